@@ -0,0 +1,188 @@
+package tiktoken
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// AnalysisSchemaVersion is the version of the schema of Analysis and
+// AnalyzeJSON. It is bumped whenever a field is renamed, removed or changes
+// meaning; new fields may be added without a bump.
+const AnalysisSchemaVersion = 1
+
+// Analysis is everything Analyze finds out about a text. Its JSON form is
+// the stable schema of AnalyzeJSON:
+//
+//	{
+//	  "schema_version": 1,
+//	  "encoding": {"name": "cl100k_base", "version": "cl100k_base/v1", "model": "", "vocab_size": 100277},
+//	  "tokens": [{"id": 15339, "text": "hello", "bytes_b64": "aGVsbG8=", "start": 0, "end": 5, "special": false, "piece": 0}],
+//	  "pieces": [{"start": 0, "end": 5, "special": false}],
+//	  "totals": {"tokens": 1, "special_tokens": 0, "pieces": 1, "bytes": 5, "chars": 5}
+//	}
+//
+// Offsets count bytes of the text as encoded, that is after input options
+// such as WithNormalization.
+type Analysis struct {
+	SchemaVersion int              `json:"schema_version"`
+	Encoding      AnalysisEncoding `json:"encoding"`
+	Tokens        []AnalysisToken  `json:"tokens"`
+	Pieces        []AnalysisPiece  `json:"pieces"`
+	Totals        AnalysisTotals   `json:"totals"`
+}
+
+// AnalysisEncoding describes the encoding of an Analysis: its Name,
+// DefinitionVersion, Model and VocabSize.
+type AnalysisEncoding struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Model     string `json:"model"`
+	VocabSize int    `json:"vocab_size"`
+}
+
+// AnalysisToken is a token of an Analysis.
+type AnalysisToken struct {
+	ID int `json:"id"`
+	// Text is the text of the token, with U+FFFD for bytes that are not
+	// valid UTF-8 on their own, such as part of a character. Bytes holds
+	// them exactly, as base64 in JSON.
+	Text  string `json:"text"`
+	Bytes []byte `json:"bytes_b64"`
+	// Start and End are the byte range of the text the token stands for.
+	Start   int  `json:"start"`
+	End     int  `json:"end"`
+	Special bool `json:"special"`
+	// Piece is the index of the piece the token is part of in Pieces.
+	Piece int `json:"piece"`
+}
+
+// AnalysisPiece is a piece of an Analysis, see PreTokenize.
+type AnalysisPiece struct {
+	Start   int  `json:"start"`
+	End     int  `json:"end"`
+	Special bool `json:"special"`
+}
+
+// AnalysisTotals are the totals of an Analysis. Bytes and Chars are those
+// of the text as encoded.
+type AnalysisTotals struct {
+	Tokens        int `json:"tokens"`
+	SpecialTokens int `json:"special_tokens"`
+	Pieces        int `json:"pieces"`
+	Bytes         int `json:"bytes"`
+	Chars         int `json:"chars"`
+}
+
+// Analyze encodes text as EncodeWithError(text, nil, nil) does and returns
+// its tokens with their text, bytes and offsets, the pieces of the split
+// pattern, totals and a description of the encoding. It fails where
+// EncodeWithError does. Tokens dropped by token filters are left out;
+// remapped ones have the id of the filter and the bytes of the original.
+func (t *Tiktoken) Analyze(text string) (Analysis, error) {
+	a, err := t.analyze(text)
+	if err != nil {
+		return Analysis{}, err
+	}
+	a.Encoding = AnalysisEncoding{
+		Name:      t.Name(),
+		Version:   t.DefinitionVersion(),
+		Model:     t.Model(),
+		VocabSize: t.VocabSize(),
+	}
+	return a, nil
+}
+
+// TokenInfo is a token with its text, bytes and byte range in the input.
+type TokenInfo = AnalysisToken
+
+// EncodeDetailed returns the tokens of Encode(text, nil, nil) with their
+// text, bytes and byte ranges, e.g. for a tokenizer playground. They are
+// the Tokens of Analyze, without describing the encoding. It panics where
+// Encode does.
+func (t *Tiktoken) EncodeDetailed(text string) []TokenInfo {
+	a, err := t.analyze(text)
+	if err != nil {
+		panic(err.Error())
+	}
+	return a.Tokens
+}
+
+// analyze is Analyze without the Encoding.
+func (t *Tiktoken) analyze(text string) (Analysis, error) {
+	if t.isClosed() {
+		return Analysis{}, ErrClosed
+	}
+	text = t.prepareText(text)
+	allowed, err := t.checkSpecial(text, nil, nil)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	a := Analysis{
+		SchemaVersion: AnalysisSchemaVersion,
+		Tokens:        []AnalysisToken{},
+		Pieces:        []AnalysisPiece{},
+	}
+	add := func(token, start, end int, special bool) {
+		b := t.bpe.tokenBytes(token)
+		id, ok := t.filterToken(token)
+		if !ok {
+			return
+		}
+		a.Tokens = append(a.Tokens, AnalysisToken{
+			ID:      id,
+			Text:    strings.ToValidUTF8(string(b), "�"),
+			Bytes:   append([]byte{}, b...),
+			Start:   start,
+			End:     end,
+			Special: special,
+			Piece:   len(a.Pieces) - 1,
+		})
+		if special {
+			a.Totals.SpecialTokens++
+		}
+	}
+	var tokens []int
+	onPiece := func(piece string, start, end int) {
+		a.Pieces = append(a.Pieces, AnalysisPiece{Start: start, End: end})
+		tokens = t.bpe.appendPiece(tokens[:0], piece)
+		for _, token := range tokens {
+			// invalid UTF-8 reads as U+FFFD, which is longer
+			to := start + len(t.bpe.tokenBytes(token))
+			if to > end {
+				to = end
+			}
+			add(token, start, to, false)
+			start = to
+		}
+	}
+	onSpecial := func(special string, start, end int) {
+		a.Pieces = append(a.Pieces, AnalysisPiece{Start: start, End: end, Special: true})
+		add(t.bpe.specialTokensEncoder[special], start, end, true)
+	}
+	t.bpe.forEachSegment(text, allowed, onPiece, onSpecial)
+
+	a.Totals.Tokens = len(a.Tokens)
+	a.Totals.Pieces = len(a.Pieces)
+	a.Totals.Bytes = len(text)
+	a.Totals.Chars = utf8.RuneCountInString(text)
+	return a, nil
+}
+
+// AnalyzeJSON returns the Analysis of text as JSON, see Analysis for the
+// schema. Special tokens such as <|endoftext|> are not escaped for HTML.
+func (t *Tiktoken) AnalyzeJSON(text string) ([]byte, error) {
+	a, err := t.Analyze(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(a); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
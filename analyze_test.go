@@ -0,0 +1,71 @@
+package tiktoken
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files")
+
+func TestAnalyzeJSON(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	enc = enc.WithDefaultAllowedSpecial("all")
+
+	// 龘 is split into two tokens that aren't valid UTF-8 on their own
+	data, err := enc.AnalyzeJSON("hello world<|endoftext|>龘")
+	ass.Nil(err)
+	var indented bytes.Buffer
+	ass.Nil(json.Indent(&indented, data, "", "  "))
+	indented.WriteByte('\n')
+	golden := "testdata/analysis.golden.json"
+	if *updateGolden {
+		ass.Nil(os.WriteFile(golden, indented.Bytes(), 0644))
+	}
+	want, err := os.ReadFile(golden)
+	ass.Nil(err)
+	ass.Equal(string(want), indented.String(), "field names and layout are frozen, see AnalysisSchemaVersion")
+
+	var a Analysis
+	ass.Nil(json.Unmarshal(data, &a))
+	var decoded []byte
+	var ids []int
+	for _, token := range a.Tokens {
+		decoded = append(decoded, token.Bytes...)
+		ids = append(ids, token.ID)
+	}
+	ass.Equal("hello world<|endoftext|>龘", string(decoded))
+	ass.Equal(enc.Encode("hello world<|endoftext|>龘", nil, nil), ids)
+	ass.Equal("�", a.Tokens[len(a.Tokens)-1].Text)
+
+	_, err = enc.WithDefaultAllowedSpecial().WithDefaultDisallowedSpecial("all").AnalyzeJSON("<|endoftext|>")
+	ass.ErrorContains(err, "disallowed special token <|endoftext|>")
+
+	empty, err := enc.Analyze("")
+	ass.Nil(err)
+	ass.NotNil(empty.Tokens)
+	ass.Zero(empty.Totals.Tokens)
+}
+
+func TestEncodeDetailed(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	text := "hello world<|endoftext|>"
+	tokens := enc.WithDefaultAllowedSpecial("all").EncodeDetailed(text)
+	ass.Equal([]TokenInfo{
+		{ID: 14990, Text: "hello", Bytes: []byte("hello"), Start: 0, End: 5},
+		{ID: 1879, Text: " world", Bytes: []byte(" world"), Start: 5, End: 11, Piece: 1},
+		{ID: 151643, Text: ENDOFTEXT, Bytes: []byte(ENDOFTEXT), Start: 11, End: 24, Special: true, Piece: 2},
+	}, tokens)
+	for _, token := range tokens {
+		ass.Equal(text[token.Start:token.End], string(token.Bytes))
+	}
+	ass.Panics(func() { enc.WithDefaultDisallowedSpecial("all").EncodeDetailed(text) })
+}
@@ -0,0 +1,155 @@
+package tiktoken
+
+import "strings"
+
+// asciiSplitter splits pure-ASCII text into exactly the pieces one of the
+// known split patterns produces, with a byte-level scanner instead of the
+// regex engine. Each field describes how a pattern differs from cl100k's:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// In ASCII, \p{L} is [A-Za-z], \p{N} is [0-9] and \s is [\t\n\v\f\r ].
+type asciiSplitter struct {
+	// foldContractions makes 's, 're etc. case-insensitive.
+	foldContractions bool
+	// anyLetterPrefix allows any non-letter, non-digit character other than
+	// \r and \n before a run of letters instead of only a space.
+	anyLetterPrefix bool
+	// maxDigits limits the length of digit runs, 0 means unlimited. Digit
+	// runs may start with a space unless digitsNoPrefix is set.
+	maxDigits      int
+	digitsNoPrefix bool
+	// newlines enables [\r\n]* after punctuation and the \s*[\r\n]+ branch.
+	newlines bool
+}
+
+var asciiSplitters = map[string]*asciiSplitter{
+	cl100kPattern: {foldContractions: true, anyLetterPrefix: true, maxDigits: 3, digitsNoPrefix: true, newlines: true},
+	qwenPattern:   {foldContractions: true, anyLetterPrefix: true, maxDigits: 1, digitsNoPrefix: true, newlines: true},
+	p50kPattern:   {},
+	testPattern:   {maxDigits: 3},
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIILetter(c byte) bool {
+	return c|0x20 >= 'a' && c|0x20 <= 'z'
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isASCIISpace(c byte) bool {
+	return c == ' ' || (c >= '\t' && c <= '\r')
+}
+
+func isASCIIOther(c byte) bool {
+	return !isASCIILetter(c) && !isASCIIDigit(c) && !isASCIISpace(c)
+}
+
+// split calls fn with every piece of text, which must be ASCII.
+func (a *asciiSplitter) split(text string, fn func(piece string)) {
+	for i := 0; i < len(text); {
+		end := a.next(text, i)
+		fn(text[i:end])
+		i = end
+	}
+}
+
+// next returns the end of the piece starting at i, trying the branches of
+// the pattern in order.
+func (a *asciiSplitter) next(text string, i int) int {
+	n := len(text)
+	c := text[i]
+
+	if c == '\'' {
+		if l := a.contraction(text[i+1:]); l > 0 {
+			return i + 1 + l
+		}
+	}
+
+	j := i
+	if a.anyLetterPrefix {
+		if !isASCIILetter(c) && !isASCIIDigit(c) && c != '\r' && c != '\n' {
+			j++
+		}
+	} else if c == ' ' {
+		j++
+	}
+	if j < n && isASCIILetter(text[j]) {
+		for j < n && isASCIILetter(text[j]) {
+			j++
+		}
+		return j
+	}
+
+	j = i
+	if c == ' ' && !a.digitsNoPrefix {
+		j++
+	}
+	if j < n && isASCIIDigit(text[j]) {
+		start := j
+		for j < n && isASCIIDigit(text[j]) && (a.maxDigits == 0 || j-start < a.maxDigits) {
+			j++
+		}
+		return j
+	}
+
+	j = i
+	if c == ' ' {
+		j++
+	}
+	if j < n && isASCIIOther(text[j]) {
+		for j < n && isASCIIOther(text[j]) {
+			j++
+		}
+		if a.newlines {
+			for j < n && (text[j] == '\r' || text[j] == '\n') {
+				j++
+			}
+		}
+		return j
+	}
+
+	// c is whitespace
+	j = i
+	for j < n && isASCIISpace(text[j]) {
+		j++
+	}
+	if a.newlines {
+		if last := strings.LastIndexAny(text[i:j], "\r\n"); last >= 0 {
+			return i + last + 1
+		}
+	}
+	if j < n && j-i >= 2 {
+		// \s+(?!\S) leaves the last space to the next piece
+		return j - 1
+	}
+	return j
+}
+
+// contractionSuffixes is in the order of the pattern's alternation.
+var contractionSuffixes = []string{"s", "t", "re", "ve", "m", "ll", "d"}
+
+// contraction returns the length of the contraction suffix at the start of
+// s, which follows an apostrophe, or 0.
+func (a *asciiSplitter) contraction(s string) int {
+	for _, suffix := range contractionSuffixes {
+		if len(s) < len(suffix) {
+			continue
+		}
+		if s[:len(suffix)] == suffix || (a.foldContractions && strings.EqualFold(s[:len(suffix)], suffix)) {
+			return len(suffix)
+		}
+	}
+	return 0
+}
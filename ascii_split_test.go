@@ -0,0 +1,77 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/dlclark/regexp2"
+	"github.com/stretchr/testify/assert"
+)
+
+func regexPieces(text string, re *regexp2.Regexp) []string {
+	pieces := []string{}
+	for _, mat := range findRegex2AllStringMatchIndex(text, re) {
+		pieces = append(pieces, text[mat[0]:mat[1]])
+	}
+	return pieces
+}
+
+func asciiPieces(text string, a *asciiSplitter) []string {
+	pieces := []string{}
+	a.split(text, func(piece string) {
+		pieces = append(pieces, piece)
+	})
+	return pieces
+}
+
+// randomASCII favors the characters the patterns treat specially.
+func randomASCII(r *rand.Rand, n int) string {
+	const interesting = "'sStTrReEvVmMlLdD \n\r\t\v\f09!.,{}"
+	b := make([]byte, n)
+	for i := range b {
+		if r.Intn(2) == 0 {
+			b[i] = interesting[r.Intn(len(interesting))]
+		} else {
+			b[i] = byte(r.Intn(128))
+		}
+	}
+	return string(b)
+}
+
+func TestASCIISplitterMatchesRegex(t *testing.T) {
+	ass := assert.New(t)
+	r := rand.New(rand.NewSource(1))
+	for pattern, splitter := range asciiSplitters {
+		re := regexp2.MustCompile(pattern, regexp2.None)
+		for _, text := range []string{"", "it's 'S 'LL 'sam", "a  b   \n\n  c\r\n", "x = 12345;\n\tif (y) {\n\t\treturn\n\t}\n", "  123 !!\n\n?"} {
+			ass.Equal(regexPieces(text, re), asciiPieces(text, splitter), "%q", text)
+		}
+		for i := 0; i < 3000; i++ {
+			text := randomASCII(r, r.Intn(40))
+			ass.Equal(regexPieces(text, re), asciiPieces(text, splitter), "%q", text)
+		}
+	}
+}
+
+func BenchmarkASCIISplit(b *testing.B) {
+	src, err := os.ReadFile("core_bpe.go")
+	if err != nil {
+		b.Fatal(err)
+	}
+	text := string(src)
+	b.Run("ascii", func(b *testing.B) {
+		splitter := asciiSplitters[cl100kPattern]
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			splitter.split(text, func(string) {})
+		}
+	})
+	b.Run("regex", func(b *testing.B) {
+		re := regexp2.MustCompile(cl100kPattern, regexp2.None)
+		b.SetBytes(int64(len(text)))
+		for i := 0; i < b.N; i++ {
+			findRegex2AllStringMatchIndex(text, re)
+		}
+	})
+}
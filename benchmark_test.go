@@ -41,3 +41,32 @@ func BenchmarkEncoding(b *testing.B) {
 	}
 
 }
+
+func BenchmarkEncodingUnbrokenString(b *testing.B) {
+	tkm, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		panic(err)
+	}
+	// 10 MB without any whitespace, like a minified bundle or a base64 blob
+	text := strings.Repeat("aB3+x9Qz", 10*1024*1024/8)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tkm.EncodeOrdinary(text)
+	}
+}
+
+func BenchmarkEncodingLongPiece(b *testing.B) {
+	tkm, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		panic(err)
+	}
+	// a single 100 KB piece, merged without the piece length cap
+	tkm = tkm.WithOptions(WithMaxPieceLength(0))
+	text := strings.Repeat("xQzkWvJr", 100*1024/8)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tkm.EncodeOrdinary(text)
+	}
+}
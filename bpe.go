@@ -5,9 +5,39 @@ import (
 )
 
 func bytePairMerge[T any](piece []byte, ranks map[string]int, f func(start, end int) T) []T {
-	parts := make([][2]int, len(piece)+1)
-	for i := 0; i < len(parts); i++ {
-		parts[i][0], parts[i][1] = i, math.MaxInt // use max int as sentinel
+	parts := bytePairMergeParts(make([][2]int, 0, len(piece)+1), piece, ranks, nil)
+	out := make([]T, len(parts)-1)
+	for i := 0; i < len(out); i++ {
+		out[i] = f(parts[i][0], parts[i+1][0])
+	}
+	return out
+}
+
+// heapMergeThreshold is the piece length from which bytePairMergeParts
+// switches to the heap-based merge. Below it the quadratic scan is faster.
+const heapMergeThreshold = 64
+
+// mergeTrace is called for every merge bytePairMergeParts makes, in order,
+// with the merged parts piece[left:mid] and piece[mid:end] and the rank of
+// piece[left:end].
+type mergeTrace func(left, mid, end, rank int)
+
+// bytePairMergeParts merges piece and returns the start offsets of the
+// resulting parts followed by len(piece), in parts[i][0]. The storage of
+// parts is reused if it is large enough. trace may be nil.
+func bytePairMergeParts(parts [][2]int, piece []byte, ranks map[string]int, trace mergeTrace) [][2]int {
+	if len(piece) >= heapMergeThreshold {
+		return bytePairMergeHeap(parts, piece, ranks, trace)
+	}
+	return bytePairMergeScan(parts, piece, ranks, trace)
+}
+
+// bytePairMergeScan rescans all pairs for the lowest rank after every
+// merge, which is quadratic in the length of piece.
+func bytePairMergeScan(parts [][2]int, piece []byte, ranks map[string]int, trace mergeTrace) [][2]int {
+	parts = parts[:0]
+	for i := 0; i <= len(piece); i++ {
+		parts = append(parts, [2]int{i, math.MaxInt}) // use max int as sentinel
 	}
 
 	getRank := func(startIdx, skip int) int {
@@ -37,6 +67,9 @@ func bytePairMerge[T any](piece []byte, ranks map[string]int, f func(start, end
 
 		if minRank < math.MaxInt {
 			i := minIdx
+			if trace != nil {
+				trace(parts[i][0], parts[i+1][0], parts[i+2][0], minRank)
+			}
 			rank := getRank(i, 1)
 			if rank >= 0 {
 				parts[i][1] = rank
@@ -56,12 +89,108 @@ func bytePairMerge[T any](piece []byte, ranks map[string]int, f func(start, end
 			break
 		}
 	}
+	return parts
+}
 
-	out := make([]T, len(parts)-1)
-	for i := 0; i < len(out); i++ {
-		out[i] = f(parts[i][0], parts[i+1][0])
+// mergeCandidate is a possible merge of the part starting at left with the
+// one after it, covering piece[left:end].
+type mergeCandidate struct {
+	rank, left, end int
+}
+
+func (c mergeCandidate) less(o mergeCandidate) bool {
+	return c.rank < o.rank || c.rank == o.rank && c.left < o.left
+}
+
+// mergeHeap is a binary min-heap of merge candidates, lowest rank first and
+// leftmost first among equal ranks, which is the order the quadratic scan
+// picks merges in.
+type mergeHeap []mergeCandidate
+
+func (h *mergeHeap) push(c mergeCandidate) {
+	*h = append(*h, c)
+	q := *h
+	for i := len(q) - 1; i > 0; {
+		p := (i - 1) / 2
+		if !q[i].less(q[p]) {
+			break
+		}
+		q[i], q[p] = q[p], q[i]
+		i = p
 	}
-	return out
+}
+
+func (h *mergeHeap) pop() mergeCandidate {
+	q := *h
+	top := q[0]
+	last := len(q) - 1
+	q[0] = q[last]
+	q = q[:last]
+	for i := 0; ; {
+		m, l, r := i, 2*i+1, 2*i+2
+		if l < len(q) && q[l].less(q[m]) {
+			m = l
+		}
+		if r < len(q) && q[r].less(q[m]) {
+			m = r
+		}
+		if m == i {
+			break
+		}
+		q[i], q[m] = q[m], q[i]
+		i = m
+	}
+	*h = q
+	return top
+}
+
+// bytePairMergeHeap produces the same parts as the quadratic scan in
+// O(n log n). Parts form a linked list over byte offsets and the candidate
+// merges sit in a heap. A candidate goes stale when either of its parts is
+// merged with something else; that is detected when it is popped, because
+// its left part is gone or no longer ends its pair at c.end.
+func bytePairMergeHeap(parts [][2]int, piece []byte, ranks map[string]int, trace mergeTrace) [][2]int {
+	n := len(piece)
+	next := make([]int, n+1)
+	prev := make([]int, n+1)
+	for i := range next {
+		next[i], prev[i] = i+1, i-1
+	}
+	merged := make([]bool, n)
+	h := make(mergeHeap, 0, n)
+	consider := func(left, end int) {
+		if rank, ok := ranks[string(piece[left:end])]; ok {
+			h.push(mergeCandidate{rank, left, end})
+		}
+	}
+	for i := 0; i+2 <= n; i++ {
+		consider(i, i+2)
+	}
+
+	for len(h) > 0 {
+		c := h.pop()
+		if merged[c.left] || next[c.left] == n || next[next[c.left]] != c.end {
+			continue
+		}
+		right := next[c.left]
+		if trace != nil {
+			trace(c.left, right, c.end, c.rank)
+		}
+		merged[right] = true
+		next[c.left], prev[c.end] = c.end, c.left
+		if c.end < n {
+			consider(c.left, next[c.end])
+		}
+		if c.left > 0 {
+			consider(prev[c.left], c.end)
+		}
+	}
+
+	parts = parts[:0]
+	for i := 0; i < n; i = next[i] {
+		parts = append(parts, [2]int{i, math.MaxInt})
+	}
+	return append(parts, [2]int{n, math.MaxInt})
 }
 
 func bytePairEncode(piece []byte, ranks map[string]int) []int {
@@ -73,3 +202,12 @@ func bytePairEncode(piece []byte, ranks map[string]int) []int {
 		return ranks[string(piece[start:end])]
 	})
 }
+
+func bytePairSplit(piece []byte, ranks map[string]int) [][]byte {
+	if len(piece) == 1 {
+		return [][]byte{piece}
+	}
+	return bytePairMerge(piece, ranks, func(start, end int) []byte {
+		return piece[start:end]
+	})
+}
@@ -0,0 +1,55 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytePairSplit(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	for _, piece := range []string{"hello", "tokenization", "你好", "!", "internationalization"} {
+		tokens := enc.BytePairEncode([]byte(piece))
+		ass.Equal(enc.EncodeOrdinary(piece), tokens, piece)
+
+		chunks := enc.BytePairSplit([]byte(piece))
+		ass.Len(chunks, len(tokens))
+		joined := []byte{}
+		for i, chunk := range chunks {
+			ass.Equal(tokens[i], enc.bpe.encoder[string(chunk)])
+			joined = append(joined, chunk...)
+		}
+		ass.Equal(piece, string(joined))
+	}
+
+	ass.Empty(enc.BytePairSplit(nil))
+	ass.Empty(enc.BytePairEncode([]byte{}))
+}
+
+func TestBytePairMergeHeapMatchesScan(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ranks := enc.bpe.encoder
+
+	r := rand.New(rand.NewSource(1))
+	pieces := []string{"", "a", "ab", "hello", "internationalization", strings.Repeat("a", 300), strings.Repeat("汉字", 100), strings.Repeat("aB3+x9Qz", 50)}
+	for i := 0; i < 200; i++ {
+		b := make([]byte, r.Intn(400))
+		alphabet := "abcdefghijklmnopqrstuvwxyz0123456789+/=_-"
+		for j := range b {
+			b[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		pieces = append(pieces, string(b))
+	}
+	for _, piece := range pieces {
+		want := bytePairMergeScan(nil, []byte(piece), ranks, nil)
+		got := bytePairMergeHeap(nil, []byte(piece), ranks, nil)
+		ass.Equal(want, got, "%q", piece)
+	}
+}
@@ -0,0 +1,107 @@
+package tiktoken
+
+// Budget keeps track of the tokens left while a prompt is assembled from
+// parts. Texts count as CountTokens does; messages count with the overheads
+// of NumTokensFromMessages for the model t was resolved for, including the
+// priming of the reply once the first message is added, so a budget holding
+// only messages spends exactly NumTokensFromMessages of them.
+//
+// A Budget is not safe for concurrent use.
+type Budget struct {
+	t     *Tiktoken
+	limit int
+	state BudgetSnapshot
+}
+
+// BudgetSnapshot is the state of a Budget saved by Snapshot.
+type BudgetSnapshot struct {
+	used     int
+	reserved int
+	messages int
+}
+
+// NewBudget returns a budget of limit tokens counted with t.
+func (t *Tiktoken) NewBudget(limit int) *Budget {
+	return &Budget{t: t, limit: limit}
+}
+
+// AddText spends the tokens of text, even if they don't fit, and returns
+// their number.
+func (b *Budget) AddText(text string) int {
+	n := b.t.CountTokens(text)
+	b.state.used += n
+	return n
+}
+
+// TryAddText spends the tokens of text if they fit and reports whether
+// they did. If not, b is unchanged.
+func (b *Budget) TryAddText(text string) bool {
+	n := b.t.CountTokens(text)
+	if n > b.Remaining() {
+		return false
+	}
+	b.state.used += n
+	return true
+}
+
+// AddMessages spends the tokens of messages, even if they don't fit, and
+// returns their number.
+func (b *Budget) AddMessages(messages ...ChatMessage) int {
+	n := b.messageTokens(messages)
+	b.state.used += n
+	b.state.messages += len(messages)
+	return n
+}
+
+// TryAddMessages spends the tokens of messages if all of them fit and
+// reports whether they did. If not, b is unchanged.
+func (b *Budget) TryAddMessages(messages ...ChatMessage) bool {
+	n := b.messageTokens(messages)
+	if n > b.Remaining() {
+		return false
+	}
+	b.state.used += n
+	b.state.messages += len(messages)
+	return true
+}
+
+func (b *Budget) messageTokens(messages []ChatMessage) int {
+	rules := messageRulesFor(b.t.Model())
+	n := 0
+	if b.state.messages == 0 && len(messages) > 0 {
+		n += rules.TokensPerReply
+	}
+	var diags []PartDiagnostic
+	for i, message := range messages {
+		n += rules.count(b.t, b.state.messages+i, message, &diags)
+	}
+	return n
+}
+
+// Reserve sets n more tokens aside, e.g. for the completion, so they are
+// not handed out to later additions.
+func (b *Budget) Reserve(n int) {
+	b.state.reserved += n
+}
+
+// Used returns the tokens spent so far, not counting reservations.
+func (b *Budget) Used() int {
+	return b.state.used
+}
+
+// Remaining returns the tokens neither spent nor reserved. It is negative
+// once an Add went over the limit.
+func (b *Budget) Remaining() int {
+	return b.limit - b.state.used - b.state.reserved
+}
+
+// Snapshot saves the state of b for Rollback.
+func (b *Budget) Snapshot() BudgetSnapshot {
+	return b.state
+}
+
+// Rollback returns b to the state saved by Snapshot, undoing the additions
+// and reservations made since.
+func (b *Budget) Rollback(s BudgetSnapshot) {
+	b.state = s
+}
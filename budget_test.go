@@ -0,0 +1,57 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudget(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	b := enc.NewBudget(20)
+	long := strings.Repeat("hello world ", 10)
+
+	ass.Equal(2, b.AddText("hello world"))
+	b.Reserve(10)
+	ass.Equal(8, b.Remaining())
+	ass.True(b.TryAddText("hello"))
+	ass.Equal(3, b.Used())
+
+	ass.False(b.TryAddText(long))
+	ass.Equal(3, b.Used(), "a refused addition changes nothing")
+
+	snap := b.Snapshot()
+	b.AddText(long)
+	b.Reserve(5)
+	ass.Less(b.Remaining(), 0)
+	b.Rollback(snap)
+	ass.Equal(7, b.Remaining())
+}
+
+func TestBudgetMessages(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := EncodingForModel("qwen2-7b")
+	ass.Nil(err)
+	messages := []ChatMessage{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Name: "example_user", Content: "hello world"},
+	}
+	want, err := NumTokensFromMessages(messages, "qwen2-7b")
+	ass.Nil(err)
+
+	b := enc.NewBudget(1000)
+	first := b.AddMessages(messages[0])
+	ass.True(b.TryAddMessages(messages[1]))
+	ass.Equal(want, b.Used(), "the reply priming is counted once")
+	single, err := NumTokensFromMessages(messages[:1], "qwen2-7b")
+	ass.Nil(err)
+	ass.Equal(single, first)
+
+	tight := enc.NewBudget(want - 1)
+	ass.False(tight.TryAddMessages(messages...))
+	ass.Equal(0, tight.Used())
+	ass.Equal(want, tight.AddMessages(messages...))
+}
@@ -0,0 +1,218 @@
+package tiktoken
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sourceSuffix names the sidecar file holding the URI a cache entry was
+// downloaded from.
+const sourceSuffix = ".source"
+
+var (
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	legacyCacheName = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	cacheName       = regexp.MustCompile(`-[0-9a-f]{12}$`)
+)
+
+// Cache directories are private to the user, so are the files in them.
+// On Windows these modes only control the read-only attribute.
+const (
+	cacheDirMode  os.FileMode = 0700
+	cacheFileMode os.FileMode = 0600
+)
+
+// cacheDir is TIKTOKEN_CACHE_DIR or DATA_GYM_CACHE_DIR if set, otherwise
+// "tiktoken" in the user cache directory, falling back to the temp dir when
+// the platform doesn't define a user cache directory.
+func cacheDir() string {
+	if os.Getenv("TIKTOKEN_CACHE_DIR") != "" {
+		return os.Getenv("TIKTOKEN_CACHE_DIR")
+	} else if os.Getenv("DATA_GYM_CACHE_DIR") != "" {
+		return os.Getenv("DATA_GYM_CACHE_DIR")
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "tiktoken")
+	}
+	return legacyTempCacheDir()
+}
+
+// legacyTempCacheDir is the default cache directory of earlier versions.
+func legacyTempCacheDir() string {
+	return filepath.Join(os.TempDir(), "data-gym-cache")
+}
+
+// cacheDirs lists every directory cache entries are read from: cacheDir and,
+// unless the location was set explicitly, the legacy temp dir.
+func cacheDirs() []string {
+	dir := cacheDir()
+	if dir == "" {
+		return nil
+	}
+	dirs := []string{dir}
+	if os.Getenv("TIKTOKEN_CACHE_DIR") == "" && os.Getenv("DATA_GYM_CACHE_DIR") == "" && legacyTempCacheDir() != dir {
+		dirs = append(dirs, legacyTempCacheDir())
+	}
+	return dirs
+}
+
+// cacheKey names the cache entry of blobpath as
+// "<sanitized file name>-<short sha1 of blobpath>", so entries can be told
+// apart by eye.
+func cacheKey(blobpath string) string {
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte(blobpath)))
+	name := path.Base(strings.ReplaceAll(blobpath, `\`, "/"))
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		name = "blob"
+	}
+	return name + "-" + sum[:12]
+}
+
+// cachePath returns the cache file for blobpath, or "" when caching is disabled.
+func cachePath(blobpath string) string {
+	dir := cacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, cacheKey(blobpath))
+}
+
+// legacyCachePaths lists where earlier versions may have stored the entry of
+// blobpath: under its bare sha1 and, in the legacy temp dir, under any name.
+// They are only read, new entries are always written to cachePath.
+func legacyCachePaths(blobpath string) []string {
+	sha := fmt.Sprintf("%x", sha1.Sum([]byte(blobpath)))
+	var paths []string
+	for i, dir := range cacheDirs() {
+		if i > 0 {
+			paths = append(paths, filepath.Join(dir, cacheKey(blobpath)))
+		}
+		paths = append(paths, filepath.Join(dir, sha))
+	}
+	return paths
+}
+
+func invalidateCache(blobpath string) error {
+	current := cachePath(blobpath)
+	if current == "" {
+		return nil
+	}
+	forgetVocab(current)
+	paths := append([]string{current, current + sourceSuffix, current + partialSuffix, current + validatorSuffix, current + staleSuffix, current + lockSuffix}, legacyCachePaths(blobpath)...)
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CacheEntry describes a rank file in the download cache.
+type CacheEntry struct {
+	Path string
+	// Source is the URI the file was downloaded from, empty for entries
+	// written by versions that didn't record it.
+	Source  string
+	Size    int64
+	ModTime time.Time
+}
+
+// CacheEntries lists the rank files in the download cache, including the
+// legacy temp dir location, sorted by path.
+// Files in the cache directory that don't look like cache entries are ignored.
+func CacheEntries() ([]CacheEntry, error) {
+	entries := []CacheEntry{}
+	for _, dir := range cacheDirs() {
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !f.Mode().IsRegular() || !isCacheEntry(f.Name()) {
+				continue
+			}
+			entry := CacheEntry{
+				Path:    filepath.Join(dir, f.Name()),
+				Size:    f.Size(),
+				ModTime: f.ModTime(),
+			}
+			if source, err := ioutil.ReadFile(entry.Path + sourceSuffix); err == nil {
+				entry.Source = string(source)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// CacheClear removes all cache entries, their sidecars, leftover
+// temporary files, interrupted downloads, stale copies and lock files from
+// the download cache.
+func CacheClear() error {
+	forgetAllVocab()
+	for _, dir := range cacheDirs() {
+		if err := clearCacheDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearCacheDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := f.Name()
+		base := name
+		switch {
+		case strings.HasSuffix(name, sourceSuffix):
+			base = strings.TrimSuffix(name, sourceSuffix)
+		case strings.HasSuffix(name, partialSuffix):
+			base = strings.TrimSuffix(name, partialSuffix)
+		case strings.HasSuffix(name, validatorSuffix):
+			base = strings.TrimSuffix(name, validatorSuffix)
+		case strings.HasSuffix(name, staleSuffix):
+			base = strings.TrimSuffix(name, staleSuffix)
+		case strings.HasSuffix(name, lockSuffix):
+			base = strings.TrimSuffix(name, lockSuffix)
+		case strings.HasSuffix(name, ".tmp"):
+			// "<entry>.<uuid>.tmp"
+			base = strings.TrimSuffix(name, ".tmp")
+			if i := strings.LastIndex(base, "."); i > 0 {
+				base = base[:i]
+			}
+		}
+		if !f.Mode().IsRegular() || !isCacheEntry(base) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func isCacheEntry(name string) bool {
+	return legacyCacheName.MatchString(name) || cacheName.MatchString(name)
+}
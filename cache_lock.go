@@ -0,0 +1,79 @@
+package tiktoken
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// lockSuffix names the file a process locks while it fills a cache entry,
+// so that processes sharing the cache directory download it once.
+const lockSuffix = ".lock"
+
+// cacheLockPoll is how often a loader waiting for another process to fill a
+// cache entry tries the lock again.
+const cacheLockPoll = 50 * time.Millisecond
+
+// cacheFills holds a channel per cache entry being filled in this process,
+// closed when it is done. File locks don't exclude goroutines of the same
+// process on every platform, and waiting on a channel beats polling.
+var cacheFills = struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}{m: map[string]chan struct{}{}}
+
+// lockCacheEntry waits until no other goroutine or process is filling the
+// cache entry at cachePath and keeps others waiting until unlock is called.
+// It only fails if ctx is done first; if the lock file can't be used, e.g.
+// in a read-only directory, the entry is filled without it.
+func lockCacheEntry(ctx context.Context, cachePath string) (unlock func(), err error) {
+	for {
+		cacheFills.Lock()
+		done, busy := cacheFills.m[cachePath]
+		if !busy {
+			done = make(chan struct{})
+			cacheFills.m[cachePath] = done
+		}
+		cacheFills.Unlock()
+		if !busy {
+			break
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		cacheFills.Lock()
+		close(cacheFills.m[cachePath])
+		delete(cacheFills.m, cachePath)
+		cacheFills.Unlock()
+	}
+
+	unlockFile, err := lockFile(ctx, cachePath+lockSuffix)
+	if err != nil {
+		if ctx.Err() != nil {
+			release()
+			return nil, ctx.Err()
+		}
+		return release, nil
+	}
+	return func() {
+		unlockFile()
+		release()
+	}, nil
+}
+
+// waitLock sleeps before the next attempt to take a lock, or returns the
+// error of ctx if it is done first.
+func waitLock(ctx context.Context) error {
+	timer := time.NewTimer(cacheLockPoll)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package tiktoken
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// cacheLockStale is the age after which a lock file is taken to be left
+// behind by a process that died while filling the cache entry.
+const cacheLockStale = 10 * time.Minute
+
+// lockFile creates the file at path exclusively and removes it to unlock,
+// for platforms without flock. A lock file older than cacheLockStale is
+// removed and taken over.
+func lockFile(ctx context.Context, path string) (unlock func(), err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, cacheFileMode)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > cacheLockStale {
+			os.Remove(path)
+			continue
+		}
+		if err := waitLock(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
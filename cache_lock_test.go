@@ -0,0 +1,61 @@
+package tiktoken
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentCacheFill(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	var fetched atomic.Int32
+	fetcher := FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+		fetched.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return []byte("YQ== 0\nYg== 1\n"), nil
+	})
+
+	// separate loaders, as in separate processes, share the cache directory
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ranks, err := NewDefaultBpeLoader(WithFetcher("mem", fetcher)).LoadTiktokenBpe("mem://vocab/test.tiktoken")
+			ass.Nil(err)
+			ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+		}()
+	}
+	wg.Wait()
+	ass.Equal(int32(1), fetched.Load())
+}
+
+func TestLockFile(t *testing.T) {
+	ass := assert.New(t)
+	path := filepath.Join(t.TempDir(), "entry")
+
+	unlock, err := lockFile(context.Background(), path+lockSuffix)
+	ass.Nil(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*cacheLockPoll)
+	defer cancel()
+	_, err = lockFile(ctx, path+lockSuffix)
+	ass.ErrorIs(err, context.DeadlineExceeded, "the lock is held")
+
+	unlock()
+	unlock, err = lockFile(context.Background(), path+lockSuffix)
+	ass.Nil(err)
+	unlock()
+
+	// in-process waiters give up with their context too
+	release, err := lockCacheEntry(context.Background(), path)
+	ass.Nil(err)
+	_, err = lockCacheEntry(ctx, path)
+	ass.ErrorIs(err, context.DeadlineExceeded)
+	release()
+}
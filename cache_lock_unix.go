@@ -0,0 +1,62 @@
+//go:build unix
+
+package tiktoken
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock of the file at path, which the kernel
+// releases if the process dies, and removes the file to unlock. A process
+// that locked the file just before it was removed finds that its lock is
+// of a file no longer at path and starts over.
+func lockFile(ctx context.Context, path string) (unlock func(), err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, cacheFileMode)
+		if err != nil {
+			return nil, err
+		}
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			current, err := isFileAt(f, path)
+			if current {
+				return func() {
+					os.Remove(path)
+					syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+					f.Close()
+				}, nil
+			}
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		f.Close()
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			return nil, err
+		}
+		if err := waitLock(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isFileAt reports whether the open file f is the file at path.
+func isFileAt(f *os.File, path string) (bool, error) {
+	opened, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(opened, fi), nil
+}
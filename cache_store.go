@@ -0,0 +1,214 @@
+package tiktoken
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// CacheStore keeps the rank files the default loader fetched, keyed by
+// their URI, see WithCacheStore. Implementations must be safe for
+// concurrent use.
+type CacheStore interface {
+	// Has reports whether the rank file uri is stored.
+	Has(ctx context.Context, uri string) bool
+	// Get returns the stored contents of the rank file uri, or an error
+	// wrapping fs.ErrNotExist if there are none.
+	Get(ctx context.Context, uri string) ([]byte, error)
+	// Put stores contents as the rank file uri, replacing what was stored
+	// for it.
+	Put(ctx context.Context, uri string, contents []byte) error
+}
+
+// WithCacheStore makes the loader keep the rank files it fetches in store
+// instead of the cache directory, e.g. NewMemoryCacheStore in a read-only
+// container, NopCacheStore to fetch every time, or a store of your own
+// backed by object storage. A nil store is NopCacheStore.
+//
+// With a store other than DiskCacheStore, downloads are not resumed, and
+// CacheEntries and CacheClear don't see what it holds. A failing Put
+// doesn't fail the load, which then fetches the file again next time.
+// RefreshEncoding fetches the rank file again, replacing the stored copy,
+// and falls back to it as WithStaleIfError says.
+func WithCacheStore(store CacheStore) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		if store == nil {
+			store = nopCacheStore{}
+		}
+		l.store = store
+	}
+}
+
+// DiskCacheStore returns the store of the default loader: a file per rank
+// file in the cache directory, TIKTOKEN_CACHE_DIR if set. The loader uses
+// it to also resume interrupted downloads and to keep the previous copy
+// aside during RefreshEncoding. With GOOS=js, where there is no file
+// system, the default is a memory store shared by all loaders instead.
+func DiskCacheStore() CacheStore {
+	return diskCacheStore{}
+}
+
+type diskCacheStore struct{}
+
+func (diskCacheStore) Has(ctx context.Context, uri string) bool {
+	_, err := diskCachedPath(uri)
+	return err == nil
+}
+
+func (diskCacheStore) Get(ctx context.Context, uri string) ([]byte, error) {
+	path, err := diskCachedPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+func (diskCacheStore) Put(ctx context.Context, uri string, contents []byte) error {
+	path := cachePath(uri)
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), cacheDirMode); err != nil {
+		return err
+	}
+	tmpFilename := path + "." + uuid.New().String() + ".tmp"
+	if err := ioutil.WriteFile(tmpFilename, contents, cacheFileMode); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	// the sidecar only helps humans and CacheEntries, a failure is harmless
+	ioutil.WriteFile(path+sourceSuffix, []byte(uri), cacheFileMode)
+	return os.Rename(tmpFilename, path)
+}
+
+// diskCachedPath returns the cache file holding uri, in its current or a
+// legacy location.
+func diskCachedPath(uri string) (string, error) {
+	path := cachePath(uri)
+	if path == "" {
+		return "", fmt.Errorf("%s: caching is disabled: %w", uri, fs.ErrNotExist)
+	}
+	for _, p := range append([]string{path}, legacyCachePaths(uri)...) {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s: not in the cache: %w", uri, fs.ErrNotExist)
+}
+
+// NewMemoryCacheStore returns a store keeping rank files in memory, for
+// the lifetime of the process. Parsed vocabularies are shared between
+// encodings anyway, so it mainly saves fetching a file again after
+// RefreshEncoding failed or Close released it.
+func NewMemoryCacheStore() CacheStore {
+	return &memoryCacheStore{files: map[string][]byte{}}
+}
+
+type memoryCacheStore struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func (s *memoryCacheStore) Has(ctx context.Context, uri string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.files[uri]
+	return ok
+}
+
+func (s *memoryCacheStore) Get(ctx context.Context, uri string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	contents, ok := s.files[uri]
+	if !ok {
+		return nil, fmt.Errorf("%s: not in the cache: %w", uri, fs.ErrNotExist)
+	}
+	return contents, nil
+}
+
+func (s *memoryCacheStore) Put(ctx context.Context, uri string, contents []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[uri] = contents
+	return nil
+}
+
+// NopCacheStore returns a store that keeps nothing, so the loader fetches
+// a rank file every time it loads it.
+func NopCacheStore() CacheStore {
+	return nopCacheStore{}
+}
+
+type nopCacheStore struct{}
+
+func (nopCacheStore) Has(ctx context.Context, uri string) bool { return false }
+
+func (nopCacheStore) Get(ctx context.Context, uri string) ([]byte, error) {
+	return nil, fmt.Errorf("%s: not in the cache: %w", uri, fs.ErrNotExist)
+}
+
+func (nopCacheStore) Put(ctx context.Context, uri string, contents []byte) error { return nil }
+
+// refetch makes the next load of blobpath from a store other than the disk
+// fetch it again, falling back to the stored copy on a network error if
+// fallback; see markStale and InvalidateCache.
+func (l *defaultBpeLoader) refetch(blobpath string, fallback bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.refetching == nil {
+		l.refetching = map[string]bool{}
+	}
+	l.refetching[blobpath] = fallback
+}
+
+// readStoreCached is readFileCached for a store other than the disk.
+func (l *defaultBpeLoader) readStoreCached(ctx context.Context, blobpath string) ([]byte, bool, error) {
+	l.mu.Lock()
+	fallback, refetching := l.refetching[blobpath]
+	l.mu.Unlock()
+	if !refetching && l.store.Has(ctx, blobpath) {
+		contents, err := l.store.Get(ctx, blobpath)
+		if err == nil {
+			err = checkFileSize(int64(len(contents)), l.limits.MaxFileBytes)
+		}
+		if err != nil {
+			return nil, true, fmt.Errorf("cached %s: %w", blobpath, err)
+		}
+		if checkRankFileHash(blobpath, contents) == nil {
+			return contents, true, nil
+		}
+		// a corrupted copy is fetched again and replaced
+	}
+
+	contents, err := l.readFile(ctx, blobpath)
+	if err == nil {
+		err = checkRankFileHash(blobpath, contents)
+	}
+	if err != nil {
+		if refetching && fallback && l.staleIfError && isNetworkError(err) {
+			if stale, getErr := l.store.Get(ctx, blobpath); getErr == nil {
+				l.doneRefetching(blobpath)
+				if l.onStale != nil {
+					l.onStale(blobpath, err)
+				}
+				return stale, true, nil
+			}
+		}
+		return nil, false, err
+	}
+	l.doneRefetching(blobpath)
+	l.store.Put(ctx, blobpath, contents)
+	return contents, false, nil
+}
+
+func (l *defaultBpeLoader) doneRefetching(blobpath string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.refetching, blobpath)
+}
@@ -0,0 +1,8 @@
+//go:build !js
+
+package tiktoken
+
+// defaultCacheStore is the store of NewDefaultBpeLoader.
+func defaultCacheStore() CacheStore {
+	return diskCacheStore{}
+}
@@ -0,0 +1,12 @@
+//go:build js
+
+package tiktoken
+
+// jsCacheStore is shared by the loaders in the browser, which has no file
+// system to cache in.
+var jsCacheStore = NewMemoryCacheStore()
+
+// defaultCacheStore is the store of NewDefaultBpeLoader.
+func defaultCacheStore() CacheStore {
+	return jsCacheStore
+}
@@ -0,0 +1,106 @@
+package tiktoken
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore is a memory store whose Put fails.
+type failingStore struct{ CacheStore }
+
+func (failingStore) Put(context.Context, string, []byte) error {
+	return errors.New("read-only")
+}
+
+func TestWithCacheStore(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	fetched := 0
+	var fetchErr error
+	fetcher := FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+		fetched++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return []byte("YQ== 0\n"), nil
+	})
+	const uri = "mem://vocab/a.tiktoken"
+
+	store := NewMemoryCacheStore()
+	var stale []error
+	loader := NewDefaultBpeLoader(WithFetcher("mem", fetcher), WithCacheStore(store),
+		WithStaleHandler(func(_ string, err error) { stale = append(stale, err) }))
+	for i := 0; i < 2; i++ {
+		ranks, err := loader.LoadTiktokenBpe(uri)
+		ass.Nil(err)
+		ass.Equal(map[string]int{"a": 0}, ranks)
+	}
+	ass.Equal(1, fetched)
+	ass.True(store.Has(context.Background(), uri))
+	files, err := os.ReadDir(dir)
+	ass.Nil(err)
+	ass.Empty(files, "nothing is written to the cache directory")
+
+	// a refresh fetches again and falls back to the stored copy
+	ass.Nil(loader.(cacheRevalidator).markStale(uri))
+	fetchErr = &DownloadError{URI: uri, StatusCode: 503, Status: "503 Service Unavailable"}
+	ranks, err := loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0}, ranks)
+	ass.Equal(2, fetched)
+	ass.Len(stale, 1)
+	// an invalidated copy is not served
+	ass.Nil(loader.(CacheInvalidator).InvalidateCache(uri))
+	_, err = loader.LoadTiktokenBpe(uri)
+	ass.ErrorAs(err, new(*DownloadError))
+	fetchErr = nil
+	_, err = loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(4, fetched)
+
+	fetched = 0
+	for _, store := range []CacheStore{NopCacheStore(), nil, failingStore{NewMemoryCacheStore()}} {
+		loader := NewDefaultBpeLoader(WithFetcher("mem", fetcher), WithCacheStore(store))
+		for i := 0; i < 2; i++ {
+			_, err := loader.LoadTiktokenBpe(uri)
+			ass.Nil(err)
+		}
+	}
+	ass.Equal(6, fetched, "nothing is kept")
+
+	_, err = NewDefaultBpeLoader(WithOffline(), WithCacheStore(NopCacheStore())).LoadTiktokenBpe("https://example.com/a.tiktoken")
+	ass.ErrorIs(err, ErrOfflineMode)
+	ass.ErrorContains(err, "not in the cache store")
+}
+
+func TestDiskCacheStore(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	ctx := context.Background()
+	store := DiskCacheStore()
+	const uri = "https://example.com/a.tiktoken"
+
+	ass.False(store.Has(ctx, uri))
+	_, err := store.Get(ctx, uri)
+	ass.ErrorIs(err, fs.ErrNotExist)
+	ass.Nil(store.Put(ctx, uri, []byte("YQ== 0\n")))
+	ass.True(store.Has(ctx, uri))
+	contents, err := store.Get(ctx, uri)
+	ass.Nil(err)
+	ass.Equal("YQ== 0\n", string(contents))
+
+	entries, err := CacheEntries()
+	ass.Nil(err)
+	ass.Len(entries, 1)
+	ass.Equal(uri, entries[0].Source)
+	// the default loader reads what the store holds
+	ranks, err := NewDefaultBpeLoader(WithOffline()).LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0}, ranks)
+}
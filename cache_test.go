@@ -0,0 +1,115 @@
+package tiktoken
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheKey(t *testing.T) {
+	ass := assert.New(t)
+	url := "https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken"
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte(url)))
+	ass.Equal("cl100k_base.tiktoken-"+sum[:12], cacheKey(url))
+	ass.Regexp(`^my_vocab_v2.tiktoken-[0-9a-f]{12}$`, cacheKey("s3://bucket/dir/my vocab@v2.tiktoken?versionId=3"))
+	ass.Regexp(`^example.com-[0-9a-f]{12}$`, cacheKey("https://example.com/"))
+	ass.Regexp(`^blob-[0-9a-f]{12}$`, cacheKey("?"))
+	ass.NotEqual(cacheKey("https://a.example.com/x.tiktoken"), cacheKey("https://b.example.com/x.tiktoken"))
+}
+
+func TestCacheEntriesAndClear(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "cache")
+	t.Setenv("TIKTOKEN_CACHE_DIR", cache)
+	rankFile := filepath.Join(dir, "test.tiktoken")
+	writeRankFile(t, rankFile, "a", "b")
+
+	entries, err := CacheEntries()
+	ass.Nil(err)
+	ass.Empty(entries)
+
+	_, err = NewDefaultBpeLoader().LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+
+	// an entry written under the old naming scheme is still used
+	legacySource := filepath.Join(dir, "legacy.tiktoken")
+	legacyPath := legacyCachePaths(legacySource)[0]
+	ass.Nil(os.WriteFile(legacyPath, []byte("Yw== 0\n"), 0600))
+	ranks, err := NewDefaultBpeLoader().LoadTiktokenBpe(legacySource)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"c": 0}, ranks)
+
+	unrelated := filepath.Join(cache, "notes.txt")
+	ass.Nil(os.WriteFile(unrelated, []byte("keep me"), 0600))
+
+	entries, err = CacheEntries()
+	ass.Nil(err)
+	ass.Len(entries, 2)
+	sources := map[string]CacheEntry{}
+	for _, e := range entries {
+		sources[e.Source] = e
+	}
+	ass.Equal(cachePath(rankFile), sources[rankFile].Path)
+	ass.Equal(int64(len("YQ== 0\nYg== 1\n")), sources[rankFile].Size)
+	ass.False(sources[rankFile].ModTime.IsZero())
+	ass.Equal(legacyPath, sources[""].Path)
+
+	ass.Nil(CacheClear())
+	entries, err = CacheEntries()
+	ass.Nil(err)
+	ass.Empty(entries)
+	_, err = os.Stat(cachePath(rankFile) + sourceSuffix)
+	ass.True(os.IsNotExist(err))
+	_, err = os.Stat(cachePath(rankFile) + lockSuffix)
+	ass.True(os.IsNotExist(err))
+	_, err = os.Stat(unrelated)
+	ass.Nil(err, "files that are not cache entries are left alone")
+}
+
+func TestDefaultCacheDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CACHE_HOME")
+	}
+	ass := assert.New(t)
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", "")
+	t.Setenv("DATA_GYM_CACHE_DIR", "")
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "xdg"))
+	t.Setenv("TMPDIR", filepath.Join(dir, "tmp"))
+	ass.Equal(filepath.Join(dir, "xdg", "tiktoken"), cacheDir())
+
+	// entries in the old temp dir location are read but not rewritten
+	legacySource := filepath.Join(dir, "legacy.tiktoken")
+	legacyPath := filepath.Join(dir, "tmp", "data-gym-cache", fmt.Sprintf("%x", sha1.Sum([]byte(legacySource))))
+	ass.Nil(os.MkdirAll(filepath.Dir(legacyPath), 0700))
+	ass.Nil(os.WriteFile(legacyPath, []byte("Yw== 0\n"), 0600))
+	ranks, err := NewDefaultBpeLoader().LoadTiktokenBpe(legacySource)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"c": 0}, ranks)
+	_, err = os.Stat(cachePath(legacySource))
+	ass.True(os.IsNotExist(err))
+
+	rankFile := filepath.Join(dir, "test.tiktoken")
+	writeRankFile(t, rankFile, "a")
+	_, err = NewDefaultBpeLoader().LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	info, err := os.Stat(cachePath(rankFile))
+	ass.Nil(err)
+	ass.Equal(os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Stat(cacheDir())
+	ass.Nil(err)
+	ass.Equal(os.FileMode(0700), info.Mode().Perm())
+
+	entries, err := CacheEntries()
+	ass.Nil(err)
+	ass.Len(entries, 2)
+	ass.Nil(CacheClear())
+	_, err = os.Stat(legacyPath)
+	ass.True(os.IsNotExist(err))
+}
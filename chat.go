@@ -0,0 +1,198 @@
+package tiktoken
+
+import (
+	"fmt"
+	"math"
+)
+
+// ChatMessage is a chat completion message as counted by
+// NumTokensFromMessages. Content holds plain text content; messages made of
+// several parts, e.g. text and images, set Parts instead.
+type ChatMessage struct {
+	Role    string
+	Name    string
+	Content string
+	Parts   []ContentPart
+}
+
+// Content part types known to NumTokensFromMessages.
+const (
+	ContentPartText     = "text"
+	ContentPartImageURL = "image_url"
+)
+
+// ContentPart is one part of a multi-part message: Text for a "text" part,
+// ImageURL for an "image_url" part.
+type ContentPart struct {
+	Type     string
+	Text     string
+	ImageURL *ImageURL
+}
+
+// ImageURL describes an image part. Detail is "low", "high" or "auto", the
+// empty string meaning "auto". Width and Height are the pixel dimensions of
+// the image; they are needed to price high detail images.
+type ImageURL struct {
+	URL    string
+	Detail string
+	Width  int
+	Height int
+}
+
+// PartDiagnostic reports a content part that NumTokensFromMessages could not
+// price exactly.
+type PartDiagnostic struct {
+	Message int // index of the message
+	Part    int // index of the part in the message
+	Reason  string
+}
+
+func (d PartDiagnostic) String() string {
+	return fmt.Sprintf("message %d, part %d: %s", d.Message, d.Part, d.Reason)
+}
+
+var imageTokenCost = DefaultImageTokenCost
+
+// SetImageTokenCost replaces the function pricing image parts, for when the
+// published formula changes. Passing nil restores DefaultImageTokenCost.
+func SetImageTokenCost(cost func(img ImageURL) int) {
+	if cost == nil {
+		cost = DefaultImageTokenCost
+	}
+	sl.Lock()
+	defer sl.Unlock()
+	imageTokenCost = cost
+}
+
+// DefaultImageTokenCost prices an image as published for the GPT-4 vision
+// models: 85 tokens at low detail. At high detail the image is scaled to fit
+// into 2048x2048, then down so its shorter side is at most 768 pixels, and
+// each 512 pixel tile costs another 170 tokens. "auto" is priced as high,
+// the most the model may pick. Without dimensions an image is priced as low.
+func DefaultImageTokenCost(img ImageURL) int {
+	const base, perTile = 85, 170
+	if img.Detail == "low" || img.Width <= 0 || img.Height <= 0 {
+		return base
+	}
+	w, h := float64(img.Width), float64(img.Height)
+	if long := math.Max(w, h); long > 2048 {
+		w, h = w*2048/long, h*2048/long
+	}
+	if short := math.Min(w, h); short > 768 {
+		w, h = w*768/short, h*768/short
+	}
+	return base + perTile*int(math.Ceil(w/512))*int(math.Ceil(h/512))
+}
+
+// NumTokensFromMessages counts the tokens a chat completion request for
+// model spends on messages, including the per-message overhead and the
+// priming of the reply, following the OpenAI cookbook. Unknown content
+// part types count as zero, use NumTokensFromMessagesWithDiagnostics to
+// find out about them.
+func NumTokensFromMessages(messages []ChatMessage, model string) (int, error) {
+	n, _, err := NumTokensFromMessagesWithDiagnostics(messages, model)
+	return n, err
+}
+
+// CountMessagesTokens is NumTokensFromMessages with the model first. The
+// overhead per message and per name follows the table of
+// GetMessageOverhead, which covers gpt-3.5-turbo, gpt-4, gpt-4o and their
+// snapshots.
+func CountMessagesTokens(model string, messages []ChatMessage) (int, error) {
+	return NumTokensFromMessages(messages, model)
+}
+
+// NumTokensFromMessagesWithDiagnostics is like NumTokensFromMessages but
+// also reports content parts of unknown type and images whose price had to
+// be guessed.
+func NumTokensFromMessagesWithDiagnostics(messages []ChatMessage, model string) (int, []PartDiagnostic, error) {
+	tkm, err := EncodingForModel(model)
+	if err != nil {
+		return 0, nil, fmt.Errorf("encoding for model: %w", err)
+	}
+	n, diags := NumTokensFromMessagesWith(tkm, messages, tkm.Model())
+	return n, diags, nil
+}
+
+// NumTokensFromMessagesWith is NumTokensFromMessagesWithDiagnostics
+// counting the text of messages with enc, e.g. a tiktokentest.FakeEncoder,
+// instead of the encoding of model, which then only selects the overhead
+// per message, see GetMessageOverhead. For a prefilled reply, add the
+// tokens of the prefill as NumTokensFromMessagesWithPrefill does.
+func NumTokensFromMessagesWith(enc Encoder, messages []ChatMessage, model string) (int, []PartDiagnostic) {
+	if resolved, _, err := encodingNameForModel(model); err == nil {
+		model = resolved
+	}
+	rules := messageRulesFor(model)
+	var diags []PartDiagnostic
+	numTokens := 0
+	for i, message := range messages {
+		numTokens += rules.count(enc, i, message, &diags)
+	}
+	numTokens += rules.TokensPerReply
+	return numTokens, diags
+}
+
+// NumTokensFromMessagesWithPrefill counts the prompt tokens of a request
+// whose reply is prefilled: the assistant turn is opened as the priming of the
+// reply does and continues with prefill, without the end-of-message framing
+// of a complete message, so the prompt is NumTokensFromMessages plus the
+// tokens of prefill. The continuation the model generates counts toward the
+// completion; the prefill does not.
+func NumTokensFromMessagesWithPrefill(messages []ChatMessage, prefill string, model string) (int, error) {
+	tkm, err := EncodingForModel(model)
+	if err != nil {
+		return 0, fmt.Errorf("encoding for model: %w", err)
+	}
+	n, _, err := NumTokensFromMessagesWithDiagnostics(messages, tkm.Model())
+	if err != nil {
+		return 0, err
+	}
+	return n + tkm.CountTokens(prefill), nil
+}
+
+// messageRules are how the messages of a request for a model are counted.
+type messageRules struct {
+	MessageOverhead
+	imageCost func(img ImageURL) int
+}
+
+// messageRulesFor reads the current settings, so changes made with
+// SetMessageOverhead and SetImageTokenCost apply to the next count.
+func messageRulesFor(model string) messageRules {
+	rules := messageRules{MessageOverhead: messageOverheadFor(model)}
+	sl.RLock()
+	rules.imageCost = imageTokenCost
+	sl.RUnlock()
+	return rules
+}
+
+// count returns the tokens of message, the i-th of a request, and appends
+// the parts it couldn't price exactly to diags.
+func (r messageRules) count(enc Encoder, i int, message ChatMessage, diags *[]PartDiagnostic) int {
+	numTokens := r.TokensPerMessage
+	numTokens += enc.CountTokens(message.Role)
+	numTokens += enc.CountTokens(message.Content)
+	if message.Name != "" {
+		numTokens += enc.CountTokens(message.Name) + r.TokensPerName
+	}
+	for j, part := range message.Parts {
+		switch part.Type {
+		case ContentPartText:
+			numTokens += enc.CountTokens(part.Text)
+		case ContentPartImageURL:
+			if part.ImageURL == nil {
+				*diags = append(*diags, PartDiagnostic{i, j, "image part without image_url"})
+				continue
+			}
+			img := *part.ImageURL
+			if img.Detail != "low" && (img.Width <= 0 || img.Height <= 0) {
+				*diags = append(*diags, PartDiagnostic{i, j, "image dimensions unknown"})
+			}
+			numTokens += r.imageCost(img)
+		default:
+			*diags = append(*diags, PartDiagnostic{i, j, fmt.Sprintf("unknown content part type %q", part.Type)})
+		}
+	}
+	return numTokens
+}
@@ -0,0 +1,125 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultImageTokenCost(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal(85, DefaultImageTokenCost(ImageURL{Detail: "low", Width: 4096, Height: 4096}))
+	ass.Equal(85, DefaultImageTokenCost(ImageURL{Detail: "high"}), "no dimensions")
+	ass.Equal(255, DefaultImageTokenCost(ImageURL{Detail: "high", Width: 512, Height: 512}))
+	ass.Equal(765, DefaultImageTokenCost(ImageURL{Detail: "high", Width: 1024, Height: 1024}))
+	ass.Equal(1105, DefaultImageTokenCost(ImageURL{Detail: "high", Width: 2048, Height: 4096}))
+	ass.Equal(1105, DefaultImageTokenCost(ImageURL{Width: 2048, Height: 4096}), "auto is priced as high")
+}
+
+func TestNumTokensFromMessages(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := EncodingForModel("qwen")
+	ass.Nil(err)
+
+	messages := []ChatMessage{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Name: "bob", Parts: []ContentPart{
+			{Type: ContentPartText, Text: "What is in this image?"},
+			{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/a.png", Detail: "high", Width: 1024, Height: 1024}},
+			{Type: "input_audio"},
+			{Type: ContentPartImageURL, ImageURL: &ImageURL{URL: "https://example.com/b.png"}},
+		}},
+	}
+	want := 3 + enc.CountTokens("system") + enc.CountTokens("You are a helpful assistant.") +
+		3 + enc.CountTokens("user") + enc.CountTokens("bob") + 1 + enc.CountTokens("What is in this image?") + 765 + 85 +
+		3
+	n, diags, err := NumTokensFromMessagesWithDiagnostics(messages, "qwen")
+	ass.Nil(err)
+	ass.Equal(want, n)
+	ass.Equal([]PartDiagnostic{
+		{Message: 1, Part: 2, Reason: `unknown content part type "input_audio"`},
+		{Message: 1, Part: 3, Reason: "image dimensions unknown"},
+	}, diags)
+	ass.Equal(`message 1, part 2: unknown content part type "input_audio"`, diags[0].String())
+
+	SetImageTokenCost(func(ImageURL) int { return 1 })
+	defer SetImageTokenCost(nil)
+	n, err = NumTokensFromMessages(messages, "qwen")
+	ass.Nil(err)
+	ass.Equal(want-765-85+2, n)
+	n2, err := CountMessagesTokens("qwen", messages)
+	ass.Nil(err)
+	ass.Equal(n, n2)
+
+	_, err = NumTokensFromMessages(messages, "nope")
+	ass.NotNil(err)
+}
+
+func TestMessageOverhead(t *testing.T) {
+	ass := assert.New(t)
+	o, err := GetMessageOverhead("gpt-3.5-turbo-0301")
+	ass.Nil(err)
+	ass.Equal(MessageOverhead{TokensPerMessage: 4, TokensPerName: -1, TokensPerReply: 3}, o)
+	o, err = GetMessageOverhead("qwen2-7b")
+	ass.Nil(err)
+	ass.Equal(MessageOverhead{TokensPerMessage: 3, TokensPerName: 1, TokensPerReply: 3}, o)
+	for _, model := range []string{"gpt-3.5-turbo", "gpt-3.5-turbo-0613", "gpt-4", "gpt-4-0314", "gpt-4o", "gpt-4o-2024-08-06"} {
+		o, err = GetMessageOverhead(model)
+		ass.Nil(err)
+		ass.Equal(MessageOverhead{TokensPerMessage: 3, TokensPerName: 1, TokensPerReply: 3}, o, model)
+	}
+	_, err = GetMessageOverhead("no-such-model")
+	ass.ErrorIs(err, ErrModelNotFound)
+
+	messages := []ChatMessage{{Role: "user", Name: "bob", Content: "hello world"}}
+	before, err := NumTokensFromMessages(messages, "qwen2-7b")
+	ass.Nil(err)
+	b, err := EncodingForModel("qwen2-7b")
+	ass.Nil(err)
+	budget := b.NewBudget(100)
+
+	SetMessageOverhead("qwen2", MessageOverhead{TokensPerMessage: 5, TokensPerName: 2, TokensPerReply: 4})
+	defer func() {
+		sl.Lock()
+		delete(messageOverheads, "qwen2")
+		sl.Unlock()
+	}()
+	after, err := NumTokensFromMessages(messages, "qwen2-7b")
+	ass.Nil(err)
+	ass.Equal(before+2+1+1, after, "the override applies to dated names at once")
+	ass.Equal(after, budget.AddMessages(messages...), "budgets read the table too")
+	same, err := NumTokensFromMessages(messages, "qwen2.5-7b")
+	ass.Nil(err)
+	ass.Equal(before, same, "qwen2.5 is not a qwen2 snapshot")
+}
+
+func TestNumTokensFromMessagesWithPrefill(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := EncodingForModel("qwen")
+	ass.Nil(err)
+
+	messages := []ChatMessage{
+		{Role: "system", Content: "Answer in JSON."},
+		{Role: "user", Content: "List three colors."},
+	}
+	prompt, err := NumTokensFromMessages(messages, "qwen")
+	ass.Nil(err)
+
+	// the prefill continues the primed assistant turn: its tokens, and no
+	// message framing or second priming
+	prefill := `{"colors": [`
+	n, err := NumTokensFromMessagesWithPrefill(messages, prefill, "qwen")
+	ass.Nil(err)
+	ass.Equal(prompt+enc.CountTokens(prefill), n)
+
+	asMessage, err := NumTokensFromMessages(append(messages, ChatMessage{Role: "assistant", Content: prefill}), "qwen")
+	ass.Nil(err)
+	ass.Equal(asMessage-3-enc.CountTokens("assistant"), n)
+
+	n, err = NumTokensFromMessagesWithPrefill(messages, "", " Qwen ")
+	ass.Nil(err)
+	ass.Equal(prompt, n)
+
+	_, err = NumTokensFromMessagesWithPrefill(messages, prefill, "nope")
+	ass.NotNil(err)
+}
@@ -0,0 +1,116 @@
+package tiktoken
+
+import "errors"
+
+// ErrClosed is returned by the methods of a Tiktoken after Close. Methods
+// that can't return an error panic with it instead, like Encode does for
+// disallowed special tokens.
+var ErrClosed = errors.New("tiktoken: encoding is closed")
+
+// Close removes t from the package caches and drops its lookup tables, so
+// the memory can be reclaimed once nothing else references t. A later
+// GetEncoding or EncodingForModel loads the encoding again into a new
+// instance. Closing a closed encoding returns ErrClosed. Rank tables shared
+// with another cached encoding, like those of p50k_base with p50k_edit,
+// stay in memory until that one is closed as well.
+//
+// Instances returned by EncodingForModel and WithOptions share their tables
+// with the cached encoding and are closed along with it. Close must not run
+// while other goroutines still use t or such a copy: calls that start after
+// Close fail with ErrClosed, calls in progress may observe the tables being
+// dropped.
+//
+// Methods returning an error return ErrClosed once t is closed. Those that
+// can't panic with it: Encode, EncodeOrdinary, CountTokens, the Truncate
+// and Split methods, Decode, DecodeBytes, DecodeLossy, DecodeFiltered,
+// DecodeTokensBytes, EncodeWithDiagnostics, ExplainMerges, BytePairSplit,
+// BytePairEncode, the vocabulary methods such as Rank, VocabSize and
+// SpecialTokens, Session.Encode and Session.CountTokens, and
+// IncrementalEncoder.Append.
+func (t *Tiktoken) Close() error {
+	if !t.bpe.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	sharesTables := func(tk *Tiktoken) bool {
+		return tk.bpe.closed == t.bpe.closed
+	}
+
+	// release holds each CoreBPE sharing the tables once, cached whether
+	// the package built the Encoding of t
+	release := map[*CoreBPE]bool{t.bpe: true}
+	cached := false
+	tl.Lock()
+	for name, tk := range tiktokenMap {
+		if sharesTables(tk) {
+			release[tk.bpe], cached = true, true
+			delete(tiktokenMap, name)
+			setLoaded(name, false)
+		}
+	}
+	tl.Unlock()
+	ll.Lock()
+	for key, tk := range loaderTiktokenMap {
+		if sharesTables(tk) {
+			release[tk.bpe], cached = true, true
+			delete(loaderTiktokenMap, key)
+		}
+	}
+	ll.Unlock()
+	l.Lock()
+	for name, enc := range encodingMap {
+		if enc == t.pbeEncoding {
+			cached = true
+			delete(encodingMap, name)
+		}
+	}
+	l.Unlock()
+
+	forgetUnusedRankTables(t.bpe.encoder)
+	if cached && t.pbeEncoding != nil {
+		// the Encoding was built by the package, not passed to NewTiktoken
+		t.pbeEncoding.MergeableRanks = nil
+	}
+	for bp := range release {
+		bp.release()
+	}
+	return nil
+}
+
+// ReleaseEncoding closes the cached instance of the named encoding, see
+// Close. It does nothing if the encoding is not loaded.
+func ReleaseEncoding(encodingName string) {
+	tl.Lock()
+	tk, ok := tiktokenMap[encodingName]
+	tl.Unlock()
+	if ok {
+		// ErrClosed only means another goroutine closed it first
+		tk.Close()
+		return
+	}
+	l.Lock()
+	delete(encodingMap, encodingName)
+	l.Unlock()
+}
+
+// isClosed reports whether t was closed.
+func (t *Tiktoken) isClosed() bool {
+	return t.bpe.closed.Load()
+}
+
+// mustOpen panics with ErrClosed if bp was closed.
+func (bp *CoreBPE) mustOpen() {
+	if bp.closed.Load() {
+		panic(ErrClosed.Error())
+	}
+}
+
+// release drops the lookup tables of bp. The pattern and settings stay, so
+// a closed encoding still reports its configuration.
+func (bp *CoreBPE) release() {
+	bp.encoder = nil
+	bp.specialTokensEncoder = nil
+	bp.specialTokensDecoder = nil
+	bp.specialMatcher = nil
+	bp.tables = nil
+	bp.specialTokenBytes = nil
+}
@@ -0,0 +1,81 @@
+package tiktoken
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClose(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	forModel, err := EncodingForModel("qwen2-7b")
+	ass.Nil(err)
+	derived := enc.WithOptions(WithMaxPieceLength(16))
+
+	ass.Nil(enc.Close())
+	ass.ErrorIs(enc.Close(), ErrClosed)
+
+	for _, tk := range []*Tiktoken{enc, forModel, derived} {
+		_, err = tk.EncodeWithError("hello", nil, nil)
+		ass.ErrorIs(err, ErrClosed)
+		_, err = tk.DecodeWithMode([]int{14990}, DecodeStrict)
+		ass.ErrorIs(err, ErrClosed)
+		ass.PanicsWithValue(ErrClosed.Error(), func() { tk.EncodeOrdinary("hello") })
+		ass.PanicsWithValue(ErrClosed.Error(), func() { tk.Decode([]int{14990}) })
+		ass.PanicsWithValue(ErrClosed.Error(), func() { tk.NewSession().CountTokens("hello") })
+		ass.Equal(MODEL_QWEN_BASE, tk.Name())
+	}
+
+	again, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.NotSame(enc, again, "the closed instance should not be cached")
+	ass.Equal([]int{14990}, again.EncodeOrdinary("hello"))
+	ass.Equal("qwen2-7b", forModel.Model())
+}
+
+func TestClosedErrors(t *testing.T) {
+	ass := assert.New(t)
+	enc := GetTestEncoding()
+	counter := enc.NewTokenCounter()
+	ass.Nil(enc.Close())
+
+	_, err := enc.FirstTokenOf("hi")
+	ass.ErrorIs(err, ErrClosed)
+	_, _, err = enc.FitsInContext("hi", "gpt-4", 0)
+	ass.ErrorIs(err, ErrClosed)
+	_, err = enc.CoverageReport(strings.NewReader("hi"))
+	ass.ErrorIs(err, ErrClosed)
+	ass.ErrorIs(enc.PreTokenizeReader(strings.NewReader("hi"), func(Piece) error { return nil }), ErrClosed)
+	_, err = enc.WithExtraSpecialTokens(map[string]int{"<|x|>": 1000})
+	ass.ErrorIs(err, ErrClosed)
+	_, err = BuildLogitBias(enc, []string{"hi"}, -100)
+	ass.ErrorIs(err, ErrClosed)
+	_, _, err = CountTokensInFiles(context.Background(), enc, []string{t.TempDir()}, 2)
+	ass.ErrorIs(err, ErrClosed)
+	_, err = counter.Write([]byte("hello world"))
+	ass.ErrorIs(err, ErrClosed)
+	ass.ErrorIs(counter.Flush(), ErrClosed)
+	ass.ErrorIs(enc.EncodeToWriter("hi", NewTokenWriter(io.Discard)), ErrClosed)
+	ass.PanicsWithValue(ErrClosed.Error(), func() { enc.NewIncrementalEncoder().Append("hi") })
+	ass.PanicsWithValue(ErrClosed.Error(), func() { enc.NewSession().Encode("hi") })
+}
+
+func TestReleaseEncoding(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	ReleaseEncoding(MODEL_QWEN_BASE)
+	ass.ErrorIs(enc.Close(), ErrClosed)
+	ReleaseEncoding(MODEL_QWEN_BASE)
+	ReleaseEncoding("not_loaded")
+
+	again, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Equal("hello world!你好，世界！", again.Decode(again.EncodeOrdinary("hello world!你好，世界！")))
+}
@@ -0,0 +1,113 @@
+// Command tiktoken-gen converts a .tiktoken rank file into Go source
+// declaring it as a tiktoken.StaticRanks variable, so an encoding built of
+// it with tiktoken.NewEncodingFromStaticRanks starts without reading or
+// parsing a file, e.g. with TinyGo or on WASM.
+//
+// Typical use from a package in your project:
+//
+//	//go:generate go run github.com/pkoukk/tiktoken-go/cmd/tiktoken-gen -in my.tiktoken -var myRanks -o my_ranks.go
+//
+// and in its code:
+//
+//	tiktoken.RegisterEncoding("my_base", func() (*tiktoken.Encoding, error) {
+//		return tiktoken.NewEncodingFromStaticRanks("my_base", myRanks, pattern, specials)
+//	})
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// chunkSize is the number of token bytes per string literal line.
+const chunkSize = 2048
+
+func main() {
+	in := flag.String("in", "", "rank file to convert")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	name := flag.String("var", "ranks", "name of the generated variable")
+	out := flag.String("o", "", "name of the generated file, standard output if empty")
+	flag.Parse()
+
+	if *in == "" {
+		log.Fatal("tiktoken-gen: -in is required")
+	}
+	if *pkg == "" {
+		log.Fatal("tiktoken-gen: -package is required outside of go generate")
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ranks, err := tiktoken.ParseRankFile(f, tiktoken.ParseLimits{})
+	f.Close()
+	if err != nil {
+		log.Fatalf("tiktoken-gen: %s: %v", *in, err)
+	}
+	src, err := generate(*pkg, *name, *in, ranks)
+	if err != nil {
+		log.Fatalf("tiktoken-gen: %v", err)
+	}
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the source of package pkg declaring ranks, read from
+// source, as the variable name.
+func generate(pkg, name, source string, ranks map[string]int) ([]byte, error) {
+	static, err := tiktoken.StaticRanksOf(ranks)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by tiktoken-gen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&buf, "package %s\n\nimport \"github.com/pkoukk/tiktoken-go\"\n\n", pkg)
+	fmt.Fprintf(&buf, "// %s holds the %d ranks of %s.\n", name, len(static.Ranks), source)
+	fmt.Fprintf(&buf, "var %s = tiktoken.StaticRanks{\n", name)
+
+	buf.WriteString("Tokens: ")
+	for start := 0; start == 0 || start < len(static.Tokens); start += chunkSize {
+		end := start + chunkSize
+		if end > len(static.Tokens) {
+			end = len(static.Tokens)
+		}
+		if start > 0 {
+			buf.WriteString(" +\n")
+		}
+		buf.WriteString(strconv.Quote(static.Tokens[start:end]))
+	}
+	buf.WriteString(",\n")
+	writeInts(&buf, "Ends: []uint32", len(static.Ends), func(i int) int { return int(static.Ends[i]) })
+	writeInts(&buf, "Ranks: []int", len(static.Ranks), func(i int) int { return static.Ranks[i] })
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
+
+// writeInts writes a composite literal of n integers, 16 per line.
+func writeInts(w io.Writer, prefix string, n int, value func(int) int) {
+	line := []byte(prefix + "{")
+	for i := 0; i < n; i++ {
+		if i%16 == 0 {
+			line = append(line, '\n')
+		} else {
+			line = append(line, ' ')
+		}
+		line = strconv.AppendInt(line, int64(value(i)), 10)
+		line = append(line, ',')
+	}
+	line = append(line, "\n},\n"...)
+	w.Write(line)
+}
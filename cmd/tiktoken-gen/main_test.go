@@ -0,0 +1,33 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	ass := assert.New(t)
+	ranks := map[string]int{"a": 0, "b": 1, "\xff": 2, "ab": 3, "\"\n": 4}
+	src, err := generate("vocab", "myRanks", "my.tiktoken", ranks)
+	ass.Nil(err)
+	file, err := parser.ParseFile(token.NewFileSet(), "my_ranks.go", src, parser.ParseComments)
+	ass.Nil(err)
+	ass.Equal("vocab", file.Name.Name)
+	ass.True(strings.HasPrefix(string(src), "// Code generated by tiktoken-gen from my.tiktoken. DO NOT EDIT.\n"))
+	ass.Contains(string(src), "\tTokens: \"\\\"\\naabb\\xff\",\n")
+	ass.Contains(string(src), "Ends: []uint32{\n\t\t2, 3, 5, 6, 7,\n\t},")
+	ass.Contains(string(src), "Ranks: []int{\n\t\t4, 0, 3, 1, 2,\n\t},")
+
+	// the generated literals are what StaticRanksOf returns
+	static, err := tiktoken.StaticRanksOf(ranks)
+	ass.Nil(err)
+	ass.Equal("\"\naabb\xff", static.Tokens)
+	enc, err := tiktoken.NewEncodingFromStaticRanks("vocab", static, `\w+|\W`, map[string]int{"<|end|>": 5})
+	ass.Nil(err)
+	ass.Equal(ranks, enc.MergeableRanks)
+}
@@ -0,0 +1,171 @@
+// Command tiktoken-vendor downloads rank files of built-in encodings into a
+// directory and generates a Go file that embeds them and installs an offline
+// BpeLoader, so GetEncoding works without network access at runtime.
+// Downloads go through the default loader of the package, with its
+// User-Agent and retries, and must have the published sha256 of the file.
+//
+// Typical use from a package in your project:
+//
+//	//go:generate go run github.com/pkoukk/tiktoken-go/cmd/tiktoken-vendor -encodings cl100k_base,p50k_base
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+var genTemplate = template.Must(template.New("gen").Parse(`// Code generated by tiktoken-vendor. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"embed"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+{{range .Files}}//go:embed {{.Path}}
+{{end}}var tiktokenVendorFS embed.FS
+
+func init() {
+	tiktoken.SetBpeLoader(tiktoken.NewFSBpeLoader(tiktokenVendorFS, map[string]string{
+{{range .Files}}		{{printf "%q" .URI}}: {{printf "%q" .Path}},
+{{end}}	}))
+}
+`))
+
+type vendoredFile struct {
+	URI  string
+	Path string
+}
+
+// rankSource is a rank file to vendor and the hex sha256 it must have.
+type rankSource struct {
+	uri, hash string
+}
+
+// builtinSource returns the rank file of the built-in encoding name with
+// its published hash.
+func builtinSource(name string) (rankSource, error) {
+	uri, ok := tiktoken.EncodingSource(name)
+	if !ok {
+		return rankSource{}, fmt.Errorf("encoding %s has no downloadable rank file", name)
+	}
+	hash, ok := tiktoken.KnownRankFileHash(uri)
+	if !ok {
+		return rankSource{}, fmt.Errorf("rank file %s has no published hash", uri)
+	}
+	return rankSource{uri, hash}, nil
+}
+
+// generator vendors the rank files of encodings into dir/subdir and writes
+// the Go file embedding them to dir/out.
+type generator struct {
+	dir, subdir, pkg, out string
+	// source returns the rank file of an encoding, builtinSource outside
+	// of tests.
+	source func(name string) (rankSource, error)
+	// loaderOptions configure the loader downloading the rank files.
+	loaderOptions []tiktoken.LoaderOption
+}
+
+func main() {
+	encodings := flag.String("encodings", "cl100k_base", "comma separated list of encodings to vendor")
+	dir := flag.String("dir", ".", "directory of the package receiving the generated file")
+	subdir := flag.String("subdir", "tiktoken_vendor", "directory, relative to -dir, for the rank files")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of the generated file")
+	out := flag.String("o", "tiktoken_vendor.go", "name of the generated file, relative to -dir")
+	flag.Parse()
+
+	if *pkg == "" {
+		log.Fatal("tiktoken-vendor: -package is required outside of go generate")
+	}
+	g := generator{
+		dir:           *dir,
+		subdir:        *subdir,
+		pkg:           *pkg,
+		out:           *out,
+		source:        builtinSource,
+		loaderOptions: []tiktoken.LoaderOption{tiktoken.WithRetry(3, time.Second)},
+	}
+	if err := g.run(context.Background(), strings.Split(*encodings, ",")); err != nil {
+		log.Fatalf("tiktoken-vendor: %v", err)
+	}
+}
+
+func (g generator) run(ctx context.Context, encodings []string) error {
+	if err := os.MkdirAll(filepath.Join(g.dir, g.subdir), 0o755); err != nil {
+		return err
+	}
+	// the store only hands the downloaded bytes back, nothing is cached
+	store := tiktoken.NewMemoryCacheStore()
+	opts := append([]tiktoken.LoaderOption{tiktoken.WithCacheStore(store)}, g.loaderOptions...)
+	loader := tiktoken.NewDefaultBpeLoader(opts...).(tiktoken.BpeLoaderWithContext)
+
+	files := map[string]vendoredFile{}
+	for _, name := range encodings {
+		name = strings.TrimSpace(name)
+		src, err := g.source(name)
+		if err != nil {
+			return err
+		}
+		if _, done := files[src.uri]; done {
+			continue
+		}
+		path := filepath.ToSlash(filepath.Join(g.subdir, filepath.Base(src.uri)))
+		if err := download(ctx, loader, store, src, filepath.Join(g.dir, path)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		files[src.uri] = vendoredFile{URI: src.uri, Path: path}
+	}
+
+	sorted := make([]vendoredFile, 0, len(files))
+	for _, f := range files {
+		sorted = append(sorted, f)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	var buf bytes.Buffer
+	if err := genTemplate.Execute(&buf, struct {
+		Package string
+		Files   []vendoredFile
+	}{g.pkg, sorted}); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.dir, g.out), src, 0o644)
+}
+
+// download loads the rank file of src with loader, which also parses it,
+// and writes the bytes it left in store to dest if they have src.hash.
+func download(ctx context.Context, loader tiktoken.BpeLoaderWithContext, store tiktoken.CacheStore, src rankSource, dest string) error {
+	if _, err := loader.LoadTiktokenBpeContext(ctx, src.uri); err != nil {
+		return err
+	}
+	contents, err := store.Get(ctx, src.uri)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(contents)
+	if got := hex.EncodeToString(sum[:]); got != src.hash {
+		return fmt.Errorf("%w %s: got %s, want %s", tiktoken.ErrHashMismatch, src.uri, got, src.hash)
+	}
+	return os.WriteFile(dest, contents, 0o644)
+}
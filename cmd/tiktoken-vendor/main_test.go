@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const rankFile = "YQ== 0\nYg== 1\nYWI= 2\n"
+
+func rankServer(t *testing.T, contents string) (*httptest.Server, *[]string) {
+	var agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		fmt.Fprint(w, contents)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &agents
+}
+
+func testGenerator(dir, uri, hash string) generator {
+	return generator{
+		dir:    dir,
+		subdir: "tiktoken_vendor",
+		pkg:    "vendored",
+		out:    "tiktoken_vendor.go",
+		source: func(name string) (rankSource, error) {
+			if name != "test_base" {
+				return builtinSource(name)
+			}
+			return rankSource{uri, hash}, nil
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	ass := assert.New(t)
+	srv, agents := rankServer(t, rankFile)
+	sum := sha256.Sum256([]byte(rankFile))
+	dir := t.TempDir()
+	g := testGenerator(dir, srv.URL+"/test_base.tiktoken", hex.EncodeToString(sum[:]))
+	ass.Nil(g.run(context.Background(), []string{"test_base", " test_base"}))
+	ass.Equal([]string{tiktoken.UserAgent()}, *agents)
+
+	contents, err := os.ReadFile(filepath.Join(dir, "tiktoken_vendor", "test_base.tiktoken"))
+	ass.Nil(err)
+	ass.Equal(rankFile, string(contents))
+	src, err := os.ReadFile(filepath.Join(dir, "tiktoken_vendor.go"))
+	ass.Nil(err)
+	ass.Contains(string(src), "//go:embed tiktoken_vendor/test_base.tiktoken\n")
+	ass.Contains(string(src), fmt.Sprintf("%q: \"tiktoken_vendor/test_base.tiktoken\",", srv.URL+"/test_base.tiktoken"))
+
+	// the generated file compiles against this module
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	root, err := filepath.Abs("../..")
+	ass.Nil(err)
+	gomod := fmt.Sprintf("module example.com/vendored\n\ngo 1.19\n\nrequire github.com/pkoukk/tiktoken-go v0.0.0\n\nreplace github.com/pkoukk/tiktoken-go => %s\n", filepath.ToSlash(root))
+	ass.Nil(os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0o644))
+	gosum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	ass.Nil(err)
+	ass.Nil(os.WriteFile(filepath.Join(dir, "go.sum"), gosum, 0o644))
+	cmd := exec.Command(gobin, "build", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	out, err := cmd.CombinedOutput()
+	ass.Nil(err, string(out))
+}
+
+func TestGenerateHashMismatch(t *testing.T) {
+	ass := assert.New(t)
+	srv, _ := rankServer(t, rankFile)
+	dir := t.TempDir()
+	g := testGenerator(dir, srv.URL+"/test_base.tiktoken", "00"+hex.EncodeToString(make([]byte, 31)))
+	err := g.run(context.Background(), []string{"test_base"})
+	ass.True(errors.Is(err, tiktoken.ErrHashMismatch), err)
+	_, err = os.Stat(filepath.Join(dir, "tiktoken_vendor", "test_base.tiktoken"))
+	ass.True(errors.Is(err, os.ErrNotExist))
+	_, err = os.Stat(filepath.Join(dir, "tiktoken_vendor.go"))
+	ass.True(errors.Is(err, os.ErrNotExist))
+
+	_, err = builtinSource("llama3")
+	ass.EqualError(err, "encoding llama3 has no downloadable rank file")
+	src, err := builtinSource(tiktoken.MODEL_CL100K_BASE)
+	ass.Nil(err)
+	ass.Equal("223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7", src.hash)
+}
@@ -0,0 +1,364 @@
+// Command tiktoken encodes, decodes, counts and chunks text from files or
+// standard input, for shell pipelines and CI checks:
+//
+//	tiktoken encode -model gpt-4o prompt.txt
+//	echo 9906 1917 | tiktoken decode
+//	tiktoken count -max 8000 prompts/*.txt
+//	tiktoken chunk -size 512 -overlap 64 -json doc.md
+//
+// Without files it reads standard input. Each command takes -model or
+// -encoding, cl100k_base by default, and -json for JSON output. encode,
+// decode and chunk read their inputs as one text; count reports each file
+// and, with -max, exits with status 1 if one has more tokens than allowed.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// errBudget is returned by count when an input exceeds -max.
+var errBudget = errors.New("token budget exceeded")
+
+const usage = `usage: tiktoken <encode|decode|count|chunk> [flags] [file ...]
+
+Run "tiktoken <command> -h" for the flags of a command.
+`
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	case errors.Is(err, errBudget):
+		fmt.Fprintln(os.Stderr, "tiktoken:", err)
+		os.Exit(1)
+	default:
+		fmt.Fprintln(os.Stderr, "tiktoken:", err)
+		os.Exit(2)
+	}
+}
+
+// command holds the flags shared by all commands.
+type command struct {
+	flags    *flag.FlagSet
+	model    string
+	encoding string
+	json     bool
+	special  string
+}
+
+func newCommand(name string, stderr io.Writer) *command {
+	c := &command{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	c.flags.SetOutput(stderr)
+	c.flags.StringVar(&c.model, "model", "", "model whose encoding to use, e.g. gpt-4o")
+	c.flags.StringVar(&c.encoding, "encoding", "", "encoding to use if -model isn't given (default cl100k_base)")
+	c.flags.BoolVar(&c.json, "json", false, "write JSON instead of plain text")
+	return c
+}
+
+// specialFlag adds -special to commands that encode text.
+func (c *command) specialFlag() {
+	c.flags.StringVar(&c.special, "special", "error",
+		"special tokens in the text: error, text to encode them as text or allow to encode them as special tokens")
+}
+
+func (c *command) tokenizer() (*tiktoken.Tiktoken, error) {
+	switch {
+	case c.model != "" && c.encoding != "":
+		return nil, fmt.Errorf("-model and -encoding are exclusive")
+	case c.model != "":
+		return tiktoken.EncodingForModel(c.model)
+	case c.encoding != "":
+		return tiktoken.GetEncoding(c.encoding)
+	}
+	return tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE)
+}
+
+func (c *command) encodeOptions() (tiktoken.EncodeOptions, error) {
+	switch c.special {
+	case "error", "":
+		return tiktoken.EncodeOptions{}, nil
+	case "text":
+		return tiktoken.EncodeOptions{OnDisallowed: tiktoken.DisallowedAsText}, nil
+	case "allow":
+		return tiktoken.EncodeOptions{AllowedSpecial: tiktoken.AllowedSpecialAll}, nil
+	}
+	return tiktoken.EncodeOptions{}, fmt.Errorf("-special must be error, text or allow, not %q", c.special)
+}
+
+func (c *command) encode(tke *tiktoken.Tiktoken, text string) ([]int, error) {
+	opts, err := c.encodeOptions()
+	if err != nil {
+		return nil, err
+	}
+	return tke.EncodeWithOptions(text, opts)
+}
+
+// input is a file named on the command line, or "-" for standard input.
+type input struct {
+	name string
+	text string
+}
+
+func readInputs(names []string, stdin io.Reader) ([]input, error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	inputs := make([]input, 0, len(names))
+	for _, name := range names {
+		var contents []byte
+		var err error
+		if name == "-" {
+			contents, err = io.ReadAll(stdin)
+		} else {
+			contents, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input{name: name, text: string(contents)})
+	}
+	return inputs, nil
+}
+
+func readText(names []string, stdin io.Reader) (string, error) {
+	inputs, err := readInputs(names, stdin)
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, in := range inputs {
+		text.WriteString(in.text)
+	}
+	return text.String(), nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+	switch args[0] {
+	case "encode":
+		return runEncode(args[1:], stdin, stdout, stderr)
+	case "decode":
+		return runDecode(args[1:], stdin, stdout, stderr)
+	case "count":
+		return runCount(args[1:], stdin, stdout, stderr)
+	case "chunk":
+		return runChunk(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+}
+
+func runEncode(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	c := newCommand("encode", stderr)
+	c.specialFlag()
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	tke, err := c.tokenizer()
+	if err != nil {
+		return err
+	}
+	text, err := readText(c.flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	tokens, err := c.encode(tke, text)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		if tokens == nil {
+			tokens = []int{}
+		}
+		return json.NewEncoder(stdout).Encode(tokens)
+	}
+	var line []byte
+	for i, token := range tokens {
+		if i > 0 {
+			line = append(line, ' ')
+		}
+		line = strconv.AppendInt(line, int64(token), 10)
+	}
+	line = append(line, '\n')
+	_, err = stdout.Write(line)
+	return err
+}
+
+func runDecode(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	c := newCommand("decode", stderr)
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	tke, err := c.tokenizer()
+	if err != nil {
+		return err
+	}
+	input, err := readText(c.flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	tokens, err := parseTokens(input)
+	if err != nil {
+		return err
+	}
+	text, err := tke.DecodeWithError(tokens)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return json.NewEncoder(stdout).Encode(text)
+	}
+	_, err = io.WriteString(stdout, text)
+	return err
+}
+
+// parseTokens reads tokens as a JSON array, as encode -json writes them, or
+// as integers separated by white space or commas.
+func parseTokens(input string) ([]int, error) {
+	trimmed := strings.TrimSpace(input)
+	if strings.HasPrefix(trimmed, "[") {
+		var tokens []int
+		if err := json.Unmarshal([]byte(trimmed), &tokens); err != nil {
+			return nil, fmt.Errorf("tokens: %w", err)
+		}
+		return tokens, nil
+	}
+	fields := strings.FieldsFunc(trimmed, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	tokens := make([]int, 0, len(fields))
+	for _, field := range fields {
+		token, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q", field)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// countResult is the JSON output of count.
+type countResult struct {
+	Files  []fileCount `json:"files"`
+	Total  int         `json:"total"`
+	Max    int         `json:"max,omitempty"`
+	Exceed []string    `json:"exceeded,omitempty"`
+}
+
+type fileCount struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+}
+
+func runCount(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	c := newCommand("count", stderr)
+	c.specialFlag()
+	limit := c.flags.Int("max", 0, "exit with status 1 if an input has more tokens, 0 for no limit")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	tke, err := c.tokenizer()
+	if err != nil {
+		return err
+	}
+	inputs, err := readInputs(c.flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	result := countResult{Max: *limit}
+	for _, in := range inputs {
+		tokens, err := c.encode(tke, in.text)
+		if err != nil {
+			return fmt.Errorf("%s: %w", in.name, err)
+		}
+		result.Files = append(result.Files, fileCount{Name: in.name, Tokens: len(tokens)})
+		result.Total += len(tokens)
+		if *limit > 0 && len(tokens) > *limit {
+			result.Exceed = append(result.Exceed, in.name)
+		}
+	}
+
+	if c.json {
+		err = json.NewEncoder(stdout).Encode(result)
+	} else {
+		var buf bytes.Buffer
+		if len(inputs) == 1 && inputs[0].name == "-" {
+			fmt.Fprintln(&buf, result.Total)
+		} else {
+			for _, f := range result.Files {
+				fmt.Fprintf(&buf, "%d\t%s\n", f.Tokens, f.Name)
+			}
+			if len(result.Files) > 1 {
+				fmt.Fprintf(&buf, "%d\ttotal\n", result.Total)
+			}
+		}
+		_, err = stdout.Write(buf.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+	if len(result.Exceed) > 0 {
+		return fmt.Errorf("%w: %s over %d tokens", errBudget, strings.Join(result.Exceed, ", "), *limit)
+	}
+	return nil
+}
+
+// chunk is an element of the JSON output of chunk.
+type chunk struct {
+	Text   string `json:"text"`
+	Tokens int    `json:"tokens"`
+}
+
+func runChunk(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	c := newCommand("chunk", stderr)
+	size := c.flags.Int("size", 512, "maximum tokens per chunk")
+	overlap := c.flags.Int("overlap", 0, "tokens shared by consecutive chunks")
+	sep := c.flags.String("sep", "\n---\n", "separator written after each chunk in plain output")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	if *size < 1 || *overlap < 0 || *overlap >= *size {
+		return fmt.Errorf("-size must be positive and -overlap in [0, size)")
+	}
+	tke, err := c.tokenizer()
+	if err != nil {
+		return err
+	}
+	text, err := readText(c.flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	texts := tke.SplitByTokens(text, *size, *overlap)
+
+	if c.json {
+		chunks := make([]chunk, len(texts))
+		for i, text := range texts {
+			chunks[i] = chunk{Text: text, Tokens: tke.CountTokens(text)}
+		}
+		return json.NewEncoder(stdout).Encode(chunks)
+	}
+	var buf bytes.Buffer
+	for _, text := range texts {
+		buf.WriteString(text)
+		buf.WriteString(*sep)
+	}
+	_, err = stdout.Write(buf.Bytes())
+	return err
+}
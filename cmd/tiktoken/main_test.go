@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runString(args []string, stdin string) (string, error) {
+	var stdout bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, io.Discard)
+	return stdout.String(), err
+}
+
+func TestEncodeDecode(t *testing.T) {
+	ass := assert.New(t)
+	out, err := runString([]string{"encode", "-encoding", "qwen_base"}, "hello world")
+	ass.Nil(err)
+	ass.Equal("14990 1879\n", out)
+
+	out, err = runString([]string{"encode", "-encoding", "qwen_base", "-json"}, "hello world")
+	ass.Nil(err)
+	ass.Equal("[14990,1879]\n", out)
+
+	for _, input := range []string{"14990 1879\n", "14990,1879", "[14990, 1879]"} {
+		out, err = runString([]string{"decode", "-encoding", "qwen_base"}, input)
+		ass.Nil(err)
+		ass.Equal("hello world", out, input)
+	}
+	out, err = runString([]string{"decode", "-encoding", "qwen_base", "-json"}, "14990 1879")
+	ass.Nil(err)
+	ass.Equal("\"hello world\"\n", out)
+	_, err = runString([]string{"decode", "-encoding", "qwen_base"}, "14990 x")
+	ass.EqualError(err, `invalid token "x"`)
+}
+
+func TestEncodeSpecial(t *testing.T) {
+	ass := assert.New(t)
+	_, err := runString([]string{"encode", "-encoding", "qwen_base"}, "<|endoftext|>")
+	ass.Error(err)
+	out, err := runString([]string{"encode", "-encoding", "qwen_base", "-special", "allow"}, "<|endoftext|>")
+	ass.Nil(err)
+	ass.Equal("151643\n", out)
+	out, err = runString([]string{"encode", "-encoding", "qwen_base", "-special", "text"}, "<|endoftext|>")
+	ass.Nil(err)
+	ass.NotEqual("151643\n", out)
+	_, err = runString([]string{"encode", "-encoding", "qwen_base", "-special", "maybe"}, "")
+	ass.EqualError(err, `-special must be error, text or allow, not "maybe"`)
+}
+
+func TestCount(t *testing.T) {
+	ass := assert.New(t)
+	out, err := runString([]string{"count", "-encoding", "qwen_base"}, "hello world")
+	ass.Nil(err)
+	ass.Equal("2\n", out)
+
+	dir := t.TempDir()
+	short, long := filepath.Join(dir, "short.txt"), filepath.Join(dir, "long.txt")
+	ass.Nil(os.WriteFile(short, []byte("hello"), 0o644))
+	ass.Nil(os.WriteFile(long, []byte("hello world hello world"), 0o644))
+	out, err = runString([]string{"count", "-encoding", "qwen_base", short, long}, "")
+	ass.Nil(err)
+	ass.Equal("1\t"+short+"\n4\t"+long+"\n5\ttotal\n", out)
+
+	out, err = runString([]string{"count", "-encoding", "qwen_base", "-max", "2", "-json", short, long}, "")
+	ass.ErrorIs(err, errBudget)
+	ass.Equal(`{"files":[{"name":"`+short+`","tokens":1},{"name":"`+long+`","tokens":4}],"total":5,"max":2,"exceeded":["`+long+`"]}`+"\n", out)
+}
+
+func TestChunk(t *testing.T) {
+	ass := assert.New(t)
+	out, err := runString([]string{"chunk", "-encoding", "qwen_base", "-size", "2", "-sep", "|"}, "hello world hello world")
+	ass.Nil(err)
+	ass.Equal("hello world| hello world|", out)
+
+	out, err = runString([]string{"chunk", "-encoding", "qwen_base", "-size", "2", "-json"}, "hello world")
+	ass.Nil(err)
+	ass.Equal(`[{"text":"hello world","tokens":2}]`+"\n", out)
+
+	_, err = runString([]string{"chunk", "-size", "2", "-overlap", "2"}, "")
+	ass.EqualError(err, "-size must be positive and -overlap in [0, size)")
+}
+
+func TestUsage(t *testing.T) {
+	ass := assert.New(t)
+	_, err := runString(nil, "")
+	ass.ErrorIs(err, flag.ErrHelp)
+	_, err = runString([]string{"tokenize"}, "")
+	ass.ErrorContains(err, `unknown command "tokenize"`)
+	_, err = runString([]string{"count", "-model", "gpt-4o", "-encoding", "qwen_base"}, "")
+	ass.EqualError(err, "-model and -encoding are exclusive")
+}
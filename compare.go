@@ -0,0 +1,35 @@
+package tiktoken
+
+// CompareEncodings counts the tokens of text with each of the named
+// encodings, as CountTokens does, e.g. to see how a prompt changes size
+// when moving from cl100k_base to o200k_base. The encodings are taken from
+// the cache, loading them first if needed. It fails with the error of the
+// first encoding that can't be loaded.
+func CompareEncodings(text string, encodings ...string) (map[string]int, error) {
+	counts, err := CompareEncodingsBatch([]string{text}, encodings...)
+	if err != nil {
+		return nil, err
+	}
+	return counts[0], nil
+}
+
+// CompareEncodingsBatch is CompareEncodings for every text of texts,
+// loading the encodings once.
+func CompareEncodingsBatch(texts []string, encodings ...string) ([]map[string]int, error) {
+	tks := make([]*Tiktoken, len(encodings))
+	for i, name := range encodings {
+		tk, err := GetEncoding(name)
+		if err != nil {
+			return nil, err
+		}
+		tks[i] = tk
+	}
+	counts := make([]map[string]int, len(texts))
+	for i, text := range texts {
+		counts[i] = make(map[string]int, len(encodings))
+		for j, tk := range tks {
+			counts[i][encodings[j]] = tk.CountTokens(text)
+		}
+	}
+	return counts, nil
+}
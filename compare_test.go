@@ -0,0 +1,43 @@
+package tiktoken
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareEncodings(t *testing.T) {
+	ass := assert.New(t)
+	RegisterEncoding("compare_test_bytes", func() (*Encoding, error) {
+		ranks := map[string]int{}
+		for b := 0; b < 256; b++ {
+			ranks[string([]byte{byte(b)})] = b
+		}
+		return &Encoding{Name: "compare_test_bytes", PatStr: `.`, MergeableRanks: ranks, SpecialTokens: map[string]int{}}, nil
+	})
+	defer func() {
+		ReleaseEncoding("compare_test_bytes")
+		rl.Lock()
+		delete(encodingConstructors, "compare_test_bytes")
+		rl.Unlock()
+	}()
+
+	counts, err := CompareEncodings("hello world", MODEL_QWEN_BASE, "compare_test_bytes")
+	ass.Nil(err)
+	ass.Equal(map[string]int{MODEL_QWEN_BASE: 2, "compare_test_bytes": 11}, counts)
+
+	batch, err := CompareEncodingsBatch([]string{"", "hello world", "你好<|endoftext|>"}, MODEL_QWEN_BASE, "compare_test_bytes")
+	ass.Nil(err)
+	ass.Equal([]map[string]int{
+		{MODEL_QWEN_BASE: 0, "compare_test_bytes": 0},
+		{MODEL_QWEN_BASE: 2, "compare_test_bytes": 11},
+		{MODEL_QWEN_BASE: 8, "compare_test_bytes": 19},
+	}, batch)
+
+	counts, err = CompareEncodings("hello")
+	ass.Nil(err)
+	ass.Empty(counts)
+	_, err = CompareEncodings("hello", MODEL_QWEN_BASE, "compare_test_missing")
+	ass.True(errors.Is(err, ErrEncodingNotFound))
+}
@@ -0,0 +1,73 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownCompatLevel is returned by WithCompatibilityLevel for a level
+// this build doesn't know.
+var ErrUnknownCompatLevel = errors.New("tiktoken: unknown compatibility level")
+
+// CompatLevel202406 is the behavior of the encoder as of June 2024: the
+// split pattern of each encoding as published, invalid UTF-8 in the input
+// encoded as if it were U+FFFD, and pieces longer than 128 KiB merged in
+// chunks of at most that length.
+const CompatLevel202406 = "2024-06"
+
+// compatLevel holds every choice of the encoder that changes tokens and may
+// change between releases. A change of any of them, including a fast path
+// that isn't proven to give the same tokens as the code it replaces, needs a
+// new level with a golden corpus in testdata/compat; existing levels and
+// their corpora never change. The ASCII splitter and the heap merge are
+// output-equivalent, see TestASCIISplitterMatchesRegex and
+// TestBytePairMergeHeapMatchesScan, and apply to all levels.
+type compatLevel struct {
+	// maxPieceLength is the piece length cap of the level, see
+	// WithMaxPieceLength.
+	maxPieceLength int
+}
+
+var compatLevels = map[string]compatLevel{
+	CompatLevel202406: {maxPieceLength: 128 << 10},
+}
+
+// CompatibilityLevels returns the compatibility levels this build knows, in
+// order.
+func CompatibilityLevels() []string {
+	levels := make([]string, 0, len(compatLevels))
+	for level := range compatLevels {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	return levels
+}
+
+// WithCompatibilityLevel returns a copy of t that pins the choices of the
+// encoder that affect tokens to the semantics of level, such as
+// CompatLevel202406, so data tokenized with one release of the library is
+// tokenized the same with every later release that knows the level. Options
+// applied to the copy with WithOptions still apply, WithMaxPieceLength
+// included. Input options such as WithNormalization are explicit choices of
+// the caller and not affected. The copy shares the vocabulary and compiled
+// patterns with t.
+//
+// It fails with ErrUnknownCompatLevel for a level this build doesn't know,
+// so nothing is ever encoded without the pinned semantics.
+func (t *Tiktoken) WithCompatibilityLevel(level string) (*Tiktoken, error) {
+	l, ok := compatLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, this build knows %s", ErrUnknownCompatLevel, level, strings.Join(CompatibilityLevels(), ", "))
+	}
+	derived := t.WithOptions(WithMaxPieceLength(l.maxPieceLength))
+	derived.opts.compatLevel = level
+	return derived, nil
+}
+
+// CompatibilityLevel returns the level set with WithCompatibilityLevel, or
+// "" if none was.
+func (t *Tiktoken) CompatibilityLevel() string {
+	return t.opts.compatLevel
+}
@@ -0,0 +1,145 @@
+package tiktoken
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// compatCorpus are the inputs of the golden corpus of a new compatibility
+// level. Existing levels keep the inputs stored in their corpus.
+func compatCorpus() []string {
+	return []string{
+		"hello world",
+		"Hello, World! It's what they'll say, isn't it?",
+		"1234567 and 3.14159 or 1,000,000",
+		"héllo 你好世界 Привет мир こんにちは",
+		"👍🏽 fine 👨‍👩‍👧",
+		"a  \n\n\tb   \r\n   c",
+		"func main() {\n\tfmt.Println(\"hi\")\n}\n",
+		"invalid \xff utf-8 \xc3 bytes\xe4\xbd",
+		"<|endoftext|> encoded as text",
+		strings.Repeat("ab", 700),
+		strings.Repeat("the", 400),
+		strings.Repeat("ä", 600),
+	}
+}
+
+// compatCase is one input of a golden corpus with its tokens.
+type compatCase struct {
+	Input  []byte `json:"input"`
+	Tokens []int  `json:"tokens"`
+}
+
+func compatEncodings(t *testing.T) map[string]*Tiktoken {
+	qwen, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*Tiktoken{testEncodingName: GetTestEncoding(), MODEL_QWEN_BASE: qwen}
+}
+
+// TestCompatibilityLevelCorpora checks that every known level still
+// reproduces its golden corpus. With -update, corpora of levels that don't
+// have one yet are written; existing corpora are never rewritten.
+func TestCompatibilityLevelCorpora(t *testing.T) {
+	encodings := compatEncodings(t)
+	for _, level := range CompatibilityLevels() {
+		t.Run(level, func(t *testing.T) {
+			ass := assert.New(t)
+			golden := filepath.Join("testdata", "compat", level+".json")
+			if _, err := os.Stat(golden); errors.Is(err, os.ErrNotExist) && *updateGolden {
+				corpus := map[string][]compatCase{}
+				for name, enc := range encodings {
+					enc, err := enc.WithCompatibilityLevel(level)
+					ass.Nil(err)
+					for _, input := range compatCorpus() {
+						corpus[name] = append(corpus[name], compatCase{[]byte(input), enc.Encode(input, nil, nil)})
+					}
+				}
+				ass.Nil(os.WriteFile(golden, marshalCorpus(corpus), 0644))
+			}
+			data, err := os.ReadFile(golden)
+			if !ass.Nil(err, "a new level needs a golden corpus, run go test -run TestCompatibilityLevelCorpora -update") {
+				return
+			}
+			var corpus map[string][]compatCase
+			ass.Nil(json.Unmarshal(data, &corpus))
+			ass.Len(corpus, len(encodings))
+			for name, cases := range corpus {
+				enc, err := encodings[name].WithCompatibilityLevel(level)
+				ass.Nil(err)
+				for _, c := range cases {
+					ass.Equal(c.Tokens, enc.Encode(string(c.Input), nil, nil), "%s: %.40q", name, c.Input)
+				}
+			}
+		})
+	}
+}
+
+func TestWithCompatibilityLevel(t *testing.T) {
+	ass := assert.New(t)
+	enc := GetTestEncoding()
+	long := strings.Repeat("the", 400)
+
+	pinned, err := enc.WithOptions(WithMaxPieceLength(8)).WithCompatibilityLevel(CompatLevel202406)
+	ass.Nil(err)
+	ass.Equal(CompatLevel202406, pinned.CompatibilityLevel())
+	ass.Equal(enc.EncodeOrdinary(long), pinned.EncodeOrdinary(long), "the level pins the piece cap")
+	ass.NotEqual(enc.WithOptions(WithMaxPieceLength(8)).EncodeOrdinary(long), pinned.EncodeOrdinary(long))
+	ass.Equal(pinned.WithOptions(WithMaxPieceLength(8)).EncodeOrdinary(long),
+		enc.WithOptions(WithMaxPieceLength(8)).EncodeOrdinary(long), "later options still apply")
+	ass.Equal("", enc.CompatibilityLevel())
+
+	unknown, err := enc.WithCompatibilityLevel("2099-01")
+	ass.Nil(unknown)
+	ass.ErrorIs(err, ErrUnknownCompatLevel)
+	ass.ErrorContains(err, `"2099-01", this build knows 2024-06`)
+	ass.Equal("", enc.CompatibilityLevel(), "t is unchanged")
+}
+
+func TestCompatibilityLevels(t *testing.T) {
+	ass := assert.New(t)
+	levels := CompatibilityLevels()
+	ass.Contains(levels, CompatLevel202406)
+	ass.True(sort.StringsAreSorted(levels))
+	// the current defaults must match the newest level, or the change that
+	// broke this needs a new level
+	newest := compatLevels[levels[len(levels)-1]]
+	ass.Equal(DefaultMaxPieceLength, newest.maxPieceLength)
+}
+
+// marshalCorpus formats corpus as JSON with a line per case.
+func marshalCorpus(corpus map[string][]compatCase) []byte {
+	names := make([]string, 0, len(corpus))
+	for name := range corpus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "\n  %q: [", name)
+		for j, c := range corpus[name] {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			data, _ := json.Marshal(c)
+			b.WriteString("\n    ")
+			b.Write(data)
+		}
+		b.WriteString("\n  ]")
+	}
+	b.WriteString("\n}\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,203 @@
+package tiktoken
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Compiled encodings start with compiledMagic followed by a big-endian
+// uint16 format version. The body is a sequence of uvarint-prefixed fields:
+//
+//	name, source URI, pattern, explicit n_vocab,
+//	special token count, then (token text, id) pairs in id order,
+//	token count, the token bytes back to back in byte order,
+//	the length of each token, then the zigzag varint rank of each token,
+//
+// and the payload ends with the big-endian CRC-32 (IEEE) of everything
+// before it. Unlike WriteTo, the tokens are stored as the rank tables
+// hold them, so LoadCompiled neither sorts nor allocates per token.
+const (
+	compiledMagic   = "TKTC"
+	compiledVersion = 1
+)
+
+// SaveCompiled writes the encoding to w in a form LoadCompiled rebuilds
+// faster than a rank file or ReadFrom: the token bytes, their order and
+// their ranks as the encoder holds them in memory. It is meant for cold
+// starts, e.g. a compiled cl100k_base shipped with a serverless function.
+// Options set with WithOptions are not part of the payload.
+func (t *Tiktoken) SaveCompiled(w io.Writer) (int64, error) {
+	if t.isClosed() {
+		return 0, ErrClosed
+	}
+	crc := crc32.NewIEEE()
+	sw := &serialWriter{w: io.MultiWriter(w, crc)}
+
+	sw.write([]byte(compiledMagic))
+	var version [2]byte
+	binary.BigEndian.PutUint16(version[:], compiledVersion)
+	sw.write(version[:])
+
+	enc := t.pbeEncoding
+	sw.bytes([]byte(enc.Name))
+	sw.bytes([]byte(enc.SourceURI))
+	sw.bytes([]byte(enc.PatStr))
+	sw.uvarint(uint64(enc.ExplicitNVocab))
+
+	specials := make([]VocabEntry, 0, len(enc.SpecialTokens))
+	for k, v := range enc.SpecialTokens {
+		specials = append(specials, VocabEntry{Token: []byte(k), Rank: v})
+	}
+	sortEntries(specials)
+	sw.uvarint(uint64(len(specials)))
+	for _, e := range specials {
+		sw.bytes(e.Token)
+		sw.uvarint(uint64(e.Rank))
+	}
+
+	tables := t.bpe.tables
+	sw.uvarint(uint64(tables.len()))
+	sw.bytes(tables.tokens)
+	for i := 0; i < tables.len(); i++ {
+		start, end := tables.span(i)
+		sw.uvarint(uint64(end - start))
+	}
+	for i := 0; i < tables.len(); i++ {
+		start, end := tables.span(i)
+		sw.varint(tables.encoder[tables.tokenString[start:end]])
+	}
+	if sw.err != nil {
+		return sw.n, sw.err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	n, err := w.Write(sum[:])
+	return sw.n + int64(n), err
+}
+
+// compiledTables reads the token section of a compiled encoding.
+func (sr *serialReader) compiledTables() (*rankTables, error) {
+	n := sr.int()
+	tokens := sr.bytes()
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if n > len(tokens)+1 {
+		return nil, errCorruptEncoding
+	}
+	ends := make([]uint32, n)
+	end := 0
+	for i := range ends {
+		end += sr.int()
+		if sr.err != nil || end > len(tokens) {
+			return nil, errCorruptEncoding
+		}
+		ends[i] = uint32(end)
+	}
+	ranks := make([]int, n)
+	for i := range ranks {
+		ranks[i] = sr.varint()
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	t, err := sortedRankTables(tokens, string(tokens), ends, ranks)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptEncoding, err)
+	}
+	return t, nil
+}
+
+// sortedRankTables builds the tables of tokens held back to back in byte
+// order, the i-th ending at ends[i] with rank ranks[i], as SaveCompiled and
+// tiktoken-gen write them. tokenString holds the same bytes as tokens; the
+// keys of the encoder are substrings of it, and the order of the tokens is
+// checked instead of sorted.
+func sortedRankTables(tokens []byte, tokenString string, ends []uint32, ranks []int) (*rankTables, error) {
+	if len(ends) != len(ranks) {
+		return nil, fmt.Errorf("%d tokens but %d ranks", len(ends), len(ranks))
+	}
+	if len(ends) > 0 && int(ends[len(ends)-1]) != len(tokens) {
+		return nil, fmt.Errorf("tokens end at %d, not at %d", ends[len(ends)-1], len(tokens))
+	}
+	t := &rankTables{tokens: tokens, tokenString: tokenString, ends: ends}
+	maxRank := -1
+	for _, rank := range ranks {
+		if rank > maxRank {
+			maxRank = rank
+		}
+	}
+	t.initIndex(len(ends), maxRank)
+	t.encoder = make(map[string]int, len(ends))
+	prev := 0
+	for i, rank := range ranks {
+		if int(ends[i]) < prev || int(ends[i]) > len(tokens) {
+			return nil, fmt.Errorf("token %d ends out of range", i)
+		}
+		prev = int(ends[i])
+		start, end := t.span(i)
+		token := t.tokenString[start:end]
+		if i > 0 {
+			prevStart, prevEnd := t.span(i - 1)
+			if token <= t.tokenString[prevStart:prevEnd] {
+				return nil, fmt.Errorf("tokens out of order")
+			}
+		}
+		if err := t.setIndex(i, rank); err != nil {
+			return nil, err
+		}
+		t.encoder[token] = rank
+	}
+	return t, nil
+}
+
+// LoadCompiled rebuilds an encoding written by Tiktoken.SaveCompiled. It
+// fails if the payload was written by an unknown format version or is
+// corrupted. Like ReadFrom, it doesn't register the encoding for
+// GetEncoding.
+func LoadCompiled(r io.Reader) (*Tiktoken, error) {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < len(compiledMagic)+2+4 || string(payload[:len(compiledMagic)]) != compiledMagic {
+		return nil, fmt.Errorf("%w: bad header", errCorruptEncoding)
+	}
+	version := binary.BigEndian.Uint16(payload[len(compiledMagic):])
+	if version != compiledVersion {
+		return nil, fmt.Errorf("unsupported compiled encoding version %d", version)
+	}
+	body, sum := payload[:len(payload)-4], binary.BigEndian.Uint32(payload[len(payload)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", errCorruptEncoding)
+	}
+
+	sr := &serialReader{r: bufio.NewReader(bytes.NewReader(body[len(compiledMagic)+2:]))}
+	name := string(sr.bytes())
+	source := string(sr.bytes())
+	pattern := string(sr.bytes())
+	explicitNVocab := sr.int()
+	specials := sr.table(true)
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	tables, err := sr.compiledTables()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sr.r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing data", errCorruptEncoding)
+	}
+
+	enc, err := newEncoding(name, source, pattern, tables, specials)
+	if err != nil {
+		return nil, err
+	}
+	enc.ExplicitNVocab = explicitNVocab
+	return newTiktokenFromEncoding(enc)
+}
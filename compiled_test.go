@@ -0,0 +1,110 @@
+package tiktoken
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoadCompiled(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	var buf bytes.Buffer
+	n, err := enc.SaveCompiled(&buf)
+	ass.Nil(err)
+	ass.Equal(int64(buf.Len()), n)
+	payload := buf.Bytes()
+
+	restored, err := LoadCompiled(bytes.NewReader(payload))
+	ass.Nil(err)
+	ass.Equal(enc.Name(), restored.Name())
+	ass.Equal(enc.SourceURI(), restored.SourceURI())
+	ass.Equal(enc.pbeEncoding.PatStr, restored.pbeEncoding.PatStr)
+	ass.Equal(enc.pbeEncoding.SpecialTokens, restored.pbeEncoding.SpecialTokens)
+	ass.Equal(enc.pbeEncoding.MergeableRanks, restored.pbeEncoding.MergeableRanks)
+	ass.Equal(enc.bpe.tables.ends, restored.bpe.tables.ends)
+	ass.Equal(enc.bpe.tables.byRank, restored.bpe.tables.byRank)
+	ass.Equal(enc.VocabSize(), restored.VocabSize())
+
+	corpus := []string{"hello world!你好，世界！", "こんにちは世界！", "안녕하세요 세계!", "Привет мир!", "func main() {\n\tfmt.Println(42)\n}"}
+	for _, text := range corpus {
+		tokens := enc.Encode(text, nil, nil)
+		ass.Equal(tokens, restored.Encode(text, nil, nil), text)
+		ass.Equal(text, restored.Decode(tokens), text)
+	}
+
+	// saving is deterministic
+	var again bytes.Buffer
+	_, err = restored.SaveCompiled(&again)
+	ass.Nil(err)
+	ass.Equal(payload, again.Bytes())
+}
+
+func TestLoadCompiledRejectsBadPayloads(t *testing.T) {
+	ass := assert.New(t)
+	ranks := map[string]int{"a": 0, "b": 1, "ab": 2, "far": 1 << 30}
+	bpe, err := NewCoreBPE(ranks, map[string]int{"<|end|>": 3}, `\w+`)
+	ass.Nil(err)
+	enc := NewTiktoken(bpe, &Encoding{Name: "tiny", PatStr: `\w+`, MergeableRanks: ranks, SpecialTokens: map[string]int{"<|end|>": 3}}, nil)
+	var buf bytes.Buffer
+	_, err = enc.SaveCompiled(&buf)
+	ass.Nil(err)
+	payload := buf.Bytes()
+
+	restored, err := LoadCompiled(bytes.NewReader(payload))
+	ass.Nil(err)
+	ass.Equal([]int{2, 3, 1 << 30}, restored.Encode("ab<|end|>far", []string{"all"}, nil))
+
+	_, err = LoadCompiled(bytes.NewReader(nil))
+	ass.ErrorIs(err, errCorruptEncoding)
+
+	var serialized bytes.Buffer
+	_, err = enc.WriteTo(&serialized)
+	ass.Nil(err)
+	_, err = LoadCompiled(&serialized)
+	ass.ErrorIs(err, errCorruptEncoding, "WriteTo payloads are a different format")
+
+	corrupted := append([]byte{}, payload...)
+	corrupted[10] ^= 0xff
+	_, err = LoadCompiled(bytes.NewReader(corrupted))
+	ass.ErrorIs(err, errCorruptEncoding)
+
+	_, err = LoadCompiled(bytes.NewReader(payload[:len(payload)-1]))
+	ass.ErrorIs(err, errCorruptEncoding)
+
+	future := append([]byte{}, payload...)
+	future[5] = 2
+	_, err = LoadCompiled(bytes.NewReader(future))
+	ass.EqualError(err, "unsupported compiled encoding version 2")
+}
+
+func BenchmarkLoadCompiled(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var compiled, serialized bytes.Buffer
+	if _, err := enc.SaveCompiled(&compiled); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := enc.WriteTo(&serialized); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("LoadCompiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := LoadCompiled(bytes.NewReader(compiled.Bytes())); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ReadFrom", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ReadFrom(bytes.NewReader(serialized.Bytes())); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
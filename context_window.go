@@ -0,0 +1,119 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrContextWindowUnknown is returned for models without a known context
+// window.
+var ErrContextWindowUnknown = errors.New("tiktoken: context window unknown for model")
+
+// ContextLimits are the token limits of a model: the context window shared
+// by prompt and completion, and the most tokens a completion may have.
+type ContextLimits struct {
+	ContextWindow   int
+	MaxOutputTokens int
+}
+
+// modelContextLimits holds the limits per model family, matched like
+// modelPricing: exactly first, then by the longest family prefix.
+var modelContextLimits = map[string]ContextLimits{
+	// o200k family
+	"gpt-5":        {400000, 128000},
+	"gpt-5-mini":   {400000, 128000},
+	"gpt-5-nano":   {400000, 128000},
+	"gpt-4.1":      {1047576, 32768},
+	"gpt-4.1-mini": {1047576, 32768},
+	"gpt-4.1-nano": {1047576, 32768},
+	"gpt-4o":       {128000, 16384},
+	"gpt-4o-mini":  {128000, 16384},
+	"o1":           {200000, 100000},
+	"o1-mini":      {128000, 65536},
+	"o3":           {200000, 100000},
+	"o3-mini":      {200000, 100000},
+	"o4-mini":      {200000, 100000},
+	// cl100k family
+	"gpt-4-turbo":   {128000, 4096},
+	"gpt-4":         {8192, 8192},
+	"gpt-4-32k":     {32768, 32768},
+	"gpt-3.5-turbo": {16385, 4096},
+	// embeddings
+	"text-embedding-3-small": {8191, 0},
+	"text-embedding-3-large": {8191, 0},
+	"text-embedding-ada-002": {8191, 0},
+}
+
+var contextLimitsMu sync.RWMutex
+
+// SetContextWindow adds or overrides the limits of a model or model family.
+func SetContextWindow(model string, limits ContextLimits) {
+	contextLimitsMu.Lock()
+	defer contextLimitsMu.Unlock()
+	modelContextLimits[model] = limits
+}
+
+// ModelContextLimits returns the limits of model, or an error wrapping
+// ErrContextWindowUnknown.
+func ModelContextLimits(model string) (ContextLimits, error) {
+	contextLimitsMu.RLock()
+	defer contextLimitsMu.RUnlock()
+	if limits, ok := modelContextLimits[model]; ok {
+		return limits, nil
+	}
+	best := ""
+	for family := range modelContextLimits {
+		if len(family) > len(best) && strings.HasPrefix(model, family+"-") {
+			best = family
+		}
+	}
+	if best == "" {
+		return ContextLimits{}, fmt.Errorf("%w: %s", ErrContextWindowUnknown, model)
+	}
+	return modelContextLimits[best], nil
+}
+
+// ContextWindow returns the context window of model in tokens, or an error
+// wrapping ErrContextWindowUnknown.
+func ContextWindow(model string) (int, error) {
+	limits, err := ModelContextLimits(model)
+	return limits.ContextWindow, err
+}
+
+// ModelContextWindow is ContextWindow, named like ModelMaxOutputTokens.
+func ModelContextWindow(model string) (int, error) {
+	return ContextWindow(model)
+}
+
+// ModelMaxOutputTokens returns the most tokens a completion of model may
+// have, 0 for embedding models, or an error wrapping
+// ErrContextWindowUnknown. Both limits count towards the context window,
+// so the room left for the output of a prompt is the smaller of this and
+// the window minus the prompt tokens.
+func ModelMaxOutputTokens(model string) (int, error) {
+	limits, err := ModelContextLimits(model)
+	return limits.MaxOutputTokens, err
+}
+
+// FitsInContext reports whether text, counted as by CountTokens, fits in
+// the context window of model with reserveOutput tokens left for the
+// completion. Counting stops as soon as text is known not to fit, so
+// checking a huge text costs little more than the window. The count
+// returned is exact if text fits and otherwise the count at which it
+// stopped, over the limit.
+func (t *Tiktoken) FitsInContext(text string, model string, reserveOutput int) (bool, int, error) {
+	if t.isClosed() {
+		return false, 0, ErrClosed
+	}
+	window, err := ContextWindow(model)
+	if err != nil {
+		return false, 0, err
+	}
+	if reserveOutput < 0 {
+		reserveOutput = 0
+	}
+	n, fits := t.bpe.countOrdinaryUpTo(t.prepareText(text), window-reserveOutput)
+	return fits, n, nil
+}
@@ -0,0 +1,88 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextWindow(t *testing.T) {
+	ass := assert.New(t)
+	n, err := ContextWindow("gpt-4o")
+	ass.Nil(err)
+	ass.Equal(128000, n)
+	n, err = ContextWindow("gpt-4o-mini-2024-07-18")
+	ass.Nil(err)
+	ass.Equal(128000, n)
+	n, err = ContextWindow("gpt-4-32k-0613")
+	ass.Nil(err)
+	ass.Equal(32768, n)
+	limits, err := ModelContextLimits("o1")
+	ass.Nil(err)
+	ass.Equal(ContextLimits{200000, 100000}, limits)
+
+	n, err = ModelContextWindow("gpt-5-2025-08-07")
+	ass.Nil(err)
+	ass.Equal(400000, n)
+	n, err = ModelMaxOutputTokens("gpt-4o-2024-08-06")
+	ass.Nil(err)
+	ass.Equal(16384, n)
+	n, err = ModelMaxOutputTokens("text-embedding-3-small")
+	ass.Nil(err)
+	ass.Equal(0, n)
+	_, err = ModelMaxOutputTokens("my-model")
+	ass.ErrorIs(err, ErrContextWindowUnknown)
+
+	_, err = ContextWindow("my-model")
+	ass.ErrorIs(err, ErrContextWindowUnknown)
+	SetContextWindow("my-model", ContextLimits{ContextWindow: 10})
+	defer func() {
+		contextLimitsMu.Lock()
+		delete(modelContextLimits, "my-model")
+		contextLimitsMu.Unlock()
+	}()
+	n, err = ContextWindow("my-model-v2")
+	ass.Nil(err)
+	ass.Equal(10, n)
+	n, err = ModelMaxOutputTokens("my-model-v2")
+	ass.Nil(err)
+	ass.Equal(0, n)
+}
+
+func TestFitsInContext(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	SetContextWindow("fits-test", ContextLimits{ContextWindow: 10})
+	defer func() {
+		contextLimitsMu.Lock()
+		delete(modelContextLimits, "fits-test")
+		contextLimitsMu.Unlock()
+	}()
+
+	text := "hello" + strings.Repeat(" hello", 3)
+	ass.Equal(4, tk.CountTokens(text))
+	fits, n, err := tk.FitsInContext(text, "fits-test", 6)
+	ass.Nil(err)
+	ass.True(fits)
+	ass.Equal(4, n)
+	fits, n, err = tk.FitsInContext(text, "fits-test", 7)
+	ass.Nil(err)
+	ass.False(fits)
+	ass.Equal(4, n)
+
+	// counting stops right after the limit
+	huge := strings.Repeat("hello ", 100000)
+	fits, n, err = tk.FitsInContext(huge, "fits-test", 0)
+	ass.Nil(err)
+	ass.False(fits)
+	ass.Equal(11, n)
+	fits, n, err = tk.FitsInContext("日本語 "+huge, "fits-test", 0)
+	ass.Nil(err)
+	ass.False(fits)
+	ass.Equal(11, n)
+
+	_, _, err = tk.FitsInContext(text, "unknown-model", 0)
+	ass.ErrorIs(err, ErrContextWindowUnknown)
+}
@@ -1,162 +1,478 @@
 package tiktoken
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"regexp"
 	"sort"
-	"strings"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/dlclark/regexp2"
 )
 
 type CoreBPE struct {
 	encoder              map[string]int
-	decoder              map[int]string
 	specialTokensEncoder map[string]int
 	specialTokensDecoder map[int]string
 	tlRegex              *regexp2.Regexp
-	tlSpecialRegex       *regexp2.Regexp
-	sortedTokenBytes     [][]byte
+	specialMatcher       *specialMatcher
+	// asciiSplitter replaces tlRegex on pure-ASCII text if the pattern is
+	// one it knows, nil otherwise.
+	asciiSplitter *asciiSplitter
+	// unicodeSplitter replaces tlRegex on other valid UTF-8 text if set
+	// with WithScannerSplit.
+	unicodeSplitter *unicodeSplitter
+	// tables hold the bytes of the mergeable tokens, shared with the other
+	// encodings built on the same rank file.
+	tables *rankTables
+	// specialTokenBytes hold the bytes of the special tokens by id.
+	specialTokenBytes map[int][]byte
+	// maxPieceLength caps the byte length of a piece handed to the merge,
+	// see WithMaxPieceLength. Zero or less disables the cap.
+	maxPieceLength int
+	// closed is set by Tiktoken.Close and shared with the copies made by
+	// WithOptions.
+	closed *atomic.Bool
 }
 
+// DefaultMaxPieceLength is the piece length cap used unless changed with
+// WithMaxPieceLength. It is far longer than any piece of normal text, so
+// only degenerate input is cut.
+const DefaultMaxPieceLength = 128 << 10
+
 func NewCoreBPE(encoder map[string]int, specialTokensEncoder map[string]int, pattern string) (*CoreBPE, error) {
-	regex, err := regexp2.Compile(pattern, regexp2.None)
+	tables, err := newRankTables(encoder)
 	if err != nil {
-		return nil, fmt.Errorf("error compiling regex: %s", err)
+		return nil, err
 	}
+	return newCoreBPE(tables, specialTokensEncoder, pattern)
+}
 
-	specialRegexStrs := make([]string, 0, len(specialTokensEncoder))
-	for k := range specialTokensEncoder {
-		specialRegexStrs = append(specialRegexStrs, regexp.QuoteMeta(k))
+// rankTables are the lookup structures that depend on the mergeable ranks
+// alone. They are never modified, so encodings built on the same rank file
+// share them, see rankCache.
+//
+// Besides the encoder map, which is the MergeableRanks of the encoding,
+// they hold the token bytes once, back to back in byte order, and index
+// them with flat arrays instead of maps and slices of slices. That keeps
+// the decoding side to a few bytes per token.
+type rankTables struct {
+	encoder map[string]int
+	// tokens are the mergeable tokens in byte order, the i-th ending at
+	// ends[i] and starting where the one before it ends. tokenString is
+	// the same bytes as a string, to hand out tokens without allocating.
+	tokens      []byte
+	tokenString string
+	ends        []uint32
+	// byRank holds the sorted index plus one of each rank, 0 for ids that
+	// aren't ranks. Ranks are dense in practice; the rare far-away or
+	// negative rank goes to sparse, so a custom rank like 1<<30 can't blow
+	// up the array.
+	byRank  []uint32
+	sparse  map[int]uint32
+	maxRank int
+}
+
+func newRankTables(encoder map[string]int) (*rankTables, error) {
+	sorted := make([]string, 0, len(encoder))
+	size, maxRank := 0, -1
+	for k, v := range encoder {
+		sorted = append(sorted, k)
+		size += len(k)
+		if v > maxRank {
+			maxRank = v
+		}
 	}
-	specialRegex, err := regexp2.Compile(strings.Join(specialRegexStrs, "|"), regexp2.None)
-	if err != nil {
-		return nil, fmt.Errorf("error compiling special regex: %s", err)
+	sort.Strings(sorted)
+
+	t := &rankTables{
+		encoder: encoder,
+		tokens:  make([]byte, 0, size),
+		ends:    make([]uint32, len(sorted)),
+	}
+	t.initIndex(len(sorted), maxRank)
+	for i, k := range sorted {
+		t.tokens = append(t.tokens, k...)
+		t.ends[i] = uint32(len(t.tokens))
+		if err := t.setIndex(i, encoder[k]); err != nil {
+			return nil, err
+		}
 	}
+	t.tokenString = string(t.tokens)
+	return t, nil
+}
 
-	decoder := make(map[int]string, len(encoder))
-	for k, v := range encoder {
-		decoder[v] = k
+// initIndex allocates the rank index for n tokens of ranks up to maxRank.
+func (t *rankTables) initIndex(n, maxRank int) {
+	denseSize := maxRank + 1
+	if limit := 2*n + 1024; denseSize > limit {
+		denseSize = limit
 	}
+	t.byRank = make([]uint32, denseSize)
+	t.sparse = map[int]uint32{}
+	t.maxRank = maxRank
+}
 
-	if len(encoder) != len(decoder) {
-		return nil, errors.New("encoder and decoder map sizes are different")
+// setIndex records that the i-th token in byte order has rank.
+func (t *rankTables) setIndex(i, rank int) error {
+	slot := uint32(i + 1)
+	if rank >= 0 && rank < len(t.byRank) {
+		if t.byRank[rank] != 0 {
+			return errors.New("encoder and decoder map sizes are different")
+		}
+		t.byRank[rank] = slot
+		return nil
 	}
+	if _, ok := t.sparse[rank]; ok {
+		return errors.New("encoder and decoder map sizes are different")
+	}
+	t.sparse[rank] = slot
+	return nil
+}
 
-	specialTokensDecoder := make(map[int]string, len(specialTokensEncoder))
-	for k, v := range specialTokensEncoder {
-		specialTokensDecoder[v] = k
+// len returns the number of mergeable tokens.
+func (t *rankTables) len() int {
+	return len(t.ends)
+}
+
+// span returns the byte range of the i-th token in byte order.
+func (t *rankTables) span(i int) (int, int) {
+	start := 0
+	if i > 0 {
+		start = int(t.ends[i-1])
 	}
+	return start, int(t.ends[i])
+}
+
+// sorted returns the i-th token in byte order. Its capacity ends with it,
+// so appending to it can't overwrite the next token.
+func (t *rankTables) sorted(i int) []byte {
+	start, end := t.span(i)
+	return t.tokens[start:end:end]
+}
 
-	sortedTokenBytes := make([][]byte, 0, len(encoder))
-	for k := range encoder {
-		sortedTokenBytes = append(sortedTokenBytes, []byte(k))
+// index returns the position of rank in byte order.
+func (t *rankTables) index(rank int) (int, bool) {
+	var slot uint32
+	if rank >= 0 && rank < len(t.byRank) {
+		slot = t.byRank[rank]
+	} else {
+		slot = t.sparse[rank]
 	}
-	sort.Slice(sortedTokenBytes, func(i, j int) bool {
-		return bytes.Compare(sortedTokenBytes[i], sortedTokenBytes[j]) < 0
-	})
+	return int(slot) - 1, slot != 0
+}
 
-	return &CoreBPE{
-		encoder:              encoder,
-		specialTokensEncoder: specialTokensEncoder,
-		decoder:              decoder,
-		specialTokensDecoder: specialTokensDecoder,
-		tlRegex:              regex,
-		tlSpecialRegex:       specialRegex,
-		sortedTokenBytes:     sortedTokenBytes,
-	}, nil
+// hasRank reports whether rank is the rank of a mergeable token.
+func (t *rankTables) hasRank(rank int) bool {
+	_, ok := t.index(rank)
+	return ok
+}
+
+// rankString returns the token of rank.
+func (t *rankTables) rankString(rank int) (string, bool) {
+	i, ok := t.index(rank)
+	if !ok {
+		return "", false
+	}
+	start, end := t.span(i)
+	return t.tokenString[start:end], true
+}
+
+func newCoreBPE(tables *rankTables, specialTokensEncoder map[string]int, pattern string) (*CoreBPE, error) {
+	regex, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling regex: %s", err)
+	}
+
+	bp := &CoreBPE{
+		encoder:        tables.encoder,
+		tlRegex:        regex,
+		asciiSplitter:  asciiSplitters[pattern],
+		tables:         tables,
+		maxPieceLength: DefaultMaxPieceLength,
+		closed:         &atomic.Bool{},
+	}
+	bp.setSpecialTokens(specialTokensEncoder)
+	return bp, nil
+}
+
+// setSpecialTokens replaces the special tokens of bp and everything built
+// from them.
+func (bp *CoreBPE) setSpecialTokens(specialTokensEncoder map[string]int) {
+	bp.specialTokensEncoder = specialTokensEncoder
+	bp.specialTokensDecoder = make(map[int]string, len(specialTokensEncoder))
+	bp.specialTokenBytes = make(map[int][]byte, len(specialTokensEncoder))
+	for k, v := range specialTokensEncoder {
+		bp.specialTokensDecoder[v] = k
+		if v >= 0 {
+			bp.specialTokenBytes[v] = []byte(k)
+		}
+	}
+	bp.specialMatcher = newSpecialMatcher(specialTokensEncoder)
 }
 
 func (bp *CoreBPE) encodeNative(text string, allowedSpecial map[string]any) ([]int, int) {
-	specialRegex := bp.tlSpecialRegex
-	regex := bp.tlRegex
-	ret := []int{}
+	return bp.encodeNativeScratch([]int{}, text, allowedSpecial, &mergeScratch{})
+}
+
+// encodeNativeScratch is encodeNative appending to ret and merging with
+// the buffers of scratch.
+func (bp *CoreBPE) encodeNativeScratch(ret []int, text string, allowedSpecial map[string]any, scratch *mergeScratch) ([]int, int) {
 	lastPieceTokenLen := 0
-	textRunes := []rune(text)
+	bp.forEachSegment(text, allowedSpecial, func(piece string, start, end int) {
+		n := len(ret)
+		ret = bp.appendPieceScratch(ret, piece, scratch)
+		lastPieceTokenLen = len(ret) - n
+	}, func(special string, start, end int) {
+		ret = append(ret, bp.specialTokensEncoder[special])
+		lastPieceTokenLen = 0
+	})
+	return ret, lastPieceTokenLen
+}
+
+// forEachSegment splits text at the special tokens in allowedSpecial and
+// the text between them into pieces, calling onPiece and onSpecial in text
+// order with the byte range of each.
+func (bp *CoreBPE) forEachSegment(text string, allowedSpecial map[string]any, onPiece, onSpecial func(s string, start, end int)) {
+	bp.walkSegments(text, allowedSpecial, func(piece string, start, end int) bool {
+		onPiece(piece, start, end)
+		return true
+	}, func(special string, start, end int) bool {
+		onSpecial(special, start, end)
+		return true
+	})
+}
+
+// walkSegments is forEachSegment stopping as soon as a callback returns
+// false.
+func (bp *CoreBPE) walkSegments(text string, allowedSpecial map[string]any, onPiece, onSpecial func(s string, start, end int) bool) {
+	isAllowed := func(token string) bool {
+		_, ok := allowedSpecial[token]
+		return ok
+	}
 
 	start := 0
 	for {
-		var nextSpecial []int
-		startFind := start
-		for {
-			// Find the next allowed special token, if any
-			temp := cutRunes(textRunes, startFind, len(textRunes))
-			nextSpecial = findRegex2StringIndex(temp, specialRegex)
-			if nextSpecial != nil {
-				token := cutRunes(textRunes, startFind+nextSpecial[0], startFind+nextSpecial[1])
-				if _, ok := allowedSpecial[token]; ok {
-					break
-				}
-				startFind += nextSpecial[1]
-			} else {
-				break
-			}
+		// Find the next allowed special token, if any
+		nextStart, nextEnd := -1, -1
+		if len(allowedSpecial) > 0 {
+			nextStart, nextEnd = bp.specialMatcher.find(text[start:], isAllowed)
 		}
 
-		end := len([]rune(text))
-		if nextSpecial != nil {
-			end = start + nextSpecial[0]
+		end := len(text)
+		if nextStart >= 0 {
+			end = start + nextStart
 		}
 
 		// Okay, here we go, compare this logic to _encode_ordinary_native
-		for _, mat := range findRegex2AllStringMatchIndex(cutRunes(textRunes, start, end), regex) {
-			piece := cutRunes(textRunes, start+mat[0], start+mat[1])
-			if token, ok := bp.encoder[piece]; ok {
-				lastPieceTokenLen = 1
-				ret = append(ret, token)
-				continue
-			}
-			tokens := bytePairEncode([]byte(piece), bp.encoder)
-			lastPieceTokenLen = len(tokens)
-			ret = append(ret, tokens...)
-		}
+		offset, stopped := start, false
+		bp.walkPieces(text[start:end], func(piece string, start, end int) bool {
+			stopped = !onPiece(piece, offset+start, offset+end)
+			return !stopped
+		})
 
-		if nextSpecial != nil {
-			temp := cutRunes(textRunes, start+nextSpecial[0], start+nextSpecial[1])
-			token := bp.specialTokensEncoder[temp]
-			ret = append(ret, token)
-			start = start + nextSpecial[1]
-			lastPieceTokenLen = 0
-		} else {
-			break
+		if stopped || nextStart < 0 {
+			return
+		}
+		if !onSpecial(text[start+nextStart:start+nextEnd], start+nextStart, start+nextEnd) {
+			return
 		}
+		start += nextEnd
 	}
-
-	return ret, lastPieceTokenLen
 }
 
 func (bp *CoreBPE) encodeOrdinaryNative(text string) []int {
 	ret := []int{}
+	bp.encodeOrdinaryFunc(text, func(token int) {
+		ret = append(ret, token)
+	})
+	return ret
+}
+
+func (bp *CoreBPE) countOrdinary(text string) int {
+	n := 0
+	bp.encodeOrdinaryFunc(text, func(int) {
+		n++
+	})
+	return n
+}
+
+// encodeOrdinaryFunc is encodeOrdinaryNative without the output slice: each
+// token is handed to emit as soon as it is produced.
+func (bp *CoreBPE) encodeOrdinaryFunc(text string, emit func(token int)) {
+	scratch := mergeScratches.Get().(*mergeScratch)
+	defer mergeScratches.Put(scratch)
+	tokens := scratch.tokens[:0]
+	defer func() { scratch.tokens = tokens }()
+	bp.forEachPiece(text, func(piece string) {
+		tokens = bp.appendPieceScratch(tokens[:0], piece, scratch)
+		for _, token := range tokens {
+			emit(token)
+		}
+	})
+}
+
+// forEachPiece calls fn with every piece the pattern splits text into.
+func (bp *CoreBPE) forEachPiece(text string, fn func(piece string)) {
+	bp.forEachPieceRange(text, func(piece string, _, _ int) {
+		fn(piece)
+	})
+}
+
+// forEachPieceRange is forEachPiece also passing the byte range of each
+// piece in text. The piece equals text[start:end] unless text is invalid
+// UTF-8, whose bad bytes the pattern sees as U+FFFD.
+func (bp *CoreBPE) forEachPieceRange(text string, fn func(piece string, start, end int)) {
+	bp.walkPieces(text, func(piece string, start, end int) bool {
+		fn(piece, start, end)
+		return true
+	})
+}
+
+// walkPieces is forEachPieceRange stopping as soon as fn returns false,
+// without splitting the rest of text.
+func (bp *CoreBPE) walkPieces(text string, fn func(piece string, start, end int) bool) {
+	bp.mustOpen()
+	if bp.asciiSplitter != nil && isASCII(text) {
+		for start := 0; start < len(text); {
+			end := bp.asciiSplitter.next(text, start)
+			if !fn(text[start:end], start, end) {
+				return
+			}
+			start = end
+		}
+		return
+	}
+	if bp.unicodeSplitter != nil && utf8.ValidString(text) {
+		for start := 0; start < len(text); {
+			end := bp.unicodeSplitter.next(text, start)
+			if !fn(text[start:end], start, end) {
+				return
+			}
+			start = end
+		}
+		return
+	}
 	textRunes := []rune(text)
-	for _, mat := range findRegex2AllStringMatchIndex(text, bp.tlRegex) {
-		piece := cutRunes(textRunes, mat[0], mat[1])
-		if token, ok := bp.encoder[piece]; ok {
-			ret = append(ret, token)
-			continue
+	// pos is the byte offset of rune r
+	pos, r := 0, 0
+	advance := func(to int) int {
+		for ; r < to && pos < len(text); r++ {
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pos += size
 		}
-		tokens := bytePairEncode([]byte(piece), bp.encoder)
-		ret = append(ret, tokens...)
+		return pos
 	}
-	return ret
+	m, _ := bp.tlRegex.FindStringMatch(text)
+	for m != nil {
+		start := advance(m.Index)
+		if !fn(cutRunes(textRunes, m.Index, m.Index+m.Length), start, advance(m.Index+m.Length)) {
+			return
+		}
+		m, _ = bp.tlRegex.FindNextMatch(m)
+	}
+}
+
+// countOrdinaryUpTo is countOrdinary for at most limit tokens. If text has
+// more, it stops merging and splitting once the count passes limit and
+// returns that count and false.
+func (bp *CoreBPE) countOrdinaryUpTo(text string, limit int) (int, bool) {
+	n := 0
+	scratch := mergeScratches.Get().(*mergeScratch)
+	defer mergeScratches.Put(scratch)
+	tokens := scratch.tokens[:0]
+	defer func() { scratch.tokens = tokens }()
+	bp.walkPieces(text, func(piece string, _, _ int) bool {
+		tokens = bp.appendPieceScratch(tokens[:0], piece, scratch)
+		n += len(tokens)
+		return n <= limit
+	})
+	return n, n <= limit
+}
+
+// appendPiece appends the tokens of a single regex piece to dst. Pieces
+// longer than maxPieceLength are cut at rune boundaries and each part is
+// merged on its own.
+func (bp *CoreBPE) appendPiece(dst []int, piece string) []int {
+	return bp.appendPieceScratch(dst, piece, &mergeScratch{})
+}
+
+// mergeScratch holds the buffers appendPieceScratch needs for a piece, for
+// reuse across the pieces of many texts by one goroutine.
+type mergeScratch struct {
+	piece []byte
+	parts [][2]int
+	// tokens hold the tokens of a piece for callers that only look at
+	// them one piece at a time.
+	tokens []int
+}
+
+// appendPieceScratch is appendPiece merging in the buffers of scratch
+// instead of allocating them for every piece.
+func (bp *CoreBPE) appendPieceScratch(dst []int, piece string, scratch *mergeScratch) []int {
+	bp.mustOpen()
+	if token, ok := bp.encoder[piece]; ok {
+		return append(dst, token)
+	}
+	scratch.piece = append(scratch.piece[:0], piece...)
+	b := scratch.piece
+	for len(b) > 0 {
+		chunk := b
+		if bp.maxPieceLength > 0 && len(chunk) > bp.maxPieceLength {
+			chunk = b[:safeCut(b, bp.maxPieceLength)]
+		}
+		if len(chunk) == 1 {
+			dst = append(dst, bp.encoder[string(chunk)])
+		} else {
+			scratch.parts = bytePairMergeParts(scratch.parts, chunk, bp.encoder, nil)
+			for i := 0; i+1 < len(scratch.parts); i++ {
+				dst = append(dst, bp.encoder[string(chunk[scratch.parts[i][0]:scratch.parts[i+1][0]])])
+			}
+		}
+		b = b[len(chunk):]
+	}
+	return dst
+}
+
+// safeCut returns the largest n <= max at which b can be cut without
+// splitting a UTF-8 sequence, or max if there is no such position.
+func safeCut(b []byte, max int) int {
+	n := max
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	if n == 0 {
+		return max
+	}
+	return n
 }
 
 func (bpe *CoreBPE) decodeNative(tokens []int) []byte {
 	ret := make([]byte, 0, len(tokens)*2)
 	for _, token := range tokens {
-		tokenBytes, ok := bpe.decoder[token]
-		if !ok {
-			tokenBytes = bpe.specialTokensDecoder[token]
-		}
-		if len(tokenBytes) > 0 {
-			ret = append(ret, tokenBytes...)
-		}
+		ret = append(ret, bpe.tokenBytes(token)...)
 	}
 	return ret
 }
 
+// tokenBytes returns the bytes of token, or nil if it is unknown. Ordinary
+// tokens win when a special token reuses their id.
+func (bpe *CoreBPE) tokenBytes(token int) []byte {
+	bpe.mustOpen()
+	if i, ok := bpe.tables.index(token); ok && token >= 0 {
+		return bpe.tables.sorted(i)
+	}
+	return bpe.specialTokenBytes[token]
+}
+
+func (bpe *CoreBPE) hasToken(token int) bool {
+	return bpe.tokenBytes(token) != nil
+}
+
 func findRegex2StringIndex(text string, reg *regexp2.Regexp) []int {
+	if reg == nil {
+		return nil
+	}
 	m, _ := reg.FindStringMatch(text)
 	if m == nil {
 		return nil
@@ -0,0 +1,197 @@
+package tiktoken
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// CountFilesOption configures CountTokensInFiles.
+type CountFilesOption func(*countFilesConfig)
+
+type countFilesConfig struct {
+	binaryThreshold float64
+	sampleSize      int
+}
+
+// WithBinaryThreshold makes CountTokensInFiles skip files whose first
+// kilobytes contain more than ratio invalid UTF-8 bytes. The default is 0.1;
+// a ratio of 1 or more disables the check.
+func WithBinaryThreshold(ratio float64) CountFilesOption {
+	return func(c *countFilesConfig) {
+		c.binaryThreshold = ratio
+	}
+}
+
+// CountFilesError collects the errors of individual files.
+type CountFilesError struct {
+	Errors map[string]error
+}
+
+func (e *CountFilesError) Error() string {
+	paths := make([]string, 0, len(e.Errors))
+	for path := range e.Errors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	msgs := make([]string, len(paths))
+	for i, path := range paths {
+		msgs[i] = fmt.Sprintf("%s: %v", path, e.Errors[path])
+	}
+	return fmt.Sprintf("counting tokens failed for %d files: %s", len(paths), strings.Join(msgs, "; "))
+}
+
+// CountTokensInFiles counts the tokens of every file in paths, walking into
+// directories, using up to workers goroutines. Files are streamed, never read
+// into memory at once, and counted as EncodeOrdinary would, token filters
+// included but without the input options of WithOptions. Files that look
+// binary are skipped and not reported.
+//
+// It returns the count per file and the total. Failures of individual files
+// are returned together as a *CountFilesError after all other files have been
+// counted; only cancellation of ctx stops the run early, returning ctx.Err()
+// along with the counts gathered so far.
+func CountTokensInFiles(ctx context.Context, enc *Tiktoken, paths []string, workers int, opts ...CountFilesOption) (map[string]int64, int64, error) {
+	cfg := countFilesConfig{binaryThreshold: 0.1, sampleSize: 8 * 1024}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if enc.isClosed() {
+		return nil, 0, ErrClosed
+	}
+
+	var (
+		mu     sync.Mutex
+		counts = map[string]int64{}
+		errs   = map[string]error{}
+		total  int64
+	)
+
+	files := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range files {
+				n, skipped, err := countFile(ctx, enc, path, &cfg)
+				mu.Lock()
+				if err != nil {
+					if ctx.Err() == nil {
+						errs[path] = err
+					}
+				} else if !skipped {
+					counts[path] = n
+					total += n
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	walkErr := func() error {
+		for _, root := range paths {
+			err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					mu.Lock()
+					errs[path] = err
+					mu.Unlock()
+					return nil
+				}
+				if d.IsDir() || !d.Type().IsRegular() {
+					return nil
+				}
+				select {
+				case files <- path:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	close(files)
+	wg.Wait()
+
+	if walkErr != nil {
+		return counts, total, walkErr
+	}
+	if err := ctx.Err(); err != nil {
+		return counts, total, err
+	}
+	if len(errs) > 0 {
+		return counts, total, &CountFilesError{Errors: errs}
+	}
+	return counts, total, nil
+}
+
+func countFile(ctx context.Context, enc *Tiktoken, path string, cfg *countFilesConfig) (int64, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	var n int64
+	count := func(token int) {
+		if _, ok := enc.filterToken(token); ok {
+			n++
+		}
+	}
+	stream := newStreamEncoder(enc.bpe)
+	buf := make([]byte, 64*1024)
+	first := true
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, false, err
+		}
+		m, err := f.Read(buf)
+		if first && m > 0 {
+			first = false
+			if looksBinary(buf[:minInt(m, cfg.sampleSize)], cfg.binaryThreshold) {
+				return 0, true, nil
+			}
+		}
+		stream.write(buf[:m], count)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	stream.flush(count)
+	return n, false, nil
+}
+
+func looksBinary(sample []byte, threshold float64) bool {
+	if threshold >= 1 || len(sample) == 0 {
+		return false
+	}
+	// a rune cut off at the end of the sample is not evidence of anything
+	sample = sample[:completeUTF8Prefix(sample)]
+	total := len(sample)
+	invalid := 0
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r == utf8.RuneError && size == 1 || r == 0 {
+			invalid++
+		}
+		sample = sample[size:]
+	}
+	return float64(invalid) > threshold*float64(total)
+}
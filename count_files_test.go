@@ -0,0 +1,63 @@
+package tiktoken
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountTokensInFiles(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":        multilingualText,
+		"sub/b.txt":    strings.Repeat("hello world ", 20000),
+		"sub/c/d.md":   "# title\n\nsome text",
+		"blob.bin":     string([]byte{0xff, 0xfe, 0x00, 0x01, 0x80, 0x81, 0x90, 0x00}),
+		"sub/empty.go": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		ass.Nil(os.MkdirAll(filepath.Dir(path), 0700))
+		ass.Nil(os.WriteFile(path, []byte(content), 0600))
+	}
+
+	counts, total, err := CountTokensInFiles(context.Background(), enc, []string{dir}, 3)
+	ass.Nil(err)
+	var sum int64
+	for name, content := range files {
+		if name == "blob.bin" {
+			continue
+		}
+		want := int64(enc.CountTokens(content))
+		ass.Equal(want, counts[filepath.Join(dir, name)], name)
+		sum += want
+	}
+	ass.NotContains(counts, filepath.Join(dir, "blob.bin"), "binary files are skipped")
+	ass.Equal(sum, total)
+
+	counts, _, err = CountTokensInFiles(context.Background(), enc, []string{dir}, 1, WithBinaryThreshold(1))
+	ass.Nil(err)
+	ass.Contains(counts, filepath.Join(dir, "blob.bin"))
+
+	missing := filepath.Join(dir, "missing.txt")
+	counts, total, err = CountTokensInFiles(context.Background(), enc, []string{filepath.Join(dir, "a.txt"), missing}, 2)
+	var filesErr *CountFilesError
+	ass.True(errors.As(err, &filesErr))
+	ass.Contains(filesErr.Errors, missing)
+	ass.Equal(int64(enc.CountTokens(multilingualText)), total, "other files are still counted")
+	ass.Len(counts, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = CountTokensInFiles(ctx, enc, []string{dir}, 2)
+	ass.ErrorIs(err, context.Canceled)
+}
@@ -0,0 +1,127 @@
+package tiktoken
+
+import (
+	"bytes"
+	"io"
+)
+
+// TokenCounter is an io.Writer that counts the tokens of everything written
+// to it, so a stream can be counted while it is copied elsewhere:
+//
+//	counter := tke.NewTokenCounter()
+//	io.Copy(io.MultiWriter(file, counter), resp.Body)
+//	counter.Flush()
+//	n := counter.Count()
+//
+// Writes may split the text anywhere, even inside a UTF-8 sequence. After
+// Flush the count equals CountTokens of the concatenated input, token
+// filters included.
+type TokenCounter struct {
+	t      *Tiktoken
+	stream *streamEncoder
+	count  int64
+	// in is where Write sends text once the BOM is handled, a normalizing
+	// writer in front of the stream encoder if t normalizes its input.
+	in      io.WriteCloser
+	started bool
+	head    []byte
+	// onToken, if set, is called with every token counted.
+	onToken func(token int)
+}
+
+// NewTokenCounter returns a TokenCounter that counts with t, including the
+// encode options of t.
+func (t *Tiktoken) NewTokenCounter() *TokenCounter {
+	c := &TokenCounter{t: t, stream: newStreamEncoder(t.bpe)}
+	c.reset()
+	return c
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func (c *TokenCounter) reset() {
+	sink := writerFunc(func(p []byte) (int, error) {
+		c.stream.write(p, c.emit)
+		return len(p), nil
+	})
+	if c.t.opts.normalize {
+		c.in = c.t.opts.normForm.Writer(sink)
+	} else {
+		c.in = nopWriteCloser{sink}
+	}
+	c.started = !c.t.opts.stripBOM
+	c.head = c.head[:0]
+}
+
+func (c *TokenCounter) emit(token int) {
+	token, ok := c.t.filterToken(token)
+	if !ok {
+		return
+	}
+	c.count++
+	if c.onToken != nil {
+		c.onToken(token)
+	}
+}
+
+// Write counts the tokens of p. Tokens at the end of the text written so
+// far are only counted once later writes or Flush show where they end.
+// It only fails with ErrClosed once the encoding is closed.
+func (c *TokenCounter) Write(p []byte) (int, error) {
+	if c.t.isClosed() {
+		return 0, ErrClosed
+	}
+	if !c.started {
+		// hold back the start of the text until a BOM can be recognized
+		c.head = append(c.head, p...)
+		if len(c.head) < len(utf8BOM) && bytes.HasPrefix(utf8BOM, c.head) {
+			return len(p), nil
+		}
+		c.started = true
+		if _, err := c.in.Write(bytes.TrimPrefix(c.head, utf8BOM)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if _, err := c.in.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush counts all buffered text, as if the input ended here. Text written
+// afterwards is counted as a new text whose count adds to the total.
+func (c *TokenCounter) Flush() error {
+	if c.t.isClosed() {
+		return ErrClosed
+	}
+	if !c.started {
+		c.started = true
+		if _, err := c.in.Write(c.head); err != nil {
+			return err
+		}
+	}
+	if err := c.in.Close(); err != nil {
+		return err
+	}
+	c.stream.flush(c.emit)
+	c.reset()
+	return nil
+}
+
+// Count returns the number of tokens counted so far.
+func (c *TokenCounter) Count() int64 {
+	return c.count
+}
@@ -0,0 +1,48 @@
+package tiktoken
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestTokenCounter(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	normalizing := enc.WithOptions(WithNormalization(norm.NFC), WithStripBOM(true))
+	text := "\uFEFF" + multilingualText + "cafe\u0301 " + strings.Repeat("ab", 300)
+
+	for _, tk := range []*Tiktoken{enc, normalizing} {
+		for _, size := range []int{1, 2, 5, 64, len(text)} {
+			counter := tk.NewTokenCounter()
+			for i := 0; i < len(text); i += size {
+				end := i + size
+				if end > len(text) {
+					end = len(text)
+				}
+				n, err := counter.Write([]byte(text[i:end]))
+				ass.Nil(err)
+				ass.Equal(end-i, n)
+			}
+			ass.Nil(counter.Flush())
+			ass.Equal(int64(tk.CountTokens(text)), counter.Count(), "chunk size %d", size)
+		}
+	}
+
+	// flushing ends one text, counting continues with the next
+	counter := normalizing.NewTokenCounter()
+	var file bytes.Buffer
+	_, err = io.Copy(io.MultiWriter(&file, counter), strings.NewReader(text))
+	ass.Nil(err)
+	ass.Nil(counter.Flush())
+	ass.Equal(text, file.String())
+	_, err = counter.Write([]byte("\uFEFF"))
+	ass.Nil(err)
+	ass.Nil(counter.Flush())
+	ass.Equal(int64(normalizing.CountTokens(text)), counter.Count())
+}
@@ -0,0 +1,100 @@
+package tiktoken
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// coverageTopK is the number of tokens in Coverage.Top.
+const coverageTopK = 20
+
+// Coverage is how the tokens of a corpus use the vocabulary, see
+// CoverageReport. It marshals to JSON as is.
+type Coverage struct {
+	Tokens int64 `json:"tokens"`
+	Bytes  int64 `json:"bytes"`
+	// ByteTokens are the tokens of a single byte, which text falls back to
+	// where the vocabulary has no merge for it, and ByteTokenFraction their
+	// share of Tokens. A high fraction means the vocabulary fits the corpus
+	// badly.
+	ByteTokens        int64   `json:"byte_tokens"`
+	ByteTokenFraction float64 `json:"byte_token_fraction"`
+	// Lengths[n] is the number of tokens of n bytes.
+	Lengths        []int64 `json:"lengths"`
+	DistinctTokens int     `json:"distinct_tokens"`
+	// Top are the most frequent tokens, most frequent first and by id among
+	// equally frequent ones.
+	Top []TokenFrequency `json:"top"`
+}
+
+// TokenFrequency is a token of Coverage.Top.
+type TokenFrequency struct {
+	ID int `json:"id"`
+	// Text is the text of the token, with U+FFFD for bytes that are not
+	// valid UTF-8 on their own.
+	Text     string  `json:"text"`
+	Count    int64   `json:"count"`
+	Fraction float64 `json:"fraction"`
+}
+
+// CoverageReport encodes corpus as a TokenCounter does, that is like
+// EncodeOrdinary of the whole text, and reports how its tokens use the
+// vocabulary: how many fall back to single bytes, their lengths and the 20
+// most frequent. The corpus is streamed; memory grows with the number of
+// distinct tokens only. Token filters don't apply. It fails with the first
+// error of corpus.
+func (t *Tiktoken) CoverageReport(corpus io.Reader) (Coverage, error) {
+	var c Coverage
+	counts := map[int]int64{}
+	unfiltered := *t
+	unfiltered.filters = nil
+	counter := unfiltered.NewTokenCounter()
+	counter.onToken = func(token int) {
+		counts[token]++
+	}
+	bytes := writerFunc(func(p []byte) (int, error) {
+		c.Bytes += int64(len(p))
+		return len(p), nil
+	})
+	if _, err := io.Copy(io.MultiWriter(counter, bytes), corpus); err != nil {
+		return Coverage{}, err
+	}
+	if err := counter.Flush(); err != nil {
+		return Coverage{}, err
+	}
+
+	c.Tokens = counter.Count()
+	c.DistinctTokens = len(counts)
+	c.Lengths = []int64{}
+	top := make([]TokenFrequency, 0, len(counts))
+	for token, n := range counts {
+		length := len(t.bpe.tokenBytes(token))
+		for len(c.Lengths) <= length {
+			c.Lengths = append(c.Lengths, 0)
+		}
+		c.Lengths[length] += n
+		top = append(top, TokenFrequency{ID: token, Count: n})
+	}
+	if len(c.Lengths) > 1 {
+		c.ByteTokens = c.Lengths[1]
+	}
+	if c.Tokens > 0 {
+		c.ByteTokenFraction = float64(c.ByteTokens) / float64(c.Tokens)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].ID < top[j].ID
+	})
+	if len(top) > coverageTopK {
+		top = top[:coverageTopK]
+	}
+	for i := range top {
+		top[i].Text = strings.ToValidUTF8(string(t.bpe.tokenBytes(top[i].ID)), "�")
+		top[i].Fraction = float64(top[i].Count) / float64(c.Tokens)
+	}
+	c.Top = top
+	return c, nil
+}
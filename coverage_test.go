@@ -0,0 +1,48 @@
+package tiktoken
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoverageReport(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	// " 龘" is " \xe9" and two byte tokens
+	corpus := "hello world hello world 龘"
+	c, err := enc.CoverageReport(iotest.OneByteReader(strings.NewReader(corpus)))
+	ass.Nil(err)
+	ass.Equal(int64(enc.CountTokens(corpus)), c.Tokens)
+	ass.Equal(int64(len(corpus)), c.Bytes)
+	ass.Equal(int64(2), c.ByteTokens)
+	ass.InDelta(2/float64(c.Tokens), c.ByteTokenFraction, 1e-9)
+	var sum int64
+	for _, n := range c.Lengths {
+		sum += n
+	}
+	ass.Equal(c.Tokens, sum)
+	ass.Equal(int64(3), c.Lengths[6], "' hello' and twice ' world'")
+	ass.Equal(TokenFrequency{ID: 1879, Text: " world", Count: 2, Fraction: 2 / float64(c.Tokens)}, c.Top[0])
+	ass.Len(c.Top, c.DistinctTokens)
+
+	data, err := json.Marshal(c)
+	ass.Nil(err)
+	ass.Contains(string(data), `"byte_tokens":2,`)
+
+	empty, err := enc.CoverageReport(strings.NewReader(""))
+	ass.Nil(err)
+	ass.Zero(empty.Tokens)
+	ass.Empty(empty.Top)
+
+	boom := errors.New("boom")
+	_, err = enc.CoverageReport(io.MultiReader(strings.NewReader("hello"), iotest.ErrReader(boom)))
+	ass.True(errors.Is(err, boom))
+}
@@ -0,0 +1,128 @@
+package tiktoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// dataGymBytes returns the byte each character of the GPT-2 data gym
+// format stands for, and the bytes in the order of their ranks: the
+// printable bytes other than the space stand for themselves, the others
+// for the characters from U+0100 on.
+func dataGymBytes() (map[rune]byte, []byte) {
+	decode := make(map[rune]byte, 256)
+	order := make([]byte, 0, 256)
+	printable := func(b int) bool {
+		return b >= '!' && b <= '~' || b >= 0xa1 && b <= 0xac || b >= 0xae && b <= 0xff
+	}
+	for b := 0; b < 256; b++ {
+		if printable(b) {
+			decode[rune(b)] = byte(b)
+			order = append(order, byte(b))
+		}
+	}
+	n := 0
+	for b := 0; b < 256; b++ {
+		if !printable(b) {
+			decode[rune(256+n)] = byte(b)
+			order = append(order, byte(b))
+			n++
+		}
+	}
+	return decode, order
+}
+
+// ParseDataGymBpe converts the vocab.bpe merges and encoder.json of a GPT-2
+// style vocabulary into mergeable ranks, as data_gym_to_mergeable_bpe_ranks
+// does in the reference tiktoken: the single bytes come first, then a
+// token per merge in order. It fails unless encoder.json holds the same
+// tokens and ranks, not counting <|endoftext|> and <|startoftext|>, which
+// are special tokens.
+func ParseDataGymBpe(vocabBpe, encoderJSON []byte) (map[string]int, error) {
+	decode, order := dataGymBytes()
+	decodeToken := func(s string) (string, error) {
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			c, ok := decode[r]
+			if !ok {
+				return "", fmt.Errorf("character %q of %q is not in the data gym byte encoding", r, s)
+			}
+			b = append(b, c)
+		}
+		return string(b), nil
+	}
+
+	ranks := make(map[string]int, 50257)
+	for i, b := range order {
+		ranks[string([]byte{b})] = i
+	}
+	for i, line := range strings.Split(string(vocabBpe), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || i == 0 && strings.HasPrefix(line, "#version") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("vocab.bpe line %d: want two parts of a merge, got %q", i+1, line)
+		}
+		first, err := decodeToken(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("vocab.bpe line %d: %w", i+1, err)
+		}
+		second, err := decodeToken(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("vocab.bpe line %d: %w", i+1, err)
+		}
+		if _, ok := ranks[first+second]; ok {
+			return nil, fmt.Errorf("vocab.bpe line %d: merge %q repeats a token", i+1, line)
+		}
+		ranks[first+second] = len(ranks)
+	}
+
+	var encoder map[string]int
+	if err := json.Unmarshal(encoderJSON, &encoder); err != nil {
+		return nil, fmt.Errorf("encoder.json: %w", err)
+	}
+	delete(encoder, "<|endoftext|>")
+	delete(encoder, "<|startoftext|>")
+	if len(encoder) != len(ranks) {
+		return nil, fmt.Errorf("encoder.json has %d tokens, vocab.bpe makes %d", len(encoder), len(ranks))
+	}
+	for key, rank := range encoder {
+		token, err := decodeToken(key)
+		if err != nil {
+			return nil, fmt.Errorf("encoder.json: %w", err)
+		}
+		if want, ok := ranks[token]; !ok || want != rank {
+			return nil, fmt.Errorf("encoder.json gives %q rank %d, which doesn't match vocab.bpe", key, rank)
+		}
+	}
+	return ranks, nil
+}
+
+// LoadDataGymBpe reads a vocab.bpe and an encoder.json, local paths or
+// URLs, and converts them with ParseDataGymBpe, e.g. for GPT-2 fine-tunes
+// whose vocabulary only exists in that format. The files are read and
+// cached like rank files by the loader set with SetBpeLoader, if it was
+// made by NewDefaultBpeLoader, or else by a default one; hashes registered
+// with RegisterRankFileHash apply to them too. The ranks are the
+// MergeableRanks of an Encoding, which for GPT-2 uses the split pattern of
+// r50k_base and <|endoftext|> as 50256.
+func LoadDataGymBpe(vocabBpeFile, encoderJSONFile string) (map[string]int, error) {
+	loader, ok := currentBpeLoader().(*defaultBpeLoader)
+	if !ok {
+		loader = NewDefaultBpeLoader().(*defaultBpeLoader)
+	}
+	ctx := context.Background()
+	vocabBpe, err := loader.readFileCached(ctx, vocabBpeFile)
+	if err != nil {
+		return nil, err
+	}
+	encoderJSON, err := loader.readFileCached(ctx, encoderJSONFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDataGymBpe(vocabBpe, encoderJSON)
+}
@@ -0,0 +1,84 @@
+package tiktoken
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dataGymMerges = "#version: 0.2\nh e\nl l\nhe ll\nĠ w\nĠw o\nĊ Ċ\n"
+
+// dataGymEncoder returns the encoder.json matching dataGymMerges.
+func dataGymEncoder(t *testing.T, extra map[string]int) []byte {
+	decode, order := dataGymBytes()
+	encode := map[byte]rune{}
+	for r, b := range decode {
+		encode[b] = r
+	}
+	encoder := map[string]int{}
+	for i, b := range order {
+		encoder[string(encode[b])] = i
+	}
+	for i, token := range []string{"he", "ll", "hell", "Ġw", "Ġwo", "ĊĊ"} {
+		encoder[token] = 256 + i
+	}
+	for k, v := range extra {
+		encoder[k] = v
+	}
+	data, err := json.Marshal(encoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseDataGymBpe(t *testing.T) {
+	ass := assert.New(t)
+	ranks, err := ParseDataGymBpe([]byte(dataGymMerges), dataGymEncoder(t, map[string]int{"<|endoftext|>": 262}))
+	ass.Nil(err)
+	ass.Len(ranks, 262)
+	// the byte ranks of GPT-2
+	ass.Equal(0, ranks["!"])
+	ass.Equal(188, ranks["\x00"])
+	ass.Equal(198, ranks["\n"])
+	ass.Equal(220, ranks[" "])
+	ass.Equal(255, ranks["\xad"])
+	ass.Equal(258, ranks["hell"])
+	ass.Equal(260, ranks[" wo"])
+	ass.Equal(261, ranks["\n\n"])
+
+	enc := &Encoding{Name: "data_gym_test", PatStr: p50kPattern, MergeableRanks: ranks, SpecialTokens: map[string]int{ENDOFTEXT: 262}}
+	tk, err := newTiktokenFromEncoding(enc)
+	ass.Nil(err)
+	ass.Equal([]int{258, 78, 260, 81, 75, 67, 261, 262}, tk.Encode("hello world\n\n<|endoftext|>", []string{"all"}, nil))
+
+	// without a trailing newline, the last merge still counts
+	_, err = ParseDataGymBpe([]byte(dataGymMerges[:len(dataGymMerges)-1]), dataGymEncoder(t, nil))
+	ass.Nil(err)
+	_, err = ParseDataGymBpe([]byte(dataGymMerges), dataGymEncoder(t, map[string]int{"hell": 300}))
+	ass.ErrorContains(err, `encoder.json gives "hell" rank 300`)
+	_, err = ParseDataGymBpe([]byte(dataGymMerges+"x\n"), dataGymEncoder(t, nil))
+	ass.ErrorContains(err, "vocab.bpe line 8")
+	_, err = ParseDataGymBpe([]byte(dataGymMerges), dataGymEncoder(t, map[string]int{"ab ": 262}))
+	ass.ErrorContains(err, "has 263 tokens")
+	_, err = ParseDataGymBpe([]byte("#version: 0.2\n一 x\n"), nil)
+	ass.ErrorContains(err, "not in the data gym byte encoding")
+}
+
+func TestLoadDataGymBpe(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	dir := t.TempDir()
+	vocab, encoder := filepath.Join(dir, "vocab.bpe"), filepath.Join(dir, "encoder.json")
+	ass.Nil(os.WriteFile(vocab, []byte(dataGymMerges), 0644))
+	ass.Nil(os.WriteFile(encoder, dataGymEncoder(t, nil), 0644))
+
+	ranks, err := LoadDataGymBpe(vocab, encoder)
+	ass.Nil(err)
+	ass.Len(ranks, 262)
+	_, err = LoadDataGymBpe(vocab, filepath.Join(dir, "missing.json"))
+	ass.Error(err)
+}
@@ -0,0 +1,64 @@
+package tiktoken
+
+import "unicode/utf8"
+
+// LossReport says what DecodeLossy dropped and replaced.
+type LossReport struct {
+	// Dropped are the indices of the tokens not in the vocabulary, in order.
+	Dropped []int
+	// Repairs are the runs of invalid UTF-8 replaced with U+FFFD, in order.
+	Repairs []Repair
+	// RemovedBytes is the number of invalid bytes removed and
+	// SynthesizedBytes the number of bytes of U+FFFD put in their place.
+	RemovedBytes, SynthesizedBytes int
+}
+
+// Repair is a run of invalid UTF-8 DecodeLossy replaced with U+FFFD.
+type Repair struct {
+	// Index is the index of the token the run starts in.
+	Index int
+	// Offset is the byte offset of the U+FFFD in the text.
+	Offset int
+	// Removed is the number of bytes of the run.
+	Removed int
+}
+
+// Lossless reports whether the decoding lost nothing, i.e. gave the same
+// text as DecodeWithMode in DecodeStrict mode.
+func (r LossReport) Lossless() bool {
+	return len(r.Dropped) == 0 && len(r.Repairs) == 0
+}
+
+// DecodeLossy decodes as much of tokens as it can: it skips the tokens not
+// in the vocabulary, then replaces each run of bytes that are not valid
+// UTF-8, such as a character whose other bytes were in a dropped token, with
+// U+FFFD. Bytes either side of a dropped token that form a character are
+// kept. The report lists what was lost; it is Lossless when DecodeStrict
+// would have succeeded with the same text.
+func (t *Tiktoken) DecodeLossy(tokens []int) (string, LossReport) {
+	t.bpe.mustOpen()
+	var report LossReport
+	b, starts := t.joinTokens(tokens, func(i int) bool {
+		report.Dropped = append(report.Dropped, i)
+		return true
+	})
+
+	var ret []byte
+	last := 0
+	forEachInvalidUTF8(b, func(start, end int) bool {
+		if ret == nil {
+			ret = make([]byte, 0, len(b)+utf8.UTFMax)
+		}
+		ret = append(ret, b[last:start]...)
+		report.Repairs = append(report.Repairs, Repair{Index: tokenAt(starts, start), Offset: len(ret), Removed: end - start})
+		report.RemovedBytes += end - start
+		report.SynthesizedBytes += utf8.RuneLen(utf8.RuneError)
+		ret = utf8.AppendRune(ret, utf8.RuneError)
+		last = end
+		return true
+	})
+	if ret == nil {
+		return string(b), report
+	}
+	return string(append(ret, b[last:]...)), report
+}
@@ -0,0 +1,46 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeLossy(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	byteToken := func(b byte) int { return enc.bpe.encoder[string([]byte{b})] }
+
+	text := "hello world!你好，世界！"
+	got, report := enc.DecodeLossy(enc.Encode(text, nil, nil))
+	ass.Equal(text, got)
+	ass.True(report.Lossless())
+	ass.Equal(LossReport{}, report)
+
+	// injected ids between the bytes of 你 leave the character whole
+	got, report = enc.DecodeLossy([]int{byteToken(0xe4), -5, byteToken(0xbd), 1 << 30, byteToken(0xa0)})
+	ass.Equal("你", got)
+	ass.Equal(LossReport{Dropped: []int{1, 3}}, report)
+	ass.False(report.Lossless())
+
+	// an id that replaced the rest of a character leaves its first byte
+	tokens := append(enc.Encode("hi", nil, nil), byteToken(0xe4), 999999, byteToken(0xbd))
+	tokens = append(tokens, enc.Encode(" world", nil, nil)...)
+	tokens = append(tokens, byteToken(0xe4))
+	got, report = enc.DecodeLossy(tokens)
+	ass.Equal("hi� world�", got)
+	ass.Equal(LossReport{
+		Dropped: []int{2},
+		Repairs: []Repair{
+			{Index: 1, Offset: 2, Removed: 2},
+			{Index: 5, Offset: 11, Removed: 1},
+		},
+		RemovedBytes:     3,
+		SynthesizedBytes: 6,
+	}, report)
+
+	replaced, err := enc.DecodeWithMode(tokens, DecodeReplace)
+	ass.Nil(err)
+	ass.Equal(replaced, got)
+}
@@ -0,0 +1,144 @@
+package tiktoken
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 is returned by DecodeWithMode in DecodeStrict mode when the
+// decoded bytes are not valid UTF-8. The wrapping error names the byte offset
+// and the token the invalid sequence starts in.
+var ErrInvalidUTF8 = errors.New("tiktoken: decoded text is not valid UTF-8")
+
+// DecodeMode selects what decoding does with unknown tokens and with bytes
+// that don't form valid UTF-8, such as a token sequence cut in the middle of
+// a character.
+type DecodeMode int
+
+const (
+	// DecodeReplace skips unknown tokens and replaces each run of invalid
+	// bytes with U+FFFD, so the result is always valid UTF-8.
+	DecodeReplace DecodeMode = iota
+	// DecodeStrict fails on the first unknown token and on the first invalid
+	// UTF-8 sequence, see ErrInvalidUTF8.
+	DecodeStrict
+	// DecodeRaw skips unknown tokens and returns the bytes of the remaining
+	// tokens unchanged. It is only accepted by DecodeBytesWithMode, as the
+	// result need not be text.
+	DecodeRaw
+)
+
+func (m DecodeMode) String() string {
+	switch m {
+	case DecodeReplace:
+		return "replace"
+	case DecodeStrict:
+		return "strict"
+	case DecodeRaw:
+		return "raw"
+	}
+	return fmt.Sprintf("DecodeMode(%d)", int(m))
+}
+
+// DecodeWithMode decodes tokens to text, handling unknown tokens and invalid
+// UTF-8 as mode says. DecodeRaw is refused here, use DecodeBytesWithMode.
+func (t *Tiktoken) DecodeWithMode(tokens []int, mode DecodeMode) (string, error) {
+	if mode == DecodeRaw {
+		return "", fmt.Errorf("decode mode %v is only supported by DecodeBytesWithMode", mode)
+	}
+	b, err := t.DecodeBytesWithMode(tokens, mode)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DecodeBytesWithMode is like DecodeWithMode but returns bytes, and also
+// accepts DecodeRaw.
+func (t *Tiktoken) DecodeBytesWithMode(tokens []int, mode DecodeMode) ([]byte, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	tokens, err := t.unfilterTokens(tokens, mode == DecodeStrict)
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case DecodeRaw:
+		return t.bpe.decodeNative(tokens), nil
+	case DecodeReplace:
+		return bytes.ToValidUTF8(t.bpe.decodeNative(tokens), []byte("�")), nil
+	case DecodeStrict:
+		return t.decodeStrict(tokens)
+	}
+	return nil, fmt.Errorf("unknown decode mode %v", mode)
+}
+
+func (t *Tiktoken) decodeStrict(tokens []int) ([]byte, error) {
+	var err error
+	ret, starts := t.joinTokens(tokens, func(i int) bool {
+		err = &InvalidTokenError{Token: tokens[i], Index: i}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	forEachInvalidUTF8(ret, func(start, _ int) bool {
+		i := tokenAt(starts, start)
+		err = fmt.Errorf("%w at byte %d, in token %d at index %d", ErrInvalidUTF8, start, tokens[i], i)
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// joinTokens returns the bytes of tokens and the offset of each token's
+// bytes in them. It calls unknown with the index of every token not in the
+// vocabulary, which adds no bytes, and stops if unknown returns false.
+func (t *Tiktoken) joinTokens(tokens []int, unknown func(i int) bool) ([]byte, []int) {
+	starts := make([]int, len(tokens))
+	ret := make([]byte, 0, len(tokens)*2)
+	for i, token := range tokens {
+		starts[i] = len(ret)
+		b := t.bpe.tokenBytes(token)
+		if b == nil && !unknown(i) {
+			break
+		}
+		ret = append(ret, b...)
+	}
+	return ret, starts
+}
+
+// tokenAt returns the index of the token the byte at offset belongs to,
+// given the starts of joinTokens. Unknown tokens own no bytes.
+func tokenAt(starts []int, offset int) int {
+	return sort.Search(len(starts), func(i int) bool { return starts[i] > offset }) - 1
+}
+
+// forEachInvalidUTF8 calls fn with every maximal run [start, end) of bytes
+// of b that are not part of a valid UTF-8 sequence, the runs
+// bytes.ToValidUTF8 replaces, until fn returns false.
+func forEachInvalidUTF8(b []byte, fn func(start, end int) bool) {
+	for offset := 0; offset < len(b); {
+		r, size := utf8.DecodeRune(b[offset:])
+		if r != utf8.RuneError || size > 1 {
+			offset += size
+			continue
+		}
+		start := offset
+		for offset < len(b) {
+			if r, size := utf8.DecodeRune(b[offset:]); r != utf8.RuneError || size > 1 {
+				break
+			}
+			offset++
+		}
+		if !fn(start, offset) {
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeWithMode(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world!你好，世界！"
+	tokens := enc.Encode(text, nil, nil)
+	for _, mode := range []DecodeMode{DecodeReplace, DecodeStrict} {
+		got, err := enc.DecodeWithMode(tokens, mode)
+		ass.Nil(err, mode.String())
+		ass.Equal(text, got, mode.String())
+	}
+
+	// "hi" followed by the first byte of a three-byte character
+	lead := enc.bpe.encoder[string([]byte{0xe4})]
+	partial := append(enc.Encode("hi", nil, nil), lead)
+
+	got, err := enc.DecodeWithMode(partial, DecodeReplace)
+	ass.Nil(err)
+	ass.Equal("hi�", got)
+
+	_, err = enc.DecodeWithMode(partial, DecodeStrict)
+	ass.True(errors.Is(err, ErrInvalidUTF8))
+	ass.Contains(err.Error(), fmt.Sprintf("at byte 2, in token %d at index 1", lead))
+	_, err = enc.DecodeWithMode([]int{1, 151851}, DecodeStrict)
+	ass.EqualError(err, "invalid token 151851 at index 1")
+
+	raw, err := enc.DecodeBytesWithMode(append(partial, 151851), DecodeRaw)
+	ass.Nil(err)
+	ass.Equal([]byte{'h', 'i', 0xe4}, raw)
+	ass.Equal(string(raw), enc.Decode(partial), "Decode is the raw mode")
+	_, err = enc.DecodeWithMode(partial, DecodeRaw)
+	ass.NotNil(err)
+	_, err = enc.DecodeBytesWithMode(partial, DecodeMode(7))
+	ass.EqualError(err, "unknown decode mode DecodeMode(7)")
+}
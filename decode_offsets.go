@@ -0,0 +1,27 @@
+package tiktoken
+
+// DecodeWithOffsets is DecodeWithError also returning the byte offset in
+// text at which each token starts, aligned with tokens: token i decodes to
+// text[offsets[i]:offsets[i+1]], the last one to the end of text. Unlike
+// decoding the tokens one by one, characters split across tokens are
+// decoded whole; the offset of a token that starts inside such a character
+// points inside it too. Map a token to the characters it overlaps by
+// rounding its offsets down to the start of a character, e.g. with
+// utf8.RuneStart.
+func (t *Tiktoken) DecodeWithOffsets(tokens []int) (text string, offsets []int, err error) {
+	if t.isClosed() {
+		return "", nil, ErrClosed
+	}
+	tokens, err = t.unfilterTokens(tokens, true)
+	if err != nil {
+		return "", nil, err
+	}
+	b, offsets := t.joinTokens(tokens, func(i int) bool {
+		err = &InvalidTokenError{Token: tokens[i], Index: i}
+		return false
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return string(b), offsets, nil
+}
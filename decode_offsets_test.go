@@ -0,0 +1,44 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeWithOffsets(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world! 你好，世界 🤖 <|endoftext|>"
+	tokens := enc.Encode(text, []string{"all"}, nil)
+	got, offsets, err := enc.DecodeWithOffsets(tokens)
+	ass.Nil(err)
+	ass.Equal(text, got)
+	ass.Len(offsets, len(tokens))
+	chunks, err := enc.DecodeTokensToBytes(tokens)
+	ass.Nil(err)
+	for i, chunk := range chunks {
+		end := len(got)
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		ass.Equal(string(chunk), got[offsets[i]:end], "token %d", i)
+	}
+
+	// a character split across tokens decodes whole
+	byteToken := func(b byte) int { return enc.bpe.encoder[string([]byte{b})] }
+	got, offsets, err = enc.DecodeWithOffsets([]int{byteToken('a'), byteToken(0xe4), byteToken(0xbd), byteToken(0xa0)})
+	ass.Nil(err)
+	ass.Equal("a你", got)
+	ass.Equal([]int{0, 1, 2, 3}, offsets)
+
+	got, offsets, err = enc.DecodeWithOffsets(nil)
+	ass.Nil(err)
+	ass.Equal("", got)
+	ass.Empty(offsets)
+
+	_, _, err = enc.DecodeWithOffsets([]int{byteToken('a'), 1 << 30})
+	ass.ErrorContains(err, "invalid token 1073741824 at index 1")
+}
@@ -0,0 +1,80 @@
+package tiktoken
+
+import "fmt"
+
+// SpecialAction is what decoding does with a special token, see
+// SpecialDecodePolicy.
+type SpecialAction int
+
+const (
+	// SpecialKeep decodes special tokens to their text, as Decode does.
+	SpecialKeep SpecialAction = iota
+	// SpecialStrip drops special tokens.
+	SpecialStrip
+	// SpecialAnnotate decodes special tokens to what
+	// SpecialDecodePolicy.Annotate returns for them.
+	SpecialAnnotate
+)
+
+func (a SpecialAction) String() string {
+	switch a {
+	case SpecialKeep:
+		return "keep"
+	case SpecialStrip:
+		return "strip"
+	case SpecialAnnotate:
+		return "annotate"
+	}
+	return fmt.Sprintf("SpecialAction(%d)", int(a))
+}
+
+// SpecialDecodePolicy says what DecodeFiltered and a DecodeWriter with
+// WithSpecialPolicy do with special tokens. Special tokens are told by
+// their ids, so text that merely reads like one, such as "<|endoftext|>"
+// encoded as ordinary text, is always kept. The zero value keeps them.
+type SpecialDecodePolicy struct {
+	Action SpecialAction
+	// Annotate returns the text a special token decodes to with
+	// SpecialAnnotate, e.g. "⏹" for a stop marker or "" to drop it. It is
+	// called with the id and the text of the token.
+	Annotate func(id int, special string) string
+}
+
+// appendToken appends the bytes token decodes to under p to dst.
+func (p SpecialDecodePolicy) appendToken(bp *CoreBPE, dst []byte, token int) []byte {
+	if p.Action != SpecialKeep {
+		if special, ok := bp.specialToken(token); ok {
+			if p.Action == SpecialAnnotate && p.Annotate != nil {
+				dst = append(dst, p.Annotate(token, special)...)
+			}
+			return dst
+		}
+	}
+	return append(dst, bp.tokenBytes(token)...)
+}
+
+// specialToken returns the text of token if it is a special token and not
+// also an ordinary one.
+func (bp *CoreBPE) specialToken(token int) (string, bool) {
+	special, ok := bp.specialTokensDecoder[token]
+	if !ok {
+		return "", false
+	}
+	if bp.tables.hasRank(token) {
+		return "", false
+	}
+	return special, true
+}
+
+// DecodeFiltered is Decode with special tokens handled as policy says, for
+// showing model output to users without stop markers that leaked through.
+// Unknown tokens are skipped as by Decode.
+func (t *Tiktoken) DecodeFiltered(tokens []int, policy SpecialDecodePolicy) string {
+	t.bpe.mustOpen()
+	tokens, _ = t.unfilterTokens(tokens, false)
+	out := make([]byte, 0, len(tokens)*2)
+	for _, token := range tokens {
+		out = policy.appendToken(t.bpe, out, token)
+	}
+	return string(out)
+}
@@ -0,0 +1,48 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeFiltered(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	// the answer quotes the marker as text, then the real one follows
+	tokens := append(enc.EncodeOrdinary("say <|im_end|> now"), 151645, 151643)
+	ass.Equal("say <|im_end|> now<|im_end|><|endoftext|>", enc.DecodeFiltered(tokens, SpecialDecodePolicy{}))
+	ass.Equal(enc.Decode(tokens), enc.DecodeFiltered(tokens, SpecialDecodePolicy{Action: SpecialKeep}))
+	ass.Equal("say <|im_end|> now", enc.DecodeFiltered(tokens, SpecialDecodePolicy{Action: SpecialStrip}))
+
+	annotate := SpecialDecodePolicy{Action: SpecialAnnotate, Annotate: func(id int, special string) string {
+		if special == "<|im_end|>" {
+			return "⏹"
+		}
+		return ""
+	}}
+	ass.Equal("say <|im_end|> now⏹", enc.DecodeFiltered(tokens, annotate))
+	ass.Equal("hello", enc.DecodeFiltered([]int{14990, -1}, annotate), "unknown tokens are skipped")
+
+	var sb strings.Builder
+	w := enc.NewDecodeWriter(&sb, WithSpecialPolicy(annotate))
+	// 龘 is split across two tokens around the stop marker
+	long := enc.EncodeOrdinary("龘")
+	_, err = w.WriteTokens(long[0], 151645)
+	ass.Nil(err)
+	_, err = w.WriteTokens(long[1:]...)
+	ass.Nil(err)
+	ass.Nil(w.Close())
+	ass.Equal(enc.DecodeFiltered([]int{long[0], 151645, long[1]}, annotate), sb.String())
+
+	sb.Reset()
+	w = enc.NewDecodeWriter(&sb, WithSpecialPolicy(SpecialDecodePolicy{Action: SpecialStrip}))
+	_, err = w.WriteTokens(tokens...)
+	ass.Nil(err)
+	ass.Equal("say <|im_end|> now", sb.String())
+
+	ass.Equal("annotate", SpecialAnnotate.String())
+}
@@ -0,0 +1,83 @@
+package tiktoken
+
+import "io"
+
+// DecodeWriterOption configures a DecodeWriter.
+type DecodeWriterOption func(*DecodeWriter)
+
+// WithDropIncomplete makes Close discard a trailing incomplete UTF-8
+// sequence instead of writing U+FFFD for it.
+func WithDropIncomplete() DecodeWriterOption {
+	return func(d *DecodeWriter) {
+		d.dropIncomplete = true
+	}
+}
+
+// WithSpecialPolicy makes the DecodeWriter handle special tokens as policy
+// says, see DecodeFiltered.
+func WithSpecialPolicy(policy SpecialDecodePolicy) DecodeWriterOption {
+	return func(d *DecodeWriter) {
+		d.special = policy
+	}
+}
+
+// DecodeWriter decodes tokens as they arrive, e.g. from a streaming API,
+// and writes the text to an underlying writer. Bytes of a character that is
+// split across tokens are held back until the character is complete, so the
+// writer only ever sees whole runes.
+type DecodeWriter struct {
+	t              *Tiktoken
+	w              io.Writer
+	buf            []byte
+	dropIncomplete bool
+	special        SpecialDecodePolicy
+}
+
+// NewDecodeWriter returns a DecodeWriter that writes the text of the
+// tokens decoded with t to w.
+func (t *Tiktoken) NewDecodeWriter(w io.Writer, opts ...DecodeWriterOption) *DecodeWriter {
+	d := &DecodeWriter{t: t, w: w}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// WriteTokens decodes ids and writes all complete characters to the
+// underlying writer. It returns the number of bytes written to it. Unknown
+// tokens fail the call before anything is written, errors of the
+// underlying writer are returned as they happen.
+func (d *DecodeWriter) WriteTokens(ids ...int) (int, error) {
+	if d.t.isClosed() {
+		return 0, ErrClosed
+	}
+	for i, id := range ids {
+		if !d.t.bpe.hasToken(id) {
+			return 0, &InvalidTokenError{Token: id, Index: i}
+		}
+	}
+	for _, id := range ids {
+		d.buf = d.special.appendToken(d.t.bpe, d.buf, id)
+	}
+	complete := completeUTF8Prefix(d.buf)
+	if complete == 0 {
+		return 0, nil
+	}
+	n, err := d.w.Write(d.buf[:complete])
+	d.buf = append(d.buf[:0], d.buf[n:]...)
+	return n, err
+}
+
+// Close writes out a trailing incomplete character as U+FFFD, or drops it
+// with WithDropIncomplete. It doesn't close the underlying writer.
+func (d *DecodeWriter) Close() error {
+	if len(d.buf) == 0 {
+		return nil
+	}
+	d.buf = d.buf[:0]
+	if d.dropIncomplete {
+		return nil
+	}
+	_, err := io.WriteString(d.w, "\uFFFD")
+	return err
+}
@@ -0,0 +1,72 @@
+package tiktoken
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingWriter struct {
+	writes []string
+	err    error
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestDecodeWriter(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	tokens := enc.EncodeOrdinary(multilingualText)
+
+	w := &recordingWriter{}
+	d := enc.NewDecodeWriter(w)
+	total := 0
+	for _, token := range tokens {
+		n, err := d.WriteTokens(token)
+		ass.Nil(err)
+		total += n
+	}
+	ass.Nil(d.Close())
+	var joined bytes.Buffer
+	for _, s := range w.writes {
+		ass.True(utf8.ValidString(s), "%q", s)
+		joined.WriteString(s)
+	}
+	ass.Equal(multilingualText, joined.String())
+	ass.Equal(len(multilingualText), total)
+
+	// half of a character left at the end
+	partial := enc.bpe.encoder["\xe4\xbd"]
+	var buf bytes.Buffer
+	d = enc.NewDecodeWriter(&buf)
+	n, err := d.WriteTokens(enc.EncodeOrdinary("ok ")[0], partial)
+	ass.Nil(err)
+	ass.Equal(2, n)
+	ass.Nil(d.Close())
+	ass.Equal("ok�", buf.String())
+
+	buf.Reset()
+	d = enc.NewDecodeWriter(&buf, WithDropIncomplete())
+	_, err = d.WriteTokens(partial)
+	ass.Nil(err)
+	ass.Nil(d.Close())
+	ass.Equal("", buf.String())
+
+	_, err = d.WriteTokens(1, -1)
+	ass.EqualError(err, "invalid token -1 at index 1")
+
+	failing := errors.New("disk full")
+	d = enc.NewDecodeWriter(&recordingWriter{err: failing})
+	_, err = d.WriteTokens(tokens[0])
+	ass.Equal(failing, err)
+}
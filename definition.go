@@ -0,0 +1,97 @@
+package tiktoken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// encodingDefinition is what decides the output of a built-in encoding:
+// its split pattern, its special tokens and the rank file it expects.
+type encodingDefinition struct {
+	// source is the rank file URI, "" if the user supplies the file.
+	source   string
+	pattern  string
+	specials map[string]int
+	// rankHash is the sha256 of the expected rank file, "" if unknown.
+	rankHash string
+}
+
+// definitionRevision is a released revision of a built-in definition.
+type definitionRevision struct {
+	version int
+	hash    string
+}
+
+// definitionRevisions records the current revision of each built-in
+// encoding definition. Whenever a definition changes, TestDefinitionVersions
+// fails until its version is bumped, its hash updated and the change noted
+// in doc/encoding_definitions.md.
+var definitionRevisions = map[string]definitionRevision{
+	MODEL_CL100K_BASE:   {1, "6ee76d66641446f5"},
+	MODEL_O200K_BASE:    {1, "6d227ea9069a92ec"},
+	MODEL_O200K_HARMONY: {1, "5354576280412aad"},
+	MODEL_P50K_BASE:     {1, "cd6f6b410b6bfc8a"},
+	MODEL_P50K_EDIT:     {1, "7eb9fa4ac9becd86"},
+	MODEL_R50K_BASE:     {1, "95cf5d559b24e4d8"},
+	MODEL_QWEN_BASE:     {1, "540b41cfea45e714"},
+	MODEL_LLAMA3:        {1, "24bc2587627add59"},
+}
+
+// qwenRankHash is the sha256 of the embedded qwen rank file.
+const qwenRankHash = "b2b1b8dfb5cc5f024bafc373121c6aba3f66f9a5a0269e243470a1de16a33186"
+
+// builtinDefinition returns the definition of a built-in encoding without
+// loading its rank file.
+func builtinDefinition(encodingName string) (encodingDefinition, bool) {
+	if _, ok := builtinSpecs[encodingName]; !ok {
+		return encodingDefinition{}, false
+	}
+	spec := publishedSpec(encodingName)
+	return encodingDefinition{source: spec.RankFile, pattern: spec.Pattern, specials: spec.SpecialTokens, rankHash: spec.RankFileHash}, true
+}
+
+// hash returns the first 16 hex digits of the sha256 over the pattern, the
+// special tokens sorted by id and the rank file hash.
+func (d encodingDefinition) hash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "pattern %q\n", d.pattern)
+	for _, special := range sortedVocab(d.specials) {
+		fmt.Fprintf(h, "special %d %q\n", special.Rank, special.Token)
+	}
+	io.WriteString(h, "ranks "+d.rankHash+"\n")
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// DefinitionVersion identifies the definition that produces the tokens of
+// t: its split pattern, special tokens and rank file. Record it along with
+// persisted tokens to tell when they need to be re-tokenized after an
+// upgrade. For the built-in encodings it is "<name>/v<n>", n being bumped
+// with every change to the definition, see doc/encoding_definitions.md.
+// Other encodings get "<name>/sha256:<hash>" with a hash over the same
+// parts, computing the rank file hash on first use. Encode options such
+// as WithNormalization are not part of the definition.
+//
+// The rank files of built-in encodings are trusted to be the expected ones,
+// which downloads check; a llama3 tokenizer model, supplied by the user, is
+// not part of its definition.
+func (t *Tiktoken) DefinitionVersion() string {
+	t.bpe.mustOpen()
+	var name, source, pattern string
+	if t.pbeEncoding != nil {
+		name, source, pattern = t.pbeEncoding.Name, t.pbeEncoding.SourceURI, t.pbeEncoding.PatStr
+	}
+	d := encodingDefinition{pattern: pattern, specials: t.bpe.specialTokensEncoder}
+	builtin, ok := builtinDefinition(name)
+	if ok && (builtin.source == "" || builtin.source == source) {
+		d.rankHash = builtin.rankHash
+	} else {
+		d.rankHash = t.ContentHash()
+	}
+	hash := d.hash()
+	if rev, ok := definitionRevisions[name]; ok && rev.hash == hash {
+		return fmt.Sprintf("%s/v%d", name, rev.version)
+	}
+	return fmt.Sprintf("%s/sha256:%s", name, hash)
+}
@@ -0,0 +1,49 @@
+package tiktoken
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefinitionVersions(t *testing.T) {
+	ass := assert.New(t)
+	changelog, err := os.ReadFile("doc/encoding_definitions.md")
+	ass.Nil(err)
+	for _, name := range builtinEncodings {
+		def, ok := builtinDefinition(string(name))
+		ass.True(ok, name)
+		rev, ok := definitionRevisions[string(name)]
+		ass.True(ok, name)
+		ass.Equal(rev.hash, def.hash(), "the definition of %s changed: bump its version in definitionRevisions, update the hash and note the change in doc/encoding_definitions.md", name)
+		ass.True(strings.Contains(string(changelog), fmt.Sprintf("`%s/v%d`", name, rev.version)), "doc/encoding_definitions.md has no entry for %s/v%d", name, rev.version)
+	}
+}
+
+func TestDefinitionVersion(t *testing.T) {
+	ass := assert.New(t)
+	qwen, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Equal("qwen_base/v1", qwen.DefinitionVersion())
+	ass.Equal(qwenRankHash, qwen.ContentHash())
+	ass.Equal("qwen_base/v1", qwen.WithOptions(WithMaxPieceLength(0)).DefinitionVersion())
+
+	base, err := LoadEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	derived, err := DeriveEncoding(base, "qwen_defined", map[string]int{"<|tool|>": 152000})
+	ass.Nil(err)
+	tk, err := newTiktokenFromEncoding(derived)
+	ass.Nil(err)
+	version := tk.DefinitionVersion()
+	ass.True(strings.HasPrefix(version, "qwen_defined/sha256:"), version)
+	ass.Len(version, len("qwen_defined/sha256:")+16)
+
+	// the same ranks under a built-in name but with other special tokens
+	derived.Name = MODEL_QWEN_BASE
+	tk, err = newTiktokenFromEncoding(derived)
+	ass.Nil(err)
+	ass.True(strings.HasPrefix(tk.DefinitionVersion(), "qwen_base/sha256:"))
+}
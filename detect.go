@@ -0,0 +1,126 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrUndetermined is returned by DetectEncoding when no candidate fits the
+// samples clearly better than the others.
+var ErrUndetermined = errors.New("tiktoken: encoding undetermined")
+
+// DetectEncoding needs the best candidate to score at least
+// minDetectScore and to lead the runner-up by minDetectMargin.
+const (
+	minDetectScore  = 0.9
+	minDetectMargin = 0.05
+)
+
+// DetectOption configures DetectEncoding.
+type DetectOption func(*detectConfig)
+
+type detectConfig struct {
+	bestGuess bool
+}
+
+// WithBestGuess makes DetectEncoding return the best scoring candidate
+// even if it is not a clear match, instead of ErrUndetermined.
+func WithBestGuess() DetectOption {
+	return func(c *detectConfig) {
+		c.bestGuess = true
+	}
+}
+
+// DetectEncoding guesses which of the candidate encodings produced the
+// token sequences in samples. Each candidate scores the mean of three
+// ratios over the samples: of token ids in its vocabulary, of samples
+// decoding to valid UTF-8, and of samples that encode back to the same
+// tokens, special tokens allowed. The confidence is the lead of the best
+// score over the runner-up, or the best score if there is only one
+// candidate.
+//
+// Unless WithBestGuess is given, it fails with ErrUndetermined when the
+// best score is below 0.9 or the lead below 0.05. Nil candidates mean the
+// built-in and registered encodings, skipping those that can't be loaded;
+// a listed candidate that can't be loaded is an error. Candidates are
+// loaded with GetEncoding and stay cached.
+func DetectEncoding(samples [][]int, candidates []string, opts ...DetectOption) (string, float64, error) {
+	var c detectConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	skipFailing := candidates == nil
+	if skipFailing {
+		for _, name := range knownEncodings() {
+			candidates = append(candidates, string(name))
+		}
+	}
+
+	best, bestScore, runnerUp := "", -1.0, 0.0
+	for _, name := range candidates {
+		tk, err := GetEncoding(name)
+		if err != nil {
+			if skipFailing {
+				continue
+			}
+			return "", 0, fmt.Errorf("detect encoding: %w", err)
+		}
+		score := detectScore(tk, samples)
+		if score > bestScore {
+			best, bestScore, runnerUp = name, score, bestScore
+		} else if score > runnerUp {
+			runnerUp = score
+		}
+	}
+	if best == "" {
+		return "", 0, fmt.Errorf("%w: no candidate could be loaded", ErrUndetermined)
+	}
+	if runnerUp < 0 {
+		runnerUp = 0
+	}
+	confidence := bestScore - runnerUp
+	if !c.bestGuess && (bestScore < minDetectScore || confidence < minDetectMargin) {
+		return "", confidence, fmt.Errorf("%w: %s scores %.2f, %.2f ahead of the next candidate", ErrUndetermined, best, bestScore, confidence)
+	}
+	return best, confidence, nil
+}
+
+// detectScore rates how well tk explains samples, from 0 to 1.
+func detectScore(tk *Tiktoken, samples [][]int) float64 {
+	var tokens, known, valid, roundTrips int
+	for _, sample := range samples {
+		tokens += len(sample)
+		for _, token := range sample {
+			if tk.bpe.hasToken(token) {
+				known++
+			}
+		}
+		text := tk.bpe.decodeNative(sample)
+		if !utf8.Valid(text) {
+			continue
+		}
+		valid++
+		encoded, _ := tk.bpe.encodeNative(string(text), tk.specialTokensSet)
+		if equalTokens(encoded, sample) {
+			roundTrips++
+		}
+	}
+	if len(samples) == 0 || tokens == 0 {
+		return 0
+	}
+	n := float64(len(samples))
+	return (float64(known)/float64(tokens) + float64(valid)/n + float64(roundTrips)/n) / 3
+}
+
+func equalTokens(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
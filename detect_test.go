@@ -0,0 +1,59 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	ass := assert.New(t)
+	// one token per byte, the ids being the byte values
+	RegisterEncoding("detect_test_bytes", func() (*Encoding, error) {
+		ranks := map[string]int{}
+		for b := 0; b < 256; b++ {
+			ranks[string([]byte{byte(b)})] = b
+		}
+		return &Encoding{Name: "detect_test_bytes", PatStr: `.`, MergeableRanks: ranks, SpecialTokens: map[string]int{}}, nil
+	})
+	defer func() {
+		ReleaseEncoding("detect_test_bytes")
+		rl.Lock()
+		delete(encodingConstructors, "detect_test_bytes")
+		rl.Unlock()
+	}()
+	qwen, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	bytesEnc, err := GetEncoding("detect_test_bytes")
+	ass.Nil(err)
+	candidates := []string{MODEL_QWEN_BASE, "detect_test_bytes"}
+
+	texts := []string{"hello world", "你好，世界", "func main() { return 42 }", "<|im_start|>user"}
+	var samples [][]int
+	for _, text := range texts {
+		samples = append(samples, qwen.Encode(text, []string{"all"}, nil))
+	}
+	name, confidence, err := DetectEncoding(samples, candidates)
+	ass.Nil(err)
+	ass.Equal(MODEL_QWEN_BASE, name)
+	ass.Greater(confidence, 0.3)
+
+	samples = samples[:0]
+	for _, text := range texts {
+		samples = append(samples, bytesEnc.EncodeOrdinary(text))
+	}
+	name, _, err = DetectEncoding(samples, candidates)
+	ass.Nil(err)
+	ass.Equal("detect_test_bytes", name)
+
+	// ids valid in both that neither produced
+	garbage := [][]int{{200, 13, 250, 7}, {99, 180}}
+	_, _, err = DetectEncoding(garbage, candidates)
+	ass.ErrorIs(err, ErrUndetermined)
+	name, _, err = DetectEncoding(garbage, candidates, WithBestGuess())
+	ass.Nil(err)
+	ass.NotEmpty(name)
+
+	_, _, err = DetectEncoding(samples, []string{"no_such_encoding"})
+	ass.ErrorIs(err, ErrEncodingNotFound)
+}
@@ -0,0 +1,256 @@
+package tiktoken
+
+import (
+	"fmt"
+	"math"
+)
+
+// CommonPrefixLen returns the number of leading tokens a and b share.
+func CommonPrefixLen(a, b []int) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// CommonPrefixTokens returns the number of leading tokens the encodings of
+// textA and textB share, e.g. to estimate how much of a prompt a
+// prefix cache can serve. Both texts are encoded as by CountTokens. A
+// common text prefix doesn't imply common tokens: the tokens before the
+// point where the texts diverge can merge differently, so the result
+// compares the tokens themselves.
+func (t *Tiktoken) CommonPrefixTokens(textA, textB string) int {
+	return CommonPrefixLen(t.EncodeOrdinary(textA), t.EncodeOrdinary(textB))
+}
+
+// EditOp is the kind of an Edit.
+type EditOp int
+
+const (
+	// EditEqual tokens are in both sequences.
+	EditEqual EditOp = iota
+	// EditDelete tokens are only in the first sequence.
+	EditDelete
+	// EditInsert tokens are only in the second sequence.
+	EditInsert
+)
+
+func (op EditOp) String() string {
+	switch op {
+	case EditEqual:
+		return "equal"
+	case EditDelete:
+		return "delete"
+	case EditInsert:
+		return "insert"
+	}
+	return fmt.Sprintf("EditOp(%d)", int(op))
+}
+
+// Edit is a run of tokens of one EditOp.
+type Edit struct {
+	Op EditOp
+	// Tokens of the run, a subslice of the sequence they are taken from.
+	Tokens []int
+	// Text is Tokens decoded. A run starting or ending inside a character
+	// has U+FFFD for its bytes.
+	Text string
+}
+
+// DiffTokens returns a shortest edit script turning a into b, computed with
+// Myers' algorithm in linear space: runs of tokens equal in both, deleted
+// from a and inserted from b, in order. Concatenating the Tokens of the
+// equal and deleted runs gives a, of the equal and inserted runs b.
+func (t *Tiktoken) DiffTokens(a, b []int) []Edit {
+	d := &tokenDiffer{a: a, b: b}
+	d.diff(0, len(a), 0, len(b))
+	for i := range d.edits {
+		d.edits[i].Text = t.Decode(d.edits[i].Tokens)
+	}
+	return d.edits
+}
+
+// TokenEdit is an Edit between the tokens of two texts and where it is in
+// both of them.
+type TokenEdit struct {
+	Edit
+	// AIndex and BIndex are the index of the first token of the run in the
+	// tokens of a and b. A deleted run is at BIndex in b, an inserted one
+	// at AIndex in a.
+	AIndex, BIndex int
+	// AOffset and BOffset are the byte offsets of AIndex and BIndex in a
+	// and b.
+	AOffset, BOffset int
+}
+
+// TokenDiff encodes a and b as by CountTokens and returns the edits
+// DiffTokens finds between their tokens, with their positions in both
+// texts. The first edit that isn't EditEqual is where the tokens diverge,
+// e.g. where a prompt cache holding the tokens of a stops serving b, and
+// the deleted and inserted runs are the tokens to bill for an edit. The
+// offsets are into the texts as encoded, which differ from a and b only
+// with WithNormalization or WithStripBOM.
+func (t *Tiktoken) TokenDiff(a, b string) []TokenEdit {
+	tokensA, tokensB := t.EncodeOrdinary(a), t.EncodeOrdinary(b)
+	offsetsA, offsetsB := t.tokenOffsets(tokensA), t.tokenOffsets(tokensB)
+	edits := t.DiffTokens(tokensA, tokensB)
+	result := make([]TokenEdit, len(edits))
+	i, j := 0, 0
+	for k, e := range edits {
+		result[k] = TokenEdit{Edit: e, AIndex: i, BIndex: j, AOffset: offsetsA[i], BOffset: offsetsB[j]}
+		if e.Op != EditInsert {
+			i += len(e.Tokens)
+		}
+		if e.Op != EditDelete {
+			j += len(e.Tokens)
+		}
+	}
+	return result
+}
+
+// tokenOffsets returns the byte offset at which each of tokens starts when
+// decoded, followed by the length of the text.
+func (t *Tiktoken) tokenOffsets(tokens []int) []int {
+	text, offsets, _ := t.DecodeWithOffsets(tokens)
+	return append(offsets, len(text))
+}
+
+// tokenDiffer collects the edits between a and b.
+type tokenDiffer struct {
+	a, b  []int
+	edits []Edit
+	// start of the last edit in a or b, depending on its op
+	start int
+	// forward and reverse furthest reaching x by diagonal, reused
+	vf, vb []int
+}
+
+// emit adds the tokens in [from, to) for op, extending the last edit if it
+// has the same op.
+func (d *tokenDiffer) emit(op EditOp, from, to int) {
+	if from == to {
+		return
+	}
+	seq := d.a
+	if op == EditInsert {
+		seq = d.b
+	}
+	if n := len(d.edits); n > 0 && d.edits[n-1].Op == op {
+		d.edits[n-1].Tokens = seq[d.start:to:to]
+		return
+	}
+	d.start = from
+	d.edits = append(d.edits, Edit{Op: op, Tokens: seq[from:to:to]})
+}
+
+// diff emits the edits turning a[a0:a1] into b[b0:b1].
+func (d *tokenDiffer) diff(a0, a1, b0, b1 int) {
+	prefix := a0
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		a0++
+		b0++
+	}
+	d.emit(EditEqual, prefix, a0)
+	suffix := a1
+	for a1 > a0 && b1 > b0 && d.a[a1-1] == d.b[b1-1] {
+		a1--
+		b1--
+	}
+
+	switch {
+	case a0 == a1:
+		d.emit(EditInsert, b0, b1)
+	case b0 == b1:
+		d.emit(EditDelete, a0, a1)
+	default:
+		x, y := d.split(a0, a1, b0, b1)
+		d.diff(a0, x, b0, y)
+		d.diff(x, a1, y, b1)
+	}
+	d.emit(EditEqual, a1, suffix)
+}
+
+// split returns a point (x, y) on a shortest edit script turning a[a0:a1]
+// into b[b0:b1] about halfway through its edits, found by searching from
+// both ends at once. The sequences must be non-empty and differ in their
+// first and last tokens. Diagonals are numbered x-y; vf and vb hold the
+// furthest x reached on each by the forward and the reverse search.
+func (d *tokenDiffer) split(a0, a1, b0, b1 int) (int, int) {
+	dmin, dmax := a0-b1, a1-b0
+	size := dmax - dmin + 3
+	if len(d.vf) < size {
+		d.vf, d.vb = make([]int, size), make([]int, size)
+	}
+	off := 1 - dmin
+	vf, vb := d.vf[:size], d.vb[:size]
+	fmid, bmid := a0-b0, a1-b1
+	fmin, fmax, bmin, bmax := fmid, fmid, bmid, bmid
+	vf[off+fmid], vb[off+bmid] = a0, a1
+	odd := (fmid-bmid)%2 != 0
+
+	for {
+		// widen the forward diagonals by one on each side, within the grid
+		if fmin > dmin {
+			fmin--
+			vf[off+fmin-1] = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			vf[off+fmax+1] = -1
+		} else {
+			fmax--
+		}
+		for k := fmax; k >= fmin; k -= 2 {
+			x := vf[off+k+1]
+			if lo := vf[off+k-1]; lo >= x {
+				x = lo + 1
+			}
+			if x > a1 {
+				x = a1
+			}
+			y := x - k
+			for x < a1 && y < b1 && d.a[x] == d.b[y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if odd && bmin <= k && k <= bmax && vb[off+k] <= x {
+				return x, y
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			vb[off+bmin-1] = math.MaxInt
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			vb[off+bmax+1] = math.MaxInt
+		} else {
+			bmax--
+		}
+		for k := bmax; k >= bmin; k -= 2 {
+			x := vb[off+k+1] - 1
+			if lo := vb[off+k-1]; lo < x+1 {
+				x = lo
+			}
+			if x < a0 {
+				x = a0
+			}
+			y := x - k
+			for x > a0 && y > b0 && d.a[x-1] == d.b[y-1] {
+				x--
+				y--
+			}
+			vb[off+k] = x
+			if !odd && fmin <= k && k <= fmax && x <= vf[off+k] {
+				return x, y
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommonPrefixLen(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal(0, CommonPrefixLen(nil, []int{1}))
+	ass.Equal(2, CommonPrefixLen([]int{1, 2, 3}, []int{1, 2, 4}))
+	ass.Equal(3, CommonPrefixLen([]int{1, 2, 3}, []int{1, 2, 3, 4}))
+}
+
+func TestCommonPrefixTokens(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	// "hello" is one token, but "hel" + "p" merges differently: the texts
+	// share 3 bytes and no token
+	ass.Equal([]int{14990}, tk.EncodeOrdinary("hello"))
+	ass.NotEqual(tk.EncodeOrdinary("hello")[0], tk.EncodeOrdinary("help")[0])
+	ass.Equal(0, tk.CommonPrefixTokens("hello", "help"))
+
+	system := "You are a helpful assistant.\n"
+	a, b := system+"What is the capital of France?", system+"What is the tallest mountain?"
+	n := tk.CommonPrefixTokens(a, b)
+	ass.Equal(len(tk.EncodeOrdinary(system+"What is the")), n)
+	ass.Equal(len(tk.EncodeOrdinary(a)), tk.CommonPrefixTokens(a, a))
+}
+
+func TestDiffTokens(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	a := tk.EncodeOrdinary("the quick brown fox jumps")
+	b := tk.EncodeOrdinary("the quick red fox leaps")
+	edits := tk.DiffTokens(a, b)
+	var ops []EditOp
+	var texts []string
+	for _, e := range edits {
+		ops = append(ops, e.Op)
+		texts = append(texts, e.Text)
+	}
+	ass.Equal([]EditOp{EditEqual, EditDelete, EditInsert, EditEqual, EditDelete, EditInsert}, ops)
+	ass.Equal([]string{"the quick", " brown", " red", " fox", " jumps", " leaps"}, texts)
+	ass.Equal("delete", EditDelete.String())
+
+	ass.Empty(tk.DiffTokens(nil, nil))
+	ass.Equal([]Edit{{Op: EditInsert, Tokens: []int{14990}, Text: "hello"}}, tk.DiffTokens(nil, []int{14990}))
+}
+
+// A shortest edit script has len(a) + len(b) - 2*LCS edited tokens.
+func TestDiffTokensShortest(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	rng := rand.New(rand.NewSource(1))
+	random := func() []int {
+		s := make([]int, rng.Intn(40))
+		for i := range s {
+			s[i] = rng.Intn(4)
+		}
+		return s
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		var gotA, gotB []int
+		edited := 0
+		for _, e := range tk.DiffTokens(a, b) {
+			switch e.Op {
+			case EditEqual:
+				gotA, gotB = append(gotA, e.Tokens...), append(gotB, e.Tokens...)
+			case EditDelete:
+				gotA, edited = append(gotA, e.Tokens...), edited+len(e.Tokens)
+			case EditInsert:
+				gotB, edited = append(gotB, e.Tokens...), edited+len(e.Tokens)
+			}
+		}
+		if !ass.Equal(len(a)+len(b)-2*lcsLen(a, b), edited, "%v %v", a, b) ||
+			!ass.True(equalTokens(a, gotA) && equalTokens(b, gotB), "%v %v", a, b) {
+			return
+		}
+	}
+}
+
+func lcsLen(a, b []int) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] > dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestTokenDiff(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	a, b := "the quick brown fox jumps", "the quick red fox leaps"
+	edits := tk.TokenDiff(a, b)
+	ass.Len(edits, 6)
+	for i, e := range tk.DiffTokens(tk.EncodeOrdinary(a), tk.EncodeOrdinary(b)) {
+		ass.Equal(e, edits[i].Edit)
+	}
+	for _, e := range edits {
+		switch e.Op {
+		case EditEqual:
+			ass.Equal(e.Text, a[e.AOffset:e.AOffset+len(e.Text)])
+			ass.Equal(e.Text, b[e.BOffset:e.BOffset+len(e.Text)])
+		case EditDelete:
+			ass.Equal(e.Text, a[e.AOffset:e.AOffset+len(e.Text)])
+		case EditInsert:
+			ass.Equal(e.Text, b[e.BOffset:e.BOffset+len(e.Text)])
+		}
+	}
+	// the red fox is at the same tokens and bytes in a and b
+	ass.Equal(" fox", edits[3].Text)
+	ass.Equal(len(tk.EncodeOrdinary("the quick brown")), edits[3].AIndex)
+	ass.Equal(len(tk.EncodeOrdinary("the quick red")), edits[3].BIndex)
+	ass.Equal(len("the quick brown"), edits[3].AOffset)
+	ass.Equal(len("the quick red"), edits[3].BOffset)
+	last := edits[5]
+	ass.Equal(EditInsert, last.Op)
+	ass.Equal(len(a), last.AOffset)
+	ass.Equal(len(tk.EncodeOrdinary(a)), last.AIndex)
+
+	ass.Empty(tk.TokenDiff("", ""))
+	ass.Equal([]TokenEdit{{Edit: Edit{Op: EditDelete, Tokens: []int{14990}, Text: "hello"}}}, tk.TokenDiff("hello", ""))
+}
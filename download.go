@@ -0,0 +1,200 @@
+package tiktoken
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// partialSuffix names the bytes of an interrupted download, kept in the
+// cache directory so the next attempt can resume it with a Range request.
+const partialSuffix = ".partial"
+
+// validatorSuffix names the sidecar of a partial download holding the ETag
+// or Last-Modified value of the response it came from. It is sent as
+// If-Range, so a changed file is downloaded in full instead of spliced.
+const validatorSuffix = partialSuffix + ".validator"
+
+// ErrHashMismatch is returned when a downloaded rank file doesn't have the
+// published sha256 of its URI. The download is discarded.
+var ErrHashMismatch = errors.New("tiktoken: rank file hash mismatch")
+
+// rankFileHashes are the sha256 digests published with the reference
+// tiktoken, and those added with RegisterRankFileHash, guarded by hl.
+var rankFileHashes = map[string]string{
+	encodingSources[MODEL_CL100K_BASE]: "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+	encodingSources[MODEL_O200K_BASE]:  "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+	encodingSources[MODEL_P50K_BASE]:   "94b5ca7dff4d00767bc256fdd1b27e5b17361d7b8a5f968547f9f23eb70d2069",
+	encodingSources[MODEL_R50K_BASE]:   "306cd27f03c1a714eca7108e03d66b7dc042abe8c258b44c199a7ed9838dd930",
+}
+var hl = &sync.RWMutex{}
+
+// KnownRankFileHash returns the hex sha256 of the rank file at uri, which
+// is known for the files of the built-in OpenAI encodings and those added
+// with RegisterRankFileHash.
+func KnownRankFileHash(uri string) (string, bool) {
+	hl.RLock()
+	defer hl.RUnlock()
+	hash, ok := rankFileHashes[uri]
+	return hash, ok
+}
+
+// RegisterRankFileHash makes the default loader check the rank file at uri
+// against the hex sha256 hash, as it checks the files of the built-in
+// encodings: a download with another hash fails with ErrHashMismatch and
+// isn't cached, and a cached copy with another hash is downloaded again.
+// It fails for a hash that isn't 64 hex digits and for the URI of a
+// built-in encoding, whose hash is published.
+func RegisterRankFileHash(uri, hash string) error {
+	hash = strings.ToLower(hash)
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("rank file hash %q is not a hex sha256", hash)
+	}
+	for _, builtin := range encodingSources {
+		if uri == builtin {
+			return fmt.Errorf("rank file %s has a published hash", uri)
+		}
+	}
+	hl.Lock()
+	defer hl.Unlock()
+	rankFileHashes[uri] = hash
+	return nil
+}
+
+func checkRankFileHash(uri string, contents []byte) error {
+	want, ok := KnownRankFileHash(uri)
+	if !ok {
+		return nil
+	}
+	sum := sha256.Sum256(contents)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("%w %s: got %s, want %s", ErrHashMismatch, uri, got, want)
+	}
+	return nil
+}
+
+// downloadResumable downloads uri into tmpFilename and returns its
+// contents. If the server accepts byte ranges, the bytes of a failed
+// download are kept next to cachePath and the next call resumes from them.
+// Partial files are claimed by renaming them, so concurrent downloads never
+// append to the same file. Files larger than f.maxBytes fail with
+// ErrFileTooLarge once f.maxBytes are written.
+func (f httpFetcher) downloadResumable(ctx context.Context, uri, cachePath, tmpFilename string) ([]byte, error) {
+	partial, validatorFile := cachePath+partialSuffix, cachePath+validatorSuffix
+	var offset int64
+	var validator string
+	if err := os.Rename(partial, tmpFilename); err == nil {
+		if fi, err := os.Stat(tmpFilename); err == nil {
+			offset = fi.Size()
+		}
+		if v, err := ioutil.ReadFile(validatorFile); err == nil {
+			validator = string(v)
+		}
+	}
+	os.Remove(validatorFile)
+
+	resp, err := f.getFrom(ctx, uri, offset, validator)
+	if err == nil && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// the kept bytes don't fit the file, start over
+		resp.Body.Close()
+		offset = 0
+		resp, err = f.getFrom(ctx, uri, 0, "")
+	}
+	if err != nil {
+		keepPartial(tmpFilename, partial, validatorFile, validator, offset > 0)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && contentRangeStart(resp) == offset:
+	case resp.StatusCode == http.StatusOK:
+		// the server ignored the range or the file changed
+		flags |= os.O_TRUNC
+		offset = 0
+	default:
+		os.Remove(tmpFilename)
+		return nil, &DownloadError{URI: mirrorURL(f.mirrors, uri), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	file, err := os.OpenFile(tmpFilename, flags, cacheFileMode)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(file, io.LimitReader(resp.Body, f.maxBytes-offset+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if err = checkFileSize(offset+n, f.maxBytes); err != nil {
+			os.Remove(tmpFilename)
+			return nil, fmt.Errorf("downloading %s: %w", uri, err)
+		}
+	}
+	if err != nil {
+		newValidator := resp.Header.Get("ETag")
+		if newValidator == "" {
+			newValidator = resp.Header.Get("Last-Modified")
+		}
+		_, known := KnownRankFileHash(uri)
+		// without a validator or a known hash, resumed bytes couldn't be
+		// told apart from a changed file
+		resumable := resp.Header.Get("Accept-Ranges") == "bytes" || resp.StatusCode == http.StatusPartialContent
+		keepPartial(tmpFilename, partial, validatorFile, newValidator, resumable && n > 0 && (newValidator != "" || known))
+		return nil, fmt.Errorf("downloading %s: %w", uri, err)
+	}
+
+	contents, err := ioutil.ReadFile(tmpFilename)
+	if err == nil {
+		err = checkRankFileHash(uri, contents)
+	}
+	if err != nil {
+		os.Remove(tmpFilename)
+		return nil, err
+	}
+	return contents, nil
+}
+
+// getFrom requests uri starting at byte offset.
+func (f httpFetcher) getFrom(ctx context.Context, uri string, offset int64, validator string) (*http.Response, error) {
+	req, err := newGetRequest(ctx, mirrorURL(f.mirrors, uri), f.userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+	return f.do(req)
+}
+
+// contentRangeStart returns the first byte of a 206 response, or -1.
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d", &start, &end); err != nil {
+		return -1
+	}
+	return start
+}
+
+// keepPartial moves the bytes in tmpFilename to partial for the next
+// attempt if keep is set, and removes them otherwise.
+func keepPartial(tmpFilename, partial, validatorFile, validator string, keep bool) {
+	if !keep || os.Rename(tmpFilename, partial) != nil {
+		os.Remove(tmpFilename)
+		return
+	}
+	if validator != "" {
+		ioutil.WriteFile(validatorFile, []byte(validator), cacheFileMode)
+	}
+}
@@ -0,0 +1,322 @@
+package tiktoken
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyServer serves content, cutting the first response off after cut
+// bytes unless cut is negative. It records the Range header of every
+// request.
+func flakyServer(t *testing.T, content []byte, cut int, ranges bool) (*httptest.Server, *[]string) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Range"))
+		if len(requests) == 1 && cut >= 0 {
+			if ranges {
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("ETag", `"v1"`)
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:cut])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		if !ranges {
+			w.Write(content)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestDownloadResume(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	content := []byte("YQ== 0\nYg== 1\nYWI= 2\n")
+	srv, requests := flakyServer(t, content, 10, true)
+	uri := srv.URL + "/test.tiktoken"
+	loader := NewDefaultBpeLoader()
+
+	_, err := loader.LoadTiktokenBpe(uri)
+	ass.NotNil(err)
+	partial, err := os.ReadFile(cachePath(uri) + partialSuffix)
+	ass.Nil(err)
+	ass.Equal(content[:10], partial)
+
+	ranks, err := loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1, "ab": 2}, ranks)
+	ass.Equal([]string{"", "bytes=10-"}, *requests)
+	_, err = os.Stat(cachePath(uri) + partialSuffix)
+	ass.True(os.IsNotExist(err), "the partial download should be promoted")
+	_, err = os.Stat(cachePath(uri) + validatorSuffix)
+	ass.True(os.IsNotExist(err))
+}
+
+func TestDownloadWithoutRanges(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	content := []byte("YQ== 0\nYg== 1\n")
+	srv, requests := flakyServer(t, content, 10, false)
+	uri := srv.URL + "/test.tiktoken"
+	loader := NewDefaultBpeLoader()
+
+	_, err := loader.LoadTiktokenBpe(uri)
+	ass.NotNil(err)
+	_, err = os.Stat(cachePath(uri) + partialSuffix)
+	ass.True(os.IsNotExist(err), "bytes that can't be resumed are dropped")
+
+	ranks, err := loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+	ass.Equal([]string{"", ""}, *requests)
+}
+
+func TestDownloadChangedFile(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	content := []byte("YQ== 0\nYg== 1\n")
+	srv, requests := flakyServer(t, content, -1, true)
+	uri := srv.URL + "/test.tiktoken"
+
+	// a partial download of another version of the file
+	os.MkdirAll(cacheDir(), cacheDirMode)
+	ass.Nil(os.WriteFile(cachePath(uri)+partialSuffix, []byte("eHl6 0\n"), cacheFileMode))
+	ass.Nil(os.WriteFile(cachePath(uri)+validatorSuffix, []byte(`"v0"`), cacheFileMode))
+	ranks, err := NewDefaultBpeLoader().LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks, "If-Range should fetch the whole new version")
+	ass.Equal([]string{"bytes=7-"}, *requests)
+}
+
+func TestDownloadHashMismatch(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	content := []byte("YQ== 0\nYg== 1\n")
+	srv, _ := flakyServer(t, content, 10, true)
+	uri := srv.URL + "/test.tiktoken"
+	rankFileHashes[uri] = strings.Repeat("0", 64)
+	defer delete(rankFileHashes, uri)
+	loader := NewDefaultBpeLoader()
+
+	loader.LoadTiktokenBpe(uri)
+	_, err := loader.LoadTiktokenBpe(uri)
+	ass.ErrorIs(err, ErrHashMismatch)
+	_, err = os.Stat(cachePath(uri))
+	ass.True(os.IsNotExist(err), "a file with the wrong hash is not cached")
+	_, err = os.Stat(cachePath(uri) + partialSuffix)
+	ass.True(os.IsNotExist(err))
+
+	hash, ok := KnownRankFileHash(encodingSources[MODEL_O200K_BASE])
+	ass.True(ok)
+	ass.Len(hash, 64)
+}
+
+func TestRegisterRankFileHash(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	content := []byte("YQ== 0\nYg== 1\n")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	srv, requests := flakyServer(t, content, -1, true)
+	uri := srv.URL + "/custom.tiktoken"
+	defer func() {
+		hl.Lock()
+		delete(rankFileHashes, uri)
+		hl.Unlock()
+	}()
+
+	ass.ErrorContains(RegisterRankFileHash(uri, "abc"), "not a hex sha256")
+	ass.ErrorContains(RegisterRankFileHash(encodingSources[MODEL_CL100K_BASE], hash), "has a published hash")
+	ass.Nil(RegisterRankFileHash(uri, strings.ToUpper(hash)))
+	got, ok := KnownRankFileHash(uri)
+	ass.True(ok)
+	ass.Equal(hash, got)
+
+	loader := NewDefaultBpeLoader()
+	ranks, err := loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+	// a cached copy corrupted on disk is downloaded again
+	ass.Nil(os.WriteFile(cachePath(uri), []byte("YQ== 1\nYg== 0\n"), cacheFileMode))
+	ranks, err = loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+	ass.Len(*requests, 2)
+	ranks, err = loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Len(*requests, 2, "the new copy is cached")
+
+	// custom encodings pass the hash along
+	other := srv.URL + "/other.tiktoken"
+	defer func() {
+		hl.Lock()
+		delete(rankFileHashes, other)
+		hl.Unlock()
+	}()
+	_, err = newEncodingFromRankFile(loader, "hashed_test", other, `\w+`, nil, WithRankFileHash(strings.Repeat("0", 64)))
+	ass.ErrorIs(err, ErrHashMismatch)
+	_, err = newEncodingFromRankFile(loader, "hashed_test", other, `\w+`, nil, WithRankFileHash("xyz"))
+	ass.ErrorContains(err, "not a hex sha256")
+}
+
+func TestStaleIfError(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	content := []byte("YQ== 0\nYg== 1\n")
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write(content)
+	}))
+	defer srv.Close()
+	uri := srv.URL + "/test.tiktoken"
+	var stale []error
+	loader := NewDefaultBpeLoader(WithStaleHandler(func(staleURI string, err error) {
+		ass.Equal(uri, staleURI)
+		stale = append(stale, err)
+	}))
+	want := map[string]int{"a": 0, "b": 1}
+
+	_, err := loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Nil(loader.(cacheRevalidator).markStale(uri))
+	status = http.StatusServiceUnavailable
+	ranks, err := loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(want, ranks)
+	ass.Len(stale, 1)
+	_, err = os.Stat(cachePath(uri))
+	ass.Nil(err, "the stale copy is put back")
+
+	// without it the outage is reported and the copy kept for later
+	strict := NewDefaultBpeLoader(WithStaleIfError(false))
+	ass.Nil(strict.(cacheRevalidator).markStale(uri))
+	_, err = strict.LoadTiktokenBpe(uri)
+	ass.NotNil(err)
+	_, err = os.Stat(cachePath(uri) + staleSuffix)
+	ass.Nil(err)
+
+	// a 404 means the file is gone, not that the network is down
+	status = http.StatusNotFound
+	_, err = loader.LoadTiktokenBpe(uri)
+	ass.NotNil(err)
+
+	status = http.StatusOK
+	rankFileHashes[uri] = strings.Repeat("0", 64)
+	defer delete(rankFileHashes, uri)
+	_, err = loader.LoadTiktokenBpe(uri)
+	ass.ErrorIs(err, ErrHashMismatch)
+	ass.Len(stale, 1, "hash mismatches never fall back")
+	delete(rankFileHashes, uri)
+
+	srv.Close()
+	ranks, err = loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(want, ranks)
+	ass.Len(stale, 2)
+	_, err = os.Stat(cachePath(uri) + staleSuffix)
+	ass.True(os.IsNotExist(err))
+}
+
+func TestDownloadUserAgent(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	var agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		w.Write([]byte("YQ== 0\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := NewDefaultBpeLoader().LoadTiktokenBpe(srv.URL + "/a.tiktoken")
+	ass.Nil(err)
+	custom := NewDefaultBpeLoader(WithUserAgent("myapp/1.2 " + UserAgent()))
+	_, err = custom.LoadTiktokenBpe(srv.URL + "/b.tiktoken")
+	ass.Nil(err)
+	// uncached reads go through the plain fetcher
+	_, err = custom.(*defaultBpeLoader).readFile(context.Background(), srv.URL+"/c.tiktoken")
+	ass.Nil(err)
+
+	ass.Equal([]string{"tiktoken-go/(devel)", "myapp/1.2 tiktoken-go/(devel)", "myapp/1.2 tiktoken-go/(devel)"}, agents)
+}
+
+// roundTripperFunc is an http.RoundTripper calling itself.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestLoadTiktokenBpeContext(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hang:
+			w.Write([]byte("YQ== 0\n"))
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(hang) })
+	loader := NewDefaultBpeLoader().(BpeLoaderWithContext)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := loader.LoadTiktokenBpeContext(ctx, srv.URL+"/a.tiktoken")
+	ass.ErrorIs(err, context.DeadlineExceeded)
+	ass.Less(time.Since(start), 5*time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = loader.LoadTiktokenBpeContext(ctx, srv.URL+"/b.tiktoken")
+	ass.ErrorIs(err, context.Canceled)
+	_, err = loader.(*defaultBpeLoader).readFile(ctx, srv.URL+"/c.tiktoken")
+	ass.ErrorIs(err, context.Canceled)
+
+	ass.False(isNetworkError(fmt.Errorf("download: %w", context.Canceled)), "a cancellation doesn't fall back to a stale copy")
+	ass.True(isNetworkError(&url.Error{Op: "Get", URL: srv.URL, Err: context.DeadlineExceeded}))
+
+	fsLoader := NewFSBpeLoader(os.DirFS("."), nil).(BpeLoaderWithContext)
+	_, err = fsLoader.LoadTiktokenBpeContext(ctx, "a.tiktoken")
+	ass.ErrorIs(err, context.Canceled)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	var paths []string
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		paths = append(paths, r.URL.Path)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("YQ== 0\n")), Request: r}, nil
+	})}
+	loader := NewDefaultBpeLoader(WithHTTPClient(client))
+
+	ranks, err := loader.LoadTiktokenBpe("https://example.invalid/a.tiktoken")
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0}, ranks)
+	_, err = loader.(*defaultBpeLoader).readFile(context.Background(), "https://example.invalid/b.tiktoken")
+	ass.Nil(err)
+	ass.Equal([]string{"/a.tiktoken", "/b.tiktoken"}, paths)
+}
@@ -0,0 +1,141 @@
+package tiktoken
+
+import (
+	"fmt"
+	"hash/maphash"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// WithBatchWorkers sets the number of goroutines EncodeBatch encodes with.
+// Zero or a negative n uses GOMAXPROCS, the default.
+func WithBatchWorkers(n int) EncodeOption {
+	return func(c *encodeConfig) {
+		c.batchWorkers = n
+	}
+}
+
+// WithBatchDedup makes EncodeBatch encode each distinct text once and give
+// its tokens to every copy of it, for batches such as templated prompts
+// that repeat the same texts. Copies are found by a 64-bit hash of each
+// text, checked against the text itself, so the lookup table holds a few
+// words per distinct text and no texts. The copies share one slice unless
+// WithCopyResults is set, so appending to or changing the tokens of one
+// changes the others. It is off by default.
+func WithBatchDedup(on bool) EncodeOption {
+	return func(c *encodeConfig) {
+		c.batchDedup = on
+	}
+}
+
+// WithCopyResults gives every copy of a text its own slice of tokens under
+// WithBatchDedup, at the cost of copying them.
+func WithCopyResults(on bool) EncodeOption {
+	return func(c *encodeConfig) {
+		c.copyResults = on
+	}
+}
+
+// EncodeBatch encodes every text like EncodeWithError with nil special
+// token arguments, spreading the texts over a pool of goroutines, see
+// WithBatchWorkers. opts apply as with WithOptions. Each goroutine reuses
+// its merge and token buffers from one text to the next, and each result
+// is allocated at its final size.
+//
+// The tokens of texts[i] are at index i. If a text fails, e.g. because it
+// contains a disallowed special token, EncodeBatch stops handing out texts
+// and returns the error of the first failing text, naming its index.
+// WithBatchDedup encodes repeated texts once.
+func (t *Tiktoken) EncodeBatch(texts []string, opts ...EncodeOption) ([][]int, error) {
+	if len(opts) > 0 {
+		t = t.WithOptions(opts...)
+	}
+	// encode holds the indices of the texts to encode, first is the index
+	// of the first copy of each text under WithBatchDedup.
+	var encode, first []int
+	if t.opts.batchDedup {
+		// seen maps the hash of each distinct text to its first index
+		first = make([]int, len(texts))
+		seed := maphash.MakeSeed()
+		seen := make(map[uint64]int, len(texts))
+		for i, text := range texts {
+			h := maphash.String(seed, text)
+			j, ok := seen[h]
+			if !ok || texts[j] != text {
+				// a text whose hash collides is encoded on its own
+				if !ok {
+					seen[h] = i
+				}
+				j = i
+				encode = append(encode, i)
+			}
+			first[i] = j
+		}
+	}
+	n := len(texts)
+	if encode != nil {
+		n = len(encode)
+	}
+	workers := t.opts.batchWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+
+	results := make([][]int, len(texts))
+	var (
+		next   int64 = -1
+		failed atomic.Bool
+		mu     sync.Mutex
+		errAt  = len(texts)
+		err    error
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var scratch mergeScratch
+			var buf []int
+			for !failed.Load() {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				if encode != nil {
+					i = encode[i]
+				}
+				tokens, encErr := t.encodeScratch(buf[:0], texts[i], nil, nil, &scratch)
+				if encErr != nil {
+					mu.Lock()
+					if i < errAt {
+						errAt, err = i, encErr
+					}
+					mu.Unlock()
+					failed.Store(true)
+					return
+				}
+				buf = tokens
+				results[i] = append(make([]int, 0, len(tokens)), tokens...)
+			}
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("text %d: %w", errAt, err)
+	}
+	for i, j := range first {
+		if i == j {
+			continue
+		}
+		if t.opts.copyResults {
+			results[i] = append(make([]int, 0, len(results[j])), results[j]...)
+		} else {
+			results[i] = results[j]
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,131 @@
+package tiktoken
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func batchTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("document %d: hello world!你好，世界！ %s", i, string(rune('a'+i%26)))
+	}
+	return texts
+}
+
+func TestEncodeBatch(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	texts := append(batchTexts(200), "", "\xff", "<|endoftext|>")
+	for _, workers := range []int{0, 1, 3, 1000} {
+		got, err := enc.EncodeBatch(texts, WithBatchWorkers(workers))
+		ass.Nil(err)
+		ass.Len(got, len(texts))
+		for i, text := range texts {
+			ass.Equal(enc.Encode(text, nil, nil), got[i], "text %d with %d workers", i, workers)
+		}
+	}
+
+	got, err := enc.EncodeBatch([]string{"\uFEFFhello world"}, WithStripBOM(true))
+	ass.Nil(err)
+	ass.Equal([][]int{{14990, 1879}}, got)
+	got, err = enc.EncodeBatch(nil)
+	ass.Nil(err)
+	ass.Empty(got)
+}
+
+func TestEncodeBatchError(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	texts := batchTexts(100)
+	texts[40] = "a <|im_start|>"
+	texts[70] = "b <|endoftext|>"
+	strict := enc.WithDefaultDisallowedSpecial("all")
+	for _, workers := range []int{1, 8} {
+		_, err = strict.EncodeBatch(texts, WithBatchWorkers(workers))
+		ass.EqualError(err, "text 40: text contains disallowed special token <|im_start|>")
+	}
+}
+
+// duplicatedTexts is n texts of which nine in ten repeat an earlier one.
+func duplicatedTexts(n int) []string {
+	distinct := batchTexts(n / 10)
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = distinct[i*7%len(distinct)]
+	}
+	return texts
+}
+
+func TestEncodeBatchDedup(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	texts := append(duplicatedTexts(500), "", "", "\xff", "\xff")
+	want, err := enc.EncodeBatch(texts)
+	ass.Nil(err)
+	for _, workers := range []int{1, 4} {
+		got, err := enc.EncodeBatch(texts, WithBatchDedup(true), WithBatchWorkers(workers))
+		ass.Nil(err)
+		ass.Equal(want, got, "%d workers", workers)
+	}
+
+	texts = []string{"hello world", "你好", "hello world"}
+	shared, err := enc.EncodeBatch(texts, WithBatchDedup(true))
+	ass.Nil(err)
+	ass.Equal(&shared[0][0], &shared[2][0], "copies share their tokens")
+	copied, err := enc.EncodeBatch(texts, WithBatchDedup(true), WithCopyResults(true))
+	ass.Nil(err)
+	copied[0][0] = -1
+	ass.Equal([]int{14990, 1879}, copied[2])
+
+	texts = duplicatedTexts(100)
+	texts[30], texts[60] = "a <|im_start|>", "a <|im_start|>"
+	_, err = enc.WithDefaultDisallowedSpecial("all").EncodeBatch(texts, WithBatchDedup(true))
+	ass.EqualError(err, "text 30: text contains disallowed special token <|im_start|>")
+}
+
+func BenchmarkEncodeBatch(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	texts := batchTexts(10000)
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, text := range texts {
+				enc.Encode(text, nil, nil)
+			}
+		}
+	})
+	for _, workers := range []int{1, 4, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := enc.EncodeBatch(texts, WithBatchWorkers(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeBatchDedup(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	texts := duplicatedTexts(10000)
+	for _, dedup := range []bool{false, true} {
+		b.Run(fmt.Sprintf("dedup=%t", dedup), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := enc.EncodeBatch(texts, WithBatchDedup(dedup)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
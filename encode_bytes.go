@@ -0,0 +1,31 @@
+package tiktoken
+
+import "unsafe"
+
+// EncodeBytes is Encode for text held in a byte slice, e.g. a memory-mapped
+// file, without copying it to a string first. b must not be modified until
+// EncodeBytes returns; the tokens don't refer to it afterwards.
+func (t *Tiktoken) EncodeBytes(b []byte, allowedSpecial []string, disallowedSpecial []string) []int {
+	tokens, err := t.EncodeWithError(bytesToString(b), allowedSpecial, disallowedSpecial)
+	if err != nil {
+		panic(err.Error())
+	}
+	return tokens
+}
+
+// DecodeBytes is Decode returning the bytes instead of copying them to a
+// string.
+func (t *Tiktoken) DecodeBytes(tokens []int) []byte {
+	t.bpe.mustOpen()
+	b, _ := t.DecodeBytesWithMode(tokens, DecodeRaw)
+	return b
+}
+
+// bytesToString returns the bytes of b as a string without copying them,
+// for calls that neither keep the string nor run while b changes.
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return *(*string)(unsafe.Pointer(&b))
+}
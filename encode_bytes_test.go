@@ -0,0 +1,44 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeBytes(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	for _, text := range []string{"", "hello world", "hello <|endoftext|> 你好", parallelText(4 << 10)} {
+		b := []byte(text)
+		tokens := enc.EncodeBytes(b, []string{"all"}, nil)
+		ass.Equal(enc.Encode(text, []string{"all"}, nil), tokens)
+		ass.Equal(b, enc.DecodeBytes(tokens))
+	}
+	ass.Equal([]int{14990, 1879}, enc.EncodeBytes([]byte("hello world"), nil, nil))
+	ass.PanicsWithValue("text contains disallowed special token <|endoftext|>", func() {
+		enc.EncodeBytes([]byte("<|endoftext|>"), nil, []string{"all"})
+	})
+
+	// the tokens don't depend on the buffer once it's reused
+	b := []byte("hello world")
+	tokens := enc.EncodeBytes(b, nil, nil)
+	copy(b, "HELLO")
+	ass.Equal([]int{14990, 1879}, tokens)
+	ass.Equal([]byte{}, enc.DecodeBytes(nil))
+	ass.Equal([]byte("hello"), enc.DecodeBytes([]int{14990, -1}))
+}
+
+func BenchmarkEncodeBytes(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	text := []byte(parallelText(1 << 20))
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		enc.EncodeBytes(text, nil, nil)
+	}
+}
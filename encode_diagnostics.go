@@ -0,0 +1,286 @@
+package tiktoken
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityInfo diagnostics are worth knowing about but usually fine.
+	SeverityInfo Severity = iota
+	// SeverityWarning diagnostics point at input that is likely not what
+	// the caller meant to send, or slow to encode.
+	SeverityWarning
+	// SeverityError diagnostics point at input Encode refuses.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// DiagnosticKind is the condition a Diagnostic reports.
+type DiagnosticKind int
+
+const (
+	// DiagnosticLongPiece is a piece of the split pattern longer than
+	// DiagnosticThresholds.MaxPieceBytes, such as a base64 blob or a run of
+	// zero-width joiners.
+	DiagnosticLongPiece DiagnosticKind = iota
+	// DiagnosticDenseTokens is a stretch with more tokens per byte than
+	// DiagnosticThresholds.MaxTokensPerByte, likely binary or encoded data.
+	DiagnosticDenseTokens
+	// DiagnosticSpecialLookalike is text of the form <|name|> that is
+	// encoded as ordinary text, because it is not a special token or not
+	// allowed.
+	DiagnosticSpecialLookalike
+	// DiagnosticDisallowedSpecial is a special token the defaults of
+	// WithDefaultDisallowedSpecial disallow.
+	DiagnosticDisallowedSpecial
+)
+
+func (k DiagnosticKind) String() string {
+	switch k {
+	case DiagnosticLongPiece:
+		return "long piece"
+	case DiagnosticDenseTokens:
+		return "dense tokens"
+	case DiagnosticSpecialLookalike:
+		return "special token lookalike"
+	case DiagnosticDisallowedSpecial:
+		return "disallowed special token"
+	}
+	return fmt.Sprintf("DiagnosticKind(%d)", int(k))
+}
+
+// Diagnostic is a suspicious part of a text found by EncodeWithDiagnostics.
+type Diagnostic struct {
+	Kind     DiagnosticKind
+	Severity Severity
+	// Start and End are the byte range of the text the diagnostic is about.
+	// With input options such as WithNormalization they refer to the
+	// transformed text.
+	Start, End int
+	// Count is the number of occurrences a diagnostic stands for, with the
+	// range of the first.
+	Count   int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%v: %s at bytes %d-%d", d.Severity, d.Message, d.Start, d.End)
+}
+
+// DiagnosticThresholds configure EncodeWithDiagnostics. Zero fields keep
+// the defaults; a negative MaxPieceBytes or MaxTokensPerByte disables that
+// check.
+type DiagnosticThresholds struct {
+	// MaxPieceBytes is the longest piece not reported, by default 1024.
+	MaxPieceBytes int
+	// MaxTokensPerByte is the density of tokens above which a window of
+	// text is reported, by default 0.5. Prose has 0.15 to 0.3, code up to
+	// 0.45 and base64 more than 0.7 with most encodings.
+	MaxTokensPerByte float64
+	// RatioWindow is the number of bytes the density is measured over, by
+	// default 4096. Texts shorter than a quarter window aren't measured.
+	RatioWindow int
+}
+
+// WithDiagnosticThresholds sets the thresholds of EncodeWithDiagnostics.
+func WithDiagnosticThresholds(d DiagnosticThresholds) EncodeOption {
+	return func(c *encodeConfig) {
+		c.diagnostics = d
+	}
+}
+
+func (d DiagnosticThresholds) withDefaults() DiagnosticThresholds {
+	if d.MaxPieceBytes == 0 {
+		d.MaxPieceBytes = 1024
+	}
+	if d.MaxTokensPerByte == 0 {
+		d.MaxTokensPerByte = 0.5
+	}
+	if d.RatioWindow <= 0 {
+		d.RatioWindow = 4096
+	}
+	return d
+}
+
+// EncodeWithDiagnostics returns the tokens of Encode(text, nil, nil) and
+// the suspicious parts of text it found while encoding, see
+// DiagnosticKind, in the order of their start. Where Encode would fail on a
+// disallowed special token, it returns the tokens with the special token
+// encoded as allowed and a SeverityError diagnostic instead. Diagnostics
+// never change the tokens.
+func (t *Tiktoken) EncodeWithDiagnostics(text string) ([]int, []Diagnostic) {
+	t.bpe.mustOpen()
+	thresholds := t.opts.diagnostics.withDefaults()
+	text = t.prepareText(text)
+	allowed := t.allowedSpecialSet(t.opts.allowedSpecial)
+
+	var diags []Diagnostic
+	if disallowed := t.disallowedSpecialSet(t.opts.disallowedSpecial, allowed); len(disallowed) > 0 {
+		if m := t.findDisallowed(text, disallowed); m != "" {
+			start := strings.Index(text, m)
+			diags = append(diags, Diagnostic{
+				Kind: DiagnosticDisallowedSpecial, Severity: SeverityError,
+				Start: start, End: start + len(m), Count: 1,
+				Message: fmt.Sprintf("text contains disallowed special token %s", m),
+			})
+			allowed = union(allowed, disallowed)
+		}
+	}
+
+	var tokens []int
+	density := tokenDensity{thresholds: thresholds}
+	var specials []int
+	onPiece := func(piece string, start, end int) {
+		before := len(tokens)
+		tokens = t.bpe.appendPiece(tokens, piece)
+		if thresholds.MaxPieceBytes >= 0 && end-start > thresholds.MaxPieceBytes {
+			diags = append(diags, Diagnostic{
+				Kind: DiagnosticLongPiece, Severity: SeverityWarning,
+				Start: start, End: end, Count: 1,
+				Message: fmt.Sprintf("single piece of %d bytes exceeds %d bytes", end-start, thresholds.MaxPieceBytes),
+			})
+		}
+		density.add(start, end, len(tokens)-before, &diags)
+	}
+	onSpecial := func(special string, start, end int) {
+		tokens = append(tokens, t.bpe.specialTokensEncoder[special])
+		specials = append(specials, start)
+		density.add(start, end, 1, &diags)
+	}
+	t.bpe.forEachSegment(text, allowed, onPiece, onSpecial)
+	density.flush(&diags)
+
+	if d, ok := findSpecialLookalikes(text, specials); ok {
+		diags = append(diags, d)
+	}
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Start < diags[j].Start })
+	return t.filterTokens(tokens), diags
+}
+
+// union returns the strings in a or b.
+func union(a, b map[string]any) map[string]any {
+	result := make(map[string]any, len(a)+len(b))
+	for k := range a {
+		result[k] = nil
+	}
+	for k := range b {
+		result[k] = nil
+	}
+	return result
+}
+
+// tokenDensity reports windows of text with too many tokens per byte,
+// merging adjacent ones.
+type tokenDensity struct {
+	thresholds    DiagnosticThresholds
+	start, end    int
+	tokens        int
+	flagged       *Diagnostic
+	flaggedTokens int
+}
+
+func (d *tokenDensity) add(start, end, tokens int, diags *[]Diagnostic) {
+	if d.thresholds.MaxTokensPerByte < 0 {
+		return
+	}
+	if d.end == 0 {
+		d.start = start
+	}
+	d.end = end
+	d.tokens += tokens
+	if d.end-d.start >= d.thresholds.RatioWindow {
+		d.check(diags)
+	}
+}
+
+// check measures the current window and starts the next.
+func (d *tokenDensity) check(diags *[]Diagnostic) {
+	bytes := d.end - d.start
+	if ratio := float64(d.tokens) / float64(bytes); ratio > d.thresholds.MaxTokensPerByte {
+		if d.flagged != nil && d.flagged.End == d.start {
+			d.flagged.End = d.end
+			d.flaggedTokens += d.tokens
+		} else {
+			d.report(diags)
+			d.flagged = &Diagnostic{Kind: DiagnosticDenseTokens, Severity: SeverityWarning, Start: d.start, End: d.end, Count: 1}
+			d.flaggedTokens = d.tokens
+		}
+	}
+	d.start, d.tokens = d.end, 0
+}
+
+// flush measures the last window if it is long enough and reports the
+// flagged stretch.
+func (d *tokenDensity) flush(diags *[]Diagnostic) {
+	if d.end > d.start && d.end-d.start >= d.thresholds.RatioWindow/4 {
+		d.check(diags)
+	}
+	d.report(diags)
+}
+
+// report appends the flagged stretch to diags.
+func (d *tokenDensity) report(diags *[]Diagnostic) {
+	if d.flagged == nil {
+		return
+	}
+	f := *d.flagged
+	f.Message = fmt.Sprintf("%d tokens in %d bytes, %.2f tokens per byte, likely binary or encoded data",
+		d.flaggedTokens, f.End-f.Start, float64(d.flaggedTokens)/float64(f.End-f.Start))
+	*diags = append(*diags, f)
+	d.flagged = nil
+}
+
+// maxLookalikeName is the longest name between <| and |> counted as a
+// special token lookalike.
+const maxLookalikeName = 64
+
+// findSpecialLookalikes counts the strings of the form <|name|> in text
+// that don't start at one of the offsets of specials, which are sorted.
+func findSpecialLookalikes(text string, specials []int) (Diagnostic, bool) {
+	d := Diagnostic{Kind: DiagnosticSpecialLookalike, Severity: SeverityWarning}
+	for at := 0; ; {
+		i := strings.Index(text[at:], "<|")
+		if i < 0 {
+			break
+		}
+		start := at + i
+		at = start + 2
+		end := strings.Index(text[at:], "|>")
+		if end <= 0 || end > maxLookalikeName || strings.ContainsAny(text[at:at+end], " \t\r\n<|") {
+			continue
+		}
+		end += at + 2
+		for len(specials) > 0 && specials[0] < start {
+			specials = specials[1:]
+		}
+		if len(specials) > 0 && specials[0] == start {
+			continue
+		}
+		if d.Count == 0 {
+			d.Start, d.End = start, end
+		}
+		d.Count++
+		at = end
+	}
+	if d.Count == 0 {
+		return d, false
+	}
+	d.Message = fmt.Sprintf("input contains %d special token lookalikes encoded as text, the first %s", d.Count, text[d.Start:d.End])
+	return d, true
+}
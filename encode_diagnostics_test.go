@@ -0,0 +1,73 @@
+package tiktoken
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeWithDiagnostics(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	prose := strings.Repeat("The history of the city begins in the early Middle Ages. ", 100)
+	tokens, diags := tk.EncodeWithDiagnostics(prose)
+	ass.Equal(tk.Encode(prose, nil, nil), tokens)
+	ass.Empty(diags)
+
+	// a run of zero-width joiners is a single piece
+	zwj := "hi " + strings.Repeat("‍", 2000) + " there"
+	tokens, diags = tk.EncodeWithDiagnostics(zwj)
+	ass.Equal(tk.Encode(zwj, nil, nil), tokens)
+	ass.Len(diags, 2)
+	ass.Equal(Diagnostic{
+		Kind: DiagnosticLongPiece, Severity: SeverityWarning, Start: 2, End: 6003, Count: 1,
+		Message: "single piece of 6001 bytes exceeds 1024 bytes",
+	}, diags[1])
+	ass.Equal(DiagnosticDenseTokens, diags[0].Kind)
+
+	blob := make([]byte, 30000)
+	rand.Read(blob)
+	b64 := base64.StdEncoding.EncodeToString(blob)
+	text := prose + b64 + prose
+	tokens, diags = tk.EncodeWithDiagnostics(text)
+	ass.Equal(tk.Encode(text, nil, nil), tokens)
+	ass.Len(diags, 1)
+	d := diags[0]
+	ass.Equal(DiagnosticDenseTokens, d.Kind)
+	ass.Equal(SeverityWarning, d.Severity)
+	// windows are whole pieces, so the stretch is about the blob
+	ass.InDelta(len(prose), d.Start, 4096)
+	ass.InDelta(len(prose)+len(b64), d.End, 4096)
+	ass.Contains(d.Message, "likely binary or encoded data")
+
+	relaxed := tk.WithOptions(WithDiagnosticThresholds(DiagnosticThresholds{MaxTokensPerByte: -1, MaxPieceBytes: 10}))
+	_, diags = relaxed.EncodeWithDiagnostics(text)
+	ass.NotEmpty(diags)
+	for _, d := range diags {
+		ass.Equal(DiagnosticLongPiece, d.Kind)
+	}
+	_, diags = tk.WithOptions(WithDiagnosticThresholds(DiagnosticThresholds{MaxPieceBytes: -1})).EncodeWithDiagnostics(zwj)
+	ass.Len(diags, 1)
+
+	lookalikes := "a <|im_start|> b <|system|> c <|not a token|> <|endoftext|>"
+	tokens, diags = tk.WithDefaultAllowedSpecial(ENDOFTEXT).EncodeWithDiagnostics(lookalikes)
+	ass.Equal(tk.Encode(lookalikes, []string{ENDOFTEXT}, nil), tokens)
+	ass.Equal([]Diagnostic{{
+		Kind: DiagnosticSpecialLookalike, Severity: SeverityWarning, Start: 2, End: 14, Count: 2,
+		Message: "input contains 2 special token lookalikes encoded as text, the first <|im_start|>",
+	}}, diags)
+	ass.Equal("warning: input contains 2 special token lookalikes encoded as text, the first <|im_start|> at bytes 2-14", diags[0].String())
+
+	strict := tk.WithDefaultDisallowedSpecial("all")
+	tokens, diags = strict.EncodeWithDiagnostics("x<|im_end|>")
+	ass.Equal(tk.Encode("x<|im_end|>", []string{"all"}, nil), tokens)
+	ass.Equal([]Diagnostic{{
+		Kind: DiagnosticDisallowedSpecial, Severity: SeverityError, Start: 1, End: 11, Count: 1,
+		Message: "text contains disallowed special token <|im_end|>",
+	}}, diags)
+}
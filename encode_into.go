@@ -0,0 +1,43 @@
+package tiktoken
+
+import "sync"
+
+// mergeScratches hold the merge buffers of EncodeInto between calls.
+var mergeScratches = sync.Pool{New: func() any { return &mergeScratch{} }}
+
+// EncodeInto appends the tokens of text to dst and returns the extended
+// slice, like append. It encodes like EncodeWithError with nil special
+// token arguments, but takes its merge buffers from a pool, so a caller
+// that passes the previous result back as dst[:0] encodes without
+// allocating once dst is large enough. Only text that isn't pure ASCII, or
+// whose pattern has no ASCII fast path, still allocates while splitting.
+func (t *Tiktoken) EncodeInto(dst []int, text string) ([]int, error) {
+	scratch := mergeScratches.Get().(*mergeScratch)
+	defer mergeScratches.Put(scratch)
+	if dst == nil {
+		dst = []int{}
+	}
+	return t.encodeScratch(dst, text, nil, nil, scratch)
+}
+
+// DecodeInto appends the bytes of tokens to dst and returns the extended
+// slice, like append, failing on the first unknown token like
+// DecodeWithError. On failure dst is returned as it was passed.
+func (t *Tiktoken) DecodeInto(dst []byte, tokens []int) ([]byte, error) {
+	if t.isClosed() {
+		return dst, ErrClosed
+	}
+	tokens, err := t.unfilterTokens(tokens, true)
+	if err != nil {
+		return dst, err
+	}
+	for i, token := range tokens {
+		if !t.bpe.hasToken(token) {
+			return dst, &InvalidTokenError{Token: token, Index: i}
+		}
+	}
+	for _, token := range tokens {
+		dst = append(dst, t.bpe.tokenBytes(token)...)
+	}
+	return dst, nil
+}
@@ -0,0 +1,51 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeInto(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	tokens, err := enc.EncodeInto(nil, "hello world")
+	ass.Nil(err)
+	ass.Equal([]int{14990, 1879}, tokens)
+	tokens, err = enc.EncodeInto(tokens, " hello world!你好，世界！")
+	ass.Nil(err)
+	ass.Equal(append([]int{14990, 1879}, enc.Encode(" hello world!你好，世界！", nil, nil)...), tokens)
+	_, err = enc.WithDefaultDisallowedSpecial("all").EncodeInto(nil, ENDOFTEXT)
+	ass.EqualError(err, "text contains disallowed special token <|endoftext|>")
+
+	text := "Profiling shows tokenization dominating GC pressure in a log-processing pipeline."
+	buf := make([]int, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = enc.EncodeInto(buf[:0], text)
+	})
+	if !raceEnabled {
+		ass.Zero(allocs, "ASCII text encodes without allocating")
+	}
+	ass.Equal(enc.Encode(text, nil, nil), buf)
+}
+
+func TestDecodeInto(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	b, err := enc.DecodeInto([]byte("> "), []int{14990, 1879})
+	ass.Nil(err)
+	ass.Equal("> hello world", string(b))
+	b, err = enc.DecodeInto(b, []int{14990, -1})
+	ass.EqualError(err, "invalid token -1 at index 1")
+	ass.Equal("> hello world", string(b), "dst is kept on failure")
+
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = enc.DecodeInto(buf[:0], []int{14990, 1879})
+	})
+	ass.Zero(allocs)
+}
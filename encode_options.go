@@ -0,0 +1,125 @@
+package tiktoken
+
+import "fmt"
+
+// SpecialSet selects special tokens for EncodeOptions, like a set or "all"
+// passed as allowed_special or disallowed_special to the Python library.
+// The zero value is unset and stands for the Python default of the field.
+type SpecialSet struct {
+	set    bool
+	all    bool
+	tokens []string
+}
+
+// AllowedSpecialAll allows every special token, allowed_special="all".
+var AllowedSpecialAll = SpecialSet{set: true, all: true}
+
+// DisallowedSpecialAll disallows every special token that isn't allowed,
+// disallowed_special="all". It is the default of
+// EncodeOptions.DisallowedSpecial.
+var DisallowedSpecialAll = SpecialSet{set: true, all: true}
+
+// SpecialSetOf returns the set of the named tokens. Without names it is
+// the empty set, so EncodeOptions{DisallowedSpecial: SpecialSetOf()}
+// encodes special tokens as text like disallowed_special=().
+func SpecialSetOf(names ...string) SpecialSet {
+	return SpecialSet{set: true, tokens: append([]string{}, names...)}
+}
+
+// arg returns s as an argument of EncodeWithError, or unset if s is
+// unset.
+func (s SpecialSet) arg(unset []string) []string {
+	switch {
+	case !s.set:
+		return unset
+	case s.all:
+		return []string{"all"}
+	}
+	return s.tokens
+}
+
+// DisallowedAction is what EncodeWithOptions does when the text contains a
+// disallowed special token.
+type DisallowedAction int
+
+const (
+	// DisallowedError fails, as the Python library raises ValueError.
+	DisallowedError DisallowedAction = iota
+	// DisallowedAsText encodes disallowed special tokens as ordinary text.
+	DisallowedAsText
+	// DisallowedEncode encodes disallowed special tokens as the special
+	// tokens they are.
+	DisallowedEncode
+)
+
+func (a DisallowedAction) String() string {
+	switch a {
+	case DisallowedError:
+		return "error"
+	case DisallowedAsText:
+		return "text"
+	case DisallowedEncode:
+		return "encode"
+	}
+	return fmt.Sprintf("DisallowedAction(%d)", int(a))
+}
+
+// EncodeOptions are the special token arguments of EncodeWithOptions. The
+// zero value has the defaults of the Python library: no special token is
+// allowed and one found in the text is an error.
+type EncodeOptions struct {
+	// AllowedSpecial are encoded as special tokens, none if unset.
+	AllowedSpecial SpecialSet
+	// DisallowedSpecial are looked for in the text and handled as
+	// OnDisallowed says, DisallowedSpecialAll if unset. Allowed tokens are
+	// never disallowed.
+	DisallowedSpecial SpecialSet
+	OnDisallowed      DisallowedAction
+}
+
+// EncodeWithOptions encodes text with the special token semantics of the
+// Python library's encode, which the slice arguments of EncodeWithError
+// can only approximate: there, nil stands for the defaults of
+// WithDefaultAllowedSpecial and nothing is disallowed unless asked for.
+// The defaults of t don't apply here.
+func (t *Tiktoken) EncodeWithOptions(text string, opts EncodeOptions) ([]int, error) {
+	allowed, disallowed, err := t.specialArgs(opts)
+	if err != nil {
+		return nil, err
+	}
+	return t.EncodeWithError(text, allowed, disallowed)
+}
+
+// specialArgs returns opts as the arguments of EncodeWithError.
+func (t *Tiktoken) specialArgs(opts EncodeOptions) (allowed, disallowed []string, err error) {
+	allowed = opts.AllowedSpecial.arg([]string{})
+	disallowed = opts.DisallowedSpecial.arg([]string{"all"})
+	switch opts.OnDisallowed {
+	case DisallowedError:
+	case DisallowedAsText:
+		disallowed = []string{}
+	case DisallowedEncode:
+		allowed = t.allowedAndDisallowed(allowed, disallowed)
+		disallowed = []string{}
+	default:
+		return nil, nil, fmt.Errorf("unknown %v", opts.OnDisallowed)
+	}
+	return allowed, disallowed, nil
+}
+
+// allowedAndDisallowed returns the special tokens named by either argument
+// as an allowedSpecial argument. Disallowed strings that aren't special
+// tokens stay text.
+func (t *Tiktoken) allowedAndDisallowed(allowed, disallowed []string) []string {
+	allowedSet := t.allowedSpecialSet(allowed)
+	names := make([]string, 0, len(allowedSet))
+	for token := range allowedSet {
+		names = append(names, token)
+	}
+	for token := range t.disallowedSpecialSet(disallowed, allowedSet) {
+		if _, ok := t.specialTokensSet[token]; ok {
+			names = append(names, token)
+		}
+	}
+	return names
+}
@@ -0,0 +1,45 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeWithOptions(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	text := "hello<|endoftext|><|im_start|>"
+	asText := enc.EncodeOrdinary(text)
+
+	_, err = enc.EncodeWithOptions(text, EncodeOptions{})
+	ass.EqualError(err, "text contains disallowed special token <|endoftext|>", "special tokens are disallowed by default")
+	tokens, err := enc.EncodeWithOptions("hello world", EncodeOptions{})
+	ass.Nil(err)
+	ass.Equal([]int{14990, 1879}, tokens)
+
+	tokens, err = enc.EncodeWithOptions(text, EncodeOptions{AllowedSpecial: AllowedSpecialAll})
+	ass.Nil(err)
+	ass.Equal([]int{14990, 151643, 151644}, tokens)
+
+	_, err = enc.EncodeWithOptions(text, EncodeOptions{AllowedSpecial: SpecialSetOf(ENDOFTEXT)})
+	ass.EqualError(err, "text contains disallowed special token <|im_start|>")
+	tokens, err = enc.EncodeWithOptions(text, EncodeOptions{AllowedSpecial: SpecialSetOf(ENDOFTEXT), DisallowedSpecial: SpecialSetOf()})
+	ass.Nil(err)
+	ass.Equal(append([]int{14990, 151643}, enc.EncodeOrdinary(IM_START)...), tokens)
+
+	tokens, err = enc.EncodeWithOptions(text, EncodeOptions{OnDisallowed: DisallowedAsText})
+	ass.Nil(err)
+	ass.Equal(asText, tokens)
+	tokens, err = enc.EncodeWithOptions(text, EncodeOptions{DisallowedSpecial: SpecialSetOf(IM_START), OnDisallowed: DisallowedEncode})
+	ass.Nil(err)
+	ass.Equal(append(enc.EncodeOrdinary("hello"+ENDOFTEXT), 151644), tokens, "only the disallowed tokens are encoded as special")
+
+	strict := enc.WithDefaultAllowedSpecial("all")
+	_, err = strict.EncodeWithOptions(text, EncodeOptions{})
+	ass.Error(err, "the defaults of the instance don't apply")
+	_, err = enc.EncodeWithOptions(text, EncodeOptions{OnDisallowed: DisallowedAction(9)})
+	ass.EqualError(err, "unknown DisallowedAction(9)")
+	ass.Equal("encode", DisallowedEncode.String())
+}
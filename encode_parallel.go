@@ -0,0 +1,289 @@
+package tiktoken
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// parallelMinSize is the length below which EncodeParallel encodes text on
+// the calling goroutine, and parallelMinRegion the least length of text a
+// goroutine is handed. Tests lower them.
+var (
+	parallelMinSize   = 1 << 20
+	parallelMinRegion = 256 << 10
+)
+
+// parallelOverlap is how far past the end of its region a goroutine keeps
+// splitting text, so that its pieces meet the pieces of the next region.
+const parallelOverlap = 16 << 10
+
+// EncodeParallel encodes text like EncodeWithError with nil special token
+// arguments, splitting it into regions that up to workers goroutines split
+// into pieces and merge at the same time. Zero or a negative workers uses
+// GOMAXPROCS. It is meant for single large documents, e.g. transcripts of
+// many megabytes; texts of less than 1MB are encoded on the calling
+// goroutine, and EncodeBatch is the better fit for many short texts.
+//
+// Each goroutine keeps splitting a little past the end of its region, and
+// the results are stitched at the first piece both it and the next
+// goroutine agree on, so the tokens are the same as those of
+// EncodeWithError. Where they don't agree within 16KB, e.g. in a run of
+// letters longer than that, the text between two special tokens is
+// encoded again on one goroutine. Encodings whose pattern looks behind,
+// e.g. with \b or ^, are always encoded on one goroutine.
+func (t *Tiktoken) EncodeParallel(text string, workers int) ([]int, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	start := metricsStart()
+	size := len(text)
+	text = t.prepareText(text)
+	allowedSpecialSet, err := t.checkSpecial(text, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var tokens []int
+	if workers == 1 || len(text) < parallelMinSize || !splitsAnywhere(t.bpe.tlRegex.String()) {
+		tokens, _ = t.bpe.encodeNativeScratch([]int{}, text, allowedSpecialSet, &mergeScratch{})
+	} else {
+		tokens = t.bpe.encodeParallel(text, allowedSpecialSet, workers)
+	}
+	tokens = t.filterTokens(tokens)
+	t.record(start, len(tokens), size)
+	return tokens, nil
+}
+
+// splitsAnywhere reports whether the pieces of a text found from any piece
+// boundary on don't depend on the text before it: pattern has no
+// lookbehind, word boundary or start anchor. A ^ right after [ negates a
+// class and is fine.
+func splitsAnywhere(pattern string) bool {
+	for _, s := range []string{`(?<=`, `(?<!`, `\b`, `\B`, `\A`, `\G`} {
+		if strings.Contains(pattern, s) {
+			return false
+		}
+	}
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '^' && (i == 0 || (pattern[i-1] != '[' && pattern[i-1] != '\\')) {
+			return false
+		}
+	}
+	return true
+}
+
+// parallelUnit is a region of text handed to one goroutine: the text
+// between two special tokens, seg to segEnd, or a part lo to hi of it.
+type parallelUnit struct {
+	seg, segEnd int
+	lo, hi      int
+	// special is the allowed special token after segEnd, if any.
+	special string
+}
+
+func (u parallelUnit) first() bool { return u.lo == u.seg }
+func (u parallelUnit) last() bool  { return u.hi == u.segEnd }
+
+// pieceMark is the start of a piece and the index of its first token.
+type pieceMark struct {
+	start, token int
+}
+
+// parallelPart is what a goroutine encoded of a unit. head marks the pieces
+// starting in the first parallelOverlap bytes of a unit that isn't the
+// first of its text, and tail the pieces starting after the end of one
+// that isn't the last.
+type parallelPart struct {
+	tokens     []int
+	head, tail []pieceMark
+}
+
+// encodeParallel is encodeNativeScratch spreading the units of text over
+// workers goroutines.
+func (bp *CoreBPE) encodeParallel(text string, allowedSpecial map[string]any, workers int) []int {
+	units := bp.parallelUnits(text, allowedSpecial, workers)
+	parts := make([]parallelPart, len(units))
+	if workers > len(units) {
+		workers = len(units)
+	}
+	var (
+		next int64 = -1
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var scratch mergeScratch
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(units) {
+					return
+				}
+				parts[i] = bp.encodeUnit(text, units[i], &scratch)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, p := range parts {
+		total += len(p.tokens)
+	}
+	ret := make([]int, 0, total+len(units))
+	var scratch *mergeScratch
+	from, segStart := 0, 0
+	for i := 0; i < len(units); i++ {
+		u := units[i]
+		if u.first() {
+			segStart = len(ret)
+		}
+		if !u.last() {
+			to, nextFrom, ok := stitchParts(parts[i].tail, parts[i+1].head)
+			if ok {
+				ret = append(ret, parts[i].tokens[from:to]...)
+				from = nextFrom
+				continue
+			}
+			// the pieces never met, encode the whole text between the
+			// special tokens again
+			if scratch == nil {
+				scratch = &mergeScratch{}
+			}
+			ret = ret[:segStart]
+			bp.walkPieces(text[u.seg:u.segEnd], func(piece string, _, _ int) bool {
+				ret = bp.appendPieceScratch(ret, piece, scratch)
+				return true
+			})
+			for !units[i].last() {
+				i++
+			}
+			u = units[i]
+		} else {
+			ret = append(ret, parts[i].tokens[from:]...)
+		}
+		from = 0
+		if u.special != "" {
+			ret = append(ret, bp.specialTokensEncoder[u.special])
+		}
+	}
+	return ret
+}
+
+// parallelUnits cuts text at the allowed special tokens, and the text
+// between them into up to workers regions of at least parallelMinRegion
+// bytes. Regions end after a newline where there is one close by.
+func (bp *CoreBPE) parallelUnits(text string, allowedSpecial map[string]any, workers int) []parallelUnit {
+	isAllowed := func(token string) bool {
+		_, ok := allowedSpecial[token]
+		return ok
+	}
+	var units []parallelUnit
+	start := 0
+	for {
+		nextStart, nextEnd := -1, -1
+		if len(allowedSpecial) > 0 {
+			nextStart, nextEnd = bp.specialMatcher.find(text[start:], isAllowed)
+		}
+		end, special := len(text), ""
+		if nextStart >= 0 {
+			end, special = start+nextStart, text[start+nextStart:start+nextEnd]
+		}
+
+		n := (end - start) / parallelMinRegion
+		if n > workers {
+			n = workers
+		}
+		lo := start
+		for k := 1; k < n; k++ {
+			cut := start + (end-start)*k/n
+			near := cut + parallelOverlap/4
+			if near > end {
+				near = end
+			}
+			if i := strings.IndexByte(text[cut:near], '\n'); i >= 0 {
+				cut += i + 1
+			}
+			for cut < end && !utf8.RuneStart(text[cut]) {
+				cut++
+			}
+			if cut <= lo || cut >= end {
+				continue
+			}
+			units = append(units, parallelUnit{seg: start, segEnd: end, lo: lo, hi: cut})
+			lo = cut
+		}
+		units = append(units, parallelUnit{seg: start, segEnd: end, lo: lo, hi: end, special: special})
+
+		if nextStart < 0 {
+			return units
+		}
+		start += nextEnd
+	}
+}
+
+// encodeUnit splits and merges the region of u. A unit that isn't the last
+// of its text goes on for parallelOverlap bytes past its end, but like
+// streamEncoder stops at the first piece that could end differently with
+// more text.
+func (bp *CoreBPE) encodeUnit(text string, u parallelUnit, scratch *mergeScratch) parallelPart {
+	var part parallelPart
+	end := u.segEnd
+	if !u.last() && u.hi+parallelOverlap < end {
+		end = u.hi + parallelOverlap
+		for end < u.segEnd && !utf8.RuneStart(text[end]) {
+			end++
+		}
+	}
+	final := end == u.segEnd
+	limit := end - u.lo - streamMargin*utf8.UTFMax
+
+	add := func(piece string, start int) {
+		mark := pieceMark{start: u.lo + start, token: len(part.tokens)}
+		if !u.first() && mark.start < u.lo+parallelOverlap {
+			part.head = append(part.head, mark)
+		}
+		if !u.last() && mark.start >= u.hi {
+			part.tail = append(part.tail, mark)
+		}
+		part.tokens = bp.appendPieceScratch(part.tokens, piece, scratch)
+	}
+	held, heldStart, heldEnd, holding := "", 0, 0, false
+	bp.walkPieces(text[u.lo:end], func(piece string, start, end int) bool {
+		if holding {
+			if !final && heldEnd > limit {
+				holding = false
+				return false
+			}
+			add(held, heldStart)
+		}
+		held, heldStart, heldEnd, holding = piece, start, end, true
+		return true
+	})
+	if holding && final {
+		add(held, heldStart)
+	}
+	return part
+}
+
+// stitchParts returns the first piece start both in tail, the pieces of a
+// unit past its end, and in head, the first pieces of the next unit, as
+// the token index in each. From there on both split the text the same.
+func stitchParts(tail, head []pieceMark) (to, from int, ok bool) {
+	for i, j := 0, 0; i < len(tail) && j < len(head); {
+		switch {
+		case tail[i].start == head[j].start:
+			return tail[i].token, head[j].token, true
+		case tail[i].start < head[j].start:
+			i++
+		default:
+			j++
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,90 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parallelText is n bytes or so of words, numbers, punctuation and runs of
+// white space in several scripts.
+func parallelText(n int) string {
+	words := []string{"hello", " world", "你好", "，世界！", " Привет", "  ", "\n", "\n\n", "\t", " 12345", "don't", " we'll", "お早う", " 😀", "func main() {", "}\n", "   x", "\r\n"}
+	rng := rand.New(rand.NewSource(1))
+	var b strings.Builder
+	for b.Len() < n {
+		b.WriteString(words[rng.Intn(len(words))])
+	}
+	return b.String()
+}
+
+func lowerParallelLimits(t *testing.T) {
+	size, region := parallelMinSize, parallelMinRegion
+	parallelMinSize, parallelMinRegion = 1<<10, 1<<10
+	t.Cleanup(func() { parallelMinSize, parallelMinRegion = size, region })
+}
+
+func TestEncodeParallel(t *testing.T) {
+	ass := assert.New(t)
+	lowerParallelLimits(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := parallelText(200 << 10)
+	// white space and letters far longer than parallelOverlap
+	long := text[:50<<10] + strings.Repeat("a", 40<<10) + text[50<<10:100<<10] + strings.Repeat(" ", 40<<10) + text[100<<10:]
+	for _, text := range []string{"", "hello world", text, long} {
+		want, err := enc.EncodeWithError(text, nil, nil)
+		ass.Nil(err)
+		for _, workers := range []int{0, 1, 2, 7, 64} {
+			got, err := enc.EncodeParallel(text, workers)
+			ass.Nil(err)
+			ass.Equal(want, got, "%d bytes with %d workers", len(text), workers)
+		}
+	}
+
+	withSpecials := strings.Repeat(text[:30<<10]+"<|endoftext|>", 4) + "<|im_start|>"
+	_, err = enc.WithDefaultDisallowedSpecial("all").EncodeParallel(withSpecials, 4)
+	ass.EqualError(err, "text contains disallowed special token <|endoftext|>")
+	allowing := enc.WithDefaultAllowedSpecial("all")
+	want, err := allowing.EncodeWithError(withSpecials, nil, nil)
+	ass.Nil(err)
+	got, err := allowing.EncodeParallel(withSpecials, 4)
+	ass.Nil(err)
+	ass.Equal(want, got)
+}
+
+func TestSplitsAnywhere(t *testing.T) {
+	ass := assert.New(t)
+	for _, pattern := range []string{cl100kPattern, o200kPattern, qwenPattern, p50kPattern, `\^\w+`} {
+		ass.True(splitsAnywhere(pattern), pattern)
+	}
+	for _, pattern := range []string{`\b\w+`, `(?<=a)b|\w`, `^\s+|\S+`, `\w+|(?<!x)\s`} {
+		ass.False(splitsAnywhere(pattern), pattern)
+	}
+}
+
+func BenchmarkEncodeParallel(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	text := parallelText(8 << 20)
+	b.SetBytes(int64(len(text)))
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := enc.EncodeWithError(text, nil, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := enc.EncodeParallel(text, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package tiktoken
+
+import (
+	"io"
+	"time"
+)
+
+// readerChunkSize is the number of bytes EncodeReader reads at a time.
+const readerChunkSize = 64 << 10
+
+// TokenIterator yields tokens one at a time, see EncodeReader. It is used
+// like bufio.Scanner:
+//
+//	it, err := tke.EncodeReader(file, nil, nil)
+//	...
+//	for it.Next() {
+//		use(it.Token())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type TokenIterator interface {
+	// Next advances to the next token and reports whether there is one.
+	// It returns false at the end of the input or on the first error.
+	Next() bool
+	// Token returns the token Next advanced to.
+	Token() int
+	// Err returns the first error, or nil if the input was encoded to its
+	// end.
+	Err() error
+}
+
+// EncodeReader encodes the text read from r as EncodeWithError encodes the
+// whole text, without holding it in memory: it reads r in chunks as the
+// tokens are consumed and buffers little more than the piece of the split
+// pattern being encoded, at most about twice the piece length cap of t, see
+// WithMaxPieceLength. The input options and token filters of t apply.
+//
+// It fails right away if t is closed. A disallowed special token or a read
+// error end the iteration with the error instead, after the tokens of the
+// text before it, since the text isn't looked at before it is encoded.
+// Reading stops there; r isn't closed.
+func (t *Tiktoken) EncodeReader(r io.Reader, allowedSpecial, disallowedSpecial []string) (TokenIterator, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	if allowedSpecial == nil {
+		allowedSpecial = t.opts.allowedSpecial
+	}
+	if disallowedSpecial == nil {
+		disallowedSpecial = t.opts.disallowedSpecial
+	}
+	it := &readerTokens{t: t, r: r, stream: newStreamEncoder(t.bpe)}
+	it.allowed = t.allowedSpecialSet(allowedSpecial)
+	it.disallowed = t.disallowedSpecialSet(disallowedSpecial, it.allowed)
+	for _, set := range []map[string]any{it.allowed, it.disallowed} {
+		for s := range set {
+			if len(s) > it.maxSpecial {
+				it.maxSpecial = len(s)
+			}
+		}
+	}
+	return it, nil
+}
+
+// readerTokens is the TokenIterator of EncodeReader.
+type readerTokens struct {
+	t          *Tiktoken
+	r          io.Reader
+	buf        []byte
+	allowed    map[string]any
+	disallowed map[string]any
+	// maxSpecial is the length of the longest allowed or disallowed
+	// special token; the last maxSpecial-1 bytes of pending may be the
+	// start of one.
+	maxSpecial int
+	// pending is prepared text not yet searched for special tokens, stream
+	// encodes the text between them.
+	pending []byte
+	stream  *streamEncoder
+	queue   []int
+	pos     int
+	token   int
+	err     error
+	done    bool
+	// tokens and bytes are counted for the metrics.
+	tokens, bytes int
+}
+
+func (it *readerTokens) Next() bool {
+	for it.pos >= len(it.queue) {
+		if it.done {
+			return false
+		}
+		it.queue, it.pos = it.queue[:0], 0
+		it.fill()
+	}
+	it.token = it.queue[it.pos]
+	it.pos++
+	return true
+}
+
+func (it *readerTokens) Token() int {
+	return it.token
+}
+
+func (it *readerTokens) Err() error {
+	return it.err
+}
+
+func (it *readerTokens) emit(token int) {
+	if token, ok := it.t.filterToken(token); ok {
+		it.queue = append(it.queue, token)
+		it.tokens++
+	}
+}
+
+// fill reads the next chunk of input and queues the tokens it completes.
+func (it *readerTokens) fill() {
+	if it.buf == nil {
+		// the input options may read ahead, so apply them on first use
+		it.buf = make([]byte, readerChunkSize)
+		it.r = it.t.prepareReader(it.r)
+	}
+	n, err := it.r.Read(it.buf)
+	it.bytes += n
+	it.pending = append(it.pending, it.buf[:n]...)
+	switch {
+	case err == io.EOF:
+		if it.scan(true) {
+			it.stream.flush(it.emit)
+			it.done = true
+			it.t.record(time.Time{}, it.tokens, it.bytes)
+		}
+	case err != nil:
+		it.fail(err)
+	case n > 0:
+		it.scan(false)
+	}
+}
+
+func (it *readerTokens) fail(err error) {
+	it.err, it.done = err, true
+}
+
+// scan encodes the pending text up to where a special token may start
+// that isn't complete yet, or all of it if final. It reports false if it
+// found a disallowed special token.
+func (it *readerTokens) scan(final bool) bool {
+	if len(it.disallowed) > 0 {
+		// every occurrence is complete in pending at some point, since
+		// the possible start of one is kept for the next scan
+		if m := it.t.findDisallowed(string(it.pending), it.disallowed); m != "" {
+			it.fail(&DisallowedSpecialError{Token: m})
+			return false
+		}
+	}
+	text := string(it.pending)
+	at := 0
+	for {
+		start, end := -1, -1
+		if len(it.allowed) > 0 {
+			start, end = it.t.bpe.specialMatcher.find(text[at:], func(token string) bool {
+				_, ok := it.allowed[token]
+				return ok
+			})
+			start, end = start+at, end+at
+		}
+		// a longer token, or one starting before, may still be incomplete
+		safe := len(text)
+		if !final && it.maxSpecial > 0 {
+			safe -= it.maxSpecial - 1
+		}
+		if start >= at && start < safe {
+			it.stream.write(it.pending[at:start], it.emit)
+			it.stream.flush(it.emit)
+			it.emit(it.t.bpe.specialTokensEncoder[text[start:end]])
+			at = end
+			continue
+		}
+		if safe > at {
+			it.stream.write(it.pending[at:safe], it.emit)
+			at = safe
+		}
+		it.pending = append(it.pending[:0], it.pending[at:]...)
+		return true
+	}
+}
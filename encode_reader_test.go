@@ -0,0 +1,91 @@
+package tiktoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
+)
+
+func readAllTokens(it TokenIterator) ([]int, error) {
+	tokens := []int{}
+	for it.Next() {
+		tokens = append(tokens, it.Token())
+	}
+	return tokens, it.Err()
+}
+
+func TestEncodeReader(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	long := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 3000)
+	texts := []string{
+		"",
+		"hello world",
+		"hello <|endoftext|> world<|im_end|><|endoftext|>",
+		"<|endoftext|>",
+		"don't   \n\n  stop 12345 龘 👍🏽",
+		long + "<|im_start|>" + long,
+		"<|endof<|endoftext|>text|>",
+	}
+	for _, text := range texts {
+		for _, allowed := range [][]string{nil, {"all"}, {"<|endoftext|>"}} {
+			want, err := enc.EncodeWithError(text, allowed, nil)
+			ass.Nil(err)
+			it, err := enc.EncodeReader(strings.NewReader(text), allowed, nil)
+			ass.Nil(err)
+			got, err := readAllTokens(it)
+			ass.Nil(err)
+			ass.Equal(want, got, "%.40q %v", text, allowed)
+
+			if len(text) > 1000 {
+				continue
+			}
+			it, err = enc.EncodeReader(iotest.OneByteReader(strings.NewReader(text)), allowed, nil)
+			ass.Nil(err)
+			got, err = readAllTokens(it)
+			ass.Nil(err)
+			ass.Equal(want, got, "%.40q %v one byte at a time", text, allowed)
+		}
+	}
+}
+
+func TestEncodeReaderOptions(t *testing.T) {
+	ass := assert.New(t)
+	enc := GetTestEncoding().WithOptions(WithStripBOM(true), WithNormalization(norm.NFC))
+	text := "\ufeffcafe\u0301 and the end" + testEndOfText + " then"
+	it, err := enc.EncodeReader(iotest.HalfReader(strings.NewReader(text)), []string{"all"}, nil)
+	ass.Nil(err)
+	got, err := readAllTokens(it)
+	ass.Nil(err)
+	ass.Equal(enc.Encode(text, []string{"all"}, nil), got)
+}
+
+func TestEncodeReaderErrors(t *testing.T) {
+	ass := assert.New(t)
+	enc := GetTestEncoding()
+
+	text := strings.Repeat("hello world ", 20000) + testEndOfText + " more"
+	it, err := enc.EncodeReader(strings.NewReader(text), []string{}, []string{"all"})
+	ass.Nil(err)
+	got, err := readAllTokens(it)
+	ass.ErrorContains(err, "disallowed special token "+testEndOfText)
+	ass.Less(len(got), len(enc.EncodeOrdinary(text)))
+	ass.False(it.Next(), "the iteration stays ended")
+
+	boom := errors.New("boom")
+	it, err = enc.EncodeReader(iotest.DataErrReader(iotest.TimeoutReader(strings.NewReader("hello world"))), nil, nil)
+	ass.Nil(err)
+	_, err = readAllTokens(it)
+	ass.ErrorIs(err, iotest.ErrTimeout)
+	it, err = enc.EncodeReader(iotest.ErrReader(boom), nil, nil)
+	ass.Nil(err)
+	_, err = readAllTokens(it)
+	ass.ErrorIs(err, boom)
+
+}
@@ -0,0 +1,59 @@
+package tiktoken
+
+import "sync"
+
+// maxPooledTokens is the capacity above which EncoderPool.Put drops a slice
+// instead of keeping it, so one huge document doesn't pin its buffer.
+const maxPooledTokens = 1 << 20
+
+// EncoderPool encodes with a Tiktoken reusing the merge buffers and the
+// token slices across calls, for servers encoding many texts at once. It is
+// safe for concurrent use. Once the pool is warm, ASCII text encodes
+// without allocating; other text still allocates while it is split unless
+// the pool was made with WithScannerSplit(true).
+type EncoderPool struct {
+	t *Tiktoken
+	// slices hold token slices handed back with Put, holders the
+	// emptied pointers, so that neither Encode nor Put allocates.
+	slices  sync.Pool
+	holders sync.Pool
+}
+
+// NewEncoderPool returns an EncoderPool encoding with t and opts applied to
+// a copy of it, as WithOptions does.
+func (t *Tiktoken) NewEncoderPool(opts ...EncodeOption) *EncoderPool {
+	return &EncoderPool{t: t.WithOptions(opts...)}
+}
+
+// Encode is EncodeWithError with the buffers of the pool. Hand the tokens
+// back with Put once they aren't used anymore; tokens that aren't handed
+// back are simply collected.
+func (p *EncoderPool) Encode(text string, allowedSpecial []string, disallowedSpecial []string) ([]int, error) {
+	scratch := mergeScratches.Get().(*mergeScratch)
+	defer mergeScratches.Put(scratch)
+	dst := []int{}
+	if h, ok := p.slices.Get().(*[]int); ok {
+		dst, *h = *h, nil
+		p.holders.Put(h)
+	}
+	tokens, err := p.t.encodeScratch(dst, text, allowedSpecial, disallowedSpecial, scratch)
+	if err != nil {
+		p.Put(dst)
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Put hands tokens returned by Encode back to the pool for reuse. tokens
+// must not be used afterwards.
+func (p *EncoderPool) Put(tokens []int) {
+	if tokens == nil || cap(tokens) > maxPooledTokens {
+		return
+	}
+	h, ok := p.holders.Get().(*[]int)
+	if !ok {
+		h = new([]int)
+	}
+	*h = tokens[:0]
+	p.slices.Put(h)
+}
@@ -0,0 +1,95 @@
+package tiktoken
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoderPool(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	pool := enc.NewEncoderPool()
+	texts := []string{"", "hello world", "hello <|endoftext|> 你好，世界！", parallelText(8 << 10)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				for _, text := range texts {
+					want := enc.Encode(text, []string{"all"}, nil)
+					tokens, err := pool.Encode(text, []string{"all"}, nil)
+					ass.Nil(err)
+					ass.Equal(want, tokens)
+					pool.Put(tokens)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err = pool.Encode("<|endoftext|>", nil, []string{"all"})
+	ass.EqualError(err, "text contains disallowed special token <|endoftext|>")
+	pool.Put(nil)
+	pool.Put(make([]int, 0, maxPooledTokens+1))
+
+	scanned := enc.NewEncoderPool(WithScannerSplit(true))
+	ass.NotNil(scanned.t.bpe.unicodeSplitter)
+	tokens, err := scanned.Encode("你好，世界！", nil, nil)
+	ass.Nil(err)
+	ass.Equal(enc.Encode("你好，世界！", nil, nil), tokens)
+
+	ascii := "The quick brown fox jumps over the lazy dog, don't you think? 12345\n"
+	tokens, _ = pool.Encode(ascii, nil, nil)
+	pool.Put(tokens)
+	allocs := testing.AllocsPerRun(100, func() {
+		tokens, _ := pool.Encode(ascii, nil, nil)
+		pool.Put(tokens)
+	})
+	if !raceEnabled {
+		ass.Zero(allocs)
+	}
+}
+
+func BenchmarkEncoderPool(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ascii := strings.Repeat("The quick brown fox jumps over the lazy dog, don't you think? 12345\n", 64)
+	for _, text := range []struct{ name, text string }{{"ascii", ascii}, {"mixed", parallelText(4 << 10)}} {
+		text := text
+		b.Run(text.name+"/EncodeWithError", func(b *testing.B) {
+			b.SetBytes(int64(len(text.text)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := enc.EncodeWithError(text.text, nil, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		for _, scanner := range []bool{false, true} {
+			pool := enc.NewEncoderPool(WithScannerSplit(scanner))
+			name := text.name + "/pool"
+			if scanner {
+				name += "+scanner"
+			}
+			b.Run(name, func(b *testing.B) {
+				b.SetBytes(int64(len(text.text)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					tokens, err := pool.Encode(text.text, nil, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					pool.Put(tokens)
+				}
+			})
+		}
+	}
+}
@@ -3,7 +3,11 @@ package tiktoken
 import (
 	"embed"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"unicode"
 )
 
 const ENDOFTEXT string = "<|endoftext|>"
@@ -11,19 +15,40 @@ const FIM_PREFIX string = "<|fim_prefix|>"
 const FIM_MIDDLE string = "<|fim_middle|>"
 const FIM_SUFFIX string = "<|fim_suffix|>"
 const ENDOFPROMPT string = "<|endofprompt|>"
+const IM_START string = "<|im_start|>"
+const IM_END string = "<|im_end|>"
 
 const (
-	MODEL_QWEN_BASE   string = "qwen_base"
-	MODEL_CL100K_BASE string = "cl100k_base"
-	MODEL_P50K_BASE   string = "p50k_base"
-	MODEL_P50K_EDIT   string = "p50k_edit"
-	MODEL_R50K_BASE   string = "r50k_base"
+	MODEL_QWEN_BASE     string = "qwen_base"
+	MODEL_CL100K_BASE   string = "cl100k_base"
+	MODEL_O200K_BASE    string = "o200k_base"
+	MODEL_O200K_HARMONY string = "o200k_harmony"
+	MODEL_P50K_BASE     string = "p50k_base"
+	MODEL_P50K_EDIT     string = "p50k_edit"
+	MODEL_R50K_BASE     string = "r50k_base"
+	MODEL_LLAMA3        string = "llama3"
 )
 
+// Split patterns shared by several encodings. Llama 3 uses the cl100k one.
+const (
+	o200kPattern  = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	qwenPattern   = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	p50kPattern   = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+)
+
+// MODEL_TO_ENCODING maps model names to encodings. Use RegisterModel to add
+// to it once lookups may be running.
 var MODEL_TO_ENCODING = map[string]string{
 	// qwen
 	"qwen": MODEL_QWEN_BASE,
 	// chat
+	"gpt-4o":        MODEL_O200K_BASE,
+	"gpt-4.1":       MODEL_O200K_BASE,
+	"o1":            MODEL_O200K_BASE,
+	"o3":            MODEL_O200K_BASE,
+	"o4-mini":       MODEL_O200K_BASE,
+	"gpt-5":         MODEL_O200K_BASE,
 	"gpt-4":         MODEL_CL100K_BASE,
 	"gpt-3.5-turbo": MODEL_CL100K_BASE,
 	// text
@@ -61,13 +86,197 @@ var MODEL_TO_ENCODING = map[string]string{
 	"code-search-babbage-code-001": MODEL_R50K_BASE,
 	"code-search-ada-code-001":     MODEL_R50K_BASE,
 	// open source
-	"gpt2": "gpt2",
+	"gpt2":         "gpt2",
+	"gpt-oss-20b":  MODEL_O200K_HARMONY,
+	"gpt-oss-120b": MODEL_O200K_HARMONY,
+	"llama3":       MODEL_LLAMA3,
+	"llama3.1":     MODEL_LLAMA3,
+	"llama3.2":     MODEL_LLAMA3,
 }
 
+// EncodingSource returns the URI of the rank file used by a built-in
+// encoding, or false if the encoding isn't downloaded from anywhere.
+func EncodingSource(encodingName string) (string, bool) {
+	uri, ok := encodingSources[encodingName]
+	return uri, ok
+}
+
+// MODEL_PREFIX_TO_ENCODING maps model name prefixes to encodings. Use
+// RegisterModelPrefix to add to it once lookups may be running.
 var MODEL_PREFIX_TO_ENCODING = map[string]string{
 	// chat
+	"gpt-4o-":        MODEL_O200K_BASE, // e.g., gpt-4o-2024-05-13, gpt-4o-mini
+	"chatgpt-4o-":    MODEL_O200K_BASE,
+	"gpt-4.1-":       MODEL_O200K_BASE, // e.g., gpt-4.1-mini
+	"o1-":            MODEL_O200K_BASE, // e.g., o1-mini
+	"o3-":            MODEL_O200K_BASE,
+	"o4-":            MODEL_O200K_BASE,
+	"gpt-5-":         MODEL_O200K_BASE, // e.g., gpt-5-mini
+	"gpt-oss-":       MODEL_O200K_HARMONY,
 	"gpt-4-":         MODEL_CL100K_BASE, // e.g., gpt-4-0314, etc., plus gpt-4-32k
 	"gpt-3.5-turbo-": MODEL_CL100K_BASE, // e.g, gpt-3.5-turbo-0301, -0401, etc.
+	// qwen
+	"qwen-":    MODEL_QWEN_BASE, // e.g., qwen-7b-chat
+	"qwen1.5-": MODEL_QWEN_BASE,
+	"qwen2-":   MODEL_QWEN_BASE, // e.g., qwen2-7b-instruct
+	"qwen2.5-": MODEL_QWEN_BASE,
+	// llama
+	"llama3-":                  MODEL_LLAMA3, // e.g., llama3-8b-instruct
+	"llama3.1-":                MODEL_LLAMA3,
+	"llama3.2-":                MODEL_LLAMA3,
+	"llama-3-":                 MODEL_LLAMA3,
+	"llama-3.1-":               MODEL_LLAMA3,
+	"llama-3.2-":               MODEL_LLAMA3,
+	"meta-llama-3-":            MODEL_LLAMA3,
+	"meta-llama-3.1-":          MODEL_LLAMA3,
+	"meta-llama/Meta-Llama-3-": MODEL_LLAMA3, // Hugging Face ids
+	"meta-llama/Llama-3.1-":    MODEL_LLAMA3,
+	"meta-llama/Llama-3.2-":    MODEL_LLAMA3,
+}
+
+var encodingConstructors = map[string]func() (*Encoding, error){}
+var rl = &sync.RWMutex{}
+
+// ml guards MODEL_TO_ENCODING and MODEL_PREFIX_TO_ENCODING.
+var ml = &sync.RWMutex{}
+
+// RegisterEncoding makes GetEncoding build the named encoding with ctor.
+// Built-in encodings can't be replaced, an encoding that is already loaded
+// keeps being served until RefreshEncoding is called for it.
+//
+// Like RegisterModel and RegisterModelPrefix it is safe to call at any
+// time, concurrently with lookups; it takes effect for lookups that start
+// after it returns.
+func RegisterEncoding(encodingName string, ctor func() (*Encoding, error)) {
+	rl.Lock()
+	defer rl.Unlock()
+	encodingConstructors[encodingName] = ctor
+	delete(registeredSpecs, encodingName)
+}
+
+// ErrModelConflict is returned when a model name or prefix is registered
+// that differs from a registered one only by case, which lookups couldn't
+// tell apart.
+var ErrModelConflict = errors.New("tiktoken: model name differs from a registered one only by case")
+
+// RegisterModel makes EncodingForModel resolve modelName to encodingName.
+// Lookups ignore case and surrounding whitespace, so modelName is trimmed
+// and must not differ from a registered name only by case; registering the
+// same name again replaces its encoding. Instances already returned for
+// modelName are not affected.
+func RegisterModel(modelName, encodingName string) error {
+	ml.Lock()
+	defer ml.Unlock()
+	return registerModelName(MODEL_TO_ENCODING, strings.TrimSpace(modelName), encodingName)
+}
+
+// SetModelEncoding is RegisterModel. It also overrides the encoding of a
+// built-in model name, so a model released with another encoding can be
+// fixed without waiting for a release.
+func SetModelEncoding(modelName, encodingName string) error {
+	return RegisterModel(modelName, encodingName)
+}
+
+// RegisterModelPrefix makes EncodingForModel resolve every model name
+// starting with prefix to encodingName, with the same rules as
+// RegisterModel.
+func RegisterModelPrefix(prefix, encodingName string) error {
+	ml.Lock()
+	defer ml.Unlock()
+	return registerModelName(MODEL_PREFIX_TO_ENCODING, strings.TrimLeftFunc(prefix, unicode.IsSpace), encodingName)
+}
+
+func registerModelName(names map[string]string, name, encodingName string) error {
+	for registered := range names {
+		if registered != name && strings.EqualFold(registered, name) {
+			return fmt.Errorf("%w: %s and %s", ErrModelConflict, name, registered)
+		}
+	}
+	names[name] = encodingName
+	return nil
+}
+
+// RankFileOption configures NewEncodingFromRankFile.
+type RankFileOption func(*rankFileConfig)
+
+type rankFileConfig struct {
+	expectedRanks int
+	hash          string
+}
+
+// WithExpectedRanks makes NewEncodingFromRankFile reject a rank file that
+// doesn't hold exactly n ranks numbered 0 to n-1, see ErrRankCount.
+func WithExpectedRanks(n int) RankFileOption {
+	return func(c *rankFileConfig) {
+		c.expectedRanks = n
+	}
+}
+
+// WithRankFileHash makes NewEncodingFromRankFile register hash, the hex
+// sha256 of the rank file, with RegisterRankFileHash before loading it, so
+// a corrupted download is rejected instead of cached.
+func WithRankFileHash(hash string) RankFileOption {
+	return func(c *rankFileConfig) {
+		c.hash = hash
+	}
+}
+
+// SpecialTokenRange generates count special tokens with consecutive ids
+// starting at start. Their names are template formatted with 0..count-1,
+// e.g. SpecialTokenRange("<|extra_%d|>", 151646, 205).
+func SpecialTokenRange(template string, start, count int) map[string]int {
+	tokens := make(map[string]int, count)
+	for i := 0; i < count; i++ {
+		tokens[fmt.Sprintf(template, i)] = start + i
+	}
+	return tokens
+}
+
+// NewEncodingFromRankFile loads the mergeable ranks of a custom encoding
+// with the current BpeLoader. Together with RegisterEncoding it lets
+// models that ship their vocabulary in tiktoken format resolve by name.
+// It fails if a special token shares its id with a mergeable rank.
+func NewEncodingFromRankFile(encodingName, rankFile, patStr string, specialTokens map[string]int, opts ...RankFileOption) (*Encoding, error) {
+	return newEncodingFromRankFile(currentBpeLoader(), encodingName, rankFile, patStr, specialTokens, opts...)
+}
+
+func newEncodingFromRankFile(loader BpeLoader, encodingName, rankFile, patStr string, specialTokens map[string]int, opts ...RankFileOption) (*Encoding, error) {
+	var c rankFileConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.hash != "" {
+		if err := RegisterRankFileHash(rankFile, c.hash); err != nil {
+			return nil, err
+		}
+	}
+	tables, err := loadRankTables(loader, rankFile, func() (map[string]int, error) {
+		ranks, err := loader.LoadTiktokenBpe(rankFile)
+		if err != nil {
+			return nil, err
+		}
+		return checkRankCount(loader, rankFile, ranks, c.expectedRanks)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newEncoding(encodingName, rankFile, patStr, tables, specialTokens)
+}
+
+func newEncoding(encodingName, source, patStr string, tables *rankTables, specialTokens map[string]int) (*Encoding, error) {
+	for token, id := range specialTokens {
+		if tables.hasRank(id) {
+			return nil, fmt.Errorf("special token %s has id %d, which is also a mergeable rank", token, id)
+		}
+	}
+	return &Encoding{
+		Name:           encodingName,
+		SourceURI:      source,
+		PatStr:         patStr,
+		MergeableRanks: tables.encoder,
+		SpecialTokens:  specialTokens,
+		tables:         tables,
+	}, nil
 }
 
 var encodingMap map[string]*Encoding
@@ -79,137 +288,146 @@ func init() {
 }
 
 type Encoding struct {
-	Name           string
-	PatStr         string
+	Name   string
+	PatStr string
+	// MergeableRanks maps the tokens to their ranks. Encodings loaded from
+	// the same rank file share the map with each other and with their
+	// encoders, so it must not be modified once the encoding is built;
+	// read it through Tiktoken.Ranks, or copy it with Tiktoken.RanksCopy.
 	MergeableRanks map[string]int
 	SpecialTokens  map[string]int
 	ExplicitNVocab int
+	// SourceURI is where MergeableRanks were loaded from, if known.
+	SourceURI string
+	// tables are derived from MergeableRanks and shared by the encodings
+	// built on the same rank file; nil for encodings built by hand.
+	tables *rankTables
 }
 
-func getEncoding(encodingName string) (*Encoding, error) {
-	l.Lock()
-	defer l.Unlock()
-	if encoding, ok := encodingMap[encodingName]; ok {
-		return encoding, nil
-	}
-	initEncoding, err := initEncoding(encodingName)
-	if err != nil {
-		return nil, err
-	}
-	encodingMap[encodingName] = initEncoding
-	return encodingMap[encodingName], nil
+func initEncoding(encodingName string) (*Encoding, error) {
+	return initEncodingWithLoader(encodingName, currentBpeLoader())
 }
 
-func initEncoding(encodingName string) (*Encoding, error) {
-	switch encodingName {
-	case MODEL_QWEN_BASE:
-		return qwen_base()
-	case MODEL_CL100K_BASE:
-		return cl100k_base()
-	case MODEL_P50K_BASE:
-		return p50k_base()
-	case MODEL_R50K_BASE:
-		return r50k_base()
-	case MODEL_P50K_EDIT:
-		return p50k_edit()
-	default:
-		return nil, errors.New("Unknown encoding: " + encodingName)
+// initEncodingWithLoader builds a built-in encoding from rank files loaded
+// with loader. Registered encodings are built by their constructor, which
+// loads its rank file itself.
+func initEncodingWithLoader(encodingName string, loader BpeLoader) (*Encoding, error) {
+	if _, ok := builtinSpecs[encodingName]; ok {
+		return buildBuiltin(loader, encodingName)
 	}
+	rl.RLock()
+	ctor, ok := encodingConstructors[encodingName]
+	rl.RUnlock()
+	if ok {
+		return ctor()
+	}
+	return nil, unknownEncoding(encodingName)
 }
 
 //go:embed tiktoken/qwen.tiktoken
 var tiktokenFS embed.FS
 
-func qwen_base() (*Encoding, error) {
-	ranks, err := bpeLoader.LoadTiktokenBpeFromFS(tiktokenFS, "tiktoken/qwen.tiktoken")
-	if err != nil {
-		return nil, err
-	}
-	special_tokens := map[string]int{
+// qwenSpecialTokens follow the 151643 mergeable ranks.
+func qwenSpecialTokens() map[string]int {
+	special_tokens := SpecialTokenRange("<|extra_%d|>", 151646, 205)
+	special_tokens[ENDOFTEXT] = 151643
+	special_tokens[IM_START] = 151644
+	special_tokens[IM_END] = 151645
+	return special_tokens
+}
+
+func cl100kSpecialTokens() map[string]int {
+	return map[string]int{
 		ENDOFTEXT:   100257,
 		FIM_PREFIX:  100258,
 		FIM_MIDDLE:  100259,
 		FIM_SUFFIX:  100260,
 		ENDOFPROMPT: 100276,
 	}
-	return &Encoding{
-		Name:           MODEL_QWEN_BASE,
-		PatStr:         `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\\r\\n\\p{L}\\p{N}]?\\p{L}+|\\p{N}| ?[^\\s\\p{L}\\p{N}]+[\\r\\n]*|\\s*[\\r\\n]+|\\s+(?!\\S)|\\s+`,
-		MergeableRanks: ranks,
-		SpecialTokens:  special_tokens,
-	}, nil
 }
 
-func cl100k_base() (*Encoding, error) {
-	ranks, err := bpeLoader.LoadTiktokenBpe("https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken")
-	if err != nil {
-		return nil, err
+func o200kSpecialTokens() map[string]int {
+	return map[string]int{
+		ENDOFTEXT:   199999,
+		ENDOFPROMPT: 200018,
 	}
+}
+
+// o200kHarmonyExtraTokens name the ids 199998 and 200000 to 201087 like
+// the reference tiktoken, the unused ones reserved_N. 200018 stays
+// <|endofprompt|> of o200k_base, which the reference also calls
+// <|reserved_200018|>; one id can't decode to two tokens.
+func o200kHarmonyExtraTokens() map[string]int {
 	special_tokens := map[string]int{
-		ENDOFTEXT:   100257,
-		FIM_PREFIX:  100258,
-		FIM_MIDDLE:  100259,
-		FIM_SUFFIX:  100260,
-		ENDOFPROMPT: 100276,
+		"<|startoftext|>": 199998,
+		"<|return|>":      200002,
+		"<|constrain|>":   200003,
+		"<|channel|>":     200005,
+		"<|start|>":       200006,
+		"<|end|>":         200007,
+		"<|message|>":     200008,
+		"<|call|>":        200012,
 	}
-	return &Encoding{
-		Name:           MODEL_CL100K_BASE,
-		PatStr:         `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
-		MergeableRanks: ranks,
-		SpecialTokens:  special_tokens,
-	}, nil
+	named := make(map[int]bool, len(special_tokens))
+	for _, id := range special_tokens {
+		named[id] = true
+	}
+	named[o200kSpecialTokens()[ENDOFPROMPT]] = true
+	for id := 200000; id < 201088; id++ {
+		if !named[id] {
+			special_tokens[fmt.Sprintf("<|reserved_%d|>", id)] = id
+		}
+	}
+	return special_tokens
 }
 
-func p50k_edit() (*Encoding, error) {
-	ranks, err := bpeLoader.LoadTiktokenBpe("https://openaipublic.blob.core.windows.net/encodings/p50k_base.tiktoken")
-	if err != nil {
-		return nil, err
-	}
-	special_tokens := map[string]int{ENDOFTEXT: 50256, FIM_PREFIX: 50281, FIM_MIDDLE: 50282, FIM_SUFFIX: 50283}
-	return &Encoding{
-		Name:           MODEL_P50K_EDIT,
-		PatStr:         `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
-		MergeableRanks: ranks,
-		SpecialTokens:  special_tokens,
-	}, nil
+func p50kEditExtraTokens() map[string]int {
+	return map[string]int{FIM_PREFIX: 50281, FIM_MIDDLE: 50282, FIM_SUFFIX: 50283}
 }
 
-func p50k_base() (*Encoding, error) {
-	ranks, err := bpeLoader.LoadTiktokenBpe("https://openaipublic.blob.core.windows.net/encodings/p50k_base.tiktoken")
-	if err != nil {
-		return nil, err
-	}
-	special_tokens := map[string]int{ENDOFTEXT: 50256}
+// gpt2SpecialTokens are those of r50k_base and p50k_base.
+func gpt2SpecialTokens() map[string]int {
+	return map[string]int{ENDOFTEXT: 50256}
+}
 
-	// ExplicitNVocab := 50281
-	// max_tokens := int(math.Max(float64(len(special_tokens)), float64(len(ranks))))
+var llama3TokenizerModel = os.Getenv("LLAMA3_TOKENIZER_MODEL")
 
-	// if len(special_tokens)+len(ranks) != max_tokens {
-	// 	return nil, errors.New("special_tokens and ranks must be disjoint")
-	// }
+// SetLlama3TokenizerModel sets the path or URI of the tokenizer.model file
+// distributed with the Llama 3 weights, which is a rank file in tiktoken
+// format. It defaults to the LLAMA3_TOKENIZER_MODEL environment variable.
+// The file isn't redistributable, so there is no download location.
+func SetLlama3TokenizerModel(path string) {
+	sl.Lock()
+	defer sl.Unlock()
+	llama3TokenizerModel = path
+}
 
-	return &Encoding{
-		Name:           MODEL_P50K_BASE,
-		PatStr:         `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
-		MergeableRanks: ranks,
-		SpecialTokens:  special_tokens,
-		ExplicitNVocab: 50281,
-	}, nil
+func currentLlama3TokenizerModel() string {
+	sl.RLock()
+	defer sl.RUnlock()
+	return llama3TokenizerModel
 }
 
-func r50k_base() (*Encoding, error) {
-	ranks, err := bpeLoader.LoadTiktokenBpe("https://openaipublic.blob.core.windows.net/encodings/r50k_base.tiktoken")
-	if err != nil {
-		return nil, err
+// llama3SpecialTokens follows the Llama 3.1 tokenizer: 256 tokens after the
+// 128000 mergeable ranks, the unused ones named reserved_special_token_N.
+func llama3SpecialTokens() map[string]int {
+	special_tokens := map[string]int{
+		"<|begin_of_text|>":            128000,
+		"<|end_of_text|>":              128001,
+		"<|reserved_special_token_0|>": 128002,
+		"<|reserved_special_token_1|>": 128003,
+		"<|finetune_right_pad_id|>":    128004,
+		"<|reserved_special_token_2|>": 128005,
+		"<|start_header_id|>":          128006,
+		"<|end_header_id|>":            128007,
+		"<|eom_id|>":                   128008,
+		"<|eot_id|>":                   128009,
+		"<|python_tag|>":               128010,
 	}
-	special_tokens := map[string]int{ENDOFTEXT: 50256}
-	return &Encoding{
-		Name:           MODEL_R50K_BASE,
-		MergeableRanks: ranks,
-		PatStr:         `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`,
-		SpecialTokens:  special_tokens,
-		ExplicitNVocab: 50257,
-	}, nil
+	for i := 3; i < 248; i++ {
+		special_tokens[fmt.Sprintf("<|reserved_special_token_%d|>", i)] = 128008 + i
+	}
+	return special_tokens
 }
 
 // var ENCODING_MAP = map[string]*Encoding{}
@@ -0,0 +1,124 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrEncodingNotFound is returned for encoding names that are neither built
+// in nor registered. The wrapping error suggests the closest known name when
+// the given one looks like a misspelling of it.
+var ErrEncodingNotFound = errors.New("tiktoken: unknown encoding")
+
+// ErrModelNotFound is returned by EncodingForModel for model names that
+// resolve to no encoding.
+var ErrModelNotFound = errors.New("tiktoken: no encoding for model")
+
+// EncodingName is the name of an encoding. Using the constants instead of
+// string literals turns typos into compile errors.
+type EncodingName string
+
+const (
+	CL100KBase   EncodingName = EncodingName(MODEL_CL100K_BASE)
+	O200KBase    EncodingName = EncodingName(MODEL_O200K_BASE)
+	O200KHarmony EncodingName = EncodingName(MODEL_O200K_HARMONY)
+	P50KBase     EncodingName = EncodingName(MODEL_P50K_BASE)
+	P50KEdit     EncodingName = EncodingName(MODEL_P50K_EDIT)
+	R50KBase     EncodingName = EncodingName(MODEL_R50K_BASE)
+	QwenBase     EncodingName = EncodingName(MODEL_QWEN_BASE)
+	Llama3       EncodingName = EncodingName(MODEL_LLAMA3)
+)
+
+var builtinEncodings = []EncodingName{CL100KBase, O200KBase, O200KHarmony, P50KBase, P50KEdit, R50KBase, QwenBase, Llama3}
+
+func (n EncodingName) String() string {
+	return string(n)
+}
+
+// GetEncodingByName is GetEncoding for a typed name.
+func GetEncodingByName(name EncodingName) (*Tiktoken, error) {
+	return GetEncoding(string(name))
+}
+
+// ParseEncoding returns s as an EncodingName if it names a built-in or a
+// registered encoding, and an error wrapping ErrEncodingNotFound otherwise.
+// It doesn't load the encoding.
+func ParseEncoding(s string) (EncodingName, error) {
+	for _, name := range knownEncodings() {
+		if string(name) == s {
+			return name, nil
+		}
+	}
+	return "", unknownEncoding(s)
+}
+
+// knownEncodings returns the built-in encodings followed by the registered
+// ones in sorted order.
+func knownEncodings() []EncodingName {
+	names := append([]EncodingName{}, builtinEncodings...)
+	rl.RLock()
+	registered := make([]string, 0, len(encodingConstructors))
+	for name := range encodingConstructors {
+		registered = append(registered, name)
+	}
+	rl.RUnlock()
+	sort.Strings(registered)
+	for _, name := range registered {
+		names = append(names, EncodingName(name))
+	}
+	return names
+}
+
+func unknownEncoding(s string) error {
+	if suggestion, ok := suggestEncoding(s); ok {
+		return fmt.Errorf("%w %q, did you mean %q?", ErrEncodingNotFound, s, suggestion)
+	}
+	return fmt.Errorf("%w %q", ErrEncodingNotFound, s)
+}
+
+// suggestEncoding returns the known name s is most likely a misspelling of:
+// one that only differs in case and separators, or else the closest one
+// within an edit distance of 2.
+func suggestEncoding(s string) (EncodingName, bool) {
+	fold := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(s))
+	}
+	best, bestDist := EncodingName(""), 3
+	for _, name := range knownEncodings() {
+		if fold(string(name)) == fold(s) {
+			return name, true
+		}
+		if d := editDistance(strings.ToLower(s), string(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance is the Levenshtein distance between a and b in bytes.
+func editDistance(a, b string) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diag := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			d := diag
+			if a[i-1] != b[j-1] {
+				d++
+			}
+			if row[j]+1 < d {
+				d = row[j] + 1
+			}
+			if row[j-1]+1 < d {
+				d = row[j-1] + 1
+			}
+			diag, row[j] = row[j], d
+		}
+	}
+	return row[len(b)]
+}
@@ -0,0 +1,49 @@
+package tiktoken
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEncoding(t *testing.T) {
+	ass := assert.New(t)
+	for _, name := range builtinEncodings {
+		parsed, err := ParseEncoding(name.String())
+		ass.Nil(err)
+		ass.Equal(name, parsed)
+	}
+
+	_, err := ParseEncoding("cl100kbase")
+	ass.True(errors.Is(err, ErrEncodingNotFound))
+	ass.EqualError(err, `tiktoken: unknown encoding "cl100kbase", did you mean "cl100k_base"?`)
+	_, err = ParseEncoding("Q200K_BASE")
+	ass.EqualError(err, `tiktoken: unknown encoding "Q200K_BASE", did you mean "o200k_base"?`)
+	_, err = ParseEncoding("nope")
+	ass.EqualError(err, `tiktoken: unknown encoding "nope"`)
+
+	_, err = GetEncoding("p50kbase")
+	ass.True(errors.Is(err, ErrEncodingNotFound))
+	ass.Contains(err.Error(), `did you mean "p50k_base"?`)
+
+	RegisterEncoding("parse_test_base", func() (*Encoding, error) { return nil, errors.New("unused") })
+	parsed, err := ParseEncoding("parse_test_base")
+	ass.Nil(err)
+	ass.Equal(EncodingName("parse_test_base"), parsed)
+
+	enc, err := GetEncodingByName(QwenBase)
+	ass.Nil(err)
+	ass.Equal(MODEL_QWEN_BASE, enc.Name())
+}
+
+func TestO200kPattern(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal(MODEL_O200K_BASE, MODEL_TO_ENCODING["gpt-4o"])
+	ass.Equal(MODEL_O200K_BASE, MODEL_PREFIX_TO_ENCODING["gpt-4o-"])
+
+	// unlike cl100k, contractions stay attached to their word
+	bpe, err := NewCoreBPE(map[string]int{}, nil, o200kPattern)
+	ass.Nil(err)
+	ass.Equal([]string{"I'm", " don't", " HTTPServer's", "/path", "/\n"}, regexPieces("I'm don't HTTPServer's/path/\n", bpe.tlRegex))
+}
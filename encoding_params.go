@@ -0,0 +1,114 @@
+package tiktoken
+
+import (
+	"fmt"
+
+	"github.com/dlclark/regexp2"
+)
+
+// EncodingParams declare a custom encoding for RegisterEncodingParams. The
+// mergeable ranks come from exactly one of Base, RankFile and
+// MergeableRanks.
+type EncodingParams struct {
+	// Base names a built-in or registered encoding whose rank tables are
+	// shared, as with DeriveEncoding. Its special tokens are kept and
+	// SpecialTokens are added to them.
+	Base string
+	// RankFile is the URI or path of a tiktoken rank file, loaded with the
+	// current BpeLoader as by NewEncodingFromRankFile.
+	RankFile string
+	// RankFileOptions apply to loading RankFile, e.g. WithRankFileHash.
+	RankFileOptions []RankFileOption
+	// MergeableRanks are the ranks themselves. The map must not be
+	// modified once it is registered.
+	MergeableRanks map[string]int
+	// PatStr is the regex splitting text into pieces. It may only be left
+	// empty with Base, whose pattern is used then.
+	PatStr string
+	// SpecialTokens map the special tokens to their ids, which must not be
+	// ids of mergeable ranks.
+	SpecialTokens map[string]int
+}
+
+// RegisterEncodingParams makes GetEncoding build the encoding named name
+// from params, without writing a constructor for RegisterEncoding. The
+// params are checked here, so a missing rank source or a pattern that
+// doesn't compile fails at registration; the ranks themselves are only
+// loaded by the first lookup, which fails if a special token shares its
+// id with a mergeable rank.
+//
+// A model that adds special tokens to a published vocabulary, e.g. after
+// fine-tuning, is best declared with Base:
+//
+//	tiktoken.RegisterEncodingParams("my_chat", tiktoken.EncodingParams{
+//		Base:          "cl100k_base",
+//		SpecialTokens: map[string]int{"<|tool|>": 100300},
+//	})
+func RegisterEncodingParams(name string, params EncodingParams) error {
+	if err := params.validate(name); err != nil {
+		return err
+	}
+	RegisterEncoding(name, func() (*Encoding, error) {
+		return params.build(name)
+	})
+	return nil
+}
+
+func (p EncodingParams) validate(name string) error {
+	if name == "" {
+		return fmt.Errorf("encoding name is empty")
+	}
+	for _, builtin := range builtinEncodings {
+		if name == string(builtin) {
+			return fmt.Errorf("encoding %s is built in and can't be replaced", name)
+		}
+	}
+	sources := 0
+	for _, set := range []bool{p.Base != "", p.RankFile != "", p.MergeableRanks != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("encoding %s needs exactly one of Base, RankFile and MergeableRanks", name)
+	}
+	if p.Base == name {
+		return fmt.Errorf("encoding %s can't be its own base", name)
+	}
+	if p.PatStr == "" {
+		if p.Base == "" {
+			return fmt.Errorf("encoding %s has no pattern", name)
+		}
+		return nil
+	}
+	if _, err := regexp2.Compile(p.PatStr, regexp2.None); err != nil {
+		return fmt.Errorf("encoding %s: pattern: %w", name, err)
+	}
+	return nil
+}
+
+func (p EncodingParams) build(name string) (*Encoding, error) {
+	switch {
+	case p.Base != "":
+		base, err := LoadEncoding(p.Base)
+		if err != nil {
+			return nil, err
+		}
+		enc, err := DeriveEncoding(base, name, p.SpecialTokens)
+		if err != nil {
+			return nil, err
+		}
+		if p.PatStr != "" {
+			enc.PatStr = p.PatStr
+		}
+		return enc, nil
+	case p.RankFile != "":
+		return NewEncodingFromRankFile(name, p.RankFile, p.PatStr, p.SpecialTokens, p.RankFileOptions...)
+	default:
+		tables, err := newRankTables(p.MergeableRanks)
+		if err != nil {
+			return nil, err
+		}
+		return newEncoding(name, "", p.PatStr, tables, p.SpecialTokens)
+	}
+}
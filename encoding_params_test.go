@@ -0,0 +1,65 @@
+package tiktoken
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterEncodingParams(t *testing.T) {
+	ass := assert.New(t)
+	ass.Nil(RegisterEncodingParams("qwen_test_params", EncodingParams{
+		Base:          MODEL_QWEN_BASE,
+		SpecialTokens: map[string]int{"<|tool|>": 160000},
+	}))
+	// it shares the qwen tables, which other tests expect to be released
+	defer ReleaseEncoding("qwen_test_params")
+	enc, err := GetEncoding("qwen_test_params")
+	ass.Nil(err)
+	ass.Equal("qwen_test_params", enc.Name())
+	ass.Equal([]int{14990, 160000}, enc.Encode("hello<|tool|>", []string{"all"}, nil))
+	ass.Equal([]int{151643}, enc.Encode(ENDOFTEXT, []string{"all"}, nil), "base special tokens are kept")
+
+	ass.Nil(RegisterEncodingParams("test_params_ranks", EncodingParams{
+		MergeableRanks: testEncoding().MergeableRanks,
+		PatStr:         testPattern,
+		SpecialTokens:  map[string]int{"<|end|>": 1000},
+	}))
+	enc, err = GetEncoding("test_params_ranks")
+	ass.Nil(err)
+	tokens := enc.Encode("hello world<|end|>", []string{"all"}, nil)
+	ass.Equal(GetTestEncoding().EncodeOrdinary("hello world"), tokens[:len(tokens)-1])
+	ass.Equal(1000, tokens[len(tokens)-1])
+
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	rankFile := filepath.Join(dir, "params.tiktoken")
+	writeRankFile(t, rankFile, "a", "b", "ab")
+	ass.Nil(RegisterEncodingParams("test_params_file", EncodingParams{
+		RankFile:      rankFile,
+		PatStr:        `\w+`,
+		SpecialTokens: map[string]int{"<|end|>": 2},
+	}))
+	_, err = GetEncoding("test_params_file")
+	ass.EqualError(err, "special token <|end|> has id 2, which is also a mergeable rank")
+}
+
+func TestRegisterEncodingParamsInvalid(t *testing.T) {
+	ass := assert.New(t)
+	ranks := map[string]int{"a": 0}
+	ass.EqualError(RegisterEncodingParams(MODEL_CL100K_BASE, EncodingParams{Base: MODEL_QWEN_BASE}),
+		"encoding cl100k_base is built in and can't be replaced")
+	ass.EqualError(RegisterEncodingParams("invalid", EncodingParams{PatStr: `\w+`}),
+		"encoding invalid needs exactly one of Base, RankFile and MergeableRanks")
+	ass.EqualError(RegisterEncodingParams("invalid", EncodingParams{Base: MODEL_QWEN_BASE, MergeableRanks: ranks}),
+		"encoding invalid needs exactly one of Base, RankFile and MergeableRanks")
+	ass.EqualError(RegisterEncodingParams("invalid", EncodingParams{MergeableRanks: ranks}),
+		"encoding invalid has no pattern")
+	ass.EqualError(RegisterEncodingParams("invalid", EncodingParams{Base: "invalid"}),
+		"encoding invalid can't be its own base")
+	ass.ErrorContains(RegisterEncodingParams("invalid", EncodingParams{MergeableRanks: ranks, PatStr: `(\w+`}),
+		"encoding invalid: pattern: ")
+	_, err := ParseEncoding("invalid")
+	ass.ErrorIs(err, ErrEncodingNotFound, "invalid params are not registered")
+}
@@ -0,0 +1,52 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDisallowedSpecial is wrapped by *DisallowedSpecialError.
+var ErrDisallowedSpecial = errors.New("tiktoken: disallowed special token")
+
+// DisallowedSpecialError is returned when text to encode contains a special
+// token that the call disallows.
+type DisallowedSpecialError struct {
+	Token string
+}
+
+func (e *DisallowedSpecialError) Error() string {
+	return "text contains disallowed special token " + e.Token
+}
+
+func (e *DisallowedSpecialError) Unwrap() error {
+	return ErrDisallowedSpecial
+}
+
+// ErrInvalidToken is wrapped by *InvalidTokenError.
+var ErrInvalidToken = errors.New("tiktoken: invalid token")
+
+// InvalidTokenError is returned by the decoding methods for an id that is
+// not a token of the encoding.
+type InvalidTokenError struct {
+	Token int
+	// Index is the index of the token in the decoded slice, -1 when a
+	// single token was decoded.
+	Index int
+	// Indices are the indices of all invalid tokens, for the methods that
+	// return them together, such as DecodeTokensToBytes.
+	Indices []int
+}
+
+func (e *InvalidTokenError) Error() string {
+	switch {
+	case len(e.Indices) > 0:
+		return fmt.Sprintf("invalid tokens at indices %v", e.Indices)
+	case e.Index < 0:
+		return fmt.Sprintf("invalid token %d", e.Token)
+	}
+	return fmt.Sprintf("invalid token %d at index %d", e.Token, e.Index)
+}
+
+func (e *InvalidTokenError) Unwrap() error {
+	return ErrInvalidToken
+}
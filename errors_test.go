@@ -0,0 +1,79 @@
+package tiktoken
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedErrors(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	_, err = enc.EncodeWithError("hi <|im_start|>", nil, []string{"all"})
+	ass.EqualError(err, "text contains disallowed special token <|im_start|>")
+	ass.ErrorIs(err, ErrDisallowedSpecial)
+	var disallowed *DisallowedSpecialError
+	ass.ErrorAs(err, &disallowed)
+	ass.Equal(IM_START, disallowed.Token)
+	it, err := enc.EncodeReader(strings.NewReader("hi <|endoftext|>"), nil, []string{"all"})
+	ass.Nil(err)
+	for it.Next() {
+	}
+	ass.ErrorAs(it.Err(), &disallowed)
+	ass.Equal(ENDOFTEXT, disallowed.Token)
+
+	var invalid *InvalidTokenError
+	_, err = enc.DecodeWithError([]int{14990, -5})
+	ass.EqualError(err, "invalid token -5 at index 1")
+	ass.ErrorIs(err, ErrInvalidToken)
+	ass.ErrorAs(err, &invalid)
+	ass.Equal(InvalidTokenError{Token: -5, Index: 1}, *invalid)
+	_, err = enc.DecodeWithMode([]int{-5}, DecodeStrict)
+	ass.ErrorIs(err, ErrInvalidToken)
+	_, _, err = enc.DecodeWithOffsets([]int{-5})
+	ass.ErrorIs(err, ErrInvalidToken)
+	_, err = enc.NewDecodeWriter(&strings.Builder{}).WriteTokens(-5)
+	ass.ErrorIs(err, ErrInvalidToken)
+	_, err = enc.DecodeTokensToBytes([]int{-5, 14990, -6})
+	ass.EqualError(err, "invalid tokens at indices [0 2]")
+	ass.ErrorAs(err, &invalid)
+	ass.Equal(InvalidTokenError{Token: -5, Index: 0, Indices: []int{0, 2}}, *invalid)
+	_, err = enc.DecodeSingleTokenBytes(-5)
+	ass.EqualError(err, "invalid token -5")
+	ass.ErrorIs(err, ErrInvalidToken)
+
+	_, err = EncodingForModel("no-such-model")
+	ass.ErrorIs(err, ErrModelNotFound)
+	_, err = GetEncoding("no_such_encoding")
+	ass.ErrorIs(err, ErrEncodingNotFound)
+}
+
+func TestDownloadError(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := NewDefaultBpeLoader().LoadTiktokenBpe(srv.URL + "/missing.tiktoken")
+	ass.ErrorIs(err, ErrDownload)
+	var download *DownloadError
+	ass.ErrorAs(err, &download)
+	ass.Equal(http.StatusNotFound, download.StatusCode)
+	ass.Equal(srv.URL+"/missing.tiktoken", download.URI)
+	ass.Nil(download.Err)
+
+	srv.Close()
+	_, err = NewDefaultBpeLoader().LoadTiktokenBpe(srv.URL + "/gone.tiktoken")
+	ass.ErrorIs(err, ErrDownload)
+	ass.ErrorAs(err, &download)
+	ass.Zero(download.StatusCode)
+	var netErr net.Error
+	ass.True(errors.As(err, &netErr), "the transport error is wrapped: %v", err)
+}
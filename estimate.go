@@ -0,0 +1,203 @@
+package tiktoken
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ratio is how densely an encoding tokenizes some text.
+type Ratio struct {
+	// Bytes, Runes and Tokens are the totals of the sample, zero for the
+	// built-in defaults.
+	Bytes, Runes, Tokens int64
+	BytesPerToken        float64
+	RunesPerToken        float64
+}
+
+// CalibrateRatio reads corpus to its end and returns how densely enc
+// tokenizes it, counting tokens as CountTokens would for the whole text.
+// Bytes and runes are those of the input as read, before the encode options
+// of enc; invalid UTF-8 bytes count as one rune each.
+func CalibrateRatio(enc *Tiktoken, corpus io.Reader) (Ratio, error) {
+	counter := enc.NewTokenCounter()
+	var r Ratio
+	runes := writerFunc(func(p []byte) (int, error) {
+		r.Bytes += int64(len(p))
+		for _, b := range p {
+			if !utf8.RuneStart(b) {
+				continue
+			}
+			r.Runes++
+		}
+		return len(p), nil
+	})
+	if _, err := io.Copy(io.MultiWriter(counter, runes), corpus); err != nil {
+		return Ratio{}, err
+	}
+	if err := counter.Flush(); err != nil {
+		return Ratio{}, err
+	}
+	r.Tokens = counter.Count()
+	if r.Tokens > 0 {
+		r.BytesPerToken = float64(r.Bytes) / float64(r.Tokens)
+		r.RunesPerToken = float64(r.Runes) / float64(r.Tokens)
+	}
+	return r, nil
+}
+
+// Script is a class of writing systems that tokenize alike, used by
+// EstimateTokens.
+type Script int
+
+const (
+	// ScriptLatin is the Latin alphabet with its accented letters.
+	ScriptLatin Script = iota
+	// ScriptCJK is Chinese, Japanese and Korean: Han, kana and Hangul.
+	ScriptCJK
+	// ScriptCyrillic is the Cyrillic alphabet.
+	ScriptCyrillic
+	// ScriptArabic is the Arabic script.
+	ScriptArabic
+
+	numScripts = iota
+)
+
+func (s Script) String() string {
+	switch s {
+	case ScriptLatin:
+		return "latin"
+	case ScriptCJK:
+		return "cjk"
+	case ScriptCyrillic:
+		return "cyrillic"
+	case ScriptArabic:
+		return "arabic"
+	}
+	return fmt.Sprintf("Script(%d)", int(s))
+}
+
+// scriptOf returns the class of r, or false for runes of no class, such as
+// digits, punctuation, spaces and other scripts.
+func scriptOf(r rune) (Script, bool) {
+	switch {
+	case r < utf8.RuneSelf:
+		return ScriptLatin, 'a' <= r|0x20 && r|0x20 <= 'z'
+	case unicode.Is(unicode.Latin, r):
+		return ScriptLatin, true
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+		return ScriptCJK, true
+	case unicode.Is(unicode.Cyrillic, r):
+		return ScriptCyrillic, true
+	case unicode.Is(unicode.Arabic, r):
+		return ScriptArabic, true
+	}
+	return 0, false
+}
+
+// scriptRatios holds the runes per token of each script per encoding. The
+// qwen_base figures are measured with CalibrateRatio on short prose samples;
+// the others are rough figures for typical prose. Use SetScriptRatio with
+// the ratios of your own text where precision matters.
+var scriptRatios = map[string][numScripts]float64{
+	MODEL_O200K_BASE:    {4.3, 1.3, 3.6, 3.3},
+	MODEL_O200K_HARMONY: {4.3, 1.3, 3.6, 3.3},
+	MODEL_CL100K_BASE:   {4.0, 0.9, 2.5, 2.0},
+	MODEL_P50K_BASE:     {3.8, 0.6, 1.4, 1.0},
+	MODEL_P50K_EDIT:     {3.8, 0.6, 1.4, 1.0},
+	MODEL_R50K_BASE:     {3.8, 0.6, 1.4, 1.0},
+	MODEL_LLAMA3:        {4.1, 1.1, 3.0, 2.6},
+	MODEL_QWEN_BASE:     {4.4, 1.7, 2.9, 3.0},
+}
+
+var scriptRatiosMu sync.RWMutex
+
+// SetScriptRatio sets the runes per token of script for the encoding
+// named encoding, e.g. to the RunesPerToken of CalibrateRatio over a sample
+// of that script. Encodings without ratios of their own use those of
+// cl100k_base.
+func SetScriptRatio(encoding string, script Script, r Ratio) {
+	if script < 0 || script >= numScripts || r.RunesPerToken <= 0 {
+		return
+	}
+	scriptRatiosMu.Lock()
+	defer scriptRatiosMu.Unlock()
+	ratios, ok := scriptRatios[encoding]
+	if !ok {
+		ratios = scriptRatios[MODEL_CL100K_BASE]
+	}
+	ratios[script] = r.RunesPerToken
+	scriptRatios[encoding] = ratios
+}
+
+// estimateSampleRunes is the number of runes EstimateTokens classifies.
+const estimateSampleRunes = 1024
+
+// EstimateTokens quickly estimates the number of tokens of text without
+// encoding it, from the runes per token of the scripts text is written in,
+// see SetScriptRatio. The mix of scripts is taken from up to 1024 runes
+// spread over the text; runes of no script, such as digits and spaces,
+// count like each script in proportion. Expect an error of 10 to 20
+// percent on prose and more on code and numbers; use CountTokens for exact
+// counts.
+func (t *Tiktoken) EstimateTokens(text string) int {
+	runes := utf8.RuneCountInString(text)
+	if runes == 0 {
+		return 0
+	}
+
+	var seen [numScripts]float64
+	letters := 0.0
+	sample := func(r rune, weight float64) {
+		if s, ok := scriptOf(r); ok {
+			seen[s] += weight
+			letters += weight
+		}
+	}
+	if runes <= estimateSampleRunes {
+		for _, r := range text {
+			sample(r, 1)
+		}
+	} else {
+		// a byte offset falls in a rune in proportion to its size, which
+		// the weight undoes
+		step := len(text) / estimateSampleRunes
+		for i := 0; i < len(text); i += step {
+			// the rune starting at or after i
+			for i < len(text) && !utf8.RuneStart(text[i]) {
+				i++
+			}
+			r, size := utf8.DecodeRuneInString(text[i:])
+			sample(r, 1/float64(size))
+		}
+	}
+
+	scriptRatiosMu.RLock()
+	ratios, ok := scriptRatios[t.Name()]
+	if !ok {
+		ratios = scriptRatios[MODEL_CL100K_BASE]
+	}
+	scriptRatiosMu.RUnlock()
+
+	if letters == 0 {
+		return int(float64(runes)/ratios[ScriptLatin] + 0.5)
+	}
+	tokens := 0.0
+	for s, n := range seen {
+		tokens += float64(runes) * n / letters / ratios[s]
+	}
+	n := int(tokens + 0.5)
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// CountTokensApprox is EstimateTokens, named for use next to CountTokens
+// where an approximate count is enough, as for rate limiting and admission
+// control. It costs a small fraction of an exact count.
+func (t *Tiktoken) CountTokensApprox(text string) int {
+	return t.EstimateTokens(text)
+}
@@ -0,0 +1,76 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var estimateTexts = map[Script]string{
+	ScriptLatin:    "The history of the city begins in the early Middle Ages, when a small settlement grew up around a river crossing. Merchants traveling between the northern ports and the southern markets stopped there to rest and trade. La ciudad creció rápidamente durante el siglo diecinueve.",
+	ScriptCJK:      "这座城市的历史可以追溯到中世纪早期，当时在河流渡口周围形成了一个小型定居点。往来于北方港口和南方市场之间的商人在这里休息和交易。東京は日本の首都であり、世界有数の大都市です。",
+	ScriptCyrillic: "История города начинается в раннем Средневековье, когда вокруг речной переправы возникло небольшое поселение. Купцы, путешествовавшие между северными портами и южными рынками, останавливались здесь.",
+	ScriptArabic:   "يبدأ تاريخ المدينة في أوائل العصور الوسطى، عندما نشأت مستوطنة صغيرة حول معبر نهري. وكان التجار المسافرون بين الموانئ الشمالية والأسواق الجنوبية يتوقفون هناك للراحة والتجارة.",
+}
+
+func TestCalibrateRatio(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := estimateTexts[ScriptCJK]
+	r, err := CalibrateRatio(tk, strings.NewReader(text))
+	ass.Nil(err)
+	ass.Equal(int64(len(text)), r.Bytes)
+	ass.Equal(int64(utf8.RuneCountInString(text)), r.Runes)
+	ass.Equal(int64(tk.CountTokens(text)), r.Tokens)
+	ass.Equal(float64(r.Bytes)/float64(r.Tokens), r.BytesPerToken)
+	ass.Equal(float64(r.Runes)/float64(r.Tokens), r.RunesPerToken)
+
+	r, err = CalibrateRatio(tk, strings.NewReader(""))
+	ass.Nil(err)
+	ass.Equal(Ratio{}, r)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	within := func(text string, tolerance float64) {
+		want := float64(tk.CountTokens(text))
+		got := float64(tk.EstimateTokens(text))
+		ass.InDelta(want, got, want*tolerance, "%.40q: estimated %v, counted %v", text, got, want)
+	}
+	var mixed strings.Builder
+	for s := ScriptLatin; s < numScripts; s++ {
+		within(estimateTexts[s], 0.25)
+		within(strings.Repeat(estimateTexts[s]+"\n", 40), 0.25)
+		mixed.WriteString(estimateTexts[s])
+	}
+	within(mixed.String(), 0.25)
+	within(strings.Repeat(mixed.String(), 20), 0.25)
+
+	ass.Equal(0, tk.EstimateTokens(""))
+	ass.Equal(1, tk.EstimateTokens("a"))
+	ass.Less(0, tk.EstimateTokens("12345 67890"))
+	ass.Equal(tk.EstimateTokens(estimateTexts[ScriptCJK]), tk.CountTokensApprox(estimateTexts[ScriptCJK]))
+
+	// a custom encoding calibrated for its own text
+	base, err := LoadEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	derived, err := DeriveEncoding(base, "estimate_custom", nil)
+	ass.Nil(err)
+	custom, err := newTiktokenFromEncoding(derived)
+	ass.Nil(err)
+	text := estimateTexts[ScriptCyrillic]
+	r, err := CalibrateRatio(custom, strings.NewReader(text))
+	ass.Nil(err)
+	SetScriptRatio("estimate_custom", ScriptCyrillic, r)
+	ass.InDelta(custom.CountTokens(text), custom.EstimateTokens(text), 1)
+	// other scripts fall back to the ratios of cl100k_base
+	latin := estimateTexts[ScriptLatin]
+	ass.Equal(int(float64(utf8.RuneCountInString(latin))/scriptRatios[MODEL_CL100K_BASE][ScriptLatin]+0.5), custom.EstimateTokens(latin))
+}
@@ -0,0 +1,58 @@
+// Command s3fetcher shows how to load rank files from S3 with IAM credentials
+// by plugging a Fetcher into the default loader.
+//
+//	go run . -uri s3://my-bucket/encodings/cl100k_base.tiktoken
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// s3Fetcher fetches "s3://bucket/key" URIs using the default AWS credential chain.
+type s3Fetcher struct {
+	client *s3.Client
+}
+
+func (f *s3Fetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	out, err := f.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func main() {
+	uri := flag.String("uri", "", "s3:// URI of a .tiktoken rank file")
+	flag.Parse()
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	loader := tiktoken.NewDefaultBpeLoader(tiktoken.WithFetcher("s3", &s3Fetcher{client: s3.NewFromConfig(cfg)}))
+
+	ranks, err := loader.LoadTiktokenBpe(*uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("loaded %d ranks from %s\n", len(ranks), *uri)
+}
@@ -0,0 +1,36 @@
+// Command server serves the tiktokenhttp endpoints below /v1/ until it is
+// interrupted, then finishes the requests in flight.
+//
+//	go run ./examples/server -addr :8080
+//	curl -d '{"model": "qwen", "text": "hello world"}' localhost:8080/v1/count
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkoukk/tiktoken-go/tiktokenhttp"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	maxBody := flag.Int64("max-body", tiktokenhttp.DefaultMaxBodyBytes, "request body limit in bytes")
+	metrics := flag.Bool("metrics", true, "serve GET /v1/metrics")
+	flag.Parse()
+
+	mux := http.NewServeMux()
+	handler := tiktokenhttp.NewHandler(tiktokenhttp.WithMaxBodyBytes(*maxBody), tiktokenhttp.WithMetrics(*metrics))
+	mux.Handle("/v1/", http.StripPrefix("/v1", handler))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("listening on %s", *addr)
+	if err := tiktokenhttp.ListenAndServe(ctx, *addr, mux); err != nil {
+		log.Fatal(err)
+	}
+	log.Print("shut down")
+}
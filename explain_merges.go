@@ -0,0 +1,69 @@
+package tiktoken
+
+import "sort"
+
+// MergeStep is a step of ExplainMerges.
+type MergeStep struct {
+	// Left and Right are the parts merged, nil in the last step.
+	Left, Right []byte
+	// Rank is the rank of Left and Right merged, which is the id of the
+	// merged token, or -1 in the last step. Lower ranks merge first, and of
+	// equal ranks the leftmost.
+	Rank int
+	// Parts is the segmentation of the piece after the step and Tokens the
+	// ids of the parts.
+	Parts  [][]byte
+	Tokens []int
+}
+
+// ExplainMerges returns the merges byte pair encoding makes in piece, in the
+// order it makes them, as a single piece of the split pattern; piece isn't
+// split again. The steps are traced from the merge loop Encode runs, so
+// they are what Encode does. The last step is not a merge: it has the
+// tokens Encode gives piece, which are those of the last merge except for
+// a piece that is a token of its own, which Encode uses without merging.
+// Pieces longer than the maximum piece length, see WithMaxPieceLength, are
+// cut and each part is merged on its own. Token filters don't apply.
+func (t *Tiktoken) ExplainMerges(piece []byte) []MergeStep {
+	t.bpe.mustOpen()
+	if len(piece) == 0 {
+		return nil
+	}
+	bp := t.bpe
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	var steps []MergeStep
+	offset := 0
+	trace := func(left, mid, end, rank int) {
+		left, mid, end = offset+left, offset+mid, offset+end
+		i := sort.SearchInts(bounds, mid)
+		bounds = append(bounds[:i], bounds[i+1:]...)
+		step := MergeStep{Left: piece[left:mid:mid], Right: piece[mid:end:end], Rank: rank}
+		for i := 0; i+1 < len(bounds); i++ {
+			part := piece[bounds[i]:bounds[i+1]:bounds[i+1]]
+			step.Parts = append(step.Parts, part)
+			step.Tokens = append(step.Tokens, bp.encoder[string(part)])
+		}
+		steps = append(steps, step)
+	}
+	for b := piece; len(b) > 0; {
+		chunk := b
+		if bp.maxPieceLength > 0 && len(chunk) > bp.maxPieceLength {
+			chunk = b[:safeCut(b, bp.maxPieceLength)]
+		}
+		bytePairMergeParts(nil, chunk, bp.encoder, trace)
+		offset += len(chunk)
+		b = b[len(chunk):]
+	}
+
+	last := MergeStep{Rank: -1, Tokens: bp.appendPiece(nil, string(piece))}
+	at := 0
+	for _, token := range last.Tokens {
+		end := at + len(bp.tokenBytes(token))
+		last.Parts = append(last.Parts, piece[at:end:end])
+		at = end
+	}
+	return append(steps, last)
+}
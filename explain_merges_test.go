@@ -0,0 +1,81 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stepStrings(steps []MergeStep) []string {
+	var out []string
+	for _, s := range steps {
+		var parts []string
+		for _, p := range s.Parts {
+			parts = append(parts, string(p))
+		}
+		out = append(out, string(s.Left)+"+"+string(s.Right)+" "+strings.Join(parts, "|"))
+	}
+	return out
+}
+
+func TestExplainMerges(t *testing.T) {
+	ass := assert.New(t)
+	tk := GetTestEncoding()
+
+	// "ll" and "lo" have adjacent ranks; the lower wins, and Encode then
+	// takes hello as a token of its own.
+	steps := tk.ExplainMerges([]byte("hello"))
+	ass.Equal([]string{"h+e he|l|l|o", "l+l he|ll|o", "+ hello"}, stepStrings(steps))
+	ass.Equal(tk.bpe.encoder["ll"], steps[1].Rank)
+	ass.Equal([]int{tk.bpe.encoder["he"], tk.bpe.encoder["ll"], 'o'}, steps[1].Tokens)
+	ass.Equal(-1, steps[2].Rank)
+	ass.Equal(tk.Encode("hello", nil, nil), steps[2].Tokens)
+
+	// equal ranks merge leftmost first, and a lower rank to the right wins
+	// over a higher one built by the first merge
+	ass.Equal([]string{"0+0 00|0", "00+0 000", "+ 000"}, stepStrings(tk.ExplainMerges([]byte("000"))))
+	ass.Equal([]string{"0+0 00|0|0", "0+0 00|00", "+ 00|00"}, stepStrings(tk.ExplainMerges([]byte("0000"))))
+
+	ass.Equal([]string{"+ x"}, stepStrings(tk.ExplainMerges([]byte("x"))))
+	ass.Nil(tk.ExplainMerges(nil))
+
+	// long pieces are cut as Encode cuts them
+	long := tk.WithOptions(WithMaxPieceLength(5))
+	steps = long.ExplainMerges([]byte("hellohello"))
+	ass.Equal([]string{
+		"h+e he|l|l|o|h|e|l|l|o", "l+l he|ll|o|h|e|l|l|o",
+		"h+e he|ll|o|he|l|l|o", "l+l he|ll|o|he|ll|o", "+ he|ll|o|he|ll|o",
+	}, stepStrings(steps))
+	ass.Equal(long.Encode("hellohello", nil, nil), steps[4].Tokens)
+}
+
+func TestMergeTraceHeapMatchesScan(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ranks := enc.bpe.encoder
+
+	r := rand.New(rand.NewSource(1))
+	pieces := []string{strings.Repeat("0", 70), strings.Repeat("ab", 40), strings.Repeat("汉字", 30)}
+	for i := 0; i < 100; i++ {
+		b := make([]byte, heapMergeThreshold+r.Intn(200))
+		alphabet := "aaabbcde0123+/="
+		for j := range b {
+			b[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		pieces = append(pieces, string(b))
+	}
+	for _, piece := range pieces {
+		var want, got [][4]int
+		bytePairMergeScan(nil, []byte(piece), ranks, func(left, mid, end, rank int) {
+			want = append(want, [4]int{left, mid, end, rank})
+		})
+		bytePairMergeHeap(nil, []byte(piece), ranks, func(left, mid, end, rank int) {
+			got = append(got, [4]int{left, mid, end, rank})
+		})
+		ass.Equal(want, got, "%q", piece)
+		ass.Len(want, len(piece)-len(enc.BytePairEncode([]byte(piece))))
+	}
+}
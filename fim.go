@@ -0,0 +1,89 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// FIMTokens are the special tokens of a fill-in-the-middle prompt.
+type FIMTokens struct {
+	Prefix int
+	Middle int
+	Suffix int
+}
+
+// FIMTokens returns the fill-in-the-middle special tokens of t, or false if
+// the encoding doesn't define all three.
+func (t *Tiktoken) FIMTokens() (FIMTokens, bool) {
+	t.bpe.mustOpen()
+	specials := t.bpe.specialTokensEncoder
+	prefix, okPrefix := specials[FIM_PREFIX]
+	middle, okMiddle := specials[FIM_MIDDLE]
+	suffix, okSuffix := specials[FIM_SUFFIX]
+	return FIMTokens{prefix, middle, suffix}, okPrefix && okMiddle && okSuffix
+}
+
+// FIMOption configures BuildFIMPrompt.
+type FIMOption func(*fimConfig)
+
+type fimConfig struct {
+	prefixShare float64 // < 0 means proportional to the lengths
+}
+
+// WithFIMPrefixShare gives the prefix the fraction share, clamped to
+// [0, 1], of the tokens left for code when both sides must be trimmed.
+// Tokens the suffix doesn't need go to the prefix and the other way round.
+// By default the share is the prefix's fraction of all code tokens, so
+// both sides are trimmed proportionally.
+func WithFIMPrefixShare(share float64) FIMOption {
+	return func(c *fimConfig) {
+		c.prefixShare = math.Min(math.Max(share, 0), 1)
+	}
+}
+
+// BuildFIMPrompt returns the tokens of a fill-in-the-middle prompt in
+// prefix-suffix-middle order: <|fim_prefix|> prefix <|fim_suffix|> suffix
+// <|fim_middle|>. The code is encoded as ordinary text. If the prompt would
+// be longer than maxTokens, the start of prefix and the end of suffix are
+// dropped token by token, keeping the code nearest the cursor.
+func (t *Tiktoken) BuildFIMPrompt(prefix, suffix string, maxTokens int, opts ...FIMOption) ([]int, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	c := fimConfig{prefixShare: -1}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	fim, ok := t.FIMTokens()
+	if !ok {
+		return nil, fmt.Errorf("encoding %s has no fill-in-the-middle tokens", t.Name())
+	}
+	budget := maxTokens - 3
+	if budget < 0 {
+		return nil, errors.New("maxTokens must leave room for the three fill-in-the-middle tokens")
+	}
+
+	p, s := t.EncodeOrdinary(prefix), t.EncodeOrdinary(suffix)
+	if len(p)+len(s) > budget {
+		share := c.prefixShare
+		if share < 0 {
+			share = float64(len(p)) / float64(len(p)+len(s))
+		}
+		keepP := int(math.Round(float64(budget) * share))
+		keepS := budget - keepP
+		if keepP > len(p) {
+			keepP, keepS = len(p), budget-len(p)
+		} else if keepS > len(s) {
+			keepP, keepS = budget-len(s), len(s)
+		}
+		p, s = p[len(p)-keepP:], s[:keepS]
+	}
+
+	tokens := make([]int, 0, len(p)+len(s)+3)
+	tokens = append(tokens, fim.Prefix)
+	tokens = append(tokens, p...)
+	tokens = append(tokens, fim.Suffix)
+	tokens = append(tokens, s...)
+	return append(tokens, fim.Middle), nil
+}
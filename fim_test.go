@@ -0,0 +1,61 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildFIMPrompt(t *testing.T) {
+	ass := assert.New(t)
+	qwen, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	_, ok := qwen.FIMTokens()
+	ass.False(ok)
+	_, err = qwen.BuildFIMPrompt("a", "b", 10)
+	ass.EqualError(err, "encoding qwen_base has no fill-in-the-middle tokens")
+
+	specials := map[string]int{FIM_PREFIX: 151646, FIM_MIDDLE: 151647, FIM_SUFFIX: 151648}
+	enc, err := newTiktokenFromEncoding(&Encoding{
+		Name:           "qwen_fim",
+		PatStr:         qwenPattern,
+		MergeableRanks: qwen.pbeEncoding.MergeableRanks,
+		SpecialTokens:  specials,
+	})
+	ass.Nil(err)
+	fim, ok := enc.FIMTokens()
+	ass.True(ok)
+	ass.Equal(FIMTokens{Prefix: 151646, Middle: 151647, Suffix: 151648}, fim)
+
+	prefix, suffix := "func add(a, b int) int {\n\treturn ", "\n}\n"
+	p, s := enc.EncodeOrdinary(prefix), enc.EncodeOrdinary(suffix)
+	tokens, err := enc.BuildFIMPrompt(prefix, suffix, 100)
+	ass.Nil(err)
+	want := append(append(append(append([]int{fim.Prefix}, p...), fim.Suffix), s...), fim.Middle)
+	ass.Equal(want, tokens)
+
+	// trimming keeps the end of the prefix and the start of the suffix
+	prefix, suffix = strings.Repeat("x = x + 1\n", 20), strings.Repeat("y = y - 1\n", 20)
+	p, s = enc.EncodeOrdinary(prefix), enc.EncodeOrdinary(suffix)
+	tokens, err = enc.BuildFIMPrompt(prefix, suffix, 43)
+	ass.Nil(err)
+	ass.Len(tokens, 43)
+	ass.Equal(append(append([]int{fim.Prefix}, p[len(p)-20:]...), fim.Suffix), tokens[:22])
+	ass.Equal(append(append([]int{}, s[:20]...), fim.Middle), tokens[22:])
+
+	tokens, err = enc.BuildFIMPrompt(prefix, suffix, 43, WithFIMPrefixShare(0.75))
+	ass.Nil(err)
+	ass.Equal(fim.Suffix, tokens[1+30], "the prefix gets three quarters of the 40 code tokens")
+
+	tokens, err = enc.BuildFIMPrompt(prefix, "}", 43, WithFIMPrefixShare(0.1))
+	ass.Nil(err)
+	ass.Len(tokens, 43, "the short suffix leaves its share to the prefix")
+	ass.Equal(fim.Suffix, tokens[1+39])
+
+	tokens, err = enc.BuildFIMPrompt(prefix, suffix, 3)
+	ass.Nil(err)
+	ass.Equal([]int{fim.Prefix, fim.Suffix, fim.Middle}, tokens)
+	_, err = enc.BuildFIMPrompt(prefix, suffix, 2)
+	ass.NotNil(err)
+}
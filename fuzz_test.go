@@ -0,0 +1,134 @@
+package tiktoken
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dlclark/regexp2"
+)
+
+func FuzzEncode(f *testing.F) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{"", "hello world!你好，世界！", "<|endoftext|>", "<|endoftext", "\xff\xfe", "  \n\n\t"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		if _, err := enc.EncodeWithError(text, nil, []string{"all"}); err != nil {
+			return
+		}
+		enc.Encode(text, []string{"all"}, nil)
+		enc.EncodeOrdinary(text)
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(0, 1, 100257)
+	f.Add(-1, 1<<40, 151643)
+	f.Fuzz(func(t *testing.T, a, b, c int) {
+		tokens := []int{a, b, c}
+		enc.Decode(tokens)
+		if _, err := enc.DecodeWithError(tokens); err == nil {
+			for _, token := range tokens {
+				if !enc.bpe.hasToken(token) {
+					t.Fatalf("DecodeWithError accepted unknown token %d", token)
+				}
+			}
+		}
+	})
+}
+
+func FuzzParseTiktokenBpe(f *testing.F) {
+	for _, seed := range []string{"", "YQ== 0\n", "YQ==\n", "YQ== x\n", "!!! 0\n", "YQ== 0 1\r\n", "\uFEFFYQ== 0"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, contents []byte) {
+		parseTiktokenBpe(contents)
+	})
+}
+
+func FuzzASCIISplit(f *testing.F) {
+	for _, seed := range []string{"", "it's 'LL", "x = 12345;\n\t}\n", "  \r\n\n !?"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		if !isASCII(text) {
+			return
+		}
+		for pattern, splitter := range asciiSplitters {
+			re := regexp2.MustCompile(pattern, regexp2.None)
+			want, got := regexPieces(text, re), asciiPieces(text, splitter)
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("%q: regex split %q, ascii split %q", text, want, got)
+			}
+		}
+	})
+}
+
+func FuzzUnicodeSplit(f *testing.F) {
+	for _, seed := range []string{"", "it's 'LL", "été ǅungla", "１２３ ²³　 x", "\u0301x ʰʰa\r\n/"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		if !utf8.ValidString(text) {
+			return
+		}
+		for pattern, splitter := range unicodeSplitters {
+			re := regexp2.MustCompile(pattern, regexp2.None)
+			want, got := regexRunePieces(text, re), unicodePieces(text, splitter)
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("%q: regex split %q, scanner split %q", text, want, got)
+			}
+		}
+	})
+}
+
+func FuzzBytePairMerge(f *testing.F) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{"", "aaaaaaaa", "internationalization", "aB3+x9Qz aB3+x9Qz", "汉字汉字"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, piece []byte) {
+		want := bytePairMergeScan(nil, piece, enc.bpe.encoder, nil)
+		got := bytePairMergeHeap(nil, piece, enc.bpe.encoder, nil)
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("%q: scan merged into %v, heap into %v", piece, want, got)
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	encodings := []*Tiktoken{GetTestEncoding()}
+	if enc, err := GetEncoding(MODEL_QWEN_BASE); err == nil {
+		encodings = append(encodings, enc)
+	}
+	for _, seed := range []string{"", "hello world!你好，世界！", "<|endoftext|>x", "\xff\xfe", "a\xed\xa0\x80b", "\xef\xbf", "👨‍👩‍👧"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		for _, enc := range encodings {
+			err := enc.ValidateRoundTrip(text)
+			if utf8.ValidString(text) {
+				if err != nil {
+					t.Fatalf("%s: %v", enc.Name(), err)
+				}
+				continue
+			}
+			var rt *RoundTripError
+			if !errors.As(err, &rt) || !rt.Invalid {
+				t.Fatalf("%s: invalid UTF-8 %q: %v", enc.Name(), text, err)
+			}
+		}
+	})
+}
@@ -5,7 +5,9 @@ go 1.19
 require (
 	github.com/dlclark/regexp2 v1.10.0
 	github.com/google/uuid v1.3.0
+	github.com/rivo/uniseg v0.4.7
 	github.com/stretchr/testify v1.8.2
+	golang.org/x/text v0.14.0
 )
 
 require (
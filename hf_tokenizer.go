@@ -0,0 +1,252 @@
+package tiktoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// hfTokenizer is the part of a HuggingFace tokenizer.json that a byte-level
+// BPE encoder is made of.
+type hfTokenizer struct {
+	AddedTokens []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	} `json:"added_tokens"`
+	Normalizer   *hfComponent `json:"normalizer"`
+	PreTokenizer *hfComponent `json:"pre_tokenizer"`
+	Model        struct {
+		Type         string            `json:"type"`
+		Vocab        map[string]int    `json:"vocab"`
+		Merges       []json.RawMessage `json:"merges"`
+		ByteFallback bool              `json:"byte_fallback"`
+	} `json:"model"`
+}
+
+// hfComponent is a normalizer or pre-tokenizer of a tokenizer.json.
+type hfComponent struct {
+	Type    string `json:"type"`
+	Pattern *struct {
+		Regex *string `json:"Regex"`
+	} `json:"pattern"`
+	Behavior       string        `json:"behavior"`
+	Invert         bool          `json:"invert"`
+	AddPrefixSpace bool          `json:"add_prefix_space"`
+	UseRegex       *bool         `json:"use_regex"`
+	Pretokenizers  []hfComponent `json:"pretokenizers"`
+}
+
+// hfNormForms are the normalizers that WithNormalization can apply.
+var hfNormForms = map[string]norm.Form{"NFC": norm.NFC, "NFD": norm.NFD, "NFKC": norm.NFKC, "NFKD": norm.NFKD}
+
+// ParseHuggingFaceTokenizerJSON converts the tokenizer.json of a
+// HuggingFace byte-level BPE tokenizer, as used by Llama 3, Qwen2 and
+// GPT-2 derived models, into an encoding named name.
+//
+// The vocabulary ids become the ranks, so the merges must follow the ids:
+// each merge makes a token with an id no lower than the merges before it,
+// several merges making the same token being fine, and every token of more
+// than one byte is made by a merge. Tokenizers
+// converted from tiktoken and those trained by the tokenizers library
+// satisfy this; others fail with an error rather than tokenizing
+// differently. The pre-tokenizer may be a ByteLevel one, with its GPT-2
+// pattern, or a single regex Split followed by a ByteLevel one without
+// regex. A NFC, NFD, NFKC or NFKD normalizer is applied with
+// WithNormalization. Added tokens become special tokens, and templates of
+// the post-processor, such as a BOS token, are not applied.
+func ParseHuggingFaceTokenizerJSON(name string, data []byte) (*Tiktoken, error) {
+	return parseHuggingFaceTokenizerJSON(name, "", data)
+}
+
+func parseHuggingFaceTokenizerJSON(name, source string, data []byte) (*Tiktoken, error) {
+	var hf hfTokenizer
+	if err := json.Unmarshal(data, &hf); err != nil {
+		return nil, fmt.Errorf("tokenizer.json: %w", err)
+	}
+	if hf.Model.Type != "BPE" {
+		return nil, fmt.Errorf("tokenizer.json: model %q is not BPE", hf.Model.Type)
+	}
+	if hf.Model.ByteFallback {
+		return nil, fmt.Errorf("tokenizer.json: byte fallback BPE is not byte-level BPE")
+	}
+	pattern, err := hf.pattern()
+	if err != nil {
+		return nil, err
+	}
+	var opts []EncodeOption
+	if hf.Normalizer != nil {
+		form, ok := hfNormForms[hf.Normalizer.Type]
+		if !ok {
+			return nil, fmt.Errorf("tokenizer.json: normalizer %q is not supported", hf.Normalizer.Type)
+		}
+		opts = append(opts, WithNormalization(form))
+	}
+	ranks, err := hf.ranks()
+	if err != nil {
+		return nil, err
+	}
+
+	specials := make(map[string]int, len(hf.AddedTokens))
+	for _, added := range hf.AddedTokens {
+		specials[added.Content] = added.ID
+	}
+	tables, err := newRankTables(ranks)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := newEncoding(name, source, pattern, tables, specials)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := newTiktokenFromEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts) > 0 {
+		tk = tk.WithOptions(opts...)
+	}
+	return tk, nil
+}
+
+// LoadFromHuggingFaceTokenizerJSON reads a tokenizer.json, a local path or
+// URL, and converts it with ParseHuggingFaceTokenizerJSON into an encoding
+// named after the path. The file is read and cached like LoadDataGymBpe
+// reads its files.
+func LoadFromHuggingFaceTokenizerJSON(path string) (*Tiktoken, error) {
+	loader, ok := currentBpeLoader().(*defaultBpeLoader)
+	if !ok {
+		loader = NewDefaultBpeLoader().(*defaultBpeLoader)
+	}
+	data, err := loader.readFileCached(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := parseHuggingFaceTokenizerJSON(path, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tk, nil
+}
+
+// pattern returns the split pattern of the pre-tokenizer.
+func (hf *hfTokenizer) pattern() (string, error) {
+	if hf.PreTokenizer == nil {
+		return "", fmt.Errorf("tokenizer.json: no pre-tokenizer, so not byte-level BPE")
+	}
+	steps := []hfComponent{*hf.PreTokenizer}
+	if hf.PreTokenizer.Type == "Sequence" {
+		steps = hf.PreTokenizer.Pretokenizers
+	}
+	pattern, byteLevel := "", false
+	for i, step := range steps {
+		switch {
+		case step.Type == "Split" && pattern == "" && !byteLevel:
+			if step.Pattern == nil || step.Pattern.Regex == nil {
+				return "", fmt.Errorf("tokenizer.json: only Split pre-tokenizers with a Regex are supported")
+			}
+			if step.Behavior != "Isolated" || step.Invert {
+				return "", fmt.Errorf("tokenizer.json: Split behavior %s is not supported", step.Behavior)
+			}
+			pattern = *step.Pattern.Regex
+		case step.Type == "ByteLevel" && !byteLevel:
+			if step.AddPrefixSpace {
+				return "", fmt.Errorf("tokenizer.json: ByteLevel add_prefix_space is not supported")
+			}
+			if step.UseRegex == nil || *step.UseRegex {
+				if pattern != "" {
+					return "", fmt.Errorf("tokenizer.json: a Split followed by a ByteLevel regex is not supported")
+				}
+				// the pattern of GPT-2
+				pattern = p50kPattern
+			}
+			byteLevel = true
+		default:
+			return "", fmt.Errorf("tokenizer.json: pre-tokenizer %s at position %d is not supported", step.Type, i)
+		}
+	}
+	switch {
+	case !byteLevel:
+		return "", fmt.Errorf("tokenizer.json: no ByteLevel pre-tokenizer, so not byte-level BPE")
+	case pattern == "":
+		return "", fmt.Errorf("tokenizer.json: no pattern to split text with")
+	}
+	return pattern, nil
+}
+
+// ranks decodes the byte-level vocabulary without the added tokens and
+// checks that the merges follow its ids.
+func (hf *hfTokenizer) ranks() (map[string]int, error) {
+	decode, _ := dataGymBytes()
+	decodeToken := func(s string) (string, bool) {
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			c, ok := decode[r]
+			if !ok {
+				return "", false
+			}
+			b = append(b, c)
+		}
+		return string(b), true
+	}
+
+	added := make(map[string]bool, len(hf.AddedTokens))
+	for _, token := range hf.AddedTokens {
+		added[token.Content] = true
+	}
+	ranks := make(map[string]int, len(hf.Model.Vocab))
+	for key, id := range hf.Model.Vocab {
+		if added[key] {
+			continue
+		}
+		token, ok := decodeToken(key)
+		if !ok {
+			return nil, fmt.Errorf("tokenizer.json: token %q is not in the byte-level encoding", key)
+		}
+		ranks[token] = id
+	}
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("tokenizer.json: the vocabulary lacks the byte 0x%02x", b)
+		}
+	}
+
+	merged := make(map[string]bool, len(hf.Model.Merges))
+	last := -1
+	for i, raw := range hf.Model.Merges {
+		var pair []string
+		var joined string
+		if err := json.Unmarshal(raw, &joined); err == nil {
+			pair = strings.Split(joined, " ")
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return nil, fmt.Errorf("tokenizer.json: merge %d: %w", i, err)
+		}
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("tokenizer.json: merge %d: want two parts, got %d", i, len(pair))
+		}
+		first, ok1 := decodeToken(pair[0])
+		second, ok2 := decodeToken(pair[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("tokenizer.json: merge %d is not in the byte-level encoding", i)
+		}
+		id, ok := ranks[first+second]
+		if !ok {
+			return nil, fmt.Errorf("tokenizer.json: merge %d makes %q, which is not in the vocabulary", i, first+second)
+		}
+		// TikTokenConverter writes a merge for every pair making a token,
+		// so an id may repeat but never go back
+		if id < last {
+			return nil, fmt.Errorf("tokenizer.json: merge %d makes %q of id %d after id %d, so the merges don't follow the ids", i, first+second, id, last)
+		}
+		last = id
+		merged[first+second] = true
+	}
+	for token := range ranks {
+		if len(token) > 1 && !merged[token] {
+			return nil, fmt.Errorf("tokenizer.json: token %q is not made by any merge", token)
+		}
+	}
+	return ranks, nil
+}
@@ -0,0 +1,115 @@
+package tiktoken
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hfTokenizerJSON returns a tokenizer.json with the vocabulary of
+// dataGymMerges, the merges given as strings or, if pairs, as arrays.
+func hfTokenizerJSON(t *testing.T, preTokenizer, normalizer any, pairs bool) []byte {
+	var vocab map[string]int
+	if err := json.Unmarshal(dataGymEncoder(t, map[string]int{"<|endoftext|>": 262}), &vocab); err != nil {
+		t.Fatal(err)
+	}
+	var merges []any
+	for _, line := range strings.Split(dataGymMerges, "\n")[1:] {
+		if line == "" {
+			continue
+		}
+		if pairs {
+			merges = append(merges, strings.Fields(line))
+		} else {
+			merges = append(merges, line)
+		}
+	}
+	data, err := json.Marshal(map[string]any{
+		"added_tokens":  []any{map[string]any{"id": 262, "content": "<|endoftext|>", "special": true}},
+		"normalizer":    normalizer,
+		"pre_tokenizer": preTokenizer,
+		"model":         map[string]any{"type": "BPE", "vocab": vocab, "merges": merges},
+		"decoder":       map[string]any{"type": "ByteLevel"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseHuggingFaceTokenizerJSON(t *testing.T) {
+	ass := assert.New(t)
+	byteLevel := map[string]any{"type": "ByteLevel", "add_prefix_space": false}
+	tk, err := ParseHuggingFaceTokenizerJSON("hf_test", hfTokenizerJSON(t, byteLevel, nil, false))
+	ass.Nil(err)
+	ass.Equal("hf_test", tk.Name())
+	// the same tokens as the data gym files of the vocabulary
+	ass.Equal([]int{258, 78, 260, 81, 75, 67, 261, 262}, tk.Encode("hello world\n\n<|endoftext|>", []string{"all"}, nil))
+	ass.Equal(map[string]int{"<|endoftext|>": 262}, tk.SpecialTokens())
+
+	// Llama 3 and Qwen2 split with their own pattern
+	split := map[string]any{"type": "Sequence", "pretokenizers": []any{
+		map[string]any{"type": "Split", "pattern": map[string]any{"Regex": cl100kPattern}, "behavior": "Isolated", "invert": false},
+		map[string]any{"type": "ByteLevel", "add_prefix_space": false, "use_regex": false},
+	}}
+	tk, err = ParseHuggingFaceTokenizerJSON("hf_test", hfTokenizerJSON(t, split, map[string]any{"type": "NFC"}, true))
+	ass.Nil(err)
+	ass.Equal(cl100kPattern, tk.pbeEncoding.PatStr)
+	ass.Equal(tk.Encode("hé", nil, nil), tk.Encode("hé", nil, nil), "the NFC normalizer is applied")
+
+	for _, c := range []struct {
+		preTokenizer, normalizer any
+		err                      string
+	}{
+		{nil, nil, "no pre-tokenizer"},
+		{map[string]any{"type": "Metaspace"}, nil, "pre-tokenizer Metaspace at position 0 is not supported"},
+		{map[string]any{"type": "ByteLevel", "add_prefix_space": true}, nil, "add_prefix_space is not supported"},
+		{map[string]any{"type": "Split", "pattern": map[string]any{"Regex": `\w+`}, "behavior": "Isolated"}, nil, "no ByteLevel pre-tokenizer"},
+		{byteLevel, map[string]any{"type": "Lowercase"}, `normalizer "Lowercase" is not supported`},
+	} {
+		_, err = ParseHuggingFaceTokenizerJSON("hf_test", hfTokenizerJSON(t, c.preTokenizer, c.normalizer, false))
+		ass.ErrorContains(err, c.err)
+	}
+
+	swapped := strings.Replace(string(hfTokenizerJSON(t, byteLevel, nil, false)), `"he ll","Ġ w"`, `"Ġ w","he ll"`, 1)
+	_, err = ParseHuggingFaceTokenizerJSON("hf_test", []byte(swapped))
+	ass.ErrorContains(err, "so the merges don't follow the ids")
+
+	// converted tiktoken vocabularies such as Llama 3 make a token with
+	// every pair of its parts
+	var repeated map[string]any
+	ass.Nil(json.Unmarshal(hfTokenizerJSON(t, byteLevel, nil, false), &repeated))
+	model := repeated["model"].(map[string]any)
+	vocab := model["vocab"].(map[string]any)
+	vocab["ab"], vocab["bc"], vocab["abc"] = 263, 264, 265
+	model["merges"] = append(model["merges"].([]any), "a b", "b c", "ab c", "a bc")
+	data, err := json.Marshal(repeated)
+	ass.Nil(err)
+	tk, err = ParseHuggingFaceTokenizerJSON("hf_test", data)
+	ass.Nil(err)
+	ass.Equal([]int{265}, tk.EncodeOrdinary("abc"))
+
+	unmerged := strings.Replace(string(hfTokenizerJSON(t, byteLevel, nil, false)), `,"Ċ Ċ"`, ``, 1)
+	_, err = ParseHuggingFaceTokenizerJSON("hf_test", []byte(unmerged))
+	ass.EqualError(err, `tokenizer.json: token "\n\n" is not made by any merge`)
+	_, err = ParseHuggingFaceTokenizerJSON("hf_test", []byte(`{"model": {"type": "Unigram"}}`))
+	ass.EqualError(err, `tokenizer.json: model "Unigram" is not BPE`)
+}
+
+func TestLoadFromHuggingFaceTokenizerJSON(t *testing.T) {
+	ass := assert.New(t)
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	ass.Nil(os.WriteFile(path, hfTokenizerJSON(t, map[string]any{"type": "ByteLevel"}, nil, false), 0o644))
+	tk, err := LoadFromHuggingFaceTokenizerJSON(path)
+	ass.Nil(err)
+	ass.Equal(path, tk.Name())
+	ass.Equal(path, tk.SourceURI())
+	ass.Equal([]int{258, 78}, tk.EncodeOrdinary("hello"))
+
+	_, err = LoadFromHuggingFaceTokenizerJSON(filepath.Join(t.TempDir(), "missing.json"))
+	ass.Error(err)
+}
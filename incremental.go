@@ -0,0 +1,88 @@
+package tiktoken
+
+import "strings"
+
+// IncrementalEncoder holds the tokens of a growing text, e.g. a chat prompt
+// being typed, so that appending to the text only encodes the new text and
+// the last few pieces before it again instead of all of it. The tokens are
+// those of EncodeOrdinary for the whole text. Input options of the
+// Tiktoken apply to each appended text on its own, so WithNormalization
+// doesn't combine a mark with a character appended before it. An
+// IncrementalEncoder is not safe for concurrent use.
+type IncrementalEncoder struct {
+	t *Tiktoken
+	// tokens are those of the whole text; the first settled of them belong
+	// to pieces that no appended text can change.
+	tokens  []int
+	settled int
+	// tail is the text after the settled pieces, split again on Append.
+	tail    string
+	started bool
+}
+
+// NewIncrementalEncoder returns an IncrementalEncoder for an empty text.
+func (t *Tiktoken) NewIncrementalEncoder() *IncrementalEncoder {
+	return &IncrementalEncoder{t: t}
+}
+
+// Append appends suffix to the text and returns the tokens from the first
+// one that changed on: they replace the tokens from index
+// e.Len()-len(newTokens) on that the text had before, which stay as they
+// were. Usually only the last token or two before suffix change, if any.
+// It panics with ErrClosed if the encoding was closed.
+func (e *IncrementalEncoder) Append(suffix string) (newTokens []int) {
+	t := e.t
+	t.bpe.mustOpen()
+	start := metricsStart()
+	if !e.started {
+		suffix = t.prepareText(suffix)
+		e.started = len(suffix) > 0
+	} else if len(suffix) > 0 && t.opts.normalize {
+		suffix = t.opts.normForm.String(suffix)
+	}
+	text := e.tail + suffix
+	old := e.tokens[e.settled:]
+	tokens := make([]int, 0, len(old)+len(suffix)/2)
+
+	// like streamEncoder, the last piece and those ending in the last
+	// runes may still change with more text
+	cutoff := cutRunesFromEnd(text, streamMargin)
+	settled, consumed, last := 0, 0, -1
+	t.bpe.forEachSegment(text, nil, func(piece string, start, end int) {
+		if last >= 0 && last <= cutoff {
+			settled, consumed = len(tokens), last
+		}
+		tokens = append(tokens, t.filterTokens(t.bpe.appendPiece(nil, piece))...)
+		last = end
+	}, nil)
+
+	changed := 0
+	for changed < len(old) && changed < len(tokens) && old[changed] == tokens[changed] {
+		changed++
+	}
+	newTokens = tokens[changed:]
+	e.tokens = append(e.tokens[:e.settled+changed], newTokens...)
+	e.settled += settled
+	e.tail = strings.Clone(text[consumed:])
+	t.record(start, len(newTokens), len(suffix))
+	return newTokens
+}
+
+// Tokens returns the tokens of the text so far. The slice is shared with
+// e until the next Append.
+func (e *IncrementalEncoder) Tokens() []int {
+	return e.tokens
+}
+
+// Len returns the number of tokens of the text so far.
+func (e *IncrementalEncoder) Len() int {
+	return len(e.tokens)
+}
+
+// Reset empties the text, keeping the buffers.
+func (e *IncrementalEncoder) Reset() {
+	e.tokens = e.tokens[:0]
+	e.settled = 0
+	e.tail = ""
+	e.started = false
+}
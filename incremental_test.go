@@ -0,0 +1,71 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrementalEncoder(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	e := enc.NewIncrementalEncoder()
+	ass.Equal([]int{14990}, e.Append("hello"))
+	ass.Equal([]int{1879}, e.Append(" world"))
+	ass.Equal(2, e.Len())
+
+	r := rand.New(rand.NewSource(1))
+	for _, text := range []string{parallelText(8 << 10), randomUnicode(r, 2000), "don't" + strings.Repeat(" ", 100) + "x\xe4\xbd\xa0\xe5\xa5\xbd"} {
+		e.Reset()
+		var mirror []int
+		for at := 0; at < len(text); {
+			// chunks of one keystroke up to a pasted paragraph, cutting runes
+			n := 1 + r.Intn(40)
+			if at+n > len(text) {
+				n = len(text) - at
+			}
+			before := e.Len()
+			newTokens := e.Append(text[at : at+n])
+			at += n
+			kept := e.Len() - len(newTokens)
+			ass.LessOrEqual(kept, before)
+			mirror = append(mirror[:kept], newTokens...)
+			ass.Equal(enc.EncodeOrdinary(text[:at]), e.Tokens(), "%q", text[:at])
+		}
+		ass.Equal(e.Tokens(), mirror)
+	}
+
+	stripped := enc.WithOptions(WithStripBOM(true)).NewIncrementalEncoder()
+	stripped.Append("")
+	stripped.Append("\uFEFFhello")
+	stripped.Append("\uFEFF")
+	ass.Equal(enc.EncodeOrdinary("hello\uFEFF"), stripped.Tokens(), "only a leading BOM is stripped")
+}
+
+func BenchmarkIncrementalEncoder(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	history := parallelText(120 << 10)
+	typed := "the quick brown fox jumps over the lazy dog. "
+	b.Run("append", func(b *testing.B) {
+		e := enc.NewIncrementalEncoder()
+		e.Append(history)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			e.Append(typed[i%len(typed) : i%len(typed)+1])
+		}
+	})
+	b.Run("reencode", func(b *testing.B) {
+		text := history
+		for i := 0; i < b.N; i++ {
+			text += typed[i%len(typed) : i%len(typed)+1]
+			enc.CountTokens(text)
+		}
+	})
+}
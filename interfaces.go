@@ -0,0 +1,26 @@
+package tiktoken
+
+// Encoder is the encoding side of a *Tiktoken. Code that only needs token
+// counts or ids should accept an Encoder so tests can inject a fake.
+type Encoder interface {
+	Encode(text string, allowedSpecial []string, disallowedSpecial []string) []int
+	CountTokens(text string) int
+}
+
+// Decoder is the decoding side of a *Tiktoken.
+type Decoder interface {
+	Decode(tokens []int) string
+}
+
+// Codec encodes and decodes, as the truncation and chunking functions need
+// to find where tokens start in a text.
+type Codec interface {
+	Encoder
+	Decoder
+}
+
+var (
+	_ Encoder = (*Tiktoken)(nil)
+	_ Decoder = (*Tiktoken)(nil)
+	_ Codec   = (*Tiktoken)(nil)
+)
@@ -0,0 +1,90 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ParseLimits bounds the memory spent on a rank file, so that files from
+// untrusted sources can't exhaust it. Zero fields take the value from
+// DefaultParseLimits.
+type ParseLimits struct {
+	// MaxFileBytes bounds the size of the file.
+	MaxFileBytes int64
+	// MaxTokenBytes bounds the decoded length of a single token.
+	MaxTokenBytes int
+	// MaxEntries bounds the number of ranks.
+	MaxEntries int
+}
+
+// DefaultParseLimits are used by the loaders unless changed with
+// WithParseLimits. They admit the published encodings many times over:
+// the largest rank files are a few MB with some 200k tokens, none longer
+// than a few hundred bytes.
+var DefaultParseLimits = ParseLimits{
+	MaxFileBytes:  64 << 20,
+	MaxTokenBytes: 4 << 10,
+	MaxEntries:    4 << 20,
+}
+
+// Rank files violating ParseLimits fail with these errors, wrapped with
+// the limit that was exceeded.
+var (
+	ErrFileTooLarge = errors.New("tiktoken: rank file too large")
+	ErrTokenTooLong = errors.New("tiktoken: token in rank file too long")
+	ErrTooManyRanks = errors.New("tiktoken: too many ranks in rank file")
+)
+
+// WithParseLimits makes the loader reject rank files exceeding limits
+// before reading or decoding more than the limits allow.
+func WithParseLimits(limits ParseLimits) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.limits = limits.withDefaults()
+	}
+}
+
+func (p ParseLimits) withDefaults() ParseLimits {
+	if p.MaxFileBytes <= 0 {
+		p.MaxFileBytes = DefaultParseLimits.MaxFileBytes
+	}
+	if p.MaxTokenBytes <= 0 {
+		p.MaxTokenBytes = DefaultParseLimits.MaxTokenBytes
+	}
+	if p.MaxEntries <= 0 {
+		p.MaxEntries = DefaultParseLimits.MaxEntries
+	}
+	return p
+}
+
+// ParseRankFile reads a rank file of "<base64 token> <rank>" lines from r
+// within limits. It stops reading once r holds more than
+// limits.MaxFileBytes.
+func ParseRankFile(r io.Reader, limits ParseLimits) (map[string]int, error) {
+	limits = limits.withDefaults()
+	contents, err := readAllLimited(r, limits.MaxFileBytes)
+	if err != nil {
+		return nil, err
+	}
+	return parseTiktokenBpeLimits(contents, limits)
+}
+
+// readAllLimited reads r to the end unless it holds more than max bytes.
+func readAllLimited(r io.Reader, max int64) ([]byte, error) {
+	contents, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFileSize(int64(len(contents)), max); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+func checkFileSize(size, max int64) error {
+	if size > max {
+		return fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, max)
+	}
+	return nil
+}
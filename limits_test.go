@@ -0,0 +1,110 @@
+package tiktoken
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// endlessReader repeats line forever.
+type endlessReader struct {
+	line []byte
+	off  int
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.line[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.line)
+	}
+	return n, nil
+}
+
+// allocated returns the bytes f allocates.
+func allocated(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestParseLimits(t *testing.T) {
+	ass := assert.New(t)
+	limits := ParseLimits{MaxFileBytes: 1 << 20, MaxTokenBytes: 256, MaxEntries: 1000}
+
+	var err error
+	n := allocated(func() {
+		_, err = ParseRankFile(&endlessReader{line: []byte("YQ== 0\n")}, limits)
+	})
+	ass.ErrorIs(err, ErrFileTooLarge)
+	ass.Less(n, uint64(8<<20), "reading stops at the limit")
+
+	// a single token of 384 KB
+	huge := []byte(strings.Repeat("QUFB", 128<<10) + " 0\n")
+	n = allocated(func() {
+		_, err = parseTiktokenBpeLimits(huge, limits.withDefaults())
+	})
+	ass.ErrorIs(err, ErrTokenTooLong)
+	ass.ErrorContains(err, "line 1")
+	ass.Less(n, uint64(len(huge)), "the token is not decoded")
+	_, err = ParseRankFile(strings.NewReader(strings.Repeat("QUFB", 86)+" 0\n"), limits)
+	ass.ErrorIs(err, ErrTokenTooLong, "258 bytes")
+	_, err = ParseRankFile(strings.NewReader(strings.Repeat("QUFB", 85)+"QQ== 0\n"), limits)
+	ass.Nil(err, "256 bytes")
+
+	var many bytes.Buffer
+	for i := 0; i <= 1000; i++ {
+		many.WriteString("YQ== 0\n")
+	}
+	_, err = ParseRankFile(&many, limits)
+	ass.ErrorIs(err, ErrTooManyRanks)
+	// the count holds across shards too
+	many.Reset()
+	for i := 0; i < 80000; i++ {
+		many.WriteString("YQ== 0\n")
+	}
+	_, err = parseTiktokenBpeShards(many.Bytes(), 2, ParseLimits{MaxEntries: 50000}.withDefaults())
+	ass.ErrorIs(err, ErrTooManyRanks)
+
+	ranks, err := ParseRankFile(strings.NewReader("YQ== 0\nYg== 1\n"), ParseLimits{})
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+}
+
+func TestLoaderParseLimits(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, io.LimitReader(&endlessReader{line: []byte("YQ== 0\n")}, 64<<20))
+	}))
+	defer srv.Close()
+	uri := srv.URL + "/huge.tiktoken"
+	loader := NewDefaultBpeLoader(WithParseLimits(ParseLimits{MaxFileBytes: 1 << 20}))
+
+	_, err := loader.LoadTiktokenBpe(uri)
+	ass.ErrorIs(err, ErrFileTooLarge)
+	files, _ := os.ReadDir(os.Getenv("TIKTOKEN_CACHE_DIR"))
+	ass.Empty(files, "nothing of the download is kept")
+
+	path := t.TempDir() + "/huge.tiktoken"
+	ass.Nil(os.WriteFile(path, bytes.Repeat([]byte("YQ== 0\n"), 200<<10), 0o644))
+	_, err = loader.LoadTiktokenBpe(path)
+	ass.ErrorIs(err, ErrFileTooLarge)
+	_, err = NewDefaultBpeLoader().LoadTiktokenBpe(path)
+	ass.Nil(err, "the default limits admit it")
+
+	// an entry cached by a loader with larger limits is not read
+	_, err = loader.LoadTiktokenBpe(path)
+	ass.ErrorIs(err, ErrFileTooLarge)
+}
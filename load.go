@@ -1,17 +1,23 @@
 package tiktoken
 
 import (
-	"crypto/sha1"
+	"bytes"
+	"context"
 	"embed"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -21,121 +27,682 @@ type BpeLoader interface {
 	LoadTiktokenBpeFromFS(fs embed.FS, path string) (map[string]int, error)
 }
 
-func readFile(blobpath string) ([]byte, error) {
-	if !strings.HasPrefix(blobpath, "http://") && !strings.HasPrefix(blobpath, "https://") {
-		file, err := os.Open(blobpath)
-		if err != nil {
-			return nil, err
+// BpeLoaderWithContext is implemented by loaders that can stop loading a
+// rank file when ctx is done, such as the loaders of NewDefaultBpeLoader and
+// NewFSBpeLoader. Their LoadTiktokenBpe uses context.Background().
+type BpeLoaderWithContext interface {
+	BpeLoader
+	LoadTiktokenBpeContext(ctx context.Context, tiktokenBpeFile string) (map[string]int, error)
+}
+
+// Fetcher retrieves the raw contents of a rank file. Fetchers are registered
+// per URI scheme with WithFetcher, so rank files can live in object stores or
+// secret managers that plain http(s) can't reach.
+type Fetcher interface {
+	Fetch(ctx context.Context, uri string) ([]byte, error)
+}
+
+// FetcherFunc adapts an ordinary function to the Fetcher interface.
+type FetcherFunc func(ctx context.Context, uri string) ([]byte, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	return f(ctx, uri)
+}
+
+// fileFetcher reads local files of at most maxBytes.
+type fileFetcher struct {
+	maxBytes int64
+}
+
+func (f fileFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
+	file, err := os.Open(strings.TrimPrefix(uri, "file://"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readAllLimited(file, f.maxBytes)
+}
+
+// ErrOfflineMode is returned when a rank file would have to be downloaded
+// while offline mode is enabled. The wrapping error names the URL and the
+// cache path that was checked, so the file can be pre-seeded there.
+var ErrOfflineMode = errors.New("tiktoken: offline mode forbids downloading")
+
+// ErrRankCount is returned when a rank file doesn't hold the expected
+// number of ranks, or they are not numbered consecutively, e.g. because a
+// download was cut short. The cached copy of the file is dropped, so a
+// retry downloads it again.
+var ErrRankCount = errors.New("tiktoken: unexpected ranks in rank file")
+
+// checkRankCount verifies that ranks holds expected ranks numbered 0 to
+// expected-1, skipping the ids in gaps, which some files leave to special
+// tokens. If not, the cache entry of uri is dropped when loader supports
+// that. An expected count of 0 skips the check.
+func checkRankCount(loader BpeLoader, uri string, ranks map[string]int, expected int, gaps ...int) (map[string]int, error) {
+	if expected <= 0 {
+		return ranks, nil
+	}
+	var problem string
+	if len(ranks) != expected {
+		problem = fmt.Sprintf("%d ranks, expected %d", len(ranks), expected)
+	} else {
+		seen := make([]bool, expected+len(gaps))
+		for _, gap := range gaps {
+			seen[gap] = true
 		}
-		defer file.Close()
-		return ioutil.ReadAll(file)
+		for _, rank := range ranks {
+			if rank < 0 || rank >= len(seen) || seen[rank] {
+				problem = fmt.Sprintf("rank %d out of range or repeated, expected ranks 0 to %d", rank, len(seen)-1)
+				if len(gaps) > 0 {
+					problem += fmt.Sprintf(" without %v", gaps)
+				}
+				break
+			}
+			seen[rank] = true
+		}
+	}
+	if problem == "" {
+		return ranks, nil
 	}
+	err := fmt.Errorf("%w %s: %s", ErrRankCount, uri, problem)
+	if inv, ok := loader.(CacheInvalidator); ok && uri != "" {
+		if invErr := inv.InvalidateCache(uri); invErr != nil {
+			return nil, fmt.Errorf("%w (dropping the cached copy failed: %v)", err, invErr)
+		}
+	}
+	return nil, err
+}
+
+// httpClient is swapped out in tests to observe network use.
+var httpClient = func() *http.Client { return http.DefaultClient }
+
+// httpFetcher downloads files of at most maxBytes with client, or
+// httpClient() if it is nil, from the mirrors of their URIs.
+type httpFetcher struct {
+	maxBytes  int64
+	userAgent string
+	client    *http.Client
+	mirrors   []mirror
+}
+
+func (f httpFetcher) Fetch(ctx context.Context, uri string) ([]byte, error) {
 	// avoiding blobfile for public files helps avoid auth issues, like MFA prompts
-	resp, err := http.Get(blobpath)
+	req, err := newGetRequest(ctx, mirrorURL(f.mirrors, uri), f.userAgent)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	return ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &DownloadError{URI: mirrorURL(f.mirrors, uri), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return readAllLimited(resp.Body, f.maxBytes)
 }
 
-func readFileCached(blobpath string) ([]byte, error) {
-	var cacheDir string
-	if os.Getenv("TIKTOKEN_CACHE_DIR") != "" {
-		cacheDir = os.Getenv("TIKTOKEN_CACHE_DIR")
-	} else if os.Getenv("DATA_GYM_CACHE_DIR") != "" {
-		cacheDir = os.Getenv("DATA_GYM_CACHE_DIR")
-	} else {
-		cacheDir = filepath.Join(os.TempDir(), "data-gym-cache")
+func (f httpFetcher) do(req *http.Request) (*http.Response, error) {
+	client := f.client
+	if client == nil {
+		client = httpClient()
 	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &DownloadError{URI: req.URL.String(), Err: err}
+	}
+	return resp, nil
+}
 
-	if cacheDir == "" {
-		// disable caching
-		return readFile(blobpath)
+// newGetRequest returns a GET request of uri identifying itself as
+// userAgent.
+func newGetRequest(ctx context.Context, uri, userAgent string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
+
+// uriScheme returns the lower-cased scheme of uri, or "" for plain paths.
+func uriScheme(uri string) string {
+	i := strings.Index(uri, "://")
+	if i <= 0 {
+		return ""
+	}
+	return strings.ToLower(uri[:i])
+}
+
+// offlineFromEnv reports whether TIKTOKEN_OFFLINE is set to a true value.
+func offlineFromEnv() bool {
+	offline, _ := strconv.ParseBool(os.Getenv("TIKTOKEN_OFFLINE"))
+	return offline
+}
+
+// isDownload reports whether blobpath is fetched by the built-in http(s)
+// downloader.
+func (l *defaultBpeLoader) isDownload(blobpath string) bool {
+	scheme := uriScheme(blobpath)
+	_, custom := l.fetchers[scheme]
+	return (scheme == "http" || scheme == "https") && !custom
+}
+
+// httpFetcher returns the built-in downloader configured for l.
+func (l *defaultBpeLoader) httpFetcher() httpFetcher {
+	return httpFetcher{l.limits.MaxFileBytes, l.userAgent, l.client, l.mirrors}
+}
+
+func (l *defaultBpeLoader) readFile(ctx context.Context, blobpath string) ([]byte, error) {
+	scheme := uriScheme(blobpath)
+	if (scheme == "http" || scheme == "https") && (l.offline || offlineFromEnv()) {
+		if _, ok := l.store.(diskCacheStore); !ok {
+			return nil, fmt.Errorf("%w %s (not in the cache store)", ErrOfflineMode, blobpath)
+		}
+		return nil, fmt.Errorf("%w %s (cache checked at %q)", ErrOfflineMode, blobpath, cachePath(blobpath))
+	}
+	if f, ok := l.fetchers[scheme]; ok {
+		contents, err := f.Fetch(ctx, blobpath)
+		if err == nil {
+			err = checkFileSize(int64(len(contents)), l.limits.MaxFileBytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return contents, nil
 	}
+	switch scheme {
+	case "http", "https":
+		return l.withRetries(ctx, func() ([]byte, error) {
+			return l.httpFetcher().Fetch(ctx, blobpath)
+		})
+	case "", "file":
+		return fileFetcher{l.limits.MaxFileBytes}.Fetch(ctx, blobpath)
+	default:
+		return nil, fmt.Errorf("no fetcher registered for scheme %q", scheme)
+	}
+}
+
+// CacheInvalidator is implemented by loaders that keep a disk cache of
+// downloaded rank files and can drop individual entries from it.
+type CacheInvalidator interface {
+	InvalidateCache(tiktokenBpeFile string) error
+}
 
-	cacheKey := fmt.Sprintf("%x", sha1.Sum([]byte(blobpath)))
+func (l *defaultBpeLoader) readFileCached(ctx context.Context, blobpath string) ([]byte, error) {
+	start := metricsStart()
+	contents, cached, err := l.readFileCachedFrom(ctx, blobpath)
+	recordRankFile(blobpath, cached, start, err)
+	return contents, err
+}
 
-	cachePath := filepath.Join(cacheDir, cacheKey)
-	if _, err := os.Stat(cachePath); err == nil {
-		return ioutil.ReadFile(cachePath)
+// readFileCachedFrom is readFileCached also reporting whether the contents
+// came from the cache.
+func (l *defaultBpeLoader) readFileCachedFrom(ctx context.Context, blobpath string) ([]byte, bool, error) {
+	if _, ok := l.store.(diskCacheStore); !ok {
+		return l.readStoreCached(ctx, blobpath)
+	}
+	cachePath := cachePath(blobpath)
+	if cachePath == "" {
+		// disable caching
+		contents, err := l.readFile(ctx, blobpath)
+		return contents, false, err
+	}
+	if contents, ok := cachedVocab(cachePath); ok {
+		if err := checkFileSize(int64(len(contents)), l.limits.MaxFileBytes); err != nil {
+			return nil, true, fmt.Errorf("%s: %w", cachePath, err)
+		}
+		return contents, true, nil
 	}
+	contents, cached, err := l.readDiskCached(ctx, blobpath, cachePath)
+	if err == nil {
+		for _, path := range append([]string{cachePath}, legacyCachePaths(blobpath)...) {
+			if _, err := os.Stat(path); err == nil {
+				keepVocab(cachePath, path, contents)
+				break
+			}
+		}
+	}
+	return contents, cached, err
+}
 
-	contents, err := readFile(blobpath)
+// readDiskCached reads the rank file blobpath through the disk cache entry
+// at cachePath, filling it if needed.
+func (l *defaultBpeLoader) readDiskCached(ctx context.Context, blobpath, cachePath string) ([]byte, bool, error) {
+	if contents, ok, err := l.lookupCache(blobpath, cachePath); ok {
+		return contents, true, err
+	}
+
+	os.MkdirAll(filepath.Dir(cachePath), cacheDirMode)
+	unlock, err := lockCacheEntry(ctx, cachePath)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	defer unlock()
+	// another goroutine or process may have filled it while this one waited
+	if contents, ok, err := l.lookupCache(blobpath, cachePath); ok {
+		return contents, true, err
 	}
 
-	os.MkdirAll(cacheDir, os.ModePerm)
 	tmpFilename := cachePath + "." + uuid.New().String() + ".tmp"
-	if err := ioutil.WriteFile(tmpFilename, contents, os.ModePerm); err != nil {
-		return nil, err
+	var contents []byte
+	if l.isDownload(blobpath) && !l.offline && !offlineFromEnv() {
+		// resumes an interrupted download and checks the known hash
+		contents, err = l.withRetries(ctx, func() ([]byte, error) {
+			return l.httpFetcher().downloadResumable(ctx, blobpath, cachePath, tmpFilename)
+		})
+	} else {
+		contents, err = l.readFile(ctx, blobpath)
+		if err == nil {
+			err = checkRankFileHash(blobpath, contents)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(tmpFilename, contents, cacheFileMode)
+		}
+	}
+	if err != nil {
+		if stale, ok := l.staleFallback(blobpath, cachePath, err); ok {
+			return stale, true, nil
+		}
+		return nil, false, err
 	}
-	return contents, os.Rename(tmpFilename, cachePath)
+	os.Remove(cachePath + staleSuffix)
+	// the sidecar only helps humans and CacheEntries, a failure is harmless
+	ioutil.WriteFile(cachePath+sourceSuffix, []byte(blobpath), cacheFileMode)
+	return contents, false, os.Rename(tmpFilename, cachePath)
 }
 
-func loadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
-	contents, err := readFileCached(tiktokenBpeFile)
+// lookupCache reads the cache entry of blobpath at cachePath or a legacy
+// location, and reports whether there was one. Corrupted entries are
+// removed and not reported.
+func (l *defaultBpeLoader) lookupCache(blobpath, cachePath string) ([]byte, bool, error) {
+	for _, path := range append([]string{cachePath}, legacyCachePaths(blobpath)...) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		contents, err := l.readCacheFile(path, fi)
+		if err == nil && checkRankFileHash(blobpath, contents) != nil {
+			// corrupted on disk, download it again
+			os.Remove(path)
+			continue
+		}
+		return contents, true, err
+	}
+	return nil, false, nil
+}
+
+// readCacheFile reads the cache entry at path unless it is larger than the
+// limit, which a cache dir shared with a loader allowing larger files may
+// hold.
+func (l *defaultBpeLoader) readCacheFile(path string, fi os.FileInfo) ([]byte, error) {
+	if err := checkFileSize(fi.Size(), l.limits.MaxFileBytes); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ioutil.ReadFile(path)
+}
+
+func (l *defaultBpeLoader) loadTiktokenBpe(ctx context.Context, tiktokenBpeFile string) (map[string]int, error) {
+	contents, err := l.readFileCached(ctx, tiktokenBpeFile)
 	if err != nil {
 		return nil, err
 	}
+	return parseTiktokenBpeLimits(contents, l.limits)
+}
 
-	bpeRanks := make(map[string]int)
-	for _, line := range strings.Split(string(contents), "\n") {
-		if line == "" {
+// minShardSize keeps small rank files from being split across goroutines.
+const minShardSize = 256 << 10
+
+func parseTiktokenBpe(contents []byte) (map[string]int, error) {
+	return parseTiktokenBpeLimits(contents, DefaultParseLimits)
+}
+
+func parseTiktokenBpeLimits(contents []byte, limits ParseLimits) (map[string]int, error) {
+	return parseTiktokenBpeShards(contents, runtime.GOMAXPROCS(0), limits)
+}
+
+// parseTiktokenBpeShards decodes up to n line-aligned parts of contents
+// concurrently and then fills the map in line order, so the result,
+// including which error is reported, is the same as for a serial parse.
+func parseTiktokenBpeShards(contents []byte, n int, limits ParseLimits) (map[string]int, error) {
+	if err := checkFileSize(int64(len(contents)), limits.MaxFileBytes); err != nil {
+		return nil, err
+	}
+	// files saved by some Windows editors start with a UTF-8 BOM
+	contents = bytes.TrimPrefix(contents, utf8BOM)
+	if limit := len(contents) / minShardSize; n > limit {
+		n = limit
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	type shard struct {
+		lines   []byte
+		entries []rankEntry
+		line    int
+		err     error
+	}
+	shards := make([]shard, 0, n)
+	for rest := contents; len(rest) > 0; {
+		end := len(contents) / n
+		if end >= len(rest) {
+			end = len(rest)
+		} else if i := bytes.IndexByte(rest[end:], '\n'); i >= 0 {
+			end += i + 1
+		} else {
+			end = len(rest)
+		}
+		shards = append(shards, shard{lines: rest[:end]})
+		rest = rest[end:]
+	}
+	if len(shards) == 1 {
+		shards[0].entries, shards[0].line, shards[0].err = parseRankLines(shards[0].lines, limits)
+	} else {
+		var wg sync.WaitGroup
+		for i := range shards {
+			wg.Add(1)
+			go func(s *shard) {
+				defer wg.Done()
+				s.entries, s.line, s.err = parseRankLines(s.lines, limits)
+			}(&shards[i])
+		}
+		wg.Wait()
+	}
+
+	size, firstLine := 0, 1
+	for _, s := range shards {
+		if s.err != nil {
+			return nil, fmt.Errorf("rank file line %d: %w", firstLine+s.line-1, s.err)
+		}
+		size += len(s.entries)
+		firstLine += bytes.Count(s.lines, []byte{'\n'})
+	}
+	if size > limits.MaxEntries {
+		return nil, fmt.Errorf("%w: more than %d", ErrTooManyRanks, limits.MaxEntries)
+	}
+	bpeRanks := make(map[string]int, size)
+	for _, s := range shards {
+		for _, e := range s.entries {
+			bpeRanks[e.token] = e.rank
+		}
+	}
+	return bpeRanks, nil
+}
+
+type rankEntry struct {
+	token string
+	rank  int
+}
+
+var errRankLine = errors.New(`expected "<base64 token> <rank>"`)
+
+// parseRankLines decodes the lines of a rank file. On error it returns the
+// 1-based number of the offending line within contents. It stops at more
+// than limits.MaxEntries entries and checks the length of every token
+// before decoding it.
+func parseRankLines(contents []byte, limits ParseLimits) ([]rankEntry, int, error) {
+	size := bytes.Count(contents, []byte{'\n'}) + 1
+	if size > limits.MaxEntries {
+		// blank lines don't count, so this is only a bound
+		size = limits.MaxEntries
+	}
+	entries := make([]rankEntry, 0, size)
+	maxEncoded := base64.StdEncoding.EncodedLen(limits.MaxTokenBytes)
+	for i := 1; len(contents) > 0; i++ {
+		line := contents
+		if end := bytes.IndexByte(contents, '\n'); end >= 0 {
+			line, contents = contents[:end], contents[end+1:]
+		} else {
+			contents = nil
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		if len(line) == 0 {
 			continue
 		}
-		parts := strings.Split(line, " ")
-		token, err := base64.StdEncoding.DecodeString(parts[0])
+		sep := bytes.IndexByte(line, ' ')
+		if sep < 0 || bytes.IndexByte(line[sep+1:], ' ') >= 0 {
+			return nil, i, errRankLine
+		}
+		if sep > maxEncoded {
+			return nil, i, fmt.Errorf("%w: more than %d bytes", ErrTokenTooLong, limits.MaxTokenBytes)
+		}
+		token := make([]byte, base64.StdEncoding.DecodedLen(sep))
+		n, err := base64.StdEncoding.Decode(token, line[:sep])
 		if err != nil {
-			return nil, err
+			return nil, i, err
 		}
-		rank, err := strconv.Atoi(parts[1])
+		if n > limits.MaxTokenBytes {
+			return nil, i, fmt.Errorf("%w: more than %d bytes", ErrTokenTooLong, limits.MaxTokenBytes)
+		}
+		rank, err := strconv.Atoi(string(line[sep+1:]))
 		if err != nil {
-			return nil, err
+			return nil, i, err
+		}
+		if len(entries) == limits.MaxEntries {
+			return nil, i, fmt.Errorf("%w: more than %d", ErrTooManyRanks, limits.MaxEntries)
 		}
-		bpeRanks[string(token)] = rank
+		entries = append(entries, rankEntry{string(token[:n]), rank})
 	}
-	return bpeRanks, nil
+	return entries, 0, nil
+}
+
+type defaultBpeLoader struct {
+	fetchers     map[string]Fetcher
+	offline      bool
+	staleIfError bool
+	onStale      func(uri string, err error)
+	onLoad       func(uri string, elapsed time.Duration, err error)
+	limits       ParseLimits
+	userAgent    string
+	client       *http.Client
+	mirrors      []mirror
+	retries      int
+	backoff      time.Duration
+	store        CacheStore
+	// refetching are the rank files to fetch again instead of reading them
+	// from store, see refetch.
+	mu         sync.Mutex
+	refetching map[string]bool
 }
 
-type defaultBpeLoader struct{}
+// LoaderOption configures the loader returned by NewDefaultBpeLoader.
+type LoaderOption func(*defaultBpeLoader)
+
+// WithFetcher routes rank files whose URI starts with "<scheme>://" through f.
+// Registering "http" or "https" replaces the built-in downloader. Fetched
+// bytes are cached the same way regardless of scheme.
+func WithFetcher(scheme string, f Fetcher) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.fetchers[strings.ToLower(strings.TrimSuffix(scheme, "://"))] = f
+	}
+}
+
+// WithOffline makes the loader refuse to download http(s) rank files with
+// ErrOfflineMode, the same as setting TIKTOKEN_OFFLINE=1. Cached entries,
+// local files and other fetchers keep working.
+func WithOffline() LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.offline = true
+	}
+}
+
+// WithUserAgent sets the User-Agent of the requests the loader downloads
+// rank files with, UserAgent() by default. Requests of fetchers registered
+// with WithFetcher are up to them.
+func WithUserAgent(ua string) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.userAgent = ua
+	}
+}
+
+// WithHTTPClient makes the loader download rank files with client instead
+// of http.DefaultClient, for a proxy, custom TLS settings, a timeout or a
+// retrying transport. Fetchers registered with WithFetcher are not
+// affected.
+func WithHTTPClient(client *http.Client) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.client = client
+	}
+}
+
+// WithLoadHandler makes the loader call f after each rank file it loaded or
+// failed to load, with the time spent reading and parsing it. Rank files are
+// loaded once per encoding build, so f observes the progress of GetEncoding
+// and Warmup. f may be called concurrently.
+func WithLoadHandler(f func(uri string, elapsed time.Duration, err error)) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.onLoad = f
+	}
+}
 
 func (l *defaultBpeLoader) LoadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
-	return loadTiktokenBpe(tiktokenBpeFile)
+	return l.LoadTiktokenBpeContext(context.Background(), tiktokenBpeFile)
+}
+
+// LoadTiktokenBpeContext is LoadTiktokenBpe giving up when ctx is done.
+// A download cut short this way is resumed later where the server allows
+// it, like one cut short by the network. Unless disabled with
+// WithStaleIfError, a deadline passing falls back to a stale cached copy
+// like other network errors do; a cancellation doesn't.
+func (l *defaultBpeLoader) LoadTiktokenBpeContext(ctx context.Context, tiktokenBpeFile string) (map[string]int, error) {
+	if l.onLoad == nil {
+		return l.loadTiktokenBpe(ctx, tiktokenBpeFile)
+	}
+	start := time.Now()
+	ranks, err := l.loadTiktokenBpe(ctx, tiktokenBpeFile)
+	l.onLoad(tiktokenBpeFile, time.Since(start), err)
+	return ranks, err
+}
+
+func (l *defaultBpeLoader) InvalidateCache(tiktokenBpeFile string) error {
+	if _, ok := l.store.(diskCacheStore); !ok {
+		l.refetch(tiktokenBpeFile, false)
+		return nil
+	}
+	return invalidateCache(tiktokenBpeFile)
 }
 
 func (l *defaultBpeLoader) LoadTiktokenBpeFromFS(fs embed.FS, path string) (map[string]int, error) {
+	if l.onLoad == nil {
+		return loadTiktokenBpeFromFS(fs, path)
+	}
+	start := time.Now()
+	ranks, err := loadTiktokenBpeFromFS(fs, path)
+	l.onLoad(path, time.Since(start), err)
+	return ranks, err
+}
+
+func loadTiktokenBpeFromFS(fsys fs.FS, path string) (map[string]int, error) {
 	// Use fs.Open to open the file from the embedded file system
-	file, err := fs.Open(path)
+	name := fsPath(path)
+	file, err := fsys.Open(name)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if dir, entries := nearestFSDir(fsys, name); entries != "" {
+				return nil, fmt.Errorf("%w (%s has %s)", err, dir, entries)
+			}
+		}
 		return nil, err
 	}
 	defer file.Close()
 
-	contents, err := io.ReadAll(file)
+	contents, err := readAllLimited(file, DefaultParseLimits.MaxFileBytes)
 	if err != nil {
 		return nil, err
 	}
-	bpeRanks := make(map[string]int)
-	for _, line := range strings.Split(string(contents), "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, " ")
-		token, err := base64.StdEncoding.DecodeString(parts[0])
-		if err != nil {
-			return nil, err
+	return parseTiktokenBpe(contents)
+}
+
+// fsPath turns name into an fs.FS path: slashes only, cleaned and without
+// a leading ./ or /, so Windows-style paths work with embed.FS.
+func fsPath(name string) string {
+	name = strings.TrimLeft(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// maxListedEntries is the number of directory entries the error of
+// loadTiktokenBpeFromFS lists.
+const maxListedEntries = 10
+
+// nearestFSDir finds the closest existing parent directory of name in fsys
+// and returns it with a list of its first entries, or an empty list if it
+// can't be read.
+func nearestFSDir(fsys fs.FS, name string) (string, string) {
+	dir := name
+	for {
+		dir = path.Dir(dir)
+		entries, err := fs.ReadDir(fsys, dir)
+		if err == nil {
+			names := make([]string, 0, maxListedEntries+1)
+			for i, e := range entries {
+				if i == maxListedEntries {
+					names = append(names, "...")
+					break
+				}
+				n := e.Name()
+				if e.IsDir() {
+					n += "/"
+				}
+				names = append(names, n)
+			}
+			if len(names) == 0 {
+				return dir, "no entries"
+			}
+			return dir, strings.Join(names, ", ")
 		}
-		rank, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return nil, err
+		if dir == "." || !errors.Is(err, fs.ErrNotExist) {
+			return dir, ""
 		}
-		bpeRanks[string(token)] = rank
 	}
-	return bpeRanks, nil
 }
 
-func NewDefaultBpeLoader() BpeLoader {
-	return &defaultBpeLoader{}
+func NewDefaultBpeLoader(opts ...LoaderOption) BpeLoader {
+	l := &defaultBpeLoader{fetchers: map[string]Fetcher{}, staleIfError: true, limits: DefaultParseLimits, userAgent: UserAgent(), store: defaultCacheStore()}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+type fsBpeLoader struct {
+	fsys  fs.FS
+	files map[string]string
+}
+
+// NewFSBpeLoader returns a loader that serves rank files from fsys and never
+// touches the network. files maps each rank file URI, as referenced by the
+// encoding definitions, to its path inside fsys. Other URIs fail with
+// ErrOfflineMode.
+func NewFSBpeLoader(fsys fs.FS, files map[string]string) BpeLoader {
+	return &fsBpeLoader{fsys: fsys, files: files}
+}
+
+func (l *fsBpeLoader) LoadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
+	return l.LoadTiktokenBpeContext(context.Background(), tiktokenBpeFile)
+}
+
+// LoadTiktokenBpeContext is LoadTiktokenBpe failing with ctx.Err() if ctx
+// is done; reading fsys itself isn't interrupted.
+func (l *fsBpeLoader) LoadTiktokenBpeContext(ctx context.Context, tiktokenBpeFile string) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, ok := l.files[tiktokenBpeFile]
+	if !ok {
+		return nil, fmt.Errorf("%w %s: it is not among the files of the loader", ErrOfflineMode, tiktokenBpeFile)
+	}
+	return loadTiktokenBpeFromFS(l.fsys, path)
+}
+
+var (
+	_ BpeLoaderWithContext = (*defaultBpeLoader)(nil)
+	_ BpeLoaderWithContext = (*fsBpeLoader)(nil)
+)
+
+func (l *fsBpeLoader) LoadTiktokenBpeFromFS(fs embed.FS, path string) (map[string]int, error) {
+	return loadTiktokenBpeFromFS(fs, path)
 }
@@ -0,0 +1,287 @@
+package tiktoken
+
+import (
+	"context"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRankFile(t *testing.T, path string, tokens ...string) {
+	content := ""
+	for i, token := range tokens {
+		content += base64.StdEncoding.EncodeToString([]byte(token)) + " " + strconv.Itoa(i) + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidateCache(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", filepath.Join(dir, "cache"))
+	rankFile := filepath.Join(dir, "test.tiktoken")
+	loader := NewDefaultBpeLoader()
+
+	writeRankFile(t, rankFile, "a", "b")
+	ranks, err := loader.LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+
+	// the cached copy wins until the entry is dropped
+	writeRankFile(t, rankFile, "a", "b", "c")
+	ranks, err = loader.LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	ass.Len(ranks, 2)
+
+	ass.Nil(loader.(CacheInvalidator).InvalidateCache(rankFile))
+	ranks, err = loader.LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1, "c": 2}, ranks)
+
+	// invalidating a missing entry is not an error
+	ass.Nil(loader.(CacheInvalidator).InvalidateCache(filepath.Join(dir, "missing")))
+}
+
+func TestLoaderFetcher(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+
+	calls := 0
+	fetcher := FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+		calls++
+		ass.Equal("mem://vocab/test.tiktoken", uri)
+		return []byte("YQ== 0\nYg== 1\n"), nil
+	})
+	loader := NewDefaultBpeLoader(WithFetcher("mem", fetcher))
+
+	for i := 0; i < 2; i++ {
+		ranks, err := loader.LoadTiktokenBpe("mem://vocab/test.tiktoken")
+		ass.Nil(err)
+		ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+	}
+	ass.Equal(1, calls, "fetched bytes should be served from the cache")
+
+	_, err := loader.LoadTiktokenBpe("s3://bucket/test.tiktoken")
+	ass.NotNil(err, "unregistered schemes should fail")
+}
+
+func TestExpectedRanks(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+
+	// the first download is cut short
+	files := []string{"YQ== 0\nYg== 1\n", "YQ== 0\nYg== 1\nYWI= 2\n"}
+	calls := 0
+	fetcher := FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+		calls++
+		return []byte(files[calls-1]), nil
+	})
+	loader := NewDefaultBpeLoader(WithFetcher("mem", fetcher))
+	newEncoding := func() (*Encoding, error) {
+		return newEncodingFromRankFile(loader, "test", "mem://vocab/test.tiktoken", `\w+`, nil, WithExpectedRanks(3))
+	}
+
+	_, err := newEncoding()
+	ass.ErrorIs(err, ErrRankCount)
+	ass.EqualError(err, "tiktoken: unexpected ranks in rank file mem://vocab/test.tiktoken: 2 ranks, expected 3")
+	enc, err := newEncoding()
+	ass.Nil(err)
+	ass.Len(enc.MergeableRanks, 3)
+	ass.Equal(2, calls, "the truncated file should not be served from the cache")
+
+	_, err = checkRankCount(loader, "gaps", map[string]int{"a": 0, "b": 2}, 2)
+	ass.EqualError(err, "tiktoken: unexpected ranks in rank file gaps: rank 2 out of range or repeated, expected ranks 0 to 1")
+	_, err = checkRankCount(loader, "repeated", map[string]int{"a": 1, "b": 1}, 2)
+	ass.ErrorIs(err, ErrRankCount)
+	// p50k_base leaves the id of <|endoftext|> free
+	_, err = checkRankCount(loader, "p50k", map[string]int{"a": 0, "b": 2}, 2, 1)
+	ass.Nil(err)
+	_, err = checkRankCount(loader, "p50k", map[string]int{"a": 0, "b": 1}, 2, 1)
+	ass.EqualError(err, "tiktoken: unexpected ranks in rank file p50k: rank 1 out of range or repeated, expected ranks 0 to 2 without [1]")
+}
+
+func TestFSBpeLoader(t *testing.T) {
+	ass := assert.New(t)
+	fsys := fstest.MapFS{"vendor/test.tiktoken": {Data: []byte("YQ== 0\nYg== 1\n")}}
+	loader := NewFSBpeLoader(fsys, map[string]string{"https://example.com/test.tiktoken": "vendor/test.tiktoken"})
+
+	ranks, err := loader.LoadTiktokenBpe("https://example.com/test.tiktoken")
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+
+	_, err = loader.LoadTiktokenBpe("https://example.com/other.tiktoken")
+	ass.NotNil(err)
+
+	ranks, err = loader.LoadTiktokenBpeFromFS(tiktokenFS, "tiktoken/qwen.tiktoken")
+	ass.Nil(err)
+	ass.Len(ranks, 151643)
+}
+
+//go:embed testdata/fsloader
+var testLoaderFS embed.FS
+
+func TestLoadTiktokenBpeFromFSPaths(t *testing.T) {
+	ass := assert.New(t)
+	loader := NewDefaultBpeLoader()
+
+	for _, path := range []string{
+		"testdata/fsloader/nested/dir/test.tiktoken",
+		`testdata\fsloader\nested\dir\test.tiktoken`,
+		`.\testdata\fsloader\nested\dir\test.tiktoken`,
+		"./testdata/fsloader/nested/other/../dir/test.tiktoken",
+		"/testdata/fsloader//nested/dir/test.tiktoken",
+	} {
+		ranks, err := loader.LoadTiktokenBpeFromFS(testLoaderFS, path)
+		ass.Nil(err, path)
+		ass.Equal(map[string]int{"a": 0, "b": 1}, ranks, path)
+	}
+
+	// the error lists the nearest directory that exists
+	_, err := loader.LoadTiktokenBpeFromFS(testLoaderFS, `testdata\fsloader\Nested\dir\test.tiktoken`)
+	ass.True(errors.Is(err, fs.ErrNotExist))
+	ass.Contains(err.Error(), "(testdata/fsloader has nested/, top.tiktoken)")
+
+	_, err = loader.LoadTiktokenBpeFromFS(testLoaderFS, "testdata/fsloader/nested/dir/tset.tiktoken")
+	ass.True(errors.Is(err, fs.ErrNotExist))
+	ass.Contains(err.Error(), "(testdata/fsloader/nested/dir has f01.tiktoken, f02.tiktoken,")
+	ass.Contains(err.Error(), "f10.tiktoken, ...)")
+
+	_, err = NewFSBpeLoader(testLoaderFS, map[string]string{"x": "testdata/fsloader/missing/deeper/x.tiktoken"}).LoadTiktokenBpe("x")
+	ass.True(errors.Is(err, fs.ErrNotExist))
+	ass.Contains(err.Error(), "(testdata/fsloader has nested/, top.tiktoken)")
+
+	_, err = loader.LoadTiktokenBpeFromFS(testLoaderFS, "other/x.tiktoken")
+	ass.Contains(err.Error(), "(. has testdata/)")
+}
+
+func TestParseTiktokenBpeBOM(t *testing.T) {
+	ass := assert.New(t)
+	ranks, err := parseTiktokenBpe([]byte("\uFEFFYQ== 0\nYg== 1\n"))
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+
+	ranks, err = parseTiktokenBpe([]byte("\uFEFF"))
+	ass.Nil(err)
+	ass.Empty(ranks)
+
+	fsys := fstest.MapFS{"bom.tiktoken": {Data: []byte("\uFEFFYQ== 0\n")}}
+	ranks, err = NewFSBpeLoader(fsys, map[string]string{"bom": "bom.tiktoken"}).LoadTiktokenBpe("bom")
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0}, ranks)
+}
+
+func TestParseTiktokenBpeErrors(t *testing.T) {
+	ass := assert.New(t)
+	_, err := parseTiktokenBpe([]byte("YQ== 0\nYg==\n"))
+	ass.EqualError(err, `rank file line 2: expected "<base64 token> <rank>"`)
+
+	_, err = parseTiktokenBpe([]byte("YQ== 0\n\nYg== x\n"))
+	ass.ErrorContains(err, "rank file line 3")
+
+	_, err = parseTiktokenBpe([]byte("!!! 0\n"))
+	ass.ErrorContains(err, "rank file line 1")
+
+	ranks, err := parseTiktokenBpe([]byte("YQ== 0\r\nYg== 1\r\n"))
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0, "b": 1}, ranks)
+}
+
+func TestOfflineMode(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	clients := 0
+	defer func(orig func() *http.Client) { httpClient = orig }(httpClient)
+	httpClient = func() *http.Client {
+		clients++
+		return http.DefaultClient
+	}
+
+	url := "https://example.com/missing.tiktoken"
+	for _, loader := range []BpeLoader{NewDefaultBpeLoader(WithOffline()), NewDefaultBpeLoader()} {
+		if loader.(*defaultBpeLoader).offline {
+			t.Setenv("TIKTOKEN_OFFLINE", "")
+		} else {
+			t.Setenv("TIKTOKEN_OFFLINE", "1")
+		}
+		_, err := loader.LoadTiktokenBpe(url)
+		ass.True(errors.Is(err, ErrOfflineMode))
+		ass.Contains(err.Error(), url)
+		ass.Contains(err.Error(), cachePath(url))
+	}
+
+	// pre-seeded cache entries and local files are still served
+	ass.Nil(os.WriteFile(cachePath(url), []byte("YQ== 0\n"), 0600))
+	ranks, err := NewDefaultBpeLoader(WithOffline()).LoadTiktokenBpe(url)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0}, ranks)
+	rankFile := filepath.Join(t.TempDir(), "local.tiktoken")
+	writeRankFile(t, rankFile, "b")
+	ranks, err = NewDefaultBpeLoader(WithOffline()).LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"b": 0}, ranks)
+
+	ass.Zero(clients, "no http client may be used offline")
+}
+
+func TestParseTiktokenBpeShards(t *testing.T) {
+	ass := assert.New(t)
+	contents, err := tiktokenFS.ReadFile("tiktoken/qwen.tiktoken")
+	ass.Nil(err)
+	serial, err := parseTiktokenBpeShards(contents, 1, DefaultParseLimits)
+	ass.Nil(err)
+	for _, n := range []int{2, 3, 4, 8, 64} {
+		parallel, err := parseTiktokenBpeShards(contents, n, DefaultParseLimits)
+		ass.Nil(err)
+		ass.Equal(serial, parallel, "%d shards", n)
+	}
+
+	// the reported line is global, and the first bad line wins
+	lines := strings.Split(string(contents), "\n")
+	lines[len(lines)/2] = "not a rank line"
+	lines[len(lines)-10] = "YQ== x"
+	broken := []byte(strings.Join(lines, "\n"))
+	for _, n := range []int{1, 8} {
+		_, err := parseTiktokenBpeShards(broken, n, DefaultParseLimits)
+		ass.EqualError(err, fmt.Sprintf(`rank file line %d: expected "<base64 token> <rank>"`, len(lines)/2+1), "%d shards", n)
+	}
+}
+
+func BenchmarkParseTiktokenBpe(b *testing.B) {
+	files := map[string]func() ([]byte, error){
+		"qwen": func() ([]byte, error) { return tiktokenFS.ReadFile("tiktoken/qwen.tiktoken") },
+		// only runs with o200k_base in the download cache
+		"o200k_base": func() ([]byte, error) {
+			return os.ReadFile(cachePath("https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken"))
+		},
+	}
+	for _, name := range []string{"qwen", "o200k_base"} {
+		contents, err := files[name]()
+		if err != nil {
+			continue
+		}
+		for _, shards := range []int{1, 4, 8} {
+			b.Run(fmt.Sprintf("%s/shards=%d", name, shards), func(b *testing.B) {
+				b.SetBytes(int64(len(contents)))
+				for i := 0; i < b.N; i++ {
+					if _, err := parseTiktokenBpeShards(contents, shards, DefaultParseLimits); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
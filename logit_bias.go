@@ -0,0 +1,169 @@
+package tiktoken
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LogitBiasLimit is the most entries the OpenAI API accepts in logit_bias.
+const LogitBiasLimit = 300
+
+// BiasVariant selects spellings of a phrase that BuildLogitBias biases in
+// addition to the phrase as given.
+type BiasVariant int
+
+const (
+	// VariantLeadingSpace adds each spelling preceded by a space, which is
+	// how a word in the middle of a sentence is tokenized.
+	VariantLeadingSpace BiasVariant = 1 << iota
+	// VariantCapitalized adds the phrase with its first letter upper case.
+	VariantCapitalized
+	// VariantLowercase adds the phrase in lower case.
+	VariantLowercase
+
+	DefaultBiasVariants = VariantLeadingSpace | VariantCapitalized | VariantLowercase
+)
+
+// BiasOption configures BuildLogitBias.
+type BiasOption func(*biasConfig)
+
+type biasConfig struct {
+	variants   BiasVariant
+	allTokens  bool
+	maxEntries int
+}
+
+// WithBiasVariants replaces DefaultBiasVariants; 0 biases the phrases
+// exactly as given.
+func WithBiasVariants(variants BiasVariant) BiasOption {
+	return func(c *biasConfig) {
+		c.variants = variants
+	}
+}
+
+// WithBiasAllTokens biases every token of a phrase instead of only the
+// first one. That also affects the tokens when they occur in other words.
+func WithBiasAllTokens() BiasOption {
+	return func(c *biasConfig) {
+		c.allTokens = true
+	}
+}
+
+// WithMaxBiasEntries replaces LogitBiasLimit, for APIs with another limit.
+func WithMaxBiasEntries(n int) BiasOption {
+	return func(c *biasConfig) {
+		c.maxEntries = n
+	}
+}
+
+// BuildLogitBias returns a logit_bias map giving bias to the tokens of
+// every phrase and its variants. By default only the first token of a
+// phrase is biased, which is enough to keep the model from starting it.
+// bias must be in [-100, 100], and the map may have at most LogitBiasLimit
+// entries unless WithMaxBiasEntries allows more.
+func BuildLogitBias(tk *Tiktoken, phrases []string, bias float64, opts ...BiasOption) (map[int]float64, error) {
+	c := biasConfig{variants: DefaultBiasVariants, maxEntries: LogitBiasLimit}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if bias < -100 || bias > 100 {
+		return nil, fmt.Errorf("logit bias %v out of range [-100, 100]", bias)
+	}
+	if tk.isClosed() {
+		return nil, ErrClosed
+	}
+
+	biases := map[int]float64{}
+	for _, phrase := range phrases {
+		for _, variant := range c.variants.spellings(phrase) {
+			tokens := tk.EncodeOrdinary(variant)
+			if len(tokens) == 0 {
+				continue
+			}
+			if !c.allTokens {
+				tokens = tokens[:1]
+			}
+			for _, token := range tokens {
+				biases[token] = bias
+			}
+		}
+	}
+	if len(biases) > c.maxEntries {
+		return nil, fmt.Errorf("logit bias has %d entries, more than the limit of %d", len(biases), c.maxEntries)
+	}
+	return biases, nil
+}
+
+// FirstTokenOf returns the first token of s at the start of a message, that
+// is the first token of EncodeOrdinary(s): "Yes" and " Yes" start with
+// different tokens, and so may "yes". Forcing an answer to start with s
+// means allowing this token, see AllowedFirstTokens. It fails for an empty
+// s.
+func (t *Tiktoken) FirstTokenOf(s string) (int, error) {
+	if t.isClosed() {
+		return 0, ErrClosed
+	}
+	tokens := t.EncodeOrdinary(s)
+	if len(tokens) == 0 {
+		return 0, fmt.Errorf("%q has no tokens", s)
+	}
+	return tokens[0], nil
+}
+
+// AllowedFirstTokens returns a logit_bias map giving +100 to the first
+// token of every option, see FirstTokenOf, which forces a response to start
+// with one of them. It fails if two different options start with the same
+// token, e.g. "Yes" and "Yes!", as forcing that token wouldn't decide
+// between them, and if there are more than LogitBiasLimit tokens.
+func (t *Tiktoken) AllowedFirstTokens(options []string) (map[int]float64, error) {
+	biases := make(map[int]float64, len(options))
+	owners := make(map[int]string, len(options))
+	for _, option := range options {
+		token, err := t.FirstTokenOf(option)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := owners[token]; ok && other != option {
+			return nil, fmt.Errorf("options %q and %q both start with token %d %q", other, option, token, t.Decode([]int{token}))
+		}
+		owners[token] = option
+		biases[token] = 100
+	}
+	if len(biases) > LogitBiasLimit {
+		return nil, fmt.Errorf("logit bias has %d entries, more than the limit of %d", len(biases), LogitBiasLimit)
+	}
+	return biases, nil
+}
+
+// spellings returns phrase and the variants of it selected by v, without
+// duplicates.
+func (v BiasVariant) spellings(phrase string) []string {
+	if phrase == "" {
+		return nil
+	}
+	cased := []string{phrase}
+	if v&VariantCapitalized != 0 {
+		r, size := utf8.DecodeRuneInString(phrase)
+		cased = append(cased, string(unicode.ToUpper(r))+phrase[size:])
+	}
+	if v&VariantLowercase != 0 {
+		cased = append(cased, strings.ToLower(phrase))
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range cased {
+		spellings := []string{s}
+		if v&VariantLeadingSpace != 0 {
+			spellings = append(spellings, " "+s)
+		}
+		for _, spelling := range spellings {
+			if !seen[spelling] {
+				seen[spelling] = true
+				out = append(out, spelling)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildLogitBias(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	biases, err := BuildLogitBias(enc, []string{"hello", "Paris"}, -100)
+	ass.Nil(err)
+	ass.Equal(map[int]float64{
+		14990: -100, 23811: -100, 9707: -100, 21927: -100, // hello, " hello", Hello, " Hello"
+		59604: -100, 12095: -100, 1732: -100, 40858: -100, // Paris, " Paris", pa|ris, " paris"
+	}, biases)
+
+	biases, err = BuildLogitBias(enc, []string{"unbelievable"}, 5, WithBiasVariants(0))
+	ass.Nil(err)
+	ass.Equal(map[int]float64{359: 5}, biases, "only the first token by default")
+	biases, err = BuildLogitBias(enc, []string{"unbelievable"}, 5, WithBiasVariants(0), WithBiasAllTokens())
+	ass.Nil(err)
+	ass.Equal(map[int]float64{359: 5, 31798: 5, 23760: 5}, biases)
+	biases, err = BuildLogitBias(enc, []string{"ChatGPT", "ChatGPT", ""}, 1, WithBiasVariants(VariantLeadingSpace))
+	ass.Nil(err)
+	ass.Equal(map[int]float64{15672: 1, 12853: 1}, biases)
+
+	_, err = BuildLogitBias(enc, []string{"x"}, 101)
+	ass.EqualError(err, "logit bias 101 out of range [-100, 100]")
+
+	words := make([]string, 0, 200)
+	for _, r := range "abcdefghijklmnopqrstuvwxyz" {
+		for _, s := range []string{"ing", "est", "ous", "ion", "ary", "ent", "ism", "ful"} {
+			words = append(words, string(r)+s)
+		}
+	}
+	_, err = BuildLogitBias(enc, words, -1)
+	ass.ErrorContains(err, "more than the limit of 300")
+	biases, err = BuildLogitBias(enc, words, -1, WithMaxBiasEntries(1000))
+	ass.Nil(err)
+	ass.Greater(len(biases), LogitBiasLimit)
+}
+
+func TestAllowedFirstTokens(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	for opener, want := range map[string]int{"{": 90, `{"`: 4913, " Yes": 7414, "Yes": 9454, "yes": 9693, "👍 ok": 144349} {
+		token, err := enc.FirstTokenOf(opener)
+		ass.Nil(err)
+		ass.Equal(want, token, opener)
+	}
+	// an emoji without a token of its own starts with part of its bytes
+	token, err := enc.FirstTokenOf("🫨")
+	ass.Nil(err)
+	ass.Equal(enc.EncodeOrdinary("🫨")[0], token)
+	ass.Less(len(enc.bpe.tokenBytes(token)), len("🫨"))
+	_, err = enc.FirstTokenOf("")
+	ass.NotNil(err)
+
+	biases, err := enc.AllowedFirstTokens([]string{"Yes", "No", "Yes", "{"})
+	ass.Nil(err)
+	ass.Equal(map[int]float64{9454: 100, 2753: 100, 90: 100}, biases)
+
+	_, err = enc.AllowedFirstTokens([]string{"Yes", "No", "Yes!"})
+	ass.ErrorContains(err, `options "Yes" and "Yes!" both start with token 9454 "Yes"`)
+}
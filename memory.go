@@ -0,0 +1,165 @@
+package tiktoken
+
+import "reflect"
+
+// Sizes of the headers on 64-bit platforms.
+const (
+	stringHeaderBytes = 16
+	sliceHeaderBytes  = 24
+	intBytes          = 8
+	interfaceBytes    = 16
+	mapHeaderBytes    = 48
+)
+
+// A compiled regexp2 pattern measured about 550 bytes plus 10 to 14 per
+// byte of pattern source. Runners allocated while matching are pooled by
+// regexp2 and not counted.
+const (
+	regexBaseBytes    = 512
+	regexBytesPerByte = 12
+)
+
+// ApproxMemoryUsage estimates the heap bytes held by t: the rank and
+// decoder tables, the sorted token index, the special token structures and
+// the compiled pattern. The sizes are computed from the table lengths, with
+// Go's map layout approximated by mapBytes, so expect the result to be
+// within some ten percent of what the runtime allocated. Tables shared with
+// other instances, e.g. from EncodingForModel, are counted in full.
+func (t *Tiktoken) ApproxMemoryUsage() int64 {
+	return newMemoryCounter().tiktoken(t)
+}
+
+// TotalCachedMemoryUsage estimates the heap bytes held by the package
+// caches of GetEncoding, GetEncodingWithLoader and the encodings behind
+// them, counting tables shared between entries once. It takes the cache
+// locks briefly and is cheap enough to export as a gauge.
+func TotalCachedMemoryUsage() int64 {
+	var cached []*Tiktoken
+	tl.Lock()
+	for _, tk := range tiktokenMap {
+		cached = append(cached, tk)
+	}
+	tl.Unlock()
+	ll.Lock()
+	for _, tk := range loaderTiktokenMap {
+		cached = append(cached, tk)
+	}
+	ll.Unlock()
+	var encodings []*Encoding
+	l.Lock()
+	for _, enc := range encodingMap {
+		encodings = append(encodings, enc)
+	}
+	l.Unlock()
+
+	c := newMemoryCounter()
+	var total int64
+	for _, tk := range cached {
+		total += c.tiktoken(tk)
+	}
+	for _, enc := range encodings {
+		total += c.encoding(enc)
+	}
+	return total
+}
+
+// memoryCounter adds up memory, skipping what it has already counted.
+type memoryCounter struct {
+	seen map[uintptr]bool
+}
+
+func newMemoryCounter() *memoryCounter {
+	return &memoryCounter{seen: map[uintptr]bool{}}
+}
+
+// first reports whether the map or pointer m is seen for the first time.
+func (c *memoryCounter) first(m any) bool {
+	p := reflect.ValueOf(m).Pointer()
+	if p == 0 || c.seen[p] {
+		return false
+	}
+	c.seen[p] = true
+	return true
+}
+
+func (c *memoryCounter) tiktoken(t *Tiktoken) int64 {
+	n := c.bpe(t.bpe)
+	if t.pbeEncoding != nil {
+		n += c.encoding(t.pbeEncoding)
+	}
+	if c.first(t.specialTokensSet) {
+		n += mapBytes(len(t.specialTokensSet), stringHeaderBytes+interfaceBytes)
+	}
+	return n
+}
+
+func (c *memoryCounter) encoding(enc *Encoding) int64 {
+	if !c.first(enc) {
+		return 0
+	}
+	return c.tokenMap(enc.MergeableRanks) + c.tokenMap(enc.SpecialTokens) + int64(len(enc.PatStr))
+}
+
+// tokenMap counts a token to id map with the bytes of its tokens.
+func (c *memoryCounter) tokenMap(m map[string]int) int64 {
+	if !c.first(m) {
+		return 0
+	}
+	n := mapBytes(len(m), stringHeaderBytes+intBytes)
+	for token := range m {
+		n += int64(len(token))
+	}
+	return n
+}
+
+func (c *memoryCounter) bpe(bp *CoreBPE) int64 {
+	// copies made by WithOptions share the tables and the closed flag
+	if !c.first(bp.closed) {
+		return 0
+	}
+	n := c.tokenMap(bp.encoder) + c.tokenMap(bp.specialTokensEncoder)
+	if c.first(bp.tables) {
+		n += rankTablesBytes(bp.tables)
+	}
+	// the decoder shares the token bytes with the encoder
+	if c.first(bp.specialTokensDecoder) {
+		n += mapBytes(len(bp.specialTokensDecoder), intBytes+stringHeaderBytes)
+	}
+	if c.first(bp.specialTokenBytes) {
+		n += mapBytes(len(bp.specialTokenBytes), intBytes+sliceHeaderBytes)
+		for _, b := range bp.specialTokenBytes {
+			n += int64(cap(b))
+		}
+	}
+	if m := bp.specialMatcher; m != nil {
+		n += int64(reflect.TypeOf(*m).Size())
+		n += 4 * int64(cap(m.next)+cap(m.pattern)+cap(m.dict))
+		n += stringHeaderBytes * int64(cap(m.patterns))
+	}
+	if bp.tlRegex != nil {
+		n += regexBaseBytes + regexBytesPerByte*int64(len(bp.tlRegex.String()))
+	}
+	return n + int64(reflect.TypeOf(*bp).Size())
+}
+
+// rankTablesBytes counts the rank tables besides the encoder map: the
+// token bytes, held twice, and the index arrays.
+func rankTablesBytes(t *rankTables) int64 {
+	n := int64(cap(t.tokens)+len(t.tokenString)) + 4*int64(cap(t.ends)+cap(t.byRank))
+	return n + mapBytes(len(t.sparse), intBytes+4) + int64(reflect.TypeOf(*t).Size())
+}
+
+// mapBytes estimates the memory of a map with n entries of slotBytes each:
+// groups of 8 slots with an 8-byte control word, doubled while the load
+// would exceed 7/8, as in the Swiss table maps of Go 1.24. The bucketed
+// maps of earlier releases come out within a few percent.
+func mapBytes(n int, slotBytes int64) int64 {
+	if n == 0 {
+		return mapHeaderBytes
+	}
+	groups := int64(1)
+	for groups*7 < int64(n) {
+		groups *= 2
+	}
+	return mapHeaderBytes + groups*(8+8*slotBytes)
+}
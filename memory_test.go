@@ -0,0 +1,64 @@
+package tiktoken
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApproxMemoryUsage(t *testing.T) {
+	ass := assert.New(t)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	// a loader of its own, so the rank tables are not already cached
+	loader := NewDefaultBpeLoader()
+	defer forgetRankTables(loader, "tiktoken/qwen.tiktoken")
+	enc, err := initEncodingWithLoader(MODEL_QWEN_BASE, loader)
+	ass.Nil(err)
+	tk, err := newTiktokenFromEncoding(enc)
+	ass.Nil(err)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	measured := float64(after.HeapAlloc) - float64(before.HeapAlloc)
+	estimated := float64(tk.ApproxMemoryUsage())
+	ass.InDelta(measured, estimated, 0.2*measured, "measured %.0f bytes, estimated %.0f", measured, estimated)
+	ass.Equal(tk.ApproxMemoryUsage(), tk.WithOptions(WithStripBOM(true)).ApproxMemoryUsage())
+	runtime.KeepAlive(tk)
+}
+
+func TestTotalCachedMemoryUsage(t *testing.T) {
+	ass := assert.New(t)
+	ReleaseEncoding(MODEL_QWEN_BASE)
+	base := TotalCachedMemoryUsage()
+
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	_, err = EncodingForModel("qwen2-7b")
+	ass.Nil(err)
+	ass.Equal(base+tk.ApproxMemoryUsage(), TotalCachedMemoryUsage(), "shared tables are counted once")
+
+	ReleaseEncoding(MODEL_QWEN_BASE)
+	ass.Equal(base, TotalCachedMemoryUsage())
+}
+
+func TestRankTables(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	tables := tk.bpe.tables
+	ass.Less(rankTablesBytes(tables), int64(2*len(tables.tokens)+12*tables.len()+1024), "a few bytes per token besides the token bytes")
+
+	hello := tk.bpe.tokenBytes(14990)
+	ass.Equal("hello", string(hello))
+	ass.Equal(len(hello), cap(hello), "appending can't overwrite the next token")
+	ass.Equal(ENDOFTEXT, string(tk.bpe.tokenBytes(151643)))
+	ass.Nil(tk.bpe.tokenBytes(-1))
+
+	_, err = newRankTables(map[string]int{"a": 0, "b": 0})
+	ass.EqualError(err, "encoder and decoder map sizes are different")
+	_, err = newRankTables(map[string]int{"a": 1 << 30, "b": 1 << 30})
+	ass.EqualError(err, "encoder and decoder map sizes are different")
+}
@@ -0,0 +1,70 @@
+package tiktoken
+
+import "strings"
+
+// MessageOverhead is what NumTokensFromMessages adds on top of the tokens
+// of the message fields.
+type MessageOverhead struct {
+	// TokensPerMessage is added for every message.
+	TokensPerMessage int
+	// TokensPerName is added for every message with a name, negative if
+	// the role is dropped then.
+	TokensPerName int
+	// TokensPerReply primes the reply, once per request.
+	TokensPerReply int
+}
+
+// defaultMessageOverhead applies to models without an entry in
+// messageOverheads.
+var defaultMessageOverhead = MessageOverhead{TokensPerMessage: 3, TokensPerName: 1, TokensPerReply: 3}
+
+// messageOverheads holds the models whose overhead differs from the
+// default, guarded by sl.
+var messageOverheads = map[string]MessageOverhead{
+	// every message follows <|start|>{role/name}\n{content}<|end|>\n, and
+	// if there's a name, the role is omitted
+	"gpt-3.5-turbo-0301": {TokensPerMessage: 4, TokensPerName: -1, TokensPerReply: 3},
+}
+
+// GetMessageOverhead returns the overhead NumTokensFromMessages counts for
+// model, or an error wrapping ErrModelNotFound if model resolves to no
+// encoding.
+func GetMessageOverhead(model string) (MessageOverhead, error) {
+	model, _, err := encodingNameForModel(model)
+	if err != nil {
+		return MessageOverhead{}, err
+	}
+	return messageOverheadFor(model), nil
+}
+
+// SetMessageOverhead makes NumTokensFromMessages and Budget count o for
+// model and for the model names starting with model followed by "-", such
+// as dated snapshots, unless a longer entry matches. The empty model sets
+// the default for all other models. It takes effect for counts that start
+// after it returns.
+func SetMessageOverhead(model string, o MessageOverhead) {
+	sl.Lock()
+	defer sl.Unlock()
+	if model == "" {
+		defaultMessageOverhead = o
+		return
+	}
+	messageOverheads[model] = o
+}
+
+// messageOverheadFor returns the entry for model, or the one of the longest
+// name model starts with followed by "-", or the default.
+func messageOverheadFor(model string) MessageOverhead {
+	sl.RLock()
+	defer sl.RUnlock()
+	if o, ok := messageOverheads[model]; ok {
+		return o
+	}
+	o, matched := defaultMessageOverhead, ""
+	for name, entry := range messageOverheads {
+		if len(name) > len(matched) && strings.HasPrefix(model, name+"-") {
+			o, matched = entry, name
+		}
+	}
+	return o
+}
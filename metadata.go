@@ -0,0 +1,114 @@
+package tiktoken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// contentHash lazily computes the vocabulary hash once per encoding; it is
+// shared by every instance derived from the same encoding.
+type contentHash struct {
+	once sync.Once
+	sum  string
+}
+
+// Name returns the name of the encoding, e.g. "cl100k_base".
+func (t *Tiktoken) Name() string {
+	if t.pbeEncoding == nil {
+		return ""
+	}
+	return t.pbeEncoding.Name
+}
+
+// Model returns the model name the encoding was resolved from by
+// EncodingForModel, or "" if it was obtained otherwise.
+func (t *Tiktoken) Model() string {
+	return t.model
+}
+
+// SourceURI returns the path or URL the mergeable ranks were loaded from,
+// or "" if they were not loaded from a rank file.
+func (t *Tiktoken) SourceURI() string {
+	if t.pbeEncoding == nil {
+		return ""
+	}
+	return t.pbeEncoding.SourceURI
+}
+
+// ContentHash returns the hex sha256 of the mergeable ranks written as a
+// rank file sorted by rank. For the published encodings this is the sha256
+// of the downloaded file. Special tokens are not part of the hash.
+func (t *Tiktoken) ContentHash() string {
+	t.bpe.mustOpen()
+	if t.hash == nil {
+		return rankFileHash(t.bpe.encoder)
+	}
+	t.hash.once.Do(func() {
+		t.hash.sum = rankFileHash(t.bpe.encoder)
+	})
+	return t.hash.sum
+}
+
+// VocabSize returns the number of token ids, that is one more than the
+// largest ordinary or special token, or the explicit vocabulary size of the
+// encoding if it sets one.
+func (t *Tiktoken) VocabSize() int {
+	t.bpe.mustOpen()
+	if t.pbeEncoding != nil && t.pbeEncoding.ExplicitNVocab > 0 {
+		return t.pbeEncoding.ExplicitNVocab
+	}
+	return t.NVocab()
+}
+
+// NVocab returns one more than MaxTokenValue, as n_vocab of the Python
+// library does. It differs from VocabSize only for an encoding with an
+// explicit vocabulary size.
+func (t *Tiktoken) NVocab() int {
+	return t.MaxTokenValue() + 1
+}
+
+// MaxTokenValue returns the largest ordinary or special token, -1 for an
+// empty vocabulary.
+func (t *Tiktoken) MaxTokenValue() int {
+	t.bpe.mustOpen()
+	n := t.bpe.tables.maxRank
+	for _, rank := range t.bpe.specialTokensEncoder {
+		if rank > n {
+			n = rank
+		}
+	}
+	return n
+}
+
+// SpecialTokens returns a new map of the special tokens of t to their ids,
+// which the caller may modify.
+func (t *Tiktoken) SpecialTokens() map[string]int {
+	t.bpe.mustOpen()
+	specials := make(map[string]int, len(t.bpe.specialTokensEncoder))
+	for token, id := range t.bpe.specialTokensEncoder {
+		specials[token] = id
+	}
+	return specials
+}
+
+// TokenByteValues returns the bytes of every mergeable token in byte
+// order, as token_byte_values of the Python library does. The slices are
+// copies, sharing a single allocation.
+func (t *Tiktoken) TokenByteValues() [][]byte {
+	t.bpe.mustOpen()
+	tables := t.bpe.tables
+	tokens := append([]byte{}, tables.tokens...)
+	values := make([][]byte, tables.len())
+	for i := range values {
+		start, end := tables.span(i)
+		values[i] = tokens[start:end:end]
+	}
+	return values
+}
+
+func rankFileHash(ranks map[string]int) string {
+	h := sha256.New()
+	writeRanks(h, sortedVocab(ranks))
+	return hex.EncodeToString(h.Sum(nil))
+}
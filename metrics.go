@@ -0,0 +1,239 @@
+package tiktoken
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsEnabled turns the counters of MetricsSnapshot on.
+var metricsEnabled atomic.Bool
+
+// encodingMetrics are the counters of one encoding name, shared by every
+// instance of it.
+type encodingMetrics struct {
+	calls, tokens, bytes atomic.Int64
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   = map[string]*encodingMetrics{}
+)
+
+// metricsFor returns the counters of the encoding called name.
+func metricsFor(name string) *encodingMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	m, ok := metrics[name]
+	if !ok {
+		m = &encodingMetrics{}
+		metrics[name] = m
+	}
+	return m
+}
+
+// loadMetrics are the process-wide counters of encoding lookups and rank
+// file reads.
+var loadMetrics struct {
+	encodingHits, encodingMisses  atomic.Int64
+	rankFileHits, rankFileFetches atomic.Int64
+	rankFileFetchNanos            atomic.Int64
+}
+
+// MetricsRecorder receives the events behind the counters as they happen,
+// e.g. to feed histograms of a metrics system such as Prometheus. Its
+// methods are called whether or not EnableMetrics is on, possibly
+// concurrently, and on the path of the calls they observe, so they should
+// be fast.
+type MetricsRecorder interface {
+	// ObserveEncode is called after each call that EncodingMetrics
+	// counts, with its duration; it is zero for EncodeReader, whose calls
+	// interleave with the caller reading the tokens.
+	ObserveEncode(encoding string, tokens, bytes int, elapsed time.Duration)
+	// ObserveEncodingLookup is called by GetEncoding, with hit set if the
+	// encoding was already loaded.
+	ObserveEncodingLookup(encoding string, hit bool)
+	// ObserveRankFile is called after the loader of NewDefaultBpeLoader
+	// read a rank file, with fromCache set if it came from its cache
+	// rather than a download or the file system, and the time it took.
+	ObserveRankFile(uri string, fromCache bool, elapsed time.Duration, err error)
+}
+
+// recorderBox holds the MetricsRecorder, which atomic.Pointer can't hold as
+// an interface.
+type recorderBox struct {
+	r MetricsRecorder
+}
+
+var metricsRecorder atomic.Pointer[recorderBox]
+
+// SetMetricsRecorder makes r receive the events of tokenization and
+// loading, or stops sending them if r is nil. Without a recorder or
+// EnableMetrics, nothing is timed.
+func SetMetricsRecorder(r MetricsRecorder) {
+	if r == nil {
+		metricsRecorder.Store(nil)
+		return
+	}
+	metricsRecorder.Store(&recorderBox{r})
+}
+
+// currentRecorder returns the recorder of SetMetricsRecorder, or nil.
+func currentRecorder() MetricsRecorder {
+	if box := metricsRecorder.Load(); box != nil {
+		return box.r
+	}
+	return nil
+}
+
+// metricsStart returns the start time of a call to observe, or the zero
+// time if metrics are disabled and there is no recorder.
+func metricsStart() time.Time {
+	if !metricsEnabled.Load() && metricsRecorder.Load() == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// since returns the time elapsed from start, zero for a zero start.
+func since(start time.Time) time.Duration {
+	if start.IsZero() {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// record counts a call started at start producing tokens from bytes of
+// text if metrics are enabled, and reports it to the recorder. Without
+// either, it costs two atomic loads.
+func (t *Tiktoken) record(start time.Time, tokens, bytes int) {
+	if r := currentRecorder(); r != nil {
+		r.ObserveEncode(t.Name(), tokens, bytes, since(start))
+	}
+	if !metricsEnabled.Load() || t.metrics == nil {
+		return
+	}
+	t.metrics.calls.Add(1)
+	t.metrics.tokens.Add(int64(tokens))
+	t.metrics.bytes.Add(int64(bytes))
+}
+
+// recordLookup counts a GetEncoding call that found the encoding loaded if
+// hit.
+func recordLookup(name string, hit bool) {
+	if r := currentRecorder(); r != nil {
+		r.ObserveEncodingLookup(name, hit)
+	}
+	if !metricsEnabled.Load() {
+		return
+	}
+	if hit {
+		loadMetrics.encodingHits.Add(1)
+	} else {
+		loadMetrics.encodingMisses.Add(1)
+	}
+}
+
+// recordRankFile counts a rank file read started at start, from the cache
+// if fromCache.
+func recordRankFile(uri string, fromCache bool, start time.Time, err error) {
+	elapsed := since(start)
+	if r := currentRecorder(); r != nil {
+		r.ObserveRankFile(uri, fromCache, elapsed, err)
+	}
+	if !metricsEnabled.Load() {
+		return
+	}
+	if fromCache {
+		loadMetrics.rankFileHits.Add(1)
+	} else {
+		loadMetrics.rankFileFetches.Add(1)
+		loadMetrics.rankFileFetchNanos.Add(int64(elapsed))
+	}
+}
+
+// EnableMetrics turns the process-wide tokenization counters of
+// MetricsSnapshot on or off. They are off by default; while off, counting
+// costs a single atomic load per call. Turning them off keeps the counts.
+func EnableMetrics(enabled bool) {
+	metricsEnabled.Store(enabled)
+}
+
+// EncodingMetrics are the tokenization counters of an encoding.
+type EncodingMetrics struct {
+	// Calls counts calls of Encode, EncodeWithError, EncodeOrdinary,
+	// CountTokens and EncodeAs and inputs of EncodeReader read to the end,
+	// Tokens the tokens they produced or counted and Bytes the bytes of
+	// their input text.
+	Calls  int64 `json:"calls"`
+	Tokens int64 `json:"tokens"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// LoadMetrics are the counters of loading encodings.
+type LoadMetrics struct {
+	// EncodingHits and EncodingMisses count the GetEncoding calls that
+	// found their encoding loaded and those that had to load it or wait
+	// for its load.
+	EncodingHits   int64 `json:"encoding_hits"`
+	EncodingMisses int64 `json:"encoding_misses"`
+	// RankFileCacheHits counts the rank files the default loader read
+	// from its cache, RankFileFetches those it downloaded or read from
+	// elsewhere, and RankFileFetchTime is the time the fetches took. It
+	// is only measured with a MetricsRecorder set.
+	RankFileCacheHits int64         `json:"rank_file_cache_hits"`
+	RankFileFetches   int64         `json:"rank_file_fetches"`
+	RankFileFetchTime time.Duration `json:"rank_file_fetch_time"`
+}
+
+// Metrics is a snapshot of the tokenization counters, see EnableMetrics.
+type Metrics struct {
+	Total EncodingMetrics `json:"total"`
+	// Encodings holds the counters of every encoding name used since the
+	// last reset.
+	Encodings map[string]EncodingMetrics `json:"encodings"`
+	Loads     LoadMetrics                `json:"loads"`
+}
+
+// MetricsSnapshot returns the current counters. Counts of calls running
+// concurrently may be partly included.
+func MetricsSnapshot() Metrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	s := Metrics{Encodings: make(map[string]EncodingMetrics, len(metrics))}
+	for name, m := range metrics {
+		e := EncodingMetrics{Calls: m.calls.Load(), Tokens: m.tokens.Load(), Bytes: m.bytes.Load()}
+		if e.Calls == 0 {
+			continue
+		}
+		s.Encodings[name] = e
+		s.Total.Calls += e.Calls
+		s.Total.Tokens += e.Tokens
+		s.Total.Bytes += e.Bytes
+	}
+	s.Loads = LoadMetrics{
+		EncodingHits:      loadMetrics.encodingHits.Load(),
+		EncodingMisses:    loadMetrics.encodingMisses.Load(),
+		RankFileCacheHits: loadMetrics.rankFileHits.Load(),
+		RankFileFetches:   loadMetrics.rankFileFetches.Load(),
+		RankFileFetchTime: time.Duration(loadMetrics.rankFileFetchNanos.Load()),
+	}
+	return s
+}
+
+// ResetMetrics sets all counters to zero, e.g. at the start of a reporting
+// period. It doesn't change whether they are enabled.
+func ResetMetrics() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for _, m := range metrics {
+		m.calls.Store(0)
+		m.tokens.Store(0)
+		m.bytes.Store(0)
+	}
+	loadMetrics.encodingHits.Store(0)
+	loadMetrics.encodingMisses.Store(0)
+	loadMetrics.rankFileHits.Store(0)
+	loadMetrics.rankFileFetches.Store(0)
+	loadMetrics.rankFileFetchNanos.Store(0)
+}
@@ -0,0 +1,119 @@
+package tiktoken
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	test := GetTestEncoding()
+	endTokens := int64(len(test.EncodeOrdinary("the end")))
+	defer EnableMetrics(false)
+
+	ResetMetrics()
+	enc.Encode("hello world", nil, nil)
+	ass.Empty(MetricsSnapshot().Encodings, "metrics are off by default")
+
+	EnableMetrics(true)
+	const workers, calls = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				enc.Encode("hello world", nil, nil)
+				enc.WithOptions(WithMaxPieceLength(8)).CountTokens("hello")
+				test.EncodeOrdinary("the end")
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := MetricsSnapshot()
+	n := int64(workers * calls)
+	ass.Equal(EncodingMetrics{Calls: 2 * n, Tokens: 3 * n, Bytes: 16 * n}, s.Encodings[MODEL_QWEN_BASE])
+	ass.Equal(EncodingMetrics{Calls: n, Tokens: endTokens * n, Bytes: 7 * n}, s.Encodings[testEncodingName])
+	ass.Equal(3*n, s.Total.Calls)
+
+	EnableMetrics(false)
+	enc.Encode("hello", nil, nil)
+	ass.Equal(s, MetricsSnapshot(), "disabling keeps the counts")
+	ResetMetrics()
+	ass.Empty(MetricsSnapshot().Encodings)
+}
+
+// eventRecorder collects the events of a MetricsRecorder.
+type eventRecorder struct {
+	mu      sync.Mutex
+	encodes []string
+	lookups map[bool]int
+	files   map[bool]int
+}
+
+func (r *eventRecorder) ObserveEncode(encoding string, tokens, bytes int, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encodes = append(r.encodes, encoding)
+}
+
+func (r *eventRecorder) ObserveEncodingLookup(encoding string, hit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups[hit]++
+}
+
+func (r *eventRecorder) ObserveRankFile(uri string, fromCache bool, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[fromCache]++
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	defer EnableMetrics(false)
+	defer SetMetricsRecorder(nil)
+
+	r := &eventRecorder{lookups: map[bool]int{}, files: map[bool]int{}}
+	SetMetricsRecorder(r)
+	ResetMetrics()
+	_, err = GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	enc.Encode("hello world", nil, nil)
+	enc.CountTokens("hello")
+	ass.Equal([]string{MODEL_QWEN_BASE, MODEL_QWEN_BASE}, r.encodes)
+	ass.Equal(map[bool]int{true: 1}, r.lookups)
+	ass.Empty(MetricsSnapshot().Encodings, "the recorder works without EnableMetrics")
+
+	EnableMetrics(true)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	fetcher := FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+		time.Sleep(time.Millisecond)
+		return []byte("YQ== 0\n"), nil
+	})
+	loader := NewDefaultBpeLoader(WithFetcher("mem", fetcher), WithCacheStore(NewMemoryCacheStore()))
+	for i := 0; i < 3; i++ {
+		_, err = loader.LoadTiktokenBpe("mem://vocab/a.tiktoken")
+		ass.Nil(err)
+	}
+	ass.Equal(map[bool]int{false: 1, true: 2}, r.files)
+	loads := MetricsSnapshot().Loads
+	ass.Equal(int64(2), loads.RankFileCacheHits)
+	ass.Equal(int64(1), loads.RankFileFetches)
+	ass.GreaterOrEqual(loads.RankFileFetchTime, time.Millisecond)
+
+	_, err = GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Equal(int64(1), MetricsSnapshot().Loads.EncodingHits)
+	ResetMetrics()
+	ass.Equal(LoadMetrics{}, MetricsSnapshot().Loads)
+}
@@ -0,0 +1,77 @@
+package tiktoken
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// mirror serves the rank files whose URIs start with prefix from base.
+type mirror struct {
+	prefix, base string
+}
+
+// mirrorURL returns the URL uri is downloaded from: uri with the prefix of
+// the longest matching mirror replaced by its base.
+func mirrorURL(mirrors []mirror, uri string) string {
+	best := -1
+	for i, m := range mirrors {
+		if strings.HasPrefix(uri, m.prefix) && (best < 0 || len(m.prefix) > len(mirrors[best].prefix)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return uri
+	}
+	return mirrors[best].base + uri[len(mirrors[best].prefix):]
+}
+
+// WithMirror makes the loader download the rank files whose URIs start
+// with prefix from base instead, e.g. for networks that can't reach
+// openaipublic.blob.core.windows.net:
+//
+//	tiktoken.WithMirror("https://openaipublic.blob.core.windows.net/", "https://mirror.example.com/openai/")
+//
+// A whole URI, as returned by EncodingSource, mirrors a single encoding.
+// Of several matching mirrors, the one with the longest prefix wins. Only
+// the download goes to the mirror: files are cached and checked against
+// known hashes under their original URIs, so a mirror can't serve altered
+// vocabularies of the built-in encodings. base must be an http(s) URL.
+func WithMirror(prefix, base string) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.mirrors = append(l.mirrors, mirror{prefix, base})
+	}
+}
+
+// WithRetry makes the loader try a download up to retries more times when
+// the network fails, as for a connection error, a cut-off transfer or a
+// 5xx or 429 reply, waiting backoff before the first retry and twice as
+// long before each next one. Interrupted downloads resume where the server
+// allows it. Giving up when the context of the load is done, the loader
+// returns the last error. By default downloads aren't retried.
+func WithRetry(retries int, backoff time.Duration) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.retries = retries
+		l.backoff = backoff
+	}
+}
+
+// withRetries calls fetch until it succeeds, fails for a reason other than
+// the network, or the retries of l are used up.
+func (l *defaultBpeLoader) withRetries(ctx context.Context, fetch func() ([]byte, error)) ([]byte, error) {
+	delay := l.backoff
+	for attempt := 0; ; attempt++ {
+		contents, err := fetch()
+		if err == nil || attempt >= l.retries || !isNetworkError(err) || ctx.Err() != nil {
+			return contents, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		delay *= 2
+	}
+}
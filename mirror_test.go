@@ -0,0 +1,92 @@
+package tiktoken
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorURL(t *testing.T) {
+	ass := assert.New(t)
+	mirrors := []mirror{
+		{"https://origin.example/", "https://mirror.example/all/"},
+		{"https://origin.example/encodings/a.tiktoken", "https://mirror.example/a.tiktoken"},
+	}
+	ass.Equal("https://mirror.example/all/encodings/b.tiktoken", mirrorURL(mirrors, "https://origin.example/encodings/b.tiktoken"))
+	ass.Equal("https://mirror.example/a.tiktoken", mirrorURL(mirrors, "https://origin.example/encodings/a.tiktoken"), "the longest prefix wins")
+	ass.Equal("https://other.example/c.tiktoken", mirrorURL(mirrors, "https://other.example/c.tiktoken"))
+	ass.Equal("https://other.example/c.tiktoken", mirrorURL(nil, "https://other.example/c.tiktoken"))
+}
+
+func TestWithMirror(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte("YQ== 0\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	uri := "https://origin.invalid/encodings/a.tiktoken"
+	loader := NewDefaultBpeLoader(WithMirror("https://origin.invalid/", srv.URL+"/mirror/"))
+	ranks, err := loader.LoadTiktokenBpe(uri)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0}, ranks)
+	ass.Equal([]string{"/mirror/encodings/a.tiktoken"}, paths)
+	_, err = os.Stat(cachePath(uri))
+	ass.Nil(err, "the file is cached under its original URI")
+
+	// uncached reads go through the plain fetcher
+	_, err = loader.(*defaultBpeLoader).readFile(context.Background(), uri)
+	ass.Nil(err)
+	ass.Equal([]string{"/mirror/encodings/a.tiktoken", "/mirror/encodings/a.tiktoken"}, paths)
+}
+
+func TestWithRetry(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	failures, requests := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing.tiktoken":
+			w.WriteHeader(http.StatusNotFound)
+		case failures > 0:
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("YQ== 0\n"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	failures = 2
+	_, err := NewDefaultBpeLoader(WithStaleIfError(false), WithRetry(1, time.Millisecond)).LoadTiktokenBpe(srv.URL + "/a.tiktoken")
+	ass.ErrorContains(err, "503")
+	ass.Equal(2, requests)
+
+	failures, requests = 2, 0
+	ranks, err := NewDefaultBpeLoader(WithRetry(2, time.Millisecond)).LoadTiktokenBpe(srv.URL + "/b.tiktoken")
+	ass.Nil(err)
+	ass.Equal(map[string]int{"a": 0}, ranks)
+	ass.Equal(3, requests)
+
+	requests = 0
+	_, err = NewDefaultBpeLoader(WithRetry(2, time.Millisecond)).LoadTiktokenBpe(srv.URL + "/missing.tiktoken")
+	ass.ErrorContains(err, "404")
+	ass.Equal(1, requests, "only network failures are retried")
+
+	failures, requests = 5, 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	loader := NewDefaultBpeLoader(WithRetry(5, time.Hour)).(BpeLoaderWithContext)
+	_, err = loader.LoadTiktokenBpeContext(ctx, srv.URL+"/c.tiktoken")
+	ass.Error(err)
+	ass.LessOrEqual(requests, 1, "a done context stops retrying")
+}
@@ -0,0 +1,6 @@
+//go:build !race
+
+package tiktoken
+
+// raceEnabled is set when testing with -race, see race_test.go.
+const raceEnabled = false
@@ -0,0 +1,139 @@
+package tiktoken
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var utf8BOM = []byte("\uFEFF")
+
+// EncodeOption changes how a Tiktoken prepares input text before encoding.
+// Options are applied with Tiktoken.WithOptions.
+type EncodeOption func(*encodeConfig)
+
+type encodeConfig struct {
+	normalize bool
+	normForm  norm.Form
+	stripBOM  bool
+	// maxPieceLength is applied to a copy of the CoreBPE when set.
+	maxPieceLength *int
+	// scannerSplit is applied to a copy of the CoreBPE when set.
+	scannerSplit *bool
+	// allowedSpecial and disallowedSpecial replace nil arguments of
+	// EncodeWithError.
+	allowedSpecial    []string
+	disallowedSpecial []string
+	// diagnostics are the thresholds of EncodeWithDiagnostics.
+	diagnostics DiagnosticThresholds
+	// compatLevel is the level of WithCompatibilityLevel.
+	compatLevel string
+	// batchWorkers is the pool size of EncodeBatch, GOMAXPROCS if 0.
+	batchWorkers int
+	// batchDedup and copyResults are the options of EncodeBatch
+	// duplicates.
+	batchDedup  bool
+	copyResults bool
+}
+
+// WithNormalization normalizes input text to form before it is split into
+// pieces, so that NFC and NFD spellings of the same text produce the same
+// tokens. No normalization happens by default.
+func WithNormalization(form norm.Form) EncodeOption {
+	return func(c *encodeConfig) {
+		c.normalize = true
+		c.normForm = form
+	}
+}
+
+// WithStripBOM removes a leading U+FEFF byte order mark from input text.
+// It is off by default to stay compatible with the reference tokenizer,
+// which encodes the BOM like any other character.
+func WithStripBOM(strip bool) EncodeOption {
+	return func(c *encodeConfig) {
+		c.stripBOM = strip
+	}
+}
+
+// WithMaxPieceLength caps the number of bytes of a single piece that is
+// merged at once; longer pieces are cut at rune boundaries first. Zero or a
+// negative n disables the cap.
+//
+// Only degenerate inputs such as long runs without whitespace (minified
+// code, base64 blobs) have pieces this long. For those the tokens may differ
+// slightly from the reference implementation, in exchange for bounding the
+// memory the merge of a single piece needs. The default is
+// DefaultMaxPieceLength, 128 KiB; a small cap changes the tokens of ordinary
+// long words and runs of whitespace too.
+func WithMaxPieceLength(n int) EncodeOption {
+	return func(c *encodeConfig) {
+		c.maxPieceLength = &n
+	}
+}
+
+// WithScannerSplit splits text into pieces with a hand-written scanner
+// instead of the regex engine, if the encoding's pattern is one of the
+// built-in cl100k_base, o200k_base, p50k_base, r50k_base or qwen patterns;
+// other patterns and text that isn't valid UTF-8 are still split by the
+// regex, and pure-ASCII text never goes through it. The tests check that
+// the scanner and regexp2 split a fixed corpus and random text mixing the
+// character classes the patterns tell apart into the same pieces;
+// BenchmarkUnicodeSplit compares their speed. The default is the regex.
+func WithScannerSplit(on bool) EncodeOption {
+	return func(c *encodeConfig) {
+		c.scannerSplit = &on
+	}
+}
+
+// WithOptions returns a copy of t with opts applied on top of t's own
+// options. The copy shares the vocabulary and compiled patterns with t.
+func (t *Tiktoken) WithOptions(opts ...EncodeOption) *Tiktoken {
+	derived := *t
+	for _, opt := range opts {
+		opt(&derived.opts)
+	}
+	if n := derived.opts.maxPieceLength; n != nil && *n != derived.bpe.maxPieceLength {
+		bpe := *derived.bpe
+		bpe.maxPieceLength = *n
+		derived.bpe = &bpe
+	}
+	if on := derived.opts.scannerSplit; on != nil && *on != (derived.bpe.unicodeSplitter != nil) {
+		bpe := *derived.bpe
+		bpe.unicodeSplitter = nil
+		if *on {
+			bpe.unicodeSplitter = unicodeSplitters[bpe.tlRegex.String()]
+		}
+		derived.bpe = &bpe
+	}
+	return &derived
+}
+
+// WithDefaultAllowedSpecial returns a copy of t whose Encode and
+// EncodeWithError allow the special tokens names when called with a nil
+// allowedSpecial, "all" allowing all of them as usual. An argument that
+// isn't nil, even an empty one, is used instead of the defaults. The copy
+// shares the vocabulary and compiled patterns with t.
+func (t *Tiktoken) WithDefaultAllowedSpecial(names ...string) *Tiktoken {
+	derived := *t
+	derived.opts.allowedSpecial = append([]string{}, names...)
+	return &derived
+}
+
+// WithDefaultDisallowedSpecial is WithDefaultAllowedSpecial for the
+// disallowedSpecial argument.
+func (t *Tiktoken) WithDefaultDisallowedSpecial(names ...string) *Tiktoken {
+	derived := *t
+	derived.opts.disallowedSpecial = append([]string{}, names...)
+	return &derived
+}
+
+// prepareText applies the configured input transformations to text.
+func (t *Tiktoken) prepareText(text string) string {
+	if t.opts.stripBOM {
+		text = strings.TrimPrefix(text, string(utf8BOM))
+	}
+	if t.opts.normalize {
+		text = t.opts.normForm.String(text)
+	}
+	return text
+}
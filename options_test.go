@@ -0,0 +1,81 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestWithNormalization(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	nfc := "caf\u00e9 cr\u00e8me"
+	nfd := "cafe\u0301 cre\u0300me"
+	ass.NotEqual(enc.Encode(nfc, nil, nil), enc.Encode(nfd, nil, nil), "no normalization by default")
+
+	normalized := enc.WithOptions(WithNormalization(norm.NFC))
+	ass.Equal(enc.Encode(nfc, nil, nil), normalized.Encode(nfd, nil, nil))
+	ass.Equal(enc.EncodeOrdinary(nfc), normalized.EncodeOrdinary(nfd))
+	ass.Equal(nfc, normalized.Decode(normalized.Encode(nfd, nil, nil)))
+	ass.Same(enc.bpe, normalized.bpe, "derived encoders share the vocabulary")
+}
+
+func TestWithStripBOM(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	stripped := enc.WithOptions(WithStripBOM(true))
+
+	ass.Greater(len(enc.Encode("\uFEFFhello", nil, nil)), len(enc.Encode("hello", nil, nil)), "BOM is kept by default")
+	ass.Equal(enc.Encode("hello", nil, nil), stripped.Encode("\uFEFFhello", nil, nil))
+	ass.Empty(stripped.Encode("\uFEFF", nil, nil))
+	ass.Equal(enc.Encode("hello\uFEFFworld", nil, nil), stripped.Encode("hello\uFEFFworld", nil, nil), "only a leading BOM is removed")
+	ass.Equal(enc.Encode("\uFEFFhello", nil, nil), stripped.Encode("\uFEFF\uFEFFhello", nil, nil), "only one BOM is removed")
+	ass.Equal(enc.Encode("hello", nil, nil), enc.WithOptions(WithStripBOM(true), WithStripBOM(false)).Encode("hello", nil, nil))
+}
+
+func TestWithMaxPieceLength(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world!你好，世界！"
+	uncapped := enc.WithOptions(WithMaxPieceLength(0))
+	ass.Equal(uncapped.Encode(text, nil, nil), enc.Encode(text, nil, nil), "normal text is not affected by the cap")
+	ass.Equal(0, uncapped.bpe.maxPieceLength)
+	ass.Equal(DefaultMaxPieceLength, enc.bpe.maxPieceLength, "the original keeps its cap")
+
+	long := strings.Repeat("汉字", 300)
+	capped := enc.WithOptions(WithMaxPieceLength(8))
+	ass.Equal(long, capped.Decode(capped.Encode(long, nil, nil)), "cuts never split a rune")
+
+	ass.Equal(3, safeCut([]byte("你好"), 4))
+	ass.Equal(2, safeCut([]byte("abc"), 2))
+	ass.Equal(1, safeCut([]byte{0x80, 0x80, 0x80}, 1), "invalid input falls back to a hard cut")
+}
+
+func TestWithDefaultSpecial(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	chat := enc.WithDefaultAllowedSpecial("<|im_start|>", "<|im_end|>")
+	text := "<|im_start|>hello<|im_end|>"
+
+	ass.Equal([]int{151644, 14990, 151645}, chat.Encode(text, nil, nil))
+	ass.Equal(enc.EncodeOrdinary(text), chat.Encode(text, []string{}, nil), "an explicit argument overrides the defaults")
+	ass.Equal(enc.EncodeOrdinary(text), enc.Encode(text, nil, nil), "the original is unchanged")
+	ass.Equal(enc.EncodeOrdinary(text), chat.NewSession().Encode(text))
+
+	strict := chat.WithDefaultDisallowedSpecial("all")
+	_, err = strict.EncodeWithError("hi<|endoftext|>", nil, nil)
+	ass.ErrorContains(err, "<|endoftext|>")
+	ass.Equal([]int{151644, 14990, 151645}, strict.Encode(text, nil, nil))
+	_, err = strict.EncodeWithError("hi<|endoftext|>", nil, []string{})
+	ass.Nil(err)
+
+	ass.Same(enc.bpe, strict.bpe, "the tables are shared")
+}
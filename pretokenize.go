@@ -0,0 +1,137 @@
+package tiktoken
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// Piece is a part of a text as an encoding splits it before merging: a
+// match of the split pattern or a special token.
+type Piece struct {
+	// Start and End are the byte range of the piece in the text.
+	Start, End int
+	// Bytes are what merging starts from: the bytes of the range, except
+	// that invalid UTF-8 bytes read as U+FFFD.
+	Bytes []byte
+	// Special is set for special tokens, which are not merged.
+	Special bool
+}
+
+// PreTokenize splits text the way Encode(text, nil, nil) does before
+// merging: at the special tokens allowed by default, see
+// WithDefaultAllowedSpecial, and the rest with the split pattern. It uses
+// the splitter of Encode, so the pieces always match the tokens. Disallowed
+// special tokens are not checked. With input options such as
+// WithNormalization the ranges refer to the transformed text.
+func (t *Tiktoken) PreTokenize(text string) []Piece {
+	var pieces []Piece
+	t.preTokenize(t.prepareText(text), func(p Piece) {
+		pieces = append(pieces, p)
+	})
+	return pieces
+}
+
+func (t *Tiktoken) preTokenize(text string, emit func(p Piece)) {
+	onPiece := func(piece string, start, end int) {
+		emit(Piece{Start: start, End: end, Bytes: []byte(piece)})
+	}
+	onSpecial := func(special string, start, end int) {
+		emit(Piece{Start: start, End: end, Bytes: []byte(special), Special: true})
+	}
+	t.bpe.forEachSegment(text, t.allowedSpecialSet(t.opts.allowedSpecial), onPiece, onSpecial)
+}
+
+// PreTokenizeReader is PreTokenize for the text read from r, calling fn
+// with every piece as soon as it is certain, so large corpora are split in
+// bounded memory. Ranges count from the start of r. It stops at the first
+// error of r or fn and returns it.
+func (t *Tiktoken) PreTokenizeReader(r io.Reader, fn func(p Piece) error) error {
+	if t.isClosed() {
+		return ErrClosed
+	}
+	r = t.prepareReader(r)
+	// a special token starting in the last bytes of the buffer may not be
+	// complete yet
+	hold := 0
+	if len(t.allowedSpecialSet(t.opts.allowedSpecial)) > 0 {
+		hold = t.bpe.specialMatcher.maxLen
+	}
+
+	buf := make([]byte, 32<<10)
+	var pending []byte
+	base := 0
+	for eof := false; !eof; {
+		n, err := r.Read(buf)
+		pending = append(pending, buf[:n]...)
+		if err == io.EOF {
+			eof = true
+		} else if err != nil {
+			return err
+		}
+		if n == 0 && !eof {
+			continue
+		}
+
+		valid := len(pending)
+		if !eof {
+			valid = completeUTF8Prefix(pending)
+		}
+		text := string(pending[:valid])
+		cutoff := len(text)
+		if !eof {
+			cutoff = cutRunesFromEnd(text, streamMargin)
+			if c := len(text) - hold; c < cutoff {
+				cutoff = c
+			}
+		}
+
+		var pieces []Piece
+		t.preTokenize(text, func(p Piece) {
+			pieces = append(pieces, p)
+		})
+		consumed := 0
+		for i, p := range pieces {
+			// like streamEncoder, the last piece may still grow
+			if !eof && (i == len(pieces)-1 || p.End > cutoff) {
+				break
+			}
+			consumed = p.End
+			p.Start += base
+			p.End += base
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		pending = append(pending[:0], pending[consumed:]...)
+		base += consumed
+	}
+	return nil
+}
+
+// prepareReader is prepareText for the text read from r.
+func (t *Tiktoken) prepareReader(r io.Reader) io.Reader {
+	if t.opts.stripBOM {
+		br := bufio.NewReader(r)
+		if head, _ := br.Peek(len(utf8BOM)); bytes.Equal(head, utf8BOM) {
+			br.Discard(len(utf8BOM))
+		}
+		r = br
+	}
+	if t.opts.normalize {
+		r = t.opts.normForm.Reader(r)
+	}
+	return r
+}
+
+// cutRunesFromEnd returns the byte offset in text n runes before its end,
+// or 0 if it is shorter.
+func cutRunesFromEnd(text string, n int) int {
+	end := len(text)
+	for ; n > 0 && end > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(text[:end])
+		end -= size
+	}
+	return end
+}
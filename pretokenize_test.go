@@ -0,0 +1,57 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreTokenize(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	pieces := enc.PreTokenize("hello world's 123")
+	var texts []string
+	for _, p := range pieces {
+		texts = append(texts, string(p.Bytes))
+	}
+	ass.Equal([]string{"hello", " world", "'s", " ", "1", "2", "3"}, texts)
+	ass.Equal(Piece{Start: 5, End: 11, Bytes: []byte(" world")}, pieces[1])
+
+	chat := enc.WithDefaultAllowedSpecial("all")
+	text := "<|im_start|>user\n你好，世界! \xffbad<|im_end|>"
+	var tokens []int
+	for _, p := range chat.PreTokenize(text) {
+		if p.Special {
+			tokens = append(tokens, enc.bpe.specialTokensEncoder[string(p.Bytes)])
+			continue
+		}
+		ass.Equal(enc.EncodeOrdinary(string(p.Bytes)), enc.EncodeOrdinary(text[p.Start:p.End]))
+		tokens = append(tokens, enc.EncodeOrdinary(string(p.Bytes))...)
+	}
+	ass.Equal(chat.Encode(text, nil, nil), tokens, "the pieces merge to the tokens of Encode")
+}
+
+func TestPreTokenizeReader(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	chat := enc.WithDefaultAllowedSpecial("all")
+	text := strings.Repeat("The quick brown fox's 12345 jumps      over\n\n 你好，世界 <|im_start|>\xe4\xbd<|endoftext|>", 50)
+
+	for _, tk := range []*Tiktoken{enc, chat} {
+		var streamed []Piece
+		err := tk.PreTokenizeReader(iotest.OneByteReader(strings.NewReader(text)), func(p Piece) error {
+			streamed = append(streamed, p)
+			return nil
+		})
+		ass.Nil(err)
+		ass.Equal(tk.PreTokenize(text), streamed)
+	}
+
+	err = enc.PreTokenizeReader(strings.NewReader(text), func(Piece) error { return iotest.ErrTimeout })
+	ass.ErrorIs(err, iotest.ErrTimeout)
+}
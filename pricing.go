@@ -0,0 +1,144 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrPricingUnknown is returned by EstimateCost for models without a price.
+var ErrPricingUnknown = errors.New("tiktoken: pricing unknown for model")
+
+// Pricing is the price of a model in micro-dollars (1e-6 USD) per million
+// tokens. Integer amounts keep aggregated costs free of float drift.
+type Pricing struct {
+	InputPerMillion  int64
+	OutputPerMillion int64
+}
+
+// Cost is an estimated price in micro-dollars.
+type Cost struct {
+	Input  int64
+	Output int64
+	Total  int64
+}
+
+// Dollars returns the total cost in dollars, for display only.
+func (c Cost) Dollars() float64 {
+	return float64(c.Total) / 1e6
+}
+
+func (c Cost) String() string {
+	return fmt.Sprintf("$%d.%06d", c.Total/1e6, c.Total%1e6)
+}
+
+// Format returns the total cost in dollars rounded to decimals places,
+// between 0 and 6, e.g. "$12.50" for 2.
+func (c Cost) Format(decimals int) string {
+	if decimals < 0 {
+		decimals = 0
+	} else if decimals > 6 {
+		decimals = 6
+	}
+	unit := int64(1)
+	for i := decimals; i < 6; i++ {
+		unit *= 10
+	}
+	total := (c.Total + unit/2) / unit
+	if decimals == 0 {
+		return fmt.Sprintf("$%d", total)
+	}
+	scale := 1e6 / unit
+	return fmt.Sprintf("$%d.%0*d", total/scale, decimals, total%scale)
+}
+
+// usd converts a dollar amount per million tokens to micro-dollars.
+func usd(dollars float64) int64 {
+	return int64(dollars*1e6 + 0.5)
+}
+
+// modelPricing holds the default prices per model family, in USD per million
+// tokens. Model names are matched exactly first, then by the longest family
+// prefix, so "gpt-4o-2024-08-06" is priced as "gpt-4o".
+var modelPricing = map[string]Pricing{
+	// o200k family
+	"gpt-4.1":      {usd(2), usd(8)},
+	"gpt-4.1-mini": {usd(0.40), usd(1.60)},
+	"gpt-4.1-nano": {usd(0.10), usd(0.40)},
+	"gpt-4o":       {usd(2.50), usd(10)},
+	"gpt-4o-mini":  {usd(0.15), usd(0.60)},
+	"o1":           {usd(15), usd(60)},
+	"o1-mini":      {usd(1.10), usd(4.40)},
+	"o3":           {usd(2), usd(8)},
+	"o3-mini":      {usd(1.10), usd(4.40)},
+	"o4-mini":      {usd(1.10), usd(4.40)},
+	// cl100k family
+	"gpt-4-turbo":   {usd(10), usd(30)},
+	"gpt-4":         {usd(30), usd(60)},
+	"gpt-4-32k":     {usd(60), usd(120)},
+	"gpt-3.5-turbo": {usd(0.50), usd(1.50)},
+	// embeddings
+	"text-embedding-3-small": {usd(0.02), 0},
+	"text-embedding-3-large": {usd(0.13), 0},
+	"text-embedding-ada-002": {usd(0.10), 0},
+}
+
+var pricingMu sync.RWMutex
+
+// SetPricing adds or overrides the price of a model or model family.
+func SetPricing(model string, p Pricing) {
+	pricingMu.Lock()
+	defer pricingMu.Unlock()
+	modelPricing[model] = p
+}
+
+func lookupPricing(model string) (Pricing, bool) {
+	pricingMu.RLock()
+	defer pricingMu.RUnlock()
+	if p, ok := modelPricing[model]; ok {
+		return p, true
+	}
+	best := ""
+	for family := range modelPricing {
+		if len(family) > len(best) && strings.HasPrefix(model, family+"-") {
+			best = family
+		}
+	}
+	if best == "" {
+		return Pricing{}, false
+	}
+	return modelPricing[best], true
+}
+
+// EstimateCost prices a request with the given token counts. Input and output
+// amounts are rounded to the nearest micro-dollar independently.
+func EstimateCost(promptTokens, completionTokens int, model string) (Cost, error) {
+	p, ok := lookupPricing(model)
+	if !ok {
+		return Cost{}, fmt.Errorf("%w: %s", ErrPricingUnknown, model)
+	}
+	c := Cost{
+		Input:  priceTokens(promptTokens, p.InputPerMillion),
+		Output: priceTokens(completionTokens, p.OutputPerMillion),
+	}
+	c.Total = c.Input + c.Output
+	return c, nil
+}
+
+func priceTokens(tokens int, perMillion int64) int64 {
+	return (int64(tokens)*perMillion + 500000) / 1000000
+}
+
+// EstimatePromptCost prices text as the prompt of a request to model,
+// counting its tokens with the encoding of model as CountTokens does.
+func EstimatePromptCost(model, text string) (Cost, error) {
+	if _, ok := lookupPricing(model); !ok {
+		return Cost{}, fmt.Errorf("%w: %s", ErrPricingUnknown, model)
+	}
+	enc, err := EncodingForModel(model)
+	if err != nil {
+		return Cost{}, err
+	}
+	return EstimateCost(enc.CountTokens(text), 0, model)
+}
@@ -0,0 +1,77 @@
+package tiktoken
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateCost(t *testing.T) {
+	ass := assert.New(t)
+
+	cost, err := EstimateCost(1000000, 1000000, "gpt-4o")
+	ass.Nil(err)
+	ass.Equal(Cost{Input: 2500000, Output: 10000000, Total: 12500000}, cost)
+	ass.Equal("$12.500000", cost.String())
+
+	// longest family prefix wins
+	cost, err = EstimateCost(1000, 0, "gpt-4o-mini-2024-07-18")
+	ass.Nil(err)
+	ass.Equal(int64(150), cost.Total)
+
+	cost, err = EstimateCost(1000, 0, "text-embedding-3-small")
+	ass.Nil(err)
+	ass.Equal(int64(20), cost.Total)
+
+	_, err = EstimateCost(10, 10, "my-model")
+	ass.True(errors.Is(err, ErrPricingUnknown))
+
+	SetPricing("my-model", Pricing{InputPerMillion: usd(1), OutputPerMillion: usd(2)})
+	defer func() {
+		pricingMu.Lock()
+		delete(modelPricing, "my-model")
+		pricingMu.Unlock()
+	}()
+	cost, err = EstimateCost(500000, 250000, "my-model")
+	ass.Nil(err)
+	ass.Equal(Cost{Input: 500000, Output: 500000, Total: 1000000}, cost)
+}
+
+func TestCostFormat(t *testing.T) {
+	ass := assert.New(t)
+	cost := Cost{Total: 12345678}
+	ass.Equal("$12.35", cost.Format(2))
+	ass.Equal("$12", cost.Format(0))
+	ass.Equal("$12.345678", cost.Format(6))
+	ass.Equal("$12.345678", cost.Format(9))
+	ass.Equal("$0.01", Cost{Total: 5000}.Format(2))
+	ass.Equal("$0.000", Cost{Total: 499}.Format(3))
+}
+
+func TestEstimatePromptCost(t *testing.T) {
+	ass := assert.New(t)
+	_, err := EstimatePromptCost("my-qwen", "hello world")
+	ass.True(errors.Is(err, ErrPricingUnknown))
+
+	SetPricing("my-qwen", Pricing{InputPerMillion: usd(1e5), OutputPerMillion: usd(1e5)})
+	defer func() {
+		pricingMu.Lock()
+		delete(modelPricing, "my-qwen")
+		pricingMu.Unlock()
+	}()
+	_, err = EstimatePromptCost("my-qwen", "hello world")
+	ass.True(errors.Is(err, ErrModelNotFound))
+
+	ass.Nil(RegisterModel("my-qwen", MODEL_QWEN_BASE))
+	defer func() {
+		ml.Lock()
+		delete(MODEL_TO_ENCODING, "my-qwen")
+		ml.Unlock()
+	}()
+	// two tokens at 10 cents each
+	cost, err := EstimatePromptCost("my-qwen", "hello world")
+	ass.Nil(err)
+	ass.Equal(Cost{Input: 200000, Total: 200000}, cost)
+	ass.Equal("$0.20", cost.Format(2))
+}
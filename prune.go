@@ -0,0 +1,163 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// ErrPrunedEncodingName is returned by NewPrunedEncoding for a name that
+// belongs to the base encoding or a built-in one.
+var ErrPrunedEncodingName = errors.New("tiktoken: a pruned encoding can't use the name of an original encoding")
+
+// PruneVocab returns the tokens of the mergeable ranks src for which keep
+// returns true, with their ranks. Single-byte tokens are always kept,
+// without asking keep, so every text can still be encoded. A token whose
+// parts were dropped is still produced for a piece of the split pattern it
+// matches as a whole, so it is kept as asked. src isn't modified. It fails
+// if two tokens of src have the same rank.
+//
+// Text encoded with a pruned vocabulary falls back to shorter tokens where
+// the dropped ones were, so it has more tokens than with src. Build an
+// encoding of it with NewPrunedEncoding and measure the difference with
+// MeasureInflation.
+func PruneVocab(src map[string]int, keep func(piece []byte, rank int) bool) (map[string]int, error) {
+	tokens, err := tokensByRank(src)
+	if err != nil {
+		return nil, err
+	}
+	pruned := make(map[string]int, len(src))
+	for _, token := range tokens {
+		if rank := src[token]; len(token) == 1 || keep([]byte(token), rank) {
+			pruned[token] = rank
+		}
+	}
+	return pruned, nil
+}
+
+// PruneVocabTopN is PruneVocab keeping the n tokens of lowest rank, which
+// are merged first and are the most frequent in the text the vocabulary was
+// trained on, plus the single-byte tokens. The ranks of the result are
+// renumbered from 0 in the same order, so it has no gaps.
+func PruneVocabTopN(src map[string]int, n int) (map[string]int, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("cannot keep %d tokens", n)
+	}
+	tokens, err := tokensByRank(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(tokens) {
+		n = len(tokens)
+	}
+	limit := math.MinInt
+	if n > 0 {
+		limit = src[tokens[n-1]]
+	}
+	return densifyRanks(PruneVocab(src, func(_ []byte, rank int) bool { return rank <= limit }))
+}
+
+// tokensByRank returns the tokens of ranks in rank order.
+func tokensByRank(ranks map[string]int) ([]string, error) {
+	tokens := make([]string, 0, len(ranks))
+	for token := range ranks {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return ranks[tokens[i]] < ranks[tokens[j]] })
+	for i := 1; i < len(tokens); i++ {
+		if ranks[tokens[i]] == ranks[tokens[i-1]] {
+			return nil, fmt.Errorf("tokens %q and %q have the same rank %d", tokens[i-1], tokens[i], ranks[tokens[i]])
+		}
+	}
+	return tokens, nil
+}
+
+// densifyRanks renumbers ranks from 0 in rank order.
+func densifyRanks(ranks map[string]int, err error) (map[string]int, error) {
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokensByRank(ranks)
+	if err != nil {
+		return nil, err
+	}
+	for i, token := range tokens {
+		ranks[token] = i
+	}
+	return ranks, nil
+}
+
+// NewPrunedEncoding builds an encoding called name from ranks, a vocabulary
+// pruned from the mergeable ranks of base with PruneVocab or
+// PruneVocabTopN, with the split pattern and special tokens of base.
+//
+// A pruned encoding tokenizes text differently from base, with more
+// tokens, so its counts and tokens are only meaningful to the caller:
+// tokensDiffer must be true to acknowledge that, and name must be neither
+// the name of base nor of a built-in encoding, or it fails with
+// ErrPrunedEncodingName. The result is typically registered with
+// RegisterEncoding under its own name.
+func NewPrunedEncoding(base *Encoding, name string, ranks map[string]int, tokensDiffer bool) (*Encoding, error) {
+	if !tokensDiffer {
+		return nil, fmt.Errorf("pruned encoding %s tokenizes text differently from %s, pass tokensDiffer to acknowledge it", name, base.Name)
+	}
+	if name == base.Name {
+		return nil, fmt.Errorf("%w: %s", ErrPrunedEncodingName, name)
+	}
+	for _, builtin := range builtinEncodings {
+		if name == string(builtin) {
+			return nil, fmt.Errorf("%w: %s", ErrPrunedEncodingName, name)
+		}
+	}
+	tables, err := newRankTables(ranks)
+	if err != nil {
+		return nil, err
+	}
+	specials := make(map[string]int, len(base.SpecialTokens))
+	for token, id := range base.SpecialTokens {
+		specials[token] = id
+	}
+	return newEncoding(name, "", base.PatStr, tables, specials)
+}
+
+// Inflation compares the token counts of a corpus with a full and a pruned
+// vocabulary, see MeasureInflation. It marshals to JSON as is.
+type Inflation struct {
+	Bytes        int64 `json:"bytes"`
+	FullTokens   int64 `json:"full_tokens"`
+	PrunedTokens int64 `json:"pruned_tokens"`
+	// Ratio is PrunedTokens / FullTokens, 1 for an empty corpus.
+	Ratio float64 `json:"ratio"`
+}
+
+// MeasureInflation counts the tokens of corpus with full and with pruned,
+// typically an encoding of NewPrunedEncoding built from the vocabulary of
+// full, as TokenCounter counts them, to tell how many more tokens the pruned
+// vocabulary needs. Running it for several sizes of PruneVocabTopN shows
+// which one is accurate enough. The corpus is streamed once. It fails with
+// the first error of corpus.
+func MeasureInflation(full, pruned *Tiktoken, corpus io.Reader) (Inflation, error) {
+	var in Inflation
+	fullCounter, prunedCounter := full.NewTokenCounter(), pruned.NewTokenCounter()
+	bytes := writerFunc(func(p []byte) (int, error) {
+		in.Bytes += int64(len(p))
+		return len(p), nil
+	})
+	if _, err := io.Copy(io.MultiWriter(fullCounter, prunedCounter, bytes), corpus); err != nil {
+		return Inflation{}, err
+	}
+	if err := fullCounter.Flush(); err != nil {
+		return Inflation{}, err
+	}
+	if err := prunedCounter.Flush(); err != nil {
+		return Inflation{}, err
+	}
+	in.FullTokens, in.PrunedTokens = fullCounter.Count(), prunedCounter.Count()
+	in.Ratio = 1
+	if in.FullTokens > 0 {
+		in.Ratio = float64(in.PrunedTokens) / float64(in.FullTokens)
+	}
+	return in, nil
+}
@@ -0,0 +1,139 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const pruneCorpus = "Hello world, the end of it.\nThey'll say that's the thing to do, and then go on and on.\n"
+
+func TestPruneVocab(t *testing.T) {
+	ass := assert.New(t)
+	src := testEncoding().MergeableRanks
+	before := len(src)
+
+	bytesOnly, err := PruneVocab(src, func([]byte, int) bool { return false })
+	ass.Nil(err)
+	ass.Len(bytesOnly, 256)
+	ass.Equal(before, len(src), "src is not modified")
+
+	asked := 0
+	all, err := PruneVocab(src, func(piece []byte, rank int) bool {
+		asked++
+		ass.Equal(src[string(piece)], rank)
+		return true
+	})
+	ass.Nil(err)
+	ass.Equal(before-256, asked)
+	ass.Equal(src, all)
+
+	// "the" is kept without "th", for pieces that are "the" as a whole
+	noTH, err := PruneVocab(src, func(piece []byte, _ int) bool { return string(piece) != "th" })
+	ass.Nil(err)
+	ass.Len(noTH, before-1)
+	ass.Equal(src["the"], noTH["the"])
+
+	_, err = PruneVocab(map[string]int{"a": 0, "b": 0}, func([]byte, int) bool { return true })
+	ass.ErrorContains(err, "have the same rank 0")
+}
+
+func TestPruneVocabTopN(t *testing.T) {
+	ass := assert.New(t)
+	src := testEncoding().MergeableRanks
+
+	ranks, err := PruneVocabTopN(src, 270)
+	ass.Nil(err)
+	ass.LessOrEqual(len(ranks), 270)
+	ass.Greater(len(ranks), 256)
+	seen := make([]bool, len(ranks))
+	for token, rank := range ranks {
+		ass.Less(rank, len(ranks), token)
+		seen[rank] = true
+		if len(token) > 1 {
+			ass.Less(src[token], 270, token)
+		}
+	}
+	ass.NotContains(seen, false, "ranks are dense")
+	tokens, _ := tokensByRank(ranks)
+	srcTokens, _ := tokensByRank(src)
+	ass.Equal(srcTokens[:len(tokens)], tokens, "the order of ranks is kept")
+
+	ranks, err = PruneVocabTopN(src, 0)
+	ass.Nil(err)
+	ass.Len(ranks, 256)
+	_, err = PruneVocabTopN(src, -1)
+	ass.Error(err)
+}
+
+func TestNewPrunedEncoding(t *testing.T) {
+	ass := assert.New(t)
+	base := testEncoding()
+	full := GetTestEncoding()
+
+	ranks, err := PruneVocab(base.MergeableRanks, func([]byte, int) bool { return true })
+	ass.Nil(err)
+	_, err = NewPrunedEncoding(base, "test_pruned", ranks, false)
+	ass.ErrorContains(err, "pass tokensDiffer")
+	_, err = NewPrunedEncoding(base, base.Name, ranks, true)
+	ass.ErrorIs(err, ErrPrunedEncodingName)
+	_, err = NewPrunedEncoding(base, MODEL_CL100K_BASE, ranks, true)
+	ass.ErrorIs(err, ErrPrunedEncodingName)
+
+	enc, err := NewPrunedEncoding(base, "test_pruned", ranks, true)
+	ass.Nil(err)
+	ass.Equal(base.SpecialTokens, enc.SpecialTokens)
+	pruned, err := newTiktokenFromEncoding(enc)
+	ass.Nil(err)
+	ass.Equal("test_pruned", pruned.Name())
+	ass.Equal(full.Encode(pruneCorpus, nil, nil), pruned.Encode(pruneCorpus, nil, nil))
+	ass.Equal(pruneCorpus, pruned.Decode(pruned.Encode(pruneCorpus+testEndOfText, []string{"all"}, nil))[:len(pruneCorpus)])
+
+	in, err := MeasureInflation(full, pruned, strings.NewReader(pruneCorpus))
+	ass.Nil(err)
+	ass.Equal(Inflation{Bytes: int64(len(pruneCorpus)), FullTokens: int64(full.CountTokens(pruneCorpus)),
+		PrunedTokens: int64(full.CountTokens(pruneCorpus)), Ratio: 1}, in)
+
+	noTH, err := PruneVocab(base.MergeableRanks, func(piece []byte, _ int) bool { return string(piece) != "th" })
+	ass.Nil(err)
+	enc, err = NewPrunedEncoding(base, "test_no_th", noTH, true)
+	ass.Nil(err)
+	pruned, err = newTiktokenFromEncoding(enc)
+	ass.Nil(err)
+	ass.Equal(full.EncodeOrdinary("the"), pruned.EncodeOrdinary("the"))
+	ass.Greater(len(pruned.EncodeOrdinary("that")), len(full.EncodeOrdinary("that")))
+
+	ranks, err = PruneVocabTopN(base.MergeableRanks, 0)
+	ass.Nil(err)
+	enc, err = NewPrunedEncoding(base, "test_bytes", ranks, true)
+	ass.Nil(err)
+	pruned, err = newTiktokenFromEncoding(enc)
+	ass.Nil(err)
+	ass.Equal(pruneCorpus, pruned.Decode(pruned.EncodeOrdinary(pruneCorpus)))
+	in, err = MeasureInflation(full, pruned, strings.NewReader(pruneCorpus))
+	ass.Nil(err)
+	ass.Equal(int64(len(pruneCorpus)), in.PrunedTokens, "a token per byte")
+	ass.Greater(in.Ratio, 1.5)
+}
+
+func TestPruneVocabQwen(t *testing.T) {
+	ass := assert.New(t)
+	full, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	base := full.pbeEncoding
+
+	ranks, err := PruneVocabTopN(base.MergeableRanks, 5000)
+	ass.Nil(err)
+	ass.LessOrEqual(len(ranks), 5000)
+	enc, err := NewPrunedEncoding(base, "qwen_5k", ranks, true)
+	ass.Nil(err)
+	pruned, err := newTiktokenFromEncoding(enc)
+	ass.Nil(err)
+	ass.Equal(pruneCorpus, pruned.Decode(pruned.EncodeOrdinary(pruneCorpus)))
+
+	in, err := MeasureInflation(full, pruned, strings.NewReader(strings.Repeat(pruneCorpus, 10)))
+	ass.Nil(err)
+	ass.GreaterOrEqual(in.Ratio, 1.0)
+	ass.Less(in.Ratio, 1.5, "common English words are among the first ranks")
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package tiktoken
+
+// raceEnabled is set when testing with -race, whose sync.Pool drops items
+// at random, so code reusing pooled buffers allocates now and then.
+const raceEnabled = true
@@ -0,0 +1,169 @@
+package tiktoken
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// rankKey identifies a rank file loaded by a loader.
+type rankKey struct {
+	loader BpeLoader
+	uri    string
+}
+
+// rankCacheEntry is a rank file being or having been loaded. ready is closed
+// once tables or err is set.
+type rankCacheEntry struct {
+	ready  chan struct{}
+	tables *rankTables
+	err    error
+}
+
+// rankCache holds the parsed rank files of the encodings built so far, so
+// encodings sharing a file, like p50k_base and p50k_edit, parse it once and
+// share the tables. Loaders whose type isn't comparable are not cached.
+var rankCache = map[rankKey]*rankCacheEntry{}
+var rcl = &sync.Mutex{}
+
+// loadRankTables returns the tables of the rank file uri, calling load to
+// parse it unless another encoding already did. Concurrent calls for the
+// same file wait for the first one. Failures are not cached.
+func loadRankTables(loader BpeLoader, uri string, load func() (map[string]int, error)) (*rankTables, error) {
+	build := func() (*rankTables, error) {
+		ranks, err := load()
+		if err != nil {
+			return nil, err
+		}
+		return newRankTables(ranks)
+	}
+	if !reflect.TypeOf(loader).Comparable() {
+		return build()
+	}
+	key := rankKey{loader, uri}
+	rcl.Lock()
+	if e, ok := rankCache[key]; ok {
+		rcl.Unlock()
+		<-e.ready
+		return e.tables, e.err
+	}
+	e := &rankCacheEntry{ready: make(chan struct{})}
+	rankCache[key] = e
+	rcl.Unlock()
+
+	e.tables, e.err = build()
+	if e.err != nil {
+		rcl.Lock()
+		delete(rankCache, key)
+		rcl.Unlock()
+	}
+	close(e.ready)
+	return e.tables, e.err
+}
+
+// forgetRankTables drops the cached tables of uri for loader, so the next
+// encoding built on it parses the file again.
+func forgetRankTables(loader BpeLoader, uri string) {
+	if !reflect.TypeOf(loader).Comparable() {
+		return
+	}
+	rcl.Lock()
+	delete(rankCache, rankKey{loader, uri})
+	rcl.Unlock()
+}
+
+// forgetUnusedRankTables drops the cached tables with the mergeable ranks
+// ranks unless one of the cached encodings still uses them.
+func forgetUnusedRankTables(ranks map[string]int) {
+	p := reflect.ValueOf(ranks).Pointer()
+	uses := func(m map[string]int) bool {
+		return reflect.ValueOf(m).Pointer() == p
+	}
+	tl.Lock()
+	for _, tk := range tiktokenMap {
+		if uses(tk.bpe.encoder) {
+			tl.Unlock()
+			return
+		}
+	}
+	tl.Unlock()
+	ll.Lock()
+	for _, tk := range loaderTiktokenMap {
+		if uses(tk.bpe.encoder) {
+			ll.Unlock()
+			return
+		}
+	}
+	ll.Unlock()
+	l.Lock()
+	for _, enc := range encodingMap {
+		if uses(enc.MergeableRanks) {
+			l.Unlock()
+			return
+		}
+	}
+	l.Unlock()
+
+	rcl.Lock()
+	defer rcl.Unlock()
+	for key, e := range rankCache {
+		select {
+		case <-e.ready:
+			if e.tables != nil && uses(e.tables.encoder) {
+				delete(rankCache, key)
+			}
+		default:
+		}
+	}
+}
+
+// DeriveEncoding returns an encoding named name with the mergeable ranks
+// and pattern of base and its special tokens plus extraSpecials. The rank
+// tables are shared with base instead of copied, so e.g. cl100k_base with
+// ChatML tokens costs no more than the added tokens. It fails if an extra
+// special token reuses the id of a rank or of another special token.
+func DeriveEncoding(base *Encoding, name string, extraSpecials map[string]int) (*Encoding, error) {
+	specials := make(map[string]int, len(base.SpecialTokens)+len(extraSpecials))
+	ids := make(map[int]string, len(base.SpecialTokens)+len(extraSpecials))
+	for token, id := range base.SpecialTokens {
+		specials[token], ids[id] = id, token
+	}
+	for token, id := range extraSpecials {
+		if other, ok := ids[id]; ok && other != token {
+			return nil, fmt.Errorf("special token %s has id %d, which is also the id of %s", token, id, other)
+		}
+		specials[token], ids[id] = id, token
+	}
+	tables := base.tables
+	if tables == nil || !sameRanks(tables.encoder, base.MergeableRanks) {
+		var err error
+		if tables, err = newRankTables(base.MergeableRanks); err != nil {
+			return nil, err
+		}
+	}
+	for id, token := range ids {
+		if tables.hasRank(id) {
+			return nil, fmt.Errorf("special token %s has id %d, which is also a mergeable rank", token, id)
+		}
+	}
+	return &Encoding{
+		Name:           name,
+		SourceURI:      base.SourceURI,
+		PatStr:         base.PatStr,
+		MergeableRanks: base.MergeableRanks,
+		SpecialTokens:  specials,
+		tables:         tables,
+	}, nil
+}
+
+// LoadEncoding builds the named built-in or registered encoding without
+// caching it, for use with DeriveEncoding in a RegisterEncoding
+// constructor. Rank files already parsed for another encoding are reused.
+func LoadEncoding(encodingName string) (*Encoding, error) {
+	return initEncoding(encodingName)
+}
+
+// sameRanks reports whether a and b are the same map.
+func sameRanks(a, b map[string]int) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
@@ -0,0 +1,90 @@
+package tiktoken
+
+import (
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingLoader counts the rank files it parses.
+type countingLoader struct {
+	BpeLoader
+	loads int
+}
+
+func (l *countingLoader) LoadTiktokenBpe(tiktokenBpeFile string) (map[string]int, error) {
+	l.loads++
+	return l.BpeLoader.LoadTiktokenBpe(tiktokenBpeFile)
+}
+
+func (l *countingLoader) LoadTiktokenBpeFromFS(fs embed.FS, path string) (map[string]int, error) {
+	l.loads++
+	return l.BpeLoader.LoadTiktokenBpeFromFS(fs, path)
+}
+
+func TestSharedRankTables(t *testing.T) {
+	ass := assert.New(t)
+	// a file laid out like p50k_base: every byte, a few merges, then
+	// padding, with no rank 50256
+	var tokens []string
+	for b := 0; b < 256; b++ {
+		tokens = append(tokens, string([]byte{byte(b)}))
+	}
+	tokens = append(tokens, "he", "ll", "hell", "hello", " w", " wo", " wor", " worl", " world")
+	for len(tokens) < builtinSpecs[MODEL_P50K_BASE].expectedRanks {
+		tokens = append(tokens, fmt.Sprintf("<pad %d>", len(tokens)))
+	}
+	var content strings.Builder
+	for i, token := range tokens {
+		if i >= 50256 {
+			i++
+		}
+		content.WriteString(base64.StdEncoding.EncodeToString([]byte(token)) + " " + strconv.Itoa(i) + "\n")
+	}
+	fsys := fstest.MapFS{"p50k.tiktoken": {Data: []byte(content.String())}}
+	loader := &countingLoader{BpeLoader: NewFSBpeLoader(fsys, map[string]string{encodingSources[MODEL_P50K_BASE]: "p50k.tiktoken"})}
+	defer forgetRankTables(loader, encodingSources[MODEL_P50K_BASE])
+
+	base, err := GetEncodingWithLoader(MODEL_P50K_BASE, loader)
+	ass.Nil(err)
+	edit, err := GetEncodingWithLoader(MODEL_P50K_EDIT, loader)
+	ass.Nil(err)
+	ass.Equal(1, loader.loads, "the rank file should be parsed once")
+	ass.True(sameRanks(base.bpe.encoder, edit.bpe.encoder))
+	ass.Same(base.bpe.tables, edit.bpe.tables)
+
+	text := "hello world<|fim_prefix|>"
+	ass.Equal(base.EncodeOrdinary(text), edit.EncodeOrdinary(text))
+	ass.Equal([]int{259, 264, 50281}, edit.Encode("hello world<|fim_prefix|>", []string{"all"}, nil))
+	ass.Equal(50281, base.VocabSize())
+	ass.Equal(50284, edit.VocabSize())
+
+	_, err = DeriveEncoding(edit.pbeEncoding, "clash", map[string]int{"<|x|>": 50282})
+	ass.EqualError(err, "special token <|x|> has id 50282, which is also the id of <|fim_middle|>")
+	_, err = DeriveEncoding(edit.pbeEncoding, "clash", map[string]int{"<|x|>": 7})
+	ass.EqualError(err, "special token <|x|> has id 7, which is also a mergeable rank")
+}
+
+func TestDeriveEncoding(t *testing.T) {
+	ass := assert.New(t)
+	RegisterEncoding("qwen_test_derived", func() (*Encoding, error) {
+		base, err := LoadEncoding(MODEL_QWEN_BASE)
+		if err != nil {
+			return nil, err
+		}
+		return DeriveEncoding(base, "qwen_test_derived", map[string]int{"<|tool|>": 160000})
+	})
+	base, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	derived, err := GetEncoding("qwen_test_derived")
+	ass.Nil(err)
+	ass.True(sameRanks(base.bpe.encoder, derived.bpe.encoder))
+	ass.Equal([]int{14990, 160000}, derived.Encode("hello<|tool|>", []string{"all"}, nil))
+	ass.Equal("qwen_test_derived", derived.Name())
+}
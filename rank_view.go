@@ -0,0 +1,66 @@
+package tiktoken
+
+import "sort"
+
+// RankView is read-only access to the mergeable ranks of an encoding,
+// backed by the tables the encoder uses. It copies nothing and can't be
+// used to change them. Special tokens are not part of it, see SpecialRank.
+type RankView struct {
+	bpe *CoreBPE
+}
+
+// Ranks returns a view of the mergeable ranks of t. Use RanksCopy for a map
+// of your own.
+func (t *Tiktoken) Ranks() RankView {
+	t.bpe.mustOpen()
+	return RankView{t.bpe}
+}
+
+// RanksCopy returns a new map of the mergeable tokens of t to their ranks,
+// which the caller may modify.
+func (t *Tiktoken) RanksCopy() map[string]int {
+	t.bpe.mustOpen()
+	ranks := make(map[string]int, len(t.bpe.encoder))
+	for token, rank := range t.bpe.encoder {
+		ranks[token] = rank
+	}
+	return ranks
+}
+
+// Get returns the rank of piece, and false if piece isn't a mergeable
+// token. It doesn't allocate.
+func (v RankView) Get(piece []byte) (int, bool) {
+	rank, ok := v.bpe.encoder[string(piece)]
+	return rank, ok
+}
+
+// Len returns the number of mergeable tokens.
+func (v RankView) Len() int {
+	return len(v.bpe.encoder)
+}
+
+// Range calls fn with every mergeable token and its rank in rank order
+// until fn returns false. It doesn't allocate for dense ranks, which all
+// built-in encodings have.
+func (v RankView) Range(fn func(token string, rank int) bool) {
+	tables := v.bpe.tables
+	for rank := range tables.byRank {
+		if token, ok := tables.rankString(rank); ok && !fn(token, rank) {
+			return
+		}
+	}
+	if len(tables.sparse) == 0 {
+		return
+	}
+	sparse := make([]int, 0, len(tables.sparse))
+	for rank := range tables.sparse {
+		sparse = append(sparse, rank)
+	}
+	sort.Ints(sparse)
+	for _, rank := range sparse {
+		token, _ := tables.rankString(rank)
+		if !fn(token, rank) {
+			return
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build go1.23
+
+package tiktoken
+
+import "iter"
+
+// All returns the mergeable tokens and their ranks in rank order, as Range
+// visits them.
+func (v RankView) All() iter.Seq2[string, int] {
+	return func(yield func(string, int) bool) {
+		v.Range(yield)
+	}
+}
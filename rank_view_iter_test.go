@@ -0,0 +1,24 @@
+//go:build go1.23
+
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankViewAll(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	n := 0
+	for token, rank := range enc.Ranks().All() {
+		ass.Equal(rank, enc.bpe.encoder[token])
+		if n++; n == 10 {
+			break
+		}
+	}
+	ass.Equal(10, n)
+}
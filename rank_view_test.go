@@ -0,0 +1,57 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankView(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	ranks := enc.Ranks()
+	ass.Equal(151643, ranks.Len())
+	rank, ok := ranks.Get([]byte("hello"))
+	ass.True(ok)
+	ass.Equal(14990, rank)
+	_, ok = ranks.Get([]byte("<|endoftext|>"))
+	ass.False(ok, "special tokens are not ranks")
+	ass.Zero(testing.AllocsPerRun(100, func() { ranks.Get([]byte(" world")) }))
+
+	n, last := 0, -1
+	ranks.Range(func(token string, rank int) bool {
+		ass.Greater(rank, last)
+		last = rank
+		n++
+		return true
+	})
+	ass.Equal(ranks.Len(), n)
+	var first []string
+	ranks.Range(func(token string, rank int) bool {
+		first = append(first, token)
+		return len(first) < 3
+	})
+	ass.Equal([]string{"!", "\"", "#"}, first)
+
+	copied := enc.RanksCopy()
+	ass.Len(copied, ranks.Len())
+	copied["hello"] = 1
+	rank, _ = ranks.Get([]byte("hello"))
+	ass.Equal(14990, rank, "the copy is the caller's")
+
+	// ranks far beyond the others are visited last
+	sparse, err := newTiktokenFromEncoding(&Encoding{
+		Name:           "sparse",
+		PatStr:         testPattern,
+		MergeableRanks: map[string]int{"a": 0, "b": 1 << 20, "c": 1 << 21},
+	})
+	ass.Nil(err)
+	var order []int
+	sparse.Ranks().Range(func(token string, rank int) bool {
+		order = append(order, rank)
+		return true
+	})
+	ass.Equal([]int{0, 1 << 20, 1 << 21}, order)
+}
@@ -0,0 +1,163 @@
+package tiktoken
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactAndCount replaces every match of patterns in text with
+// replacement, taken literally, and returns the result and its number of
+// tokens as CountTokens counts them, encoding it once. Matches of all
+// patterns are found in the original text; overlapping matches are
+// replaced together. With input options such as WithNormalization the
+// patterns apply to the transformed text, which is what is returned.
+func (t *Tiktoken) RedactAndCount(text string, patterns []*regexp.Regexp, replacement string) (string, int) {
+	redacted, _ := redact(t.prepareText(text), patterns, replacement)
+	n, _ := t.countPieces(redacted, nil)
+	return redacted, n
+}
+
+// RedactAndCountIsolated is RedactAndCount, except that a space is put
+// before or after a replacement where it would otherwise merge with the
+// text next to it into one piece of the split pattern; a space already in
+// front of it is used instead where that is enough. Every replacement, with
+// the space before it if it needs one, then starts and ends at a piece
+// boundary, so it has the same tokens wherever it appears and budgets can
+// count it once.
+func (t *Tiktoken) RedactAndCountIsolated(text string, patterns []*regexp.Regexp, replacement string) (string, int) {
+	text = t.prepareText(text)
+	ranges := matchRanges(text, patterns)
+	pad := make([]padding, len(ranges))
+	for {
+		redacted, sites := redactRanges(text, ranges, pad, replacement)
+		n, boundaries := t.countPieces(redacted, sites)
+		changed := false
+		for i, site := range sites {
+			if !boundaries[site[0]] && pad[i].before < padInsert {
+				if pad[i].before == padNone && ranges[i][0] > 0 && text[ranges[i][0]-1] == ' ' {
+					pad[i].before = padAbsorb
+				} else {
+					pad[i].before = padInsert
+				}
+				changed = true
+			}
+			if !boundaries[site[1]] && !pad[i].after {
+				pad[i].after, changed = true, true
+			}
+		}
+		if !changed {
+			return redacted, n
+		}
+	}
+}
+
+// padding is how a replacement of RedactAndCountIsolated is padded.
+type padding struct {
+	before int
+	after  bool
+}
+
+// Values of padding.before. padAbsorb counts the space in front of the
+// replacement as its own, padInsert inserts one.
+const (
+	padNone = iota
+	padAbsorb
+	padInsert
+)
+
+// countPieces counts the tokens of text, which has been prepared, and
+// reports which of the offsets of sites are piece boundaries, if any.
+func (t *Tiktoken) countPieces(text string, sites [][2]int) (int, map[int]bool) {
+	var boundaries map[int]bool
+	if len(sites) > 0 {
+		boundaries = make(map[int]bool, 2*len(sites))
+		for _, site := range sites {
+			boundaries[site[0]], boundaries[site[1]] = false, false
+		}
+		boundaries[0], boundaries[len(text)] = true, true
+	}
+	n := 0
+	var tokens []int
+	t.bpe.forEachPieceRange(text, func(piece string, start, end int) {
+		if boundaries != nil {
+			if _, ok := boundaries[start]; ok {
+				boundaries[start] = true
+			}
+		}
+		tokens = t.bpe.appendPiece(tokens[:0], piece)
+		if len(t.filters) == 0 {
+			n += len(tokens)
+			return
+		}
+		for _, token := range tokens {
+			if _, ok := t.filterToken(token); ok {
+				n++
+			}
+		}
+	})
+	return n, boundaries
+}
+
+// matchRanges returns the byte ranges of the matches of patterns in text,
+// sorted and with overlapping ranges merged.
+func matchRanges(text string, patterns []*regexp.Regexp) [][2]int {
+	var ranges [][2]int
+	for _, re := range patterns {
+		for _, m := range re.FindAllStringIndex(text, -1) {
+			if m[1] > m[0] {
+				ranges = append(ranges, [2]int{m[0], m[1]})
+			}
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1] {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// redact replaces the matches of patterns in text with replacement and
+// returns the result with the range of each replacement in it.
+func redact(text string, patterns []*regexp.Regexp, replacement string) (string, [][2]int) {
+	ranges := matchRanges(text, patterns)
+	return redactRanges(text, ranges, make([]padding, len(ranges)), replacement)
+}
+
+// redactRanges replaces ranges of text with replacement, padded as pad
+// says, and returns the result with the range of each replacement in it,
+// including the space before it but not the one after.
+func redactRanges(text string, ranges [][2]int, pad []padding, replacement string) (string, [][2]int) {
+	if len(ranges) == 0 {
+		return text, nil
+	}
+	var sb strings.Builder
+	sb.Grow(len(text) + len(ranges)*(len(replacement)+2))
+	sites := make([][2]int, len(ranges))
+	last := 0
+	for i, r := range ranges {
+		sb.WriteString(text[last:r[0]])
+		sites[i][0] = sb.Len()
+		switch pad[i].before {
+		case padAbsorb:
+			sites[i][0]--
+		case padInsert:
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(replacement)
+		sites[i][1] = sb.Len()
+		if pad[i].after {
+			sb.WriteByte(' ')
+		}
+		last = r[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String(), sites
+}
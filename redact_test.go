@@ -0,0 +1,61 @@
+package tiktoken
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactAndCount(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`sk-[A-Za-z0-9]{8,}`),
+		regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	}
+	text := "key=sk-abcdef123456, ssn 123-45-6789 and keysk-zzzzzzzzzz. done"
+	redacted, n := tk.RedactAndCount(text, patterns, "[REDACTED]")
+	ass.Equal("key=[REDACTED], ssn [REDACTED] and key[REDACTED]. done", redacted)
+	ass.Equal(tk.CountTokens(redacted), n)
+
+	// overlapping matches are replaced once
+	overlapping := []*regexp.Regexp{regexp.MustCompile(`abc`), regexp.MustCompile(`bcd`), regexp.MustCompile(`de`)}
+	redacted, n = tk.RedactAndCount("xabcdey abc", overlapping, "#")
+	ass.Equal("x#y #", redacted)
+	ass.Equal(tk.CountTokens(redacted), n)
+
+	// the replacement is literal
+	redacted, _ = tk.RedactAndCount("id 123-45-6789", patterns, "$1")
+	ass.Equal("id $1", redacted)
+
+	redacted, n = tk.RedactAndCount("nothing here", patterns, "[REDACTED]")
+	ass.Equal("nothing here", redacted)
+	ass.Equal(tk.CountTokens("nothing here"), n)
+
+	isolated, n := tk.RedactAndCountIsolated(text, patterns, "[REDACTED]")
+	ass.Equal("key= [REDACTED] , ssn [REDACTED] and key[REDACTED] . done", isolated)
+	ass.Equal(tk.CountTokens(isolated), n)
+	// every padded replacement encodes as it does alone
+	tokens := tk.EncodeOrdinary(isolated)
+	for _, unit := range []string{" [REDACTED]", "[REDACTED]"} {
+		ass.Contains(tokenString(tokens), tokenString(tk.EncodeOrdinary(unit)), unit)
+	}
+
+	// letters merge with a replacement made of letters
+	isolated, n = tk.RedactAndCountIsolated("userJohnSmith logged in", []*regexp.Regexp{regexp.MustCompile(`JohnSmith`)}, "NAME")
+	ass.Equal("user NAME logged in", isolated)
+	ass.Equal(tk.CountTokens(isolated), n)
+
+	filtered := tk.WithTokenFilter(func(id int) (int, bool) { return id, id != 14990 })
+	_, n = filtered.RedactAndCount("hello world", patterns, "x")
+	ass.Equal(1, n)
+}
+
+// tokenString spells tokens so that Contains finds subsequences.
+func tokenString(tokens []int) string {
+	return fmt.Sprint(tokens)[1:len(fmt.Sprint(tokens))-1] + " "
+}
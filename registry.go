@@ -0,0 +1,337 @@
+package tiktoken
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dlclark/regexp2"
+)
+
+// EncodingSpec declares an encoding: where its mergeable ranks come from,
+// how text is split and its special tokens. ListEncodings describes the
+// known encodings with it, and RegisterEncodingSpec and
+// LoadEncodingRegistry add encodings from it without code.
+type EncodingSpec struct {
+	Name string `json:"name"`
+	// RankFile is the path or URI of the rank file in tiktoken format, ""
+	// for llama3, whose file the user supplies.
+	RankFile string `json:"rank_file"`
+	// RankFileHash is the hex sha256 of the rank file, "" if unknown. A
+	// download with another hash is rejected.
+	RankFileHash string `json:"rank_file_hash,omitempty"`
+	// ExpectedRanks is the number of mergeable ranks the rank file must
+	// hold, see WithExpectedRanks; 0 accepts any number.
+	ExpectedRanks  int            `json:"expected_ranks,omitempty"`
+	Pattern        string         `json:"pattern"`
+	SpecialTokens  map[string]int `json:"special_tokens,omitempty"`
+	ExplicitNVocab int            `json:"explicit_n_vocab,omitempty"`
+}
+
+// builtinSpec is the definition of a built-in encoding.
+type builtinSpec struct {
+	rankFile       string
+	pattern        string
+	specials       func() map[string]int
+	explicitNVocab int
+	expectedRanks  int
+	// gaps are the ids inside the rank range that belong to special tokens
+	// instead.
+	gaps []int
+	// base is the encoding whose rank tables and pattern a derived one
+	// shares; specials are added to the special tokens of base.
+	base string
+	// embedded rank files are read from tiktokenFS, and rankHash is their
+	// hash; the hashes of downloads are published ones, see
+	// KnownRankFileHash.
+	embedded bool
+	rankHash string
+	// userFile returns the rank file of an encoding whose file the user
+	// supplies.
+	userFile func() string
+}
+
+const openaiEncodings = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// builtinSpecs define the built-in encodings. llama3 is missing an
+// expected rank count because its tokenizer file is supplied by the user.
+var builtinSpecs = map[string]builtinSpec{
+	MODEL_CL100K_BASE: {
+		rankFile:      openaiEncodings + "cl100k_base.tiktoken",
+		pattern:       cl100kPattern,
+		specials:      cl100kSpecialTokens,
+		expectedRanks: 100256,
+	},
+	MODEL_O200K_BASE: {
+		rankFile:      openaiEncodings + "o200k_base.tiktoken",
+		pattern:       o200kPattern,
+		specials:      o200kSpecialTokens,
+		expectedRanks: 199998,
+	},
+	MODEL_O200K_HARMONY: {base: MODEL_O200K_BASE, specials: o200kHarmonyExtraTokens},
+	MODEL_P50K_BASE: {
+		rankFile:       openaiEncodings + "p50k_base.tiktoken",
+		pattern:        p50kPattern,
+		specials:       gpt2SpecialTokens,
+		explicitNVocab: 50281,
+		expectedRanks:  50280,
+		gaps:           []int{50256},
+	},
+	MODEL_P50K_EDIT: {base: MODEL_P50K_BASE, specials: p50kEditExtraTokens},
+	MODEL_R50K_BASE: {
+		rankFile:       openaiEncodings + "r50k_base.tiktoken",
+		pattern:        p50kPattern,
+		specials:       gpt2SpecialTokens,
+		explicitNVocab: 50257,
+		expectedRanks:  50256,
+	},
+	MODEL_QWEN_BASE: {
+		rankFile:      "tiktoken/qwen.tiktoken",
+		pattern:       qwenPattern,
+		specials:      qwenSpecialTokens,
+		expectedRanks: 151643,
+		embedded:      true,
+		rankHash:      qwenRankHash,
+	},
+	MODEL_LLAMA3: {pattern: cl100kPattern, specials: llama3SpecialTokens, userFile: currentLlama3TokenizerModel},
+}
+
+// encodingSources records where the rank file of each downloadable encoding
+// lives, so that its cache entry can be located again later.
+var encodingSources = func() map[string]string {
+	sources := map[string]string{}
+	for name, b := range builtinSpecs {
+		if b.base != "" {
+			b = builtinSpecs[b.base]
+		}
+		if !b.embedded && b.userFile == nil {
+			sources[name] = b.rankFile
+		}
+	}
+	return sources
+}()
+
+// builtinEncodingSpec returns the spec of a built-in encoding, resolving a
+// derived one against its base. The rank file hash of downloads is left to
+// KnownRankFileHash, which depends on encodingSources.
+func builtinEncodingSpec(name string) EncodingSpec {
+	b := builtinSpecs[name]
+	spec := EncodingSpec{
+		Name:           name,
+		RankFile:       b.rankFile,
+		RankFileHash:   b.rankHash,
+		ExpectedRanks:  b.expectedRanks,
+		Pattern:        b.pattern,
+		SpecialTokens:  b.specials(),
+		ExplicitNVocab: b.explicitNVocab,
+	}
+	if b.base != "" {
+		base := builtinEncodingSpec(b.base)
+		for token, id := range spec.SpecialTokens {
+			base.SpecialTokens[token] = id
+		}
+		base.Name, base.ExplicitNVocab = name, 0
+		return base
+	}
+	return spec
+}
+
+// publishedSpec is builtinEncodingSpec with the published hash of the rank
+// file of a download.
+func publishedSpec(name string) EncodingSpec {
+	spec := builtinEncodingSpec(name)
+	if hash, ok := KnownRankFileHash(spec.RankFile); ok && spec.RankFileHash == "" {
+		spec.RankFileHash = hash
+	}
+	return spec
+}
+
+// loadEncodingRanks loads the rank file of a built-in encoding and checks
+// its size, unless another encoding already loaded it.
+func loadEncodingRanks(loader BpeLoader, encodingName string) (*rankTables, error) {
+	b := builtinSpecs[encodingName]
+	return loadRankTables(loader, b.rankFile, func() (map[string]int, error) {
+		ranks, err := loader.LoadTiktokenBpe(b.rankFile)
+		if err != nil {
+			return nil, err
+		}
+		return checkRankCount(loader, b.rankFile, ranks, b.expectedRanks, b.gaps...)
+	})
+}
+
+// buildBuiltin builds a built-in encoding from rank files loaded with
+// loader.
+func buildBuiltin(loader BpeLoader, encodingName string) (*Encoding, error) {
+	b := builtinSpecs[encodingName]
+	switch {
+	case b.base != "":
+		base, err := buildBuiltin(loader, b.base)
+		if err != nil {
+			return nil, err
+		}
+		return DeriveEncoding(base, encodingName, b.specials())
+	case b.embedded:
+		tables, err := loadRankTables(loader, b.rankFile, func() (map[string]int, error) {
+			ranks, err := loader.LoadTiktokenBpeFromFS(tiktokenFS, b.rankFile)
+			if err != nil {
+				return nil, err
+			}
+			return checkRankCount(loader, "", ranks, b.expectedRanks)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newEncoding(encodingName, b.rankFile, b.pattern, tables, b.specials())
+	case b.userFile != nil:
+		path := b.userFile()
+		if path == "" {
+			return nil, fmt.Errorf("%s needs the tokenizer.model file, set LLAMA3_TOKENIZER_MODEL or call SetLlama3TokenizerModel", encodingName)
+		}
+		return newEncodingFromRankFile(loader, encodingName, path, b.pattern, b.specials(), WithExpectedRanks(b.expectedRanks))
+	}
+	tables, err := loadEncodingRanks(loader, encodingName)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoding{
+		Name:           encodingName,
+		SourceURI:      b.rankFile,
+		PatStr:         b.pattern,
+		MergeableRanks: tables.encoder,
+		SpecialTokens:  b.specials(),
+		ExplicitNVocab: b.explicitNVocab,
+		tables:         tables,
+	}, nil
+}
+
+// registeredSpecs are the specs of the encodings registered with
+// RegisterEncodingSpec, guarded by rl like encodingConstructors.
+var registeredSpecs = map[string]EncodingSpec{}
+
+// ListEncodings describes the built-in encodings followed by the registered
+// ones in sorted order, without loading them. Encodings registered with
+// RegisterEncoding only have their Name set, as only their constructor
+// knows the rest.
+func ListEncodings() []EncodingSpec {
+	names := knownEncodings()
+	specs := make([]EncodingSpec, 0, len(names))
+	rl.RLock()
+	defer rl.RUnlock()
+	for _, name := range names {
+		if _, ok := builtinSpecs[string(name)]; ok {
+			specs = append(specs, publishedSpec(string(name)))
+		} else if spec, ok := registeredSpecs[string(name)]; ok {
+			spec.SpecialTokens = copySpecials(spec.SpecialTokens)
+			specs = append(specs, spec)
+		} else {
+			specs = append(specs, EncodingSpec{Name: string(name)})
+		}
+	}
+	return specs
+}
+
+func copySpecials(specials map[string]int) map[string]int {
+	copied := make(map[string]int, len(specials))
+	for token, id := range specials {
+		copied[token] = id
+	}
+	return copied
+}
+
+// RegisterEncodingSpec makes GetEncoding build the encoding spec declares,
+// loading its rank file with the current BpeLoader on first use, as
+// RegisterEncoding would with a constructor calling
+// NewEncodingFromRankFile. It fails if the spec has no name, rank file or
+// pattern, if the pattern doesn't compile or if it names a built-in
+// encoding.
+func RegisterEncodingSpec(spec EncodingSpec) error {
+	switch {
+	case spec.Name == "":
+		return errors.New("encoding spec has no name")
+	case spec.RankFile == "":
+		return fmt.Errorf("encoding %s has no rank file", spec.Name)
+	case spec.Pattern == "":
+		return fmt.Errorf("encoding %s has no pattern", spec.Name)
+	}
+	if _, ok := builtinSpecs[spec.Name]; ok {
+		return fmt.Errorf("encoding %s is built in and can't be replaced", spec.Name)
+	}
+	if _, err := regexp2.Compile(spec.Pattern, regexp2.None); err != nil {
+		return fmt.Errorf("encoding %s: %w", spec.Name, err)
+	}
+	spec.SpecialTokens = copySpecials(spec.SpecialTokens)
+
+	rl.Lock()
+	defer rl.Unlock()
+	registeredSpecs[spec.Name] = spec
+	encodingConstructors[spec.Name] = func() (*Encoding, error) {
+		opts := []RankFileOption{WithExpectedRanks(spec.ExpectedRanks)}
+		if spec.RankFileHash != "" {
+			opts = append(opts, WithRankFileHash(spec.RankFileHash))
+		}
+		enc, err := NewEncodingFromRankFile(spec.Name, spec.RankFile, spec.Pattern, copySpecials(spec.SpecialTokens), opts...)
+		if err != nil {
+			return nil, err
+		}
+		enc.ExplicitNVocab = spec.ExplicitNVocab
+		return enc, nil
+	}
+	return nil
+}
+
+// EncodingRegistry is the content of a registry file read by
+// LoadEncodingRegistry.
+type EncodingRegistry struct {
+	Encodings []EncodingSpec `json:"encodings"`
+	// Models map model names to encodings, as RegisterModel does.
+	Models map[string]string `json:"models,omitempty"`
+	// ModelPrefixes map model name prefixes to encodings, as
+	// RegisterModelPrefix does.
+	ModelPrefixes map[string]string `json:"model_prefixes,omitempty"`
+}
+
+// LoadEncodingRegistry registers the encodings and models of the JSON
+// registry file at path, an EncodingRegistry, e.g.
+//
+//	{
+//	  "encodings": [{
+//	    "name": "acme_base",
+//	    "rank_file": "https://models.example.com/acme_base.tiktoken",
+//	    "rank_file_hash": "…",
+//	    "pattern": "…",
+//	    "special_tokens": {"<|endoftext|>": 100000}
+//	  }],
+//	  "models": {"acme-chat": "acme_base"}
+//	}
+//
+// so new encodings can be rolled out with configuration. The encodings
+// are registered with RegisterEncodingSpec and load on first use. It
+// stops at the first invalid encoding or model, leaving those before it
+// registered.
+func LoadEncodingRegistry(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var registry EncodingRegistry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, spec := range registry.Encodings {
+		if err := RegisterEncodingSpec(spec); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for model, encoding := range registry.Models {
+		if err := RegisterModel(model, encoding); err != nil {
+			return fmt.Errorf("%s: model %s: %w", path, model, err)
+		}
+	}
+	for prefix, encoding := range registry.ModelPrefixes {
+		if err := RegisterModelPrefix(prefix, encoding); err != nil {
+			return fmt.Errorf("%s: model prefix %s: %w", path, prefix, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package tiktoken
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListEncodings(t *testing.T) {
+	ass := assert.New(t)
+	specs := ListEncodings()
+	ass.GreaterOrEqual(len(specs), len(builtinEncodings))
+	for i, name := range builtinEncodings {
+		ass.Equal(string(name), specs[i].Name)
+		ass.NotEmpty(specs[i].Pattern, name)
+	}
+	byName := map[string]EncodingSpec{}
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+
+	cl100k := byName[MODEL_CL100K_BASE]
+	ass.Equal(encodingSources[MODEL_CL100K_BASE], cl100k.RankFile)
+	ass.Equal("223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7", cl100k.RankFileHash)
+	ass.Equal(100256, cl100k.ExpectedRanks)
+	ass.Equal(100257, cl100k.SpecialTokens[ENDOFTEXT])
+
+	harmony := byName[MODEL_O200K_HARMONY]
+	ass.Equal(byName[MODEL_O200K_BASE].RankFile, harmony.RankFile)
+	ass.Equal(o200kPattern, harmony.Pattern)
+	ass.Equal(199999, harmony.SpecialTokens[ENDOFTEXT])
+	ass.Equal(200002, harmony.SpecialTokens["<|return|>"])
+	ass.Equal(50281, byName[MODEL_P50K_BASE].ExplicitNVocab)
+	ass.Equal(qwenRankHash, byName[MODEL_QWEN_BASE].RankFileHash)
+	ass.Empty(byName[MODEL_LLAMA3].RankFile)
+
+	// the specs are copies
+	cl100k.SpecialTokens[ENDOFTEXT] = 1
+	ass.Equal(100257, publishedSpec(MODEL_CL100K_BASE).SpecialTokens[ENDOFTEXT])
+
+	qwen, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Equal(byName[MODEL_QWEN_BASE].SpecialTokens, qwen.SpecialTokens())
+}
+
+func forgetRegisteredSpec(name string) {
+	ReleaseEncoding(name)
+	rl.Lock()
+	delete(encodingConstructors, name)
+	delete(registeredSpecs, name)
+	rl.Unlock()
+}
+
+func TestLoadEncodingRegistry(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	var ranks strings.Builder
+	for b := 0; b < 256; b++ {
+		ranks.WriteString(base64.StdEncoding.EncodeToString([]byte{byte(b)}) + " " + strconv.Itoa(b) + "\n")
+	}
+	ranks.WriteString(base64.StdEncoding.EncodeToString([]byte("ab")) + " 256\n")
+	rankFile := filepath.Join(dir, "registry_test.tiktoken")
+	ass.Nil(os.WriteFile(rankFile, []byte(ranks.String()), 0o644))
+
+	registry := filepath.Join(dir, "encodings.json")
+	ass.Nil(os.WriteFile(registry, []byte(`{
+		"encodings": [{
+			"name": "registry_test_base",
+			"rank_file": `+strconv.Quote(rankFile)+`,
+			"expected_ranks": 257,
+			"pattern": "\\w+|\\s+|.",
+			"special_tokens": {"<|end|>": 257},
+			"explicit_n_vocab": 258
+		}],
+		"models": {"registry-test-chat": "registry_test_base"}
+	}`), 0o644))
+	ass.Nil(LoadEncodingRegistry(registry))
+	defer func() {
+		forgetRegisteredSpec("registry_test_base")
+		ml.Lock()
+		delete(MODEL_TO_ENCODING, "registry-test-chat")
+		ml.Unlock()
+	}()
+
+	specs := ListEncodings()
+	ass.Contains(specs, EncodingSpec{
+		Name:           "registry_test_base",
+		RankFile:       rankFile,
+		ExpectedRanks:  257,
+		Pattern:        `\w+|\s+|.`,
+		SpecialTokens:  map[string]int{"<|end|>": 257},
+		ExplicitNVocab: 258,
+	})
+	enc, err := EncodingForModel("registry-test-chat")
+	ass.Nil(err)
+	ass.Equal("registry_test_base", enc.Name())
+	ass.Equal([]int{256, 32, 99, 257}, enc.Encode("ab c<|end|>", []string{"all"}, nil))
+	ass.Equal(258, enc.VocabSize())
+
+	// a constructor replaces the spec
+	RegisterEncoding("registry_test_base", func() (*Encoding, error) { return LoadEncoding(MODEL_QWEN_BASE) })
+	ass.Contains(ListEncodings(), EncodingSpec{Name: "registry_test_base"})
+}
+
+func TestRegisterEncodingSpecErrors(t *testing.T) {
+	ass := assert.New(t)
+	ass.EqualError(RegisterEncodingSpec(EncodingSpec{}), "encoding spec has no name")
+	ass.EqualError(RegisterEncodingSpec(EncodingSpec{Name: "x", Pattern: `.`}), "encoding x has no rank file")
+	ass.EqualError(RegisterEncodingSpec(EncodingSpec{Name: "x", RankFile: "x.tiktoken"}), "encoding x has no pattern")
+	ass.EqualError(RegisterEncodingSpec(EncodingSpec{Name: MODEL_CL100K_BASE, RankFile: "x.tiktoken", Pattern: `.`}), "encoding cl100k_base is built in and can't be replaced")
+	ass.ErrorContains(RegisterEncodingSpec(EncodingSpec{Name: "x", RankFile: "x.tiktoken", Pattern: `(`}), "encoding x: ")
+	_, err := ParseEncoding("x")
+	ass.ErrorIs(err, ErrEncodingNotFound, "failed specs aren't registered")
+
+	path := filepath.Join(t.TempDir(), "bad.json")
+	ass.Nil(os.WriteFile(path, []byte(`{"encodings": [{"name": "x"}]}`), 0o644))
+	ass.EqualError(LoadEncodingRegistry(path), path+": encoding x has no rank file")
+	ass.Nil(os.WriteFile(path, []byte(`[`), 0o644))
+	ass.ErrorContains(LoadEncodingRegistry(path), path+": ")
+}
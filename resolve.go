@@ -0,0 +1,56 @@
+package tiktoken
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ModelInfo describes how EncodingForModel would resolve a model name.
+type ModelInfo struct {
+	// Model is the name as registered, which may differ from the one looked
+	// up in case and surrounding whitespace.
+	Model    string
+	Encoding EncodingName
+	// Exact is set if the name is in MODEL_TO_ENCODING. Otherwise Prefix is
+	// the MODEL_PREFIX_TO_ENCODING entry that matched.
+	Exact  bool
+	Prefix string
+	// Loaded reports whether GetEncoding holds the encoding, so that
+	// EncodingForModel returns without loading anything.
+	Loaded bool
+}
+
+// ResolveModel reports the encoding EncodingForModel would use for
+// modelName without loading it. It neither reads files nor touches the
+// network, and doesn't wait for encodings being loaded by other goroutines,
+// so it is cheap enough for a readiness probe. It fails with
+// ErrModelNotFound for unknown models and with ErrEncodingNotFound if the
+// model maps to an encoding that is neither built in nor registered.
+func ResolveModel(modelName string) (ModelInfo, error) {
+	model, encodingName, prefix, ok := matchModel(modelName)
+	if !ok {
+		return ModelInfo{}, fmt.Errorf("%w %s", ErrModelNotFound, modelName)
+	}
+	name, err := ParseEncoding(encodingName)
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	lnl.RLock()
+	defer lnl.RUnlock()
+	return ModelInfo{Model: model, Encoding: name, Exact: prefix == "", Prefix: prefix, Loaded: loadedNames[encodingName]}, nil
+}
+
+// loadedNames mirrors the keys of tiktokenMap under a lock of its own, as tl
+// is held while GetEncoding loads an encoding.
+var loadedNames = map[string]bool{}
+var lnl = &sync.RWMutex{}
+
+func setLoaded(encodingName string, loaded bool) {
+	lnl.Lock()
+	defer lnl.Unlock()
+	if loaded {
+		loadedNames[encodingName] = true
+	} else {
+		delete(loadedNames, encodingName)
+	}
+}
@@ -0,0 +1,118 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveModel(t *testing.T) {
+	ass := assert.New(t)
+	loader := &countingLoader{BpeLoader: NewDefaultBpeLoader()}
+	SetBpeLoader(loader)
+	defer SetBpeLoader(NewDefaultBpeLoader())
+
+	info, err := ResolveModel("gpt-4o")
+	ass.Nil(err)
+	ass.Equal(ModelInfo{Model: "gpt-4o", Encoding: O200KBase, Exact: true}, info)
+
+	info, err = ResolveModel("gpt-4o-mini-2024-07-18")
+	ass.Nil(err)
+	ass.Equal(O200KBase, info.Encoding)
+	ass.False(info.Exact)
+	ass.Equal("gpt-4o-", info.Prefix)
+
+	ReleaseEncoding(MODEL_QWEN_BASE)
+	info, err = ResolveModel("qwen2-7b")
+	ass.Nil(err)
+	ass.False(info.Loaded)
+	ass.Zero(loader.loads, "resolving loads nothing")
+	_, err = GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	info, err = ResolveModel("qwen2-7b")
+	ass.Nil(err)
+	ass.True(info.Loaded)
+
+	_, err = ResolveModel("no-such-model")
+	ass.ErrorIs(err, ErrModelNotFound)
+	RegisterModel("resolve-test-model", "no_such_encoding")
+	defer func() {
+		ml.Lock()
+		delete(MODEL_TO_ENCODING, "resolve-test-model")
+		ml.Unlock()
+	}()
+	_, err = ResolveModel("resolve-test-model")
+	ass.ErrorIs(err, ErrEncodingNotFound)
+}
+
+func TestModelNameNormalization(t *testing.T) {
+	ass := assert.New(t)
+	for _, name := range []string{"GPT-4o", " gpt-4o\n", "Gpt-4O"} {
+		info, err := ResolveModel(name)
+		ass.Nil(err, name)
+		ass.Equal(ModelInfo{Model: "gpt-4o", Encoding: O200KBase, Exact: true}, info, name)
+	}
+	info, err := ResolveModel("Gpt-3.5-Turbo")
+	ass.Nil(err)
+	ass.Equal("gpt-3.5-turbo", info.Model)
+
+	// prefixes match after normalization, keeping the registered casing
+	info, err = ResolveModel("  GPT-4o-Mini-2024-07-18 ")
+	ass.Nil(err)
+	ass.Equal(O200KBase, info.Encoding)
+	ass.Equal("gpt-4o-", info.Prefix)
+	ass.Equal("gpt-4o-Mini-2024-07-18", info.Model)
+	info, err = ResolveModel("META-LLAMA/llama-3.2-1B")
+	ass.Nil(err)
+	ass.Equal("meta-llama/Llama-3.2-1B", info.Model)
+
+	tk, err := EncodingForModel("Qwen2-7B-Instruct\t")
+	ass.Nil(err)
+	ass.Equal(MODEL_QWEN_BASE, tk.Name())
+	ass.Equal("qwen2-7B-Instruct", tk.Model())
+
+	// names differing only by case can't both be registered
+	defer func() {
+		ml.Lock()
+		delete(MODEL_TO_ENCODING, "Norm-Test")
+		delete(MODEL_PREFIX_TO_ENCODING, "norm-test-")
+		ml.Unlock()
+	}()
+	ass.Nil(RegisterModel(" Norm-Test ", MODEL_QWEN_BASE))
+	ass.Nil(RegisterModel("Norm-Test", MODEL_QWEN_BASE))
+	ass.ErrorIs(RegisterModel("norm-test", MODEL_CL100K_BASE), ErrModelConflict)
+	info, err = ResolveModel("NORM-TEST")
+	ass.Nil(err)
+	ass.Equal(ModelInfo{Model: "Norm-Test", Encoding: QwenBase, Exact: true, Loaded: info.Loaded}, info)
+	ass.Nil(RegisterModelPrefix("norm-test-", MODEL_QWEN_BASE))
+	ass.ErrorIs(RegisterModelPrefix("Norm-Test-", MODEL_QWEN_BASE), ErrModelConflict)
+}
+
+func TestResolveO200kHarmony(t *testing.T) {
+	ass := assert.New(t)
+	info, err := ResolveModel("gpt-oss-20b")
+	ass.Nil(err)
+	ass.Equal(O200KHarmony, info.Encoding)
+	info, err = ResolveModel("gpt-oss-safeguard-20b")
+	ass.Nil(err)
+	ass.Equal(O200KHarmony, info.Encoding)
+	ass.Equal("gpt-oss-", info.Prefix)
+
+	def, ok := builtinDefinition(MODEL_O200K_HARMONY)
+	ass.True(ok)
+	ass.Len(def.specials, 201088-199998)
+	ass.Equal(200006, def.specials["<|start|>"])
+	ass.Equal(200018, def.specials[ENDOFPROMPT])
+	ass.Equal(201087, def.specials["<|reserved_201087|>"])
+	ids := map[int]bool{}
+	for _, id := range def.specials {
+		ass.False(ids[id], "id %d is taken twice", id)
+		ids[id] = true
+	}
+
+	ass.Nil(SetModelEncoding("gpt-oss-20b", MODEL_O200K_BASE))
+	defer SetModelEncoding("gpt-oss-20b", MODEL_O200K_HARMONY)
+	info, err = ResolveModel("gpt-oss-20b")
+	ass.Nil(err)
+	ass.Equal(O200KBase, info.Encoding)
+}
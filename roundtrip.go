@@ -0,0 +1,91 @@
+package tiktoken
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// RoundTripError is returned by ValidateRoundTrip for a text that doesn't
+// decode back to itself.
+type RoundTripError struct {
+	// Mode is the encode call that produced the tokens: "EncodeOrdinary",
+	// or "Encode" with all special tokens allowed.
+	Mode string
+	// Offset is the index of the first byte where the decoded text differs
+	// from the text. It may be the length of the shorter of the two.
+	Offset int
+	// Want and Got are the text and the decoded text from a few bytes
+	// before Offset on.
+	Want, Got string
+	// Invalid is set if the text isn't valid UTF-8 up to Offset. The encoder
+	// reads such bytes, including lone surrogates encoded as WTF-8, as
+	// U+FFFD, so they never round-trip.
+	Invalid bool
+}
+
+func (e *RoundTripError) Error() string {
+	msg := fmt.Sprintf("round trip of %s differs at byte %d: %q decodes as %q", e.Mode, e.Offset, e.Want, e.Got)
+	if e.Invalid {
+		msg += " (invalid UTF-8 in the text)"
+	}
+	return msg
+}
+
+// roundTripContext is the number of bytes before the divergence that a
+// RoundTripError shows.
+const roundTripContext = 8
+
+// ValidateRoundTrip checks that text, which may be arbitrary bytes,
+// decodes back to itself after EncodeOrdinary and after Encode with all
+// special tokens allowed, and returns a *RoundTripError for the first one
+// that doesn't. Valid UTF-8 always should; a failure is a bug worth
+// reporting unless t transforms text, as WithNormalization and token
+// filters do. See FuzzRoundTrip for a fuzz target built on it.
+func (t *Tiktoken) ValidateRoundTrip(text string) error {
+	if t.isClosed() {
+		return ErrClosed
+	}
+	if err := roundTrip("EncodeOrdinary", text, t.Decode(t.EncodeOrdinary(text))); err != nil {
+		return err
+	}
+	tokens, err := t.EncodeWithError(text, []string{"all"}, nil)
+	if err != nil {
+		return err
+	}
+	return roundTrip("Encode", text, t.Decode(tokens))
+}
+
+// roundTrip compares text with what it decoded to.
+func roundTrip(mode, text, decoded string) error {
+	offset := 0
+	for offset < len(text) && offset < len(decoded) && text[offset] == decoded[offset] {
+		offset++
+	}
+	if offset == len(text) && offset == len(decoded) {
+		return nil
+	}
+	from := offset - roundTripContext
+	if from < 0 {
+		from = 0
+	}
+	excerpt := func(s string) string {
+		start, end := from, offset+roundTripContext
+		if end > len(s) {
+			end = len(s)
+		}
+		// whole characters where the bytes allow it
+		for start > 0 && start > from-utf8.UTFMax && !utf8.RuneStart(s[start]) {
+			start--
+		}
+		for end < len(s) && end < offset+roundTripContext+utf8.UTFMax && !utf8.RuneStart(s[end]) {
+			end++
+		}
+		return s[start:end]
+	}
+	end := offset + utf8.UTFMax
+	if end > len(text) {
+		end = len(text)
+	}
+	invalid := !utf8.ValidString(text[:end])
+	return &RoundTripError{Mode: mode, Offset: offset, Want: excerpt(text), Got: excerpt(decoded), Invalid: invalid}
+}
@@ -0,0 +1,30 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRoundTrip(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	for _, text := range []string{"", "hello world", "<|endoftext|> and <|im_start|>", "👨‍👩‍👧‍👦 你好", "\x00\x01\x7f"} {
+		ass.Nil(enc.ValidateRoundTrip(text), "%q", text)
+	}
+
+	// a lone surrogate, as WTF-8 from a UTF-16 source
+	err = enc.ValidateRoundTrip("surrogate: \xed\xa0\x80!")
+	var rt *RoundTripError
+	if ass.ErrorAs(err, &rt) {
+		ass.Equal(RoundTripError{Mode: "EncodeOrdinary", Offset: 11, Want: "rogate: \xed\xa0\x80!", Got: "rogate: ���", Invalid: true}, *rt)
+	}
+	ass.EqualError(err, `round trip of EncodeOrdinary differs at byte 11: "rogate: \xed\xa0\x80!" decodes as "rogate: ���" (invalid UTF-8 in the text)`)
+
+	err = enc.ValidateRoundTrip("x\xef\xbf")
+	if ass.ErrorAs(err, &rt) {
+		ass.Equal(3, rt.Offset)
+		ass.True(rt.Invalid)
+	}
+}
@@ -0,0 +1,77 @@
+package tiktoken
+
+import "math/rand"
+
+// Window is a run of consecutive tokens of a text.
+type Window struct {
+	// Text is the part of the text the tokens encode. It starts or ends in
+	// the middle of a character if a token boundary does.
+	Text string
+	// Start and End are the byte range of Text in the text. With input
+	// options such as WithNormalization they refer to the transformed text.
+	Start, End int
+	Tokens     []int
+}
+
+// SampleWindows returns count windows of exactly windowTokens consecutive
+// tokens of text, at random token offsets drawn from seed, so the same
+// arguments always give the same windows. Text is encoded once, as
+// Encode(text, nil, nil) does without checking disallowed special tokens.
+// The windows start at different tokens unless count is larger than the
+// number of possible starts; they may overlap. A text of fewer than
+// windowTokens tokens is returned whole as a single window, and an empty
+// text or a count or windowTokens below 1 gives none.
+func (t *Tiktoken) SampleWindows(text string, windowTokens, count int, seed int64) []Window {
+	if windowTokens < 1 || count < 1 {
+		return nil
+	}
+	prepared := t.prepareText(text)
+	var tokens, offsets []int
+	t.walkTokens(text, func(token, offset int) bool {
+		tokens = append(tokens, token)
+		offsets = append(offsets, offset)
+		return true
+	})
+	if len(tokens) == 0 {
+		return nil
+	}
+	offsets = append(offsets, len(prepared))
+
+	window := func(start int) Window {
+		end := start + windowTokens
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		from, to := offsets[start], offsets[end]
+		return Window{Text: prepared[from:to], Start: from, End: to, Tokens: tokens[start:end:end]}
+	}
+	starts := len(tokens) - windowTokens + 1
+	if starts < 1 {
+		return []Window{window(0)}
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	windows := make([]Window, 0, count)
+	if count > starts {
+		for i := 0; i < count; i++ {
+			windows = append(windows, window(r.Intn(starts)))
+		}
+		return windows
+	}
+	// a partial Fisher-Yates shuffle of the starts, keeping only the moved
+	// entries
+	moved := map[int]int{}
+	at := func(i int) int {
+		if v, ok := moved[i]; ok {
+			return v
+		}
+		return i
+	}
+	for i := 0; i < count; i++ {
+		j := i + r.Intn(starts-i)
+		vi, vj := at(i), at(j)
+		moved[j] = vi
+		windows = append(windows, window(vj))
+	}
+	return windows
+}
@@ -0,0 +1,48 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleWindows(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. 你好，世界！ ", 20)
+	all := tk.Encode(text, nil, nil)
+
+	windows := tk.SampleWindows(text, 8, 25, 42)
+	ass.Len(windows, 25)
+	starts := map[int]bool{}
+	for _, w := range windows {
+		ass.Len(w.Tokens, 8)
+		ass.Equal(text[w.Start:w.End], w.Text)
+		ass.Equal(w.Text, tk.Decode(w.Tokens))
+		ass.False(starts[w.Start], "start %d sampled twice", w.Start)
+		starts[w.Start] = true
+	}
+	ass.Equal(windows, tk.SampleWindows(text, 8, 25, 42))
+	ass.NotEqual(windows, tk.SampleWindows(text, 8, 25, 43))
+
+	// every start, once each, when count is the number of starts
+	n := len(all) - 8 + 1
+	windows = tk.SampleWindows(text, 8, n, 1)
+	seen := map[int]bool{}
+	for _, w := range windows {
+		seen[w.Start] = true
+	}
+	ass.Len(seen, n)
+
+	// with replacement beyond that
+	ass.Len(tk.SampleWindows(text, len(all)-1, 5, 1), 5)
+
+	short := tk.SampleWindows("hello world", 8, 3, 1)
+	ass.Equal([]Window{{Text: "hello world", Start: 0, End: 11, Tokens: []int{14990, 1879}}}, short)
+	ass.Nil(tk.SampleWindows("", 8, 3, 1))
+	ass.Nil(tk.SampleWindows(text, 0, 3, 1))
+	ass.Nil(tk.SampleWindows(text, 8, 0, 1))
+}
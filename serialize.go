@@ -0,0 +1,225 @@
+package tiktoken
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Serialized encodings start with serializeMagic followed by a big-endian
+// uint16 format version. The body is a sequence of uvarint-prefixed fields:
+//
+//	name, pattern, explicit n_vocab,
+//	rank count, then (token bytes, rank) pairs in rank order,
+//	special token count, then (token text, id) pairs in id order,
+//
+// where ranks and ids are zigzag varints, and the payload ends with the
+// big-endian CRC-32 (IEEE) of everything before it. Version 1 stored ranks
+// and ids as uvarints, which can't hold negative ones; ReadFrom still
+// reads it.
+const (
+	serializeMagic   = "TKTN"
+	serializeVersion = 2
+
+	// maxSerializedString bounds any single string read back, so a corrupted
+	// length can't make ReadFrom allocate unbounded memory.
+	maxSerializedString = 1 << 24
+)
+
+var errCorruptEncoding = errors.New("corrupt serialized encoding")
+
+type serialWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (sw *serialWriter) write(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	n, err := sw.w.Write(b)
+	sw.n += int64(n)
+	sw.err = err
+}
+
+func (sw *serialWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(sw.buf[:], v)
+	sw.write(sw.buf[:n])
+}
+
+func (sw *serialWriter) varint(v int) {
+	n := binary.PutVarint(sw.buf[:], int64(v))
+	sw.write(sw.buf[:n])
+}
+
+func (sw *serialWriter) bytes(b []byte) {
+	sw.uvarint(uint64(len(b)))
+	sw.write(b)
+}
+
+// WriteTo serializes the vocabulary, pattern, special tokens and name of the
+// encoding to w, so that ReadFrom can rebuild it without parsing a rank file.
+// Options set with WithOptions are not part of the payload.
+func (t *Tiktoken) WriteTo(w io.Writer) (int64, error) {
+	if t.isClosed() {
+		return 0, ErrClosed
+	}
+	crc := crc32.NewIEEE()
+	sw := &serialWriter{w: io.MultiWriter(w, crc)}
+
+	sw.write([]byte(serializeMagic))
+	var version [2]byte
+	binary.BigEndian.PutUint16(version[:], serializeVersion)
+	sw.write(version[:])
+
+	enc := t.pbeEncoding
+	sw.bytes([]byte(enc.Name))
+	sw.bytes([]byte(enc.PatStr))
+	sw.uvarint(uint64(enc.ExplicitNVocab))
+
+	for _, table := range []map[string]int{enc.MergeableRanks, enc.SpecialTokens} {
+		entries := make([]VocabEntry, 0, len(table))
+		for k, v := range table {
+			entries = append(entries, VocabEntry{Token: []byte(k), Rank: v})
+		}
+		sortEntries(entries)
+		sw.uvarint(uint64(len(entries)))
+		for _, e := range entries {
+			sw.bytes(e.Token)
+			sw.varint(e.Rank)
+		}
+	}
+	if sw.err != nil {
+		return sw.n, sw.err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	n, err := w.Write(sum[:])
+	return sw.n + int64(n), err
+}
+
+type serialReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (sr *serialReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		sr.err = errCorruptEncoding
+	}
+	return v
+}
+
+func (sr *serialReader) int() int {
+	v := sr.uvarint()
+	if v > 1<<62 {
+		sr.err = errCorruptEncoding
+		return 0
+	}
+	return int(v)
+}
+
+func (sr *serialReader) varint() int {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(sr.r)
+	if err != nil || v > 1<<62 || v < -1<<62 {
+		sr.err = errCorruptEncoding
+		return 0
+	}
+	return int(v)
+}
+
+func (sr *serialReader) bytes() []byte {
+	n := sr.uvarint()
+	if sr.err != nil {
+		return nil
+	}
+	if n > maxSerializedString {
+		sr.err = errCorruptEncoding
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, b); err != nil {
+		sr.err = errCorruptEncoding
+	}
+	return b
+}
+
+// table reads a rank or special token table, whose values are uvarints
+// if unsigned is set, as in version 1 and the special tokens of compiled
+// encodings.
+func (sr *serialReader) table(unsigned bool) map[string]int {
+	n := sr.int()
+	if sr.err != nil {
+		return nil
+	}
+	table := make(map[string]int, minInt(n, maxSerializedString))
+	for i := 0; i < n && sr.err == nil; i++ {
+		k := sr.bytes()
+		if unsigned {
+			table[string(k)] = sr.int()
+		} else {
+			table[string(k)] = sr.varint()
+		}
+	}
+	if len(table) != n && sr.err == nil {
+		sr.err = errCorruptEncoding
+	}
+	return table
+}
+
+// ReadFrom rebuilds an encoding serialized with Tiktoken.WriteTo. It fails if
+// the payload was written by an unknown format version or is corrupted.
+func ReadFrom(r io.Reader) (*Tiktoken, error) {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < len(serializeMagic)+2+4 || string(payload[:len(serializeMagic)]) != serializeMagic {
+		return nil, fmt.Errorf("%w: bad header", errCorruptEncoding)
+	}
+	version := binary.BigEndian.Uint16(payload[len(serializeMagic):])
+	if version != 1 && version != serializeVersion {
+		return nil, fmt.Errorf("unsupported serialized encoding version %d", version)
+	}
+	body, sum := payload[:len(payload)-4], binary.BigEndian.Uint32(payload[len(payload)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", errCorruptEncoding)
+	}
+
+	sr := &serialReader{r: bufio.NewReader(bytes.NewReader(body[len(serializeMagic)+2:]))}
+	enc := &Encoding{
+		Name:   string(sr.bytes()),
+		PatStr: string(sr.bytes()),
+	}
+	enc.ExplicitNVocab = sr.int()
+	enc.MergeableRanks = sr.table(version == 1)
+	enc.SpecialTokens = sr.table(version == 1)
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if _, err := sr.r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing data", errCorruptEncoding)
+	}
+	return newTiktokenFromEncoding(enc)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,93 @@
+package tiktoken
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteToReadFrom(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	var buf bytes.Buffer
+	n, err := enc.WriteTo(&buf)
+	ass.Nil(err)
+	ass.Equal(int64(buf.Len()), n)
+	payload := buf.Bytes()
+
+	restored, err := ReadFrom(bytes.NewReader(payload))
+	ass.Nil(err)
+	ass.Equal(enc.pbeEncoding.Name, restored.pbeEncoding.Name)
+	ass.Equal(enc.pbeEncoding.PatStr, restored.pbeEncoding.PatStr)
+	ass.Equal(enc.pbeEncoding.SpecialTokens, restored.pbeEncoding.SpecialTokens)
+	ass.Equal(len(enc.pbeEncoding.MergeableRanks), len(restored.pbeEncoding.MergeableRanks))
+
+	corpus := []string{"hello world!你好，世界！", "こんにちは世界！", "안녕하세요 세계!", "Привет мир!", "func main() {\n\tfmt.Println(42)\n}"}
+	for _, text := range corpus {
+		ass.Equal(enc.Encode(text, nil, nil), restored.Encode(text, nil, nil), text)
+	}
+
+	// writing is deterministic
+	var again bytes.Buffer
+	_, err = restored.WriteTo(&again)
+	ass.Nil(err)
+	ass.Equal(payload, again.Bytes())
+}
+
+func TestReadFromRejectsBadPayloads(t *testing.T) {
+	ass := assert.New(t)
+	bpe, err := NewCoreBPE(map[string]int{"a": 0, "b": 1, "ab": 2}, map[string]int{"<|end|>": 3}, `\w+`)
+	ass.Nil(err)
+	enc := NewTiktoken(bpe, &Encoding{Name: "tiny", PatStr: `\w+`, MergeableRanks: map[string]int{"a": 0, "b": 1, "ab": 2}, SpecialTokens: map[string]int{"<|end|>": 3}}, nil)
+	var buf bytes.Buffer
+	_, err = enc.WriteTo(&buf)
+	ass.Nil(err)
+	payload := buf.Bytes()
+
+	restored, err := ReadFrom(bytes.NewReader(payload))
+	ass.Nil(err)
+	ass.Equal([]int{2, 3}, restored.Encode("ab<|end|>", []string{"all"}, nil))
+
+	_, err = ReadFrom(bytes.NewReader(nil))
+	ass.ErrorIs(err, errCorruptEncoding)
+
+	corrupted := append([]byte{}, payload...)
+	corrupted[10] ^= 0xff
+	_, err = ReadFrom(bytes.NewReader(corrupted))
+	ass.ErrorIs(err, errCorruptEncoding)
+
+	_, err = ReadFrom(bytes.NewReader(payload[:len(payload)-1]))
+	ass.ErrorIs(err, errCorruptEncoding)
+
+	future := append([]byte{}, payload...)
+	future[5] = 3
+	_, err = ReadFrom(bytes.NewReader(future))
+	ass.EqualError(err, "unsupported serialized encoding version 3")
+
+	// version 1 stored ranks as uvarints
+	v1 := "TKTN\x00\x01\x04tiny\x03\\w+\x00\x03\x01a\x00\x01b\x01\x02ab\x02\x01\a<|end|>\x038bM3"
+	restored, err = ReadFrom(strings.NewReader(v1))
+	ass.Nil(err)
+	ass.Equal([]int{2, 3}, restored.Encode("ab<|end|>", []string{"all"}, nil))
+}
+
+func TestWriteToNegativeRanks(t *testing.T) {
+	ass := assert.New(t)
+	ranks, specials := map[string]int{"a": -1, "b": 0, "ab": 1}, map[string]int{"<|end|>": -2}
+	bpe, err := NewCoreBPE(ranks, specials, `\w+`)
+	ass.Nil(err)
+	enc := NewTiktoken(bpe, &Encoding{Name: "negative", PatStr: `\w+`, MergeableRanks: ranks, SpecialTokens: specials}, nil)
+	var buf bytes.Buffer
+	_, err = enc.WriteTo(&buf)
+	ass.Nil(err)
+
+	restored, err := ReadFrom(&buf)
+	ass.Nil(err)
+	ass.Equal(ranks, restored.pbeEncoding.MergeableRanks)
+	ass.Equal(specials, restored.pbeEncoding.SpecialTokens)
+	ass.Equal([]int{-1, 1, -2}, restored.Encode("a ab<|end|>", []string{"all"}, nil))
+}
@@ -0,0 +1,110 @@
+package tiktoken
+
+import "unicode/utf8"
+
+// Session encodes with the scratch memory it owns, so encoding many short
+// texts in a loop doesn't allocate on every call. Slices returned by a
+// session are only valid until its next call.
+//
+// A Session is not safe for concurrent use; keep one per goroutine. Text
+// that isn't pure ASCII, or encodings with a pattern the ASCII splitter
+// doesn't know, go through the regex engine, which allocates a little for
+// each piece of text.
+type Session struct {
+	t     *Tiktoken
+	runes []rune
+	piece []byte
+	parts [][2]int
+	out   []int
+}
+
+// NewSession returns a session encoding with t.
+func (t *Tiktoken) NewSession() *Session {
+	return &Session{t: t}
+}
+
+// Encode is like t.EncodeOrdinary(text): special tokens are encoded as
+// ordinary text, whatever defaults t has for Encode. The returned slice is
+// owned by the session and overwritten by the next call.
+func (s *Session) Encode(text string) []int {
+	s.out = s.out[:0]
+	s.encode(text, false)
+	return s.out
+}
+
+// CountTokens returns len(s.Encode(text)).
+func (s *Session) CountTokens(text string) int {
+	return s.encode(text, true)
+}
+
+// encode is encodeOrdinaryFunc working in the session buffers. It appends
+// the tokens to s.out unless countOnly is set, and returns their number.
+func (s *Session) encode(text string, countOnly bool) int {
+	bp := s.t.bpe
+	bp.mustOpen()
+	text = s.t.prepareText(text)
+	n := 0
+	if bp.asciiSplitter != nil && isASCII(text) {
+		bp.asciiSplitter.split(text, func(piece string) {
+			s.piece = append(s.piece[:0], piece...)
+			n += s.encodePiece(countOnly)
+		})
+		return n
+	}
+	s.runes = s.runes[:0]
+	for _, r := range text {
+		s.runes = append(s.runes, r)
+	}
+	m, _ := bp.tlRegex.FindRunesMatch(s.runes)
+	for m != nil {
+		s.piece = s.piece[:0]
+		for _, r := range s.runes[m.Index : m.Index+m.Length] {
+			s.piece = utf8.AppendRune(s.piece, r)
+		}
+		n += s.encodePiece(countOnly)
+		m, _ = bp.tlRegex.FindNextMatch(m)
+	}
+	return n
+}
+
+// encodePiece is appendPiece for the piece in s.piece.
+func (s *Session) encodePiece(countOnly bool) int {
+	bp := s.t.bpe
+	if token, ok := bp.encoder[string(s.piece)]; ok {
+		return s.add(token, countOnly)
+	}
+	n := 0
+	for b := s.piece; len(b) > 0; {
+		chunk := b
+		if bp.maxPieceLength > 0 && len(chunk) > bp.maxPieceLength {
+			chunk = b[:safeCut(b, bp.maxPieceLength)]
+		}
+		if len(chunk) == 1 {
+			n += s.add(bp.encoder[string(chunk)], countOnly)
+		} else {
+			s.parts = bytePairMergeParts(s.parts, chunk, bp.encoder, nil)
+			if countOnly && len(s.t.filters) == 0 {
+				n += len(s.parts) - 1
+			} else {
+				for i := 0; i < len(s.parts)-1; i++ {
+					n += s.add(bp.encoder[string(chunk[s.parts[i][0]:s.parts[i+1][0]])], countOnly)
+				}
+			}
+		}
+		b = b[len(chunk):]
+	}
+	return n
+}
+
+// add passes token through the token filters and appends it to s.out
+// unless countOnly is set. It returns 1 if the filters keep it, 0 if not.
+func (s *Session) add(token int, countOnly bool) int {
+	token, ok := s.t.filterToken(token)
+	if !ok {
+		return 0
+	}
+	if !countOnly {
+		s.out = append(s.out, token)
+	}
+	return 1
+}
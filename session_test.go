@@ -0,0 +1,51 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	sess := enc.NewSession()
+	texts := []string{multilingualText, "", "hello <|endoftext|>", strings.Repeat("ab", 1000), "\xff\xfe broken utf-8"}
+	for _, text := range texts {
+		ass.Equal(enc.Encode(text, nil, nil), append([]int{}, sess.Encode(text)...), "%q", text)
+		ass.Equal(enc.CountTokens(text), sess.CountTokens(text), "%q", text)
+	}
+
+	short := "a short string, encoded in a loop"
+	sess.Encode(short)
+	ass.Zero(testing.AllocsPerRun(100, func() { sess.Encode(short) }))
+	ass.Zero(testing.AllocsPerRun(100, func() { sess.CountTokens(short) }))
+	unicode := "a short string, 你好"
+	sess.Encode(unicode)
+	sessionAllocs := testing.AllocsPerRun(100, func() { sess.Encode(unicode) })
+	encodeAllocs := testing.AllocsPerRun(100, func() { enc.Encode(unicode, nil, nil) })
+	ass.Less(sessionAllocs, encodeAllocs)
+}
+
+func BenchmarkSessionEncode(b *testing.B) {
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	short := "a short string, encoded in a loop"
+	b.Run("session", func(b *testing.B) {
+		sess := enc.NewSession()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sess.Encode(short)
+		}
+	})
+	b.Run("encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			enc.Encode(short, nil, nil)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package tiktoken
+
+import "sync"
+
+// tokenOverlaps holds the scratch space of OverlapTokens, so repeated calls
+// don't allocate.
+var tokenOverlaps = sync.Pool{New: func() any { return &tokenOverlap{set: map[int]uint8{}} }}
+
+// tokenOverlap counts the distinct tokens of two sequences, those of the
+// first added with addA, then those of the second with addB.
+type tokenOverlap struct {
+	// set has bit 1 for the tokens of the first sequence, 2 for the second.
+	set                    map[int]uint8
+	shared, totalA, totalB int
+}
+
+func getTokenOverlap() *tokenOverlap {
+	return tokenOverlaps.Get().(*tokenOverlap)
+}
+
+// release returns the counts and puts o back in the pool.
+func (o *tokenOverlap) release() (shared, totalA, totalB int) {
+	shared, totalA, totalB = o.shared, o.totalA, o.totalB
+	for token := range o.set {
+		delete(o.set, token)
+	}
+	o.shared, o.totalA, o.totalB = 0, 0, 0
+	tokenOverlaps.Put(o)
+	return shared, totalA, totalB
+}
+
+func (o *tokenOverlap) addA(token int) {
+	if o.set[token] == 0 {
+		o.set[token] = 1
+		o.totalA++
+	}
+}
+
+func (o *tokenOverlap) addB(token int) {
+	if v := o.set[token]; v&2 == 0 {
+		o.set[token] = v | 2
+		o.totalB++
+		if v&1 != 0 {
+			o.shared++
+		}
+	}
+}
+
+// OverlapTokens returns the number of distinct tokens a and b share, and
+// the number of distinct tokens of each.
+func OverlapTokens(a, b []int) (shared, totalA, totalB int) {
+	o := getTokenOverlap()
+	for _, token := range a {
+		o.addA(token)
+	}
+	for _, token := range b {
+		o.addB(token)
+	}
+	return o.release()
+}
+
+// JaccardTokens returns the Jaccard similarity of the sets of tokens of a
+// and b: the number of distinct tokens they share over the number of
+// distinct tokens in either. It is 1 for two empty sequences and 0 if only
+// one is empty.
+func JaccardTokens(a, b []int) float64 {
+	return jaccard(OverlapTokens(a, b))
+}
+
+// TokenOverlap is OverlapTokens for the tokens of texts a and b, encoded as
+// by CountTokens without building the token slices.
+func (t *Tiktoken) TokenOverlap(a, b string) (shared, totalA, totalB int) {
+	o := getTokenOverlap()
+	t.bpe.encodeOrdinaryFunc(t.prepareText(a), o.addA)
+	t.bpe.encodeOrdinaryFunc(t.prepareText(b), o.addB)
+	return o.release()
+}
+
+// TokenSetSimilarity is JaccardTokens for the tokens of texts a and b,
+// encoded as by CountTokens.
+func (t *Tiktoken) TokenSetSimilarity(a, b string) float64 {
+	return jaccard(t.TokenOverlap(a, b))
+}
+
+func jaccard(shared, totalA, totalB int) float64 {
+	union := totalA + totalB - shared
+	if union == 0 {
+		return 1
+	}
+	return float64(shared) / float64(union)
+}
@@ -0,0 +1,52 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenOverlap(t *testing.T) {
+	ass := assert.New(t)
+
+	shared, totalA, totalB := OverlapTokens([]int{1, 2, 2, 3}, []int{3, 4, 1, 1})
+	ass.Equal([]int{2, 3, 3}, []int{shared, totalA, totalB})
+	ass.Equal(0.5, JaccardTokens([]int{1, 2, 2, 3}, []int{3, 4, 1, 1}))
+	ass.Equal(0.5, JaccardTokens([]int{3, 4, 1, 1}, []int{1, 2, 2, 3}))
+
+	ass.Equal(1.0, JaccardTokens(nil, nil))
+	ass.Equal(0.0, JaccardTokens(nil, []int{1}))
+	ass.Equal(0.0, JaccardTokens([]int{1}, []int{}))
+	ass.Equal(1.0, JaccardTokens([]int{5, 5}, []int{5}))
+
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Equal(1.0, tk.TokenSetSimilarity("", ""))
+	ass.Equal(0.0, tk.TokenSetSimilarity("", "hello"))
+	ass.Equal(0.0, tk.TokenSetSimilarity("hello", ""))
+	ass.Equal(1.0, tk.TokenSetSimilarity("hello hello", "hello hello hello"))
+
+	pairs := [][2]string{
+		{"the quick brown fox", "the quick red fox"},
+		{"你好，世界", "世界你好"},
+		{"hello world", "goodbye moon"},
+	}
+	for _, pair := range pairs {
+		a, b := tk.EncodeOrdinary(pair[0]), tk.EncodeOrdinary(pair[1])
+		s1, a1, b1 := tk.TokenOverlap(pair[0], pair[1])
+		s2, b2, a2 := tk.TokenOverlap(pair[1], pair[0])
+		ass.Equal([]int{s1, a1, b1}, []int{s2, a2, b2}, pair)
+		es, ea, eb := OverlapTokens(a, b)
+		ass.Equal([]int{es, ea, eb}, []int{s1, a1, b1}, pair)
+		ass.Equal(JaccardTokens(a, b), tk.TokenSetSimilarity(pair[0], pair[1]), pair)
+		ass.Equal(tk.TokenSetSimilarity(pair[0], pair[1]), tk.TokenSetSimilarity(pair[1], pair[0]), pair)
+	}
+	ass.Equal(0.0, tk.TokenSetSimilarity("hello", " world"))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		OverlapTokens([]int{1, 2, 3}, []int{3, 4, 5})
+	})
+	if !raceEnabled {
+		ass.Zero(allocs)
+	}
+}
@@ -0,0 +1,143 @@
+package tiktoken
+
+import "strings"
+
+// specialMatcher finds special tokens in text in a single pass, no matter
+// how many there are. It is an Aho-Corasick automaton over the bytes of the
+// tokens, built once per CoreBPE and compiled to a dense transition table
+// over the bytes that occur in tokens.
+type specialMatcher struct {
+	// classes maps a byte to its column in next, 0 for bytes no token has.
+	classes  [256]uint8
+	width    int
+	next     []int32
+	pattern  []int32 // token ending at a state, or -1
+	dict     []int32 // nearest state on the fail chain ending a token, or 0
+	patterns []string
+	maxLen   int
+	// first is the first byte of every token if they all share it, so the
+	// search can skip ahead with IndexByte; -1 otherwise.
+	first int
+}
+
+func newSpecialMatcher(tokens map[string]int) *specialMatcher {
+	m := &specialMatcher{first: -1}
+	firsts := map[byte]bool{}
+	for token := range tokens {
+		if token == "" {
+			continue
+		}
+		firsts[token[0]] = true
+		for i := 0; i < len(token); i++ {
+			if m.classes[token[i]] == 0 {
+				m.width++
+				m.classes[token[i]] = uint8(m.width)
+			}
+		}
+	}
+	m.width++
+	if len(firsts) == 1 {
+		for c := range firsts {
+			m.first = int(c)
+		}
+	}
+
+	// the trie, with -1 for missing edges
+	newState := func() int32 {
+		for i := 0; i < m.width; i++ {
+			m.next = append(m.next, -1)
+		}
+		m.pattern = append(m.pattern, -1)
+		m.dict = append(m.dict, 0)
+		return int32(len(m.pattern) - 1)
+	}
+	newState()
+	for token := range tokens {
+		if token == "" {
+			continue
+		}
+		s := int32(0)
+		for i := 0; i < len(token); i++ {
+			edge := int(s)*m.width + int(m.classes[token[i]])
+			if m.next[edge] < 0 {
+				child := newState()
+				m.next[edge] = child
+			}
+			s = m.next[edge]
+		}
+		m.pattern[s] = int32(len(m.patterns))
+		m.patterns = append(m.patterns, token)
+		if len(token) > m.maxLen {
+			m.maxLen = len(token)
+		}
+	}
+
+	// breadth first, filling missing edges from the fail state, which is
+	// always complete by the time it is needed
+	fail := make([]int32, len(m.pattern))
+	queue := []int32{}
+	for c := 0; c < m.width; c++ {
+		if child := m.next[c]; child > 0 {
+			queue = append(queue, child)
+		} else {
+			m.next[c] = 0
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		f := fail[s]
+		if m.pattern[f] >= 0 {
+			m.dict[s] = f
+		} else {
+			m.dict[s] = m.dict[f]
+		}
+		for c := 0; c < m.width; c++ {
+			edge := int(s)*m.width + c
+			if child := m.next[edge]; child >= 0 {
+				fail[child] = m.next[int(f)*m.width+c]
+				queue = append(queue, child)
+			} else {
+				m.next[edge] = m.next[int(f)*m.width+c]
+			}
+		}
+	}
+	return m
+}
+
+// find returns the byte offsets of the leftmost occurrence in text of a
+// token accepted by accept, the longest one if several start there, or
+// -1, -1 if there is none.
+func (m *specialMatcher) find(text string, accept func(token string) bool) (int, int) {
+	bestStart, bestEnd := -1, -1
+	s := int32(0)
+	for i := 0; i < len(text); i++ {
+		if bestStart >= 0 && i-m.maxLen >= bestStart {
+			// every later match starts after the best one
+			break
+		}
+		if s == 0 && m.first >= 0 && int(text[i]) != m.first {
+			j := strings.IndexByte(text[i:], byte(m.first))
+			if j < 0 {
+				break
+			}
+			i += j
+		}
+		s = m.next[int(s)*m.width+int(m.classes[text[i]])]
+		o := s
+		if m.pattern[o] < 0 {
+			o = m.dict[o]
+		}
+		for ; o != 0; o = m.dict[o] {
+			token := m.patterns[m.pattern[o]]
+			start := i + 1 - len(token)
+			if bestStart >= 0 && (start > bestStart || (start == bestStart && i+1 <= bestEnd)) {
+				continue
+			}
+			if accept(token) {
+				bestStart, bestEnd = start, i+1
+			}
+		}
+	}
+	return bestStart, bestEnd
+}
@@ -0,0 +1,101 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// findNaive is the obvious quadratic leftmost-longest search.
+func findNaive(text string, tokens []string, accept func(string) bool) (int, int) {
+	for start := 0; start < len(text); start++ {
+		best := -1
+		for _, token := range tokens {
+			if token != "" && strings.HasPrefix(text[start:], token) && accept(token) && len(token) > best {
+				best = len(token)
+			}
+		}
+		if best >= 0 {
+			return start, start + best
+		}
+	}
+	return -1, -1
+}
+
+func TestSpecialMatcher(t *testing.T) {
+	ass := assert.New(t)
+	tokens := []string{"<|end", "<|endoftext|>", "|>", "oft", "<|e", "t|", "<|a|", "a|><"}
+	set := map[string]int{}
+	for i, token := range tokens {
+		set[token] = i
+	}
+	m := newSpecialMatcher(set)
+	all := func(string) bool { return true }
+
+	start, end := m.find("xx<|endoftext|>", all)
+	ass.Equal("<|endoftext|>", "xx<|endoftext|>"[start:end])
+	start, end = m.find("xx<|endoftext|>", func(token string) bool { return token != "<|endoftext|>" })
+	ass.Equal("<|end", "xx<|endoftext|>"[start:end])
+	start, _ = m.find("plain text", all)
+	ass.Equal(-1, start)
+
+	r := rand.New(rand.NewSource(1))
+	alphabet := "<|>endoftxa"
+	// the second set shares its first byte, which takes the IndexByte path
+	for _, tokens := range [][]string{tokens, {"<|end", "<|endoftext|>", "<|", "<a|><", "<t|"}} {
+		set := map[string]int{}
+		for i, token := range tokens {
+			set[token] = i
+		}
+		m := newSpecialMatcher(set)
+		for i := 0; i < 2000; i++ {
+			b := make([]byte, r.Intn(30))
+			for j := range b {
+				b[j] = alphabet[r.Intn(len(alphabet))]
+			}
+			text := string(b)
+			skip := tokens[r.Intn(len(tokens))]
+			accept := func(token string) bool { return token != skip }
+			wantStart, wantEnd := findNaive(text, tokens, accept)
+			gotStart, gotEnd := m.find(text, accept)
+			ass.Equal([2]int{wantStart, wantEnd}, [2]int{gotStart, gotEnd}, "%q without %q", text, skip)
+		}
+	}
+}
+
+func TestEncodeOverlappingSpecialTokens(t *testing.T) {
+	ass := assert.New(t)
+	bpe, err := NewCoreBPE(map[string]int{"<": 0, "|": 1, "e": 2, "n": 3, "d": 4, "x": 5, ">": 6}, map[string]int{"<|end": 7, "<|endx|>": 8}, `\S`)
+	ass.Nil(err)
+	enc := NewTiktoken(bpe, &Encoding{Name: "overlap"}, map[string]any{"<|end": true, "<|endx|>": true})
+
+	ass.Equal([]int{8, 7}, enc.Encode("<|endx|><|end", []string{"all"}, nil))
+	ass.Equal([]int{7, 5, 1, 6}, enc.Encode("<|endx|>", []string{"<|end"}, nil))
+	_, err = enc.EncodeWithError("a<|endx|>", nil, []string{"all"})
+	ass.EqualError(err, "text contains disallowed special token <|endx|>")
+	// strings that aren't special tokens can still be disallowed
+	_, err = enc.EncodeWithError("<x>", nil, []string{"<x>"})
+	ass.EqualError(err, "text contains disallowed special token <x>")
+}
+
+func BenchmarkSpecialTokenCheck(b *testing.B) {
+	special := SpecialTokenRange("<|tool_%d|>", 1000, 64)
+	special[ENDOFTEXT] = 999
+	bpe, err := NewCoreBPE(map[string]int{"a": 0}, special, `\w+`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	set := map[string]any{}
+	for token := range special {
+		set[token] = true
+	}
+	enc := NewTiktoken(bpe, &Encoding{Name: "many_specials"}, set)
+	text := strings.Repeat("a plain prompt with no special tokens in it. ", 2000)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		enc.findDisallowed(text, set)
+	}
+}
@@ -0,0 +1,56 @@
+package tiktoken
+
+// SpecialSpan is a special token that EncodeWithSpecialSpans encoded.
+type SpecialSpan struct {
+	Token string
+	// Start and End are the byte offsets of the token in the text, after
+	// the normalization of WithNormalization if set.
+	Start, End int
+	// Index is the position of the token among the tokens returned.
+	Index int
+}
+
+// EncodeWithSpecialSpans is EncodeWithOptions also returning where the
+// special tokens it encoded were found, in order, e.g. to check that the
+// markers of a prompt template such as <|im_start|> were encoded as
+// special tokens where expected. Special tokens encoded as text have no
+// span. A special token removed by a token filter keeps its span, with
+// the Index of the token that follows it.
+func (t *Tiktoken) EncodeWithSpecialSpans(text string, opts EncodeOptions) ([]int, []SpecialSpan, error) {
+	if t.isClosed() {
+		return nil, nil, ErrClosed
+	}
+	allowedSpecial, disallowedSpecial, err := t.specialArgs(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := metricsStart()
+	size := len(text)
+	text = t.prepareText(text)
+	allowed, err := t.checkSpecial(text, allowedSpecial, disallowedSpecial)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens := make([]int, 0, len(text)/4)
+	var spans []SpecialSpan
+	emit := func(token int) {
+		if token, ok := t.filterToken(token); ok {
+			tokens = append(tokens, token)
+		}
+	}
+	var piece []int
+	onPiece := func(text string, start, end int) {
+		piece = t.bpe.appendPiece(piece[:0], text)
+		for _, token := range piece {
+			emit(token)
+		}
+	}
+	onSpecial := func(special string, start, end int) {
+		spans = append(spans, SpecialSpan{Token: special, Start: start, End: end, Index: len(tokens)})
+		emit(t.bpe.specialTokensEncoder[special])
+	}
+	t.bpe.forEachSegment(text, allowed, onPiece, onSpecial)
+	t.record(start, len(tokens), size)
+	return tokens, spans, nil
+}
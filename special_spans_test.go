@@ -0,0 +1,39 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeWithSpecialSpans(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "<|im_start|>hello world<|endoftext|>"
+	tokens, spans, err := enc.EncodeWithSpecialSpans(text, EncodeOptions{AllowedSpecial: AllowedSpecialAll})
+	ass.Nil(err)
+	ass.Equal([]int{151644, 14990, 1879, 151643}, tokens)
+	ass.Equal([]SpecialSpan{
+		{Token: "<|im_start|>", Start: 0, End: 12, Index: 0},
+		{Token: "<|endoftext|>", Start: 23, End: 36, Index: 3},
+	}, spans)
+	for _, span := range spans {
+		ass.Equal(span.Token, text[span.Start:span.End])
+		ass.Equal(enc.bpe.specialTokensEncoder[span.Token], tokens[span.Index])
+	}
+
+	// special tokens encoded as text have no span
+	tokens, spans, err = enc.EncodeWithSpecialSpans(text, EncodeOptions{AllowedSpecial: SpecialSetOf("<|endoftext|>"), OnDisallowed: DisallowedAsText})
+	ass.Nil(err)
+	ass.Equal(enc.EncodeOrdinary("<|im_start|>hello world"), tokens[:len(tokens)-1])
+	ass.Equal([]SpecialSpan{{Token: "<|endoftext|>", Start: 23, End: 36, Index: len(tokens) - 1}}, spans)
+
+	_, _, err = enc.EncodeWithSpecialSpans(text, EncodeOptions{})
+	ass.EqualError(err, "text contains disallowed special token <|im_start|>")
+	tokens, spans, err = enc.EncodeWithSpecialSpans("hello", EncodeOptions{})
+	ass.Nil(err)
+	ass.Equal([]int{14990}, tokens)
+	ass.Empty(spans)
+}
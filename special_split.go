@@ -0,0 +1,101 @@
+package tiktoken
+
+// Segment is a part of a text split by SplitBySpecialTokens: either a
+// special token, with its id in Token, or the ordinary text between special
+// tokens, with Token set to -1.
+type Segment struct {
+	Text      string
+	IsSpecial bool
+	Token     int
+}
+
+// SplitBySpecialTokens cuts text at every occurrence of the given special
+// tokens, matching them leftmost-longest like Encode does when they are
+// allowed. An empty specials, or []string{"all"}, means all special tokens
+// of the encoding; strings that aren't special tokens of the encoding are
+// ignored, as they are by Encode. Joining the Text of the segments gives
+// back text. Empty ordinary segments are omitted.
+func (t *Tiktoken) SplitBySpecialTokens(text string, specials []string) []Segment {
+	t.bpe.mustOpen()
+	accept := func(string) bool { return true }
+	if len(specials) > 0 && !(len(specials) == 1 && specials[0] == "all") {
+		set := make(map[string]bool, len(specials))
+		for _, special := range specials {
+			set[special] = true
+		}
+		accept = func(token string) bool { return set[token] }
+	}
+
+	var segments []Segment
+	for len(text) > 0 {
+		start, end := t.bpe.specialMatcher.find(text, accept)
+		if start < 0 {
+			start, end = len(text), len(text)
+		}
+		if start > 0 {
+			segments = append(segments, Segment{Text: text[:start], Token: -1})
+		}
+		if end > start {
+			special := text[start:end]
+			segments = append(segments, Segment{Text: special, IsSpecial: true, Token: t.bpe.specialTokensEncoder[special]})
+		}
+		text = text[end:]
+	}
+	return segments
+}
+
+// SpecialOccurrence is a special token found in a text.
+type SpecialOccurrence struct {
+	Token string
+	ID    int
+	// Offset and Len are the byte range of the token in the text.
+	Offset, Len int
+}
+
+// FindSpecialTokens returns the special tokens of the encoding in text,
+// leftmost-longest and without overlaps, found with the matcher Encode
+// uses. With input options such as WithNormalization the offsets refer to
+// the transformed text, as Encode sees it.
+func (t *Tiktoken) FindSpecialTokens(text string) []SpecialOccurrence {
+	t.bpe.mustOpen()
+	text = t.prepareText(text)
+	var found []SpecialOccurrence
+	for at := 0; at < len(text); {
+		occ, ok := t.findSpecial(text[at:], func(string) bool { return true })
+		if !ok {
+			break
+		}
+		occ.Offset += at
+		found = append(found, occ)
+		at = occ.Offset + occ.Len
+	}
+	return found
+}
+
+// ContainsDisallowedSpecial reports whether Encode(text, allowed, nil)
+// with disallowed set to "all" would refuse text, and returns the special
+// token it would report, e.g. to point the user at it before encoding. A
+// nil allowed stands for the default of WithDefaultAllowedSpecial.
+func (t *Tiktoken) ContainsDisallowedSpecial(text string, allowed []string) (bool, SpecialOccurrence) {
+	t.bpe.mustOpen()
+	if allowed == nil {
+		allowed = t.opts.allowedSpecial
+	}
+	allowedSet := t.allowedSpecialSet(allowed)
+	occ, ok := t.findSpecial(t.prepareText(text), func(token string) bool {
+		_, ok := allowedSet[token]
+		return !ok
+	})
+	return ok, occ
+}
+
+// findSpecial returns the leftmost, longest special token in text accepted
+// by accept.
+func (t *Tiktoken) findSpecial(text string, accept func(token string) bool) (SpecialOccurrence, bool) {
+	start, end := t.bpe.specialMatcher.find(text, accept)
+	if start < 0 {
+		return SpecialOccurrence{}, false
+	}
+	token := text[start:end]
+	return SpecialOccurrence{Token: token, ID: t.bpe.specialTokensEncoder[token], Offset: start, Len: end - start}, true
+}
@@ -0,0 +1,80 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBySpecialTokens(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "<|im_start|>system\nBe brief.<|im_end|>\n<|im_start|>user\nHi<|endoftext|>"
+	segments := enc.SplitBySpecialTokens(text, nil)
+	ass.Equal([]Segment{
+		{Text: IM_START, IsSpecial: true, Token: 151644},
+		{Text: "system\nBe brief.", Token: -1},
+		{Text: IM_END, IsSpecial: true, Token: 151645},
+		{Text: "\n", Token: -1},
+		{Text: IM_START, IsSpecial: true, Token: 151644},
+		{Text: "user\nHi", Token: -1},
+		{Text: ENDOFTEXT, IsSpecial: true, Token: 151643},
+	}, segments)
+	ass.Equal(segments, enc.SplitBySpecialTokens(text, []string{"all"}))
+
+	// the split is consistent with Encode
+	tokens := []int{}
+	for _, segment := range segments {
+		if segment.IsSpecial {
+			tokens = append(tokens, segment.Token)
+		} else {
+			tokens = append(tokens, enc.EncodeOrdinary(segment.Text)...)
+		}
+	}
+	ass.Equal(enc.Encode(text, []string{"all"}, nil), tokens)
+
+	only := enc.SplitBySpecialTokens(text, []string{IM_END, "<|not_special|>"})
+	ass.Equal([]Segment{
+		{Text: "<|im_start|>system\nBe brief.", Token: -1},
+		{Text: IM_END, IsSpecial: true, Token: 151645},
+		{Text: "\n<|im_start|>user\nHi<|endoftext|>", Token: -1},
+	}, only)
+
+	ass.Empty(enc.SplitBySpecialTokens("", nil))
+	ass.Equal([]Segment{{Text: "plain", Token: -1}}, enc.SplitBySpecialTokens("plain", nil))
+}
+
+func TestFindSpecialTokens(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hi <|im_start|>user<|im_end|><|endoftext|> <|not_special|>"
+	ass.Equal([]SpecialOccurrence{
+		{Token: IM_START, ID: 151644, Offset: 3, Len: 12},
+		{Token: IM_END, ID: 151645, Offset: 19, Len: 10},
+		{Token: ENDOFTEXT, ID: 151643, Offset: 29, Len: 13},
+	}, enc.FindSpecialTokens(text))
+	for _, occ := range enc.FindSpecialTokens(text) {
+		ass.Equal(occ.Token, text[occ.Offset:occ.Offset+occ.Len])
+	}
+	ass.Empty(enc.FindSpecialTokens("plain <| text"))
+
+	found, occ := enc.ContainsDisallowedSpecial(text, []string{IM_START})
+	ass.True(found)
+	ass.Equal(SpecialOccurrence{Token: IM_END, ID: 151645, Offset: 19, Len: 10}, occ)
+	_, err = enc.EncodeWithError(text, []string{IM_START}, []string{"all"})
+	ass.EqualError(err, "text contains disallowed special token "+IM_END)
+
+	found, _ = enc.ContainsDisallowedSpecial(text, []string{"all"})
+	ass.False(found)
+	found, occ = enc.ContainsDisallowedSpecial("plain", nil)
+	ass.False(found)
+	ass.Equal(SpecialOccurrence{}, occ)
+
+	defaults := enc.WithDefaultAllowedSpecial(IM_START, IM_END, ENDOFTEXT)
+	found, _ = defaults.ContainsDisallowedSpecial(text, nil)
+	ass.False(found)
+}
@@ -0,0 +1,106 @@
+package tiktoken
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ul serializes UpdateEncodingSpecials.
+var ul = &sync.Mutex{}
+
+// UpdateEncodingSpecials replaces the special tokens of the cached instance
+// of the named encoding with specials, loading it first if needed. The new
+// instance shares the rank tables of the old one and replaces it at once:
+// GetEncoding and EncodingForModel return the new instance from then on,
+// while instances obtained before, and calls in progress on them, keep the
+// old special tokens. If a special token has the id of a mergeable rank or
+// of another special token, it fails and the cached instance stays as it
+// was.
+//
+// The update lasts until the encoding is released or refreshed, after
+// which it is built from its definition again. Instances cached by
+// GetEncodingWithLoader are not affected.
+func UpdateEncodingSpecials(name string, specials map[string]int) error {
+	ul.Lock()
+	defer ul.Unlock()
+	old, err := GetEncoding(name)
+	if err != nil {
+		return err
+	}
+	old.bpe.mustOpen()
+
+	enc := *old.pbeEncoding
+	enc.SpecialTokens = make(map[string]int, len(specials))
+	for token, id := range specials {
+		enc.SpecialTokens[token] = id
+	}
+	if err := checkSpecialIDs(old.bpe.tables, enc.SpecialTokens); err != nil {
+		return fmt.Errorf("update special tokens of %s: %w", name, err)
+	}
+	tk, err := newTiktokenFromEncoding(&enc)
+	if err != nil {
+		return fmt.Errorf("update special tokens of %s: %w", name, err)
+	}
+
+	tl.Lock()
+	defer tl.Unlock()
+	l.Lock()
+	encodingMap[name] = &enc
+	l.Unlock()
+	tiktokenMap[name] = tk
+	setLoaded(name, true)
+	return nil
+}
+
+// WithExtraSpecialTokens returns a copy of t that also knows the special
+// tokens extra, e.g. those added by a fine-tune, with their ids. A token t
+// already has gets the id given in extra. The copy shares the rank tables,
+// compiled pattern and options with t, so it costs about as much as the
+// special tokens; t itself is not changed and may be used concurrently.
+// Closing either closes both, as with WithOptions. It fails if a special
+// token would have the id of a mergeable rank or of another special token.
+func (t *Tiktoken) WithExtraSpecialTokens(extra map[string]int) (*Tiktoken, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	specials := make(map[string]int, len(t.bpe.specialTokensEncoder)+len(extra))
+	for token, id := range t.bpe.specialTokensEncoder {
+		specials[token] = id
+	}
+	for token, id := range extra {
+		specials[token] = id
+	}
+	if err := checkSpecialIDs(t.bpe.tables, specials); err != nil {
+		return nil, err
+	}
+
+	derived := *t
+	bpe := *t.bpe
+	bpe.setSpecialTokens(specials)
+	derived.bpe = &bpe
+	derived.specialTokensSet = make(map[string]any, len(specials))
+	for token := range specials {
+		derived.specialTokensSet[token] = true
+	}
+	if t.pbeEncoding != nil {
+		enc := *t.pbeEncoding
+		enc.SpecialTokens = specials
+		derived.pbeEncoding = &enc
+	}
+	return &derived, nil
+}
+
+// checkSpecialIDs fails if a special token has the id of a mergeable rank
+// in tables or the same id as another special token.
+func checkSpecialIDs(tables *rankTables, specials map[string]int) error {
+	entries := sortedVocab(specials)
+	for i, e := range entries {
+		if tables.hasRank(e.Rank) {
+			return fmt.Errorf("special token %s has id %d, which is also a mergeable rank", e.Token, e.Rank)
+		}
+		if i > 0 && entries[i-1].Rank == e.Rank {
+			return fmt.Errorf("special token %s has id %d, which is also the id of %s", e.Token, e.Rank, entries[i-1].Token)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package tiktoken
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateEncodingSpecials(t *testing.T) {
+	ass := assert.New(t)
+	defer ReleaseEncoding(MODEL_QWEN_BASE)
+	old, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	specials := map[string]int{ENDOFTEXT: 151643, IM_START: 151644, IM_END: 151645, "<|tool|>": 151646}
+
+	// encoding goes on while the instance is swapped
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				tk, err := GetEncoding(MODEL_QWEN_BASE)
+				ass.Nil(err)
+				ass.Equal("hello<|tool|>", tk.Decode(tk.Encode("hello<|tool|>", []string{"all"}, nil)))
+			}
+		}()
+	}
+	ass.Nil(UpdateEncodingSpecials(MODEL_QWEN_BASE, specials))
+	wg.Wait()
+
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.NotSame(old, tk)
+	ass.Equal([]int{14990, 151646}, tk.Encode("hello<|tool|>", []string{"all"}, nil))
+	ass.Equal(specials, tk.bpe.specialTokensEncoder)
+	ass.True(sameRanks(tk.bpe.encoder, old.bpe.encoder), "the rank tables should be shared")
+	// the old instance keeps its tokens
+	ass.Equal([]int{14990, 151646}, old.Encode("hello<|extra_0|>", []string{"all"}, nil))
+	ass.NotEqual([]int{14990, 151646}, old.Encode("hello<|tool|>", []string{"all"}, nil))
+
+	err = UpdateEncodingSpecials(MODEL_QWEN_BASE, map[string]int{"<|a|>": 151700, "<|b|>": 151700})
+	ass.EqualError(err, "update special tokens of qwen_base: special token <|b|> has id 151700, which is also the id of <|a|>")
+	err = UpdateEncodingSpecials(MODEL_QWEN_BASE, map[string]int{"<|a|>": 14990})
+	ass.EqualError(err, "update special tokens of qwen_base: special token <|a|> has id 14990, which is also a mergeable rank")
+	again, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Same(tk, again, "a failed update should keep the instance")
+}
+
+func TestWithExtraSpecialTokens(t *testing.T) {
+	ass := assert.New(t)
+	base, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	base = base.WithOptions(WithStripBOM(true))
+	tk, err := base.WithExtraSpecialTokens(map[string]int{"<|fim_prefix_v2|>": 152000, ENDOFTEXT: 152001})
+	ass.Nil(err)
+
+	ass.Equal([]int{14990, 152000, 152001}, tk.Encode("\uFEFFhello<|fim_prefix_v2|><|endoftext|>", []string{"all"}, nil))
+	ass.Equal("hello<|fim_prefix_v2|>", tk.Decode([]int{14990, 152000}))
+	ass.Equal(152000, tk.SpecialTokens()["<|fim_prefix_v2|>"])
+	ass.Equal(152000, tk.pbeEncoding.SpecialTokens["<|fim_prefix_v2|>"])
+	ass.Equal(len(base.SpecialTokens())+1, len(tk.SpecialTokens()))
+	ass.True(sameRanks(tk.bpe.encoder, base.bpe.encoder), "the rank tables should be shared")
+	_, err = tk.EncodeWithError("<|fim_prefix_v2|>", nil, []string{"all"})
+	ass.EqualError(err, "text contains disallowed special token <|fim_prefix_v2|>")
+
+	// the base is unchanged
+	ass.NotContains(base.SpecialTokens(), "<|fim_prefix_v2|>")
+	ass.Equal(ENDOFTEXT, base.bpe.specialTokensDecoder[151643])
+	ass.Equal([]int{151643}, base.Encode(ENDOFTEXT, []string{"all"}, nil))
+	ass.NotEqual([]int{152000}, base.Encode("<|fim_prefix_v2|>", []string{"all"}, nil))
+
+	_, err = base.WithExtraSpecialTokens(map[string]int{"<|x|>": 14990})
+	ass.EqualError(err, "special token <|x|> has id 14990, which is also a mergeable rank")
+	_, err = base.WithExtraSpecialTokens(map[string]int{"<|x|>": 151643})
+	ass.ErrorContains(err, "which is also the id of")
+}
@@ -0,0 +1,88 @@
+package tiktoken
+
+import "unicode/utf8"
+
+// TruncateToTokens is Truncate without options: the longest prefix of text
+// that encodes to at most maxTokens tokens, cut on a token boundary that is
+// also a character boundary, and its token count.
+func (t *Tiktoken) TruncateToTokens(text string, maxTokens int) (string, int) {
+	return TruncateToTokens(t, text, maxTokens)
+}
+
+// TruncateToTokens is the TruncateToTokens method of *Tiktoken for any
+// Codec, see Truncate.
+func TruncateToTokens(enc Codec, text string, maxTokens int) (string, int) {
+	return Truncate(enc, text, maxTokens)
+}
+
+// SplitByTokens splits text into chunks that each encode to at most
+// chunkSize tokens, e.g. for retrieval, where consecutive chunks share
+// about overlap tokens of text. Chunks are cut on token boundaries that are
+// also character boundaries, so each is valid UTF-8 if text is, and they
+// cover all of text in order. Special tokens are counted as ordinary text,
+// as in Truncate, and the encode options of t are applied to text first.
+//
+// Text is encoded once and each chunk counted again, since a chunk doesn't
+// always tokenize like its part of the whole text. A chunk only has more
+// than chunkSize tokens if no shorter one ends on a character boundary, as
+// for an emoji of several tokens and a chunkSize of 1. An empty text, a
+// chunkSize below 1 or an overlap outside [0, chunkSize) give no chunks.
+func (t *Tiktoken) SplitByTokens(text string, chunkSize, overlap int) []string {
+	return SplitByTokens(t, text, chunkSize, overlap)
+}
+
+// SplitByTokens is the SplitByTokens method of *Tiktoken for any Codec,
+// see Truncate.
+func SplitByTokens(enc Codec, text string, chunkSize, overlap int) []string {
+	if chunkSize < 1 || overlap < 0 || overlap >= chunkSize {
+		return nil
+	}
+	tk, text := tokenizerOf(enc, text)
+	tokens, offsets := tk.encodeOrdinaryOffsets(text)
+	n := len(tokens)
+	if n == 0 {
+		return nil
+	}
+	clean := func(i int) bool {
+		return i == 0 || i == n || offsets[i] >= 0 && utf8.RuneStart(text[offsets[i]])
+	}
+
+	var chunks []string
+	for start := 0; ; {
+		// the shortest chunk ends after the first character
+		first := start + 1
+		for !clean(first) {
+			first++
+		}
+		end := start + chunkSize
+		if end < first {
+			end = first
+		} else if end > n {
+			end = n
+		}
+		for {
+			for end > first && !clean(end) {
+				end--
+			}
+			count := tk.countOrdinary(text[offsets[start]:offsets[end]])
+			if count <= chunkSize || end == first {
+				break
+			}
+			if end -= count - chunkSize; end < first {
+				end = first
+			}
+		}
+		chunks = append(chunks, text[offsets[start]:offsets[end]])
+		if end == n {
+			return chunks
+		}
+		next := end - overlap
+		if next <= start {
+			next = start + 1
+		}
+		for !clean(next) {
+			next++
+		}
+		start = next
+	}
+}
@@ -0,0 +1,88 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitByTokens(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := multilingualText + "The quick brown fox jumps over the lazy dog; pack my box with five dozen liquor jugs."
+	for _, size := range []int{1, 2, 7, 30, 1000} {
+		for _, overlap := range []int{0, 1, size / 2, size - 1} {
+			if overlap < 0 || overlap >= size {
+				continue
+			}
+			chunks := enc.SplitByTokens(text, size, overlap)
+			ass.NotEmpty(chunks)
+			pos, end := 0, 0
+			for i, chunk := range chunks {
+				ass.True(utf8.ValidString(chunk), "%d/%d chunk %d", size, overlap, i)
+				if tokens := enc.EncodeOrdinary(chunk); len(tokens) > size {
+					ass.False(utf8.ValidString(enc.Decode(tokens[:size])), "no shorter chunk ends on a character boundary")
+				}
+				// each chunk starts after the start of the previous one and
+				// leaves no gap; of the places it fits, take the last
+				at := -1
+				for s := end; s > pos || (i == 0 && s == 0); s-- {
+					if strings.HasPrefix(text[s:], chunk) {
+						at = s
+						break
+					}
+				}
+				if !ass.GreaterOrEqual(at, 0, "%d/%d chunk %d", size, overlap, i) {
+					break
+				}
+				pos, end = at, at+len(chunk)
+			}
+			ass.Equal(len(text), end, "%d/%d covers the text", size, overlap)
+			if overlap == 0 {
+				ass.Equal(text, strings.Join(chunks, ""))
+			}
+		}
+	}
+
+	tokens := enc.EncodeOrdinary("hello world, how are you")
+	chunks := enc.SplitByTokens("hello world, how are you", 3, 1)
+	ass.Equal([]string{enc.Decode(tokens[:3]), enc.Decode(tokens[2:5]), enc.Decode(tokens[4:])}, chunks)
+
+	// 龘 is three byte tokens of the test encoding
+	test := GetTestEncoding()
+	ass.Equal(3, test.CountTokens("龘"))
+	ass.Equal([]string{"a", "龘", "b"}, test.SplitByTokens("a龘b", 1, 0))
+	ass.Equal([]string{"a", "龘", "b"}, test.SplitByTokens("a龘b", 2, 1))
+
+	// invalid bytes encode as U+FFFD, which is longer than they are
+	for _, text := range []string{"a\xffb", "123\x80\n", "\xe4\xbd\n", "\xff\xff\xff\xff hello world"} {
+		for _, size := range []int{1, 2, 3} {
+			chunks := enc.SplitByTokens(text, size, 0)
+			ass.Equal(text, strings.Join(chunks, ""), "%q in chunks of %d", text, size)
+			for _, chunk := range chunks {
+				ass.NotEmpty(chunk)
+			}
+			got, _ := enc.TruncateToTokens(text, size)
+			ass.True(strings.HasPrefix(text, got), "%q", text)
+		}
+	}
+
+	ass.Nil(enc.SplitByTokens("", 10, 0))
+	ass.Nil(enc.SplitByTokens("hello", 0, 0))
+	ass.Nil(enc.SplitByTokens("hello", 2, 2))
+	ass.Nil(enc.SplitByTokens("hello", 2, -1))
+}
+
+func TestTruncateToTokens(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	got, n := enc.TruncateToTokens(multilingualText, 5)
+	want, wantN := enc.Truncate(multilingualText, 5)
+	ass.Equal(want, got)
+	ass.Equal(wantN, n)
+}
@@ -0,0 +1,139 @@
+package tiktoken
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+)
+
+// staleSuffix names a cache entry that is being downloaded again. It is
+// kept until the new copy is in place and served if the download fails
+// because the network is unavailable.
+const staleSuffix = ".stale"
+
+// cacheRevalidator is implemented by loaders that can keep the cached copy
+// of a rank file as a fallback while downloading it again.
+type cacheRevalidator interface {
+	markStale(tiktokenBpeFile string) error
+}
+
+// WithStaleIfError controls whether a rank file that RefreshEncoding fails
+// to download again because of a network error is served from the copy
+// cached before, as in HTTP's stale-if-error. It is on by default. Hash
+// mismatches are never papered over this way.
+func WithStaleIfError(enabled bool) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.staleIfError = enabled
+	}
+}
+
+// WithStaleHandler calls f whenever the loader serves a stale copy of the
+// rank file uri, with the error that prevented the download.
+func WithStaleHandler(f func(uri string, err error)) LoaderOption {
+	return func(l *defaultBpeLoader) {
+		l.onStale = f
+	}
+}
+
+// markStale moves the cache entry of blobpath aside, so the next load
+// downloads it again but can fall back to it.
+func (l *defaultBpeLoader) markStale(blobpath string) error {
+	if _, ok := l.store.(diskCacheStore); !ok {
+		l.refetch(blobpath, true)
+		return nil
+	}
+	current := cachePath(blobpath)
+	if current == "" {
+		return nil
+	}
+	forgetVocab(current)
+	for _, p := range append([]string{current}, legacyCachePaths(blobpath)...) {
+		err := os.Rename(p, current+staleSuffix)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// downloading starts over and older copies would shadow the new one
+	for _, p := range append([]string{current + partialSuffix, current + validatorSuffix}, legacyCachePaths(blobpath)...) {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// staleFallback restores the stale copy of the cache entry at cachePath if
+// loading it again failed with a network error, and returns its contents.
+func (l *defaultBpeLoader) staleFallback(blobpath, cachePath string, loadErr error) ([]byte, bool) {
+	if !l.staleIfError || !isNetworkError(loadErr) {
+		return nil, false
+	}
+	stale := cachePath + staleSuffix
+	contents, err := ioutil.ReadFile(stale)
+	if err != nil {
+		return nil, false
+	}
+	// back in place, so later loads don't try the network again
+	os.Rename(stale, cachePath)
+	if l.onStale != nil {
+		l.onStale(blobpath, loadErr)
+	}
+	return contents, true
+}
+
+// ErrDownload is matched by *DownloadError with errors.Is.
+var ErrDownload = errors.New("tiktoken: rank file download failed")
+
+// DownloadError is returned when the default loader can't download a rank
+// file: the request failed, with Err set, or the server answered with a
+// status other than the file's.
+type DownloadError struct {
+	// URI is the address requested, which a mirror may have rewritten.
+	URI string
+	// StatusCode and Status are those of the response, 0 and empty if
+	// there was none.
+	StatusCode int
+	Status     string
+	Err        error
+}
+
+func (e *DownloadError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return "downloading " + e.URI + ": unexpected status " + e.Status
+}
+
+// Is makes errors.Is(err, ErrDownload) hold, while Unwrap leaves Err to
+// errors.Is and errors.As, e.g. for a net.Error.
+func (e *DownloadError) Is(target error) bool {
+	return target == ErrDownload
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// isNetworkError reports whether err means the rank file couldn't be
+// reached, as opposed to being reached and found wrong.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	var download *DownloadError
+	switch {
+	case errors.Is(err, context.Canceled):
+		// the caller gave up, it didn't fail
+		return false
+	case errors.Is(err, ErrOfflineMode), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &netErr):
+		return true
+	case errors.As(err, &download) && download.StatusCode != 0:
+		return download.StatusCode >= 500 || download.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
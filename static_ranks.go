@@ -0,0 +1,45 @@
+package tiktoken
+
+import "fmt"
+
+// StaticRanks is a rank file as Go data, which cmd/tiktoken-gen writes as
+// the source of a package variable: the tokens back to back in byte order,
+// where each of them ends in Tokens, and their ranks. Building an encoding
+// of it decodes nothing, so an encoding compiled into the binary starts
+// without reading or parsing a file, e.g. with TinyGo or on WASM.
+type StaticRanks struct {
+	Tokens string
+	Ends   []uint32
+	Ranks  []int
+}
+
+// StaticRanksOf returns ranks as StaticRanks, as tiktoken-gen generates
+// them.
+func StaticRanksOf(ranks map[string]int) (StaticRanks, error) {
+	tables, err := newRankTables(ranks)
+	if err != nil {
+		return StaticRanks{}, err
+	}
+	static := StaticRanks{
+		Tokens: tables.tokenString,
+		Ends:   append([]uint32{}, tables.ends...),
+		Ranks:  make([]int, tables.len()),
+	}
+	for i := range static.Ranks {
+		start, end := tables.span(i)
+		static.Ranks[i] = tables.encoder[tables.tokenString[start:end]]
+	}
+	return static, nil
+}
+
+// NewEncodingFromStaticRanks is NewEncodingFromRankFile for ranks compiled
+// into the binary: it builds the encoding name of ranks, the split pattern
+// patStr and specialTokens, to register with RegisterEncoding. ranks must
+// not be modified afterwards.
+func NewEncodingFromStaticRanks(encodingName string, ranks StaticRanks, patStr string, specialTokens map[string]int) (*Encoding, error) {
+	tables, err := sortedRankTables([]byte(ranks.Tokens), ranks.Tokens, ranks.Ends, ranks.Ranks)
+	if err != nil {
+		return nil, fmt.Errorf("static ranks of %s: %w", encodingName, err)
+	}
+	return newEncoding(encodingName, "", patStr, tables, specialTokens)
+}
@@ -0,0 +1,35 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEncodingFromStaticRanks(t *testing.T) {
+	ass := assert.New(t)
+	ref, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	static, err := StaticRanksOf(ref.pbeEncoding.MergeableRanks)
+	ass.Nil(err)
+	ass.Len(static.Ranks, len(ref.pbeEncoding.MergeableRanks))
+
+	enc, err := NewEncodingFromStaticRanks("static_qwen", static, ref.pbeEncoding.PatStr, ref.pbeEncoding.SpecialTokens)
+	ass.Nil(err)
+	ass.Equal(ref.pbeEncoding.MergeableRanks, enc.MergeableRanks)
+	tk, err := newTiktokenFromEncoding(enc)
+	ass.Nil(err)
+	text := "hello world<|endoftext|>你好"
+	ass.Equal(ref.Encode(text, []string{"all"}, nil), tk.Encode(text, []string{"all"}, nil))
+
+	_, err = NewEncodingFromStaticRanks("bad", StaticRanks{Tokens: "ab", Ends: []uint32{1, 2}, Ranks: []int{0}}, `\w+`, nil)
+	ass.EqualError(err, "static ranks of bad: 2 tokens but 1 ranks")
+	_, err = NewEncodingFromStaticRanks("bad", StaticRanks{Tokens: "ba", Ends: []uint32{1, 2}, Ranks: []int{0, 1}}, `\w+`, nil)
+	ass.EqualError(err, "static ranks of bad: tokens out of order")
+	_, err = NewEncodingFromStaticRanks("bad", StaticRanks{Tokens: "ab", Ends: []uint32{1, 2}, Ranks: []int{0, 0}}, `\w+`, nil)
+	ass.ErrorContains(err, "static ranks of bad")
+	_, err = NewEncodingFromStaticRanks("bad", StaticRanks{Tokens: "ab", Ends: []uint32{1}, Ranks: []int{0}}, `\w+`, nil)
+	ass.EqualError(err, "static ranks of bad: tokens end at 1, not at 2")
+	_, err = NewEncodingFromStaticRanks("bad", StaticRanks{Tokens: "ab", Ends: []uint32{1, 2}, Ranks: []int{0, 1}}, `\w+`, map[string]int{"<|x|>": 1})
+	ass.ErrorContains(err, "also a mergeable rank")
+}
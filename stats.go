@@ -0,0 +1,51 @@
+package tiktoken
+
+// TokenStats summarizes the tokens of one or more texts.
+type TokenStats struct {
+	TotalTokens  int
+	UniqueTokens int
+	// Frequencies maps each token to the number of times it occurred.
+	Frequencies map[int]int
+	TotalBytes  int
+	// BytesPerToken is TotalBytes / TotalTokens, or 0 for empty input.
+	BytesPerToken float64
+}
+
+// EncodeStats encodes text as EncodeOrdinary does and returns a frequency
+// histogram of the tokens instead of the tokens themselves.
+func (t *Tiktoken) EncodeStats(text string) TokenStats {
+	text = t.prepareText(text)
+	stats := TokenStats{
+		Frequencies: map[int]int{},
+		TotalBytes:  len(text),
+	}
+	t.bpe.encodeOrdinaryFunc(text, func(token int) {
+		stats.Frequencies[token]++
+		stats.TotalTokens++
+	})
+	stats.UniqueTokens = len(stats.Frequencies)
+	stats.updateRatio()
+	return stats
+}
+
+// Add merges other into s, so stats can be aggregated across documents.
+func (s *TokenStats) Add(other TokenStats) {
+	if s.Frequencies == nil {
+		s.Frequencies = make(map[int]int, len(other.Frequencies))
+	}
+	for token, n := range other.Frequencies {
+		s.Frequencies[token] += n
+	}
+	s.TotalTokens += other.TotalTokens
+	s.TotalBytes += other.TotalBytes
+	s.UniqueTokens = len(s.Frequencies)
+	s.updateRatio()
+}
+
+func (s *TokenStats) updateRatio() {
+	if s.TotalTokens == 0 {
+		s.BytesPerToken = 0
+		return
+	}
+	s.BytesPerToken = float64(s.TotalBytes) / float64(s.TotalTokens)
+}
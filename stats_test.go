@@ -0,0 +1,37 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeStats(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello hello hello world"
+	tokens := enc.EncodeOrdinary(text)
+	stats := enc.EncodeStats(text)
+	ass.Equal(len(tokens), stats.TotalTokens)
+	ass.Equal(len(text), stats.TotalBytes)
+	ass.InDelta(float64(len(text))/float64(len(tokens)), stats.BytesPerToken, 1e-9)
+
+	freq := map[int]int{}
+	for _, token := range tokens {
+		freq[token]++
+	}
+	ass.Equal(freq, stats.Frequencies)
+	ass.Equal(len(freq), stats.UniqueTokens)
+
+	var total TokenStats
+	total.Add(stats)
+	total.Add(enc.EncodeStats("你好"))
+	ass.Equal(stats.TotalTokens+len(enc.EncodeOrdinary("你好")), total.TotalTokens)
+	ass.Equal(len(text)+len("你好"), total.TotalBytes)
+
+	empty := enc.EncodeStats("")
+	ass.Equal(0, empty.TotalTokens)
+	ass.Equal(0.0, empty.BytesPerToken)
+}
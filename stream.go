@@ -0,0 +1,116 @@
+package tiktoken
+
+import (
+	"unicode/utf8"
+)
+
+// streamMargin is the number of runes at the end of the buffered text that
+// streamEncoder never encodes before more input arrives: how a piece ends
+// can depend on a few characters after it (contractions, whitespace runs).
+const streamMargin = 16
+
+// streamEncoder encodes text that arrives in chunks the same way
+// EncodeOrdinary encodes the concatenated text. Pieces are only encoded once
+// enough of the following text is known to be sure of their boundaries.
+//
+// A piece longer than the piece length cap is merged in chunks anyway, so
+// its chunks are encoded as soon as they are known and only the rest of it
+// is held. Without a cap a piece is held whole, however long it gets.
+type streamEncoder struct {
+	bpe     *CoreBPE
+	pending []byte
+	tokens  []int
+	// held is the length of pending after the last split; pending is only
+	// split again once it has doubled, so a long piece that keeps growing
+	// is split a logarithmic number of times instead of on every write.
+	held int
+}
+
+func newStreamEncoder(bpe *CoreBPE) *streamEncoder {
+	return &streamEncoder{bpe: bpe}
+}
+
+// write buffers p and emits the tokens of every piece that is now final.
+func (s *streamEncoder) write(p []byte, emit func(token int)) {
+	s.pending = append(s.pending, p...)
+	s.encode(false, emit)
+}
+
+// flush emits the tokens of all buffered text.
+func (s *streamEncoder) flush(emit func(token int)) {
+	s.encode(true, emit)
+	s.pending = s.pending[:0]
+	s.held = 0
+}
+
+func (s *streamEncoder) encode(final bool, emit func(token int)) {
+	if !final && len(s.pending) < 2*s.held {
+		return
+	}
+	valid := len(s.pending)
+	if !final {
+		valid = completeUTF8Prefix(s.pending)
+	}
+	text := string(s.pending[:valid])
+	// pieces ending after stable may still change, see streamMargin
+	stable := valid
+	for i := 0; i < streamMargin && stable > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:stable])
+		stable -= size
+	}
+
+	appendTokens := func(piece string) {
+		s.tokens = s.bpe.appendPiece(s.tokens[:0], piece)
+		for _, token := range s.tokens {
+			emit(token)
+		}
+	}
+	// the last piece is only encoded once the next one starts
+	var last string
+	consumed, lastStart, lastEnd := 0, 0, 0
+	s.bpe.walkPieces(text, func(piece string, start, end int) bool {
+		if last != "" {
+			if !final && lastEnd > stable {
+				return false
+			}
+			appendTokens(last)
+			consumed = lastEnd
+		}
+		last, lastStart, lastEnd = piece, start, end
+		return true
+	})
+	if final {
+		if consumed < lastEnd {
+			appendTokens(last)
+		}
+		return
+	}
+	if lastStart == consumed && len(last) == lastEnd-lastStart {
+		// encode the chunks of a held piece that the cap cuts off anyway
+		known := lastEnd
+		if known > stable {
+			known = stable
+		}
+		for max := s.bpe.maxPieceLength; max > 0 && known-consumed > max; {
+			n := safeCut(s.pending[consumed:known], max)
+			appendTokens(text[consumed : consumed+n])
+			consumed += n
+		}
+	}
+	s.pending = append(s.pending[:0], s.pending[consumed:]...)
+	s.held = len(s.pending)
+}
+
+// completeUTF8Prefix returns the length of b without a trailing, possibly
+// incomplete, UTF-8 sequence.
+func completeUTF8Prefix(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,54 @@
+package tiktoken
+
+import "strings"
+
+// StreamDecoder decodes tokens one at a time, e.g. those of a streamed
+// chat completion, into text made of whole characters only. The bytes of
+// a character split across tokens are held back until its last byte
+// arrives; bytes that can't become a character are replaced with U+FFFD,
+// as DecodeReplace does. It is DecodeWriter for callers that want strings
+// rather than a writer. A StreamDecoder is not safe for concurrent use.
+type StreamDecoder struct {
+	t   *Tiktoken
+	buf []byte
+}
+
+// NewStreamDecoder returns a StreamDecoder decoding tokens of t.
+func (t *Tiktoken) NewStreamDecoder() *StreamDecoder {
+	return &StreamDecoder{t: t}
+}
+
+// Push decodes token and returns the text that is complete now, which is
+// empty while a character is still missing bytes. It returns false, and
+// ignores the token, if token is not in the vocabulary of the encoding.
+func (d *StreamDecoder) Push(token int) (string, bool) {
+	token, ok := d.t.unfilterToken(token)
+	if !ok || !d.t.bpe.hasToken(token) {
+		return "", false
+	}
+	d.buf = append(d.buf, d.t.bpe.tokenBytes(token)...)
+	complete := completeUTF8Prefix(d.buf)
+	if complete == 0 {
+		return "", true
+	}
+	text := strings.ToValidUTF8(string(d.buf[:complete]), "\uFFFD")
+	d.buf = append(d.buf[:0], d.buf[complete:]...)
+	return text, true
+}
+
+// Pending reports the number of bytes held back for an incomplete
+// character.
+func (d *StreamDecoder) Pending() int {
+	return len(d.buf)
+}
+
+// Flush ends the stream: it returns U+FFFD for a character that never got
+// all its bytes, or "" if none is pending, and leaves d ready for a new
+// stream.
+func (d *StreamDecoder) Flush() string {
+	if len(d.buf) == 0 {
+		return ""
+	}
+	d.buf = d.buf[:0]
+	return "\uFFFD"
+}
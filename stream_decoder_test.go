@@ -0,0 +1,52 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamDecoder(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	d := enc.NewStreamDecoder()
+	var joined strings.Builder
+	for _, token := range enc.EncodeOrdinary(multilingualText) {
+		text, ok := d.Push(token)
+		ass.True(ok)
+		ass.True(utf8.ValidString(text), "%q", text)
+		joined.WriteString(text)
+	}
+	ass.Equal(0, d.Pending())
+	ass.Equal("", d.Flush())
+	ass.Equal(multilingualText, joined.String())
+
+	// a character split across tokens comes out whole
+	first, second := enc.bpe.encoder["\xe4\xbd"], enc.bpe.encoder["\xa0"]
+	text, ok := d.Push(first)
+	ass.True(ok)
+	ass.Equal("", text)
+	ass.Equal(2, d.Pending())
+	text, ok = d.Push(second)
+	ass.True(ok)
+	ass.Equal("你", text)
+
+	// bytes that can't become a character are replaced
+	d.Push(first)
+	text, _ = d.Push(enc.EncodeOrdinary("a")[0])
+	ass.Equal("\uFFFDa", text)
+	d.Push(first)
+	ass.Equal("\uFFFD", d.Flush())
+	ass.Equal(0, d.Pending())
+
+	text, ok = d.Push(-1)
+	ass.False(ok)
+	ass.Equal("", text)
+	text, ok = d.Push(151643)
+	ass.True(ok)
+	ass.Equal(ENDOFTEXT, text)
+}
@@ -0,0 +1,76 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const multilingualText = "hello world! It's 2024, isn't it?\n\n  你好，世界！こんにちは世界！안녕하세요 세계! Привет мир! ¡Hola mundo! 👋🏽 done.   \n"
+
+func TestStreamEncoder(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	want := enc.EncodeOrdinary(multilingualText)
+
+	for _, size := range []int{1, 2, 3, 7, 64, len(multilingualText)} {
+		var got []int
+		emit := func(token int) { got = append(got, token) }
+		s := newStreamEncoder(enc.bpe)
+		for i := 0; i < len(multilingualText); i += size {
+			end := i + size
+			if end > len(multilingualText) {
+				end = len(multilingualText)
+			}
+			s.write([]byte(multilingualText[i:end]), emit)
+		}
+		s.flush(emit)
+		ass.Equal(want, got, "chunk size %d", size)
+	}
+}
+
+func TestStreamEncoderLongPieces(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	texts := []string{
+		strings.Repeat("a", 5000),
+		"x " + strings.Repeat(" ", 3000) + "y",
+		strings.Repeat("+-", 2000) + "\n",
+		"It's " + strings.Repeat("汉字", 1500) + " done",
+		strings.Repeat("AbC", 1500) + "'s",
+	}
+	for _, max := range []int{0, 64, 1000} {
+		capped := enc.WithOptions(WithMaxPieceLength(max))
+		for _, text := range texts {
+			want := capped.EncodeOrdinary(text)
+			for _, size := range []int{1, 7, 100, 4096} {
+				var got []int
+				emit := func(token int) { got = append(got, token) }
+				s := newStreamEncoder(capped.bpe)
+				for i := 0; i < len(text); i += size {
+					end := i + size
+					if end > len(text) {
+						end = len(text)
+					}
+					s.write([]byte(text[i:end]), emit)
+					if max > 0 {
+						ass.Less(len(s.pending), 2*max+100, "the held text stays bounded")
+					}
+				}
+				s.flush(emit)
+				ass.Equal(want, got, "cap %d, chunk size %d: %.20q", max, size, text)
+			}
+		}
+	}
+}
+
+func TestCompleteUTF8Prefix(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal(3, completeUTF8Prefix([]byte("abc")))
+	ass.Equal(1, completeUTF8Prefix([]byte("a\xe4\xbd")))
+	ass.Equal(4, completeUTF8Prefix([]byte("a你")))
+	ass.Equal(2, completeUTF8Prefix([]byte("a\xff")), "invalid bytes are not held back")
+}
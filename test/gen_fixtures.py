@@ -0,0 +1,79 @@
+"""
+Write the fixtures that tiktokentest.VerifyAgainstFixtures checks, with the
+tokens of the Python tiktoken library:
+
+    pip install tiktoken
+    python test/gen_fixtures.py > testdata/fixtures/openai.json
+
+Pass encoding names to generate fixtures of those only, and a file of one
+text per line with --corpus to add texts of your own.
+"""
+import argparse
+import json
+import sys
+
+import tiktoken as tk
+
+ENCODINGS = ['r50k_base', 'p50k_base', 'p50k_edit', 'cl100k_base', 'o200k_base']
+
+# Unicode edge cases: scripts, combining marks, emoji sequences, whitespace
+# runs, contractions, numbers, and strings that look like special tokens.
+CORPUS = [
+    '',
+    'hello world',
+    "Hello, World! It's what they'll say, isn't it? I'M SURE WE'VE SEEN IT.",
+    '1234567 and 3.14159 or 1,000,000',
+    '  leading and trailing  \n\n\n',
+    '\t\r\n \r\n  　',
+    '你好，世界！こんにちは 안녕하세요',
+    'Привет, мир. مرحبا بالعالم. שלום עולם. नमस्ते दुनिया. สวัสดีชาวโลก',
+    'é vs é, ﬁ ligature, Å vs Å, ǅ titlecase',
+    '👍🏽 👨‍👩‍👧‍👦 🇺🇸 🏳️‍🌈 #️⃣',
+    'zero​width‌joiners‍ and ﻿BOM',
+    'a' * 1000,
+    'ab1+/' * 200,
+    'func main() {\n\tfmt.Println("hi")\n}\n',
+    '<|endoftext|> <|fim_prefix|> <|not_special|> <|endoftext',
+    '\U0001d54f\U0001d58a\U0001d5c9 mathematical alphanumerics',
+]
+
+
+def cases_for(name, corpus):
+    """
+    Encode the corpus, and every special token alone and in text
+    :param name: encoding name
+    :param corpus: texts
+    :return: fixture cases
+    """
+    enc = tk.get_encoding(name)
+    cases = []
+    for text in corpus:
+        cases.append({'encoding': name, 'text': text,
+                      'tokens': enc.encode(text, disallowed_special=())})
+    for special in sorted(enc.special_tokens_set):
+        for text in (special, 'before' + special + 'after'):
+            cases.append({'encoding': name, 'text': text, 'allowed_special': ['all'],
+                          'tokens': enc.encode(text, allowed_special='all')})
+    return cases
+
+
+def main():
+    parser = argparse.ArgumentParser(description=__doc__.strip().splitlines()[0])
+    parser.add_argument('encodings', nargs='*', default=ENCODINGS)
+    parser.add_argument('--corpus', help='file of additional texts, one per line')
+    args = parser.parse_args()
+
+    corpus = list(CORPUS)
+    if args.corpus:
+        with open(args.corpus, 'r', encoding='utf-8') as f:
+            corpus += f.read().splitlines()
+    cases = []
+    for name in args.encodings:
+        cases += cases_for(name, corpus)
+    json.dump({'generator': 'tiktoken ' + tk.__version__, 'cases': cases},
+              sys.stdout, ensure_ascii=False, indent=1)
+    sys.stdout.write('\n')
+
+
+if __name__ == '__main__':
+    main()
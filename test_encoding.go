@@ -0,0 +1,79 @@
+package tiktoken
+
+// testEncodingName is the name of the encoding of GetTestEncoding.
+const testEncodingName = "test_mini"
+
+// testPattern is p50k's pattern with digit runs of at most three, so the
+// test encoding has a split pattern of its own that the ASCII splitter
+// still covers.
+const testPattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}{1,3}| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+// testMerges are the merges of the test encoding after its 256 byte tokens,
+// in rank order: common English, contractions, digits, whitespace runs and
+// a few multi-byte characters.
+var testMerges = [][2]string{
+	{"t", "h"}, {"h", "e"}, {"i", "n"}, {"e", "r"}, {"o", "n"}, {"r", "e"},
+	{"a", "n"}, {"e", "n"}, {"o", "r"}, {"a", "t"}, {"e", "s"}, {"e", "d"},
+	{"i", "s"}, {"i", "t"}, {"a", "l"}, {"a", "r"}, {"s", "t"}, {"o", "u"},
+	{"l", "l"}, {"l", "o"}, {"l", "d"}, {"e", "l"}, {"n", "g"}, {"in", "g"},
+	{"th", "e"}, {"h", "el"}, {"hel", "lo"}, {"H", "el"}, {"Hel", "lo"},
+	{"w", "or"}, {"wor", "ld"}, {"t", "o"}, {"o", "f"}, {"an", "d"}, {"v", "e"},
+
+	{" ", "t"}, {" ", "a"}, {" ", "w"}, {" ", "s"}, {" ", "o"}, {" ", "c"},
+	{" ", "b"}, {" ", "f"}, {" ", "h"}, {" ", "i"}, {" ", "m"}, {" ", "p"},
+	{" ", "d"}, {" ", "l"}, {" ", "n"}, {" ", "e"}, {" ", "r"}, {" ", "g"},
+	{" t", "he"}, {" a", "n"}, {" an", "d"}, {" o", "f"}, {" t", "o"}, {" i", "n"},
+	{" i", "s"}, {" i", "t"}, {" ", "hello"}, {" w", "or"}, {" wor", "ld"},
+	{" ", "th"}, {" th", "at"}, {" ", "T"}, {" T", "he"},
+
+	{"'", "s"}, {"'", "t"}, {"'", "re"}, {"'", "ll"}, {"'", "ve"},
+
+	{"1", "2"}, {"12", "3"}, {"0", "0"}, {"00", "0"}, {" ", "1"}, {" ", "2"},
+
+	{" ", " "}, {"  ", "  "}, {"\n", "\n"}, {"\t", "\t"}, {".", "."},
+	{"..", "."}, {"(", ")"}, {" ", "("}, {" ", "="}, {" ", "-"}, {"-", "-"},
+
+	// é, ñ and ü, 你, 好, 世 and 界, and 你好
+	{"\xc3", "\xa9"}, {"\xc3", "\xb1"}, {"\xc3", "\xbc"}, {" ", "é"},
+	{"\xe4", "\xbd"}, {"\xe4\xbd", "\xa0"}, {"\xe5", "\xa5"}, {"\xe5\xa5", "\xbd"},
+	{"\xe4", "\xb8"}, {"\xe4\xb8", "\x96"}, {"\xe7", "\x95"}, {"\xe7\x95", "\x8c"},
+	{"你", "好"},
+}
+
+// testEndOfText is the special token of the test encoding.
+const testEndOfText = "<|endoftext|>"
+
+func testEncoding() *Encoding {
+	ranks := make(map[string]int, 256+len(testMerges))
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for _, merge := range testMerges {
+		ranks[merge[0]+merge[1]] = len(ranks)
+	}
+	return &Encoding{
+		Name:           testEncodingName,
+		PatStr:         testPattern,
+		MergeableRanks: ranks,
+		SpecialTokens:  map[string]int{testEndOfText: len(ranks)},
+	}
+}
+
+// GetTestEncoding returns a tiny encoding built into the package, for unit
+// tests of code that splits, truncates or budgets tokens without loading a
+// real vocabulary. It has the 256 byte tokens, about a hundred merges of
+// English, digits, whitespace and a few multi-byte characters, a split
+// pattern of its own and the special token <|endoftext|>, so its texts take
+// the same code paths as those of real encodings.
+//
+// Its tokens resemble those of no real encoding, and its vocabulary,
+// pattern and ids are unstable: they may change in any release. Only use
+// it in tests, and don't store its tokens. Each call returns a new
+// instance.
+func GetTestEncoding() *Tiktoken {
+	tk, err := newTiktokenFromEncoding(testEncoding())
+	if err != nil {
+		panic("tiktoken: test encoding: " + err.Error())
+	}
+	return tk
+}
@@ -0,0 +1,42 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTestEncoding(t *testing.T) {
+	ass := assert.New(t)
+
+	seen := map[string]bool{}
+	for b := 0; b < 256; b++ {
+		seen[string([]byte{byte(b)})] = true
+	}
+	for _, merge := range testMerges {
+		ass.True(seen[merge[0]] && seen[merge[1]], "%q merges unknown tokens", merge)
+		ass.False(seen[merge[0]+merge[1]], "%q is a duplicate", merge)
+		seen[merge[0]+merge[1]] = true
+	}
+
+	tk := GetTestEncoding()
+	ass.NotSame(tk, GetTestEncoding())
+	ass.Equal(testEncodingName, tk.Name())
+
+	tokens := tk.Encode("Hello world, the 1234 café 你好世界 👍", nil, nil)
+	var pieces []string
+	for _, token := range tokens {
+		pieces = append(pieces, tk.Decode([]int{token}))
+	}
+	ass.Equal([]string{
+		"Hello", " world", ",", " the", " ", "123", "4", " c", "a", "f", "é",
+		" ", "你好", "世", "界", " ", "\xf0", "\x9f", "\x91", "\x8d",
+	}, pieces)
+	ass.Equal("Hello world, the 1234 café 你好世界 👍", tk.Decode(tokens))
+
+	eot := tk.Encode("hi"+testEndOfText, []string{"all"}, nil)
+	ass.Equal([]int{'h', 'i', 256 + len(testMerges)}, eot)
+	_, err := tk.EncodeWithError(testEndOfText, nil, []string{"all"})
+	ass.NotNil(err)
+	ass.Equal(tk.CountTokens("hello   world's"), len(tk.EncodeOrdinary("hello   world's")))
+}
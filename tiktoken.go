@@ -2,24 +2,181 @@ package tiktoken
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/dlclark/regexp2"
 )
 
 var bpeLoader BpeLoader = NewDefaultBpeLoader()
 
+// sl guards the settings changed by SetBpeLoader, SetLlama3TokenizerModel
+// and SetImageTokenCost.
+var sl = &sync.RWMutex{}
+
+// SetBpeLoader replaces the loader used for rank files. Encodings that are
+// already loaded keep their vocabulary until RefreshEncoding.
 func SetBpeLoader(loader BpeLoader) {
+	sl.Lock()
+	defer sl.Unlock()
 	bpeLoader = loader
 }
 
+func currentBpeLoader() BpeLoader {
+	sl.RLock()
+	defer sl.RUnlock()
+	return bpeLoader
+}
+
+var tiktokenMap = make(map[string]*Tiktoken)
+var tl = &sync.Mutex{}
+
+// encodingLoads are the loads of GetEncoding under way by name, guarded by
+// tl.
+var encodingLoads = map[string]*encodingLoad{}
+
+// encodingLoad is a load of GetEncoding, done once closed.
+type encodingLoad struct {
+	done chan struct{}
+	tk   *Tiktoken
+	err  error
+}
+
+// GetEncoding returns the instance of the named encoding shared by the
+// process, loading it on first use. Concurrent calls for an encoding that
+// isn't loaded yet wait for a single load, and don't hold up calls for
+// encodings already loaded. A failed load isn't cached, the next call tries
+// again.
 func GetEncoding(encodingName string) (*Tiktoken, error) {
-	enc, err := getEncoding(encodingName)
+	tl.Lock()
+	if tk, ok := tiktokenMap[encodingName]; ok {
+		tl.Unlock()
+		recordLookup(encodingName, true)
+		return tk, nil
+	}
+	load, loading := encodingLoads[encodingName]
+	if !loading {
+		load = &encodingLoad{done: make(chan struct{})}
+		encodingLoads[encodingName] = load
+	}
+	tl.Unlock()
+	recordLookup(encodingName, false)
+	if loading {
+		<-load.done
+		return load.tk, load.err
+	}
+
+	defer func() {
+		tl.Lock()
+		delete(encodingLoads, encodingName)
+		tl.Unlock()
+		close(load.done)
+	}()
+	load.tk, load.err = loadEncoding(encodingName)
+	return load.tk, load.err
+}
+
+// GetEncodingCached is GetEncoding, which already builds each encoding once
+// and returns the shared instance.
+func GetEncodingCached(encodingName string) (*Tiktoken, error) {
+	return GetEncoding(encodingName)
+}
+
+// loadEncoding caches the named encoding, building it without holding the
+// cache locks so several encodings load in parallel. Rank files shared
+// between encodings are still parsed once.
+func loadEncoding(name string) (*Tiktoken, error) {
+	l.Lock()
+	enc, ok := encodingMap[name]
+	l.Unlock()
+	if !ok {
+		var err error
+		if enc, err = initEncoding(name); err != nil {
+			return nil, err
+		}
+	}
+	tk, err := newTiktokenFromEncoding(enc)
 	if err != nil {
 		return nil, err
 	}
-	pbe, err := NewCoreBPE(enc.MergeableRanks, enc.SpecialTokens, enc.PatStr)
+
+	tl.Lock()
+	defer tl.Unlock()
+	if cached, ok := tiktokenMap[name]; ok {
+		// stored by RefreshEncoding or UpdateEncodingSpecials in the meantime
+		return cached, nil
+	}
+	l.Lock()
+	if _, ok := encodingMap[name]; !ok {
+		encodingMap[name] = enc
+	}
+	l.Unlock()
+	tiktokenMap[name] = tk
+	setLoaded(name, true)
+	return tk, nil
+}
+
+// MustGetEncoding is like GetEncoding but panics if the encoding can't be
+// loaded. It simplifies initializing package-level variables with encodings
+// whose names are known to be correct; the result is cached as usual.
+func MustGetEncoding(encodingName string) *Tiktoken {
+	tk, err := GetEncoding(encodingName)
+	if err != nil {
+		panic(`tiktoken: GetEncoding(` + strconv.Quote(encodingName) + `): ` + err.Error())
+	}
+	return tk
+}
+
+// RefreshEncoding drops the cached rank file of the named encoding, loads it
+// again and replaces the cached *Tiktoken. Instances obtained before the
+// refresh keep working with the old vocabulary. With the default loader, a
+// download that fails because the network is unavailable falls back to the
+// copy cached before, see WithStaleIfError.
+func RefreshEncoding(encodingName string) error {
+	if uri, ok := encodingSources[encodingName]; ok {
+		forgetRankTables(currentBpeLoader(), uri)
+		switch loader := currentBpeLoader().(type) {
+		case cacheRevalidator:
+			if err := loader.markStale(uri); err != nil {
+				return fmt.Errorf("invalidate cache for %s: %w", encodingName, err)
+			}
+		case CacheInvalidator:
+			if err := loader.InvalidateCache(uri); err != nil {
+				return fmt.Errorf("invalidate cache for %s: %w", encodingName, err)
+			}
+		}
+	}
+	enc, err := initEncoding(encodingName)
+	if err != nil {
+		return err
+	}
+	tk, err := newTiktokenFromEncoding(enc)
+	if err != nil {
+		return err
+	}
+
+	l.Lock()
+	encodingMap[encodingName] = enc
+	l.Unlock()
+
+	tl.Lock()
+	tiktokenMap[encodingName] = tk
+	setLoaded(encodingName, true)
+	tl.Unlock()
+	return nil
+}
+
+func newTiktokenFromEncoding(enc *Encoding) (*Tiktoken, error) {
+	var pbe *CoreBPE
+	var err error
+	if enc.tables != nil && sameRanks(enc.tables.encoder, enc.MergeableRanks) {
+		pbe, err = newCoreBPE(enc.tables, enc.SpecialTokens, enc.PatStr)
+	} else {
+		pbe, err = NewCoreBPE(enc.MergeableRanks, enc.SpecialTokens, enc.PatStr)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -31,63 +188,300 @@ func GetEncoding(encodingName string) (*Tiktoken, error) {
 }
 
 func EncodingForModel(modelName string) (*Tiktoken, error) {
+	model, encodingName, err := encodingNameForModel(modelName)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := GetEncoding(encodingName)
+	if err != nil {
+		return nil, err
+	}
+	return withModel(tk, model), nil
+}
+
+func encodingNameForModel(modelName string) (model, encodingName string, err error) {
+	model, encodingName, _, ok := matchModel(modelName)
+	if !ok {
+		return "", "", fmt.Errorf("%w %s", ErrModelNotFound, modelName)
+	}
+	return model, encodingName, nil
+}
+
+// matchModel looks modelName up in MODEL_TO_ENCODING and then in
+// MODEL_PREFIX_TO_ENCODING, returning the matching prefix for the latter.
+// Surrounding whitespace is ignored and case doesn't matter; model is the
+// name as registered, or for a prefix match the registered prefix followed
+// by the rest of modelName. The longest matching prefix wins, so the result
+// doesn't depend on map order.
+func matchModel(modelName string) (model, encodingName, prefix string, ok bool) {
+	ml.RLock()
+	defer ml.RUnlock()
 	if encodingName, ok := MODEL_TO_ENCODING[modelName]; ok {
+		return modelName, encodingName, "", true
+	}
+	name := strings.TrimSpace(modelName)
+	if encodingName, ok := MODEL_TO_ENCODING[name]; ok {
+		return name, encodingName, "", true
+	}
+	for m, encodingName := range MODEL_TO_ENCODING {
+		if strings.EqualFold(m, name) {
+			return m, encodingName, "", true
+		}
+	}
+	for p, e := range MODEL_PREFIX_TO_ENCODING {
+		if hasPrefixFold(name, p) && len(p) > len(prefix) {
+			encodingName, prefix, ok = e, p, true
+		}
+	}
+	if !ok {
+		return "", "", "", false
+	}
+	return prefix + name[len(prefix):], encodingName, prefix, true
+}
+
+// hasPrefixFold is strings.HasPrefix ignoring case.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// loaderKey identifies an encoding cached by GetEncodingWithLoader.
+type loaderKey struct {
+	loader       BpeLoader
+	encodingName string
+}
+
+var loaderTiktokenMap = make(map[loaderKey]*Tiktoken)
+var ll = &sync.Mutex{}
+
+// GetEncodingWithLoader is like GetEncoding but loads the rank files of
+// built-in encodings with loader instead of the package-default one, so a
+// single call can e.g. work offline without SetBpeLoader. Results are cached
+// per loader, loaders being told apart by ==; those whose type isn't
+// comparable aren't cached. Registered encodings are built by their
+// constructor as usual. A nil loader means GetEncoding.
+func GetEncodingWithLoader(encodingName string, loader BpeLoader) (*Tiktoken, error) {
+	if loader == nil {
 		return GetEncoding(encodingName)
-	} else {
-		for prefix, encodingName := range MODEL_PREFIX_TO_ENCODING {
-			if strings.HasPrefix(modelName, prefix) {
-				return GetEncoding(encodingName)
-			}
+	}
+	cacheable := reflect.TypeOf(loader).Comparable()
+	ll.Lock()
+	defer ll.Unlock()
+	key := loaderKey{loader, encodingName}
+	if cacheable {
+		if tk, ok := loaderTiktokenMap[key]; ok {
+			return tk, nil
 		}
 	}
-	return nil, fmt.Errorf("no encoding for model %s", modelName)
+	enc, err := initEncodingWithLoader(encodingName, loader)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := newTiktokenFromEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		loaderTiktokenMap[key] = tk
+	}
+	return tk, nil
+}
+
+// EncodingForModelWithLoader is EncodingForModel with the encoding loaded
+// by GetEncodingWithLoader.
+func EncodingForModelWithLoader(modelName string, loader BpeLoader) (*Tiktoken, error) {
+	model, encodingName, err := encodingNameForModel(modelName)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := GetEncodingWithLoader(encodingName, loader)
+	if err != nil {
+		return nil, err
+	}
+	return withModel(tk, model), nil
+}
+
+// MustEncodingForModel is like EncodingForModel but panics on failure.
+func MustEncodingForModel(modelName string) *Tiktoken {
+	tk, err := EncodingForModel(modelName)
+	if err != nil {
+		panic(`tiktoken: EncodingForModel(` + strconv.Quote(modelName) + `): ` + err.Error())
+	}
+	return tk
+}
+
+// withModel returns a copy of the cached encoding tk that remembers the
+// model it was resolved for. The copy shares all lookup tables.
+func withModel(tk *Tiktoken, modelName string) *Tiktoken {
+	copied := *tk
+	copied.model = modelName
+	return &copied
 }
 
 type Tiktoken struct {
 	bpe              *CoreBPE
 	pbeEncoding      *Encoding
 	specialTokensSet map[string]any
+	opts             encodeConfig
+	model            string
+	hash             *contentHash
+	// filters are the token filters of WithTokenFilter, in order.
+	filters []tokenFilter
+	// metrics are the counters of the encoding name, see EnableMetrics.
+	metrics *encodingMetrics
 }
 
+// Encode panics if text contains a disallowed special token, use
+// EncodeWithError to get an error instead. Nil arguments stand for the
+// defaults set with WithDefaultAllowedSpecial and
+// WithDefaultDisallowedSpecial, which are empty unless set.
 func (t *Tiktoken) Encode(text string, allowedSpecial []string, disallowedSpecial []string) []int {
-	var allowedSpecialSet map[string]any
-	if len(allowedSpecial) == 0 {
-		allowedSpecialSet = map[string]any{}
-	} else if len(allowedSpecial) == 1 && allowedSpecial[0] == "all" {
-		allowedSpecialSet = t.specialTokensSet
-	} else {
-		allowedSpecialSet = map[string]any{}
-		for _, v := range allowedSpecial {
-			allowedSpecialSet[v] = nil
-		}
+	tokens, err := t.EncodeWithError(text, allowedSpecial, disallowedSpecial)
+	if err != nil {
+		panic(err.Error())
 	}
+	return tokens
+}
 
-	disallowedSpecialSet := map[string]any{}
-	for _, v := range disallowedSpecial {
-		disallowedSpecialSet[v] = nil
+// EncodeWithError is like Encode but returns an error instead of panicking.
+func (t *Tiktoken) EncodeWithError(text string, allowedSpecial []string, disallowedSpecial []string) ([]int, error) {
+	return t.encodeScratch([]int{}, text, allowedSpecial, disallowedSpecial, &mergeScratch{})
+}
+
+// encodeScratch is EncodeWithError appending the tokens to dst and merging
+// with the buffers of scratch.
+func (t *Tiktoken) encodeScratch(dst []int, text string, allowedSpecial, disallowedSpecial []string, scratch *mergeScratch) ([]int, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
 	}
-	if len(disallowedSpecial) == 1 && disallowedSpecial[0] == "all" {
-		disallowedSpecialSet = difference(t.specialTokensSet, allowedSpecialSet)
+	start := metricsStart()
+	size := len(text)
+	text = t.prepareText(text)
+	allowedSpecialSet, err := t.checkSpecial(text, allowedSpecial, disallowedSpecial)
+	if err != nil {
+		return nil, err
 	}
+	tokens, _ := t.bpe.encodeNativeScratch(dst, text, allowedSpecialSet, scratch)
+	tokens = t.filterTokens(tokens)
+	t.record(start, len(tokens), size)
+	return tokens, nil
+}
 
-	if len(disallowedSpecialSet) > 0 {
-		specialRegex := t.SpecialTokenRegex(disallowedSpecialSet)
-		m := findRegex2StringMatch(text, specialRegex)
-		if m != "" {
-			panic(fmt.Sprintf("text contains disallowed special token %s", m))
+// checkSpecial returns the special tokens allowed by the allowedSpecial
+// argument of EncodeWithError, or an error if text, which has been
+// prepared, contains one disallowed by disallowedSpecial. Nil arguments
+// stand for the defaults.
+func (t *Tiktoken) checkSpecial(text string, allowedSpecial, disallowedSpecial []string) (map[string]any, error) {
+	if allowedSpecial == nil {
+		allowedSpecial = t.opts.allowedSpecial
+	}
+	if disallowedSpecial == nil {
+		disallowedSpecial = t.opts.disallowedSpecial
+	}
+	allowed := t.allowedSpecialSet(allowedSpecial)
+	if disallowed := t.disallowedSpecialSet(disallowedSpecial, allowed); len(disallowed) > 0 {
+		if m := t.findDisallowed(text, disallowed); m != "" {
+			return nil, &DisallowedSpecialError{Token: m}
 		}
 	}
+	return allowed, nil
+}
 
-	tokens, _ := t.bpe.encodeNative(text, allowedSpecialSet)
-	return tokens
+// allowedSpecialSet returns the special tokens named by an allowedSpecial
+// argument.
+func (t *Tiktoken) allowedSpecialSet(allowedSpecial []string) map[string]any {
+	if len(allowedSpecial) == 1 && allowedSpecial[0] == "all" {
+		return t.specialTokensSet
+	}
+	if len(allowedSpecial) == 0 {
+		// nothing to allocate for the default
+		return nil
+	}
+	set := map[string]any{}
+	for _, v := range allowedSpecial {
+		set[v] = nil
+	}
+	return set
+}
+
+// disallowedSpecialSet returns the strings named by a disallowedSpecial
+// argument, "all" meaning the special tokens not in allowed.
+func (t *Tiktoken) disallowedSpecialSet(disallowedSpecial []string, allowed map[string]any) map[string]any {
+	if len(disallowedSpecial) == 1 && disallowedSpecial[0] == "all" {
+		return difference(t.specialTokensSet, allowed)
+	}
+	if len(disallowedSpecial) == 0 {
+		// nothing to allocate for the default
+		return nil
+	}
+	set := map[string]any{}
+	for _, v := range disallowedSpecial {
+		set[v] = nil
+	}
+	return set
 }
 
 func (t *Tiktoken) EncodeOrdinary(text string) []int {
-	return (t.bpe.encodeOrdinaryNative(text))
+	start := metricsStart()
+	tokens := t.filterTokens(t.bpe.encodeOrdinaryNative(t.prepareText(text)))
+	t.record(start, len(tokens), len(text))
+	return tokens
+}
+
+// CountTokens returns len(t.EncodeOrdinary(text)) without building the
+// token slice.
+func (t *Tiktoken) CountTokens(text string) int {
+	start := metricsStart()
+	n := 0
+	if len(t.filters) > 0 {
+		t.bpe.encodeOrdinaryFunc(t.prepareText(text), func(token int) {
+			if _, ok := t.filterToken(token); ok {
+				n++
+			}
+		})
+	} else {
+		n = t.bpe.countOrdinary(t.prepareText(text))
+	}
+	t.record(start, n, len(text))
+	return n
 }
 
+// Decode decodes tokens in DecodeRaw mode: tokens that are not part of the
+// vocabulary are skipped, use DecodeWithError to detect them, and the bytes
+// are not checked, so the result is not valid UTF-8 if the tokens end or
+// start in the middle of a character. See DecodeWithMode for the other
+// modes.
 func (t *Tiktoken) Decode(tokens []int) string {
-	return string(t.bpe.decodeNative(tokens))
+	t.bpe.mustOpen()
+	b, _ := t.DecodeBytesWithMode(tokens, DecodeRaw)
+	return string(b)
+}
+
+// DecodeWithError is like Decode but fails on the first unknown token.
+func (t *Tiktoken) DecodeWithError(tokens []int) (string, error) {
+	b, err := t.DecodeInto(make([]byte, 0, len(tokens)*2), tokens)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// findDisallowed returns the leftmost, longest string of disallowed found in
+// text, or "" if there is none.
+func (t *Tiktoken) findDisallowed(text string, disallowed map[string]any) string {
+	for token := range disallowed {
+		if _, ok := t.bpe.specialTokensEncoder[token]; !ok {
+			// the matcher only knows the special tokens of the encoding
+			return findRegex2StringMatch(text, t.SpecialTokenRegex(disallowed))
+		}
+	}
+	occ, ok := t.findSpecial(text, func(token string) bool {
+		_, ok := disallowed[token]
+		return ok
+	})
+	if !ok {
+		return ""
+	}
+	return occ.Token
 }
 
 func (t *Tiktoken) SpecialTokenRegex(disallowedSpecialSet map[string]any) *regexp2.Regexp {
@@ -120,9 +514,124 @@ func difference(setA, setB map[string]any) map[string]any {
 
 // NewTiktoken can be used to create a *Tiktoken with custom parameters.
 func NewTiktoken(bpe *CoreBPE, encoding *Encoding, specialTokensSet map[string]any) *Tiktoken {
+	name := ""
+	if encoding != nil {
+		name = encoding.Name
+	}
 	return &Tiktoken{
 		bpe:              bpe,
 		pbeEncoding:      encoding,
 		specialTokensSet: specialTokensSet,
+		hash:             &contentHash{},
+		metrics:          metricsFor(name),
+	}
+}
+
+// BytePairSplit runs the merge algorithm on exactly the given bytes, without
+// splitting them with the encoding's pattern first, and returns the chunks
+// the bytes were merged into. Each chunk is a token of the vocabulary.
+func (t *Tiktoken) BytePairSplit(piece []byte) [][]byte {
+	t.bpe.mustOpen()
+	if len(piece) == 0 {
+		return [][]byte{}
+	}
+	return bytePairSplit(piece, t.bpe.encoder)
+}
+
+// BytePairEncode is like BytePairSplit but returns the token of each chunk.
+func (t *Tiktoken) BytePairEncode(piece []byte) []int {
+	t.bpe.mustOpen()
+	if len(piece) == 0 {
+		return []int{}
+	}
+	return bytePairEncode(piece, t.bpe.encoder)
+}
+
+// DecodeTokensToBytes returns the bytes of each token, aligned with tokens.
+// Special tokens decode to their literal text. Unknown tokens, and ids the
+// token filters can't map back, yield an empty slice and are reported
+// together in the returned error.
+func (t *Tiktoken) DecodeTokensToBytes(tokens []int) ([][]byte, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	ret := make([][]byte, len(tokens))
+	var invalid []int
+	for i, token := range tokens {
+		var b []byte
+		if id, ok := t.unfilterToken(token); ok {
+			b = t.bpe.tokenBytes(id)
+		}
+		if b == nil {
+			invalid = append(invalid, i)
+			b = []byte{}
+		}
+		ret[i] = b
+	}
+	if len(invalid) > 0 {
+		return ret, &InvalidTokenError{Token: tokens[invalid[0]], Index: invalid[0], Indices: invalid}
+	}
+	return ret, nil
+}
+
+// DecodeTokensBytes is DecodeTokensToBytes without the error, like
+// decode_tokens_bytes of the Python library. Unknown tokens yield empty
+// slices.
+func (t *Tiktoken) DecodeTokensBytes(tokens []int) [][]byte {
+	t.bpe.mustOpen()
+	chunks, _ := t.DecodeTokensToBytes(tokens)
+	return chunks
+}
+
+// EncodeSingleToken returns the token whose bytes are exactly piece, an
+// ordinary or a special one, like encode_single_token of the Python
+// library. It fails for bytes that are no single token, with no merging
+// attempted, and for a token dropped by the token filters.
+func (t *Tiktoken) EncodeSingleToken(piece []byte) (int, error) {
+	if t.isClosed() {
+		return 0, ErrClosed
+	}
+	token, ok := t.bpe.encoder[string(piece)]
+	if !ok {
+		token, ok = t.bpe.specialTokensEncoder[string(piece)]
+	}
+	if ok {
+		token, ok = t.filterToken(token)
+	}
+	if !ok {
+		return 0, fmt.Errorf("%q is not a single token", piece)
+	}
+	return token, nil
+}
+
+// DecodeSingleTokenBytes returns the bytes of token, the inverse of
+// EncodeSingleToken. The bytes are a copy the caller may modify.
+func (t *Tiktoken) DecodeSingleTokenBytes(token int) ([]byte, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	id := token
+	if len(t.filters) > 0 {
+		var ok bool
+		if id, ok = t.unfilterToken(token); !ok {
+			return nil, fmt.Errorf("token %d can't be mapped back by the token filters", token)
+		}
+	}
+	b := t.bpe.tokenBytes(id)
+	if b == nil {
+		return nil, &InvalidTokenError{Token: token, Index: -1}
+	}
+	return append([]byte{}, b...), nil
+}
+
+// DecodeTokensToStrings is like DecodeTokensToBytes but returns strings. A
+// token holding part of a multi-byte character decodes to text containing
+// U+FFFD, use DecodeTokensToBytes when that loss matters.
+func (t *Tiktoken) DecodeTokensToStrings(tokens []int) ([]string, error) {
+	chunks, err := t.DecodeTokensToBytes(tokens)
+	ret := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		ret[i] = strings.ToValidUTF8(string(chunk), "�")
 	}
+	return ret, err
 }
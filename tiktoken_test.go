@@ -1,7 +1,18 @@
 package tiktoken
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -36,7 +47,38 @@ func TestQwenEncoding(t *testing.T) {
 	enc, err := EncodingForModel("qwen")
 	ass.Nil(err, "Encoding  init should not be nil")
 	tokens := enc.Encode("hello world!你好，世界！", []string{"all"}, []string{"all"})
-	ass.Equal(7, len(tokens))
+	// these tokens are converted from the reference Qwen tokenizer
+	ass.Equal([]int{14990, 1879, 0, 108386, 3837, 99489, 6313}, tokens)
+	ass.Equal([]int{16, 17, 18, 40676}, enc.Encode("123 apples", nil, nil))
+	ass.Equal([]int{151644, 872, 198, 13048, 151645}, enc.Encode("<|im_start|>user\nHi<|im_end|>", []string{"all"}, nil))
+	ass.Equal("<|extra_204|>", enc.Decode([]int{151850}))
+
+	enc, err = EncodingForModel("qwen2-7b-instruct")
+	ass.Nil(err)
+	ass.Equal(MODEL_QWEN_BASE, enc.Name())
+}
+
+func TestRegisterEncoding(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	rankFile := filepath.Join(dir, "tiny.tiktoken")
+	writeRankFile(t, rankFile, "a", "b", "ab")
+
+	ass.Equal(map[string]int{"<|r_0|>": 10, "<|r_1|>": 11}, SpecialTokenRange("<|r_%d|>", 10, 2))
+	_, err := NewEncodingFromRankFile("tiny", rankFile, `\w+`, map[string]int{"<|end|>": 2})
+	ass.EqualError(err, "special token <|end|> has id 2, which is also a mergeable rank")
+
+	RegisterEncoding("tiny", func() (*Encoding, error) {
+		return NewEncodingFromRankFile("tiny", rankFile, `\w+`, SpecialTokenRange("<|r_%d|>", 3, 2))
+	})
+	RegisterModelPrefix("tiny-", "tiny")
+	defer delete(MODEL_PREFIX_TO_ENCODING, "tiny-")
+	enc, err := EncodingForModel("tiny-chat")
+	ass.Nil(err)
+	ass.Equal("tiny-chat", enc.Model())
+	ass.Equal(rankFile, enc.SourceURI())
+	ass.Equal([]int{2, 4}, enc.Encode("ab<|r_1|>", []string{"all"}, nil))
 }
 
 func TestDecoding(t *testing.T) {
@@ -52,3 +94,394 @@ func TestDecoding(t *testing.T) {
 	ass.Equal("hello world!你好，世界！", txt, "Decoding should be equal")
 	ass.Equal("hello world!你好，世界！", txt2, "Decoding should be equal")
 }
+
+func TestRefreshEncoding(t *testing.T) {
+	ass := assert.New(t)
+	old, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	cached, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Same(old, cached, "GetEncoding should return the cached instance")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			old.Encode("hello world!你好，世界！", nil, nil)
+		}
+	}()
+	ass.Nil(RefreshEncoding(MODEL_QWEN_BASE))
+	<-done
+
+	refreshed, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.NotSame(old, refreshed)
+	ass.Equal(old.Encode("hello world!你好，世界！", nil, nil), refreshed.Encode("hello world!你好，世界！", nil, nil))
+
+	ass.NotNil(RefreshEncoding("unknown_base"))
+}
+
+func TestEncodeDecodeWithError(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	_, err = enc.EncodeWithError("hello <|endoftext|>", nil, []string{"all"})
+	ass.EqualError(err, "text contains disallowed special token <|endoftext|>")
+	tokens, err := enc.EncodeWithError("hello <|endoftext|>", []string{"all"}, nil)
+	ass.Nil(err)
+	ass.Equal(enc.Encode("hello <|endoftext|>", []string{"all"}, nil), tokens)
+
+	tokens = enc.Encode("hello world", nil, nil)
+	text, err := enc.DecodeWithError(tokens)
+	ass.Nil(err)
+	ass.Equal("hello world", text)
+
+	_, err = enc.DecodeWithError([]int{tokens[0], -1})
+	ass.EqualError(err, "invalid token -1 at index 1")
+	ass.Equal(enc.Decode(tokens[:1]), enc.Decode([]int{tokens[0], -1, 1 << 40}))
+}
+
+func TestEncodeWithoutSpecialTokens(t *testing.T) {
+	ass := assert.New(t)
+	bpe, err := NewCoreBPE(map[string]int{"a": 0, "b": 1, "ab": 2}, map[string]int{}, `\w+|\s+`)
+	ass.Nil(err)
+	enc := NewTiktoken(bpe, &Encoding{Name: "tiny"}, map[string]any{})
+	ass.Equal([]int{2, 0}, enc.Encode("aba", nil, nil))
+}
+
+func TestDecodeTokensToStrings(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	tokens := enc.Encode("hello world!你好", nil, nil)
+	chunks, err := enc.DecodeTokensToBytes(tokens)
+	ass.Nil(err)
+	ass.Len(chunks, len(tokens))
+	joined := []byte{}
+	for _, chunk := range chunks {
+		joined = append(joined, chunk...)
+	}
+	ass.Equal("hello world!你好", string(joined))
+
+	strs, err := enc.DecodeTokensToStrings(tokens)
+	ass.Nil(err)
+	ass.Equal("hello", strs[0])
+
+	// a token holding half of a character
+	partial := enc.bpe.encoder["\xe4\xbd"]
+	strs, err = enc.DecodeTokensToStrings([]int{partial, -1, 151851})
+	ass.EqualError(err, "invalid tokens at indices [1 2]")
+	ass.Equal([]string{"�", "", ""}, strs)
+}
+
+func TestSingleToken(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	token, err := enc.EncodeSingleToken([]byte(" world"))
+	ass.Nil(err)
+	ass.Equal(1879, token)
+	token, err = enc.EncodeSingleToken([]byte(ENDOFTEXT))
+	ass.Nil(err)
+	ass.Equal(151643, token)
+	_, err = enc.EncodeSingleToken([]byte("hello world"))
+	ass.EqualError(err, `"hello world" is not a single token`)
+
+	// a single byte that isn't valid UTF-8 on its own
+	ff, err := enc.EncodeSingleToken([]byte("\xff"))
+	ass.Nil(err)
+	for _, token := range []int{ff, 1879, 151643} {
+		b, err := enc.DecodeSingleTokenBytes(token)
+		ass.Nil(err)
+		back, err := enc.EncodeSingleToken(b)
+		ass.Nil(err)
+		ass.Equal(token, back, "bytes round-trip exactly")
+	}
+	b, err := enc.DecodeSingleTokenBytes(ff)
+	ass.Nil(err)
+	ass.Equal([]byte("\xff"), b)
+	b[0] = 'x'
+	ass.Equal([]byte("\xff"), enc.DecodeTokensBytes([]int{ff})[0], "the bytes are a copy")
+	_, err = enc.DecodeSingleTokenBytes(-1)
+	ass.EqualError(err, "invalid token -1")
+	ass.Equal([][]byte{[]byte("hello"), {}}, enc.DecodeTokensBytes([]int{14990, -1}))
+}
+
+func TestDecodeSparseTokens(t *testing.T) {
+	ass := assert.New(t)
+	bpe, err := NewCoreBPE(map[string]int{"a": 0, "b": 1}, map[string]int{"<|end|>": 1 << 30}, `\w+`)
+	ass.Nil(err)
+	enc := NewTiktoken(bpe, &Encoding{Name: "sparse"}, map[string]any{"<|end|>": true})
+	tokens := enc.Encode("ab<|end|>", []string{"all"}, nil)
+	ass.Equal([]int{0, 1, 1 << 30}, tokens)
+	ass.Equal("ab<|end|>", enc.Decode(tokens))
+	strs, err := enc.DecodeTokensToStrings(tokens)
+	ass.Nil(err)
+	ass.Equal([]string{"a", "b", "<|end|>"}, strs)
+}
+
+func TestCountTokens(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	for _, text := range []string{"", "hello world!你好，世界！", "<|endoftext|> is text here"} {
+		ass.Equal(len(enc.Encode(text, nil, nil)), enc.CountTokens(text), text)
+	}
+
+	text := "Admission control counts the tokens of every incoming request."
+	allocs := testing.AllocsPerRun(100, func() {
+		enc.CountTokens(text)
+	})
+	if !raceEnabled {
+		ass.Zero(allocs, "ASCII text counts without allocating")
+	}
+}
+
+func TestEncodingMetadata(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := EncodingForModel("qwen")
+	ass.Nil(err)
+	ass.Equal(MODEL_QWEN_BASE, enc.Name())
+	ass.Equal("qwen", enc.Model())
+	ass.Equal("tiktoken/qwen.tiktoken", enc.SourceURI())
+	ass.Equal(151851, enc.VocabSize())
+
+	contents, err := tiktokenFS.ReadFile("tiktoken/qwen.tiktoken")
+	ass.Nil(err)
+	ass.Equal(fmt.Sprintf("%x", sha256.Sum256(contents)), enc.ContentHash())
+
+	base, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Equal("", base.Model())
+	ass.Equal(enc.ContentHash(), base.WithOptions(WithStripBOM(true)).ContentHash())
+}
+
+func TestVocabIntrospection(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Equal(151850, enc.MaxTokenValue())
+	ass.Equal(151851, enc.NVocab())
+
+	specials := enc.SpecialTokens()
+	ass.Equal(151643, specials[ENDOFTEXT])
+	ass.Equal(151644, specials[IM_START])
+	delete(specials, ENDOFTEXT)
+	ass.Equal(151643, enc.SpecialTokens()[ENDOFTEXT], "the map is a copy")
+
+	values := enc.TokenByteValues()
+	ass.Equal(151643, len(values))
+	for i := 1; i < len(values); i++ {
+		if bytes.Compare(values[i-1], values[i]) >= 0 {
+			ass.Fail("unsorted", "%q >= %q", values[i-1], values[i])
+			break
+		}
+	}
+	rank, ok := enc.Rank(values[0])
+	ass.True(ok)
+	single, err := enc.DecodeSingleTokenBytes(rank)
+	ass.Nil(err)
+	ass.Equal(values[0], single)
+	values[0] = append(values[0], 'x')
+	ass.Equal(1, len(enc.TokenByteValues()[0]), "the values are copies")
+}
+
+func TestLlama3SpecialTokens(t *testing.T) {
+	ass := assert.New(t)
+	special := llama3SpecialTokens()
+	ass.Len(special, 256)
+	ids := map[int]bool{}
+	for _, id := range special {
+		ids[id] = true
+	}
+	for id := 128000; id < 128256; id++ {
+		ass.True(ids[id], id)
+	}
+	ass.Equal(128009, special["<|eot_id|>"])
+	ass.Equal(128011, special["<|reserved_special_token_3|>"])
+	ass.Equal(128255, special["<|reserved_special_token_247|>"])
+}
+
+func TestLlama3ModelMapping(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	defer SetLlama3TokenizerModel(llama3TokenizerModel)
+	defer func() {
+		delete(encodingMap, MODEL_LLAMA3)
+		delete(tiktokenMap, MODEL_LLAMA3)
+		setLoaded(MODEL_LLAMA3, false)
+	}()
+
+	SetLlama3TokenizerModel("")
+	_, err := GetEncoding(MODEL_LLAMA3)
+	ass.ErrorContains(err, "LLAMA3_TOKENIZER_MODEL")
+
+	rankFile := filepath.Join(dir, "tokenizer.model")
+	writeRankFile(t, rankFile, "H", "i", "Hi")
+	SetLlama3TokenizerModel(rankFile)
+	for _, model := range []string{"llama3", "llama-3.1-8b-instruct", "meta-llama/Llama-3.2-1B", "meta-llama/Meta-Llama-3-8B"} {
+		enc, err := EncodingForModel(model)
+		ass.Nil(err, model)
+		ass.Equal(MODEL_LLAMA3, enc.Name(), model)
+	}
+	enc, err := GetEncoding(MODEL_LLAMA3)
+	ass.Nil(err)
+	ass.Equal([]int{128000, 2, 128009}, enc.Encode("<|begin_of_text|>Hi<|eot_id|>", []string{"all"}, nil))
+}
+
+// TestLlama3Golden runs against the real tokenizer.model, which can't be
+// shipped with the tests. Point LLAMA3_TOKENIZER_MODEL at it to run.
+func TestLlama3Golden(t *testing.T) {
+	if llama3TokenizerModel == "" {
+		t.Skip("LLAMA3_TOKENIZER_MODEL not set")
+	}
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_LLAMA3)
+	ass.Nil(err)
+	ass.Equal(128256, enc.VocabSize())
+	// these tokens are converted from the reference Llama 3 tokenizer
+	ass.Equal([]int{128000, 9906, 1917}, enc.Encode("<|begin_of_text|>Hello world", []string{"all"}, nil))
+	ass.Equal([]int{128006, 882, 128007, 271}, enc.Encode("<|start_header_id|>user<|end_header_id|>\n\n", []string{"all"}, nil))
+	text := "hello world!你好，世界！"
+	ass.Equal(text, enc.Decode(enc.Encode(text, nil, nil)))
+}
+
+func TestGetEncodingConcurrent(t *testing.T) {
+	ass := assert.New(t)
+	qwen, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	var calls int32
+	fail := true
+	release := make(chan struct{})
+	RegisterEncoding("concurrent_test", func() (*Encoding, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		if fail {
+			return nil, errors.New("flaky")
+		}
+		enc := testEncoding()
+		enc.Name = "concurrent_test"
+		return enc, nil
+	})
+	defer ReleaseEncoding("concurrent_test")
+
+	close(release)
+	_, err = GetEncoding("concurrent_test")
+	ass.EqualError(err, "flaky")
+	fail, release = false, make(chan struct{})
+
+	var wg sync.WaitGroup
+	got := make([]*Tiktoken, 16)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i], _ = GetEncoding("concurrent_test")
+		}(i)
+	}
+	// a loaded encoding doesn't wait for the load under way
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Same(qwen, tk)
+	close(release)
+	wg.Wait()
+
+	ass.EqualValues(2, atomic.LoadInt32(&calls), "a failed load is tried again, then loaded once")
+	ass.NotNil(got[0])
+	for _, tk := range got {
+		ass.Same(got[0], tk)
+	}
+	tk, err = GetEncodingCached("concurrent_test")
+	ass.Nil(err)
+	ass.Same(got[0], tk)
+}
+
+func TestMustGetEncoding(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	ass.Same(enc, MustGetEncoding(MODEL_QWEN_BASE))
+	ass.Equal("qwen2-7b", MustEncodingForModel("qwen2-7b").Model())
+
+	ass.PanicsWithValue(`tiktoken: GetEncoding("nope"): tiktoken: unknown encoding "nope"`, func() { MustGetEncoding("nope") })
+	ass.PanicsWithValue(`tiktoken: EncodingForModel("nope"): tiktoken: no encoding for model nope`, func() { MustEncodingForModel("nope") })
+}
+
+func TestGetEncodingWithLoader(t *testing.T) {
+	ass := assert.New(t)
+	uri := encodingSources[MODEL_CL100K_BASE]
+	loaderWith := func(tokens ...string) BpeLoader {
+		// Pad to the size of cl100k_base, the padding never merges with "ab".
+		for len(tokens) < builtinSpecs[MODEL_CL100K_BASE].expectedRanks {
+			tokens = append(tokens, fmt.Sprintf("<pad %d>", len(tokens)))
+		}
+		var content strings.Builder
+		for i, token := range tokens {
+			content.WriteString(base64.StdEncoding.EncodeToString([]byte(token)) + " " + strconv.Itoa(i) + "\n")
+		}
+		fsys := fstest.MapFS{"cl100k.tiktoken": {Data: []byte(content.String())}}
+		return NewFSBpeLoader(fsys, map[string]string{uri: "cl100k.tiktoken"})
+	}
+	merging, plain := loaderWith("a", "b", "ab"), loaderWith("a", "b")
+
+	enc, err := GetEncodingWithLoader(MODEL_CL100K_BASE, merging)
+	ass.Nil(err)
+	ass.Equal([]int{2}, enc.EncodeOrdinary("ab"))
+	again, err := GetEncodingWithLoader(MODEL_CL100K_BASE, merging)
+	ass.Nil(err)
+	ass.Same(enc, again, "cached per loader")
+
+	other, err := GetEncodingWithLoader(MODEL_CL100K_BASE, plain)
+	ass.Nil(err)
+	ass.Equal([]int{0, 1}, other.EncodeOrdinary("ab"), "not shared across loaders")
+
+	forModel, err := EncodingForModelWithLoader("gpt-4-0613", merging)
+	ass.Nil(err)
+	ass.Equal("gpt-4-0613", forModel.Model())
+	ass.Equal(enc.bpe, forModel.bpe)
+
+	_, err = GetEncodingWithLoader(MODEL_P50K_BASE, merging)
+	ass.NotNil(err, "the loader has no p50k file")
+	_, err = EncodingForModelWithLoader("nope", merging)
+	ass.NotNil(err)
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+	ass := assert.New(t)
+	loader := currentBpeLoader()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				name := fmt.Sprintf("race-model-%d-%d", i, j)
+				RegisterModel(name, MODEL_QWEN_BASE)
+				RegisterModelPrefix(name+"-", MODEL_QWEN_BASE)
+				RegisterEncoding(name+"_base", func() (*Encoding, error) { return nil, fmt.Errorf("unused") })
+				SetBpeLoader(loader)
+				SetImageTokenCost(nil)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := EncodingForModel("qwen2-7b")
+				ass.Nil(err)
+				EncodingForModel(fmt.Sprintf("race-model-%d-%d-x", i, j))
+				ParseEncoding(fmt.Sprintf("race-model-%d-%d_base", i, j))
+				NumTokensFromMessages([]ChatMessage{{Role: "user", Content: "hi"}}, "qwen")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	enc, err := EncodingForModel("race-model-3-7-suffix")
+	ass.Nil(err)
+	ass.Equal(MODEL_QWEN_BASE, enc.Name())
+}
@@ -0,0 +1,207 @@
+// Package tiktokenbench measures encodings on a corpus: how fast they
+// encode it, how much they allocate and how many bytes a token covers, and
+// how the token counts of two encodings differ per document.
+//
+// A corpus is read from an io.Reader and split into documents, one per line
+// unless changed with WithSplit. WithSample restricts a run to a random but
+// reproducible subset of the documents, so runs on the same corpus with the
+// same seed measure the same text.
+package tiktokenbench
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// maxDocumentBytes bounds the documents the default scanner accepts.
+const maxDocumentBytes = 64 << 20
+
+// Option configures RunProfile and CompareEncodings.
+type Option func(*config)
+
+type config struct {
+	split  bufio.SplitFunc
+	sample int
+	seed   int64
+}
+
+// WithSplit splits the corpus into documents with split instead of
+// bufio.ScanLines.
+func WithSplit(split bufio.SplitFunc) Option {
+	return func(c *config) {
+		c.split = split
+	}
+}
+
+// WithSample uses n documents of the corpus chosen with seed, in corpus
+// order, instead of all of them. The same corpus, n and seed always select
+// the same documents.
+func WithSample(n int, seed int64) Option {
+	return func(c *config) {
+		c.sample = n
+		c.seed = seed
+	}
+}
+
+// Document is a document of a corpus, Index counting from 0 in corpus order.
+type Document struct {
+	Index int
+	Text  string
+}
+
+// Sample reads the documents of corpus as configured by opts.
+func Sample(corpus io.Reader, opts ...Option) ([]Document, error) {
+	c := config{split: bufio.ScanLines}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	scanner := bufio.NewScanner(corpus)
+	scanner.Buffer(nil, maxDocumentBytes)
+	scanner.Split(c.split)
+	rng := rand.New(rand.NewSource(c.seed))
+	var docs []Document
+	for i := 0; scanner.Scan(); i++ {
+		doc := Document{Index: i, Text: scanner.Text()}
+		switch {
+		case c.sample <= 0 || len(docs) < c.sample:
+			docs = append(docs, doc)
+		default:
+			// reservoir sampling keeps every document with equal chance
+			if j := rng.Intn(i + 1); j < c.sample {
+				docs[j] = doc
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Index < docs[j].Index })
+	return docs, nil
+}
+
+// Report is the result of RunProfile. One pass encodes every document once
+// with EncodeOrdinary.
+type Report struct {
+	Encoding  string
+	Documents int
+	Bytes     int64
+	Tokens    int64
+	// BytesPerToken is Bytes / Tokens, the compression ratio.
+	BytesPerToken float64
+
+	// Passes and Elapsed are how often and how long testing.Benchmark
+	// encoded the documents.
+	Passes            int
+	Elapsed           time.Duration
+	TokensPerSec      float64
+	BytesPerSec       float64
+	AllocsPerPass     int64
+	AllocBytesPerPass int64
+}
+
+// RunProfile encodes the documents of corpus with enc under
+// testing.Benchmark, which runs for about a second, and reports the
+// throughput, allocations and compression ratio.
+func RunProfile(enc *tiktoken.Tiktoken, corpus io.Reader, opts ...Option) (Report, error) {
+	docs, err := Sample(corpus, opts...)
+	if err != nil {
+		return Report{}, err
+	}
+	report := Report{Encoding: enc.Name(), Documents: len(docs)}
+	for _, doc := range docs {
+		report.Bytes += int64(len(doc.Text))
+		report.Tokens += int64(enc.CountTokens(doc.Text))
+	}
+	if report.Tokens > 0 {
+		report.BytesPerToken = float64(report.Bytes) / float64(report.Tokens)
+	}
+
+	result := testing.Benchmark(BenchmarkFunc(enc, docs))
+	report.Passes = result.N
+	report.Elapsed = result.T
+	if s := result.T.Seconds(); s > 0 {
+		report.TokensPerSec = float64(report.Tokens) * float64(result.N) / s
+		report.BytesPerSec = float64(report.Bytes) * float64(result.N) / s
+	}
+	report.AllocsPerPass = result.AllocsPerOp()
+	report.AllocBytesPerPass = result.AllocedBytesPerOp()
+	return report, nil
+}
+
+// BenchmarkFunc returns a benchmark encoding docs with enc once per
+// iteration, for use in a Benchmark function of a test file:
+//
+//	func BenchmarkProse(b *testing.B) {
+//		tiktokenbench.BenchmarkFunc(enc, docs)(b)
+//	}
+//
+// It reports allocations, MB/s and tokens/op.
+func BenchmarkFunc(enc *tiktoken.Tiktoken, docs []Document) func(b *testing.B) {
+	var bytes, tokens int
+	for _, doc := range docs {
+		bytes += len(doc.Text)
+	}
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(bytes))
+		for i := 0; i < b.N; i++ {
+			tokens = 0
+			for _, doc := range docs {
+				tokens += len(enc.EncodeOrdinary(doc.Text))
+			}
+		}
+		b.ReportMetric(float64(tokens), "tokens/op")
+	}
+}
+
+// DocumentDelta compares the token counts of one document.
+type DocumentDelta struct {
+	Index   int
+	Bytes   int
+	TokensA int
+	TokensB int
+	// Delta is TokensB - TokensA.
+	Delta int
+}
+
+// Comparison is the result of CompareEncodings.
+type Comparison struct {
+	A, B      string
+	Documents []DocumentDelta
+	TokensA   int64
+	TokensB   int64
+	// Ratio is TokensB / TokensA, below 1 if B needs fewer tokens.
+	Ratio float64
+}
+
+// CompareEncodings counts the tokens of every document of corpus with a
+// and b.
+func CompareEncodings(a, b *tiktoken.Tiktoken, corpus io.Reader, opts ...Option) (Comparison, error) {
+	docs, err := Sample(corpus, opts...)
+	if err != nil {
+		return Comparison{}, err
+	}
+	cmp := Comparison{A: a.Name(), B: b.Name(), Documents: make([]DocumentDelta, 0, len(docs))}
+	for _, doc := range docs {
+		d := DocumentDelta{
+			Index:   doc.Index,
+			Bytes:   len(doc.Text),
+			TokensA: a.CountTokens(doc.Text),
+			TokensB: b.CountTokens(doc.Text),
+		}
+		d.Delta = d.TokensB - d.TokensA
+		cmp.Documents = append(cmp.Documents, d)
+		cmp.TokensA += int64(d.TokensA)
+		cmp.TokensB += int64(d.TokensB)
+	}
+	if cmp.TokensA > 0 {
+		cmp.Ratio = float64(cmp.TokensB) / float64(cmp.TokensA)
+	}
+	return cmp, nil
+}
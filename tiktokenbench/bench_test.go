@@ -0,0 +1,74 @@
+package tiktokenbench
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const corpus = "hello world\nfunc main() { fmt.Println(42) }\n你好，世界\nthe quick brown fox\njumps over the lazy dog\n"
+
+// byteEncoding has one token per byte.
+func byteEncoding(t *testing.T) *tiktoken.Tiktoken {
+	ranks := map[string]int{}
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	bpe, err := tiktoken.NewCoreBPE(ranks, nil, `.`)
+	assert.Nil(t, err)
+	return tiktoken.NewTiktoken(bpe, &tiktoken.Encoding{Name: "bytes", MergeableRanks: ranks}, nil)
+}
+
+func TestSample(t *testing.T) {
+	ass := assert.New(t)
+	all, err := Sample(strings.NewReader(corpus))
+	ass.Nil(err)
+	ass.Len(all, 5)
+	ass.Equal(Document{Index: 2, Text: "你好，世界"}, all[2])
+
+	sample, err := Sample(strings.NewReader(corpus), WithSample(3, 7))
+	ass.Nil(err)
+	ass.Len(sample, 3)
+	again, err := Sample(strings.NewReader(corpus), WithSample(3, 7))
+	ass.Nil(err)
+	ass.Equal(sample, again, "the same seed picks the same documents")
+	for i := 1; i < len(sample); i++ {
+		ass.Less(sample[i-1].Index, sample[i].Index)
+	}
+
+	words, err := Sample(strings.NewReader("a b  c"), WithSplit(bufio.ScanWords))
+	ass.Nil(err)
+	ass.Len(words, 3)
+}
+
+func TestCompareEncodings(t *testing.T) {
+	ass := assert.New(t)
+	qwen, err := tiktoken.GetEncoding(tiktoken.MODEL_QWEN_BASE)
+	ass.Nil(err)
+	cmp, err := CompareEncodings(qwen, byteEncoding(t), strings.NewReader(corpus))
+	ass.Nil(err)
+	ass.Equal("qwen_base", cmp.A)
+	ass.Equal("bytes", cmp.B)
+	ass.Len(cmp.Documents, 5)
+	for _, d := range cmp.Documents {
+		ass.Equal(d.Bytes, d.TokensB)
+		ass.Equal(d.TokensB-d.TokensA, d.Delta)
+		ass.Less(d.TokensA, d.TokensB)
+	}
+	ass.Greater(cmp.Ratio, 1.0)
+}
+
+func TestRunProfile(t *testing.T) {
+	ass := assert.New(t)
+	report, err := RunProfile(byteEncoding(t), strings.NewReader(corpus))
+	ass.Nil(err)
+	ass.Equal(5, report.Documents)
+	ass.Equal(report.Bytes, report.Tokens)
+	ass.Equal(1.0, report.BytesPerToken)
+	ass.Greater(report.Passes, 0)
+	ass.Greater(report.TokensPerSec, 0.0)
+	ass.Greater(report.AllocsPerPass, int64(0))
+}
@@ -0,0 +1,312 @@
+// Package tiktokenhttp serves tokenization over HTTP, for services that
+// can't link the tiktoken package but need exact token counts.
+//
+// The handler answers POST requests with JSON bodies:
+//
+//	/encode  {"model": "gpt-4o", "text": "..."}     -> {"tokens": [...], "count": n}
+//	/decode  {"model": "gpt-4o", "tokens": [...]}   -> {"text": "..."}
+//	/count   {"model": "gpt-4o", "text": "..."}     -> {"count": n}
+//	/count-messages {"model": "gpt-4o", "messages": [{"role": "user", "content": "..."}]}
+//	                                                -> {"count": n}
+//
+// Messages may also have a "name" and multi-part "parts" instead of
+// "content", as tiktoken.ChatMessage does, and are counted by
+// tiktoken.NumTokensFromMessages, so /count-messages needs "model".
+// With WithMetrics, GET /metrics reports the requests served per endpoint
+// and the counters of tiktoken.MetricsSnapshot.
+//
+// Instead of "model", a request may name an encoding directly with
+// "encoding". Errors are reported as {"error": "..."} with a 4xx status.
+// Encodings come from the process-wide cache of the tiktoken package, so
+// only the first request for an encoding pays for loading it.
+package tiktokenhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// DefaultMaxBodyBytes is the request body limit unless changed with
+// WithMaxBodyBytes.
+const DefaultMaxBodyBytes = 1 << 20
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithMaxBodyBytes limits the size of request bodies; larger requests fail
+// with 413 Request Entity Too Large.
+func WithMaxBodyBytes(n int64) Option {
+	return func(h *Handler) {
+		h.maxBodyBytes = n
+	}
+}
+
+// WithMetrics turns on tiktoken.EnableMetrics and serves GET /metrics.
+func WithMetrics(on bool) Option {
+	return func(h *Handler) {
+		h.metrics = on
+	}
+}
+
+// Handler serves the /encode, /decode, /count and /count-messages
+// endpoints. Mount it with http.StripPrefix to serve them below a path.
+type Handler struct {
+	mux          *http.ServeMux
+	maxBodyBytes int64
+	metrics      bool
+	// requests count the requests of every POST endpoint, see WithMetrics.
+	requests map[string]*endpointMetrics
+}
+
+type endpointMetrics struct {
+	requests, errors atomic.Int64
+}
+
+// NewHandler returns a Handler configured by opts.
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{mux: http.NewServeMux(), maxBodyBytes: DefaultMaxBodyBytes, requests: map[string]*endpointMetrics{}}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.handle("/encode", h.encode)
+	h.handle("/decode", h.decode)
+	h.handle("/count", h.count)
+	h.handle("/count-messages", h.countMessages)
+	if h.metrics {
+		tiktoken.EnableMetrics(true)
+		h.mux.HandleFunc("/metrics", h.serveMetrics)
+	}
+	return h
+}
+
+func (h *Handler) handle(path string, fn func(tk *tiktoken.Tiktoken, req *request) (any, error)) {
+	m := &endpointMetrics{}
+	h.requests[path] = m
+	h.mux.HandleFunc(path, h.post(m, fn))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+type request struct {
+	Model          string    `json:"model"`
+	Encoding       string    `json:"encoding"`
+	Text           string    `json:"text"`
+	Tokens         []int     `json:"tokens"`
+	AllowedSpecial []string  `json:"allowed_special"`
+	Messages       []message `json:"messages"`
+}
+
+// message is tiktoken.ChatMessage in JSON.
+type message struct {
+	Role    string `json:"role"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Parts   []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL *struct {
+			URL    string `json:"url"`
+			Detail string `json:"detail"`
+			Width  int    `json:"width"`
+			Height int    `json:"height"`
+		} `json:"image_url"`
+	} `json:"parts"`
+}
+
+func (m message) chatMessage() tiktoken.ChatMessage {
+	msg := tiktoken.ChatMessage{Role: m.Role, Name: m.Name, Content: m.Content}
+	for _, p := range m.Parts {
+		part := tiktoken.ContentPart{Type: p.Type, Text: p.Text}
+		if p.ImageURL != nil {
+			part.ImageURL = &tiktoken.ImageURL{URL: p.ImageURL.URL, Detail: p.ImageURL.Detail, Width: p.ImageURL.Width, Height: p.ImageURL.Height}
+		}
+		msg.Parts = append(msg.Parts, part)
+	}
+	return msg
+}
+
+type encodeResponse struct {
+	Tokens []int `json:"tokens"`
+	Count  int   `json:"count"`
+}
+
+type decodeResponse struct {
+	Text string `json:"text"`
+}
+
+type countResponse struct {
+	Count int `json:"count"`
+}
+
+// httpError is an error with the status it is reported with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return &httpError{http.StatusBadRequest, err}
+}
+
+// post decodes the request body and writes the response or error of fn,
+// counting the request in m.
+func (h *Handler) post(m *endpointMetrics, fn func(tk *tiktoken.Tiktoken, req *request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.requests.Add(1)
+		// MaxBytesReader closes the connection of a too large body
+		// through the writer of the server
+		body := http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+		w = &statusWriter{ResponseWriter: w, m: m}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, &httpError{http.StatusMethodNotAllowed, errors.New("method not allowed, use POST")})
+			return
+		}
+		var req request
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, &httpError{http.StatusRequestEntityTooLarge, fmt.Errorf("request body larger than %d bytes", tooLarge.Limit)})
+				return
+			}
+			writeError(w, badRequest(fmt.Errorf("invalid JSON body: %w", err)))
+			return
+		}
+		tk, err := resolve(&req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resp, err := fn(tk, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// resolve looks up the encoding of a request. Unknown names are reported
+// with 404, failures to load a known encoding with 500.
+func resolve(req *request) (*tiktoken.Tiktoken, error) {
+	var tk *tiktoken.Tiktoken
+	var err error
+	switch {
+	case req.Model != "" && req.Encoding != "":
+		return nil, badRequest(errors.New(`give either "model" or "encoding", not both`))
+	case req.Model != "":
+		tk, err = tiktoken.EncodingForModel(req.Model)
+	case req.Encoding != "":
+		tk, err = tiktoken.GetEncoding(req.Encoding)
+	default:
+		return nil, badRequest(errors.New(`"model" or "encoding" is required`))
+	}
+	if errors.Is(err, tiktoken.ErrModelNotFound) || errors.Is(err, tiktoken.ErrEncodingNotFound) {
+		return nil, &httpError{http.StatusNotFound, err}
+	}
+	return tk, err
+}
+
+func (h *Handler) encode(tk *tiktoken.Tiktoken, req *request) (any, error) {
+	tokens, err := tk.EncodeWithError(req.Text, req.AllowedSpecial, nil)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	return encodeResponse{tokens, len(tokens)}, nil
+}
+
+// decode replaces bytes that aren't valid UTF-8, as JSON can't carry them.
+func (h *Handler) decode(tk *tiktoken.Tiktoken, req *request) (any, error) {
+	text, err := tk.DecodeWithMode(req.Tokens, tiktoken.DecodeStrict)
+	if errors.Is(err, tiktoken.ErrInvalidUTF8) {
+		text, err = tk.DecodeWithMode(req.Tokens, tiktoken.DecodeReplace)
+	}
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	return decodeResponse{text}, nil
+}
+
+func (h *Handler) count(tk *tiktoken.Tiktoken, req *request) (any, error) {
+	return countResponse{tk.CountTokens(req.Text)}, nil
+}
+
+func (h *Handler) countMessages(tk *tiktoken.Tiktoken, req *request) (any, error) {
+	if req.Model == "" {
+		return nil, badRequest(errors.New(`"model" is required to count messages`))
+	}
+	messages := make([]tiktoken.ChatMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = m.chatMessage()
+	}
+	n, err := tiktoken.NumTokensFromMessages(messages, req.Model)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	return countResponse{n}, nil
+}
+
+// statusWriter counts the error responses of an endpoint.
+type statusWriter struct {
+	http.ResponseWriter
+	m *endpointMetrics
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if status >= 400 {
+		w.m.errors.Add(1)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// EndpointMetrics are the counters of one endpoint in the /metrics
+// response.
+type EndpointMetrics struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+// MetricsResponse is the body of GET /metrics.
+type MetricsResponse struct {
+	Endpoints map[string]EndpointMetrics `json:"endpoints"`
+	Tokenizer tiktoken.Metrics           `json:"tokenizer"`
+}
+
+func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, &httpError{http.StatusMethodNotAllowed, errors.New("method not allowed, use GET")})
+		return
+	}
+	resp := MetricsResponse{Endpoints: map[string]EndpointMetrics{}, Tokenizer: tiktoken.MetricsSnapshot()}
+	for path, m := range h.requests {
+		resp.Endpoints[path] = EndpointMetrics{Requests: m.requests.Load(), Errors: m.errors.Load()}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,119 @@
+package tiktokenhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func post(h http.Handler, path, body string) (int, map[string]any) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	var out map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func TestHandler(t *testing.T) {
+	ass := assert.New(t)
+	h := NewHandler(WithMaxBodyBytes(200))
+	enc, err := tiktoken.GetEncoding(tiktoken.MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	code, out := post(h, "/encode", `{"model": "qwen", "text": "hello world!你好，世界！"}`)
+	ass.Equal(http.StatusOK, code)
+	ass.Equal([]any{14990.0, 1879.0, 0.0, 108386.0, 3837.0, 99489.0, 6313.0}, out["tokens"])
+	ass.Equal(7.0, out["count"])
+
+	code, out = post(h, "/encode", `{"encoding": "qwen_base", "text": ""}`)
+	ass.Equal(http.StatusOK, code)
+	ass.Equal([]any{}, out["tokens"])
+
+	code, out = post(h, "/count", `{"model": "qwen2-7b", "text": "hello world"}`)
+	ass.Equal(http.StatusOK, code)
+	ass.Equal(2.0, out["count"])
+
+	code, out = post(h, "/decode", `{"model": "qwen", "tokens": [14990, 1879]}`)
+	ass.Equal(http.StatusOK, code)
+	ass.Equal("hello world", out["text"])
+	lead := enc.EncodeOrdinary("\xe4")
+	body, _ := json.Marshal(map[string]any{"model": "qwen", "tokens": append([]int{14990}, lead...)})
+	code, out = post(h, "/decode", string(body))
+	ass.Equal(http.StatusOK, code)
+	ass.Equal("hello�", out["text"])
+	code, out = post(h, "/decode", `{"model": "qwen", "tokens": [-1]}`)
+	ass.Equal(http.StatusBadRequest, code)
+	ass.Equal("invalid token -1 at index 0", out["error"])
+
+	code, out = post(h, "/count", `{"model": "nope", "text": "x"}`)
+	ass.Equal(http.StatusNotFound, code)
+	ass.Equal("tiktoken: no encoding for model nope", out["error"])
+	code, _ = post(h, "/count", `{"encoding": "qwenbase", "text": "x"}`)
+	ass.Equal(http.StatusNotFound, code)
+	code, _ = post(h, "/count", `{"text": "x"}`)
+	ass.Equal(http.StatusBadRequest, code)
+	code, _ = post(h, "/count", `{"model": `)
+	ass.Equal(http.StatusBadRequest, code)
+	code, out = post(h, "/count", `{"model": "qwen", "text": "`+strings.Repeat("x", 300)+`"}`)
+	ass.Equal(http.StatusRequestEntityTooLarge, code)
+	ass.Equal("request body larger than 200 bytes", out["error"])
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/count", nil))
+	ass.Equal(http.StatusMethodNotAllowed, rec.Code)
+	ass.Equal(http.MethodPost, rec.Header().Get("Allow"))
+}
+
+func TestCountMessages(t *testing.T) {
+	ass := assert.New(t)
+	h := NewHandler()
+	messages := []tiktoken.ChatMessage{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Name: "bob", Parts: []tiktoken.ContentPart{
+			{Type: tiktoken.ContentPartText, Text: "hello world"},
+			{Type: tiktoken.ContentPartImageURL, ImageURL: &tiktoken.ImageURL{URL: "https://example.com/a.png", Detail: "low"}},
+		}},
+	}
+	want, err := tiktoken.NumTokensFromMessages(messages, "qwen")
+	ass.Nil(err)
+
+	code, out := post(h, "/count-messages", `{"model": "qwen", "messages": [
+		{"role": "system", "content": "You are helpful."},
+		{"role": "user", "name": "bob", "parts": [
+			{"type": "text", "text": "hello world"},
+			{"type": "image_url", "image_url": {"url": "https://example.com/a.png", "detail": "low"}}
+		]}
+	]}`)
+	ass.Equal(http.StatusOK, code)
+	ass.Equal(float64(want), out["count"])
+
+	code, out = post(h, "/count-messages", `{"encoding": "qwen_base", "messages": []}`)
+	ass.Equal(http.StatusBadRequest, code)
+	ass.Equal(`"model" is required to count messages`, out["error"])
+}
+
+func TestMetrics(t *testing.T) {
+	ass := assert.New(t)
+	defer tiktoken.EnableMetrics(false)
+	h := NewHandler(WithMetrics(true))
+	post(h, "/count", `{"model": "qwen", "text": "hello world"}`)
+	post(h, "/count", `{"model": "nope", "text": "x"}`)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	ass.Equal(http.StatusOK, rec.Code)
+	var resp MetricsResponse
+	ass.Nil(json.Unmarshal(rec.Body.Bytes(), &resp))
+	ass.Equal(EndpointMetrics{Requests: 2, Errors: 1}, resp.Endpoints["/count"])
+	ass.Equal(EndpointMetrics{}, resp.Endpoints["/encode"])
+	ass.GreaterOrEqual(resp.Tokenizer.Encodings[tiktoken.MODEL_QWEN_BASE].Tokens, int64(2))
+
+	rec = httptest.NewRecorder()
+	NewHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	ass.Equal(http.StatusNotFound, rec.Code, "metrics are off by default")
+}
@@ -0,0 +1,47 @@
+package tiktokenhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ShutdownTimeout is how long Serve and ListenAndServe wait for requests in
+// flight once their context is done.
+var ShutdownTimeout = 10 * time.Second
+
+// ListenAndServe serves handler on addr until ctx is done, then shuts down
+// gracefully, e.g. with a context of signal.NotifyContext. It returns nil
+// after a graceful shutdown.
+func ListenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, ln, handler)
+}
+
+// Serve is ListenAndServe on ln, which it closes.
+func Serve(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
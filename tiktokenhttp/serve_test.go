@@ -0,0 +1,59 @@
+package tiktokenhttp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe(t *testing.T) {
+	ass := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	ass.Nil(err)
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/", NewHandler())
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, ln, mux)
+	}()
+	url := "http://" + ln.Addr().String()
+	resp, err := http.Post(url+"/count", "application/json", strings.NewReader(`{"model": "qwen", "text": "hello world"}`))
+	ass.Nil(err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	ass.JSONEq(`{"count": 2}`, string(body))
+
+	// a request in flight finishes during the shutdown
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- string(body)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	ass.Equal("done", <-slow)
+	ass.Nil(<-served)
+	_, err = http.Get(url + "/count")
+	ass.NotNil(err, "the listener is closed")
+}
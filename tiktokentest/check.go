@@ -0,0 +1,117 @@
+package tiktokentest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Samples are the texts RoundTrip and NoPanics always check: ASCII prose
+// and code, several scripts, emoji, whitespace runs, contractions, long
+// runs without whitespace and strings that look like special tokens.
+var Samples = []string{
+	"",
+	"hello world",
+	"Hello, World! It's 12:30pm, we'll see.",
+	"func main() {\n\tfmt.Println(\"hi\")\n}\n",
+	"  leading and trailing  \n\n\n",
+	"\t\r\n \r\n",
+	"你好，世界！こんにちは 안녕하세요",
+	"Привет, мир. مرحبا بالعالم. שלום עולם",
+	"👍🏽 👨‍👩‍👧‍👦 🇺🇸",
+	"é café naïve",
+	"1234567890 3.14159 -42 1e10",
+	strings.Repeat("a", 1000),
+	strings.Repeat("ab1+/", 200),
+	"<|endoftext|> <|im_start|> <|fim_prefix|> <|not_special|>",
+	"<|endoftext",
+}
+
+// RoundTrip checks that enc decodes the tokens of every valid UTF-8 text in
+// Samples and extra back to the text, both with EncodeOrdinary and with all
+// special tokens allowed, and that every special token encodes to exactly
+// its id, is refused when disallowed and is plain text to EncodeOrdinary.
+// enc must not transform its input with options like WithNormalization.
+func RoundTrip(t testing.TB, enc *tiktoken.Tiktoken, extra ...string) {
+	t.Helper()
+	for _, text := range append(append([]string{}, Samples...), extra...) {
+		if !utf8.ValidString(text) {
+			continue
+		}
+		if got := enc.Decode(enc.EncodeOrdinary(text)); got != text {
+			t.Errorf("%s: EncodeOrdinary(%q) decodes to %q", enc.Name(), text, got)
+		}
+		if got := enc.Decode(enc.Encode(text, []string{"all"}, nil)); got != text {
+			t.Errorf("%s: Encode(%q, all) decodes to %q", enc.Name(), text, got)
+		}
+		if n := enc.CountTokens(text); n != len(enc.EncodeOrdinary(text)) {
+			t.Errorf("%s: CountTokens(%q) = %d, EncodeOrdinary returns %d tokens", enc.Name(), text, n, len(enc.EncodeOrdinary(text)))
+		}
+	}
+
+	enc.SpecialTokenIter(func(id int, token []byte) bool {
+		special := string(token)
+		if got := enc.Encode(special, []string{"all"}, nil); !reflect.DeepEqual(got, []int{id}) {
+			t.Errorf("%s: special token %q encodes to %v, want [%d]", enc.Name(), special, got, id)
+		}
+		if got := enc.Decode([]int{id}); got != special {
+			t.Errorf("%s: special token %d decodes to %q, want %q", enc.Name(), id, got, special)
+		}
+		if _, err := enc.EncodeWithError("x"+special, nil, []string{"all"}); err == nil {
+			t.Errorf("%s: disallowed special token %q was accepted", enc.Name(), special)
+		}
+		for _, token := range enc.EncodeOrdinary(special) {
+			if token == id {
+				t.Errorf("%s: EncodeOrdinary(%q) produced the special token", enc.Name(), special)
+				break
+			}
+		}
+		return true
+	})
+}
+
+// NoPanics wires a fuzz target checking that no input makes enc panic
+// when encoding, counting or decoding, and that valid UTF-8 input decodes
+// back to itself. Samples seed the corpus. Call it from a Fuzz function:
+//
+//	func FuzzMyEncoding(f *testing.F) {
+//		tiktokentest.NoPanics(f, enc)
+//	}
+func NoPanics(f *testing.F, enc *tiktoken.Tiktoken) {
+	for _, seed := range Samples {
+		f.Add(seed)
+	}
+	f.Add("\xff\xfe invalid \xc3")
+	f.Fuzz(func(t *testing.T, text string) {
+		tokens := enc.EncodeOrdinary(text)
+		enc.CountTokens(text)
+		if _, err := enc.EncodeWithError(text, nil, []string{"all"}); err == nil {
+			enc.Encode(text, []string{"all"}, nil)
+		}
+		decoded := enc.Decode(tokens)
+		if utf8.ValidString(text) && decoded != text {
+			t.Fatalf("%s: %q decodes to %q", enc.Name(), text, decoded)
+		}
+	})
+}
+
+// CompareEncoders checks that a and b produce the same tokens for every
+// text of corpus, with all special tokens allowed, e.g. for a custom
+// encoding that should match a reference one.
+func CompareEncoders(t testing.TB, a, b tiktoken.Encoder, corpus []string) {
+	t.Helper()
+	for i, text := range corpus {
+		ta, tb := a.Encode(text, []string{"all"}, nil), b.Encode(text, []string{"all"}, nil)
+		if reflect.DeepEqual(ta, tb) {
+			continue
+		}
+		at := 0
+		for at < len(ta) && at < len(tb) && ta[at] == tb[at] {
+			at++
+		}
+		t.Errorf("text %d %q: first difference at token %d: %v vs %v", i, text, at, ta[at:], tb[at:])
+	}
+}
@@ -0,0 +1,69 @@
+package tiktokentest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var builtinEncodings = []tiktoken.EncodingName{
+	tiktoken.CL100KBase, tiktoken.O200KBase, tiktoken.P50KBase, tiktoken.P50KEdit,
+	tiktoken.R50KBase, tiktoken.QwenBase, tiktoken.Llama3,
+}
+
+func TestBuiltinEncodings(t *testing.T) {
+	// only encodings that are embedded or already cached
+	t.Setenv("TIKTOKEN_OFFLINE", "1")
+	for _, name := range builtinEncodings {
+		t.Run(string(name), func(t *testing.T) {
+			enc, err := tiktoken.GetEncodingByName(name)
+			if err != nil {
+				if name == tiktoken.QwenBase {
+					t.Fatal(err)
+				}
+				t.Skipf("not available offline: %v", err)
+			}
+			RoundTrip(t, enc)
+		})
+	}
+}
+
+func TestTestEncoding(t *testing.T) {
+	RoundTrip(t, tiktoken.GetTestEncoding())
+}
+
+func FuzzQwen(f *testing.F) {
+	enc, err := tiktoken.GetEncodingByName(tiktoken.QwenBase)
+	if err != nil {
+		f.Fatal(err)
+	}
+	NoPanics(f, enc)
+}
+
+func TestCompareEncoders(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := tiktoken.GetEncodingByName(tiktoken.QwenBase)
+	ass.Nil(err)
+	var buf bytes.Buffer
+	_, err = enc.WriteTo(&buf)
+	ass.Nil(err)
+	copied, err := tiktoken.ReadFrom(&buf)
+	ass.Nil(err)
+	CompareEncoders(t, enc, copied, Samples)
+
+	recorder := &failureRecorder{TB: t}
+	CompareEncoders(recorder, enc, FakeEncoder{}, []string{"hello world"})
+	ass.True(recorder.failed)
+}
+
+// failureRecorder notes failures instead of failing the test.
+type failureRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *failureRecorder) Errorf(format string, args ...any) {
+	r.failed = true
+}
@@ -0,0 +1,64 @@
+// Package tiktokentest provides test doubles for code that depends on the
+// tiktoken package, so unit tests don't need to download vocabularies, and
+// property checks for encodings: RoundTrip, NoPanics and CompareEncoders.
+package tiktokentest
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// FakeEncoder produces ceil(TokensPerChar * runes) tokens for a text. A zero
+// TokensPerChar behaves like 1, in which case each token is the code point
+// of a character and Decode restores the text exactly. Otherwise tokens are
+// numbered from 0 and decode to "?".
+type FakeEncoder struct {
+	TokensPerChar float64
+}
+
+var (
+	_ tiktoken.Encoder = FakeEncoder{}
+	_ tiktoken.Decoder = FakeEncoder{}
+)
+
+func (f FakeEncoder) exact() bool {
+	return f.TokensPerChar == 0 || f.TokensPerChar == 1
+}
+
+// Encode ignores the special token arguments.
+func (f FakeEncoder) Encode(text string, allowedSpecial []string, disallowedSpecial []string) []int {
+	if f.exact() {
+		tokens := make([]int, 0, len(text))
+		for _, r := range text {
+			tokens = append(tokens, int(r))
+		}
+		return tokens
+	}
+	tokens := make([]int, f.CountTokens(text))
+	for i := range tokens {
+		tokens[i] = i
+	}
+	return tokens
+}
+
+func (f FakeEncoder) CountTokens(text string) int {
+	runes := utf8.RuneCountInString(text)
+	if f.exact() {
+		return runes
+	}
+	return int(math.Ceil(float64(runes) * f.TokensPerChar))
+}
+
+func (f FakeEncoder) Decode(tokens []int) string {
+	if !f.exact() {
+		return strings.Repeat("?", len(tokens))
+	}
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteRune(rune(token))
+	}
+	return sb.String()
+}
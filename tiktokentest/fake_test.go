@@ -0,0 +1,61 @@
+package tiktokentest
+
+import (
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeEncoder(t *testing.T) {
+	ass := assert.New(t)
+	exact := FakeEncoder{}
+	tokens := exact.Encode("hi 世界", nil, nil)
+	ass.Equal(5, len(tokens))
+	ass.Equal(5, exact.CountTokens("hi 世界"))
+	ass.Equal("hi 世界", exact.Decode(tokens))
+
+	quarter := FakeEncoder{TokensPerChar: 0.25}
+	ass.Equal(3, quarter.CountTokens("hello world"))
+	ass.Equal([]int{0, 1, 2}, quarter.Encode("hello world", nil, nil))
+	ass.Equal(0, quarter.CountTokens(""))
+}
+
+func TestFakeEncoderHelpers(t *testing.T) {
+	ass := assert.New(t)
+	exact := FakeEncoder{}
+	text := "hello 世界, hello"
+
+	got, n := tiktoken.Truncate(exact, text, 7)
+	ass.Equal("hello 世", got)
+	ass.Equal(7, n)
+	got, n = tiktoken.TruncateToTokens(exact, text, 100)
+	ass.Equal(text, got)
+	ass.Equal(15, n)
+	got, n = tiktoken.TruncateHead(exact, text, 5)
+	ass.Equal("hello", got)
+	ass.Equal(5, n)
+	got, n = tiktoken.TruncateAtSeparator(exact, text, 12, ", ")
+	ass.Equal("hello 世界, ", got)
+	ass.Equal(10, n)
+	got, n = tiktoken.TruncateMiddle(exact, text, 9, "…")
+	ass.Equal("hell…ello", got)
+	ass.Equal(9, n)
+	ass.Equal([]string{"hello ", " 世界, h", "hello"}, tiktoken.SplitByTokens(exact, text, 6, 1))
+
+	// tokens that don't decode back to the text can't be cut between
+	got, n = tiktoken.Truncate(FakeEncoder{TokensPerChar: 2}, text, 7)
+	ass.Equal("", got)
+	ass.Equal(0, n)
+
+	messages := []tiktoken.ChatMessage{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Name: "bob", Content: "hi"},
+	}
+	n, diags := tiktoken.NumTokensFromMessagesWith(exact, messages, "gpt-4")
+	ass.Nil(diags)
+	// 3 per message, 1 per name and 3 for the reply around 6+8+4+3+2 runes
+	ass.Equal(3+6+8+3+4+3+1+2+3, n)
+	n, _ = tiktoken.NumTokensFromMessagesWith(exact, messages, "gpt-3.5-turbo-0301")
+	ass.Equal(4+6+8+4+4+3-1+2+3, n)
+}
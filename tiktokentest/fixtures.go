@@ -0,0 +1,185 @@
+package tiktokentest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Fixtures is a file of texts and the tokens a reference implementation
+// encoded them to, as test/gen_fixtures.py writes them from the Python
+// tiktoken library.
+type Fixtures struct {
+	// Generator names the library and version the tokens came from.
+	Generator string        `json:"generator"`
+	Cases     []FixtureCase `json:"cases"`
+}
+
+// FixtureCase is a text and its expected tokens in an encoding. Special
+// tokens in the text are encoded as text unless AllowedSpecial names them
+// or is ["all"], as Python's encode(text, allowed_special=...,
+// disallowed_special=()) does.
+type FixtureCase struct {
+	Encoding       string   `json:"encoding"`
+	Text           string   `json:"text"`
+	AllowedSpecial []string `json:"allowed_special,omitempty"`
+	Tokens         []int    `json:"tokens"`
+}
+
+// FixtureMismatch is a case of a fixture file that the encoding doesn't
+// reproduce.
+type FixtureMismatch struct {
+	File string
+	// Case is the index of the case in the file.
+	Case     int
+	Encoding string
+	Text     string
+	Want     []int
+	// Got are the tokens encoded, or nil with Err set if encoding failed.
+	Got []int
+	Err error
+}
+
+func (m FixtureMismatch) String() string {
+	if m.Err != nil {
+		return fmt.Sprintf("%s case %d (%s, %.40q): %v", m.File, m.Case, m.Encoding, m.Text, m.Err)
+	}
+	at := 0
+	for at < len(m.Want) && at < len(m.Got) && m.Want[at] == m.Got[at] {
+		at++
+	}
+	return fmt.Sprintf("%s case %d (%s, %.40q): first difference at token %d: want %v, got %v",
+		m.File, m.Case, m.Encoding, m.Text, at, m.Want[at:], m.Got[at:])
+}
+
+// FixtureError is returned by VerifyAgainstFixtures for the cases that
+// don't match.
+type FixtureError struct {
+	Cases      int
+	Mismatches []FixtureMismatch
+}
+
+func (e *FixtureError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d fixture cases don't match", len(e.Mismatches), e.Cases)
+	for i, m := range e.Mismatches {
+		if i == 10 {
+			fmt.Fprintf(&b, "\n\t... and %d more", len(e.Mismatches)-i)
+			break
+		}
+		b.WriteString("\n\t")
+		b.WriteString(m.String())
+	}
+	return b.String()
+}
+
+// ReadFixtures reads a fixture file.
+func ReadFixtures(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// VerifyAgainstFixtures checks that every case of the fixture file at path,
+// or of every .json file in the directory at path, encodes to its expected
+// tokens with the encoding of its name, and that they decode back to its
+// text. It fails with a *FixtureError listing the cases that don't match,
+// or with the error of a file or encoding that can't be loaded.
+//
+// Run it in a test of your own with the fixtures of the encodings you use
+// to have a machine-checked guarantee that they tokenize like Python:
+//
+//	if err := tiktokentest.VerifyAgainstFixtures("testdata/fixtures"); err != nil {
+//		t.Fatal(err)
+//	}
+func VerifyAgainstFixtures(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	files := []string{path}
+	if fi.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no fixture files in %s", path)
+		}
+		sort.Strings(files)
+	}
+
+	encodings := map[string]*tiktoken.Tiktoken{}
+	result := &FixtureError{}
+	for _, file := range files {
+		fixtures, err := ReadFixtures(file)
+		if err != nil {
+			return err
+		}
+		for i, c := range fixtures.Cases {
+			enc, ok := encodings[c.Encoding]
+			if !ok {
+				enc, err = tiktoken.GetEncoding(c.Encoding)
+				if err != nil {
+					return fmt.Errorf("%s case %d: %w", file, i, err)
+				}
+				encodings[c.Encoding] = enc
+			}
+			result.Cases++
+			if m, ok := verifyCase(enc, c); !ok {
+				m.File, m.Case = file, i
+				result.Mismatches = append(result.Mismatches, m)
+			}
+		}
+	}
+	if len(result.Mismatches) > 0 {
+		return result
+	}
+	return nil
+}
+
+// verifyCase encodes and decodes c with enc, and reports false with the
+// details if the result differs from c.
+func verifyCase(enc *tiktoken.Tiktoken, c FixtureCase) (FixtureMismatch, bool) {
+	m := FixtureMismatch{Encoding: c.Encoding, Text: c.Text, Want: c.Tokens}
+	opts := tiktoken.EncodeOptions{
+		AllowedSpecial:    tiktoken.SpecialSetOf(c.AllowedSpecial...),
+		DisallowedSpecial: tiktoken.SpecialSetOf(),
+	}
+	if len(c.AllowedSpecial) == 1 && c.AllowedSpecial[0] == "all" {
+		opts.AllowedSpecial = tiktoken.AllowedSpecialAll
+	}
+	got, err := enc.EncodeWithOptions(c.Text, opts)
+	if err != nil {
+		m.Err = err
+		return m, false
+	}
+	if len(got) == 0 && len(c.Tokens) == 0 {
+		return m, true
+	}
+	if !reflect.DeepEqual(got, c.Tokens) {
+		m.Got = got
+		return m, false
+	}
+	text, err := enc.DecodeWithError(got)
+	if err == nil && text != c.Text {
+		err = fmt.Errorf("tokens decode to %q", text)
+	}
+	if err != nil {
+		m.Err = err
+		return m, false
+	}
+	return m, true
+}
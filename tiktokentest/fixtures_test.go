@@ -0,0 +1,37 @@
+package tiktokentest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyAgainstFixtures(t *testing.T) {
+	ass := assert.New(t)
+	ass.Nil(VerifyAgainstFixtures("testdata/qwen_base.json"))
+	ass.Nil(VerifyAgainstFixtures("testdata"))
+
+	dir := t.TempDir()
+	bad := `{"generator": "test", "cases": [
+		{"encoding": "qwen_base", "text": "hello world", "tokens": [14990, 1879]},
+		{"encoding": "qwen_base", "text": "hello world", "tokens": [14990, 1880]}
+	]}`
+	ass.Nil(os.WriteFile(filepath.Join(dir, "bad.json"), []byte(bad), 0o644))
+	err := VerifyAgainstFixtures(dir)
+	var fixtureErr *FixtureError
+	if ass.ErrorAs(err, &fixtureErr) {
+		ass.Equal(2, fixtureErr.Cases)
+		ass.Len(fixtureErr.Mismatches, 1)
+		m := fixtureErr.Mismatches[0]
+		ass.Equal(1, m.Case)
+		ass.Equal([]int{14990, 1879}, m.Got)
+	}
+	ass.ErrorContains(err, "first difference at token 1: want [1880], got [1879]")
+
+	unknown := `{"cases": [{"encoding": "no_such_encoding", "text": "x", "tokens": [1]}]}`
+	ass.Nil(os.WriteFile(filepath.Join(dir, "bad.json"), []byte(unknown), 0o644))
+	ass.ErrorContains(VerifyAgainstFixtures(dir), "bad.json case 0")
+	ass.ErrorContains(VerifyAgainstFixtures(t.TempDir()), "no fixture files")
+}
@@ -0,0 +1,100 @@
+package tiktoken
+
+import "fmt"
+
+// tokenFilter is a filter of WithTokenFilter, with its inverse if it has
+// one.
+type tokenFilter struct {
+	apply, inverse func(id int) (int, bool)
+}
+
+// WithTokenFilter returns a copy of t whose Encode, EncodeWithError,
+// EncodeOrdinary and CountTokens pass every token through filter: it is
+// dropped if filter returns false and replaced by the returned id
+// otherwise. Filters of copies of copies apply in the order they were
+// added. The copy shares the vocabulary and compiled patterns with t.
+//
+// Decode on the copy can't tell which tokens filter remapped, so it only
+// accepts the ids filter keeps as they are and skips the others, as it
+// skips unknown tokens; DecodeWithError and DecodeStrict fail on them. Use
+// WithInvertibleTokenFilter to decode remapped ids.
+func (t *Tiktoken) WithTokenFilter(filter func(id int) (int, bool)) *Tiktoken {
+	return t.withTokenFilter(tokenFilter{apply: filter})
+}
+
+// WithInvertibleTokenFilter is WithTokenFilter with the inverse of filter,
+// which decoding applies to map ids back. inverse returns false for ids
+// filter never returns.
+func (t *Tiktoken) WithInvertibleTokenFilter(filter, inverse func(id int) (int, bool)) *Tiktoken {
+	return t.withTokenFilter(tokenFilter{apply: filter, inverse: inverse})
+}
+
+func (t *Tiktoken) withTokenFilter(f tokenFilter) *Tiktoken {
+	derived := *t
+	derived.filters = append(append([]tokenFilter{}, t.filters...), f)
+	return &derived
+}
+
+// filterToken passes token through the filters of t.
+func (t *Tiktoken) filterToken(token int) (int, bool) {
+	for _, f := range t.filters {
+		var ok bool
+		if token, ok = f.apply(token); !ok {
+			return 0, false
+		}
+	}
+	return token, true
+}
+
+// filterTokens filters tokens in place.
+func (t *Tiktoken) filterTokens(tokens []int) []int {
+	if len(t.filters) == 0 {
+		return tokens
+	}
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if token, ok := t.filterToken(token); ok {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+// unfilterToken maps a filtered id back to the token it was produced from,
+// or returns false if the filters can't tell.
+func (t *Tiktoken) unfilterToken(id int) (int, bool) {
+	for i := len(t.filters) - 1; i >= 0; i-- {
+		f := t.filters[i]
+		if f.inverse != nil {
+			var ok bool
+			if id, ok = f.inverse(id); !ok {
+				return 0, false
+			}
+			continue
+		}
+		if kept, ok := f.apply(id); !ok || kept != id {
+			return 0, false
+		}
+	}
+	return id, true
+}
+
+// unfilterTokens maps tokens back for decoding. Ids the filters can't map
+// back are skipped, or fail if strict.
+func (t *Tiktoken) unfilterTokens(tokens []int, strict bool) ([]int, error) {
+	if len(t.filters) == 0 {
+		return tokens, nil
+	}
+	mapped := make([]int, 0, len(tokens))
+	for i, id := range tokens {
+		token, ok := t.unfilterToken(id)
+		if !ok {
+			if strict {
+				return nil, fmt.Errorf("token %d at index %d can't be mapped back by the token filters", id, i)
+			}
+			continue
+		}
+		mapped = append(mapped, token)
+	}
+	return mapped, nil
+}
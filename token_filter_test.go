@@ -0,0 +1,97 @@
+package tiktoken
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTokenFilter(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world<|im_start|>hi<|im_end|>"
+	base := tk.Encode(text, []string{"all"}, nil)
+	ass.Equal([]int{14990, 1879, 151644, 6023, 151645}, base)
+
+	// drop the reserved range of special tokens
+	dropSpecial := tk.WithTokenFilter(func(id int) (int, bool) { return id, id < 151643 })
+	ass.Equal([]int{14990, 1879, 6023}, dropSpecial.Encode(text, []string{"all"}, nil))
+	ass.Equal(dropSpecial.EncodeOrdinary("hello world"), []int{14990, 1879})
+	ass.Equal(tk.CountTokens(text), dropSpecial.CountTokens(text))
+	ass.Equal("hello worldhi", dropSpecial.Decode(base))
+	_, err = dropSpecial.DecodeWithError(base)
+	ass.EqualError(err, "token 151644 at index 2 can't be mapped back by the token filters")
+	ass.Equal(base, tk.Encode(text, []string{"all"}, nil))
+
+	// remap between dialects: im_start and im_end swapped, without and with
+	// an inverse
+	swap := func(id int) (int, bool) {
+		switch id {
+		case 151644:
+			return 151645, true
+		case 151645:
+			return 151644, true
+		}
+		return id, true
+	}
+	remapped := tk.WithTokenFilter(swap)
+	tokens := remapped.Encode(text, []string{"all"}, nil)
+	ass.Equal([]int{14990, 1879, 151645, 6023, 151644}, tokens)
+	ass.Equal("hello worldhi", remapped.Decode(tokens))
+	_, err = remapped.DecodeWithMode(tokens, DecodeStrict)
+	ass.NotNil(err)
+
+	invertible := tk.WithInvertibleTokenFilter(swap, swap)
+	tokens = invertible.Encode(text, []string{"all"}, nil)
+	ass.Equal([]int{14990, 1879, 151645, 6023, 151644}, tokens)
+	ass.Equal(text, invertible.Decode(tokens))
+	decoded, err := invertible.DecodeWithError(tokens)
+	ass.Nil(err)
+	ass.Equal(text, decoded)
+
+	// filters compose in order, and the copies share the tables
+	shift := func(id int) (int, bool) { return id + 1000000, true }
+	unshift := func(id int) (int, bool) { return id - 1000000, id >= 1000000 }
+	composed := invertible.WithTokenFilter(func(id int) (int, bool) { return id, id != 151644 }).WithInvertibleTokenFilter(shift, unshift)
+	tokens = composed.Encode(text, []string{"all"}, nil)
+	ass.Equal([]int{1014990, 1001879, 1151645, 1006023}, tokens)
+	ass.Equal("hello world<|im_start|>hi", composed.Decode(tokens))
+	ass.Equal("hello world", composed.Decode([]int{1014990, 1001879, 14990}))
+	ass.Equal(4, composed.CountTokens("hello world hello world"))
+	ass.Same(tk.bpe, composed.bpe)
+	ass.Len(invertible.filters, 1)
+
+	_, err = composed.DecodeWithMode([]int{5}, DecodeStrict)
+	ass.NotNil(err)
+	ass.False(errors.Is(err, ErrInvalidUTF8))
+}
+
+func TestTokenFilterStreamsAndSessions(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	shift := func(id int) (int, bool) { return id + 1000000, id != 1879 }
+	unshift := func(id int) (int, bool) { return id - 1000000, id >= 1000000 }
+	filtered := tk.WithInvertibleTokenFilter(shift, unshift)
+	text := "hello world, hello world"
+	want := filtered.EncodeOrdinary(text)
+	ass.Equal([]int{1014990, 1000011, 1023811}, want)
+
+	session := filtered.NewSession()
+	ass.Equal(want, session.Encode(text))
+	ass.Equal(len(want), session.CountTokens(text))
+
+	counter := filtered.NewTokenCounter()
+	_, _ = counter.Write([]byte(text))
+	ass.Nil(counter.Flush())
+	ass.Equal(int64(filtered.CountTokens(text)), counter.Count())
+
+	chunks, err := filtered.DecodeTokensToBytes(append(want, 14990))
+	ass.Equal([][]byte{[]byte("hello"), []byte(","), []byte(" hello"), {}}, chunks)
+	var invalid *InvalidTokenError
+	ass.ErrorAs(err, &invalid)
+	ass.Equal(3, invalid.Index)
+}
@@ -0,0 +1,52 @@
+package tiktoken
+
+import (
+	"sort"
+	"strings"
+)
+
+// EncodeWithLastTokenCompletion encodes prompt like EncodeOrdinary for
+// token healing: if the last token of prompt is the start of longer
+// tokens, the prompt may end in the middle of the token a model would
+// produce for a longer text, e.g. "https:" before "//". It then returns
+// the tokens without the last one and, in ascending order, every token
+// whose bytes start with the bytes of the last one, the last one included.
+// Constraining the first generated token to partialTokenCandidates lets
+// the model pick the token it would have seen in training.
+//
+// If no token extends the last one, all tokens are returned and
+// partialTokenCandidates is nil.
+func (t *Tiktoken) EncodeWithLastTokenCompletion(prompt string) (tokens []int, partialTokenCandidates []int) {
+	start := metricsStart()
+	tokens = t.bpe.encodeOrdinaryNative(t.prepareText(prompt))
+	if len(tokens) > 0 {
+		last, _ := t.bpe.tables.rankString(tokens[len(tokens)-1])
+		if candidates := t.bpe.tables.withPrefix(last); len(candidates) > 1 {
+			tokens = tokens[:len(tokens)-1]
+			partialTokenCandidates = t.filterTokens(candidates)
+		}
+	}
+	tokens = t.filterTokens(tokens)
+	t.record(start, len(tokens), len(prompt))
+	return tokens, partialTokenCandidates
+}
+
+// withPrefix returns the ranks of the tokens starting with prefix in
+// ascending order. They are next to each other in byte order.
+func (t *rankTables) withPrefix(prefix string) []int {
+	first := sort.Search(t.len(), func(i int) bool {
+		start, end := t.span(i)
+		return t.tokenString[start:end] >= prefix
+	})
+	var ranks []int
+	for i := first; i < t.len(); i++ {
+		start, end := t.span(i)
+		token := t.tokenString[start:end]
+		if !strings.HasPrefix(token, prefix) {
+			break
+		}
+		ranks = append(ranks, t.encoder[token])
+	}
+	sort.Ints(ranks)
+	return ranks
+}
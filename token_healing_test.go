@@ -0,0 +1,36 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeWithLastTokenCompletion(t *testing.T) {
+	ass := assert.New(t)
+	ranks := map[string]int{"a": 0, "b": 1, "c": 2, "ab": 3, "bc": 4, "abc": 5, " ": 7}
+	bpe, err := NewCoreBPE(ranks, map[string]int{"<|end|>": 6}, `\w+|\s+`)
+	ass.Nil(err)
+	enc := NewTiktoken(bpe, &Encoding{Name: "tiny", PatStr: `\w+|\s+`, MergeableRanks: ranks, SpecialTokens: map[string]int{"<|end|>": 6}}, nil)
+
+	tokens, candidates := enc.EncodeWithLastTokenCompletion("c ab")
+	ass.Equal([]int{2, 7}, tokens)
+	ass.Equal([]int{3, 5}, candidates)
+	tokens, candidates = enc.EncodeWithLastTokenCompletion("c abc")
+	ass.Equal(enc.EncodeOrdinary("c abc"), tokens)
+	ass.Nil(candidates)
+	tokens, candidates = enc.EncodeWithLastTokenCompletion("")
+	ass.Empty(tokens)
+	ass.Nil(candidates)
+
+	qwen, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	tokens, candidates = qwen.EncodeWithLastTokenCompletion("hello wor")
+	ass.Equal([]int{14990}, tokens)
+	ass.Contains(candidates, 1879)
+	for _, candidate := range candidates {
+		ass.True(strings.HasPrefix(qwen.Decode([]int{candidate}), " wor"), candidate)
+	}
+	ass.Equal("hello world", qwen.Decode(append(tokens, 1879)))
+}
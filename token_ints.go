@@ -0,0 +1,104 @@
+package tiktoken
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TokenInt is an integer type token ids can be held in with EncodeAs and
+// DecodeAs, such as the int64 of repeated int64 protobuf fields.
+type TokenInt interface {
+	~int | ~int32 | ~int64 | ~uint32
+}
+
+// ErrTokenOutOfRange is wrapped by *TokenRangeError.
+var ErrTokenOutOfRange = errors.New("tiktoken: token id out of range")
+
+// TokenRangeError is returned by DecodeAs and DecodeInt64 for an id that is
+// not a token of the encoding: negative, too large or unknown.
+type TokenRangeError struct {
+	// Index is the index of the id in the decoded slice.
+	Index int
+	Token int64
+}
+
+func (e *TokenRangeError) Error() string {
+	return fmt.Sprintf("%v: token %d at index %d", ErrTokenOutOfRange, e.Token, e.Index)
+}
+
+func (e *TokenRangeError) Unwrap() error {
+	return ErrTokenOutOfRange
+}
+
+// EncodeAs is EncodeWithError returning the tokens as T. The tokens are
+// appended to the result as they are merged, without an []int in between.
+func EncodeAs[T TokenInt](t *Tiktoken, text string, allowedSpecial []string, disallowedSpecial []string) ([]T, error) {
+	if t.isClosed() {
+		return nil, ErrClosed
+	}
+	start := metricsStart()
+	size := len(text)
+	text = t.prepareText(text)
+	allowed, err := t.checkSpecial(text, allowedSpecial, disallowedSpecial)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]T, 0, len(text)/4)
+	emit := func(token int) {
+		if token, ok := t.filterToken(token); ok {
+			out = append(out, T(token))
+		}
+	}
+	var tokens []int
+	onPiece := func(piece string, start, end int) {
+		tokens = t.bpe.appendPiece(tokens[:0], piece)
+		for _, token := range tokens {
+			emit(token)
+		}
+	}
+	onSpecial := func(special string, start, end int) {
+		emit(t.bpe.specialTokensEncoder[special])
+	}
+	t.bpe.forEachSegment(text, allowed, onPiece, onSpecial)
+	t.record(start, len(out), size)
+	return out, nil
+}
+
+// DecodeAs is DecodeWithError for tokens held as T. Every id is checked
+// before it is converted, so none is truncated: ids that are not tokens of
+// the encoding fail with a *TokenRangeError.
+func DecodeAs[T TokenInt](t *Tiktoken, tokens []T) (string, error) {
+	if t.isClosed() {
+		return "", ErrClosed
+	}
+	out := make([]byte, 0, len(tokens)*2)
+	for i, v := range tokens {
+		id := int64(v)
+		if id < 0 || id > maxTokenID {
+			return "", &TokenRangeError{Index: i, Token: id}
+		}
+		token := int(id)
+		if len(t.filters) > 0 {
+			var ok bool
+			if token, ok = t.unfilterToken(token); !ok {
+				return "", fmt.Errorf("token %d at index %d can't be mapped back by the token filters", id, i)
+			}
+		}
+		b := t.bpe.tokenBytes(token)
+		if b == nil {
+			return "", &TokenRangeError{Index: i, Token: id}
+		}
+		out = append(out, b...)
+	}
+	return string(out), nil
+}
+
+// EncodeInt64 is EncodeAs for int64 tokens.
+func (t *Tiktoken) EncodeInt64(text string, allowedSpecial []string, disallowedSpecial []string) ([]int64, error) {
+	return EncodeAs[int64](t, text, allowedSpecial, disallowedSpecial)
+}
+
+// DecodeInt64 is DecodeAs for int64 tokens.
+func (t *Tiktoken) DecodeInt64(tokens []int64) (string, error) {
+	return DecodeAs(t, tokens)
+}
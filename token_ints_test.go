@@ -0,0 +1,57 @@
+package tiktoken
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecodeInt64(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world<|endoftext|> 你好"
+	want := enc.Encode(text, []string{"all"}, nil)
+	tokens, err := enc.EncodeInt64(text, []string{"all"}, nil)
+	ass.Nil(err)
+	ass.Len(tokens, len(want))
+	for i, token := range want {
+		ass.Equal(int64(token), tokens[i])
+	}
+	decoded, err := enc.DecodeInt64(tokens)
+	ass.Nil(err)
+	ass.Equal(text, decoded)
+
+	small, err := EncodeAs[uint32](enc, text, []string{"all"}, nil)
+	ass.Nil(err)
+	ass.Equal(uint32(want[0]), small[0])
+	decoded, err = DecodeAs(enc, small)
+	ass.Nil(err)
+	ass.Equal(text, decoded)
+
+	_, err = enc.EncodeInt64(text, nil, []string{"all"})
+	ass.ErrorContains(err, "disallowed special token <|endoftext|>")
+
+	for _, bad := range []int64{-1, 1 << 40, 1<<32 + 14990, 200000} {
+		_, err = enc.DecodeInt64([]int64{14990, bad})
+		var rangeErr *TokenRangeError
+		ass.True(errors.As(err, &rangeErr), "%d", bad)
+		ass.Equal(&TokenRangeError{Index: 1, Token: bad}, rangeErr)
+		ass.True(errors.Is(err, ErrTokenOutOfRange))
+	}
+	_, err = DecodeAs(enc, []int32{-5})
+	ass.Equal(&TokenRangeError{Index: 0, Token: -5}, err)
+
+	shifted := enc.WithInvertibleTokenFilter(
+		func(id int) (int, bool) { return id + 1, true },
+		func(id int) (int, bool) { return id - 1, true },
+	)
+	tokens, err = shifted.EncodeInt64("hello", nil, nil)
+	ass.Nil(err)
+	ass.Equal([]int64{14991}, tokens)
+	decoded, err = shifted.DecodeInt64(tokens)
+	ass.Nil(err)
+	ass.Equal("hello", decoded)
+}
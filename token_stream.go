@@ -0,0 +1,272 @@
+package tiktoken
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTokenStream is returned by TokenReader for input that is not a token
+// stream or is corrupt. The wrapping error says what is wrong.
+var ErrTokenStream = errors.New("tiktoken: invalid token stream")
+
+// tokenStreamMagic starts every token stream, followed by the version.
+const (
+	tokenStreamMagic   = "TKS"
+	tokenStreamVersion = 1
+)
+
+// DefaultBlockTokens is the number of tokens a TokenWriter collects before
+// it writes a block.
+const DefaultBlockTokens = 4096
+
+// TokenWriter writes token ids compactly to an io.Writer, most in one to
+// three bytes. The format, version 1, is:
+//
+//	stream  = "TKS" version block*
+//	version = byte 0x01
+//	block   = uvarint(count) uvarint(size) uvarint(id){count}
+//
+// where uvarint is the unsigned LEB128 varint of encoding/binary: 7 bits
+// per byte, least significant first, the high bit set on all but the last
+// byte. count is the number of ids in the block, at least 1, and size the
+// number of bytes they take, so a reader can skip blocks. The stream ends
+// after the last block; readers must reject a stream ending inside one.
+// Blocks don't mean anything beyond framing, the stream is the
+// concatenation of their ids.
+//
+// Tokens are buffered: call Flush when done. A TokenWriter doesn't close the
+// underlying writer and is not safe for concurrent use.
+type TokenWriter struct {
+	w           *bufio.Writer
+	blockTokens int
+	pending     []byte
+	count       int
+	started     bool
+	err         error
+}
+
+// NewTokenWriter returns a TokenWriter writing to w in blocks of
+// DefaultBlockTokens tokens.
+func NewTokenWriter(w io.Writer) *TokenWriter {
+	return &TokenWriter{w: bufio.NewWriter(w), blockTokens: DefaultBlockTokens}
+}
+
+// Write adds tokens to the stream. Token ids must not be negative.
+func (tw *TokenWriter) Write(tokens ...int) error {
+	for _, token := range tokens {
+		if err := tw.writeToken(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tw *TokenWriter) writeToken(token int) error {
+	if tw.err != nil {
+		return tw.err
+	}
+	if token < 0 {
+		return fmt.Errorf("token stream: negative token %d", token)
+	}
+	tw.pending = binary.AppendUvarint(tw.pending, uint64(token))
+	if tw.count++; tw.count == tw.blockTokens {
+		return tw.writeBlock()
+	}
+	return nil
+}
+
+// writeBlock writes the pending tokens as a block, and the header first if
+// it hasn't been written.
+func (tw *TokenWriter) writeBlock() error {
+	if !tw.started {
+		tw.started = true
+		tw.w.WriteString(tokenStreamMagic)
+		tw.w.WriteByte(tokenStreamVersion)
+	}
+	if tw.count > 0 {
+		var head [2 * binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(head[:], uint64(tw.count))
+		n += binary.PutUvarint(head[n:], uint64(len(tw.pending)))
+		tw.w.Write(head[:n])
+		tw.w.Write(tw.pending)
+		tw.pending, tw.count = tw.pending[:0], 0
+	}
+	// bufio.Writer keeps the first error and reports it from every call
+	_, tw.err = tw.w.Write(nil)
+	return tw.err
+}
+
+// Flush writes the buffered tokens as a block and flushes the underlying
+// writer. A stream that Flush was never called on is empty, not even the
+// header is written.
+func (tw *TokenWriter) Flush() error {
+	if tw.err != nil {
+		return tw.err
+	}
+	if err := tw.writeBlock(); err != nil {
+		return err
+	}
+	tw.err = tw.w.Flush()
+	return tw.err
+}
+
+// TokenReader reads the token ids written by a TokenWriter. It is not safe
+// for concurrent use.
+type TokenReader struct {
+	r       *bufio.Reader
+	started bool
+	// left is the number of ids and bytes remaining in the current block.
+	left, size uint64
+	err        error
+}
+
+// NewTokenReader returns a TokenReader reading from r.
+func NewTokenReader(r io.Reader) *TokenReader {
+	return &TokenReader{r: bufio.NewReader(r)}
+}
+
+// Read reads up to len(dst) tokens into dst and returns their number. At
+// the end of the stream it returns 0 and io.EOF; an empty input is an empty
+// stream.
+func (tr *TokenReader) Read(dst []int) (int, error) {
+	n := 0
+	for n < len(dst) {
+		token, err := tr.ReadToken()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		dst[n] = token
+		n++
+	}
+	return n, nil
+}
+
+// ReadToken reads the next token, or returns io.EOF at the end of the
+// stream.
+func (tr *TokenReader) ReadToken() (int, error) {
+	if tr.err != nil {
+		return 0, tr.err
+	}
+	token, err := tr.readToken()
+	if err != nil {
+		tr.err = err
+	}
+	return token, err
+}
+
+func (tr *TokenReader) readToken() (int, error) {
+	if !tr.started {
+		tr.started = true
+		var head [len(tokenStreamMagic) + 1]byte
+		if _, err := io.ReadFull(tr.r, head[:]); err != nil {
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, fmt.Errorf("%w: no header", ErrTokenStream)
+		}
+		if string(head[:len(tokenStreamMagic)]) != tokenStreamMagic {
+			return 0, fmt.Errorf("%w: bad magic %q", ErrTokenStream, head[:len(tokenStreamMagic)])
+		}
+		if v := head[len(tokenStreamMagic)]; v != tokenStreamVersion {
+			return 0, fmt.Errorf("%w: unsupported version %d", ErrTokenStream, v)
+		}
+	}
+	if tr.left == 0 {
+		if tr.size != 0 {
+			return 0, fmt.Errorf("%w: block longer than its size", ErrTokenStream)
+		}
+		if _, err := tr.r.Peek(1); err == io.EOF {
+			return 0, io.EOF
+		}
+		var err error
+		if tr.left, err = binary.ReadUvarint(tr.r); err != nil {
+			return 0, tr.corrupt(err)
+		}
+		if tr.size, err = binary.ReadUvarint(tr.r); err != nil {
+			return 0, tr.corrupt(err)
+		}
+		if tr.left == 0 || tr.size < tr.left {
+			return 0, fmt.Errorf("%w: block of %d tokens in %d bytes", ErrTokenStream, tr.left, tr.size)
+		}
+	}
+	token, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return 0, tr.corrupt(err)
+	}
+	width := uvarintLen(token)
+	if width > tr.size {
+		return 0, fmt.Errorf("%w: block shorter than its size", ErrTokenStream)
+	}
+	if token > uint64(maxTokenID) {
+		return 0, fmt.Errorf("%w: token %d out of range", ErrTokenStream, token)
+	}
+	tr.left--
+	tr.size -= width
+	return int(token), nil
+}
+
+// uvarintLen returns the number of bytes of the uvarint of x. Writers emit
+// the shortest form, which is what ReadUvarint accepts.
+func uvarintLen(x uint64) uint64 {
+	n := uint64(1)
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
+// maxTokenID is the largest id an int holds on every platform.
+const maxTokenID = 1<<31 - 1
+
+func (tr *TokenReader) corrupt(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated block", ErrTokenStream)
+	}
+	return fmt.Errorf("%w: %v", ErrTokenStream, err)
+}
+
+// ReadAll reads the remaining tokens of the stream.
+func (tr *TokenReader) ReadAll() ([]int, error) {
+	var tokens []int
+	for {
+		token, err := tr.ReadToken()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// EncodeToWriter writes the tokens of Encode(text, nil, nil) to tw as they
+// are produced, without building the token slice. Disallowed special tokens
+// are not checked, as in PreTokenize. Call tw.Flush when done.
+func (t *Tiktoken) EncodeToWriter(text string, tw *TokenWriter) error {
+	if t.isClosed() {
+		return ErrClosed
+	}
+	var err error
+	t.walkTokens(text, func(token, _ int) bool {
+		err = tw.writeToken(token)
+		return err == nil
+	})
+	return err
+}
+
+// DecodeFromReader reads the remaining tokens of tr and decodes them as
+// Decode does.
+func (t *Tiktoken) DecodeFromReader(tr *TokenReader) (string, error) {
+	tokens, err := tr.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	return t.Decode(tokens), nil
+}
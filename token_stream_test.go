@@ -0,0 +1,120 @@
+package tiktoken
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenStreamFormat(t *testing.T) {
+	ass := assert.New(t)
+	var buf bytes.Buffer
+	tw := NewTokenWriter(&buf)
+	ass.Nil(tw.Write(0, 127, 128, 151643))
+	ass.Nil(tw.Flush())
+	ass.Equal([]byte{
+		'T', 'K', 'S', 1,
+		4, 7,
+		0x00, 0x7f, 0x80, 0x01, 0xdb, 0xa0, 0x09,
+	}, buf.Bytes())
+
+	tokens, err := NewTokenReader(&buf).ReadAll()
+	ass.Nil(err)
+	ass.Equal([]int{0, 127, 128, 151643}, tokens)
+
+	buf.Reset()
+	ass.Nil(NewTokenWriter(&buf).Flush())
+	ass.Equal([]byte("TKS\x01"), buf.Bytes())
+	tokens, err = NewTokenReader(&buf).ReadAll()
+	ass.Nil(err)
+	ass.Nil(tokens)
+
+	tokens, err = NewTokenReader(strings.NewReader("")).ReadAll()
+	ass.Nil(err)
+	ass.Nil(tokens)
+
+	ass.NotNil(NewTokenWriter(&buf).Write(1, -1))
+}
+
+func TestTokenStreamRoundTrip(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	parts := []string{
+		"The quick brown fox jumps over the lazy dog. ",
+		"你好，世界！这是一个测试。",
+		"こんにちは世界 안녕하세요 ",
+		"Привет, мир! مرحبا بالعالم שלום ",
+		"👍🏽 👨‍👩‍👧‍👦 🇺🇸\n",
+		"func main() {\n\tfmt.Println(42)\n}\n",
+	}
+	var sb strings.Builder
+	for i := 0; i < 500; i++ {
+		sb.WriteString(parts[i%len(parts)])
+	}
+	corpus := sb.String()
+	want := tk.EncodeOrdinary(corpus)
+
+	for _, blockTokens := range []int{1, 7, DefaultBlockTokens} {
+		var buf bytes.Buffer
+		tw := NewTokenWriter(&buf)
+		tw.blockTokens = blockTokens
+		ass.Nil(tk.EncodeToWriter(corpus, tw))
+		ass.Nil(tw.Flush())
+		if blockTokens == DefaultBlockTokens {
+			ass.Less(buf.Len(), 3*len(want))
+		}
+
+		got, err := tk.DecodeFromReader(NewTokenReader(bytes.NewReader(buf.Bytes())))
+		ass.Nil(err)
+		ass.Equal(corpus, got, blockTokens)
+
+		tr := NewTokenReader(bytes.NewReader(buf.Bytes()))
+		var tokens []int
+		dst := make([]int, 100)
+		for {
+			n, err := tr.Read(dst)
+			tokens = append(tokens, dst[:n]...)
+			if err == io.EOF {
+				break
+			}
+			ass.Nil(err)
+		}
+		ass.Equal(want, tokens, blockTokens)
+	}
+}
+
+func TestTokenStreamCorrupt(t *testing.T) {
+	ass := assert.New(t)
+	var buf bytes.Buffer
+	tw := NewTokenWriter(&buf)
+	ass.Nil(tw.Write(1, 300, 2))
+	ass.Nil(tw.Flush())
+	valid := buf.Bytes()
+
+	for name, input := range map[string]string{
+		"short header":    "TK",
+		"bad magic":       "TKZ\x01\x01\x01\x00",
+		"bad version":     "TKS\x02\x01\x01\x00",
+		"empty block":     "TKS\x01\x00\x00",
+		"truncated block": string(valid[:len(valid)-1]),
+		"truncated size":  "TKS\x01\x03",
+		"size too small":  "TKS\x01\x03\x03\x01\xac\x02\x02",
+		"size too large":  "TKS\x01\x03\x05\x01\xac\x02\x02\x00",
+		"out of range":    "TKS\x01\x01\x05\xff\xff\xff\xff\x0f",
+	} {
+		tokens, err := NewTokenReader(strings.NewReader(input)).ReadAll()
+		ass.True(errors.Is(err, ErrTokenStream), "%s: %v %v", name, tokens, err)
+	}
+
+	tr := NewTokenReader(strings.NewReader("TKS\x02"))
+	_, err := tr.ReadToken()
+	ass.True(errors.Is(err, ErrTokenStream))
+	_, err2 := tr.ReadToken()
+	ass.Equal(err, err2)
+}
@@ -0,0 +1,48 @@
+package tiktoken
+
+// FNV-1a 64 parameters.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// tokenHash is FNV-1a 64 over tokens written as 8-byte little-endian
+// integers.
+type tokenHash uint64
+
+func newTokenHash() tokenHash {
+	return fnvOffset64
+}
+
+func (h tokenHash) add(token int) tokenHash {
+	v := uint64(token)
+	for i := 0; i < 8; i++ {
+		h ^= tokenHash(byte(v))
+		h *= fnvPrime64
+		v >>= 8
+	}
+	return h
+}
+
+// HashTokens returns the 64-bit FNV-1a hash of tokens, each written as an
+// 8-byte little-endian integer, e.g. to key a cache on a tokenized prompt.
+// The hash is the same on every platform and will not change in later
+// releases; equal sequences hash equally but different sequences may
+// collide, so it is no substitute for comparing tokens where that matters.
+func HashTokens(tokens []int) uint64 {
+	h := newTokenHash()
+	for _, token := range tokens {
+		h = h.add(token)
+	}
+	return uint64(h)
+}
+
+// HashText returns HashTokens(t.EncodeOrdinary(text)) without building the
+// token slice.
+func (t *Tiktoken) HashText(text string) uint64 {
+	h := newTokenHash()
+	t.bpe.encodeOrdinaryFunc(t.prepareText(text), func(token int) {
+		h = h.add(token)
+	})
+	return uint64(h)
+}
@@ -0,0 +1,47 @@
+package tiktoken
+
+import (
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The hashes are persisted by users; these values must never change.
+func TestHashTokens(t *testing.T) {
+	ass := assert.New(t)
+	golden := []struct {
+		tokens []int
+		hash   uint64
+	}{
+		{nil, 0xcbf29ce484222325},
+		{[]int{0}, 0xa8c7f832281a39c5},
+		{[]int{1}, 0x89cd31291d2aefa4},
+		{[]int{14990}, 0xea6cb2fa30de7149},
+		{[]int{14990, 1879}, 0x6e3f732455dcb96f},
+		{[]int{151643, 151644, 151645}, 0xce3beb2293ebf21d},
+		{[]int{1 << 30, -1}, 0xa2645a560d4759d},
+	}
+	for _, g := range golden {
+		ass.Equal(g.hash, HashTokens(g.tokens), "%v", g.tokens)
+
+		// the reference implementation over fixed-width little-endian ints
+		h := fnv.New64a()
+		for _, token := range g.tokens {
+			v := uint64(token)
+			h.Write([]byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24), byte(v >> 32), byte(v >> 40), byte(v >> 48), byte(v >> 56)})
+		}
+		ass.Equal(h.Sum64(), HashTokens(g.tokens))
+	}
+	ass.NotEqual(HashTokens([]int{1, 2}), HashTokens([]int{2, 1}))
+}
+
+func TestHashText(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	for _, text := range []string{"", "hello world", "你好，世界", "<|endoftext|> 12345"} {
+		ass.Equal(HashTokens(tk.EncodeOrdinary(text)), tk.HashText(text), text)
+	}
+	ass.Equal(uint64(0x6e3f732455dcb96f), tk.HashText("hello world"))
+}
@@ -0,0 +1,27 @@
+package tiktoken
+
+// walkTokens calls fn with the tokens of Encode(text, nil, nil) and the byte
+// offset in text each starts at, as they are produced, until fn returns
+// false. Disallowed special tokens are not checked, as in PreTokenize.
+func (t *Tiktoken) walkTokens(text string, fn func(token, offset int) bool) {
+	text = t.prepareText(text)
+	var tokens []int
+	onPiece := func(piece string, start, end int) bool {
+		tokens = t.bpe.appendPiece(tokens[:0], piece)
+		offset := start
+		for _, token := range tokens {
+			if !fn(token, offset) {
+				return false
+			}
+			// invalid UTF-8 reads as U+FFFD, which is longer
+			if offset += len(t.bpe.tokenBytes(token)); offset > end {
+				offset = end
+			}
+		}
+		return true
+	}
+	onSpecial := func(special string, start, end int) bool {
+		return fn(t.bpe.specialTokensEncoder[special], start)
+	}
+	t.bpe.walkSegments(text, t.allowedSpecialSet(t.opts.allowedSpecial), onPiece, onSpecial)
+}
@@ -0,0 +1,28 @@
+//go:build go1.23
+
+package tiktoken
+
+import "iter"
+
+// Tokens returns the tokens of text as Encode(text, nil, nil) produces
+// them, but one at a time as each piece is merged instead of as a slice,
+// so ranging over them takes memory independent of the number of tokens.
+// Breaking out of the loop stops encoding. Special tokens are those allowed by default, see
+// WithDefaultAllowedSpecial; disallowed ones are not checked, as in
+// PreTokenize. Each range over the sequence encodes text again.
+func (t *Tiktoken) Tokens(text string) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		t.walkTokens(text, func(token, _ int) bool {
+			return yield(token)
+		})
+	}
+}
+
+// TokensWithOffsets is Tokens also yielding the byte offset in text at
+// which each token starts. With input options such as WithNormalization
+// the offsets refer to the transformed text.
+func (t *Tiktoken) TokensWithOffsets(text string) iter.Seq2[int, int] {
+	return func(yield func(token, offset int) bool) {
+		t.walkTokens(text, yield)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build go1.23
+
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	ass := assert.New(t)
+	tk, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	for _, text := range []string{"", "hello world", "你好，世界！ 12345", "bad \xff utf-8", "<|endoftext|> hi"} {
+		var tokens []int
+		for token := range tk.Tokens(text) {
+			tokens = append(tokens, token)
+		}
+		ass.Equal(tk.EncodeOrdinary(text), append([]int{}, tokens...), text)
+	}
+
+	text := "hello world, 你好"
+	var offsets []int
+	for token, offset := range tk.TokensWithOffsets(text) {
+		ass.True(strings.HasPrefix(text[offset:], tk.Decode([]int{token})), offset)
+		offsets = append(offsets, offset)
+	}
+	ass.Equal([]int{0, 5, 11, 12}, offsets[:4])
+
+	withSpecials := tk.WithDefaultAllowedSpecial(ENDOFTEXT)
+	var tokens []int
+	for token := range withSpecials.Tokens("hello<|endoftext|>") {
+		tokens = append(tokens, token)
+	}
+	ass.Equal([]int{14990, 151643}, tokens)
+
+	// breaking out stops encoding of the rest
+	n := 0
+	huge := strings.Repeat("hello ", 1<<20)
+	for range tk.Tokens(huge) {
+		if n++; n == 3 {
+			break
+		}
+	}
+	ass.Equal(3, n)
+	ass.Less(testing.AllocsPerRun(5, func() {
+		for range tk.Tokens(huge) {
+			break
+		}
+	}), 20.0)
+}
@@ -0,0 +1,362 @@
+package tiktoken
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// TruncateOption configures the truncation helpers.
+type TruncateOption func(*truncateConfig)
+
+type truncateConfig struct {
+	graphemeSafe bool
+	headRatio    float64
+}
+
+// WithGraphemeSafety makes truncation cut only between user-perceived
+// characters (UAX #29 grapheme clusters), so a truncated text never ends in
+// half of an emoji sequence or a letter without its combining marks.
+func WithGraphemeSafety(enabled bool) TruncateOption {
+	return func(c *truncateConfig) {
+		c.graphemeSafe = enabled
+	}
+}
+
+// WithHeadRatio sets the share of the budget TruncateMiddle gives to the
+// start of the text, the rest goes to the end. It is clamped to [0, 1] and
+// defaults to 0.5.
+func WithHeadRatio(ratio float64) TruncateOption {
+	return func(c *truncateConfig) {
+		if ratio < 0 {
+			ratio = 0
+		} else if ratio > 1 {
+			ratio = 1
+		}
+		c.headRatio = ratio
+	}
+}
+
+func newTruncateConfig(opts []TruncateOption) truncateConfig {
+	cfg := truncateConfig{headRatio: 0.5}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// Truncate returns the longest prefix of text, cut on a token boundary, that
+// encodes to at most maxTokens tokens, together with its token count. The
+// prefix is valid UTF-8 if text is. Special tokens are counted as ordinary text,
+// as in EncodeOrdinary, and the encode options of t are applied to text
+// before it is cut.
+func (t *Tiktoken) Truncate(text string, maxTokens int, opts ...TruncateOption) (string, int) {
+	return Truncate(t, text, maxTokens, opts...)
+}
+
+// Truncate is the Truncate method of *Tiktoken for any Codec, e.g. a
+// tiktokentest.FakeEncoder. Token boundaries are found by decoding the
+// tokens of text, so cuts can only fall where they decode back to it.
+func Truncate(enc Codec, text string, maxTokens int, opts ...TruncateOption) (string, int) {
+	tk, text := tokenizerOf(enc, text)
+	return truncateTail(tk, text, maxTokens, newTruncateConfig(opts))
+}
+
+func truncateTail(tk tokenizer, text string, maxTokens int, cfg truncateConfig) (string, int) {
+	tokens, offsets := tk.encodeOrdinaryOffsets(text)
+	if len(tokens) <= maxTokens {
+		return text, len(tokens)
+	}
+	keep := maxTokens
+	for keep > 0 {
+		for offsets[keep] < 0 {
+			keep--
+		}
+		n := cfg.cutBefore(text, offsets[keep])
+		// a prefix doesn't always tokenize like the start of the whole text
+		count := tk.countOrdinary(text[:n])
+		if count <= maxTokens {
+			return text[:n], count
+		}
+		keep -= count - maxTokens
+	}
+	return "", 0
+}
+
+// encodeOrdinaryOffsets is encodeOrdinaryNative also returning the byte
+// offset in text at which each token starts, followed by len(text).
+// Invalid UTF-8 encodes as the longer U+FFFD, so the tokens of a piece
+// holding some don't line up with its bytes: all of them but the first
+// get the offset -1, as text can't be cut there.
+func (bp *CoreBPE) encodeOrdinaryOffsets(text string) (tokens, offsets []int) {
+	bp.forEachPieceRange(text, func(piece string, start, end int) {
+		first := len(tokens)
+		tokens = bp.appendPiece(tokens, piece)
+		aligned := len(piece) == end-start
+		for _, token := range tokens[first:] {
+			offsets = append(offsets, start)
+			if start >= 0 && aligned {
+				start += len(bp.tokenBytes(token))
+			} else {
+				start = -1
+			}
+		}
+	})
+	return tokens, append(offsets, len(text))
+}
+
+// tokenizer is what truncation and chunking need of an encoder, working on
+// text the encode options were already applied to. *CoreBPE is one, and
+// codecTokenizer adapts any Codec.
+type tokenizer interface {
+	encodeOrdinaryNative(text string) []int
+	encodeOrdinaryOffsets(text string) (tokens, offsets []int)
+	countOrdinary(text string) int
+	tokenBytes(token int) []byte
+}
+
+// tokenizerOf returns the tokenizer of enc and text with the encode
+// options of enc applied.
+func tokenizerOf(enc Codec, text string) (tokenizer, string) {
+	if t, ok := enc.(*Tiktoken); ok {
+		return t.bpe, t.prepareText(text)
+	}
+	return codecTokenizer{enc}, text
+}
+
+// maxTokenGroup bounds how many tokens codecTokenizer decodes together
+// looking for the end of a character split across them.
+const maxTokenGroup = 8
+
+type codecTokenizer struct {
+	enc Codec
+}
+
+func (c codecTokenizer) encodeOrdinaryNative(text string) []int {
+	return c.enc.Encode(text, nil, nil)
+}
+
+// encodeOrdinaryOffsets decodes the tokens of text in groups, each ending
+// once its tokens decode to the next bytes of text. The first token of a
+// group starts where the previous group ended, the others get the offset
+// -1; once no group of up to maxTokenGroup tokens matches the text, the
+// rest of the tokens get -1 too.
+func (c codecTokenizer) encodeOrdinaryOffsets(text string) (tokens, offsets []int) {
+	tokens = c.encodeOrdinaryNative(text)
+	offsets = make([]int, len(tokens), len(tokens)+1)
+	pos, first := 0, 0
+	for i := range tokens {
+		offsets[i] = -1
+		if pos < 0 {
+			continue
+		}
+		if i == first {
+			offsets[i] = pos
+		}
+		if s := c.enc.Decode(tokens[first : i+1]); strings.HasPrefix(text[pos:], s) {
+			pos, first = pos+len(s), i+1
+		} else if i+1-first >= maxTokenGroup {
+			pos = -1
+		}
+	}
+	return tokens, append(offsets, len(text))
+}
+
+func (c codecTokenizer) countOrdinary(text string) int {
+	return c.enc.CountTokens(text)
+}
+
+func (c codecTokenizer) tokenBytes(token int) []byte {
+	return []byte(c.enc.Decode([]int{token}))
+}
+
+// maxSuffixGrowth bounds how many times TruncateHead re-encodes a suffix that
+// came out shorter than the budget to try to fit one more token.
+const maxSuffixGrowth = 8
+
+// TruncateHead is the mirror image of Truncate: it drops the beginning of
+// text and returns the longest suffix, cut on a token boundary, that encodes
+// to at most maxTokens tokens, together with its token count.
+//
+// A suffix doesn't always tokenize like the end of the whole text, so its
+// count is verified after cutting and the cut moved if needed. The number
+// of attempts is bounded by maxTokens plus a small constant.
+func (t *Tiktoken) TruncateHead(text string, maxTokens int, opts ...TruncateOption) (string, int) {
+	return TruncateHead(t, text, maxTokens, opts...)
+}
+
+// TruncateHead is the TruncateHead method of *Tiktoken for any Codec, see
+// Truncate.
+func TruncateHead(enc Codec, text string, maxTokens int, opts ...TruncateOption) (string, int) {
+	tk, text := tokenizerOf(enc, text)
+	return truncateHead(tk, text, maxTokens, newTruncateConfig(opts))
+}
+
+func truncateHead(tk tokenizer, text string, maxTokens int, cfg truncateConfig) (string, int) {
+	tokens, offsets := tk.encodeOrdinaryOffsets(text)
+	if len(tokens) <= maxTokens {
+		return text, len(tokens)
+	}
+	suffix := func(keep int) (string, int) {
+		i := len(tokens) - keep
+		for offsets[i] < 0 {
+			i++
+		}
+		start := cfg.cutAfter(text, offsets[i])
+		return text[start:], tk.countOrdinary(text[start:])
+	}
+
+	keep := maxTokens
+	for keep > 0 {
+		got, count := suffix(keep)
+		if count > maxTokens {
+			keep -= count - maxTokens
+			continue
+		}
+		// the cut may have merged tokens, see whether a longer suffix fits
+		for i := 0; i < maxSuffixGrowth && count < maxTokens && keep < len(tokens); i++ {
+			longer, longerCount := suffix(keep + 1)
+			if longerCount > maxTokens {
+				break
+			}
+			keep, got, count = keep+1, longer, longerCount
+		}
+		return got, count
+	}
+	return "", 0
+}
+
+// TruncateAtSeparator is Truncate for texts made of units that each end in
+// separator, such as few-shot examples ending in "\n###\n": it returns the
+// longest prefix of text that encodes to at most maxTokens tokens and ends
+// with a complete separator, together with its token count, so no unit is
+// cut. The result is "" if not even the first unit fits, and text itself
+// if all of it fits. Separators are found in the text, not in its tokens.
+// text is encoded once and the chosen prefix counted, which normally
+// decides; an empty separator truncates as Truncate does.
+func (t *Tiktoken) TruncateAtSeparator(text string, maxTokens int, separator string) (string, int) {
+	return TruncateAtSeparator(t, text, maxTokens, separator)
+}
+
+// TruncateAtSeparator is the TruncateAtSeparator method of *Tiktoken for
+// any Codec, see Truncate.
+func TruncateAtSeparator(enc Codec, text string, maxTokens int, separator string) (string, int) {
+	tk, text := tokenizerOf(enc, text)
+	if separator == "" {
+		return truncateTail(tk, text, maxTokens, truncateConfig{})
+	}
+	tokens := tk.encodeOrdinaryNative(text)
+	if len(tokens) <= maxTokens {
+		return text, len(tokens)
+	}
+	n := 0
+	for _, token := range tokens[:maxTokens] {
+		n += len(tk.tokenBytes(token))
+	}
+	if n > len(text) {
+		n = len(text)
+	}
+	for {
+		i := strings.LastIndex(text[:n], separator)
+		if i < 0 {
+			return "", 0
+		}
+		end := i + len(separator)
+		// a prefix doesn't always tokenize like the start of the whole text
+		if count := tk.countOrdinary(text[:end]); count <= maxTokens {
+			return text[:end], count
+		}
+		n = end - 1
+	}
+}
+
+// TruncateMiddle keeps the start and the end of text and replaces the middle
+// with ellipsis so that the result encodes to at most maxTokens tokens. The
+// budget left after the ellipsis is split according to WithHeadRatio. It
+// returns the result and its token count. When maxTokens is too small for
+// the ellipsis, the text is truncated like Truncate does, without ellipsis.
+func (t *Tiktoken) TruncateMiddle(text string, maxTokens int, ellipsis string, opts ...TruncateOption) (string, int) {
+	return TruncateMiddle(t, text, maxTokens, ellipsis, opts...)
+}
+
+// TruncateMiddle is the TruncateMiddle method of *Tiktoken for any Codec,
+// see Truncate.
+func TruncateMiddle(enc Codec, text string, maxTokens int, ellipsis string, opts ...TruncateOption) (string, int) {
+	cfg := newTruncateConfig(opts)
+	tk, text := tokenizerOf(enc, text)
+	total := tk.countOrdinary(text)
+	if total <= maxTokens {
+		return text, total
+	}
+	ellipsisTokens := tk.countOrdinary(ellipsis)
+	if ellipsisTokens > maxTokens {
+		return truncateTail(tk, text, maxTokens, cfg)
+	}
+	budget := maxTokens - ellipsisTokens
+	for budget > 0 {
+		headBudget := int(float64(budget) * cfg.headRatio)
+		head, _ := truncateTail(tk, text, headBudget, cfg)
+		tail, _ := truncateHead(tk, text[len(head):], budget-headBudget, cfg)
+		// tokens can merge across the joins, so count the result as a whole
+		result := head + ellipsis + tail
+		count := tk.countOrdinary(result)
+		if count <= maxTokens {
+			return result, count
+		}
+		budget -= count - maxTokens
+	}
+	return ellipsis, ellipsisTokens
+}
+
+// cutAfter is like cutBefore but moves the offset forward.
+func (c truncateConfig) cutAfter(text string, n int) int {
+	for n > 0 && n < len(text) && !utf8.RuneStart(text[n]) {
+		n++
+	}
+	if c.graphemeSafe {
+		n = graphemeBoundaryAfter(text, n)
+	}
+	return n
+}
+
+// cutBefore moves the byte offset n back to the nearest rune boundary, or
+// grapheme cluster boundary if configured.
+func (c truncateConfig) cutBefore(text string, n int) int {
+	for n > 0 && n < len(text) && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	if c.graphemeSafe {
+		n = graphemeBoundaryBefore(text, n)
+	}
+	return n
+}
+
+// graphemeBoundaryBefore returns the largest grapheme cluster boundary of text
+// that is not after n.
+func graphemeBoundaryBefore(text string, n int) int {
+	pos, state := 0, -1
+	rest := text
+	for len(rest) > 0 {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		if pos+len(cluster) > n {
+			break
+		}
+		pos += len(cluster)
+	}
+	return pos
+}
+
+// graphemeBoundaryAfter returns the smallest grapheme cluster boundary of
+// text that is not before n.
+func graphemeBoundaryAfter(text string, n int) int {
+	pos, state := 0, -1
+	rest := text
+	for len(rest) > 0 && pos < n {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		pos += len(cluster)
+	}
+	return pos
+}
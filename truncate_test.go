@@ -0,0 +1,214 @@
+package tiktoken
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"github.com/stretchr/testify/assert"
+)
+
+func graphemeBoundaries(text string) map[int]bool {
+	boundaries := map[int]bool{0: true}
+	pos, state := 0, -1
+	for rest := text; len(rest) > 0; {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		pos += len(cluster)
+		boundaries[pos] = true
+	}
+	return boundaries
+}
+
+func TestTruncate(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world!你好，世界！"
+	got, n := enc.Truncate(text, 100)
+	ass.Equal(text, got)
+	ass.Equal(7, n)
+	got, n = enc.Truncate(text, 2)
+	ass.Equal("hello world", got)
+	ass.Equal(2, n)
+	got, n = enc.Truncate(text, 0)
+	ass.Equal("", got)
+	ass.Equal(0, n)
+
+	for max := 0; max <= enc.CountTokens(multilingualText); max++ {
+		got, n := enc.Truncate(multilingualText, max)
+		ass.True(strings.HasPrefix(multilingualText, got))
+		ass.True(utf8.ValidString(got))
+		ass.LessOrEqual(n, max)
+		ass.Equal(enc.CountTokens(got), n)
+	}
+}
+
+func TestTruncateInvalidUTF8(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	// invalid bytes encode as U+FFFD, which is longer than they are
+	for _, text := range []string{"\xff\xff\xff\xff hello world", "a\xffb", "123\x80\n", "\xe4\xbd\n", "你好\xe4\xbd 世界\xff\xfe"} {
+		for max := 0; max <= enc.CountTokens(text); max++ {
+			got, n := enc.Truncate(text, max)
+			ass.True(strings.HasPrefix(text, got), "%q", text)
+			ass.LessOrEqual(n, max, "%q", text)
+			ass.Equal(enc.CountTokens(got), n, "%q", text)
+
+			got, n = enc.TruncateHead(text, max)
+			ass.True(strings.HasSuffix(text, got), "%q", text)
+			ass.LessOrEqual(n, max, "%q", text)
+			ass.Equal(enc.CountTokens(got), n, "%q", text)
+		}
+	}
+}
+
+func TestTruncateGraphemeSafety(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	cases := map[string]string{
+		"zwj family":  "family: \U0001F468\u200d\U0001F469\u200d\U0001F467\u200d\U0001F466 and \U0001F44D\U0001F3FD done",
+		"combining":   "cafe\u0301 re\u0301sume\u0301 nai\u0308ve",
+		"hangul jamo": "\u1100\u1161\u11a8\u1102\u1161 \u1112\u1161\u11ab\u1100\u1173\u11af",
+	}
+	for name, text := range cases {
+		boundaries := graphemeBoundaries(text)
+		splitsCluster := false
+		for max := 0; max <= enc.CountTokens(text); max++ {
+			got, n := enc.Truncate(text, max, WithGraphemeSafety(true))
+			ass.True(strings.HasPrefix(text, got), name)
+			ass.True(boundaries[len(got)], "%s: %q ends inside a grapheme cluster", name, got)
+			ass.LessOrEqual(n, max, name)
+			ass.Equal(enc.CountTokens(got), n, name)
+
+			unsafe, _ := enc.Truncate(text, max)
+			if !boundaries[len(unsafe)] {
+				splitsCluster = true
+			}
+		}
+		ass.True(splitsCluster, "%s: plain truncation never splits a cluster, the case tests nothing", name)
+	}
+}
+
+func TestTruncateHead(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world!你好，世界！"
+	got, n := enc.TruncateHead(text, 100)
+	ass.Equal(text, got)
+	ass.Equal(7, n)
+	got, n = enc.TruncateHead(text, 2)
+	ass.Equal("世界！", got)
+	ass.Equal(2, n)
+	got, n = enc.TruncateHead(text, 0)
+	ass.Equal("", got)
+	ass.Equal(0, n)
+
+	// inputs where cutting changes how the remaining text is split
+	adversarial := []string{
+		multilingualText,
+		"a" + strings.Repeat(" ", 17) + "b" + strings.Repeat("\n", 5) + "c",
+		"1234567890 9876543210",
+		"it's they'll we'd 's'll'd",
+		strings.Repeat("!?", 20) + "...!!!",
+		strings.Repeat("ab", 50),
+		"\U0001F468\u200d\U0001F469\u200d\U0001F467 4\u20e3 cafe\u0301",
+	}
+	for _, text := range adversarial {
+		boundaries := graphemeBoundaries(text)
+		for max := 0; max <= enc.CountTokens(text); max++ {
+			for _, safe := range []bool{false, true} {
+				got, n := enc.TruncateHead(text, max, WithGraphemeSafety(safe))
+				ass.True(strings.HasSuffix(text, got), "%q", text)
+				ass.True(utf8.ValidString(got))
+				ass.LessOrEqual(n, max, "%q", text)
+				ass.Equal(enc.CountTokens(got), n, "%q", text)
+				if safe {
+					ass.True(boundaries[len(text)-len(got)], "%q starts inside a grapheme cluster", got)
+				}
+			}
+		}
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	text := "hello world!你好，世界！"
+	got, n := enc.TruncateMiddle(text, 100, "...")
+	ass.Equal(text, got)
+	ass.Equal(7, n)
+	got, n = enc.TruncateMiddle(text, 5, "...")
+	ass.Equal("hello world...世界！", got)
+	ass.Equal(5, n)
+	got, n = enc.TruncateMiddle(text, 5, "...", WithHeadRatio(1))
+	ass.Equal("hello world!你好...", got)
+	ass.Equal(5, n)
+
+	// too small for the ellipsis
+	got, n = enc.TruncateMiddle(text, 1, " [many tokens elided] ")
+	ass.Equal("hello", got)
+	ass.Equal(1, n)
+	got, n = enc.TruncateMiddle(text, 0, "...")
+	ass.Equal("", got)
+	ass.Equal(0, n)
+
+	for _, ellipsis := range []string{"...", " ", "\n[...]\n", "…"} {
+		for max := 0; max <= enc.CountTokens(multilingualText); max++ {
+			got, n := enc.TruncateMiddle(multilingualText, max, ellipsis, WithGraphemeSafety(true))
+			ass.True(utf8.ValidString(got))
+			ass.LessOrEqual(n, max)
+			ass.Equal(enc.CountTokens(got), n)
+			if strings.Contains(multilingualText, ellipsis) {
+				continue
+			}
+			if i := strings.Index(got, ellipsis); i >= 0 {
+				ass.True(strings.HasPrefix(multilingualText, got[:i]))
+				ass.True(strings.HasSuffix(multilingualText, got[i+len(ellipsis):]))
+			}
+		}
+	}
+}
+
+func TestTruncateAtSeparator(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	sep := "\n###\n"
+	units := []string{"Q: hello\nA: world" + sep, "Q: 你好\nA: 世界" + sep, "Q: bye\nA: now" + sep}
+	text := strings.Join(units, "")
+	got, n := enc.TruncateAtSeparator(text, 1000, sep)
+	ass.Equal(text, got)
+	ass.Equal(enc.CountTokens(text), n)
+
+	for max := 0; max <= enc.CountTokens(text); max++ {
+		got, n := enc.TruncateAtSeparator(text, max, sep)
+		ass.LessOrEqual(n, max)
+		ass.Equal(enc.CountTokens(got), n)
+		// the longest whole number of units that fits
+		want := ""
+		for i := range units {
+			if prefix := strings.Join(units[:i+1], ""); enc.CountTokens(prefix) <= max {
+				want = prefix
+			}
+		}
+		ass.Equal(want, got, "max %d", max)
+	}
+
+	got, n = enc.TruncateAtSeparator("no separator here at all", 3, sep)
+	ass.Equal("", got)
+	ass.Zero(n)
+	got, _ = enc.TruncateAtSeparator(text, 2, "")
+	ass.Equal("Q:", got)
+}
@@ -0,0 +1,209 @@
+package tiktoken
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// unicodeSplitter is asciiSplitter for any valid UTF-8 text: it splits text
+// into exactly the pieces one of the known split patterns produces, rune
+// by rune. rules describe the pattern as for asciiSplitter, with \p{L},
+// \p{N} and \s standing for the Unicode classes the regex engine uses.
+// o200k additionally needs:
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|...)?|
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|...)?|
+//	...| ?[^\s\p{L}\p{N}]+[\r\n/]*|...
+type unicodeSplitter struct {
+	rules *asciiSplitter
+	// casedWords replaces the contraction and letter branches with the two
+	// case-aware word branches of o200k.
+	casedWords bool
+	// slashes lets / follow the newlines after punctuation.
+	slashes bool
+}
+
+var unicodeSplitters = map[string]*unicodeSplitter{
+	cl100kPattern: {rules: asciiSplitters[cl100kPattern]},
+	qwenPattern:   {rules: asciiSplitters[qwenPattern]},
+	p50kPattern:   {rules: asciiSplitters[p50kPattern]},
+	testPattern:   {rules: asciiSplitters[testPattern]},
+	o200kPattern: {
+		rules:      &asciiSplitter{foldContractions: true, anyLetterPrefix: true, maxDigits: 3, digitsNoPrefix: true, newlines: true},
+		casedWords: true,
+		slashes:    true,
+	},
+}
+
+// isUpperish is [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}] and isLowerish
+// [\p{Ll}\p{Lm}\p{Lo}\p{M}].
+func isUpperish(r rune) bool {
+	return unicode.IsUpper(r) || unicode.IsTitle(r) || unicode.In(r, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+func isLowerish(r rune) bool {
+	return unicode.IsLower(r) || unicode.In(r, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isOther is [^\s\p{L}\p{N}].
+func isOther(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsSpace(r)
+}
+
+// isLetterPrefix is [^\r\n\p{L}\p{N}].
+func isLetterPrefix(r rune) bool {
+	return r != '\r' && r != '\n' && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// run returns the end of the runes from i on that satisfy in.
+func run(text string, i int, in func(rune) bool) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !in(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// split calls fn with every piece of text, which must be valid UTF-8.
+func (u *unicodeSplitter) split(text string, fn func(piece string)) {
+	for i := 0; i < len(text); {
+		end := u.next(text, i)
+		fn(text[i:end])
+		i = end
+	}
+}
+
+// next returns the end of the piece starting at i, trying the branches of
+// the pattern in order.
+func (u *unicodeSplitter) next(text string, i int) int {
+	a := u.rules
+	n := len(text)
+	c, size := utf8.DecodeRuneInString(text[i:])
+
+	if u.casedWords {
+		if end, ok := u.casedWord(text, i); ok {
+			return end
+		}
+	} else {
+		if c == '\'' {
+			if l := a.contraction(text[i+1:]); l > 0 {
+				return i + 1 + l
+			}
+		}
+		j := i
+		if a.anyLetterPrefix {
+			if isLetterPrefix(c) {
+				j += size
+			}
+		} else if c == ' ' {
+			j++
+		}
+		if end := run(text, j, unicode.IsLetter); end > j {
+			return end
+		}
+	}
+
+	j := i
+	if c == ' ' && !a.digitsNoPrefix {
+		j++
+	}
+	if r, _ := utf8.DecodeRuneInString(text[j:]); j < n && unicode.IsNumber(r) {
+		for digits := 0; j < n && (a.maxDigits == 0 || digits < a.maxDigits); digits++ {
+			r, size := utf8.DecodeRuneInString(text[j:])
+			if !unicode.IsNumber(r) {
+				break
+			}
+			j += size
+		}
+		return j
+	}
+
+	j = i
+	if c == ' ' {
+		j++
+	}
+	if end := run(text, j, isOther); end > j {
+		j = end
+		for a.newlines && j < n && (text[j] == '\r' || text[j] == '\n' || (u.slashes && text[j] == '/')) {
+			j++
+		}
+		return j
+	}
+
+	// c is whitespace
+	j = run(text, i, unicode.IsSpace)
+	if j == i {
+		return i + size
+	}
+	if a.newlines {
+		for k := j - 1; k >= i; k-- {
+			if text[k] == '\r' || text[k] == '\n' {
+				return k + 1
+			}
+		}
+	}
+	if _, last := utf8.DecodeLastRuneInString(text[i:j]); j < n && j-last > i {
+		// \s+(?!\S) leaves the last space to the next piece
+		return j - last
+	}
+	return j
+}
+
+// casedWord tries the two word branches of o200k at i, each with and then
+// without the optional prefix, as the regex engine backtracks.
+func (u *unicodeSplitter) casedWord(text string, i int) (int, bool) {
+	c, size := utf8.DecodeRuneInString(text[i:])
+	starts := []int{i}
+	if isLetterPrefix(c) {
+		starts = []int{i + size, i}
+	}
+	for _, start := range starts {
+		if end, ok := u.lowerWord(text, start); ok {
+			return end, true
+		}
+	}
+	for _, start := range starts {
+		if k := run(text, start, isUpperish); k > start {
+			return u.withContraction(text, run(text, k, isLowerish)), true
+		}
+	}
+	return 0, false
+}
+
+// lowerWord is [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+
+// at start. The first class is matched as far as it goes and given back
+// until the second one matches: the second class either goes on after
+// the first one or starts at its last rune that is in both.
+func (u *unicodeSplitter) lowerWord(text string, start int) (int, bool) {
+	k, both := start, -1
+	for k < len(text) {
+		r, size := utf8.DecodeRuneInString(text[k:])
+		if !isUpperish(r) {
+			break
+		}
+		k += size
+		if isLowerish(r) {
+			both = k
+		}
+	}
+	if end := run(text, k, isLowerish); end > k {
+		return u.withContraction(text, end), true
+	}
+	if both >= 0 {
+		return u.withContraction(text, both), true
+	}
+	return 0, false
+}
+
+// withContraction extends a word ending at end by a contraction suffix.
+func (u *unicodeSplitter) withContraction(text string, end int) int {
+	if end < len(text) && text[end] == '\'' {
+		if l := u.rules.contraction(text[end+1:]); l > 0 {
+			return end + 1 + l
+		}
+	}
+	return end
+}
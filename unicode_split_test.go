@@ -0,0 +1,103 @@
+package tiktoken
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/dlclark/regexp2"
+	"github.com/stretchr/testify/assert"
+)
+
+// regexRunePieces is regexPieces for text that isn't ASCII: the regex
+// engine reports matches in runes.
+func regexRunePieces(text string, re *regexp2.Regexp) []string {
+	runes := []rune(text)
+	pieces := []string{}
+	for _, mat := range findRegex2AllStringMatchIndex(text, re) {
+		pieces = append(pieces, string(runes[mat[0]:mat[1]]))
+	}
+	return pieces
+}
+
+func unicodePieces(text string, u *unicodeSplitter) []string {
+	pieces := []string{}
+	u.split(text, func(piece string) {
+		pieces = append(pieces, piece)
+	})
+	return pieces
+}
+
+// unicodeAlphabet holds a few runes of every class the patterns tell apart:
+// cased, modifier and other letters, titlecase digraphs, combining marks,
+// decimal and other numbers, Unicode white space and punctuation.
+var unicodeAlphabet = []rune("aAzZsStTéÉßǅʰ中あ́ि्²½Ⅻ٣  　 \u0085\t\n\r'’/!.，😀‍")
+
+func randomUnicode(r *rand.Rand, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if r.Intn(4) == 0 {
+			b.WriteByte(byte(r.Intn(128)))
+		} else {
+			b.WriteRune(unicodeAlphabet[r.Intn(len(unicodeAlphabet))])
+		}
+	}
+	return b.String()
+}
+
+func TestUnicodeSplitterMatchesRegex(t *testing.T) {
+	ass := assert.New(t)
+	r := rand.New(rand.NewSource(1))
+	corpus := []string{"", "hello world!你好，世界！", "こんにちは世界！", "Привет мир! It'S", "don't HTTPServer's/path/\n", "été ǅungla", "́x ́ ʰʰʰa", "１２３４ ²³ ⅫⅫ　　word", "a  b  \n c"}
+	for pattern, splitter := range unicodeSplitters {
+		re := regexp2.MustCompile(pattern, regexp2.None)
+		for _, text := range corpus {
+			ass.Equal(regexRunePieces(text, re), unicodePieces(text, splitter), "%q", text)
+		}
+		for i := 0; i < 3000; i++ {
+			text := randomUnicode(r, r.Intn(30))
+			ass.Equal(regexRunePieces(text, re), unicodePieces(text, splitter), "%q", text)
+		}
+	}
+}
+
+func TestWithScannerSplit(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	scanned := enc.WithOptions(WithScannerSplit(true))
+	ass.NotNil(scanned.bpe.unicodeSplitter)
+	ass.Nil(enc.bpe.unicodeSplitter)
+	ass.Nil(scanned.WithOptions(WithScannerSplit(false)).bpe.unicodeSplitter)
+
+	r := rand.New(rand.NewSource(2))
+	texts := []string{"hello world!你好，世界！", "\xffinvalid 你好", parallelText(20 << 10)}
+	for i := 0; i < 200; i++ {
+		texts = append(texts, randomUnicode(r, r.Intn(60)))
+	}
+	for _, text := range texts {
+		ass.Equal(enc.Encode(text, nil, nil), scanned.Encode(text, nil, nil), "%q", text)
+	}
+
+	custom, err := NewCoreBPE(map[string]int{"a": 0, "b": 1}, nil, `\w`)
+	ass.Nil(err)
+	tk := NewTiktoken(custom, &Encoding{Name: "custom", PatStr: `\w`}, nil).WithOptions(WithScannerSplit(true))
+	ass.Nil(tk.bpe.unicodeSplitter, "patterns without a scanner keep the regex")
+}
+
+func BenchmarkUnicodeSplit(b *testing.B) {
+	text := parallelText(1 << 20)
+	b.SetBytes(int64(len(text)))
+	b.Run("scanner", func(b *testing.B) {
+		splitter := unicodeSplitters[cl100kPattern]
+		for i := 0; i < b.N; i++ {
+			splitter.split(text, func(string) {})
+		}
+	})
+	b.Run("regex", func(b *testing.B) {
+		re := regexp2.MustCompile(cl100kPattern, regexp2.None)
+		for i := 0; i < b.N; i++ {
+			findRegex2AllStringMatchIndex(text, re)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package tiktoken
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// modulePath is the path of this module in build info.
+const modulePath = "github.com/pkoukk/tiktoken-go"
+
+// develVersion is the version of builds without module information, such
+// as the tests of this package or a GOPATH build.
+const develVersion = "(devel)"
+
+var versionOnce struct {
+	sync.Once
+	v string
+}
+
+// Version returns the version of this module the program was built with,
+// such as v0.1.7, or "(devel)" if the build has no module information for
+// it. A replaced module reports the version it was replaced with, and
+// "(devel)" if replaced with a local directory.
+func Version() string {
+	versionOnce.Do(func() {
+		versionOnce.v = moduleVersion(debug.ReadBuildInfo())
+	})
+	return versionOnce.v
+}
+
+func moduleVersion(info *debug.BuildInfo, ok bool) string {
+	if !ok {
+		return develVersion
+	}
+	mods := append([]*debug.Module{&info.Main}, info.Deps...)
+	for _, m := range mods {
+		if m.Path != modulePath {
+			continue
+		}
+		if m.Replace != nil {
+			m = m.Replace
+		}
+		if m.Version == "" {
+			return develVersion
+		}
+		return m.Version
+	}
+	return develVersion
+}
+
+// UserAgent returns the User-Agent the default loader sends when it
+// downloads rank files, tiktoken-go/ followed by Version. WithUserAgent
+// replaces it; to extend it, pass your own product first:
+//
+//	tiktoken.WithUserAgent("myapp/1.2 " + tiktoken.UserAgent())
+func UserAgent() string {
+	return "tiktoken-go/" + Version()
+}
@@ -0,0 +1,27 @@
+package tiktoken
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal(develVersion, Version())
+	ass.Equal("tiktoken-go/"+develVersion, UserAgent())
+
+	ass.Equal(develVersion, moduleVersion(nil, false))
+	ass.Equal(develVersion, moduleVersion(&debug.BuildInfo{Main: debug.Module{Path: "example.com/app", Version: "v1.0.0"}}, true))
+	ass.Equal("v0.1.7", moduleVersion(&debug.BuildInfo{
+		Main: debug.Module{Path: "example.com/app", Version: "(devel)"},
+		Deps: []*debug.Module{{Path: "github.com/google/uuid", Version: "v1.3.0"}, {Path: modulePath, Version: "v0.1.7"}},
+	}, true))
+	ass.Equal("v0.1.8-fork", moduleVersion(&debug.BuildInfo{
+		Deps: []*debug.Module{{Path: modulePath, Version: "v0.1.7", Replace: &debug.Module{Path: "example.com/fork", Version: "v0.1.8-fork"}}},
+	}, true))
+	ass.Equal(develVersion, moduleVersion(&debug.BuildInfo{
+		Deps: []*debug.Module{{Path: modulePath, Version: "v0.1.7", Replace: &debug.Module{Path: "../tiktoken-go"}}},
+	}, true))
+}
@@ -0,0 +1,423 @@
+package tiktoken
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VocabEntry is a single token of a vocabulary together with its rank.
+type VocabEntry struct {
+	Token []byte
+	Rank  int
+}
+
+// RankChange describes a token present in both vocabularies under different ranks.
+type RankChange struct {
+	Token []byte
+	RankA int
+	RankB int
+}
+
+// VocabDiff is the result of DiffVocabs. OnlyInA and OnlyInB are sorted by
+// rank, Changed is sorted by the token bytes.
+type VocabDiff struct {
+	OnlyInA []VocabEntry
+	OnlyInB []VocabEntry
+	Changed []RankChange
+}
+
+// DiffVocabs compares two rank tables.
+func DiffVocabs(a, b map[string]int) VocabDiff {
+	diff := VocabDiff{
+		OnlyInA: []VocabEntry{},
+		OnlyInB: []VocabEntry{},
+		Changed: []RankChange{},
+	}
+	for token, rankA := range a {
+		rankB, ok := b[token]
+		if !ok {
+			diff.OnlyInA = append(diff.OnlyInA, VocabEntry{Token: []byte(token), Rank: rankA})
+		} else if rankA != rankB {
+			diff.Changed = append(diff.Changed, RankChange{Token: []byte(token), RankA: rankA, RankB: rankB})
+		}
+	}
+	for token, rankB := range b {
+		if _, ok := a[token]; !ok {
+			diff.OnlyInB = append(diff.OnlyInB, VocabEntry{Token: []byte(token), Rank: rankB})
+		}
+	}
+
+	sortEntries(diff.OnlyInA)
+	sortEntries(diff.OnlyInB)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return bytes.Compare(diff.Changed[i].Token, diff.Changed[j].Token) < 0
+	})
+	return diff
+}
+
+// DiffVocab compares the full vocabulary of t, special tokens included, with other's.
+func (t *Tiktoken) DiffVocab(other *Tiktoken) VocabDiff {
+	return DiffVocabs(t.fullVocab(), other.fullVocab())
+}
+
+func (t *Tiktoken) fullVocab() map[string]int {
+	t.bpe.mustOpen()
+	vocab := make(map[string]int, len(t.pbeEncoding.MergeableRanks)+len(t.pbeEncoding.SpecialTokens))
+	for k, v := range t.pbeEncoding.MergeableRanks {
+		vocab[k] = v
+	}
+	for k, v := range t.pbeEncoding.SpecialTokens {
+		vocab[k] = v
+	}
+	return vocab
+}
+
+func sortEntries(entries []VocabEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Rank != entries[j].Rank {
+			return entries[i].Rank < entries[j].Rank
+		}
+		return bytes.Compare(entries[i].Token, entries[j].Token) < 0
+	})
+}
+
+// sortedVocab returns the entries of ranks in rank order.
+func sortedVocab(ranks map[string]int) []VocabEntry {
+	entries := make([]VocabEntry, 0, len(ranks))
+	for token, rank := range ranks {
+		entries = append(entries, VocabEntry{Token: []byte(token), Rank: rank})
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// VocabIter calls fn with every mergeable token of t in rank order until fn
+// returns false. Special tokens are visited by SpecialTokenIter.
+func (t *Tiktoken) VocabIter(fn func(id int, token []byte) bool) {
+	t.bpe.mustOpen()
+	for _, e := range sortedVocab(t.bpe.encoder) {
+		if !fn(e.Rank, e.Token) {
+			return
+		}
+	}
+}
+
+// SpecialTokenIter calls fn with every special token of t in id order until
+// fn returns false.
+func (t *Tiktoken) SpecialTokenIter(fn func(id int, token []byte) bool) {
+	t.bpe.mustOpen()
+	for _, e := range sortedVocab(t.bpe.specialTokensEncoder) {
+		if !fn(e.Rank, e.Token) {
+			return
+		}
+	}
+}
+
+// Rank returns the rank, that is the token id, of the mergeable token
+// piece, and false if piece isn't one. Special tokens are looked up by
+// SpecialRank. Neither allocates.
+func (t *Tiktoken) Rank(piece []byte) (int, bool) {
+	t.bpe.mustOpen()
+	rank, ok := t.bpe.encoder[string(piece)]
+	return rank, ok
+}
+
+// SpecialRank returns the id of the special token piece, and false if
+// piece isn't one.
+func (t *Tiktoken) SpecialRank(piece []byte) (int, bool) {
+	t.bpe.mustOpen()
+	id, ok := t.bpe.specialTokensEncoder[string(piece)]
+	return id, ok
+}
+
+// HasToken reports whether piece is a mergeable or a special token of t.
+func (t *Tiktoken) HasToken(piece []byte) bool {
+	if _, ok := t.Rank(piece); ok {
+		return true
+	}
+	_, ok := t.SpecialRank(piece)
+	return ok
+}
+
+// ExportVocab writes the vocabulary of t to w in one of these formats:
+//
+//   - "tiktoken": the rank file format read by the loaders, one
+//     "<base64 token> <rank>" line per mergeable token. Special tokens are
+//     not part of rank files and are left out.
+//   - "tsv": a header line, then "<id>\t<base64 token>\t<kind>" lines where
+//     kind is "ordinary" or "special", special tokens last.
+//   - "json": an object with everything needed to rebuild the encoding,
+//     for other languages and for audits: name, pattern, the ContentHash
+//     of the ranks, the explicit vocabulary size if any, the ranks as
+//     {"token": "<hex bytes>", "rank": n} in rank order and the special
+//     tokens.
+//
+// ImportVocab reads all three back.
+func (t *Tiktoken) ExportVocab(w io.Writer, format string) error {
+	if t.isClosed() {
+		return ErrClosed
+	}
+	bw := bufio.NewWriter(w)
+	switch format {
+	case "tiktoken":
+		writeRanks(bw, sortedVocab(t.bpe.encoder))
+	case "tsv":
+		bw.WriteString("id\ttoken\tkind\n")
+		writeTSV(bw, sortedVocab(t.bpe.encoder), "ordinary")
+		writeTSV(bw, sortedVocab(t.bpe.specialTokensEncoder), "special")
+	case "json":
+		if err := t.writeVocabJSON(bw); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown vocabulary format %q", format)
+	}
+	return bw.Flush()
+}
+
+func writeRanks(w io.Writer, entries []VocabEntry) {
+	line := make([]byte, 0, 64)
+	for _, e := range entries {
+		line = append(line[:0], base64.StdEncoding.EncodeToString(e.Token)...)
+		line = append(line, ' ')
+		line = strconv.AppendInt(line, int64(e.Rank), 10)
+		line = append(line, '\n')
+		w.Write(line)
+	}
+}
+
+func writeTSV(w io.Writer, entries []VocabEntry, kind string) {
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", e.Rank, base64.StdEncoding.EncodeToString(e.Token), kind)
+	}
+}
+
+// vocabJSON is the "json" format of ExportVocab.
+type vocabJSON struct {
+	Name           string          `json:"name"`
+	Pattern        string          `json:"pattern"`
+	ContentHash    string          `json:"content_hash"`
+	ExplicitNVocab int             `json:"explicit_n_vocab,omitempty"`
+	Ranks          []vocabJSONRank `json:"ranks"`
+	SpecialTokens  map[string]int  `json:"special_tokens"`
+}
+
+type vocabJSONRank struct {
+	Token string `json:"token"`
+	Rank  int    `json:"rank"`
+}
+
+func (t *Tiktoken) writeVocabJSON(w io.Writer) error {
+	entries := sortedVocab(t.bpe.encoder)
+	v := vocabJSON{
+		Name:          t.Name(),
+		Pattern:       t.bpe.tlRegex.String(),
+		ContentHash:   t.ContentHash(),
+		Ranks:         make([]vocabJSONRank, len(entries)),
+		SpecialTokens: t.SpecialTokens(),
+	}
+	if t.pbeEncoding != nil {
+		v.ExplicitNVocab = t.pbeEncoding.ExplicitNVocab
+	}
+	for i, e := range entries {
+		v.Ranks[i] = vocabJSONRank{Token: hex.EncodeToString(e.Token), Rank: e.Rank}
+	}
+	return json.NewEncoder(w).Encode(v)
+}
+
+// ImportVocab reads a vocabulary written by ExportVocab in format, within
+// DefaultParseLimits. For "json" the result is the complete encoding,
+// after checking the ranks against the content hash. The "tiktoken" and
+// "tsv" formats have no pattern or name, so set PatStr and Name before
+// building an encoding of the result, e.g. in a RegisterEncoding
+// constructor; "tiktoken" has no special tokens either.
+func ImportVocab(r io.Reader, format string) (*Encoding, error) {
+	limits := DefaultParseLimits
+	contents, err := readAllLimited(r, limits.MaxFileBytes)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "tiktoken":
+		ranks, err := parseTiktokenBpeLimits(contents, limits)
+		if err != nil {
+			return nil, err
+		}
+		return &Encoding{MergeableRanks: ranks, SpecialTokens: map[string]int{}}, nil
+	case "tsv":
+		return readVocabTSV(contents, limits)
+	case "json":
+		return readVocabJSON(contents, limits)
+	}
+	return nil, fmt.Errorf("unknown vocabulary format %q", format)
+}
+
+func readVocabTSV(contents []byte, limits ParseLimits) (*Encoding, error) {
+	enc := &Encoding{MergeableRanks: map[string]int{}, SpecialTokens: map[string]int{}}
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	if lines[0] != "id\ttoken\tkind" {
+		return nil, fmt.Errorf("vocabulary: missing header line")
+	}
+	for i, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("vocabulary line %d: want 3 fields, got %d", i+2, len(fields))
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("vocabulary line %d: %w", i+2, err)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("vocabulary line %d: %w", i+2, err)
+		}
+		var dst map[string]int
+		switch fields[2] {
+		case "ordinary":
+			dst = enc.MergeableRanks
+		case "special":
+			dst = enc.SpecialTokens
+		default:
+			return nil, fmt.Errorf("vocabulary line %d: unknown kind %q", i+2, fields[2])
+		}
+		if err := addVocabEntry(dst, token, id, limits); err != nil {
+			return nil, fmt.Errorf("vocabulary line %d: %w", i+2, err)
+		}
+	}
+	return enc, nil
+}
+
+func readVocabJSON(contents []byte, limits ParseLimits) (*Encoding, error) {
+	var v vocabJSON
+	if err := json.Unmarshal(contents, &v); err != nil {
+		return nil, fmt.Errorf("vocabulary: %w", err)
+	}
+	enc := &Encoding{
+		Name:           v.Name,
+		PatStr:         v.Pattern,
+		MergeableRanks: make(map[string]int, len(v.Ranks)),
+		SpecialTokens:  v.SpecialTokens,
+		ExplicitNVocab: v.ExplicitNVocab,
+	}
+	if enc.SpecialTokens == nil {
+		enc.SpecialTokens = map[string]int{}
+	}
+	for i, rank := range v.Ranks {
+		token, err := hex.DecodeString(rank.Token)
+		if err != nil {
+			return nil, fmt.Errorf("vocabulary entry %d: %w", i, err)
+		}
+		if err := addVocabEntry(enc.MergeableRanks, token, rank.Rank, limits); err != nil {
+			return nil, fmt.Errorf("vocabulary entry %d: %w", i, err)
+		}
+	}
+	if v.ContentHash != "" {
+		if got := rankFileHash(enc.MergeableRanks); got != v.ContentHash {
+			return nil, fmt.Errorf("%w: vocabulary %s: got %s, want %s", ErrHashMismatch, v.Name, got, v.ContentHash)
+		}
+	}
+	return enc, nil
+}
+
+// addVocabEntry adds token to dst within limits, failing for a token that
+// is already there.
+func addVocabEntry(dst map[string]int, token []byte, id int, limits ParseLimits) error {
+	if len(token) > limits.MaxTokenBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrTokenTooLong, limits.MaxTokenBytes)
+	}
+	if len(dst) >= limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d", ErrTooManyRanks, limits.MaxEntries)
+	}
+	if _, ok := dst[string(token)]; ok {
+		return fmt.Errorf("duplicate token %q", token)
+	}
+	dst[string(token)] = id
+	return nil
+}
+
+// MatchMode selects how FindTokens compares the query with token bytes.
+type MatchMode int
+
+const (
+	// MatchPrefix finds tokens starting with the query.
+	MatchPrefix MatchMode = iota
+	// MatchContains finds tokens containing the query anywhere.
+	MatchContains
+	// MatchExact finds the tokens equal to the query.
+	MatchExact
+)
+
+func (m MatchMode) String() string {
+	switch m {
+	case MatchPrefix:
+		return "prefix"
+	case MatchContains:
+		return "contains"
+	case MatchExact:
+		return "exact"
+	}
+	return fmt.Sprintf("MatchMode(%d)", int(m))
+}
+
+// TokenMatch is a token found by FindTokens.
+type TokenMatch struct {
+	Token     int
+	Bytes     []byte
+	IsSpecial bool
+}
+
+// FindTokens returns the tokens of t, special tokens included, whose bytes
+// match query, in rank order. It helps building logit_bias maps, e.g. with
+// every token spelling a word with and without a leading space. Prefix
+// matches use the sorted token index; MatchContains scans the decoder table.
+func (t *Tiktoken) FindTokens(query []byte, mode MatchMode) []TokenMatch {
+	t.bpe.mustOpen()
+	bp := t.bpe
+	matches := []TokenMatch{}
+	add := func(token int, b []byte) {
+		_, special := bp.specialTokensEncoder[string(b)]
+		matches = append(matches, TokenMatch{token, append([]byte(nil), b...), special})
+	}
+	switch mode {
+	case MatchExact:
+		if token, ok := bp.encoder[string(query)]; ok {
+			add(token, query)
+		}
+		if token, ok := bp.specialTokensEncoder[string(query)]; ok {
+			add(token, query)
+		}
+	case MatchPrefix:
+		tables := bp.tables
+		i := sort.Search(tables.len(), func(i int) bool { return bytes.Compare(tables.sorted(i), query) >= 0 })
+		for ; i < tables.len() && bytes.HasPrefix(tables.sorted(i), query); i++ {
+			add(bp.encoder[string(tables.sorted(i))], tables.sorted(i))
+		}
+		// the sorted tokens are the mergeable ones only
+		for token, id := range bp.specialTokensEncoder {
+			if strings.HasPrefix(token, string(query)) {
+				add(id, []byte(token))
+			}
+		}
+	case MatchContains:
+		for i := 0; i < bp.tables.len(); i++ {
+			if b := bp.tables.sorted(i); bytes.Contains(b, query) {
+				add(bp.encoder[string(b)], b)
+			}
+		}
+		for token, b := range bp.specialTokenBytes {
+			if !bp.tables.hasRank(token) && bytes.Contains(b, query) {
+				add(token, b)
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Token < matches[j].Token })
+	return matches
+}
@@ -0,0 +1,123 @@
+package tiktoken
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultVocabCacheSize is the byte budget of the in-memory cache of rank
+// files, enough for the OpenAI encodings.
+const DefaultVocabCacheSize = 32 << 20
+
+// vocabCacheEntry is a rank file held in memory under the path of its disk
+// cache entry, with the file it was read from as it was then.
+type vocabCacheEntry struct {
+	key      string
+	contents []byte
+	path     string
+	size     int64
+	modTime  time.Time
+}
+
+// vocabCache keeps the most recently read entries of the disk cache in
+// memory, up to limit bytes, so building encodings again, e.g. after Close
+// or in every test of a package, doesn't read the file again. An entry is
+// only served while its file is unchanged on disk, which costs a stat. The
+// front of order is the most recently used entry.
+var vocabCache = struct {
+	sync.Mutex
+	limit, size int64
+	order       *list.List
+	entries     map[string]*list.Element
+}{limit: DefaultVocabCacheSize, order: list.New(), entries: map[string]*list.Element{}}
+
+// SetVocabCacheSize sets the byte budget of the in-memory cache the default
+// loader keeps in front of the cache directory, DefaultVocabCacheSize
+// unless set. When the rank files read exceed it, the least recently used
+// are evicted; files larger than the budget are not kept. A size of zero
+// or less turns the cache off and releases what it holds.
+func SetVocabCacheSize(bytes int64) {
+	vocabCache.Lock()
+	defer vocabCache.Unlock()
+	if bytes < 0 {
+		bytes = 0
+	}
+	vocabCache.limit = bytes
+	evictVocab()
+}
+
+// cachedVocab returns the contents of the cache entry at key if they are in
+// memory and the file they were read from is unchanged, and marks them used.
+func cachedVocab(key string) ([]byte, bool) {
+	vocabCache.Lock()
+	e, ok := vocabCache.entries[key]
+	if !ok {
+		vocabCache.Unlock()
+		return nil, false
+	}
+	vocabCache.order.MoveToFront(e)
+	entry := *e.Value.(*vocabCacheEntry)
+	vocabCache.Unlock()
+
+	fi, err := os.Stat(entry.path)
+	if err != nil || fi.Size() != entry.size || !fi.ModTime().Equal(entry.modTime) {
+		forgetVocab(key)
+		return nil, false
+	}
+	return entry.contents, true
+}
+
+// keepVocab holds contents, which must not be modified afterwards, as the
+// cache entry at key, read from the file at path.
+func keepVocab(key, path string, contents []byte) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	entry := &vocabCacheEntry{key: key, contents: contents, path: path, size: fi.Size(), modTime: fi.ModTime()}
+	vocabCache.Lock()
+	defer vocabCache.Unlock()
+	removeVocab(key)
+	if int64(len(contents)) > vocabCache.limit {
+		return
+	}
+	vocabCache.entries[key] = vocabCache.order.PushFront(entry)
+	vocabCache.size += int64(len(contents))
+	evictVocab()
+}
+
+// forgetVocab drops the cache entry at key from memory, for when it is
+// removed or replaced on disk.
+func forgetVocab(key string) {
+	vocabCache.Lock()
+	defer vocabCache.Unlock()
+	removeVocab(key)
+}
+
+// forgetAllVocab empties the in-memory cache.
+func forgetAllVocab() {
+	vocabCache.Lock()
+	defer vocabCache.Unlock()
+	vocabCache.order.Init()
+	vocabCache.entries = map[string]*list.Element{}
+	vocabCache.size = 0
+}
+
+// removeVocab drops key; vocabCache must be locked.
+func removeVocab(key string) {
+	if e, ok := vocabCache.entries[key]; ok {
+		vocabCache.order.Remove(e)
+		delete(vocabCache.entries, key)
+		vocabCache.size -= int64(len(e.Value.(*vocabCacheEntry).contents))
+	}
+}
+
+// evictVocab drops the least recently used entries until they fit the
+// limit; vocabCache must be locked.
+func evictVocab() {
+	for vocabCache.size > vocabCache.limit {
+		removeVocab(vocabCache.order.Back().Value.(*vocabCacheEntry).key)
+	}
+}
@@ -0,0 +1,76 @@
+package tiktoken
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVocabCache(t *testing.T) {
+	ass := assert.New(t)
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", filepath.Join(dir, "cache"))
+	rankFile := filepath.Join(dir, "test.tiktoken")
+	writeRankFile(t, rankFile, "a", "b")
+	loader := NewDefaultBpeLoader()
+
+	_, err := loader.LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	contents, ok := cachedVocab(cachePath(rankFile))
+	ass.True(ok)
+	ass.Equal("YQ== 0\nYg== 1\n", string(contents))
+
+	// a cache entry changed on disk is read again
+	ass.Nil(os.WriteFile(cachePath(rankFile), []byte("Yw== 0\n"), cacheFileMode))
+	ranks, err := loader.LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	ass.Equal(map[string]int{"c": 0}, ranks)
+
+	ass.Nil(loader.(CacheInvalidator).InvalidateCache(rankFile))
+	_, ok = cachedVocab(cachePath(rankFile))
+	ass.False(ok)
+	_, err = loader.LoadTiktokenBpe(rankFile)
+	ass.Nil(err)
+	ass.Nil(CacheClear())
+	_, ok = cachedVocab(cachePath(rankFile))
+	ass.False(ok)
+}
+
+func TestVocabCacheEviction(t *testing.T) {
+	ass := assert.New(t)
+	defer SetVocabCacheSize(DefaultVocabCacheSize)
+	dir := t.TempDir()
+	files := map[string]string{"a": "12345", "b": "123456", "c": "1234567", "big": "1234567890abcdef"}
+	for name, contents := range files {
+		ass.Nil(os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600))
+	}
+	keep := func(name string) {
+		keepVocab(name, filepath.Join(dir, name), []byte(files[name]))
+	}
+	cached := func(name string) bool {
+		_, ok := cachedVocab(name)
+		return ok
+	}
+
+	SetVocabCacheSize(12)
+	keep("a")
+	keep("b")
+	ass.True(cached("a"))
+	keep("c")
+	ass.True(cached("a"), "the most recently used entry is kept")
+	ass.False(cached("b"))
+	ass.True(cached("c"))
+	keep("big")
+	ass.False(cached("big"), "entries larger than the budget are not kept")
+	ass.True(cached("a"))
+
+	SetVocabCacheSize(6)
+	ass.False(cached("c"), "shrinking the budget evicts")
+	ass.True(cached("a"))
+	SetVocabCacheSize(0)
+	ass.False(cached("a"))
+	keep("a")
+	ass.False(cached("a"))
+}
@@ -0,0 +1,204 @@
+package tiktoken
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffVocabs(t *testing.T) {
+	ass := assert.New(t)
+	a := map[string]int{"a": 0, "b": 1, "ab": 2, "abc": 3}
+	b := map[string]int{"a": 0, "b": 1, "abc": 2, "bc": 4, "c": 3}
+
+	diff := DiffVocabs(a, b)
+	ass.Equal([]VocabEntry{{Token: []byte("ab"), Rank: 2}}, diff.OnlyInA)
+	ass.Equal([]VocabEntry{{Token: []byte("c"), Rank: 3}, {Token: []byte("bc"), Rank: 4}}, diff.OnlyInB)
+	ass.Equal([]RankChange{{Token: []byte("abc"), RankA: 3, RankB: 2}}, diff.Changed)
+
+	same := DiffVocabs(a, a)
+	ass.Empty(same.OnlyInA)
+	ass.Empty(same.OnlyInB)
+	ass.Empty(same.Changed)
+}
+
+func TestTiktokenDiffVocab(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	extra := *enc.pbeEncoding
+	extra.SpecialTokens = map[string]int{ENDOFTEXT: 151643, IM_START: 151644, "<|custom|>": 151900}
+	other, err := newTiktokenFromEncoding(&extra)
+	ass.Nil(err)
+
+	diff := enc.DiffVocab(other)
+	ass.Equal([]VocabEntry{{Token: []byte("<|custom|>"), Rank: 151900}}, diff.OnlyInB)
+	ass.Len(diff.OnlyInA, 206)
+	ass.Empty(diff.Changed)
+}
+
+func TestVocabIterAndExport(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	var ids []int
+	enc.VocabIter(func(id int, token []byte) bool {
+		ids = append(ids, id)
+		return len(ids) < 3
+	})
+	ass.Equal([]int{0, 1, 2}, ids)
+	count := 0
+	last := -1
+	enc.SpecialTokenIter(func(id int, token []byte) bool {
+		ass.Greater(id, last)
+		last = id
+		count++
+		return true
+	})
+	ass.Equal(208, count)
+
+	var rankFile bytes.Buffer
+	ass.Nil(enc.ExportVocab(&rankFile, "tiktoken"))
+	contents, err := tiktokenFS.ReadFile("tiktoken/qwen.tiktoken")
+	ass.Nil(err)
+	ass.Equal(string(contents), rankFile.String())
+	ranks, err := parseTiktokenBpe(rankFile.Bytes())
+	ass.Nil(err)
+	ass.Equal(enc.bpe.encoder, ranks)
+
+	var tsv bytes.Buffer
+	ass.Nil(enc.ExportVocab(&tsv, "tsv"))
+	lines := strings.Split(strings.TrimSuffix(tsv.String(), "\n"), "\n")
+	ass.Equal("id\ttoken\tkind", lines[0])
+	ass.Equal("0\tIQ==\tordinary", lines[1])
+	ass.Equal("151643\tPHxlbmRvZnRleHR8Pg==\tspecial", lines[len(enc.bpe.encoder)+1])
+	ass.Len(lines, 1+len(enc.bpe.encoder)+208)
+
+	ass.EqualError(enc.ExportVocab(&tsv, "yaml"), `unknown vocabulary format "yaml"`)
+}
+
+func TestImportVocab(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	var js bytes.Buffer
+	ass.Nil(enc.ExportVocab(&js, "json"))
+	var v vocabJSON
+	ass.Nil(json.Unmarshal(js.Bytes(), &v))
+	ass.Equal(MODEL_QWEN_BASE, v.Name)
+	ass.Equal(qwenRankHash, v.ContentHash)
+	ass.Equal(vocabJSONRank{Token: "21", Rank: 0}, v.Ranks[0])
+	ass.Equal(151643, v.SpecialTokens[ENDOFTEXT])
+
+	imported, err := ImportVocab(bytes.NewReader(js.Bytes()), "json")
+	ass.Nil(err)
+	ass.Equal(MODEL_QWEN_BASE, imported.Name)
+	ass.Equal(enc.pbeEncoding.PatStr, imported.PatStr)
+	ass.Equal(enc.bpe.encoder, imported.MergeableRanks)
+	ass.Equal(enc.SpecialTokens(), imported.SpecialTokens)
+	tk, err := newTiktokenFromEncoding(imported)
+	ass.Nil(err)
+	ass.Equal(enc.ContentHash(), tk.ContentHash())
+	ass.Equal([]int{14990, 1879}, tk.Encode("hello world", nil, nil))
+
+	for _, format := range []string{"tiktoken", "tsv"} {
+		var out bytes.Buffer
+		ass.Nil(enc.ExportVocab(&out, format))
+		imported, err := ImportVocab(&out, format)
+		ass.Nil(err, format)
+		ass.Equal(enc.bpe.encoder, imported.MergeableRanks, format)
+		ass.Empty(imported.PatStr, format)
+		if format == "tsv" {
+			ass.Equal(enc.SpecialTokens(), imported.SpecialTokens)
+		} else {
+			ass.Empty(imported.SpecialTokens)
+		}
+	}
+
+	tampered := strings.Replace(js.String(), `{"token":"21","rank":0}`, `{"token":"22","rank":0},{"token":"21","rank":0}`, 1)
+	_, err = ImportVocab(strings.NewReader(tampered), "json")
+	ass.EqualError(err, `vocabulary entry 2: duplicate token "\""`)
+	tampered = strings.Replace(js.String(), `{"token":"21","rank":0}`, `{"token":"21","rank":1000000}`, 1)
+	_, err = ImportVocab(strings.NewReader(tampered), "json")
+	ass.ErrorIs(err, ErrHashMismatch)
+	_, err = ImportVocab(strings.NewReader(`{"ranks": [{"token": "zz", "rank": 0}]}`), "json")
+	ass.ErrorContains(err, "vocabulary entry 0: ")
+	_, err = ImportVocab(strings.NewReader("id\ttoken\tkind\n0\tIQ==\tother\n"), "tsv")
+	ass.EqualError(err, `vocabulary line 2: unknown kind "other"`)
+	_, err = ImportVocab(strings.NewReader("0\tIQ==\tordinary\n"), "tsv")
+	ass.EqualError(err, "vocabulary: missing header line")
+	_, err = ImportVocab(strings.NewReader(""), "yaml")
+	ass.EqualError(err, `unknown vocabulary format "yaml"`)
+}
+
+func TestFindTokens(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+
+	bruteForce := func(match func(token []byte) bool) []TokenMatch {
+		want := []TokenMatch{}
+		visit := func(special bool) func(int, []byte) bool {
+			return func(id int, token []byte) bool {
+				if match(token) {
+					want = append(want, TokenMatch{id, token, special})
+				}
+				return true
+			}
+		}
+		enc.VocabIter(visit(false))
+		enc.SpecialTokenIter(visit(true))
+		sort.Slice(want, func(i, j int) bool { return want[i].Token < want[j].Token })
+		return want
+	}
+
+	prefix := enc.FindTokens([]byte(" hel"), MatchPrefix)
+	ass.NotEmpty(prefix)
+	ass.Equal(bruteForce(func(b []byte) bool { return bytes.HasPrefix(b, []byte(" hel")) }), prefix)
+	contains := enc.FindTokens([]byte("ello"), MatchContains)
+	ass.Equal(bruteForce(func(b []byte) bool { return bytes.Contains(b, []byte("ello")) }), contains)
+	ass.Greater(len(contains), len(enc.FindTokens([]byte("ello"), MatchPrefix)))
+
+	ass.Equal([]TokenMatch{{14990, []byte("hello"), false}}, enc.FindTokens([]byte("hello"), MatchExact))
+	ass.Equal([]TokenMatch{{151644, []byte(IM_START), true}, {151645, []byte(IM_END), true}}, enc.FindTokens([]byte("<|im_"), MatchPrefix))
+	ass.Equal([]TokenMatch{{151645, []byte(IM_END), true}}, enc.FindTokens([]byte("im_end"), MatchContains))
+	ass.Empty(enc.FindTokens([]byte("hello"), MatchMode(9)))
+
+	// results are copies
+	prefix[0].Bytes[0] = 'X'
+	ass.Equal(byte(' '), enc.FindTokens([]byte(" hel"), MatchPrefix)[0].Bytes[0])
+}
+
+func TestRank(t *testing.T) {
+	ass := assert.New(t)
+	enc, err := GetEncoding(MODEL_QWEN_BASE)
+	ass.Nil(err)
+	hello := []byte("hello")
+	special := []byte("<|endoftext|>")
+
+	rank, ok := enc.Rank(hello)
+	ass.True(ok)
+	ass.Equal(14990, rank)
+	_, ok = enc.Rank(special)
+	ass.False(ok, "special tokens have no rank")
+	id, ok := enc.SpecialRank(special)
+	ass.True(ok)
+	ass.Equal(151643, id)
+	_, ok = enc.SpecialRank(hello)
+	ass.False(ok)
+
+	ass.True(enc.HasToken(hello))
+	ass.True(enc.HasToken(special))
+	ass.False(enc.HasToken([]byte("hello world, not a token")))
+	ass.Zero(testing.AllocsPerRun(100, func() {
+		enc.Rank(hello)
+		enc.HasToken(special)
+	}))
+}
@@ -0,0 +1,131 @@
+package tiktoken
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WarmupError collects the errors of the encodings Warmup failed to load.
+type WarmupError struct {
+	Errors map[string]error
+}
+
+func (e *WarmupError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+	return fmt.Sprintf("warmup failed for %d encodings: %s", len(names), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the individual encodings, so errors.Is and
+// errors.As look through them.
+func (e *WarmupError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// WarmupProgress reports an encoding that WarmupWithProgress has finished
+// loading, or failed to load.
+type WarmupProgress struct {
+	Name    string
+	Err     error
+	Elapsed time.Duration
+	// Done counts the encodings finished so far, including this one, out
+	// of Total.
+	Done, Total int
+}
+
+// Warmup loads the named encodings concurrently and caches them the way
+// GetEncoding does, so that the first request using them doesn't pay for
+// the download and parsing. No names mean all built-in encodings, which
+// includes llama3 and so fails for it unless its tokenizer model is set.
+// Encodings already cached are not loaded again, which makes a second call
+// cheap. Use WarmupWithProgress, or WithLoadHandler on the loader, to
+// observe the progress.
+//
+// Failures of individual encodings are returned together as a *WarmupError
+// once all have been tried; the others are cached and usable. If ctx is
+// done first, Warmup returns ctx.Err() without waiting. Loads can't be
+// interrupted, so those under way still complete and are cached.
+func Warmup(ctx context.Context, names ...string) error {
+	return WarmupWithProgress(ctx, nil, names...)
+}
+
+// WarmupAll is Warmup of all built-in encodings.
+func WarmupAll(ctx context.Context) error {
+	return Warmup(ctx)
+}
+
+// WarmupWithProgress is Warmup calling progress, if not nil, as each
+// encoding finishes. The calls come one at a time from the goroutine of
+// WarmupWithProgress, and stop when ctx is done.
+func WarmupWithProgress(ctx context.Context, progress func(WarmupProgress), names ...string) error {
+	if len(names) == 0 {
+		for _, name := range builtinEncodings {
+			names = append(names, string(name))
+		}
+	}
+
+	type result struct {
+		name    string
+		err     error
+		elapsed time.Duration
+	}
+	results := make(chan result, len(names))
+	for _, name := range names {
+		go func(name string) {
+			start := time.Now()
+			_, err := GetEncoding(name)
+			results <- result{name, err, time.Since(start)}
+		}(name)
+	}
+
+	errs := map[string]error{}
+	for done := 1; done <= len(names); done++ {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				errs[r.name] = r.err
+			}
+			if progress != nil {
+				progress(WarmupProgress{Name: r.name, Err: r.err, Elapsed: r.elapsed, Done: done, Total: len(names)})
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if len(errs) > 0 {
+		return &WarmupError{Errors: errs}
+	}
+	return nil
+}
+
+// PrefetchEncodings starts to warm up the named encodings in the
+// background, as Warmup does, and returns without waiting, e.g. while a
+// service is still starting up. It only fails for names that aren't
+// built-in or registered encodings, in which case nothing is prefetched.
+// A failed load is tried again by the first GetEncoding, which reports its
+// error; run WarmupWithProgress in a goroutine to observe the loads.
+func PrefetchEncodings(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		if _, err := ParseEncoding(name); err != nil {
+			return err
+		}
+	}
+	go func() {
+		_ = Warmup(ctx, names...)
+	}()
+	return nil
+}
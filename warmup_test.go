@@ -0,0 +1,123 @@
+package tiktoken
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmup(t *testing.T) {
+	ass := assert.New(t)
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+
+	var mu sync.Mutex
+	var fetched, loaded []string
+	fetcher := FetcherFunc(func(ctx context.Context, uri string) ([]byte, error) {
+		mu.Lock()
+		fetched = append(fetched, uri)
+		mu.Unlock()
+		return []byte("YQ== 0\nYg== 1\n"), nil
+	})
+	onLoad := func(uri string, elapsed time.Duration, err error) {
+		ass.Nil(err)
+		mu.Lock()
+		loaded = append(loaded, uri)
+		mu.Unlock()
+	}
+	loader := NewDefaultBpeLoader(WithFetcher("mem", fetcher), WithLoadHandler(onLoad))
+	for _, name := range []string{"warmup_test_a", "warmup_test_b"} {
+		name := name
+		RegisterEncoding(name, func() (*Encoding, error) {
+			return newEncodingFromRankFile(loader, name, "mem://vocab/"+name+".tiktoken", `\w+`, nil)
+		})
+		defer ReleaseEncoding(name)
+	}
+
+	err := Warmup(context.Background(), "warmup_test_a", "warmup_test_b", "warmup_test_missing")
+	var warmupErr *WarmupError
+	ass.True(errors.As(err, &warmupErr))
+	ass.Len(warmupErr.Errors, 1)
+	ass.ErrorIs(err, ErrEncodingNotFound)
+	ass.ElementsMatch([]string{"mem://vocab/warmup_test_a.tiktoken", "mem://vocab/warmup_test_b.tiktoken"}, fetched)
+	ass.ElementsMatch(fetched, loaded)
+
+	// the encodings that loaded are cached
+	tl.Lock()
+	_, cached := tiktokenMap["warmup_test_a"]
+	tl.Unlock()
+	ass.True(cached)
+	tk, err := GetEncoding("warmup_test_b")
+	ass.Nil(err)
+	ass.Equal([]int{0, 1}, tk.EncodeOrdinary("a b"))
+	ass.Nil(Warmup(context.Background(), "warmup_test_a", "warmup_test_b"))
+	ass.Len(fetched, 2, "warm encodings should not be loaded again")
+}
+
+func TestWarmupCanceled(t *testing.T) {
+	ass := assert.New(t)
+	release := make(chan struct{})
+	RegisterEncoding("warmup_test_slow", func() (*Encoding, error) {
+		<-release
+		return &Encoding{Name: "warmup_test_slow", PatStr: `\w+`, MergeableRanks: map[string]int{"a": 0}}, nil
+	})
+	defer ReleaseEncoding("warmup_test_slow")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ass.ErrorIs(Warmup(ctx, "warmup_test_slow"), context.Canceled)
+
+	// the load goes on and is cached
+	close(release)
+	tk, err := GetEncoding("warmup_test_slow")
+	ass.Nil(err)
+	ass.Equal([]int{0}, tk.EncodeOrdinary("a"))
+}
+
+func TestWarmupWithProgress(t *testing.T) {
+	ass := assert.New(t)
+	RegisterEncoding("warmup_test_progress", func() (*Encoding, error) {
+		return &Encoding{Name: "warmup_test_progress", PatStr: `\w+`, MergeableRanks: map[string]int{"a": 0}}, nil
+	})
+	defer ReleaseEncoding("warmup_test_progress")
+
+	var progress []WarmupProgress
+	err := WarmupWithProgress(context.Background(), func(p WarmupProgress) {
+		progress = append(progress, p)
+	}, "warmup_test_progress", "warmup_test_missing")
+	ass.ErrorIs(err, ErrEncodingNotFound)
+	ass.Len(progress, 2)
+	for i, p := range progress {
+		ass.Equal(i+1, p.Done)
+		ass.Equal(2, p.Total)
+		if p.Name == "warmup_test_missing" {
+			ass.ErrorIs(p.Err, ErrEncodingNotFound)
+		} else {
+			ass.Equal("warmup_test_progress", p.Name)
+			ass.Nil(p.Err)
+		}
+	}
+}
+
+func TestPrefetchEncodings(t *testing.T) {
+	ass := assert.New(t)
+	release := make(chan struct{})
+	RegisterEncoding("warmup_test_prefetch", func() (*Encoding, error) {
+		<-release
+		return &Encoding{Name: "warmup_test_prefetch", PatStr: `\w+`, MergeableRanks: map[string]int{"a": 0}}, nil
+	})
+	defer ReleaseEncoding("warmup_test_prefetch")
+
+	ass.ErrorIs(PrefetchEncodings(context.Background(), "warmup_test_prefetch", "warmup_test_missing"), ErrEncodingNotFound)
+	ass.Nil(PrefetchEncodings(context.Background(), "warmup_test_prefetch"), "returns before the load")
+	close(release)
+	ass.Eventually(func() bool {
+		tl.Lock()
+		defer tl.Unlock()
+		_, cached := tiktokenMap["warmup_test_prefetch"]
+		return cached
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,115 @@
+//go:build js && wasm
+
+// Command wasm exposes the encoder to JavaScript, so a web page counts
+// tokens exactly like a Go backend does:
+//
+//	GOOS=js GOARCH=wasm go build -o tiktoken.wasm github.com/pkoukk/tiktoken-go/wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Once the module runs, the global tiktoken object has getEncoding(name)
+// and encodingForModel(model), which return promises of an encoder with
+//
+//	encode(text, allowedSpecial?) // an array of token ids
+//	decode(tokens)                // a string
+//	countTokens(text)             // a number
+//
+// allowedSpecial is an array of special tokens or "all"; unlisted ones are
+// encoded as text. Rank files are downloaded with fetch and kept in memory,
+// and qwen_base is embedded.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+func main() {
+	js.Global().Set("tiktoken", js.ValueOf(map[string]any{
+		"getEncoding":      loader(tiktoken.GetEncoding),
+		"encodingForModel": loader(tiktoken.EncodingForModel),
+	}))
+	// the functions must outlive main
+	select {}
+}
+
+// loader wraps load as a function returning a promise of the encoder of
+// its argument. Loading may download and so runs outside the event loop.
+func loader(load func(string) (*tiktoken.Tiktoken, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) any {
+		name := ""
+		if len(args) > 0 {
+			name = args[0].String()
+		}
+		executor := js.FuncOf(func(this js.Value, args []js.Value) any {
+			resolve, reject := args[0], args[1]
+			go func() {
+				enc, err := load(name)
+				if err != nil {
+					reject.Invoke(js.Global().Get("Error").New(err.Error()))
+					return
+				}
+				resolve.Invoke(encoder(enc))
+			}()
+			return nil
+		})
+		defer executor.Release()
+		return js.Global().Get("Promise").New(executor)
+	})
+}
+
+// encoder returns the JavaScript object of enc.
+func encoder(enc *tiktoken.Tiktoken) js.Value {
+	return js.ValueOf(map[string]any{
+		"name": enc.Name(),
+		"encode": js.FuncOf(func(this js.Value, args []js.Value) any {
+			if len(args) == 0 {
+				return js.ValueOf([]any{})
+			}
+			var allowed []string
+			if len(args) > 1 {
+				allowed = stringsOf(args[1])
+			}
+			tokens, err := enc.EncodeWithError(args[0].String(), allowed, []string{})
+			if err != nil {
+				return js.Global().Get("Error").New(err.Error())
+			}
+			out := make([]any, len(tokens))
+			for i, token := range tokens {
+				out[i] = token
+			}
+			return js.ValueOf(out)
+		}),
+		"decode": js.FuncOf(func(this js.Value, args []js.Value) any {
+			if len(args) == 0 {
+				return ""
+			}
+			tokens := make([]int, args[0].Length())
+			for i := range tokens {
+				tokens[i] = args[0].Index(i).Int()
+			}
+			return enc.Decode(tokens)
+		}),
+		"countTokens": js.FuncOf(func(this js.Value, args []js.Value) any {
+			if len(args) == 0 {
+				return 0
+			}
+			return enc.CountTokens(args[0].String())
+		}),
+	})
+}
+
+// stringsOf converts "all" or an array of strings.
+func stringsOf(v js.Value) []string {
+	if v.Type() == js.TypeString {
+		return []string{v.String()}
+	}
+	if v.Type() != js.TypeObject {
+		return nil
+	}
+	out := make([]string, v.Length())
+	for i := range out {
+		out[i] = v.Index(i).String()
+	}
+	return out
+}